@@ -0,0 +1,137 @@
+package compressor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"file-compressor/constants"
+	"file-compressor/encryption"
+	"file-compressor/format"
+	"file-compressor/utils"
+)
+
+// AppendFiles adds files to an archive as written by the CLI. The Huffman codes of an archive
+// are built from all of its files, so new files cannot simply be appended after the existing
+// entries: the archive is extracted into a temporary directory next to it, and the old and new
+// files are compressed again with the algorithm of the archive. This takes as long as creating
+// the archive from scratch. The archive is only replaced once the new one is complete.
+//
+// The entries keep their names, modification times and permissions, the new files are named
+// like they are by Compress. The new archive is encrypted with the password and options, the
+// cipher and key derivation function of the old archive are not kept.
+//
+// Parameters:
+//   - archivePath: The path to the archive.
+//   - password: The password the archive is encrypted with, empty when it is not.
+//   - newFiles: The files and directories to add.
+//   - options: Optional encryption settings, used to decrypt the old and encrypt the new archive.
+//
+// Returns:
+//   - error: if the archive cannot be decrypted or extracted, if a new file has the name of an
+//     entry of the archive, or if the new archive cannot be written
+func AppendFiles(archivePath, password string, newFiles []string, options ...encryption.EncryptionOptions) error {
+	ctx := context.Background()
+
+	tempDir, err := os.MkdirTemp(filepath.Dir(archivePath), "squirrelzip-append-*")
+	if err != nil {
+		return fmt.Errorf(constants.FILE_CREATE_ERROR, err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	algorithm, err := extractForAppend(ctx, archivePath, password, tempDir, options...)
+	if err != nil {
+		return err
+	}
+
+	// the extracted entries are named relative to tempDir, like the files they were compressed from
+	extracted, err := os.ReadDir(tempDir)
+	if err != nil {
+		return fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	inputs := []string{}
+	for _, entry := range extracted {
+		inputs = append(inputs, filepath.Join(tempDir, entry.Name()))
+	}
+	for _, file := range newFiles {
+		name := filepath.Base(file)
+		if _, err := os.Lstat(filepath.Join(tempDir, name)); err == nil {
+			return fmt.Errorf("cannot append %s, the archive has an entry named %s already", file, name)
+		}
+		inputs = append(inputs, file)
+	}
+
+	compressed, err := os.CreateTemp(tempDir, "archive-*"+constants.COMPRESSED_FILE_EXT)
+	if err != nil {
+		return fmt.Errorf(constants.FILE_CREATE_ERROR, err)
+	}
+	defer compressed.Close()
+
+	if _, err := ReadAndCompressFiles(inputs, compressed, algorithm); err != nil {
+		return err
+	}
+	if _, err := compressed.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+
+	// the new archive replaces the old one only once it is complete
+	archive, err := os.CreateTemp(filepath.Dir(archivePath), filepath.Base(archivePath)+".*")
+	if err != nil {
+		return fmt.Errorf(constants.FILE_CREATE_ERROR, err)
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	buffered := bufio.NewWriterSize(archive, constants.BUFFER_SIZE)
+	if err := encryption.EncryptStream(ctx, compressed, buffered, password, options...); err != nil {
+		return fmt.Errorf(constants.FAILED_TO_ENCRYPT, err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+
+	if err := os.Rename(archive.Name(), archivePath); err != nil {
+		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+	return nil
+}
+
+// extractForAppend extracts every entry of the archive below outputDir and returns the
+// algorithm the archive is compressed again with.
+func extractForAppend(ctx context.Context, archivePath, password, outputDir string, options ...encryption.EncryptionOptions) (string, error) {
+	archiveFile, archive, err := openArchive(archivePath, archiveVerifyKey(options))
+	if err != nil {
+		return "", err
+	}
+
+	defer archiveFile.Close()
+
+	var header format.ContainerHeader
+	err = encryption.DecryptPipe(ctx, archive, password, func(plaintext io.Reader) error {
+		buffered := bufio.NewReaderSize(plaintext, constants.BUFFER_SIZE)
+		if header, err = readHeader(buffered); err != nil {
+			return err
+		}
+		_, err = decompressPayload(ctx, buffered, header, outputDir, nil)
+		return err
+	}, options...)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case header.Version == format.VERSION_1:
+		// archives without a version field only hold Huffman data
+		return string(utils.HUFFMAN), nil
+	case utils.Algorithm(header.Algorithm) == utils.HUFFMAN_STREAM:
+		// ReadAndCompressFiles streams by itself when its output cannot seek
+		return string(utils.HUFFMAN), nil
+	}
+	return header.Algorithm, nil
+}
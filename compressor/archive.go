@@ -0,0 +1,282 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"file-compressor/encryption"
+	"file-compressor/utils"
+)
+
+// Archive is an archive opened for reading its entries one at a time, see OpenArchive and FS.
+type Archive struct {
+	path     string
+	password string
+	options  []encryption.EncryptionOptions
+	entries  []utils.EntryInfo
+	// files holds the entries by their name, dirs the names of the files and directories of
+	// every directory, "." for the root
+	files map[string]utils.EntryInfo
+	dirs  map[string]map[string]bool
+}
+
+// OpenArchive lists the entries of the archive at archivePath, decrypting it with password
+// when it is encrypted. The data is not read, every entry is decompressed when it is read
+// through FS.
+//
+// Parameters:
+//   - archivePath: The path of the archive.
+//   - password: The password of an encrypted archive, ignored otherwise.
+//   - options: Optional settings for the decryption, such as the key file.
+//
+// Returns:
+//   - *Archive: the opened archive.
+//   - error: An error if the archive cannot be read or the password is wrong.
+func OpenArchive(archivePath, password string, options ...encryption.EncryptionOptions) (*Archive, error) {
+	entries, err := ListArchive(archivePath, password, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &Archive{
+		path:     archivePath,
+		password: password,
+		options:  options,
+		entries:  entries,
+		files:    map[string]utils.EntryInfo{},
+		dirs:     map[string]map[string]bool{".": {}},
+	}
+	for _, entry := range entries {
+		// an entry that would be extracted outside of the output directory has no path in FS
+		if !fs.ValidPath(entry.Name) || entry.Name == "." {
+			continue
+		}
+		archive.files[entry.Name] = entry
+		for name := entry.Name; name != "."; name = path.Dir(name) {
+			parent := path.Dir(name)
+			if archive.dirs[parent] == nil {
+				archive.dirs[parent] = map[string]bool{}
+			}
+			archive.dirs[parent][path.Base(name)] = true
+		}
+	}
+	return archive, nil
+}
+
+// Entries returns the entries of the archive in archive order.
+func (a *Archive) Entries() []utils.EntryInfo {
+	return a.entries
+}
+
+// FS returns the entries of the archive as a read-only filesystem, for fs.ReadFile, fs.WalkDir,
+// http.FS or template.ParseFS. The directories are made up from the entry names. A file is
+// decompressed on its first Read, only its entry is written, the others are skipped or decoded
+// and discarded, so reading every file of a Huffman archive decodes it once per file.
+func (a *Archive) FS() fs.FS {
+	return archiveFS{archive: a}
+}
+
+// readEntry decompresses the entry with the given name. When several entries have that name,
+// the data of the last one is returned, the file extraction would leave.
+func (a *Archive) readEntry(name string) ([]byte, error) {
+	archiveFile, archive, err := openArchive(a.path, archiveVerifyKey(a.options))
+	if err != nil {
+		return nil, err
+	}
+	defer archiveFile.Close()
+
+	var data bytes.Buffer
+	opts := []utils.Option{utils.WithEntryWriter(func(entry string) (io.Writer, error) {
+		if entry != name {
+			return io.Discard, nil
+		}
+		data.Reset()
+		return &data, nil
+	})}
+	// the patterns cannot be escaped on Windows, a name with one of their characters decodes
+	// every entry
+	if !strings.ContainsAny(name, `*?[\`) {
+		opts = append(opts, utils.WithEntries([]string{name}))
+	}
+
+	container, magic, err := sniffContainer(archive)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckContainer(container, magic); err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	if container != CONTAINER_ENCRYPTED {
+		_, err = DecompressStream(ctx, archive, "", nil, opts...)
+	} else {
+		err = encryption.DecryptPipe(ctx, archive, a.password, func(plaintext io.Reader) error {
+			_, err := DecompressStream(ctx, plaintext, "", nil, opts...)
+			return err
+		}, a.options...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+// archiveFS is the fs.FS of an Archive.
+type archiveFS struct {
+	archive *Archive
+}
+
+// Open opens the file or the directory with the given name, "." is the root of the archive.
+func (f archiveFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if entry, found := f.archive.files[name]; found {
+		return &archiveFile{archive: f.archive, entry: entry}, nil
+	}
+	if _, found := f.archive.dirs[name]; found {
+		entries, err := f.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+		return &archiveDir{name: name, entries: entries}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir returns the files and directories of the directory with the given name, sorted by
+// name.
+func (f archiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	children, found := f.archive.dirs[name]
+	if !found {
+		if _, isFile := f.archive.files[name]; isFile {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+		}
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	names := make([]string, 0, len(children))
+	for child := range children {
+		names = append(names, child)
+	}
+	sort.Strings(names)
+
+	entries := make([]fs.DirEntry, len(names))
+	for i, child := range names {
+		entries[i] = fs.FileInfoToDirEntry(f.stat(path.Join(name, child)))
+	}
+	return entries, nil
+}
+
+// stat returns the fs.FileInfo of a file or a directory of the archive, a name that is both
+// is a file.
+func (f archiveFS) stat(name string) fs.FileInfo {
+	if entry, found := f.archive.files[name]; found {
+		return entryInfo{entry: entry}
+	}
+	return dirInfo{name: path.Base(name)}
+}
+
+// archiveFile is an entry opened through FS, it is decompressed on its first Read.
+type archiveFile struct {
+	archive *Archive
+	entry   utils.EntryInfo
+	data    *bytes.Reader
+	closed  bool
+}
+
+func (f *archiveFile) Stat() (fs.FileInfo, error) {
+	return entryInfo{entry: f.entry}, nil
+}
+
+func (f *archiveFile) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.entry.Name, Err: fs.ErrClosed}
+	}
+	if f.data == nil {
+		data, err := f.archive.readEntry(f.entry.Name)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.entry.Name, Err: err}
+		}
+		f.data = bytes.NewReader(data)
+	}
+	return f.data.Read(p)
+}
+
+func (f *archiveFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.entry.Name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	f.data = nil
+	return nil
+}
+
+// archiveDir is a directory opened through FS.
+type archiveDir struct {
+	name    string
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *archiveDir) Stat() (fs.FileInfo, error) {
+	return dirInfo{name: path.Base(d.name)}, nil
+}
+
+func (d *archiveDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir returns the next n entries of the directory, all remaining ones when n <= 0.
+func (d *archiveDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+	return remaining[:n], nil
+}
+
+func (d *archiveDir) Close() error {
+	return nil
+}
+
+// entryInfo is the fs.FileInfo of an entry.
+type entryInfo struct {
+	entry utils.EntryInfo
+}
+
+func (i entryInfo) Name() string       { return path.Base(i.entry.Name) }
+func (i entryInfo) Size() int64        { return int64(i.entry.OriginalSize) }
+func (i entryInfo) Mode() fs.FileMode  { return i.entry.Mode.Perm() }
+func (i entryInfo) ModTime() time.Time { return i.entry.ModTime }
+func (i entryInfo) IsDir() bool        { return false }
+func (i entryInfo) Sys() any           { return i.entry }
+
+// dirInfo is the fs.FileInfo of a directory made up from the entry names.
+type dirInfo struct {
+	name string
+}
+
+func (i dirInfo) Name() string       { return i.name }
+func (i dirInfo) Size() int64        { return 0 }
+func (i dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0o755 }
+func (i dirInfo) ModTime() time.Time { return time.Time{} }
+func (i dirInfo) IsDir() bool        { return true }
+func (i dirInfo) Sys() any           { return nil }
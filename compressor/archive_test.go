@@ -0,0 +1,117 @@
+package compressor
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"file-compressor/encryption"
+	"file-compressor/utils"
+)
+
+func TestArchiveFS(t *testing.T) {
+	inputDir := filepath.Join(t.TempDir(), "tree")
+	contents := map[string]string{
+		"top.txt":              "at the top",
+		"docs/readme.md":       "# read me",
+		"docs/guide/intro.txt": "the introduction of the guide",
+		"src/main.go":          "package main",
+	}
+	for name, content := range contents {
+		path := filepath.Join(inputDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		password string
+		opts     []utils.Option
+	}{
+		{name: "huffman encrypted", password: "password123"},
+		{name: "tar.gz", opts: []utils.Option{utils.WithArchiveFormat(utils.TARGZ)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			compressedPath, _, err := Compress(context.Background(), []string{inputDir}, t.TempDir(), string(utils.HUFFMAN), tc.opts...)
+			if err != nil {
+				t.Fatalf("failed to compress: %v", err)
+			}
+			archivePath := compressedPath
+			if tc.password != "" {
+				archivePath = encryptFile(t, compressedPath, tc.password)
+			}
+
+			archive, err := OpenArchive(archivePath, tc.password)
+			if err != nil {
+				t.Fatalf("failed to open the archive: %v", err)
+			}
+			fsys := archive.FS()
+
+			data, err := fs.ReadFile(fsys, "tree/docs/guide/intro.txt")
+			if err != nil || string(data) != contents["docs/guide/intro.txt"] {
+				t.Fatalf("expected the content of intro.txt, got %q (%v)", data, err)
+			}
+
+			walked := []string{}
+			err = fs.WalkDir(fsys, ".", func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if entry.IsDir() {
+					walked = append(walked, path+"/")
+				} else {
+					walked = append(walked, path)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("failed to walk the archive: %v", err)
+			}
+			expected := []string{"./", "tree/", "tree/docs/", "tree/docs/guide/", "tree/docs/guide/intro.txt", "tree/docs/readme.md", "tree/src/", "tree/src/main.go", "tree/top.txt"}
+			if !reflect.DeepEqual(walked, expected) {
+				t.Fatalf("expected to walk %v, got %v", expected, walked)
+			}
+
+			if _, err := fsys.Open("tree/missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+				t.Fatalf("expected fs.ErrNotExist for a missing file, got %v", err)
+			}
+			if _, err := fsys.Open("../tree/top.txt"); !errors.Is(err, fs.ErrInvalid) {
+				t.Fatalf("expected fs.ErrInvalid for an invalid path, got %v", err)
+			}
+
+			if err := fstest.TestFS(fsys, "tree/top.txt", "tree/docs/readme.md", "tree/src/main.go"); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// encryptFile encrypts the archive at compressedPath with password and returns the path of the
+// encrypted archive.
+func encryptFile(t *testing.T, compressedPath, password string) string {
+	compressed, err := os.Open(compressedPath)
+	if err != nil {
+		t.Fatalf("failed to open the archive: %v", err)
+	}
+	defer compressed.Close()
+
+	archivePath := filepath.Join(t.TempDir(), "archive.sq")
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	defer archive.Close()
+	if err := encryption.EncryptStream(context.Background(), compressed, archive, password); err != nil {
+		t.Fatalf("failed to encrypt the archive: %v", err)
+	}
+	return archivePath
+}
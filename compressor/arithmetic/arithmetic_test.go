@@ -0,0 +1,174 @@
+package arithmetic
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+// roundTrip zips the contents as files named 0, 1, ... and unzips them again.
+func roundTrip(t *testing.T, contents ...[]byte) ([][]byte, int64) {
+	dir := t.TempDir()
+
+	files := []utils.FileData{}
+	for i, content := range contents {
+		files = append(files, utils.FileData{
+			Name:   filepath.Join("dir", string(rune('a'+i))),
+			Size:   int64(len(content)),
+			Reader: bytes.NewReader(content),
+		})
+	}
+
+	archivePath := filepath.Join(dir, "archive")
+	output, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	if err := Zip(files, output); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+	output.Close()
+
+	input, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	defer input.Close()
+
+	paths, err := Unzip(input, filepath.Join(dir, "out"))
+	if err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+
+	results := [][]byte{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		results = append(results, data)
+	}
+
+	info, _ := os.Stat(archivePath)
+	return results, info.Size()
+}
+
+func TestRoundTrip(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	cases := map[string][][]byte{
+		"empty":         {{}},
+		"single symbol": {bytes.Repeat([]byte{'a'}, 5000)},
+		"text":          {[]byte("the quick brown fox jumps over the lazy dog"), []byte("second entry")},
+		"all bytes": {func() []byte {
+			b := make([]byte, 256)
+			for i := range b {
+				b[i] = byte(i)
+			}
+			return b
+		}()},
+		"random": {random},
+		"mixed":  {{}, []byte("x"), random[:1000], bytes.Repeat([]byte("ab"), 3000)},
+	}
+
+	for name, contents := range cases {
+		t.Run(name, func(t *testing.T) {
+			results, _ := roundTrip(t, contents...)
+			if len(results) != len(contents) {
+				t.Fatalf("expected %d files, got %d", len(contents), len(results))
+			}
+			for i := range contents {
+				if !bytes.Equal(results[i], contents[i]) {
+					t.Fatalf("file %d does not match: %d bytes, expected %d", i, len(results[i]), len(contents[i]))
+				}
+			}
+		})
+	}
+}
+
+// TestArithmeticLargeInput codes 10KB of text, far more symbols than a float64 interval could
+// tell apart, so every symbol depends on the integer scaling of the coder.
+func TestArithmeticLargeInput(t *testing.T) {
+	words := []string{"squirrel", "nut", "tree", "winter", "store", "the", "a", "and", "buries", "finds"}
+	random := rand.New(rand.NewSource(1))
+
+	text := &bytes.Buffer{}
+	for text.Len() < 10*1024 {
+		text.WriteString(words[random.Intn(len(words))])
+		if random.Intn(12) == 0 {
+			text.WriteString(".\n")
+		} else {
+			text.WriteByte(' ')
+		}
+	}
+	content := text.Bytes()[:10*1024]
+
+	results, size := roundTrip(t, content)
+	if len(results) != 1 || !bytes.Equal(results[0], content) {
+		t.Fatal("the decompressed text does not match the original")
+	}
+	if size >= int64(len(content)) {
+		t.Fatalf("expected text to compress, got %d bytes from %d", size, len(content))
+	}
+}
+
+func TestCompressesSkewedData(t *testing.T) {
+	skewed := bytes.Repeat([]byte("aaaaaaab"), 10000)
+
+	_, size := roundTrip(t, skewed)
+	if size >= int64(len(skewed))/4 {
+		t.Fatalf("expected skewed data to compress well, got %d bytes from %d", size, len(skewed))
+	}
+}
+
+func TestZipRequiresSeeker(t *testing.T) {
+	files := []utils.FileData{{Name: "a.txt", Size: 3, Reader: bytes.NewReader([]byte("abc"))}}
+	output := &bytes.Buffer{}
+	if err := Zip(files, output); err == nil {
+		t.Fatal("expected an error for an output that cannot seek")
+	}
+	if output.Len() != 0 {
+		t.Fatalf("expected nothing to be written, got %d bytes", output.Len())
+	}
+}
+
+func TestScaleFrequencies(t *testing.T) {
+	counts := [256]uint64{}
+	counts['a'] = 1 << 40
+	counts['b'] = 1
+
+	table := scaleFrequencies(counts)
+	if table['b'] == 0 {
+		t.Fatal("a symbol that occurs must keep a frequency")
+	}
+	if newModel(table).total() > maxTotal {
+		t.Fatalf("total %d exceeds %d", newModel(table).total(), maxTotal)
+	}
+}
+
+func TestDecodeDamagedData(t *testing.T) {
+	table := scaleFrequencies([256]uint64{'a': 10, 'b': 1})
+	m := newModel(table)
+
+	var compressed bytes.Buffer
+	if _, err := compressData(bytes.NewReader([]byte("aaaabaaa")), &compressed, m); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+
+	// random bytes must end in an error or a result, never in an endless stream of symbols
+	for seed := int64(0); seed < 50; seed++ {
+		damaged := make([]byte, compressed.Len())
+		rand.New(rand.NewSource(seed)).Read(damaged)
+
+		var output bytes.Buffer
+		decompressData(bytes.NewReader(damaged), &output, m, uint64(len(damaged)))
+		if output.Len() > 1<<20 {
+			t.Fatalf("seed %d: decoded %d bytes from %d", seed, output.Len(), len(damaged))
+		}
+	}
+}
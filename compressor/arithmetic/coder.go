@@ -0,0 +1,226 @@
+package arithmetic
+
+import (
+	"errors"
+	"io"
+)
+
+// The coder works on 32 bit integers, the interval is kept in uint64 so the products
+// with frequencies below maxTotal cannot overflow.
+const (
+	codeBits     = 32
+	topValue     = uint64(1)<<codeBits - 1
+	firstQuarter = topValue/4 + 1
+	half         = 2 * firstQuarter
+	thirdQuarter = 3 * firstQuarter
+)
+
+// errInvalidData is returned when the decoder reaches a symbol the model does not know.
+var errInvalidData = errors.New("invalid arithmetic coded data")
+
+// bitWriter packs bits MSB first.
+type bitWriter struct {
+	output  io.Writer
+	current byte
+	count   uint8
+	written uint64
+}
+
+func (w *bitWriter) writeBit(bit uint64) error {
+	w.current = w.current<<1 | byte(bit)
+	w.count++
+	if w.count == 8 {
+		return w.flushByte()
+	}
+	return nil
+}
+
+func (w *bitWriter) flushByte() error {
+	if _, err := w.output.Write([]byte{w.current}); err != nil {
+		return err
+	}
+	w.written++
+	w.current = 0
+	w.count = 0
+	return nil
+}
+
+// flush writes the last partial byte padded with zeros.
+func (w *bitWriter) flush() error {
+	if w.count == 0 {
+		return nil
+	}
+	w.current <<= 8 - w.count
+	return w.flushByte()
+}
+
+// bitReader unpacks bits MSB first. Past the end of the input it returns zeros,
+// the encoder relies on that instead of writing the trailing bits. The decoder never
+// needs more than codeBits of them, more means the data is damaged.
+type bitReader struct {
+	input   io.Reader
+	current byte
+	count   uint8
+	padding int
+	buf     [1]byte
+}
+
+func (r *bitReader) readBit() (uint64, error) {
+	if r.count == 0 {
+		n, err := r.input.Read(r.buf[:])
+		if n == 0 {
+			if err == io.EOF {
+				r.padding++
+				if r.padding > codeBits {
+					return 0, errInvalidData
+				}
+				return 0, nil
+			}
+			if err != nil {
+				return 0, err
+			}
+			return r.readBit()
+		}
+		r.current = r.buf[0]
+		r.count = 8
+	}
+	r.count--
+	return uint64(r.current>>r.count) & 1, nil
+}
+
+// encoder is an integer arithmetic encoder with underflow handling.
+type encoder struct {
+	bits    *bitWriter
+	model   *model
+	low     uint64
+	high    uint64
+	pending uint64
+}
+
+func newEncoder(output io.Writer, m *model) *encoder {
+	return &encoder{bits: &bitWriter{output: output}, model: m, high: topValue}
+}
+
+// emit writes a bit followed by the pending opposite bits.
+func (e *encoder) emit(bit uint64) error {
+	if err := e.bits.writeBit(bit); err != nil {
+		return err
+	}
+	for ; e.pending > 0; e.pending-- {
+		if err := e.bits.writeBit(bit ^ 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *encoder) encode(symbol int) error {
+	low, high := e.model.bounds(symbol)
+	total := e.model.total()
+
+	width := e.high - e.low + 1
+	e.high = e.low + width*high/total - 1
+	e.low = e.low + width*low/total
+
+	for {
+		switch {
+		case e.high < half:
+			if err := e.emit(0); err != nil {
+				return err
+			}
+		case e.low >= half:
+			if err := e.emit(1); err != nil {
+				return err
+			}
+			e.low -= half
+			e.high -= half
+		case e.low >= firstQuarter && e.high < thirdQuarter:
+			e.pending++
+			e.low -= firstQuarter
+			e.high -= firstQuarter
+		default:
+			return nil
+		}
+		e.low <<= 1
+		e.high = e.high<<1 | 1
+	}
+}
+
+// finish writes enough bits to identify the final interval and flushes the last byte.
+func (e *encoder) finish() error {
+	e.pending++
+	bit := uint64(1)
+	if e.low < firstQuarter {
+		bit = 0
+	}
+	if err := e.emit(bit); err != nil {
+		return err
+	}
+	return e.bits.flush()
+}
+
+// decoder mirrors encoder.
+type decoder struct {
+	bits  *bitReader
+	model *model
+	low   uint64
+	high  uint64
+	value uint64
+}
+
+func newDecoder(input io.Reader, m *model) (*decoder, error) {
+	d := &decoder{bits: &bitReader{input: input}, model: m, high: topValue}
+	for i := 0; i < codeBits; i++ {
+		bit, err := d.bits.readBit()
+		if err != nil {
+			return nil, err
+		}
+		d.value = d.value<<1 | bit
+	}
+	return d, nil
+}
+
+func (d *decoder) decode() (int, error) {
+	if d.value < d.low || d.value > d.high {
+		return 0, errInvalidData
+	}
+
+	total := d.model.total()
+	width := d.high - d.low + 1
+	count := ((d.value-d.low+1)*total - 1) / width
+
+	symbol := d.model.symbolFor(count)
+	if symbol >= numSymbols {
+		return 0, errInvalidData
+	}
+	low, high := d.model.bounds(symbol)
+	if low == high {
+		return 0, errInvalidData
+	}
+
+	d.high = d.low + width*high/total - 1
+	d.low = d.low + width*low/total
+
+	for {
+		switch {
+		case d.high < half:
+		case d.low >= half:
+			d.low -= half
+			d.high -= half
+			d.value -= half
+		case d.low >= firstQuarter && d.high < thirdQuarter:
+			d.low -= firstQuarter
+			d.high -= firstQuarter
+			d.value -= firstQuarter
+		default:
+			return symbol, nil
+		}
+		bit, err := d.bits.readBit()
+		if err != nil {
+			return 0, err
+		}
+		d.low <<= 1
+		d.high = d.high<<1 | 1
+		d.value = d.value<<1 | bit
+	}
+}
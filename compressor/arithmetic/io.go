@@ -0,0 +1,233 @@
+// Package arithmetic implements an arithmetic coding codec with the same streaming
+// contract as hfc: one static frequency model for all entries, followed by the entries.
+package arithmetic
+
+import (
+	"fmt"
+	"io"
+
+	"file-compressor/compressor/framing"
+	"file-compressor/constants"
+	"file-compressor/format"
+	"file-compressor/metrics"
+	"file-compressor/utils"
+)
+
+// Zip compresses multiple files with arithmetic coding and writes them to output.
+// It first counts the byte frequencies of all files and writes the frequency table, then
+// writes the number of files and every entry. The compressed size of an entry is back-filled
+// after its data, so output must also implement io.Seeker, and every file reader must
+// implement io.Seeker because the files are read twice.
+//
+// Parameters:
+//   - files: A slice of utils.FileData representing the files to be compressed.
+//   - output: An io.Writer where the compressed data will be written.
+//   - opts: Optional settings such as utils.WithMetrics.
+//
+// Returns:
+//   - error: An error if any step in the compression process fails.
+func Zip(files []utils.FileData, output io.Writer, opts ...utils.Option) error {
+	options := utils.NewOptions(opts...)
+
+	if err := zipFiles(files, output, options); err != nil {
+		metrics.RecordError(options.Metrics, string(utils.ARITHMETIC), metrics.OP_COMPRESS, err)
+		return err
+	}
+
+	return nil
+}
+
+func zipFiles(files []utils.FileData, output io.Writer, options utils.Options) error {
+	// nothing is written when the headers cannot be back-filled
+	if _, err := framing.Seeker(output, utils.ARITHMETIC); err != nil {
+		return err
+	}
+
+	table, err := buildFrequencyTable(files)
+	if err != nil {
+		return fmt.Errorf(constants.FAILED_GET_FREQ_MAP, err)
+	}
+
+	if err := format.WriteFrequencyTable(output, table); err != nil {
+		return err
+	}
+
+	model := newModel(table)
+	return framing.WriteEntries(files, output, utils.ARITHMETIC, func(input io.Reader, output io.Writer) (uint64, error) {
+		return compressData(input, output, model)
+	}, options)
+}
+
+// buildFrequencyTable counts the bytes of all files and rewinds them.
+func buildFrequencyTable(files []utils.FileData) (format.FrequencyTable, error) {
+	counts := [256]uint64{}
+	for _, file := range files {
+		if err := countFrequencies(file.Reader, &counts); err != nil {
+			return format.FrequencyTable{}, fmt.Errorf(constants.BUFFER_READ_ERROR, err)
+		}
+
+		seeker, ok := file.Reader.(io.Seeker)
+		if !ok {
+			return format.FrequencyTable{}, fmt.Errorf("reader of %s does not support seeking", file.Name)
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return format.FrequencyTable{}, err
+		}
+	}
+
+	return scaleFrequencies(counts), nil
+}
+
+// compressData encodes input followed by the end of entry symbol and returns the number of bytes written.
+func compressData(input io.Reader, output io.Writer, m *model) (uint64, error) {
+	enc := newEncoder(output, m)
+
+	buf := make([]byte, constants.BUFFER_SIZE)
+	for {
+		n, err := input.Read(buf)
+		for _, b := range buf[:n] {
+			if err := enc.encode(int(b)); err != nil {
+				return 0, fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf(constants.BUFFER_READ_ERROR, err)
+		}
+	}
+
+	if err := enc.encode(eofSymbol); err != nil {
+		return 0, fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+	if err := enc.finish(); err != nil {
+		return 0, fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+
+	return enc.bits.written, nil
+}
+
+// decompressData decodes one entry of compressedSize bytes from input into output.
+// The whole entry is consumed, so input is positioned at the next entry afterwards.
+func decompressData(input io.Reader, output io.Writer, m *model, compressedSize uint64) error {
+	entry := &io.LimitedReader{R: input, N: int64(compressedSize)}
+
+	dec, err := newDecoder(entry, m)
+	if err != nil {
+		return fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+
+	buf := make([]byte, 0, constants.BUFFER_SIZE)
+	for {
+		symbol, err := dec.decode()
+		if err != nil {
+			return err
+		}
+		if symbol == eofSymbol {
+			break
+		}
+
+		buf = append(buf, byte(symbol))
+		if len(buf) == cap(buf) {
+			if _, err := output.Write(buf); err != nil {
+				return fmt.Errorf(constants.BUFFER_WRITE_ERROR, err)
+			}
+			buf = buf[:0]
+		}
+	}
+
+	if _, err := output.Write(buf); err != nil {
+		return fmt.Errorf(constants.BUFFER_WRITE_ERROR, err)
+	}
+
+	// skip the padding after the end of entry symbol
+	if _, err := io.Copy(io.Discard, entry); err != nil {
+		return fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	if entry.N > 0 {
+		return fmt.Errorf("entry data ends %d bytes early", entry.N)
+	}
+
+	return nil
+}
+
+// Unzip decompresses an arithmetic coded archive from input and writes the files below outputPath.
+// If the output path is an empty string, the current directory is used.
+//
+// Parameters:
+//   - input: An io.Reader from which the compressed data is read.
+//   - outputPath: A string specifying the directory where the decompressed files will be written.
+//   - opts: Optional settings, the same as for hfc.Unzip.
+//
+// Returns:
+//   - A slice of strings containing the paths of the decompressed files.
+//   - An error if any issue occurs during the decompression process.
+func Unzip(input io.Reader, outputPath string, opts ...utils.Option) ([]string, error) {
+	options := utils.NewOptions(opts...)
+
+	filePaths, err := unzipFiles(input, outputPath, options)
+	if err != nil {
+		metrics.RecordError(options.Metrics, string(utils.ARITHMETIC), metrics.OP_DECOMPRESS, err)
+		return nil, err
+	}
+
+	return filePaths, nil
+}
+
+func unzipFiles(input io.Reader, outputPath string, options utils.Options) ([]string, error) {
+	table, err := format.ReadFrequencyTable(input)
+	if err != nil {
+		return nil, err
+	}
+
+	model := newModel(table)
+	return framing.ReadEntries(input, outputPath, utils.ARITHMETIC, func(input io.Reader, output io.Writer, compressedSize uint64) error {
+		return decompressData(input, output, model, compressedSize)
+	}, options)
+}
+
+// List reads the entry headers of an arithmetic coded archive, skipping the entry data.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the arithmetic payload.
+//
+// Returns:
+//   - []utils.EntryInfo: the entries in archive order
+//   - error: if the archive is truncated
+func List(input io.Reader) ([]utils.EntryInfo, error) {
+	// the frequency table is not needed, but it has to be read to reach the entries
+	if _, err := format.ReadFrequencyTable(input); err != nil {
+		return nil, err
+	}
+
+	return framing.List(input)
+}
+
+// Verify decodes every entry of an arithmetic coded archive without writing anything and
+// reports all damaged entries, like hfc.Verify.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the arithmetic payload.
+//
+// Returns:
+//   - utils.VerifyReport: the collected report. Offsets are relative to the start of input.
+func Verify(input io.Reader) utils.VerifyReport {
+	counter := &utils.CountingReader{Reader: input}
+
+	table, err := format.ReadFrequencyTable(counter)
+	if err != nil {
+		report := utils.VerifyReport{Structural: err.Error()}
+		report.Finish()
+		return report
+	}
+
+	tableLen := counter.BytesRead
+	model := newModel(table)
+	report := utils.VerifyEntries(counter, func(input io.Reader, output io.Writer, compressedSize uint64) error {
+		return decompressData(input, output, model, compressedSize)
+	})
+	// the entries start after the frequency table
+	report.OffsetBy(tableLen)
+	return report
+}
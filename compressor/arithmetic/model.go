@@ -0,0 +1,99 @@
+package arithmetic
+
+import (
+	"io"
+	"sort"
+
+	"file-compressor/format"
+)
+
+const (
+	// eofSymbol marks the end of an entry, it follows the 256 byte values.
+	eofSymbol = 256
+	numSymbols = 257
+
+	// maxTotal bounds the sum of all frequencies so the coder keeps enough precision.
+	maxTotal = 1 << 24
+)
+
+// model is a static frequency model over the byte values and the end of entry symbol.
+type model struct {
+	// cumulative[s] is the sum of the frequencies of all symbols below s,
+	// cumulative[numSymbols] is the total.
+	cumulative [numSymbols + 1]uint64
+}
+
+// newModel builds the model for a frequency table. The end of entry symbol has frequency 1.
+func newModel(table format.FrequencyTable) *model {
+	m := &model{}
+	for symbol := 0; symbol < numSymbols; symbol++ {
+		frequency := uint64(1)
+		if symbol != eofSymbol {
+			frequency = uint64(table[symbol])
+		}
+		m.cumulative[symbol+1] = m.cumulative[symbol] + frequency
+	}
+	return m
+}
+
+func (m *model) total() uint64 {
+	return m.cumulative[numSymbols]
+}
+
+// bounds returns the cumulative frequency range of a symbol.
+func (m *model) bounds(symbol int) (uint64, uint64) {
+	return m.cumulative[symbol], m.cumulative[symbol+1]
+}
+
+// symbolFor returns the symbol whose cumulative range contains count.
+func (m *model) symbolFor(count uint64) int {
+	// the first symbol whose upper bound is above count
+	return sort.Search(numSymbols, func(symbol int) bool {
+		return m.cumulative[symbol+1] > count
+	})
+}
+
+// countFrequencies adds the byte frequencies of input to table.
+func countFrequencies(input io.Reader, table *[256]uint64) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := input.Read(buf)
+		for _, b := range buf[:n] {
+			table[b]++
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// scaleFrequencies converts raw counts into a table whose total, including the end of
+// entry symbol, stays below maxTotal. Symbols that occur keep a frequency of at least 1.
+func scaleFrequencies(counts [256]uint64) format.FrequencyTable {
+	sum := uint64(0)
+	for _, count := range counts {
+		sum += count
+	}
+
+	// room for the end of entry symbol and the rounding up of every symbol
+	target := uint64(maxTotal - numSymbols)
+
+	table := format.FrequencyTable{}
+	for symbol, count := range counts {
+		if count == 0 {
+			continue
+		}
+		if sum > target {
+			count = count * target / sum
+			if count == 0 {
+				count = 1
+			}
+		}
+		table[symbol] = uint32(count)
+	}
+
+	return table
+}
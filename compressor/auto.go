@@ -0,0 +1,226 @@
+package compressor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"file-compressor/compressor/auto"
+	"file-compressor/constants"
+	"file-compressor/format"
+	"file-compressor/utils"
+)
+
+// zipAuto writes the payload of a utils.AUTO archive. auto.Choose picks the algorithm of every
+// file from a sample of its first bytes, and the files are written in groups of the same
+// algorithm, in the order the algorithms were first picked. Every group is the payload of its
+// algorithm after a format.WriteGroupHeader header.
+func zipAuto(files []utils.FileData, output io.Writer, opts ...utils.Option) error {
+	options := utils.NewOptions(opts...)
+
+	groups := map[utils.Algorithm][]utils.FileData{}
+	order := []utils.Algorithm{}
+	for _, file := range files {
+		sample, reader, err := auto.Sample(file.Reader)
+		if err != nil {
+			return fmt.Errorf("failed to sample %s: %w", file.Name, err)
+		}
+		file.Reader = reader
+
+		algorithm := auto.Choose(sample)
+		options.AlgorithmChosen(file.Name, algorithm)
+
+		if _, ok := groups[algorithm]; !ok {
+			order = append(order, algorithm)
+		}
+		groups[algorithm] = append(groups[algorithm], file)
+	}
+
+	// every group reports the total of its own files, the progress is over all of them
+	total := utils.TotalSize(files)
+	opts = append(opts, utils.WithProgress(func(filename string, bytesProcessed, _ int64) {
+		options.Progress(filename, bytesProcessed, total)
+	}))
+
+	_, seekable := output.(io.Seeker)
+
+	for _, algorithm := range order {
+		files := groups[algorithm]
+		// like a whole archive, a Huffman group is streamed when the output cannot seek
+		if algorithm == utils.HUFFMAN && !seekable {
+			algorithm = utils.HUFFMAN_STREAM
+		}
+
+		if err := format.WriteGroupHeader(output, string(algorithm)); err != nil {
+			return err
+		}
+		if err := zipPayload(files, output, algorithm, opts...); err != nil {
+			return err
+		}
+	}
+
+	return format.WriteEntryMarker(output, false)
+}
+
+// readGroupAlgorithm reads the next group header of a utils.AUTO payload, the algorithm is
+// empty after the last group.
+func readGroupAlgorithm(input io.Reader) (utils.Algorithm, error) {
+	name, next, err := format.ReadGroupHeader(input)
+	if err != nil || !next {
+		return "", err
+	}
+
+	algorithm := utils.Algorithm(name)
+	switch algorithm {
+	case utils.AUTO, utils.BZIP2:
+		return "", fmt.Errorf("a group cannot use the %s algorithm", algorithm)
+	}
+	if err := CheckCompressionAlgorithm(name); err != nil {
+		return "", err
+	}
+	return algorithm, nil
+}
+
+// unzipAuto decompresses every group of a utils.AUTO payload with its own algorithm.
+func unzipAuto(input io.Reader, outputDir string, opts ...utils.Option) ([]string, error) {
+	options := utils.NewOptions(opts...)
+
+	// every group counts the extracted bytes from zero, the events continue the previous groups
+	extracted, groupExtracted := int64(0), int64(0)
+	if events := options.ProgressEvents; events != nil {
+		opts = append(opts, utils.WithProgressEvents(func(event utils.ProgressEvent) {
+			groupExtracted = event.BytesProcessed
+			event.BytesProcessed += extracted
+			events(event)
+		}, options.ProgressInterval))
+	}
+
+	var fileNames []string
+	var renamed []utils.RenamedEntry
+	groups := 0
+	for {
+		algorithm, err := readGroupAlgorithm(input)
+		if err != nil {
+			return nil, err
+		}
+		if algorithm == "" {
+			break
+		}
+
+		names, err := WriteAndDecompressFiles(input, outputDir, []byte(algorithm), opts...)
+		if err != nil {
+			return nil, err
+		}
+		extracted += groupExtracted
+		groupExtracted = 0
+
+		// every group writes the manifest of its shortened names, it is rewritten with all of them
+		if len(names) > 0 && filepath.Base(names[len(names)-1]) == utils.RENAMED_MANIFEST {
+			groupRenamed, err := readRenameManifest(names[len(names)-1])
+			if err != nil {
+				return nil, err
+			}
+			renamed = append(renamed, groupRenamed...)
+			names = names[:len(names)-1]
+		}
+
+		fileNames = append(fileNames, names...)
+		groups++
+	}
+
+	if groups < 1 {
+		return nil, errors.New("no files to decompress")
+	}
+
+	if len(renamed) > 0 {
+		manifestPath, err := utils.WriteRenameManifest(outputDir, renamed)
+		if err != nil {
+			return nil, err
+		}
+		fileNames = append(fileNames, manifestPath)
+	}
+	return fileNames, nil
+}
+
+// readRenameManifest reads the entries of a manifest written by utils.WriteRenameManifest.
+func readRenameManifest(path string) ([]utils.RenamedEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	var renamed []utils.RenamedEntry
+	if err := json.Unmarshal(data, &renamed); err != nil {
+		return nil, fmt.Errorf("failed to decode renamed entries: %v", err)
+	}
+	return renamed, nil
+}
+
+// listAuto lists the entries of every group of a utils.AUTO payload, each with the algorithm
+// of its group.
+func listAuto(input io.Reader, version uint16) ([]utils.EntryInfo, error) {
+	entries := []utils.EntryInfo{}
+	for {
+		algorithm, err := readGroupAlgorithm(input)
+		if err != nil {
+			return nil, err
+		}
+		if algorithm == "" {
+			return entries, nil
+		}
+
+		group, err := listPayload(input, algorithm, version)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, group...)
+	}
+}
+
+// verifyAuto checks every group of a utils.AUTO payload, offsets are relative to its start.
+// It stops at the first group whose end cannot be found.
+func verifyAuto(input io.Reader, version uint16) utils.VerifyReport {
+	report := utils.VerifyReport{}
+	counter := &utils.CountingReader{Reader: input}
+
+	for {
+		algorithm, err := readGroupAlgorithm(counter)
+		if err != nil {
+			report.Structural = err.Error()
+			break
+		}
+		if algorithm == "" {
+			break
+		}
+
+		start := counter.BytesRead
+		group := verifyPayload(counter, algorithm, version)
+		group.OffsetBy(start)
+
+		report.Entries += group.Entries
+		report.Checked += group.Checked
+		report.Failures = append(report.Failures, group.Failures...)
+		if group.Structural != "" {
+			report.Structural = group.Structural
+			break
+		}
+		if group.Checked < group.Entries || !remainderReachable(group) {
+			break
+		}
+	}
+
+	report.Finish()
+	return report
+}
+
+// remainderReachable reports whether the end of a verified payload was found.
+func remainderReachable(report utils.VerifyReport) bool {
+	for _, failure := range report.Failures {
+		if !failure.RemainderReachable {
+			return false
+		}
+	}
+	return true
+}
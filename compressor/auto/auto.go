@@ -0,0 +1,91 @@
+// Package auto picks the algorithm of a file from a sample of its content, for utils.AUTO.
+// Data that is already compressed, such as images, archives and encrypted files, has close to
+// 8 bits of entropy per byte and is stored as it is.
+package auto
+
+import (
+	"bytes"
+	"io"
+	"math"
+
+	"file-compressor/utils"
+)
+
+const (
+	// SAMPLE_SIZE is the number of bytes at the start of a file the choice is based on.
+	SAMPLE_SIZE = 16 * 1024
+
+	// MAX_ENTROPY is the entropy in bits per byte above which a file is stored. Huffman codes
+	// save at most 8 minus the entropy bits per byte, above it the savings are a few percent.
+	MAX_ENTROPY = 7.5
+)
+
+// Entropy returns the Shannon entropy of data in bits per byte, between 0 and 8.
+//
+// Parameters:
+//   - data: the bytes to measure
+//
+// Returns:
+//   - float64: the entropy, 0 for empty data
+func Entropy(data []byte) float64 {
+	if len(data) == 0 {
+		return 0
+	}
+
+	counts := [256]int{}
+	for _, b := range data {
+		counts[b]++
+	}
+
+	entropy := 0.0
+	for _, count := range counts {
+		if count > 0 {
+			p := float64(count) / float64(len(data))
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy
+}
+
+// Choose returns the algorithm for a file that starts with sample: utils.HUFFMAN when its
+// entropy is at most MAX_ENTROPY, utils.STORE otherwise and for empty files.
+//
+// Parameters:
+//   - sample: up to SAMPLE_SIZE bytes from the start of the file
+//
+// Returns:
+//   - utils.Algorithm: utils.HUFFMAN or utils.STORE
+func Choose(sample []byte) utils.Algorithm {
+	if len(sample) == 0 || Entropy(sample) > MAX_ENTROPY {
+		return utils.STORE
+	}
+	return utils.HUFFMAN
+}
+
+// Sample reads up to SAMPLE_SIZE bytes from the start of reader. A reader that implements
+// io.Seeker is moved back to where it was, the others are replaced by one that returns the
+// sample first.
+//
+// Parameters:
+//   - reader: the content of the file
+//
+// Returns:
+//   - []byte: the sample, shorter than SAMPLE_SIZE for small files
+//   - io.Reader: a reader of the whole content
+//   - error: if reading or seeking fails
+func Sample(reader io.Reader) ([]byte, io.Reader, error) {
+	sample := make([]byte, SAMPLE_SIZE)
+	n, err := io.ReadFull(reader, sample)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	sample = sample[:n]
+
+	if seeker, ok := reader.(io.Seeker); ok {
+		if _, err := seeker.Seek(-int64(n), io.SeekCurrent); err != nil {
+			return nil, nil, err
+		}
+		return sample, reader, nil
+	}
+	return sample, io.MultiReader(bytes.NewReader(sample), reader), nil
+}
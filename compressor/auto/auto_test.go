@@ -0,0 +1,78 @@
+package auto
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+func TestChoose(t *testing.T) {
+	random := make([]byte, SAMPLE_SIZE)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	photo, err := os.ReadFile("../test_files/auto/photo.jpg")
+	if err != nil {
+		t.Fatalf("failed to read the JPEG: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		sample   []byte
+		expected utils.Algorithm
+	}{
+		{"text", []byte(strings.Repeat("Simple CLI tool for compressing and decompressing files.\n", 200)), utils.HUFFMAN},
+		{"random bytes", random, utils.STORE},
+		{"jpeg", photo, utils.STORE},
+		{"empty", nil, utils.STORE},
+	}
+
+	for _, test := range tests {
+		if algorithm := Choose(test.sample); algorithm != test.expected {
+			t.Fatalf("%s: expected %s, got %s (%.2f bits per byte)", test.name, test.expected, algorithm, Entropy(test.sample))
+		}
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	if entropy := Entropy(bytes.Repeat([]byte{'a'}, 100)); entropy != 0 {
+		t.Fatalf("expected 0 bits for a single symbol, got %f", entropy)
+	}
+	if entropy := Entropy([]byte("abababab")); entropy != 1 {
+		t.Fatalf("expected 1 bit for two equally frequent symbols, got %f", entropy)
+	}
+
+	every := make([]byte, 256)
+	for i := range every {
+		every[i] = byte(i)
+	}
+	if entropy := Entropy(every); entropy != 8 {
+		t.Fatalf("expected 8 bits for every byte once, got %f", entropy)
+	}
+}
+
+func TestSampleKeepsTheContent(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), SAMPLE_SIZE/5)
+
+	for name, reader := range map[string]io.Reader{
+		"seeker": bytes.NewReader(content),
+		"pipe":   struct{ io.Reader }{bytes.NewReader(content)},
+	} {
+		sample, whole, err := Sample(reader)
+		if err != nil {
+			t.Fatalf("%s: failed to sample: %v", name, err)
+		}
+		if !bytes.Equal(sample, content[:SAMPLE_SIZE]) {
+			t.Fatalf("%s: expected the first %d bytes, got %d", name, SAMPLE_SIZE, len(sample))
+		}
+
+		data, err := io.ReadAll(whole)
+		if err != nil || !bytes.Equal(data, content) {
+			t.Fatalf("%s: expected the whole content after the sample, got %d bytes (%v)", name, len(data), err)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"file-compressor/encryption"
+	"file-compressor/format"
+	"file-compressor/utils"
+)
+
+// BENCH_CORPUS_SIZE is the size of benchCorpus.
+const BENCH_CORPUS_SIZE = 1 << 20
+
+// benchCorpus is the input of the benchmarks below: a third text, a third binary records and a
+// third runs of repeated bytes. It is generated once by TestMain and the same on every run.
+var benchCorpus []byte
+
+func TestMain(m *testing.M) {
+	benchCorpus = generateCorpus(BENCH_CORPUS_SIZE)
+	os.Exit(m.Run())
+}
+
+// generateCorpus returns size bytes of text, binary records and repetitive data, from a fixed
+// seed.
+func generateCorpus(size int) []byte {
+	random := rand.New(rand.NewSource(1))
+	part := size / 3
+	corpus := make([]byte, 0, size+64)
+
+	words := strings.Fields("the quick brown fox jumps over the lazy dog while squirrels bury 42 acorns in {json: [1, 2, 3]}")
+	for len(corpus) < part {
+		corpus = append(corpus, words[random.Intn(len(words))]...)
+		corpus = append(corpus, " \n"[random.Intn(8)/7])
+	}
+
+	// counters and random bytes, like the records of a database page
+	for i := 0; len(corpus) < 2*part; i++ {
+		corpus = format.ByteOrder.AppendUint64(corpus, uint64(i))
+		corpus = format.ByteOrder.AppendUint32(corpus, uint32(i%7))
+		corpus = format.ByteOrder.AppendUint32(corpus, random.Uint32())
+	}
+
+	for len(corpus) < size {
+		corpus = append(corpus, bytes.Repeat([]byte{byte(random.Intn(4))}, 1+random.Intn(200))...)
+	}
+	return corpus[:size]
+}
+
+// corpusFiles returns benchCorpus as the single file of an archive.
+func corpusFiles() []utils.FileData {
+	return []utils.FileData{{Name: "corpus.bin", Size: int64(len(benchCorpus)), Reader: bytes.NewReader(benchCorpus)}}
+}
+
+// compressCorpus compresses benchCorpus with algorithm and opts into output, a file because most
+// codecs seek back to fill in the entry sizes, and returns the size of the archive.
+func compressCorpus(b *testing.B, output *os.File, algorithm string, opts ...utils.Option) int64 {
+	if err := output.Truncate(0); err != nil {
+		b.Fatal(err)
+	}
+	if _, err := output.Seek(0, io.SeekStart); err != nil {
+		b.Fatal(err)
+	}
+	if err := CompressFileData(corpusFiles(), output, algorithm, opts...); err != nil {
+		b.Fatalf("failed to compress with %s: %v", algorithm, err)
+	}
+	size, err := output.Seek(0, io.SeekCurrent)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return size
+}
+
+// runBench compresses benchCorpus with algo and opts and reports the size of the archive
+// relative to the corpus.
+func runBench(b *testing.B, algo string, opts ...utils.Option) {
+	output, err := os.Create(filepath.Join(b.TempDir(), "bench.sq"))
+	if err != nil {
+		b.Fatalf("failed to create the output: %v", err)
+	}
+	defer output.Close()
+
+	var compressedSize int64
+	b.SetBytes(int64(len(benchCorpus)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		compressedSize = compressCorpus(b, output, algo, opts...)
+	}
+	b.ReportMetric(float64(compressedSize)/float64(len(benchCorpus)), "ratio")
+}
+
+// runDecompressBench extracts the archive of benchCorpus compressed with algo.
+func runDecompressBench(b *testing.B, algo string) {
+	output, err := os.Create(filepath.Join(b.TempDir(), "bench.sq"))
+	if err != nil {
+		b.Fatalf("failed to create the output: %v", err)
+	}
+	defer output.Close()
+	compressCorpus(b, output, algo)
+	archive, err := os.ReadFile(output.Name())
+	if err != nil {
+		b.Fatalf("failed to read the archive: %v", err)
+	}
+
+	outputDir := b.TempDir()
+	b.SetBytes(int64(len(benchCorpus)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// the extracted file is replaced on every iteration instead of renamed
+		if err := os.RemoveAll(filepath.Join(outputDir, "corpus.bin")); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := DecompressStream(context.Background(), bytes.NewReader(archive), outputDir, nil); err != nil {
+			b.Fatalf("failed to decompress with %s: %v", algo, err)
+		}
+	}
+}
+
+func BenchmarkCompressHuffman(b *testing.B)    { runBench(b, string(utils.HUFFMAN)) }
+func BenchmarkCompressArithmetic(b *testing.B) { runBench(b, string(utils.ARITHMETIC)) }
+func BenchmarkCompressLZ77(b *testing.B)       { runBench(b, string(utils.LZ77)) }
+func BenchmarkCompressLampelZiv(b *testing.B)  { runBench(b, string(utils.LZ)) }
+func BenchmarkCompressDeflate(b *testing.B)    { runBench(b, string(utils.DEFLATE)) }
+func BenchmarkCompressRLE(b *testing.B)        { runBench(b, string(utils.RLE)) }
+func BenchmarkCompressBWT(b *testing.B)        { runBench(b, string(utils.BWT)) }
+func BenchmarkCompressLZ4(b *testing.B)        { runBench(b, string(utils.LZ4)) }
+func BenchmarkCompressStore(b *testing.B)      { runBench(b, string(utils.STORE)) }
+func BenchmarkCompressAuto(b *testing.B)       { runBench(b, string(utils.AUTO)) }
+
+// BenchmarkLevels shows the ratio and the speed of every utils.CompressionLevel with the
+// algorithms that use it, and with huffman, which ignores it.
+func BenchmarkLevels(b *testing.B) {
+	for _, algorithm := range []utils.Algorithm{utils.DEFLATE, utils.LZ, utils.HUFFMAN} {
+		for level := utils.LevelFast; level <= utils.LevelBest; level++ {
+			b.Run(fmt.Sprintf("%s/level-%d", algorithm, level), func(b *testing.B) {
+				runBench(b, string(algorithm), utils.WithLevel(level))
+			})
+		}
+	}
+}
+
+// BENCH_LARGE_FILE_SIZE is the size of the file compressed by the large file benchmarks, above
+// utils.DEFAULT_MMAP_THRESHOLD.
+const BENCH_LARGE_FILE_SIZE = 80 << 20
+
+// runLargeFileBench compresses a file of BENCH_LARGE_FILE_SIZE bytes made of benchCorpus with
+// huffman, reading it with the given mmap threshold.
+func runLargeFileBench(b *testing.B, mmapThreshold int64) {
+	dir := b.TempDir()
+	input := filepath.Join(dir, "large.bin")
+	if err := os.WriteFile(input, bytes.Repeat(benchCorpus, BENCH_LARGE_FILE_SIZE/len(benchCorpus)), 0o644); err != nil {
+		b.Fatal(err)
+	}
+	output, err := os.Create(filepath.Join(dir, "bench.sq"))
+	if err != nil {
+		b.Fatalf("failed to create the output: %v", err)
+	}
+	defer output.Close()
+
+	b.SetBytes(BENCH_LARGE_FILE_SIZE)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := output.Truncate(0); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := output.Seek(0, io.SeekStart); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := ReadAndCompressFiles([]string{input}, output, string(utils.HUFFMAN), utils.WithMmapThreshold(mmapThreshold)); err != nil {
+			b.Fatalf("failed to compress: %v", err)
+		}
+	}
+}
+
+func BenchmarkCompressLargeFileMmap(b *testing.B) { runLargeFileBench(b, utils.DEFAULT_MMAP_THRESHOLD) }
+func BenchmarkCompressLargeFileRead(b *testing.B) { runLargeFileBench(b, -1) }
+
+func BenchmarkDecompressHuffman(b *testing.B)    { runDecompressBench(b, string(utils.HUFFMAN)) }
+func BenchmarkDecompressArithmetic(b *testing.B) { runDecompressBench(b, string(utils.ARITHMETIC)) }
+func BenchmarkDecompressLZ77(b *testing.B)       { runDecompressBench(b, string(utils.LZ77)) }
+func BenchmarkDecompressLampelZiv(b *testing.B)  { runDecompressBench(b, string(utils.LZ)) }
+func BenchmarkDecompressDeflate(b *testing.B)    { runDecompressBench(b, string(utils.DEFLATE)) }
+func BenchmarkDecompressRLE(b *testing.B)        { runDecompressBench(b, string(utils.RLE)) }
+func BenchmarkDecompressBWT(b *testing.B)        { runDecompressBench(b, string(utils.BWT)) }
+func BenchmarkDecompressLZ4(b *testing.B)        { runDecompressBench(b, string(utils.LZ4)) }
+func BenchmarkDecompressStore(b *testing.B)      { runDecompressBench(b, string(utils.STORE)) }
+func BenchmarkDecompressAuto(b *testing.B)       { runDecompressBench(b, string(utils.AUTO)) }
+
+// runEncryptBench encrypts benchCorpus with suite. A cheap key derivation keeps the cipher the
+// dominant cost.
+func runEncryptBench(b *testing.B, suite encryption.CipherSuite) {
+	options := encryption.EncryptionOptions{CipherSuite: suite, KDFIterations: 1_000}
+	b.SetBytes(int64(len(benchCorpus)))
+	for i := 0; i < b.N; i++ {
+		if err := encryption.EncryptStream(context.Background(), bytes.NewReader(benchCorpus), io.Discard, "benchmark", options); err != nil {
+			b.Fatalf("failed to encrypt with %s: %v", suite, err)
+		}
+	}
+}
+
+func BenchmarkEncryptAESGCM(b *testing.B)   { runEncryptBench(b, encryption.AES_GCM) }
+func BenchmarkEncryptChaCha20(b *testing.B) { runEncryptBench(b, encryption.CHACHA20_POLY1305) }
@@ -0,0 +1,317 @@
+package bwt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"file-compressor/constants"
+	"file-compressor/format"
+)
+
+const (
+	// BLOCK_SIZE is the number of input bytes transformed at once. Larger blocks group more
+	// similar contexts together but need more memory to sort, about 20 bytes per input byte.
+	BLOCK_SIZE = 256 << 10
+	// BLOCK_HEADER_LEN is the length of the primary index and the block length in front of every
+	// block, see format.BWTBlockHeader.
+	BLOCK_HEADER_LEN = format.BWT_BLOCK_HEADER_LEN
+)
+
+var (
+	// ErrTruncatedBlock is returned by Decoder.Close when the encoded data ends inside a block.
+	ErrTruncatedBlock = errors.New("bwt: input ends inside a block")
+	// ErrInvalidBlock is returned when a block header describes a block that cannot be inverted.
+	ErrInvalidBlock = errors.New("bwt: invalid block header")
+)
+
+// BWT applies the Burrows-Wheeler transform to data. All rotations of data are sorted and the
+// last byte of each is returned, which groups bytes that precede similar contexts together.
+//
+// Parameters:
+//   - data: the bytes to transform
+//
+// Returns:
+//   - []byte: the last column of the sorted rotations, as long as data
+//   - int: the primary index, the row of the sorted rotations holding data itself, needed by InverseBWT
+func BWT(data []byte) ([]byte, int) {
+	n := len(data)
+	if n == 0 {
+		return []byte{}, 0
+	}
+
+	rotations := sortRotations(data)
+
+	transformed := make([]byte, n)
+	primary := 0
+	for i, start := range rotations {
+		if start == 0 {
+			primary = i
+		}
+		transformed[i] = data[(int(start)+n-1)%n]
+	}
+
+	return transformed, primary
+}
+
+// sortRotations returns the start offsets of the rotations of data in sorted order. The
+// rotations are sorted by their first 1, 2, 4, ... bytes with a counting sort per step, using
+// the classes of the previous step as keys, until every rotation has a class of its own.
+func sortRotations(data []byte) []int32 {
+	n := len(data)
+	order := make([]int32, n)
+	classes := make([]int32, n)
+	count := make([]int32, max(256, n))
+
+	for _, b := range data {
+		count[b]++
+	}
+	for i := 1; i < 256; i++ {
+		count[i] += count[i-1]
+	}
+	for i := n - 1; i >= 0; i-- {
+		count[data[i]]--
+		order[count[data[i]]] = int32(i)
+	}
+
+	numClasses := int32(1)
+	for i := 1; i < n; i++ {
+		if data[order[i]] != data[order[i-1]] {
+			numClasses++
+		}
+		classes[order[i]] = numClasses - 1
+	}
+
+	nextOrder := make([]int32, n)
+	nextClasses := make([]int32, n)
+	for length := 1; length < n && int(numClasses) < n; length *= 2 {
+		// the rotations are already sorted by their second half, shifting them back by length
+		// gives an order by the second half of the rotations that are sorted next
+		for i, start := range order {
+			nextOrder[i] = int32((int(start) - length + n) % n)
+		}
+
+		clear(count[:numClasses])
+		for _, start := range nextOrder {
+			count[classes[start]]++
+		}
+		for i := int32(1); i < numClasses; i++ {
+			count[i] += count[i-1]
+		}
+		for i := n - 1; i >= 0; i-- {
+			class := classes[nextOrder[i]]
+			count[class]--
+			order[count[class]] = nextOrder[i]
+		}
+
+		nextClasses[order[0]] = 0
+		numClasses = 1
+		for i := 1; i < n; i++ {
+			current, previous := int(order[i]), int(order[i-1])
+			if classes[current] != classes[previous] || classes[(current+length)%n] != classes[(previous+length)%n] {
+				numClasses++
+			}
+			nextClasses[current] = numClasses - 1
+		}
+		classes, nextClasses = nextClasses, classes
+	}
+
+	return order
+}
+
+// InverseBWT restores the data BWT was applied to.
+//
+// Parameters:
+//   - data: the output of BWT
+//   - primary: the primary index returned by BWT
+//
+// Returns:
+//   - []byte: the original data, empty when primary is not an index of data
+func InverseBWT(data []byte, primary int) []byte {
+	n := len(data)
+	if primary < 0 || primary >= n {
+		return []byte{}
+	}
+
+	// first[b] is the first row of the sorted rotations starting with b
+	var first [256]int
+	for _, b := range data {
+		first[b]++
+	}
+	sum := 0
+	for b, count := range first {
+		first[b] = sum
+		sum += count
+	}
+
+	// previous[i] is the row of the rotation that starts one byte before the rotation of row i
+	previous := make([]int32, n)
+	var seen [256]int
+	for i, b := range data {
+		previous[i] = int32(first[b] + seen[b])
+		seen[b]++
+	}
+
+	original := make([]byte, n)
+	row := primary
+	for i := n - 1; i >= 0; i-- {
+		original[i] = data[row]
+		row = int(previous[row])
+	}
+
+	return original
+}
+
+// MoveToFront replaces every byte of data by its position in a list of all byte values, and
+// moves it to the front of the list. The runs of equal bytes BWT produces become runs of
+// zeros, and the frequent bytes small values, which Huffman coding compresses well.
+//
+// Parameters:
+//   - data: the bytes to encode
+//
+// Returns:
+//   - []byte: the positions, as long as data
+func MoveToFront(data []byte) []byte {
+	symbols := initialSymbols()
+	encoded := make([]byte, len(data))
+	for i, b := range data {
+		position := 0
+		for symbols[position] != b {
+			position++
+		}
+		copy(symbols[1:position+1], symbols[:position])
+		symbols[0] = b
+		encoded[i] = byte(position)
+	}
+	return encoded
+}
+
+// InverseMoveToFront restores the data MoveToFront was applied to.
+//
+// Parameters:
+//   - data: the output of MoveToFront
+//
+// Returns:
+//   - []byte: the original data
+func InverseMoveToFront(data []byte) []byte {
+	symbols := initialSymbols()
+	decoded := make([]byte, len(data))
+	for i, position := range data {
+		b := symbols[position]
+		copy(symbols[1:int(position)+1], symbols[:position])
+		symbols[0] = b
+		decoded[i] = b
+	}
+	return decoded
+}
+
+func initialSymbols() []byte {
+	symbols := make([]byte, 256)
+	for i := range symbols {
+		symbols[i] = byte(i)
+	}
+	return symbols
+}
+
+// Encoder is an io.Reader returning the data of another reader split into blocks of at most
+// BLOCK_SIZE bytes. Every block is returned as its primary index and length, 4 bytes each in
+// big-endian order, followed by MoveToFront(BWT(block)).
+type Encoder struct {
+	reader  io.Reader
+	block   []byte
+	pending []byte
+	err     error
+}
+
+// NewEncoder creates an Encoder reading the data to transform from r.
+func NewEncoder(r io.Reader) *Encoder {
+	return &Encoder{reader: r}
+}
+
+// Read returns the encoded blocks, reading and transforming the next block of the underlying
+// reader once the previous one was returned completely.
+func (e *Encoder) Read(p []byte) (int, error) {
+	for len(e.pending) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+		e.nextBlock()
+	}
+
+	n := copy(p, e.pending)
+	e.pending = e.pending[n:]
+	return n, nil
+}
+
+func (e *Encoder) nextBlock() {
+	if e.block == nil {
+		e.block = make([]byte, BLOCK_SIZE)
+	}
+
+	n, err := io.ReadFull(e.reader, e.block)
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		e.err = io.EOF
+	case err != nil && err != io.EOF:
+		e.err = fmt.Errorf(constants.FILE_READ_ERROR, err)
+	default:
+		e.err = err
+	}
+	if n == 0 {
+		return
+	}
+
+	transformed, primary := BWT(e.block[:n])
+	e.pending = format.AppendBWTBlockHeader(make([]byte, 0, BLOCK_HEADER_LEN+n), format.BWTBlockHeader{Primary: uint32(primary), Length: uint32(n)})
+	e.pending = append(e.pending, MoveToFront(transformed)...)
+}
+
+// Decoder is an io.WriteCloser that reverses an Encoder. The encoded data is written to it in
+// pieces of any size and every complete block is restored and written to the underlying writer.
+type Decoder struct {
+	writer  io.Writer
+	pending []byte
+}
+
+// NewDecoder creates a Decoder writing the restored data to w.
+func NewDecoder(w io.Writer) *Decoder {
+	return &Decoder{writer: w}
+}
+
+// Write buffers p and restores the blocks it completes.
+func (d *Decoder) Write(p []byte) (int, error) {
+	d.pending = append(d.pending, p...)
+
+	consumed := 0
+	for len(d.pending)-consumed >= BLOCK_HEADER_LEN {
+		header := format.ParseBWTBlockHeader(d.pending[consumed : consumed+BLOCK_HEADER_LEN])
+		primary, length := int(header.Primary), int(header.Length)
+		if length == 0 || length > BLOCK_SIZE || primary >= length {
+			return 0, ErrInvalidBlock
+		}
+		if len(d.pending)-consumed < BLOCK_HEADER_LEN+length {
+			break
+		}
+
+		block := d.pending[consumed+BLOCK_HEADER_LEN : consumed+BLOCK_HEADER_LEN+length]
+		if _, err := d.writer.Write(InverseBWT(InverseMoveToFront(block), primary)); err != nil {
+			return 0, err
+		}
+		consumed += BLOCK_HEADER_LEN + length
+	}
+
+	// keep only the start of the next block instead of the whole input
+	if consumed > 0 {
+		d.pending = append([]byte(nil), d.pending[consumed:]...)
+	}
+
+	return len(p), nil
+}
+
+// Close reports ErrTruncatedBlock if the data written so far ends inside a block.
+func (d *Decoder) Close() error {
+	if len(d.pending) != 0 {
+		return ErrTruncatedBlock
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package bwt
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+func roundTrip(t *testing.T, input []byte) []byte {
+	t.Helper()
+
+	encoded := &bytes.Buffer{}
+	if _, err := io.Copy(encoded, NewEncoder(bytes.NewReader(input))); err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+
+	// write the encoded data in small pieces, block headers and blocks are split across writes
+	decoded := &bytes.Buffer{}
+	decoder := NewDecoder(decoded)
+	for data := encoded.Bytes(); len(data) > 0; {
+		n := min(len(data), 1000)
+		if _, err := decoder.Write(data[:n]); err != nil {
+			t.Fatalf("failed to decode: %v", err)
+		}
+		data = data[n:]
+	}
+	if err := decoder.Close(); err != nil {
+		t.Fatalf("failed to close the decoder: %v", err)
+	}
+
+	if !bytes.Equal(input, decoded.Bytes()) {
+		t.Fatalf("decoded data does not match the %d byte input", len(input))
+	}
+	return encoded.Bytes()
+}
+
+func TestBWTBanana(t *testing.T) {
+	// the sorted rotations of banana are abanan, anaban, ananab, banana, nabana, nanaba
+	transformed, primary := BWT([]byte("banana"))
+	if string(transformed) != "nnbaaa" || primary != 3 {
+		t.Fatalf("expected nnbaaa and 3, got %s and %d", transformed, primary)
+	}
+	if original := InverseBWT(transformed, primary); string(original) != "banana" {
+		t.Fatalf("expected banana, got %s", original)
+	}
+}
+
+func TestMoveToFront(t *testing.T) {
+	encoded := MoveToFront([]byte("aaabbb"))
+	if !bytes.Equal(encoded, []byte{'a', 0, 0, 'b', 0, 0}) {
+		t.Fatalf("unexpected encoding %v", encoded)
+	}
+	if decoded := InverseMoveToFront(encoded); string(decoded) != "aaabbb" {
+		t.Fatalf("expected aaabbb, got %s", decoded)
+	}
+}
+
+func TestRoundTripText(t *testing.T) {
+	text, err := os.ReadFile("../test_files/input/example.txt")
+	if err != nil {
+		t.Fatalf("failed to read the test file: %v", err)
+	}
+	roundTrip(t, text)
+}
+
+func TestRoundTripBinary(t *testing.T) {
+	random := make([]byte, BLOCK_SIZE+12345)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	inputs := map[string][]byte{
+		"empty":     {},
+		"one byte":  {42},
+		"all zeros": make([]byte, 5000),
+		"periodic":  bytes.Repeat([]byte{0, 1, 2, 255}, 3000),
+		"random":    random,
+	}
+	for name, input := range inputs {
+		t.Run(name, func(t *testing.T) {
+			roundTrip(t, input)
+		})
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	encoded := roundTrip(t, []byte("abracadabra"))
+
+	decoder := NewDecoder(&bytes.Buffer{})
+	if _, err := decoder.Write(encoded[:len(encoded)-1]); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if err := decoder.Close(); !errors.Is(err, ErrTruncatedBlock) {
+		t.Fatalf("expected %v, got %v", ErrTruncatedBlock, err)
+	}
+
+	// a primary index past the end of the block
+	corrupt := append([]byte{}, encoded...)
+	corrupt[3] = 200
+	if _, err := NewDecoder(&bytes.Buffer{}).Write(corrupt); !errors.Is(err, ErrInvalidBlock) {
+		t.Fatalf("expected %v, got %v", ErrInvalidBlock, err)
+	}
+}
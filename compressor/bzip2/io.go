@@ -0,0 +1,120 @@
+package bzip2
+
+import (
+	"bytes"
+	stdbzip2 "compress/bzip2"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"file-compressor/constants"
+	"file-compressor/metrics"
+	"file-compressor/utils"
+)
+
+// MAGIC starts every bzip2 stream, followed by the block size digit '1' to '9'.
+const MAGIC = "BZh"
+
+// MAGIC_LEN is the number of bytes IsBzip2 needs, the magic and the block size digit.
+const MAGIC_LEN = len(MAGIC) + 1
+
+// ErrBzip2WriteNotSupported is returned by Zip, the standard library can only read bzip2.
+var ErrBzip2WriteNotSupported = errors.New("bzip2 compression is not supported, bzip2 files can only be decompressed")
+
+// IsBzip2 reports whether header, the first MAGIC_LEN bytes of a file, starts a bzip2 stream.
+func IsBzip2(header []byte) bool {
+	if len(header) < MAGIC_LEN || !bytes.HasPrefix(header, []byte(MAGIC)) {
+		return false
+	}
+	return header[len(MAGIC)] >= '1' && header[len(MAGIC)] <= '9'
+}
+
+// EntryName returns the name of the file held by the bzip2 file at path: the path without
+// its ".bz2" extension, or with ".out" appended when it has another one.
+func EntryName(path string) string {
+	if path == "" {
+		return "decompressed"
+	}
+	name := filepath.Base(path)
+	for _, ext := range []string{".bz2", ".bzip2"} {
+		if strings.EqualFold(filepath.Ext(name), ext) {
+			return strings.TrimSuffix(name, filepath.Ext(name))
+		}
+	}
+	return name + ".out"
+}
+
+// Zip always fails with ErrBzip2WriteNotSupported. It exists so bzip2 can be selected like
+// the other algorithms and be rejected with a clear error.
+//
+// Parameters:
+//   - files: The files that would be compressed.
+//   - output: The io.Writer that would receive the compressed data, nothing is written.
+//   - opts: Optional settings such as utils.WithMetrics.
+//
+// Returns:
+//   - error: ErrBzip2WriteNotSupported
+func Zip(files []utils.FileData, output io.Writer, opts ...utils.Option) error {
+	options := utils.NewOptions(opts...)
+	metrics.RecordError(options.Metrics, string(utils.BZIP2), metrics.OP_COMPRESS, ErrBzip2WriteNotSupported)
+	return ErrBzip2WriteNotSupported
+}
+
+// Unzip decompresses a bzip2 file made by an external tool. Unlike the archives of the other
+// codecs it holds a single file without a name, stored time or checksum of its own, so the
+// file is written as name below outputPath. bzip2 checks the CRC of every block itself.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the bzip2 stream.
+//   - outputPath: A string specifying the directory where the decompressed file will be written.
+//   - name: The name of the decompressed file, see EntryName.
+//   - opts: Optional settings, the same as for hfc.Unzip.
+//
+// Returns:
+//   - A slice of strings containing the path of the decompressed file, empty when
+//     utils.WithEntries does not select it.
+//   - An error if any issue occurs during the decompression process.
+func Unzip(input io.Reader, outputPath, name string, opts ...utils.Option) ([]string, error) {
+	options := utils.NewOptions(opts...)
+
+	filePaths, err := unzipFile(input, outputPath, name, options)
+	if err != nil {
+		metrics.RecordError(options.Metrics, string(utils.BZIP2), metrics.OP_DECOMPRESS, err)
+		return nil, err
+	}
+
+	return filePaths, nil
+}
+
+func unzipFile(input io.Reader, outputPath, name string, options utils.Options) ([]string, error) {
+	start := time.Now()
+	extractor := utils.NewExtractor(outputPath, options)
+
+	if !options.Selects(name) {
+		return extractor.Finish()
+	}
+
+	output, err := extractor.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	compressed := &utils.CountingReader{Reader: input}
+	buf := make([]byte, constants.BUFFER_SIZE)
+	if _, err := io.CopyBuffer(output, stdbzip2.NewReader(compressed), buf); err != nil {
+		output.Abort()
+		return nil, fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+	}
+
+	if err := output.Close(); err != nil {
+		return nil, err
+	}
+
+	metrics.RecordEntry(options.Metrics, string(utils.BZIP2), metrics.OP_DECOMPRESS, compressed.BytesRead, output.BytesWritten(), time.Since(start))
+	options.Progress(name, output.BytesWritten(), -1)
+
+	return extractor.Finish()
+}
@@ -0,0 +1,101 @@
+package bzip2
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+// notes.txt.bz2 was written by the bzip2 command line tool
+const fixture = "../test_files/bzip2/notes.txt.bz2"
+
+var fixtureContent = strings.Repeat("SquirrelZip reads bzip2 files made by other tools.\n", 3)
+
+func TestUnzipFixture(t *testing.T) {
+	input, err := os.Open(fixture)
+	if err != nil {
+		t.Fatalf("failed to open the fixture: %v", err)
+	}
+	defer input.Close()
+
+	outputDir := t.TempDir()
+	paths, err := Unzip(input, outputDir, EntryName(fixture))
+	if err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != filepath.Join(outputDir, "notes.txt") {
+		t.Fatalf("expected %s, got %v", filepath.Join(outputDir, "notes.txt"), paths)
+	}
+
+	decompressed, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatalf("failed to read the decompressed file: %v", err)
+	}
+	if string(decompressed) != fixtureContent {
+		t.Fatalf("expected %q, got %q", fixtureContent, decompressed)
+	}
+}
+
+func TestUnzipCorruptData(t *testing.T) {
+	compressed, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatalf("failed to read the fixture: %v", err)
+	}
+	compressed[len(compressed)/2] ^= 0xff
+
+	if _, err := Unzip(bytes.NewReader(compressed), t.TempDir(), "notes.txt"); err == nil {
+		t.Fatal("expected an error for corrupted data")
+	}
+}
+
+func TestZipNotSupported(t *testing.T) {
+	files := []utils.FileData{{Name: "a.txt", Size: 3, Reader: bytes.NewReader([]byte("abc"))}}
+	output := &bytes.Buffer{}
+	if err := Zip(files, output); !errors.Is(err, ErrBzip2WriteNotSupported) {
+		t.Fatalf("expected %v, got %v", ErrBzip2WriteNotSupported, err)
+	}
+	if output.Len() != 0 {
+		t.Fatalf("expected nothing to be written, got %d bytes", output.Len())
+	}
+}
+
+func TestIsBzip2(t *testing.T) {
+	tests := []struct {
+		header []byte
+		want   bool
+	}{
+		{[]byte("BZh9"), true},
+		{[]byte("BZh1"), true},
+		{[]byte("BZh0"), false},
+		{[]byte("BZh"), false},
+		{[]byte("SQZP"), false},
+		{nil, false},
+	}
+
+	for _, test := range tests {
+		if got := IsBzip2(test.header); got != test.want {
+			t.Errorf("IsBzip2(%q) = %v, expected %v", test.header, got, test.want)
+		}
+	}
+}
+
+func TestEntryName(t *testing.T) {
+	tests := map[string]string{
+		"dir/notes.txt.bz2": "notes.txt",
+		"backup.BZ2":        "backup",
+		"data.bzip2":        "data",
+		"archive.sq":        "archive.sq.out",
+		"":                  "decompressed",
+	}
+
+	for path, want := range tests {
+		if got := EntryName(path); got != want {
+			t.Errorf("EntryName(%q) = %q, expected %q", path, got, want)
+		}
+	}
+}
@@ -1,21 +1,36 @@
 package compressor
 
 import (
-	"encoding/binary"
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"file-compressor/compressor/arithmetic"
+	"file-compressor/compressor/bzip2"
+	"file-compressor/compressor/deflate"
 	"file-compressor/compressor/hfc"
+	"file-compressor/compressor/lampelziv"
+	"file-compressor/compressor/lz4fast"
+	"file-compressor/compressor/lz77"
+	"file-compressor/compressor/rle"
+	"file-compressor/compressor/store"
+	"file-compressor/compressor/targz"
 	"file-compressor/constants"
+	"file-compressor/encryption"
+	"file-compressor/format"
 	"file-compressor/utils"
 )
 
 func CheckCompressionAlgorithm(algo string) error {
 	switch utils.Algorithm(algo) {
-	case utils.HUFFMAN, utils.ARITHMETIC:
+	case utils.HUFFMAN, utils.HUFFMAN_STREAM, utils.ARITHMETIC, utils.LZ77, utils.DEFLATE, utils.RLE, utils.BWT, utils.LZ4, utils.LZ, utils.BZIP2, utils.STORE, utils.AUTO:
 		return nil
 	default:
 		return fmt.Errorf("unsupported compression algorithm: %v", algo)
@@ -26,13 +41,17 @@ func CheckCompressionAlgorithm(algo string) error {
 // Compress compresses a list of files using the specified compression algorithm and saves the compressed file to the output directory.
 // 
 // Parameters:
+// - ctx: Cancels the compression, the partially written compressed file is removed.
 // - filenameStrs: A slice of strings containing the paths of the files to be compressed.
 // - outputDir: A string specifying the directory where the compressed file will be saved. If not provided, a default directory will be used.
 // - algorithm: A string specifying the compression algorithm to be used.
+// - opts: Optional settings passed to the codec, such as utils.WithMetrics or utils.WithProgress.
+//   utils.WithSignKey signs the written archive.
 //
 // Returns:
 // - A string representing the path of the compressed file.
-// - A utils.FilesRatio struct containing the ratio of the original size to the compressed size.
+// - A utils.CompressionStats struct with the algorithm, the sizes of the archive and of every
+//   file, the number of files and the throughput of the compression.
 // - An error if any issues occur during the compression process.
 //
 // The function performs the following steps:
@@ -43,11 +62,12 @@ func CheckCompressionAlgorithm(algo string) error {
 // 5. Generates a valid name for the compressed file.
 // 6. Creates the compressed file in the output directory.
 // 7. Reads and compresses the input files using the specified algorithm.
-// 8. Calculates the size ratio between the original and compressed files.
-// 9. Returns the path of the compressed file, the size ratio, and any error encountered.
-func Compress(filenameStrs []string, outputDir, algorithm string) (string, utils.FilesRatio, error) {
+// 8. Collects the stats of the original and compressed files.
+// 9. Returns the path of the compressed file, the stats, and any error encountered.
+func Compress(ctx context.Context, filenameStrs []string, outputDir, algorithm string, opts ...utils.Option) (string, utils.CompressionStats, error) {
 
-	fileMeta := utils.FilesRatio{}
+	start := time.Now()
+	fileMeta := utils.CompressionStats{Algorithm: algorithm}
 	//check if files exist
 	for _, filenameStr := range filenameStrs {
 		if _, err := os.Stat(filenameStr); os.IsNotExist(err) {
@@ -70,11 +90,11 @@ func Compress(filenameStrs []string, outputDir, algorithm string) (string, utils
 	}
 
 
-	fileName := filenameStrs[0]
-	ext := filepath.Ext(fileName)
-	fileName = strings.TrimSuffix(fileName, ext)
-	fileName = filepath.Base(fileName) + constants.COMPRESSED_FILE_EXT
-	fileName = utils.InvalidateFileName(fileName, outputDir)
+	extension := constants.COMPRESSED_FILE_EXT
+	if utils.NewOptions(opts...).ArchiveFormat == utils.TARGZ {
+		extension = constants.TARGZ_FILE_EXT
+	}
+	fileName := utils.InvalidateFileName(utils.ArchiveName(filenameStrs, extension), outputDir)
 
 	compressedFileOutput, err := os.Create(fileName)
 	if err != nil {
@@ -83,9 +103,21 @@ func Compress(filenameStrs []string, outputDir, algorithm string) (string, utils
 	
 	defer compressedFileOutput.Close()
 
-	originalSize, err := ReadAndCompressFiles(filenameStrs, compressedFileOutput, algorithm)
+	originalSize, err := ReadAndCompressFiles(filenameStrs, compressedFileOutput, algorithm, fileMeta.CountFiles(append(opts, utils.WithContext(ctx)), false)...)
 	if err != nil {
-		return "", fileMeta, err
+		// do not leave a partial archive behind
+		compressedFileOutput.Close()
+		utils.SafeDeleteFile(fileName)
+		return "", fileMeta, utils.ContextError(ctx, err)
+	}
+
+	signKey := utils.NewOptions(opts...).SignKey
+	if signKey != nil {
+		compressedFileOutput.Close()
+		if err := encryption.SignArchive(fileName, signKey); err != nil {
+			utils.SafeDeleteFile(fileName)
+			return "", fileMeta, err
+		}
 	}
 
 	compressedStat, err := os.Stat(fileName)
@@ -93,7 +125,19 @@ func Compress(filenameStrs []string, outputDir, algorithm string) (string, utils
 		return "", fileMeta, fmt.Errorf(constants.FILE_STAT_ERROR, err)
 	}
 
-	fileMeta = utils.NewFilesRatio(originalSize, uint64(compressedStat.Size()))
+	fileMeta.OriginalBytes = originalSize
+	fileMeta.CompressedBytes = uint64(compressedStat.Size())
+	// the progress only reports the original size of every file, the compressed sizes are
+	// listed from the archive, they stay 0 when it cannot be listed. A signed archive is listed
+	// with the key of its signature.
+	var listing []utils.Option
+	if signKey != nil {
+		listing = append(listing, utils.WithVerifyKey(signKey.Public().(ed25519.PublicKey)))
+	}
+	if entries, err := List(fileName, listing...); err == nil {
+		fileMeta.SetEntrySizes(entries)
+	}
+	fileMeta.Finish(start)
 
 	return fileName, fileMeta, err
 }
@@ -106,6 +150,7 @@ func Compress(filenameStrs []string, outputDir, algorithm string) (string, utils
 //   - filenameStrs: A slice of strings containing the file paths to be read and compressed.
 //   - output: An io.Writer where the compressed data will be written.
 //   - algorithm: A string specifying the compression algorithm to use.
+//   - opts: Optional settings passed to the codec, utils.WithContext cancels reading the files.
 //
 // Returns:
 //   - uint64: The total size of the original uncompressed files.
@@ -116,21 +161,45 @@ func Compress(filenameStrs []string, outputDir, algorithm string) (string, utils
 //   2. Retrieves file information and checks if the file is a directory.
 //   3. If the file is a directory, it recursively walks through the directory to gather file data.
 //   4. If the file is not a directory, it opens the file and appends its data to a slice.
-//   5. Writes the specified compression algorithm to the output.
-//   6. Compresses the gathered file data using the specified algorithm and writes the compressed data to the output.
+//      Files and directories matching a pattern of utils.WithExclude are skipped, files of at
+//      least utils.WithMmapThreshold bytes are mapped into memory.
+//   5. Finds the files with the same content as an earlier one, utils.HUFFMAN, utils.BWT and
+//      utils.AUTO store them as links to it without data.
+//   6. Passes the gathered file data to CompressFileData, which writes the container header
+//      and the compressed data to the output.
 //
 // Supported compression algorithms:
-//   - utils.HUFFMAN: Uses Huffman coding for compression.
+//   - utils.HUFFMAN: Uses Huffman coding for compression. When output does not implement
+//     io.Seeker the archive is written as utils.HUFFMAN_STREAM instead.
+//   - utils.ARITHMETIC: Uses arithmetic coding for compression.
+//   - utils.LZ77: Uses LZ77 with a small sliding window for compression.
+//   - utils.DEFLATE: Uses Deflate from compress/flate for compression.
+//   - utils.RLE: Uses run-length encoding, fast and effective for highly repetitive data.
+//   - utils.BWT: Applies the Burrows-Wheeler transform and move-to-front coding before Huffman
+//     coding, slower but smaller than utils.HUFFMAN for text.
+//   - utils.LZ4: Uses a simplified LZ4 block format, much faster than the others but larger.
+//   - utils.LZ: Uses the Lempel-Ziv codec of the lampelziv package, see utils.WithWindowSize.
+//   - utils.BZIP2: Fails with bzip2.ErrBzip2WriteNotSupported, bzip2 files can only be decompressed.
+//   - utils.STORE: Keeps the data as it is.
+//   - utils.AUTO: Uses utils.HUFFMAN or utils.STORE for every file, depending on the entropy
+//     of its first bytes, see the auto package.
 //
 // Errors:
 //   - Returns an error if any file cannot be opened, read, or if compression fails.
-func ReadAndCompressFiles(filenameStrs []string, output io.Writer, algorithm string) (uint64, error) {
-
-	var err error
+func ReadAndCompressFiles(filenameStrs []string, output io.Writer, algorithm string, opts ...utils.Option) (uint64, error) {
 
 	fileDataArr := []utils.FileData{}
 
-	originalSize := uint64(0)
+	options := utils.NewOptions(opts...)
+
+	// the files are read while the archive is written, they are closed once it is done. They are
+	// kept apart from fileDataArr because CompressFileData wraps the readers.
+	openFiles := []io.Closer{}
+	defer func() {
+		for _, file := range openFiles {
+			file.Close()
+		}
+	}()
 
 	for _, filenameStr := range filenameStrs {
 		// Get the file info
@@ -139,50 +208,182 @@ func ReadAndCompressFiles(filenameStrs []string, output io.Writer, algorithm str
 			return 0, fmt.Errorf("failed to get file info: %v", err)
 		}
 
-		originalSize += uint64(fileInfo.Size())
-
 		// Check if the file is a directory
 		if fileInfo.IsDir() {
-			if err := walkDir(filenameStr, &fileDataArr); err != nil {
+			walked := len(fileDataArr)
+			err := walkDir(filenameStr, &fileDataArr, options)
+			for _, fileData := range fileDataArr[walked:] {
+				openFiles = append(openFiles, fileData.Reader.(io.Closer))
+			}
+			if err != nil {
 				return 0, err
 			}
 		} else {
-			file, err := os.Open(filenameStr)
+			name, err := entryName(filenameStr, filenameStr, options.KeepPaths)
 			if err != nil {
-				return 0, fmt.Errorf(constants.FILE_OPEN_ERROR, err)
+				return 0, err
+			}
+			excluded, err := utils.MatchesAnyPattern(name, options.Exclude)
+			if err != nil {
+				return 0, err
+			}
+			if excluded {
+				options.Excluded(name, false)
+				continue
 			}
 
-			defer file.Close()
+			file, err := openFile(filenameStr, fileInfo.Size(), options.MmapThreshold)
+			if err != nil {
+				return 0, err
+			}
+			openFiles = append(openFiles, file)
 
 			fileData := utils.FileData{
-				Name: filenameStr,
+				Name: name,
 				Size: fileInfo.Size(),
 				Reader: file,
+				ModTime: fileInfo.ModTime(),
+				Mode: fileInfo.Mode(),
 			}
 
 			fileDataArr = append(fileDataArr, fileData)
 		}
 	}
 
+	if len(fileDataArr) == 0 && len(options.Exclude) > 0 {
+		return 0, errors.New("no files to compress, every file is excluded")
+	}
+
+	// files with the same content are stored once
+	if linksSupported(algorithm, options) {
+		if err := linkDuplicates(fileDataArr); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := CompressFileData(fileDataArr, output, algorithm, opts...); err != nil {
+		return 0, err
+	}
+
+	return uint64(utils.TotalSize(fileDataArr)), nil
+}
+
+// CompressFileData compresses files that are already open, or held in memory, using the specified
+// algorithm and writes the archive to output, starting with the container header. With
+// utils.WithArchiveFormat(utils.TARGZ) a tar.gz stream is written instead and the algorithm is
+// ignored.
+//
+// Parameters:
+//   - files: The entries to compress, every Reader is read to its end.
+//   - output: An io.Writer where the compressed data will be written.
+//   - algorithm: A string specifying the compression algorithm to use, see ReadAndCompressFiles.
+//   - opts: Optional settings passed to the codec, utils.WithContext cancels reading the files.
+//
+// Returns:
+//   - error: An error if writing the header or the compression fails.
+func CompressFileData(files []utils.FileData, output io.Writer, algorithm string, opts ...utils.Option) error {
+
+	options := utils.NewOptions(opts...)
+
+	warnLongNames(files, options)
+
+	// throttle reading the input files when a read limit is set, and stop once the context is done
+	progress := utils.NewProgressTracker(options.ProgressEvents, options.ProgressInterval, utils.PHASE_COMPRESS, utils.TotalSize(files))
+	for i := range files {
+		files[i].Reader = progress.Reader(files[i].Name, utils.CancelReader(options.Context, utils.LimitReader(files[i].Reader, options.ReadLimiter)))
+	}
+	// the codecs report every finished file, which ends its events
+	fileDone := options.Progress
+	opts = append(opts, utils.WithProgress(func(filename string, bytesProcessed, totalBytes int64) {
+		progress.Done(filename)
+		fileDone(filename, bytesProcessed, totalBytes)
+	}))
+
+	// a Huffman archive is streamed when the sizes cannot be filled in by seeking back
+	if _, ok := output.(io.Seeker); !ok && utils.Algorithm(algorithm) == utils.HUFFMAN {
+		algorithm = string(utils.HUFFMAN_STREAM)
+	}
+
+	// the codecs write a few bytes at a time, the buffer is flushed before they seek
+	var buffered interface {
+		io.Writer
+		Flush() error
+	}
+	if writeSeeker, ok := output.(io.WriteSeeker); ok {
+		buffered = utils.NewBufferedWriteSeeker(writeSeeker, options.BufferSize)
+	} else {
+		buffered = bufio.NewWriterSize(output, options.BufferSize)
+	}
+	output = buffered
+
+	// a tar.gz has no container header, other tools read it
+	if options.ArchiveFormat == utils.TARGZ {
+		if err := targz.Zip(files, output, opts...); err != nil {
+			return fmt.Errorf(constants.ERROR_COMPRESS, err)
+		}
+		if err := buffered.Flush(); err != nil {
+			return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+		}
+		return nil
+	}
+
 	// Write the compression algorithm to the output
 	if err := writeAlgorithm(output, algorithm); err != nil {
-		return 0, err
+		return err
 	}
 
-	switch utils.Algorithm(algorithm) {
+	if err := zipPayload(files, output, utils.Algorithm(algorithm), opts...); err != nil {
+		return err
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+
+	return nil
+}
+
+// zipPayload writes the payload of algorithm, everything after the container header.
+func zipPayload(files []utils.FileData, output io.Writer, algorithm utils.Algorithm, opts ...utils.Option) error {
+	var err error
+
+	switch algorithm {
 	case utils.HUFFMAN:
-		err = hfc.Zip(fileDataArr, output)
+		err = hfc.Zip(files, output, opts...)
+	case utils.HUFFMAN_STREAM:
+		err = hfc.ZipStream(files, output, opts...)
+	case utils.ARITHMETIC:
+		err = arithmetic.Zip(files, output, opts...)
+	case utils.LZ77:
+		err = lz77.Zip(files, output, opts...)
+	case utils.DEFLATE:
+		err = deflate.Zip(files, output, opts...)
+	case utils.RLE:
+		err = rle.Zip(files, output, opts...)
+	case utils.BWT:
+		err = hfc.ZipBWT(files, output, opts...)
+	case utils.LZ4:
+		err = lz4fast.Zip(files, output, opts...)
+	case utils.LZ:
+		err = lampelziv.Zip(files, output, opts...)
+	case utils.BZIP2:
+		err = bzip2.Zip(files, output, opts...)
+	case utils.STORE:
+		err = store.Zip(files, output, opts...)
+	case utils.AUTO:
+		// the groups are compressed by this function, their errors are wrapped already
+		return zipAuto(files, output, opts...)
 	}
 
 	if err != nil {
-		return 0, fmt.Errorf(constants.ERROR_COMPRESS, err)
+		return fmt.Errorf(constants.ERROR_COMPRESS, err)
 	}
-
-	return originalSize, nil
+	return nil
 }
 
 // writeAlgorithm writes the specified compression algorithm name to the provided writer.
-// It first writes the length of the algorithm name as a single byte, followed by the algorithm name itself.
+// It first writes the magic number and the current format version, then the length of the
+// algorithm name as a single byte, followed by the algorithm name itself.
 //
 // Parameters:
 //   - output: An io.Writer where the algorithm name will be written.
@@ -191,17 +392,7 @@ func ReadAndCompressFiles(filenameStrs []string, output io.Writer, algorithm str
 // Returns:
 //   - error: An error if writing to the output fails, otherwise nil.
 func writeAlgorithm(output io.Writer, algorithm string) error {
-	// write the length of compression algorithm
-	if err := binary.Write(output, binary.LittleEndian, uint8(len(algorithm))); err != nil {
-		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
-	}
-
-	// write the compression algorithm
-	if err := binary.Write(output, binary.LittleEndian, []byte(algorithm)); err != nil {
-		return fmt.Errorf(constants.BUFFER_WRITE_ERROR, err)
-	}
-
-	return nil
+	return format.WriteContainerHeader(output, format.ContainerHeader{Algorithm: algorithm})
 }
 
 
@@ -213,11 +404,12 @@ func writeAlgorithm(output io.Writer, algorithm string) error {
 //   - compressedFile: an io.Reader from which the compressed file is read.
 //   - outputDir: a string specifying the directory where decompressed files will be written.
 //   - algorithm: a byte slice indicating the decompression algorithm to use.
+//   - opts: optional settings passed to the codec.
 //
 // Returns:
 //   - A slice of strings containing the names of the decompressed files.
 //   - An error if the decompression process fails.
-func WriteAndDecompressFiles(compressedFile io.Reader, outputDir string, algorithm []byte) ([]string, error) {
+func WriteAndDecompressFiles(compressedFile io.Reader, outputDir string, algorithm []byte, opts ...utils.Option) ([]string, error) {
 
 	var fileNames []string
 	var err error
@@ -225,10 +417,61 @@ func WriteAndDecompressFiles(compressedFile io.Reader, outputDir string, algorit
 	switch utils.Algorithm(algorithm) {
 	case utils.HUFFMAN:
 		// Decompress the file
-		fileNames, err = hfc.Unzip(compressedFile, outputDir)
+		fileNames, err = hfc.Unzip(compressedFile, outputDir, opts...)
+		if err != nil {
+			return nil, fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+		}
+	case utils.HUFFMAN_STREAM:
+		fileNames, err = hfc.UnzipStream(compressedFile, outputDir, opts...)
+		if err != nil {
+			return nil, fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+		}
+	case utils.ARITHMETIC:
+		fileNames, err = arithmetic.Unzip(compressedFile, outputDir, opts...)
 		if err != nil {
 			return nil, fmt.Errorf(constants.ERROR_DECOMPRESS, err)
 		}
+	case utils.LZ77:
+		fileNames, err = lz77.Unzip(compressedFile, outputDir, opts...)
+		if err != nil {
+			return nil, fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+		}
+	case utils.DEFLATE:
+		fileNames, err = deflate.Unzip(compressedFile, outputDir, opts...)
+		if err != nil {
+			return nil, fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+		}
+	case utils.RLE:
+		fileNames, err = rle.Unzip(compressedFile, outputDir, opts...)
+		if err != nil {
+			return nil, fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+		}
+	case utils.BWT:
+		fileNames, err = hfc.UnzipBWT(compressedFile, outputDir, opts...)
+		if err != nil {
+			return nil, fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+		}
+	case utils.LZ4:
+		fileNames, err = lz4fast.Unzip(compressedFile, outputDir, opts...)
+		if err != nil {
+			return nil, fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+		}
+	case utils.LZ:
+		fileNames, err = lampelziv.Unzip(compressedFile, outputDir, opts...)
+		if err != nil {
+			return nil, fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+		}
+	case utils.STORE:
+		fileNames, err = store.Unzip(compressedFile, outputDir, opts...)
+		if err != nil {
+			return nil, fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+		}
+	case utils.AUTO:
+		// the groups are decompressed by this function, their errors are wrapped already
+		fileNames, err = unzipAuto(compressedFile, outputDir, opts...)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return fileNames, nil
@@ -238,92 +481,373 @@ func WriteAndDecompressFiles(compressedFile io.Reader, outputDir string, algorit
 // Decompress extracts files from a compressed archive.
 //
 // Parameters:
+//   - ctx: Cancels the decompression, the file being extracted is removed.
 //   - compressedFilePath: The path to the compressed file to be decompressed.
 //   - outputDir: The directory where the decompressed files will be stored.
+//   - opts: Optional settings such as utils.WithSplitOutput or utils.WithProgress.
+//     utils.WithVerifyKey checks the signature of the archive before anything is extracted.
 //
 // Returns:
 //   - A slice of strings containing the names of the decompressed files.
+//   - A utils.CompressionStats struct with the algorithm, the sizes of the archive and of every
+//     extracted file, the number of extracted files and the throughput of the decompression.
 //   - An error if any issue occurs during the decompression process.
 //
 // The function performs the following steps:
 //   1. Checks if the compressed file exists.
-//   2. Opens the compressed file.
-//   3. Reads the compression algorithm used.
-//   4. Verifies if the compression algorithm is supported.
-//   5. Sets the output directory.
-//   6. Ensures the output directory exists.
-//   7. Decompresses the file and writes the decompressed files to the output directory.
-func Decompress(compressedFilePath, outputDir string) ([]string, error) {
+//   2. Opens the compressed file and recognizes it with DetectContainer. A bzip2 file made by
+//      another tool is decompressed as is, ZIP archives and other files that cannot be read
+//      are reported by an *UnsupportedContainerError.
+//   3. Sets the output directory.
+//   4. Lists the entries, for the progress total and the patterns of utils.WithEntries.
+//   5. Passes the file to DecompressStream, which reads the container header, falling back
+//      to the format.VERSION_1 header, verifies the compression algorithm, ensures the output
+//      directory exists and writes the decompressed files to it.
+func Decompress(ctx context.Context, compressedFilePath, outputDir string, opts ...utils.Option) ([]string, utils.CompressionStats, error) {
 
+	start := time.Now()
+	stats := utils.CompressionStats{}
 	outputFiles := make([]string, 0)
 	// check if the compressed file exists
-	if _, err := os.Stat(compressedFilePath); os.IsNotExist(err) {
-		return nil, fmt.Errorf("compressed file '%s' does not exist", compressedFilePath)
+	compressedStat, err := os.Stat(compressedFilePath)
+	if os.IsNotExist(err) {
+		return nil, stats, fmt.Errorf("compressed file '%s' does not exist", compressedFilePath)
+	}
+	if err == nil {
+		stats.CompressedBytes = uint64(compressedStat.Size())
 	}
 
-	// decrypt the compressed file first
-	compressedFile, err := os.Open(compressedFilePath)
+	// decrypt the compressed file first, a signed archive is checked before anything is read
+	// from it
+	file, compressedFile, err := openArchive(compressedFilePath, utils.NewOptions(opts...).VerifyKey)
 	if err != nil {
-		return outputFiles, fmt.Errorf(constants.FILE_OPEN_ERROR, err)
+		return outputFiles, stats, err
 	}
 
-	defer compressedFile.Close()
+	defer file.Close()
 
-	// Read the compression algorithm
-	algorithm, err := readAlgorithm(compressedFile)
+	// the files of other tools have no container header, they are recognized by their own magic
+	container, header, err := sniffContainer(compressedFile)
 	if err != nil {
-		return outputFiles, err
+		return outputFiles, stats, err
+	}
+	if err := CheckContainer(container, header); err != nil {
+		return outputFiles, stats, err
+	}
+	stats.Algorithm = ArchiveAlgorithm(header)
+	// the extracted files are counted as they are written
+	opts = stats.CountFiles(opts, true)
+	if container == CONTAINER_BZIP2 {
+		setOutputDir(&outputDir, compressedFilePath)
+		if err := utils.MakeOutputDir(outputDir); err != nil {
+			return nil, stats, err
+		}
+		fileNames, err := bzip2.Unzip(utils.CancelReader(ctx, compressedFile), outputDir, bzip2.EntryName(compressedFilePath), opts...)
+		if err != nil {
+			return outputFiles, stats, utils.ContextError(ctx, err)
+		}
+		stats.Finish(start)
+		return fileNames, stats, nil
 	}
 
-	// Check if the compression algorithm is supported
-	err = CheckCompressionAlgorithm(string(algorithm))
+	setOutputDir(&outputDir, compressedFilePath)
+
+	// an archive that cannot be listed is decompressed without the entries, the decompression
+	// reports what is wrong with it. The signature was checked already, the archive is listed
+	// from the same section.
+	entries, err := ListStream(io.NewSectionReader(compressedFile, 0, compressedFile.Size()))
 	if err != nil {
-		return outputFiles, err
+		entries = nil
 	}
 
-	setOutputDir(&outputDir, compressedFilePath)
+	fileNames, err := DecompressStream(ctx, compressedFile, outputDir, entries, opts...)
+	if err != nil {
+		return fileNames, stats, err
+	}
+	stats.SetEntrySizes(entries)
+	stats.Finish(start)
+	return fileNames, stats, nil
+}
 
-	// Check if the output directory exists
-	if err := utils.MakeOutputDir(outputDir); err != nil {
+// DecompressStream extracts the files of an archive read from input, like Decompress does for
+// a file. input is read once from the start to the end of the archive, so it can be a pipe such
+// as the plaintext of encryption.DecryptPipe. A tar.gz stream is recognized by its magic and
+// extracted with the targz package, bzip2 files are not recognized.
+//
+// Parameters:
+//   - ctx: Cancels the decompression, the file being extracted is removed.
+//   - input: The archive, positioned at its container header.
+//   - outputDir: The directory where the decompressed files will be stored, "." when empty.
+//   - entries: The entries of the archive when they were listed before, for example by
+//     ListStream in an earlier pass over the archive, nil otherwise. With them the patterns of
+//     utils.WithEntries that match no entry are reported before anything is extracted, and the
+//     progress reports the total size of the extracted entries.
+//   - opts: Optional settings such as utils.WithSplitOutput or utils.WithProgress.
+//
+// Returns:
+//   - A slice of strings containing the names of the decompressed files.
+//   - An error if any issue occurs during the decompression process.
+func DecompressStream(ctx context.Context, input io.Reader, outputDir string, entries []utils.EntryInfo, opts ...utils.Option) ([]string, error) {
+	buffered := bufio.NewReaderSize(input, utils.NewOptions(opts...).BufferSize)
+
+	container, magic, err := peekContainer(buffered)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckContainer(container, magic); err != nil {
+		return nil, err
+	}
+	switch container {
+	case CONTAINER_GZIP, CONTAINER_TAR, CONTAINER_BZIP2:
+		return decompressForeign(ctx, buffered, container, outputDir, entries, opts...)
+	case CONTAINER_ENCRYPTED:
+		return nil, unsupportedContainer(container, magic)
+	}
+
+	// Read the compression algorithm and the format version
+	header, err := readHeader(buffered)
+	if err != nil {
 		return nil, err
 	}
 
-	// Decompress the file
-	fileNames, err := WriteAndDecompressFiles(compressedFile, outputDir, algorithm)
+	return decompressPayload(ctx, buffered, header, outputDir, entries, opts...)
+}
+
+// decompressForeign extracts a tar, a tar.gz or a bzip2 file made by another tool, like
+// DecompressStream. A bzip2 file read from a stream has no name, its file is named "decompressed".
+func decompressForeign(ctx context.Context, input io.Reader, container Container, outputDir string, entries []utils.EntryInfo, opts ...utils.Option) ([]string, error) {
+	outputDir, opts, err := prepareOutput(outputDir, entries, opts)
 	if err != nil {
-		return outputFiles, err
+		return nil, err
 	}
 
+	var fileNames []string
+	if container == CONTAINER_BZIP2 {
+		fileNames, err = bzip2.Unzip(utils.CancelReader(ctx, input), outputDir, bzip2.EntryName(""), opts...)
+	} else {
+		fileNames, err = targz.Unzip(utils.CancelReader(ctx, input), outputDir, opts...)
+	}
+	if err != nil {
+		return nil, utils.ContextError(ctx, fmt.Errorf(constants.ERROR_DECOMPRESS, err))
+	}
 	return fileNames, nil
 }
 
-// readAlgorithm reads the compression algorithm identifier from the provided
-// compressed file reader. It first reads the length of the algorithm identifier
-// and then reads the identifier itself.
+// decompressPayload decompresses the payload that follows header, like DecompressStream.
+func decompressPayload(ctx context.Context, buffered io.Reader, header format.ContainerHeader, outputDir string, entries []utils.EntryInfo, opts ...utils.Option) ([]string, error) {
+	algorithm := []byte(header.Algorithm)
+
+	// Check if the compression algorithm is supported
+	err := CheckCompressionAlgorithm(string(algorithm))
+	if err != nil {
+		return nil, err
+	}
+
+	outputDir, opts, err = prepareOutput(outputDir, entries, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decompress the file, archives without a version field only hold Huffman data
+	var fileNames []string
+	if header.Version == format.VERSION_1 {
+		fileNames, err = hfc.UnzipLegacy(utils.CancelReader(ctx, buffered), outputDir, opts...)
+		if err != nil {
+			err = fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+		}
+	} else {
+		opts = append(opts, utils.WithFormatVersion(header.Version))
+		fileNames, err = WriteAndDecompressFiles(utils.CancelReader(ctx, buffered), outputDir, algorithm, opts...)
+	}
+	if err != nil {
+		return nil, utils.ContextError(ctx, err)
+	}
+
+	return fileNames, nil
+}
+
+// ExtractFile extracts a single file of an archive as written by the CLI, decrypting it first.
+// The entries before and after it are skipped using their stored compressed sizes, without
+// decoding them, see hfc.SkipFile. The decrypted archive is only read through a pipe, it is never written to disk.
 //
 // Parameters:
-//   compressedFile (io.Reader): The reader from which the algorithm identifier
-//   is to be read.
+//   - archivePath: The path to the archive.
+//   - password: The password the archive was encrypted with, empty when it was not.
+//   - targetFilename: The name of the entry, matched like the patterns of utils.WithEntries.
+//   - outputDir: The directory where the file is written, "." when empty.
+//   - options: Optional decryption settings, such as the key file of the archive or the
+//     VerifyKey of a signed archive.
 //
 // Returns:
-//   ([]byte, error): A byte slice containing the algorithm identifier if successful,
-//   or an error if there was a problem reading from the file.
-func readAlgorithm(compressedFile io.Reader) ([]byte, error) {
-	var algoLen uint8
-	var err error
+//   - error: if the archive cannot be decrypted or decompressed, or has no entry named
+//     targetFilename
+func ExtractFile(archivePath, password, targetFilename, outputDir string, options ...encryption.EncryptionOptions) error {
+	archiveFile, archive, err := openArchive(archivePath, archiveVerifyKey(options))
+	if err != nil {
+		return err
+	}
+
+	defer archiveFile.Close()
+
+	var paths []string
+	ctx := context.Background()
+	err = encryption.DecryptPipe(ctx, archive, password, func(plaintext io.Reader) error {
+		paths, err = DecompressStream(ctx, plaintext, outputDir, nil, utils.WithEntries([]string{targetFilename}))
+		return err
+	}, options...)
+	if err != nil {
+		return err
+	}
+
+	// the entries are not listed before, a name that matches none is noticed afterwards
+	if len(paths) == 0 {
+		return checkEntries(nil, []string{targetFilename})
+	}
+
+	return nil
+}
 
-	// read the length of compression algorithm
-	if err = binary.Read(compressedFile, binary.LittleEndian, &algoLen); err != nil {
-		return nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+// DecompressFiles extracts only the entries of a compressed archive whose names match one of
+// the given patterns, the other entries are skipped using their stored compressed sizes.
+// Patterns follow utils.MatchEntry. Without patterns every entry is extracted.
+//
+// Parameters:
+//   - ctx: Cancels the decompression, like for Decompress.
+//   - compressedFilePath: The path to the compressed file to be decompressed.
+//   - outputDir: The directory where the decompressed files will be stored.
+//   - names: The names or glob patterns of the entries to extract.
+//   - opts: Optional settings such as utils.WithSplitOutput.
+//
+// Returns:
+//   - A slice of strings containing the names of the decompressed files.
+//   - An error naming every pattern that matches no entry, checked before anything is
+//     extracted, or an error if the decompression fails.
+func DecompressFiles(ctx context.Context, compressedFilePath, outputDir string, names []string, opts ...utils.Option) ([]string, error) {
+	if len(names) == 0 {
+		paths, _, err := Decompress(ctx, compressedFilePath, outputDir, opts...)
+		return paths, err
 	}
 
-	// read the compression algorithm
-	algo := make([]byte, algoLen)
-	if err = binary.Read(compressedFile, binary.LittleEndian, &algo); err != nil {
-		return nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	// Decompress checks the names against the listed entries, an archive that cannot be
+	// listed would be extracted without the check
+	if _, err := List(compressedFilePath, opts...); err != nil {
+		return nil, err
 	}
 
-	return algo, nil
+	paths, _, err := Decompress(ctx, compressedFilePath, outputDir, append(opts, utils.WithEntries(names))...)
+	return paths, err
+}
+
+// prepareOutput checks the patterns of utils.WithEntries against entries and adds their total
+// to the progress when the entries are known, then creates the output directory, "." when empty.
+func prepareOutput(outputDir string, entries []utils.EntryInfo, opts []utils.Option) (string, []utils.Option, error) {
+	if entries != nil {
+		if err := checkEntries(entries, utils.NewOptions(opts...).Entries); err != nil {
+			return "", nil, err
+		}
+		opts = withProgressTotal(entries, opts)
+	}
+
+	if outputDir == "" {
+		outputDir = "."
+	}
+	// Check if the output directory exists
+	if err := utils.MakeOutputDir(outputDir); err != nil {
+		return "", nil, err
+	}
+	return outputDir, opts, nil
+}
+
+// checkEntries returns an error naming every pattern that matches none of entries.
+func checkEntries(entries []utils.EntryInfo, patterns []string) error {
+	missing := []string{}
+	for _, pattern := range patterns {
+		found := false
+		for _, entry := range entries {
+			if utils.MatchEntry(pattern, entry.Name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, pattern)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("entries not found in the archive: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// withProgressTotal fills in the total size the codecs cannot know while extracting, the sum of
+// the original sizes of the entries that are extracted.
+func withProgressTotal(entries []utils.EntryInfo, opts []utils.Option) []utils.Option {
+	options := utils.NewOptions(opts...)
+	total := int64(0)
+	for _, entry := range entries {
+		if options.Selects(entry.Name) {
+			total += int64(entry.OriginalSize)
+		}
+	}
+
+	progress := options.Progress
+	return append(opts, utils.WithProgressTotal(total), utils.WithProgress(func(filename string, bytesProcessed, totalBytes int64) {
+		if totalBytes < 0 {
+			totalBytes = total
+		}
+		progress(filename, bytesProcessed, totalBytes)
+	}))
+}
+
+// readHeader reads the container header from the provided compressed file reader. It first
+// checks the magic number and the format version, then reads the length of the algorithm
+// identifier and the identifier itself. Input without the magic number is read as a
+// format.VERSION_1 header instead, which is accepted only for the Huffman algorithm, after the
+// metadata byte the first releases wrote before it.
+//
+// Parameters:
+//   compressedFile (*bufio.Reader): The reader from which the header is to be read, the magic
+//   number is peeked so the legacy header can be read without seeking back.
+//
+// Returns:
+//   (format.ContainerHeader, error): The header if successful, *format.ErrNotAnArchive if
+//   the input is not an archive, *format.ErrUnsupportedVersion if this build cannot read
+//   its version, or an error if there was a problem reading from the file.
+func readHeader(compressedFile *bufio.Reader) (format.ContainerHeader, error) {
+	magic, err := compressedFile.Peek(len(format.MAGIC))
+	if err != nil && err != io.EOF {
+		return format.ContainerHeader{}, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	if string(magic) == format.MAGIC {
+		return format.ReadContainerHeader(compressedFile)
+	}
+
+	notAnArchive := &format.ErrNotAnArchive{Found: append([]byte(nil), magic...)}
+	// the first releases wrote the metadata byte of an archive without a password before it, a
+	// buffer smaller than DETECT_LEN still holds the start of the header
+	if start, _ := compressedFile.Peek(DETECT_LEN); isLegacyArchive(start) {
+		if _, err := compressedFile.Discard(1); err != nil {
+			return format.ContainerHeader{}, fmt.Errorf(constants.FILE_READ_ERROR, err)
+		}
+	}
+	legacy, legacyErr := format.ReadLegacyHeader(compressedFile)
+	if legacyErr != nil || utils.Algorithm(legacy.Algorithm) != utils.HUFFMAN {
+		return format.ContainerHeader{}, notAnArchive
+	}
+
+	return legacy, nil
+}
+
+// ErrVersion1 is returned where the entry fields a format.VERSION_1 archive is missing are
+// needed, such archives can only be decompressed.
+var ErrVersion1 = errors.New("version 1 archives can only be decompressed, recreate the archive to use this feature")
+
+// checkCurrentVersion rejects format.VERSION_1 archives with ErrVersion1.
+func checkCurrentVersion(header format.ContainerHeader) error {
+	if header.Version == format.VERSION_1 {
+		return ErrVersion1
+	}
+	return nil
 }
 
 // setOutputDir sets the output directory to the directory of the first file if the output directory is not provided.
@@ -338,6 +862,112 @@ func setOutputDir(outputDir *string, firstFilename string) {
 	}
 }
 
+// warnLongNames warns about entry names that most filesystems will refuse on extraction.
+// Such archives can still be extracted with utils.WithTruncateLongNames.
+func warnLongNames(files []utils.FileData, options utils.Options) {
+	for _, file := range files {
+		for _, component := range utils.LongNameComponents(file.Name, utils.MAX_NAME_COMPONENT_LEN) {
+			options.Warn(fmt.Sprintf("%s has a %d byte name component, most filesystems accept at most %d. Extract it with -truncate-long-names.",
+				file.Name, len(component), utils.MAX_NAME_COMPONENT_LEN))
+		}
+	}
+}
+
+// entryName returns the name the file at path is stored under when it was found through the
+// command line argument root, which is path itself for a file and a parent of it for a directory.
+// The name is relative to the parent of root, so compressing /tmp/data stores /tmp/data/a.txt
+// as data/a.txt and a single file under its base name. It always uses forward slashes.
+// With keepPaths path is returned unchanged.
+//
+// Parameters:
+//   - root: The argument the file was found through.
+//   - path: The path of the file.
+//   - keepPaths: Whether to keep path as it is, see utils.WithKeepPaths.
+//
+// Returns:
+//   - string: the entry name
+//   - error: if the absolute path of root or path cannot be determined
+func entryName(root, path string, keepPaths bool) (string, error) {
+	if keepPaths {
+		return path, nil
+	}
+
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", root, err)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+
+	name, err := filepath.Rel(filepath.Dir(absRoot), absPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to make %s relative to %s: %w", path, root, err)
+	}
+	return filepath.ToSlash(name), nil
+}
+
+// openArchive opens the archive at path, the file has to be closed. With a verifyKey the
+// signature of the archive is checked and the reader ends before it, without one a signed
+// archive is refused with encryption.ErrVerifyKeyRequired, see encryption.ArchiveSection.
+func openArchive(path string, verifyKey ed25519.PublicKey) (*os.File, *io.SectionReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf(constants.FILE_OPEN_ERROR, err)
+	}
+	content, err := encryption.ArchiveSection(file, verifyKey)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, content, nil
+}
+
+// archiveVerifyKey returns the key a signed archive is read with, the VerifyKey of the first
+// options, nil without options.
+func archiveVerifyKey(options []encryption.EncryptionOptions) ed25519.PublicKey {
+	if len(options) == 0 {
+		return nil
+	}
+	return options[0].VerifyKey
+}
+
+// openFile opens the file at path to compress it. Files of at least mmapThreshold bytes are
+// mapped into memory with utils.MmapReader, a negative mmapThreshold reads every file.
+func openFile(path string, size int64, mmapThreshold int64) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf(constants.FILE_OPEN_ERROR, err)
+	}
+	if mmapThreshold < 0 || size < mmapThreshold {
+		return file, nil
+	}
+
+	reader, err := utils.MmapReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// isExcluded reports whether the file or directory at path, found below root, matches one of
+// the patterns of exclude. The patterns are matched against its entry name and against its path
+// relative to root, so ".git/**" skips the .git directory of root whatever the entry names.
+func isExcluded(root, path, name string, exclude []string) (bool, error) {
+	excluded, err := utils.MatchesAnyPattern(name, exclude)
+	if err != nil || excluded {
+		return excluded, err
+	}
+
+	relative, err := filepath.Rel(root, path)
+	if err != nil || relative == "." {
+		return false, nil
+	}
+	return utils.MatchesAnyPattern(relative, exclude)
+}
+
 // walkDir traverses the directory specified by filenameStr and collects information
 // about each file into the fileDataArr slice. It skips directories and only processes files.
 // Each file's data is stored in a utils.FileData struct, which includes the file's name,
@@ -346,29 +976,55 @@ func setOutputDir(outputDir *string, firstFilename string) {
 // Parameters:
 //   - filenameStr: The path of the directory to walk.
 //   - fileDataArr: A pointer to a slice of utils.FileData where file information will be stored.
+//   - options: KeepPaths stores the files under their paths instead of names relative to the
+//     parent of the directory, see entryName. The files and directories matching a pattern of
+//     Exclude are skipped and passed to Excluded, see isExcluded. Files of at least
+//     MmapThreshold bytes are mapped into memory, see openFile.
 //
 // Returns:
-//   - error: An error if the directory walk fails or if there are issues opening files.
-func walkDir(filenameStr string, fileDataArr *[]utils.FileData) error {
+//   - error: An error if the directory walk fails, a pattern is malformed or if there are
+//     issues opening files.
+func walkDir(filenameStr string, fileDataArr *[]utils.FileData, options utils.Options) error {
 	err := filepath.Walk(filenameStr, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return fmt.Errorf("failed to walk path: %v", err)
 		}
 
+		name, err := entryName(filenameStr, path, options.KeepPaths)
+		if err != nil {
+			return err
+		}
+
+		excluded, err := isExcluded(filenameStr, path, name, options.Exclude)
+		if err != nil {
+			return err
+		}
+
 		if info.IsDir() {
+			// nothing below an excluded directory is read
+			if excluded {
+				options.Excluded(name, true)
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if excluded {
+			options.Excluded(name, false)
 			return nil
 		}
 
-		file, err := os.Open(path)
+		// closed by ReadAndCompressFiles once the archive is written
+		file, err := openFile(path, info.Size(), options.MmapThreshold)
 		if err != nil {
-			return fmt.Errorf(constants.FILE_OPEN_ERROR, err)
+			return err
 		}
-		defer file.Close()
 
 		fileData := utils.FileData{
-			Name: path,
+			Name: name,
 			Size: info.Size(),
 			Reader: file,
+			ModTime: info.ModTime(),
+			Mode: info.Mode(),
 		}
 
 		*fileDataArr = append(*fileDataArr, fileData)
@@ -376,8 +1032,374 @@ func walkDir(filenameStr string, fileDataArr *[]utils.FileData) error {
 		return nil
 	})
 	if err != nil {
-		return fmt.Errorf("failed to walk directory: %v", err)
+		return fmt.Errorf("failed to walk directory: %w", err)
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// Verify checks every entry of a compressed archive without writing any output and
+// collects all damaged entries into a report instead of stopping at the first one.
+//
+// Parameters:
+//   - compressedFilePath: The path to the (decrypted) compressed file to verify.
+//   - opts: utils.WithVerifyKey checks the signature of a signed archive first.
+//
+// Returns:
+//   - utils.VerifyReport: the report. If the archive header itself cannot be read the
+//     report status is utils.VERIFY_UNREADABLE.
+//   - error: An error if the file cannot be opened or its signature does not match.
+func Verify(compressedFilePath string, opts ...utils.Option) (utils.VerifyReport, error) {
+	file, compressedFile, err := openArchive(compressedFilePath, utils.NewOptions(opts...).VerifyKey)
+	if err != nil {
+		return utils.VerifyReport{}, err
+	}
+
+	defer file.Close()
+
+	return VerifyStream(compressedFile), nil
+}
+
+// VerifyStream checks the archive read from input like Verify does for a file. input is read
+// once, so it can be a pipe such as the plaintext of encryption.DecryptPipe. A tar.gz stream is
+// checked by targz.Verify.
+//
+// Parameters:
+//   - input: The archive, positioned at its container header.
+//
+// Returns:
+//   - utils.VerifyReport: the report, with offsets relative to the start of input
+func VerifyStream(input io.Reader) utils.VerifyReport {
+	report := utils.VerifyReport{}
+	compressedFile := bufio.NewReader(input)
+
+	container, magic, err := peekContainer(compressedFile)
+	if err == nil {
+		err = CheckContainer(container, magic)
+	}
+	switch {
+	case err == nil && (container == CONTAINER_GZIP || container == CONTAINER_TAR):
+		return targz.Verify(compressedFile)
+	case err == nil && (container == CONTAINER_BZIP2 || container == CONTAINER_ENCRYPTED):
+		err = unsupportedContainer(container, magic)
+	}
+	if err != nil {
+		report.Structural = err.Error()
+		report.Finish()
+		return report
+	}
+
+	header, err := readHeader(compressedFile)
+	if err == nil {
+		err = checkCurrentVersion(header)
+	}
+	if err == nil {
+		err = CheckCompressionAlgorithm(header.Algorithm)
+	}
+	algorithm := header.Algorithm
+	if err != nil {
+		report.Structural = err.Error()
+		report.Finish()
+		return report
+	}
+
+	report = verifyPayload(compressedFile, utils.Algorithm(algorithm), header.Version)
+
+	// offsets are relative to the payload, which starts after the container header
+	report.OffsetBy(int64(format.ContainerHeaderLen(string(algorithm))))
+
+	return report
+}
+
+// verifyPayload checks the payload of algorithm read from input, offsets are relative to its start.
+func verifyPayload(input io.Reader, algorithm utils.Algorithm, version uint16) utils.VerifyReport {
+	switch algorithm {
+	case utils.HUFFMAN:
+		return hfc.Verify(input, utils.WithFormatVersion(version))
+	case utils.HUFFMAN_STREAM:
+		return hfc.VerifyStream(input, utils.WithFormatVersion(version))
+	case utils.BWT:
+		return hfc.VerifyBWT(input, utils.WithFormatVersion(version))
+	case utils.ARITHMETIC:
+		return arithmetic.Verify(input)
+	case utils.LZ77:
+		return lz77.Verify(input)
+	case utils.DEFLATE:
+		return deflate.Verify(input)
+	case utils.RLE:
+		return rle.Verify(input)
+	case utils.LZ4:
+		return lz4fast.Verify(input)
+	case utils.LZ:
+		return lampelziv.Verify(input)
+	case utils.STORE:
+		return store.Verify(input)
+	case utils.AUTO:
+		return verifyAuto(input, version)
+	}
+
+	report := utils.VerifyReport{Structural: fmt.Sprintf("verification is not supported for %s archives", algorithm)}
+	report.Finish()
+	return report
+}
+
+// VerificationError is a damaged entry found by VerifyArchive.
+type VerificationError struct {
+	// Name is the entry name, empty if the name itself could not be decoded.
+	Name string
+	Kind utils.FailureKind
+	// Offset is the position of the entry header in the decrypted archive.
+	Offset int64
+	Err    error
+}
+
+func (e VerificationError) Error() string {
+	name := e.Name
+	if name == "" {
+		name = "<unknown>"
+	}
+	return fmt.Sprintf("%s: %s: %v", name, e.Kind, e.Err)
+}
+
+func (e VerificationError) Unwrap() error {
+	return e.Err
+}
+
+// VerificationErrors is returned by VerifyArchive when entries are damaged, one error per entry.
+type VerificationErrors []VerificationError
+
+func (e VerificationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, failure := range e {
+		messages[i] = failure.Error()
+	}
+	return fmt.Sprintf("%d damaged entries: %s", len(e), strings.Join(messages, "; "))
+}
+
+func (e VerificationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, failure := range e {
+		errs[i] = failure
+	}
+	return errs
+}
+
+// VerifyArchiveReport checks an archive as written by the CLI, decrypting it first, like
+// Verify does for a decrypted archive. Nothing is written to disk.
+//
+// Parameters:
+//   - ctx: Cancels the verification.
+//   - archivePath: The path to the archive.
+//   - password: The password the archive was encrypted with, empty when it was not.
+//   - options: Optional decryption settings, such as the key file of the archive.
+//
+// Returns:
+//   - utils.VerifyReport: the report of the entries that were reached
+//   - error: if the archive cannot be opened or decrypted
+func VerifyArchiveReport(ctx context.Context, archivePath, password string, options ...encryption.EncryptionOptions) (utils.VerifyReport, error) {
+	archiveFile, archive, err := openArchive(archivePath, archiveVerifyKey(options))
+	if err != nil {
+		return utils.VerifyReport{}, err
+	}
+
+	defer archiveFile.Close()
+
+	// a tar, a tar.gz or an archive written without the CLI is not encrypted
+	container, magic, err := sniffContainer(archive)
+	if err != nil {
+		return utils.VerifyReport{}, err
+	}
+	if err := CheckContainer(container, magic); err != nil {
+		return utils.VerifyReport{}, err
+	}
+	if container != CONTAINER_ENCRYPTED {
+		return VerifyStream(archive), nil
+	}
+
+	report := utils.VerifyReport{}
+	// the archive is verified while it is decrypted
+	err = encryption.DecryptPipe(ctx, archive, password, func(plaintext io.Reader) error {
+		report = VerifyStream(plaintext)
+		return nil
+	}, options...)
+	return report, err
+}
+
+// VerifyArchive decrypts and decompresses every entry of an archive, discarding the output,
+// to tell whether it can be extracted.
+//
+// Parameters:
+//   - archivePath: The path to the archive.
+//   - password: The password the archive was encrypted with, empty when it was not.
+//   - options: Optional decryption settings, such as the key file of the archive.
+//
+// Returns:
+//   - error: nil when every entry is intact, VerificationErrors naming the damaged entries,
+//     or the error that kept the archive from being read at all
+func VerifyArchive(archivePath, password string, options ...encryption.EncryptionOptions) error {
+	report, err := VerifyArchiveReport(context.Background(), archivePath, password, options...)
+	if err != nil {
+		return err
+	}
+	if report.Structural != "" {
+		return errors.New(report.Structural)
+	}
+	if len(report.Failures) == 0 {
+		return nil
+	}
+
+	errs := make(VerificationErrors, len(report.Failures))
+	for i, failure := range report.Failures {
+		errs[i] = VerificationError{Name: failure.Name, Kind: failure.Kind, Offset: failure.Offset, Err: errors.New(failure.Error)}
+	}
+	return errs
+}
+
+// List reads the names, sizes, modification times and modes stored in a compressed archive
+// without extracting anything. The entry data is skipped using the stored compressed sizes.
+//
+// Parameters:
+//   - compressedFilePath: The path to the (decrypted) compressed file to list.
+//   - opts: utils.WithVerifyKey checks the signature of a signed archive first.
+//
+// Returns:
+//   - []utils.EntryInfo: the entries in archive order.
+//   - error: An error if the file cannot be opened, its signature does not match, or it is not
+//     a supported archive or is truncated.
+func List(compressedFilePath string, opts ...utils.Option) ([]utils.EntryInfo, error) {
+	file, compressedFile, err := openArchive(compressedFilePath, utils.NewOptions(opts...).VerifyKey)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	return ListStream(compressedFile)
+}
+
+// ListStream lists the entries of the archive read from input like List does for a file.
+// input is read once and only up to the end of the last entry, so it can be a pipe such as
+// the plaintext of encryption.DecryptPipe. The entries of a tar.gz stream are listed by
+// targz.List, which decompresses it to its end.
+//
+// Parameters:
+//   - input: The archive, positioned at its container header.
+//
+// Returns:
+//   - []utils.EntryInfo: the entries in archive order.
+//   - error: An error if the input is not a supported archive or is truncated.
+func ListStream(input io.Reader) ([]utils.EntryInfo, error) {
+	compressedFile := bufio.NewReader(input)
+
+	container, magic, err := peekContainer(compressedFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckContainer(container, magic); err != nil {
+		return nil, err
+	}
+	switch container {
+	case CONTAINER_GZIP, CONTAINER_TAR:
+		entries, err := targz.List(compressedFile)
+		algorithm := ArchiveAlgorithm(magic)
+		for i := range entries {
+			entries[i].Algorithm = algorithm
+		}
+		return entries, err
+	case CONTAINER_BZIP2, CONTAINER_ENCRYPTED:
+		return nil, unsupportedContainer(container, magic)
+	}
+
+	header, err := readHeader(compressedFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCurrentVersion(header); err != nil {
+		return nil, err
+	}
+	return listPayload(compressedFile, utils.Algorithm(header.Algorithm), header.Version)
+}
+
+// listPayload lists the entries of the payload of algorithm read from input.
+func listPayload(input io.Reader, algorithm utils.Algorithm, version uint16) ([]utils.EntryInfo, error) {
+	var entries []utils.EntryInfo
+	var err error
+	switch algorithm {
+	case utils.HUFFMAN, utils.BWT:
+		// BWT archives only differ from Huffman ones in the entry data
+		entries, err = hfc.List(input, utils.WithFormatVersion(version))
+	case utils.HUFFMAN_STREAM:
+		entries, err = hfc.ListStream(input, utils.WithFormatVersion(version))
+	case utils.ARITHMETIC:
+		entries, err = arithmetic.List(input)
+	case utils.LZ77:
+		entries, err = lz77.List(input)
+	case utils.DEFLATE:
+		entries, err = deflate.List(input)
+	case utils.RLE:
+		entries, err = rle.List(input)
+	case utils.LZ4:
+		entries, err = lz4fast.List(input)
+	case utils.LZ:
+		entries, err = lampelziv.List(input)
+	case utils.STORE:
+		entries, err = store.List(input)
+	case utils.AUTO:
+		// every group sets the algorithm of its entries
+		return listAuto(input, version)
+	default:
+		return nil, CheckCompressionAlgorithm(string(algorithm))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range entries {
+		entries[i].Algorithm = string(algorithm)
+	}
+
+	return entries, nil
+}
+
+// ListArchive lists the entries of an archive as written by the CLI, decrypting it first.
+// The decrypted archive is only read through a pipe, it is never written to disk.
+//
+// Parameters:
+//   - archivePath: The path to the archive.
+//   - password: The password the archive was encrypted with, empty when it was not.
+//   - options: Optional decryption settings, such as the key file of the archive.
+//
+// Returns:
+//   - []utils.EntryInfo: the entries in archive order, with the algorithm of the archive
+//   - error: if the archive cannot be decrypted or its headers cannot be read
+func ListArchive(archivePath, password string, options ...encryption.EncryptionOptions) ([]utils.EntryInfo, error) {
+	archiveFile, archive, err := openArchive(archivePath, archiveVerifyKey(options))
+	if err != nil {
+		return nil, err
+	}
+
+	defer archiveFile.Close()
+
+	// a tar, a tar.gz or an archive written without the CLI is not encrypted
+	container, magic, err := sniffContainer(archive)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckContainer(container, magic); err != nil {
+		return nil, err
+	}
+	if container != CONTAINER_ENCRYPTED {
+		return ListStream(archive)
+	}
+
+	var entries []utils.EntryInfo
+	err = encryption.DecryptPipe(context.Background(), archive, password, func(plaintext io.Reader) error {
+		entries, err = ListStream(plaintext)
+		return err
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
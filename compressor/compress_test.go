@@ -1,9 +1,29 @@
 package compressor
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
+	"math/rand"
 	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"file-compressor/constants"
+	"file-compressor/encryption"
+	"file-compressor/format"
+	"file-compressor/utils"
 )
 
 func TestCompress(t *testing.T) {
@@ -23,13 +43,14 @@ func Init(algo string, t *testing.T) string {
 	}
 
 	outputDir := "test_files/compress_output"
-	outputPath, fileMeta, err := Compress(fileNameStrs, outputDir, algo)
+	outputPath, fileMeta, err := Compress(context.Background(), fileNameStrs, outputDir, algo)
 	if err != nil {
 		t.Fatalf("failed to compress files: %v", err)
 	}
 
-	fileMeta.PrintFileInfo()
-	fileMeta.PrintCompressionRatio()
+	ratio := fileMeta.Ratio()
+	ratio.PrintFileInfo()
+	ratio.PrintCompressionRatio()
 
 	fmt.Println("Compression done: ", outputPath)
 
@@ -38,7 +59,7 @@ func Init(algo string, t *testing.T) string {
 
 func DecompressStart(compressedPath string, t *testing.T) {
 	fmt.Printf("Decompressing file: %s\n", compressedPath)
-	_, err := Decompress(compressedPath, "test_files/decompressed_output")
+	_, _, err := Decompress(context.Background(), compressedPath, "test_files/decompressed_output")
 	if err != nil {
 		t.Fatalf("failed to decompress files: %v", err)
 	}
@@ -53,4 +74,1862 @@ func DecompressStart(compressedPath string, t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to delete decompressed files: %v", err)
 	}
-}
\ No newline at end of file
+}
+func TestDecompressSplitOutput(t *testing.T) {
+	compressedPath := Init("huffman", t)
+	defer os.RemoveAll("test_files/compress_output")
+
+	outputDir := "test_files/split_output"
+	defer os.RemoveAll(outputDir)
+
+	descriptors, _, err := Decompress(context.Background(), compressedPath, outputDir, utils.WithSplitOutput(100))
+	if err != nil {
+		t.Fatalf("failed to decompress files: %v", err)
+	}
+
+	for _, descriptorPath := range descriptors {
+		if !strings.HasSuffix(descriptorPath, utils.SPLIT_DESCRIPTOR_EXT) {
+			t.Fatalf("expected a split descriptor, got %s", descriptorPath)
+		}
+
+		joinedPath, err := utils.JoinParts(descriptorPath, filepath.Join(outputDir, "joined"), false)
+		if err != nil {
+			t.Fatalf("failed to join parts: %v", err)
+		}
+
+		originalPath := filepath.Join("test_files/input", strings.TrimSuffix(strings.TrimPrefix(filepath.ToSlash(descriptorPath), outputDir+"/"), utils.SPLIT_DESCRIPTOR_EXT))
+		original, err := os.ReadFile(originalPath)
+		if err != nil {
+			t.Fatalf("failed to read original file: %v", err)
+		}
+
+		joined, err := os.ReadFile(joinedPath)
+		if err != nil {
+			t.Fatalf("failed to read joined file: %v", err)
+		}
+
+		if !bytes.Equal(original, joined) {
+			t.Fatalf("joined %s does not match original %s", joinedPath, originalPath)
+		}
+	}
+}
+
+func TestArithmeticRoundTrip(t *testing.T) {
+	compressedPath := Init(string(utils.ARITHMETIC), t)
+	defer os.RemoveAll("test_files/compress_output")
+
+	outputDir := "test_files/arithmetic_output"
+	defer os.RemoveAll(outputDir)
+
+	paths, _, err := Decompress(context.Background(), compressedPath, outputDir)
+	if err != nil {
+		t.Fatalf("failed to decompress files: %v", err)
+	}
+
+	testFiles, err := os.ReadDir("test_files/input")
+	if err != nil {
+		t.Fatalf("failed to read test files directory: %v", err)
+	}
+	if len(paths) != len(testFiles) {
+		t.Fatalf("expected %d files, got %d", len(testFiles), len(paths))
+	}
+
+	for _, path := range paths {
+		original, err := os.ReadFile(filepath.Join("test_files/input", filepath.Base(path)))
+		if err != nil {
+			t.Fatalf("failed to read original of %s: %v", path, err)
+		}
+		decompressed, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		if !bytes.Equal(original, decompressed) {
+			t.Fatalf("%s does not match the original", path)
+		}
+	}
+}
+
+func TestLZ77(t *testing.T) {
+	DecompressStart(Init(string(utils.LZ77), t), t)
+}
+
+func TestLZ77RoundTrip(t *testing.T) {
+	inputDir := t.TempDir()
+	contents := map[string][]byte{
+		"text.txt":   bytes.Repeat([]byte("to be or not to be, "), 50),
+		"binary.bin": {0, 1, 0, 0, 2, 0, 0, 0, 255, 0},
+		"zeros.bin":  make([]byte, 100),
+	}
+
+	fileNames := []string{}
+	for name, content := range contents {
+		path := filepath.Join(inputDir, name)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		fileNames = append(fileNames, path)
+	}
+
+	compressedPath, _, err := Compress(context.Background(), fileNames, t.TempDir(), string(utils.LZ77))
+	if err != nil {
+		t.Fatalf("failed to compress files: %v", err)
+	}
+
+	paths, _, err := Decompress(context.Background(), compressedPath, t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to decompress files: %v", err)
+	}
+	if len(paths) != len(contents) {
+		t.Fatalf("expected %d files, got %d", len(contents), len(paths))
+	}
+
+	for _, path := range paths {
+		decompressed, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		if !bytes.Equal(contents[filepath.Base(path)], decompressed) {
+			t.Fatalf("%s does not match the original", path)
+		}
+	}
+}
+
+func TestDeflate(t *testing.T) {
+	DecompressStart(Init(string(utils.DEFLATE), t), t)
+}
+
+func TestRLE(t *testing.T) {
+	DecompressStart(Init(string(utils.RLE), t), t)
+}
+
+func TestBWT(t *testing.T) {
+	DecompressStart(Init(string(utils.BWT), t), t)
+}
+
+func TestLZ4(t *testing.T) {
+	DecompressStart(Init(string(utils.LZ4), t), t)
+}
+
+func TestLZ(t *testing.T) {
+	DecompressStart(Init(string(utils.LZ), t), t)
+}
+
+func TestStore(t *testing.T) {
+	DecompressStart(Init(string(utils.STORE), t), t)
+}
+
+// BenchmarkAlgorithms compresses the test corpus with Deflate and Huffman coding and
+// reports the size of the archive relative to the input.
+func BenchmarkAlgorithms(b *testing.B) {
+	benchmarkAlgorithms(b, testFileNames(b), []utils.Algorithm{utils.DEFLATE, utils.HUFFMAN})
+}
+
+// BenchmarkDeflateLevels compares Huffman coding with the fastest, the default and the
+// smallest level of Deflate on the test corpus.
+func BenchmarkDeflateLevels(b *testing.B) {
+	fileNameStrs := testFileNames(b)
+	benchmarkAlgorithms(b, fileNameStrs, []utils.Algorithm{utils.HUFFMAN})
+	for _, level := range []utils.CompressionLevel{utils.LevelFast, 6, utils.LevelBest} {
+		b.Run(fmt.Sprintf("level-%d", level), func(b *testing.B) {
+			benchmarkAlgorithms(b, fileNameStrs, []utils.Algorithm{utils.DEFLATE}, utils.WithLevel(level))
+		})
+	}
+}
+
+// testFileNames returns the paths of the files in the test corpus.
+func testFileNames(b *testing.B) []string {
+	testFilesDir := "test_files/input"
+	testFiles, err := os.ReadDir(testFilesDir)
+	if err != nil {
+		b.Fatalf("failed to read test files directory: %v", err)
+	}
+
+	fileNameStrs := make([]string, 0)
+	for _, file := range testFiles {
+		fileNameStrs = append(fileNameStrs, filepath.Join(testFilesDir, file.Name()))
+	}
+	return fileNameStrs
+}
+
+// BenchmarkBWT compares Huffman coding with and without the Burrows-Wheeler and move-to-front
+// stage on a text file.
+func BenchmarkBWT(b *testing.B) {
+	benchmarkAlgorithms(b, []string{"test_files/input/example.txt"}, []utils.Algorithm{utils.HUFFMAN, utils.BWT})
+}
+
+// BenchmarkLZ4 compares the LZ4 block codec with Huffman coding on a text file and on binary
+// data, records of counters and random bytes like a database page.
+func BenchmarkLZ4(b *testing.B) {
+	binary := make([]byte, 0, 1<<20)
+	random := rand.New(rand.NewSource(1))
+	for i := 0; len(binary) < cap(binary); i++ {
+		binary = format.ByteOrder.AppendUint64(binary, uint64(i))
+		binary = format.ByteOrder.AppendUint32(binary, uint32(i%7))
+		binary = format.ByteOrder.AppendUint32(binary, random.Uint32())
+	}
+	binaryPath := filepath.Join(b.TempDir(), "records.bin")
+	if err := os.WriteFile(binaryPath, binary, 0644); err != nil {
+		b.Fatalf("failed to write the binary input: %v", err)
+	}
+
+	b.Run("text", func(b *testing.B) {
+		benchmarkAlgorithms(b, []string{"test_files/input/example.txt"}, []utils.Algorithm{utils.HUFFMAN, utils.LZ4})
+	})
+	b.Run("binary", func(b *testing.B) {
+		benchmarkAlgorithms(b, []string{binaryPath}, []utils.Algorithm{utils.HUFFMAN, utils.LZ4})
+	})
+}
+
+// benchmarkAlgorithms compresses fileNameStrs with every algorithm and opts in a sub-benchmark
+// and reports the size of the archive relative to the input.
+func benchmarkAlgorithms(b *testing.B, fileNameStrs []string, algorithms []utils.Algorithm, opts ...utils.Option) {
+	for _, algorithm := range algorithms {
+		b.Run(string(algorithm), func(b *testing.B) {
+			// both codecs seek back to fill in the entry sizes, so the archive is a real file
+			output, err := os.Create(filepath.Join(b.TempDir(), "bench.sq"))
+			if err != nil {
+				b.Fatalf("failed to create the output: %v", err)
+			}
+			defer output.Close()
+
+			var originalSize uint64
+			var compressedSize int64
+			for i := 0; i < b.N; i++ {
+				if err := output.Truncate(0); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := output.Seek(0, io.SeekStart); err != nil {
+					b.Fatal(err)
+				}
+				originalSize, err = ReadAndCompressFiles(fileNameStrs, output, string(algorithm), opts...)
+				if err != nil {
+					b.Fatalf("failed to compress with %s: %v", algorithm, err)
+				}
+				compressedSize, err = output.Seek(0, io.SeekCurrent)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.SetBytes(int64(originalSize))
+			b.ReportMetric(float64(compressedSize)/float64(originalSize), "ratio")
+		})
+	}
+}
+
+func TestDecompressBzip2(t *testing.T) {
+	outputDir := t.TempDir()
+	paths, _, err := Decompress(context.Background(), "test_files/bzip2/notes.txt.bz2", outputDir)
+	if err != nil {
+		t.Fatalf("failed to decompress the bzip2 file: %v", err)
+	}
+	if len(paths) != 1 || filepath.Base(paths[0]) != "notes.txt" {
+		t.Fatalf("expected notes.txt, got %v", paths)
+	}
+
+	decompressed, err := os.ReadFile(paths[0])
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", paths[0], err)
+	}
+	expected := strings.Repeat("SquirrelZip reads bzip2 files made by other tools.\n", 3)
+	if string(decompressed) != expected {
+		t.Fatalf("expected %q, got %q", expected, decompressed)
+	}
+}
+
+func TestTarGz(t *testing.T) {
+	inputDir := t.TempDir()
+	modTime := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	contents := map[string]string{"a.txt": strings.Repeat("tar ", 500), "sub/b.txt": "b"}
+	for name, content := range contents {
+		path := filepath.Join(inputDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	archivePath, _, err := Compress(context.Background(), []string{inputDir}, t.TempDir(), string(utils.HUFFMAN), utils.WithArchiveFormat(utils.TARGZ))
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	if !strings.HasSuffix(archivePath, constants.TARGZ_FILE_EXT) {
+		t.Fatalf("expected a %s file, got %s", constants.TARGZ_FILE_EXT, archivePath)
+	}
+
+	entries, err := List(archivePath)
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Algorithm != string(utils.TARGZ) {
+		t.Fatalf("expected 2 targz entries, got %+v", entries)
+	}
+	if report, err := Verify(archivePath); err != nil || report.Status != utils.VERIFY_OK {
+		t.Fatalf("expected the archive to verify, got %+v, %v", report, err)
+	}
+
+	outputDir := t.TempDir()
+	paths, _, err := Decompress(context.Background(), archivePath, outputDir)
+	if err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+	if len(paths) != 2 {
+		t.Fatalf("expected 2 files, got %v", paths)
+	}
+	root := filepath.Base(inputDir)
+	for name, content := range contents {
+		path := filepath.Join(outputDir, root, filepath.FromSlash(name))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if string(data) != content {
+			t.Fatalf("%s does not match the input", name)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(modTime) || (runtime.GOOS != "windows" && info.Mode().Perm() != 0640) {
+			t.Fatalf("expected %s with mode 0640 modified at %v, got %v and %v", name, modTime, info.Mode().Perm(), info.ModTime())
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	for _, algorithm := range []utils.Algorithm{utils.HUFFMAN, utils.ARITHMETIC, utils.LZ77, utils.DEFLATE, utils.RLE, utils.BWT, utils.LZ4, utils.LZ, utils.STORE, utils.AUTO} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			inputDir := t.TempDir()
+			contents := map[string]string{"a.txt": "first file", "b.txt": strings.Repeat("second file ", 20)}
+			modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+			fileNames := []string{}
+			for name, content := range contents {
+				path := filepath.Join(inputDir, name)
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatalf("failed to write %s: %v", name, err)
+				}
+				if err := os.Chtimes(path, modTime, modTime); err != nil {
+					t.Fatalf("failed to set the time of %s: %v", name, err)
+				}
+				fileNames = append(fileNames, path)
+			}
+
+			compressedPath, _, err := Compress(context.Background(), fileNames, t.TempDir(), string(algorithm))
+			if err != nil {
+				t.Fatalf("failed to compress files: %v", err)
+			}
+
+			entries, err := List(compressedPath)
+			if err != nil {
+				t.Fatalf("failed to list the archive: %v", err)
+			}
+			if len(entries) != len(contents) {
+				t.Fatalf("expected %d entries, got %d", len(contents), len(entries))
+			}
+
+			for _, entry := range entries {
+				content, ok := contents[filepath.Base(entry.Name)]
+				if !ok {
+					t.Fatalf("unexpected entry %s", entry.Name)
+				}
+				if entry.OriginalSize != uint64(len(content)) {
+					t.Fatalf("%s: expected size %d, got %d", entry.Name, len(content), entry.OriginalSize)
+				}
+				if entry.CompressedSize == 0 {
+					t.Fatalf("%s: expected a compressed size", entry.Name)
+				}
+				if !entry.ModTime.Equal(modTime) {
+					t.Fatalf("%s: expected modification time %v, got %v", entry.Name, modTime, entry.ModTime)
+				}
+			}
+		})
+	}
+}
+
+func TestDecompressFiles(t *testing.T) {
+	for _, algorithm := range []utils.Algorithm{utils.HUFFMAN, utils.ARITHMETIC, utils.LZ77, utils.DEFLATE, utils.RLE, utils.BWT, utils.LZ4} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			inputDir := t.TempDir()
+			fileNames := []string{}
+			for _, name := range []string{"a.txt", "b.txt", "c.md"} {
+				path := filepath.Join(inputDir, name)
+				if err := os.WriteFile(path, []byte("content of "+name), 0644); err != nil {
+					t.Fatalf("failed to write %s: %v", name, err)
+				}
+				fileNames = append(fileNames, path)
+			}
+
+			compressedPath, _, err := Compress(context.Background(), fileNames, t.TempDir(), string(algorithm))
+			if err != nil {
+				t.Fatalf("failed to compress files: %v", err)
+			}
+
+			tests := []struct {
+				names    []string
+				expected []string
+			}{
+				{[]string{"b.txt"}, []string{"b.txt"}},
+				{[]string{"*.md"}, []string{"c.md"}},
+				{[]string{"a.txt", "c.*"}, []string{"a.txt", "c.md"}},
+			}
+
+			for _, test := range tests {
+				outputDir := t.TempDir()
+				paths, err := DecompressFiles(context.Background(), compressedPath, outputDir, test.names)
+				if err != nil {
+					t.Fatalf("%v: failed to decompress files: %v", test.names, err)
+				}
+				if len(paths) != len(test.expected) {
+					t.Fatalf("%v: expected %d files, got %v", test.names, len(test.expected), paths)
+				}
+
+				// the skipped entries must not leave any file behind
+				created := []string{}
+				err = filepath.WalkDir(outputDir, func(path string, entry os.DirEntry, err error) error {
+					if err == nil && !entry.IsDir() {
+						created = append(created, entry.Name())
+					}
+					return err
+				})
+				if err != nil {
+					t.Fatalf("failed to walk the output: %v", err)
+				}
+				sort.Strings(created)
+				if !reflect.DeepEqual(created, test.expected) {
+					t.Fatalf("%v: expected %v to be created, got %v", test.names, test.expected, created)
+				}
+			}
+
+			_, err = DecompressFiles(context.Background(), compressedPath, t.TempDir(), []string{"b.txt", "missing.txt", "*.go"})
+			if err == nil || !strings.Contains(err.Error(), "missing.txt, *.go") {
+				t.Fatalf("expected an error naming the missing entries, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecompressStreamEntries(t *testing.T) {
+	for _, algorithm := range []utils.Algorithm{utils.HUFFMAN, utils.ARITHMETIC, utils.LZ77, utils.DEFLATE, utils.RLE, utils.BWT, utils.LZ4, utils.LZ, utils.STORE, utils.AUTO} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			inputDir := t.TempDir()
+			fileNames := []string{}
+			for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+				path := filepath.Join(inputDir, name)
+				if err := os.WriteFile(path, []byte(strings.Repeat("content of "+name, 100)), 0644); err != nil {
+					t.Fatalf("failed to write %s: %v", name, err)
+				}
+				fileNames = append(fileNames, path)
+			}
+			compressedPath, _, err := Compress(context.Background(), fileNames, t.TempDir(), string(algorithm))
+			if err != nil {
+				t.Fatalf("failed to compress files: %v", err)
+			}
+			data, err := os.ReadFile(compressedPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a cancelable context wraps the input in a reader that offers Seek, the skipped
+			// entries must still be read past when the input below it cannot seek
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			outputDir := t.TempDir()
+			input := struct{ io.Reader }{bytes.NewReader(data)}
+			paths, err := DecompressStream(ctx, input, outputDir, nil, utils.WithEntries([]string{"b.txt"}))
+			if err != nil {
+				t.Fatalf("failed to decompress b.txt: %v", err)
+			}
+			if len(paths) != 1 {
+				t.Fatalf("expected only b.txt, got %v", paths)
+			}
+			extracted, err := os.ReadFile(filepath.Join(outputDir, "b.txt"))
+			if err != nil || string(extracted) != strings.Repeat("content of b.txt", 100) {
+				t.Fatalf("expected b.txt to match the original: %v", err)
+			}
+		})
+	}
+}
+
+func TestRelativeEntryNames(t *testing.T) {
+	inputDir := filepath.Join(t.TempDir(), "data")
+	if err := os.MkdirAll(filepath.Join(inputDir, "sub"), 0755); err != nil {
+		t.Fatalf("failed to create the input: %v", err)
+	}
+	contents := map[string]string{"a.txt": "first", "sub/b.txt": "second"}
+	for name, content := range contents {
+		if err := os.WriteFile(filepath.Join(inputDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	single := filepath.Join(t.TempDir(), "single.txt")
+	if err := os.WriteFile(single, []byte("single"), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", single, err)
+	}
+
+	tests := map[string]struct {
+		keepPaths bool
+		expected  []string
+	}{
+		"relative":   {false, []string{"data/a.txt", "data/sub/b.txt", "single.txt"}},
+		"keep paths": {true, []string{filepath.Join(inputDir, "a.txt"), filepath.Join(inputDir, "sub", "b.txt"), single}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			archive, err := os.Create(filepath.Join(t.TempDir(), "archive.sq"))
+			if err != nil {
+				t.Fatalf("failed to create the archive: %v", err)
+			}
+			defer archive.Close()
+
+			if _, err := ReadAndCompressFiles([]string{inputDir, single}, archive, string(utils.DEFLATE), utils.WithKeepPaths(test.keepPaths)); err != nil {
+				t.Fatalf("failed to compress: %v", err)
+			}
+
+			entries, err := List(archive.Name())
+			if err != nil {
+				t.Fatalf("failed to list: %v", err)
+			}
+			names := []string{}
+			for _, entry := range entries {
+				names = append(names, entry.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(test.expected, ",") {
+				t.Fatalf("expected %v, got %v", test.expected, names)
+			}
+		})
+	}
+
+	// /tmp/.../data/a.txt is stored as data/a.txt and extracted below the output directory
+	archive, err := os.Create(filepath.Join(t.TempDir(), "archive.sq"))
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	if _, err := ReadAndCompressFiles([]string{inputDir}, archive, string(utils.DEFLATE)); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	archive.Close()
+
+	outputDir := t.TempDir()
+	if _, _, err := Decompress(context.Background(), archive.Name(), outputDir); err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+	for name, content := range contents {
+		extracted, err := os.ReadFile(filepath.Join(outputDir, "data", name))
+		if err != nil {
+			t.Fatalf("failed to read the extracted %s: %v", name, err)
+		}
+		if string(extracted) != content {
+			t.Fatalf("%s does not match the original", name)
+		}
+	}
+}
+
+func TestExcludePatterns(t *testing.T) {
+	inputDir := filepath.Join(t.TempDir(), "project")
+	for _, dir := range []string{"cmd", ".git"} {
+		if err := os.MkdirAll(filepath.Join(inputDir, dir), 0755); err != nil {
+			t.Fatalf("failed to create the input: %v", err)
+		}
+	}
+	for _, name := range []string{"main.go", "notes.txt", "cmd/run.go", "cmd/todo.txt", ".git/HEAD"} {
+		if err := os.WriteFile(filepath.Join(inputDir, name), []byte("content of "+name), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	single := filepath.Join(t.TempDir(), "single.txt")
+	if err := os.WriteFile(single, []byte("single"), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", single, err)
+	}
+
+	archive, err := os.Create(filepath.Join(t.TempDir(), "archive.sq"))
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	defer archive.Close()
+
+	originalSize, err := ReadAndCompressFiles([]string{inputDir, single}, archive, string(utils.HUFFMAN), utils.WithExclude([]string{"*.txt", ".git"}))
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+
+	entries, err := List(archive.Name())
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	expected := []string{"project/cmd/run.go", "project/main.go"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+	if expectedSize := uint64(len("content of cmd/run.go") + len("content of main.go")); originalSize != expectedSize {
+		t.Fatalf("expected an original size of %d, got %d", expectedSize, originalSize)
+	}
+
+	// .git/** is matched against the paths relative to the directory, the entry names start with project
+	for _, name := range []string{"debug.log", "Trace.LOG", ".git/objects/ab", "cmd/.git/keep"} {
+		path := filepath.Join(inputDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("content of "+name), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	excludedFiles, excludedDirs := []string{}, []string{}
+	archive.Truncate(0)
+	archive.Seek(0, io.SeekStart)
+	_, err = ReadAndCompressFiles([]string{inputDir}, archive, string(utils.HUFFMAN), utils.WithExclude([]string{"*.log", ".git/**", "*.txt"}), utils.WithExcluded(func(name string, dir bool) {
+		if dir {
+			excludedDirs = append(excludedDirs, name)
+		} else {
+			excludedFiles = append(excludedFiles, name)
+		}
+	}))
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	entries, err = List(archive.Name())
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	names = []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	// patterns are case sensitive, Trace.LOG is kept
+	expected = []string{"project/Trace.LOG", "project/cmd/.git/keep", "project/cmd/run.go", "project/main.go"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+	if strings.Join(excludedDirs, ",") != "project/.git" || len(excludedFiles) != 3 {
+		t.Fatalf("expected project/.git and 3 files to be excluded, got %v and %v", excludedDirs, excludedFiles)
+	}
+
+	if _, err := ReadAndCompressFiles([]string{single}, archive, string(utils.HUFFMAN), utils.WithExclude([]string{"*"})); err == nil {
+		t.Fatal("expected an error when every file is excluded")
+	}
+	if _, err := ReadAndCompressFiles([]string{inputDir}, archive, string(utils.HUFFMAN), utils.WithExclude([]string{"["})); !errors.Is(err, path.ErrBadPattern) {
+		t.Fatalf("expected %v, got %v", path.ErrBadPattern, err)
+	}
+}
+
+func TestReadAndCompressFilesStreams(t *testing.T) {
+	testFiles, err := os.ReadDir("test_files/input")
+	if err != nil {
+		t.Fatalf("failed to read test files directory: %v", err)
+	}
+	fileNames := []string{}
+	for _, file := range testFiles {
+		fileNames = append(fileNames, filepath.Join("test_files/input", file.Name()))
+	}
+
+	// a bytes.Buffer cannot seek, so the archive is written as a stream
+	var archive bytes.Buffer
+	if _, err := ReadAndCompressFiles(fileNames, &archive, string(utils.HUFFMAN)); err != nil {
+		t.Fatalf("failed to compress files: %v", err)
+	}
+
+	input := bufio.NewReader(bytes.NewReader(archive.Bytes()))
+	header, err := readHeader(input)
+	if err != nil {
+		t.Fatalf("failed to read the header: %v", err)
+	}
+	if utils.Algorithm(header.Algorithm) != utils.HUFFMAN_STREAM {
+		t.Fatalf("expected %s, got %s", utils.HUFFMAN_STREAM, header.Algorithm)
+	}
+
+	outputDir := t.TempDir()
+	paths, err := WriteAndDecompressFiles(input, outputDir, []byte(header.Algorithm))
+	if err != nil {
+		t.Fatalf("failed to decompress files: %v", err)
+	}
+	if len(paths) != len(fileNames) {
+		t.Fatalf("expected %d files, got %d", len(fileNames), len(paths))
+	}
+
+	for _, fileName := range fileNames {
+		original, err := os.ReadFile(fileName)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", fileName, err)
+		}
+		// single files are stored under their base names
+		decompressed, err := os.ReadFile(filepath.Join(outputDir, filepath.Base(fileName)))
+		if err != nil {
+			t.Fatalf("failed to read the extracted %s: %v", fileName, err)
+		}
+		if !bytes.Equal(original, decompressed) {
+			t.Fatalf("%s does not match the original", fileName)
+		}
+	}
+}
+
+func TestDecompressCorruptHeader(t *testing.T) {
+	compressedPath := Init("huffman", t)
+	defer os.RemoveAll("test_files/compress_output")
+
+	data, err := os.ReadFile(compressedPath)
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		corrupt  func([]byte) []byte
+		expected string
+	}{
+		{"bad magic", func(archive []byte) []byte { archive[0] = 'X'; return archive }, "not a SquirrelZip archive"},
+		{"future version", func(archive []byte) []byte { archive[len(format.MAGIC)] = byte(format.CURRENT_VERSION + 1); return archive }, fmt.Sprintf("unsupported archive version %d", format.CURRENT_VERSION+1)},
+		{"plain text", func([]byte) []byte { return []byte("hello world") }, "input is not compressed"},
+	}
+
+	for _, test := range tests {
+		corruptPath := filepath.Join(t.TempDir(), "corrupt.sq")
+		corrupted := test.corrupt(append([]byte(nil), data...))
+		if err := os.WriteFile(corruptPath, corrupted, 0644); err != nil {
+			t.Fatalf("failed to write corrupt archive: %v", err)
+		}
+
+		_, _, err := Decompress(context.Background(), corruptPath, t.TempDir())
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Fatalf("%s: expected an error containing %q, got %v", test.name, test.expected, err)
+		}
+
+		var notAnArchive *format.ErrNotAnArchive
+		if isArchive := !errors.As(err, &notAnArchive); isArchive != (test.name == "future version") {
+			t.Fatalf("%s: unexpected error type %T", test.name, err)
+		}
+	}
+}
+
+func TestModTimeRoundTrip(t *testing.T) {
+	for _, algorithm := range []utils.Algorithm{utils.HUFFMAN, utils.ARITHMETIC, utils.LZ77, utils.DEFLATE, utils.RLE, utils.BWT, utils.LZ4} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			inputDir := t.TempDir()
+			modTimes := map[string]time.Time{
+				"old.txt":    time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC),
+				"recent.txt": time.Now().Add(-time.Hour),
+			}
+
+			fileNames := []string{}
+			for name, modTime := range modTimes {
+				path := filepath.Join(inputDir, name)
+				if err := os.WriteFile(path, []byte("content of "+name), 0644); err != nil {
+					t.Fatalf("failed to write %s: %v", name, err)
+				}
+				if err := os.Chtimes(path, modTime, modTime); err != nil {
+					t.Fatalf("failed to set the time of %s: %v", name, err)
+				}
+				fileNames = append(fileNames, path)
+			}
+
+			compressedPath, _, err := Compress(context.Background(), fileNames, t.TempDir(), string(algorithm))
+			if err != nil {
+				t.Fatalf("failed to compress files: %v", err)
+			}
+
+			paths, _, err := Decompress(context.Background(), compressedPath, t.TempDir())
+			if err != nil {
+				t.Fatalf("failed to decompress files: %v", err)
+			}
+			if len(paths) != len(modTimes) {
+				t.Fatalf("expected %d files, got %d", len(modTimes), len(paths))
+			}
+
+			for _, path := range paths {
+				info, err := os.Stat(path)
+				if err != nil {
+					t.Fatalf("failed to stat %s: %v", path, err)
+				}
+				original, err := os.Stat(filepath.Join(inputDir, filepath.Base(path)))
+				if err != nil {
+					t.Fatalf("failed to stat the original of %s: %v", path, err)
+				}
+				if diff := info.ModTime().Sub(original.ModTime()); diff > time.Second || diff < -time.Second {
+					t.Fatalf("%s: expected modification time %v, got %v", path, original.ModTime(), info.ModTime())
+				}
+			}
+		})
+	}
+}
+
+func TestModeRoundTrip(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permission bits are not preserved on windows")
+	}
+
+	inputDir := t.TempDir()
+	modes := map[string]os.FileMode{"script.sh": 0755, "private.txt": 0600, "shared.txt": 0644}
+
+	fileNames := []string{}
+	for name, mode := range modes {
+		path := filepath.Join(inputDir, name)
+		if err := os.WriteFile(path, []byte("content of "+name), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatalf("failed to set the mode of %s: %v", name, err)
+		}
+		fileNames = append(fileNames, path)
+	}
+
+	compressedPath, _, err := Compress(context.Background(), fileNames, t.TempDir(), "huffman")
+	if err != nil {
+		t.Fatalf("failed to compress files: %v", err)
+	}
+
+	paths, _, err := Decompress(context.Background(), compressedPath, t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to decompress files: %v", err)
+	}
+	if len(paths) != len(modes) {
+		t.Fatalf("expected %d files, got %d", len(modes), len(paths))
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("failed to stat %s: %v", path, err)
+		}
+		if expected := modes[filepath.Base(path)]; info.Mode().Perm() != expected {
+			t.Fatalf("%s: expected mode %v, got %v", path, expected, info.Mode().Perm())
+		}
+	}
+}
+
+// TestMmapRoundTrip maps every file, the empty one is read as it is.
+func TestMmapRoundTrip(t *testing.T) {
+	inputDir := filepath.Join(t.TempDir(), "input")
+	contents := map[string]string{"a.txt": strings.Repeat("mapped squirrels ", 500), "sub/b.bin": "\x00\x01\x02", "empty.txt": ""}
+	for name, content := range contents {
+		path := filepath.Join(inputDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	for _, algorithm := range []utils.Algorithm{utils.HUFFMAN, utils.DEFLATE} {
+		compressedPath, _, err := Compress(context.Background(), []string{inputDir}, t.TempDir(), string(algorithm), utils.WithMmapThreshold(1))
+		if err != nil {
+			t.Fatalf("%s: failed to compress: %v", algorithm, err)
+		}
+		outputDir := t.TempDir()
+		if _, _, err := Decompress(context.Background(), compressedPath, outputDir); err != nil {
+			t.Fatalf("%s: failed to decompress: %v", algorithm, err)
+		}
+		for name, content := range contents {
+			data, err := os.ReadFile(filepath.Join(outputDir, "input", filepath.FromSlash(name)))
+			if err != nil || string(data) != content {
+				t.Fatalf("%s: %s does not match the input: %v", algorithm, name, err)
+			}
+		}
+	}
+}
+
+func TestCompressProgress(t *testing.T) {
+	for _, algorithm := range []utils.Algorithm{utils.HUFFMAN, utils.ARITHMETIC, utils.LZ77, utils.DEFLATE, utils.RLE, utils.BWT, utils.LZ4, utils.LZ, utils.STORE, utils.AUTO} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			inputDir := t.TempDir()
+			contents := map[string]string{"a.txt": "first file", "b.txt": strings.Repeat("second file ", 20), "c.txt": ""}
+
+			fileNames := []string{}
+			total := int64(0)
+			for name, content := range contents {
+				path := filepath.Join(inputDir, name)
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatalf("failed to write %s: %v", name, err)
+				}
+				fileNames = append(fileNames, path)
+				total += int64(len(content))
+			}
+
+			// checkCalls verifies one call per file and that the processed bytes add up to the total
+			checkCalls := func(calls map[string]int, processed, reportedTotal int64) {
+				t.Helper()
+				if len(calls) != len(contents) {
+					t.Fatalf("expected a call for each of the %d files, got %v", len(contents), calls)
+				}
+				for name, count := range calls {
+					if count != 1 {
+						t.Fatalf("%s: expected 1 call, got %d", name, count)
+					}
+				}
+				if processed != total || reportedTotal != total {
+					t.Fatalf("expected %d bytes in total, processed %d, reported total %d", total, processed, reportedTotal)
+				}
+			}
+
+			calls := map[string]int{}
+			processed, reportedTotal := int64(0), int64(0)
+			progress := utils.WithProgress(func(filename string, bytesProcessed, totalBytes int64) {
+				calls[filepath.Base(filename)]++
+				processed += bytesProcessed
+				reportedTotal = totalBytes
+			})
+
+			compressedPath, _, err := Compress(context.Background(), fileNames, t.TempDir(), string(algorithm), progress)
+			if err != nil {
+				t.Fatalf("failed to compress files: %v", err)
+			}
+			checkCalls(calls, processed, reportedTotal)
+
+			calls = map[string]int{}
+			processed, reportedTotal = 0, 0
+			if _, _, err := Decompress(context.Background(), compressedPath, t.TempDir(), progress); err != nil {
+				t.Fatalf("failed to decompress files: %v", err)
+			}
+			checkCalls(calls, processed, reportedTotal)
+		})
+	}
+}
+
+func TestProgressEvents(t *testing.T) {
+	for _, algorithm := range []utils.Algorithm{utils.HUFFMAN, utils.ARITHMETIC, utils.LZ77, utils.DEFLATE, utils.RLE, utils.BWT, utils.LZ4, utils.LZ, utils.STORE, utils.AUTO} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			inputDir := t.TempDir()
+			contents := map[string]string{"a.txt": "first file", "b.txt": strings.Repeat("second file ", 2000), "c.txt": ""}
+
+			fileNames := []string{}
+			total := int64(0)
+			for name, content := range contents {
+				path := filepath.Join(inputDir, name)
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatalf("failed to write %s: %v", name, err)
+				}
+				fileNames = append(fileNames, path)
+				total += int64(len(content))
+			}
+
+			// checkEvents verifies growing byte counts, a final event per file and the total
+			checkEvents := func(events []utils.ProgressEvent, phase utils.ProgressPhase) {
+				t.Helper()
+				done := map[string]int{}
+				last := int64(0)
+				for _, event := range events {
+					if event.Phase != phase || event.TotalBytes != total {
+						t.Fatalf("expected %s events with a total of %d, got %+v", phase, total, event)
+					}
+					if event.BytesProcessed < last {
+						t.Fatalf("byte count went back from %d to %d", last, event.BytesProcessed)
+					}
+					last = event.BytesProcessed
+					if event.Done {
+						done[filepath.Base(event.Filename)]++
+					}
+				}
+				for name := range contents {
+					if done[name] != 1 {
+						t.Fatalf("%s: expected 1 final event, got %d", name, done[name])
+					}
+				}
+				if last != total {
+					t.Fatalf("expected %d bytes to be processed, got %d", total, last)
+				}
+				// the large file is reported while it is processed, not only once it is done
+				if len(events) <= len(contents) {
+					t.Fatalf("expected events within the files, got %d events", len(events))
+				}
+			}
+
+			events := []utils.ProgressEvent{}
+			progress := utils.WithProgressEvents(func(event utils.ProgressEvent) {
+				events = append(events, event)
+			}, 1000)
+
+			compressedPath, _, err := Compress(context.Background(), fileNames, t.TempDir(), string(algorithm), progress)
+			if err != nil {
+				t.Fatalf("failed to compress files: %v", err)
+			}
+			checkEvents(events, utils.PHASE_COMPRESS)
+
+			events = []utils.ProgressEvent{}
+			if _, _, err := Decompress(context.Background(), compressedPath, t.TempDir(), progress); err != nil {
+				t.Fatalf("failed to decompress files: %v", err)
+			}
+			checkEvents(events, utils.PHASE_EXTRACT)
+		})
+	}
+}
+
+func TestCompressCanceled(t *testing.T) {
+	for _, algorithm := range []utils.Algorithm{utils.HUFFMAN, utils.ARITHMETIC, utils.LZ77, utils.DEFLATE, utils.RLE, utils.BWT, utils.LZ4} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			inputDir := t.TempDir()
+			small := filepath.Join(inputDir, "small.txt")
+			large := filepath.Join(inputDir, "large.txt")
+			if err := os.WriteFile(small, []byte("compressed before the cancel"), 0644); err != nil {
+				t.Fatalf("failed to write the small file: %v", err)
+			}
+			if err := os.WriteFile(large, bytes.Repeat([]byte("large file content "), 1<<16), 0644); err != nil {
+				t.Fatalf("failed to write the large file: %v", err)
+			}
+
+			// cancel once the first file is done, while the large one is still to be read
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			progress := utils.WithProgress(func(string, int64, int64) { cancel() })
+
+			outputDir := t.TempDir()
+			_, _, err := Compress(ctx, []string{small, large}, outputDir, string(algorithm), progress)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected context.Canceled, got %v", err)
+			}
+
+			leftovers, err := os.ReadDir(outputDir)
+			if err != nil {
+				t.Fatalf("failed to read the output directory: %v", err)
+			}
+			if len(leftovers) != 0 {
+				t.Fatalf("expected no partial output, found %v", leftovers)
+			}
+		})
+	}
+}
+
+func TestDecompressCanceled(t *testing.T) {
+	inputPath := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(inputPath, []byte("some content to extract"), 0644); err != nil {
+		t.Fatalf("failed to write the input: %v", err)
+	}
+
+	compressedPath, _, err := Compress(context.Background(), []string{inputPath}, t.TempDir(), string(utils.HUFFMAN))
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := Decompress(ctx, compressedPath, t.TempDir()); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestDecompressCanceledMidEntry(t *testing.T) {
+	inputPath := filepath.Join(t.TempDir(), "input.bin")
+	content := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(content)
+	if err := os.WriteFile(inputPath, content, 0644); err != nil {
+		t.Fatalf("failed to write the input: %v", err)
+	}
+
+	compressedPath, _, err := Compress(context.Background(), []string{inputPath}, t.TempDir(), string(utils.DEFLATE))
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+
+	// writing the entry takes about a second, it is canceled while it is half done
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	outputDir := t.TempDir()
+	removed := []string{}
+	_, _, err = Decompress(ctx, compressedPath, outputDir,
+		utils.WithRateLimits(nil, utils.NewRateLimiter(1<<20)),
+		utils.WithWarnings(func(message string) { removed = append(removed, message) }))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	err = filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			t.Errorf("expected the partial file to be removed, found %s", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("failed to walk the output directory: %v", err)
+	}
+	if len(removed) != 1 || !strings.Contains(removed[0], "removed the partially extracted") {
+		t.Fatalf("expected the removal to be reported, got %v", removed)
+	}
+}
+
+func TestListArchive(t *testing.T) {
+	inputDir := t.TempDir()
+	contents := map[string]string{"a.txt": "first file", "b.txt": "second file"}
+
+	fileNames := []string{}
+	for name, content := range contents {
+		path := filepath.Join(inputDir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		fileNames = append(fileNames, path)
+	}
+
+	compressedPath, _, err := Compress(context.Background(), fileNames, t.TempDir(), string(utils.ARITHMETIC))
+	if err != nil {
+		t.Fatalf("failed to compress files: %v", err)
+	}
+
+	// encrypt the archive the same way the CLI does
+	compressed, err := os.Open(compressedPath)
+	if err != nil {
+		t.Fatalf("failed to open the archive: %v", err)
+	}
+	defer compressed.Close()
+
+	archivePath := filepath.Join(t.TempDir(), "archive.sq")
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	if err := encryption.EncryptStream(context.Background(), compressed, archive, "password123"); err != nil {
+		t.Fatalf("failed to encrypt the archive: %v", err)
+	}
+	archive.Close()
+
+	entries, err := ListArchive(archivePath, "password123")
+	if err != nil {
+		t.Fatalf("failed to list the archive: %v", err)
+	}
+	if len(entries) != len(contents) {
+		t.Fatalf("expected %d entries, got %d", len(contents), len(entries))
+	}
+
+	for _, entry := range entries {
+		content, ok := contents[filepath.Base(entry.Name)]
+		if !ok {
+			t.Fatalf("unexpected entry %s", entry.Name)
+		}
+		if entry.Algorithm != string(utils.ARITHMETIC) {
+			t.Fatalf("%s: expected algorithm %s, got %s", entry.Name, utils.ARITHMETIC, entry.Algorithm)
+		}
+		if expected := utils.FormatChecksum(crc32.ChecksumIEEE([]byte(content))); entry.Checksum != expected {
+			t.Fatalf("%s: expected checksum %s, got %s", entry.Name, expected, entry.Checksum)
+		}
+	}
+
+	if _, err := ListArchive(archivePath, "wrong password"); err == nil {
+		t.Fatal("listing with a wrong password should fail")
+	}
+}
+
+func TestNoPreserveAttrs(t *testing.T) {
+	inputPath := filepath.Join(t.TempDir(), "old.txt")
+	if err := os.WriteFile(inputPath, []byte("old content"), 0600); err != nil {
+		t.Fatalf("failed to write the input: %v", err)
+	}
+	modTime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	if err := os.Chtimes(inputPath, modTime, modTime); err != nil {
+		t.Fatalf("failed to set the time of the input: %v", err)
+	}
+
+	compressedPath, _, err := Compress(context.Background(), []string{inputPath}, t.TempDir(), string(utils.HUFFMAN))
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+
+	start := time.Now().Add(-time.Second)
+	paths, _, err := Decompress(context.Background(), compressedPath, t.TempDir(), utils.WithNoPreserveAttrs(true))
+	if err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+
+	info, err := os.Stat(paths[0])
+	if err != nil {
+		t.Fatalf("failed to stat %s: %v", paths[0], err)
+	}
+	if info.ModTime().Before(start) {
+		t.Fatalf("expected the time of extraction, got %v", info.ModTime())
+	}
+}
+
+func TestDecompressVersion1(t *testing.T) {
+	// written without a password by the CLI of the first releases, the metadata byte of the
+	// encryption comes before the header without magic bytes and a version field
+	legacyPath := "test_files/legacy/v1.sq"
+
+	outputDir := t.TempDir()
+	paths, _, err := Decompress(context.Background(), legacyPath, outputDir)
+	if err != nil {
+		t.Fatalf("failed to decompress a version 1 archive: %v", err)
+	}
+
+	contents := map[string]string{"legacyin/a.txt": "first legacy file\n", "legacyin/dir/b.txt": legacyNested()}
+	if len(paths) != len(contents) {
+		t.Fatalf("expected %d files, got %v", len(contents), paths)
+	}
+	for name, content := range contents {
+		data, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if string(data) != content {
+			t.Fatalf("%s: expected %q, got %q", name, content, data)
+		}
+	}
+
+	// listing needs the sizes that version 1 did not store
+	if _, err := List(legacyPath); !errors.Is(err, ErrVersion1) {
+		t.Fatalf("expected ErrVersion1, got %v", err)
+	}
+}
+
+// legacyNested returns the content of legacyin/dir/b.txt in the archives of the first releases.
+func legacyNested() string {
+	nested := strings.Builder{}
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&nested, "line %d of a nested file from version 1\n", i)
+	}
+	return nested.String()
+}
+
+func TestVerifyArchive(t *testing.T) {
+	inputDir := t.TempDir()
+	words := strings.Fields("the quick brown fox jumps over a lazy dog while squirrels bury acorns")
+	random := rand.New(rand.NewSource(7))
+	large := strings.Builder{}
+	for large.Len() < 100_000 {
+		large.WriteString(words[random.Intn(len(words))])
+		large.WriteByte(' ')
+	}
+	contents := map[string]string{"a.txt": "first file", "b.txt": large.String(), "c.txt": "third file"}
+
+	fileNames := []string{}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		path := filepath.Join(inputDir, name)
+		if err := os.WriteFile(path, []byte(contents[name]), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		fileNames = append(fileNames, path)
+	}
+
+	for _, algorithm := range []utils.Algorithm{utils.HUFFMAN, utils.BWT, utils.ARITHMETIC, utils.LZ77, utils.DEFLATE, utils.RLE, utils.LZ4, utils.LZ, utils.STORE, utils.AUTO} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			compressedPath, _, err := Compress(context.Background(), fileNames, t.TempDir(), string(algorithm))
+			if err != nil {
+				t.Fatalf("failed to compress files: %v", err)
+			}
+			compressed, err := os.Open(compressedPath)
+			if err != nil {
+				t.Fatalf("failed to open the archive: %v", err)
+			}
+			defer compressed.Close()
+
+			// without a password the archive stores the compressed data as it is
+			archivePath := filepath.Join(t.TempDir(), "archive.sq")
+			archive, err := os.Create(archivePath)
+			if err != nil {
+				t.Fatalf("failed to create the archive: %v", err)
+			}
+			if err := encryption.EncryptStream(context.Background(), compressed, archive, ""); err != nil {
+				t.Fatalf("failed to write the archive: %v", err)
+			}
+			archive.Close()
+
+			if err := VerifyArchive(archivePath, ""); err != nil {
+				t.Fatalf("expected the archive to be intact, got %v", err)
+			}
+
+			// b.txt makes up nearly all of the archive, its data holds the middle byte
+			data, err := os.ReadFile(archivePath)
+			if err != nil {
+				t.Fatalf("failed to read the archive: %v", err)
+			}
+			data[len(data)/2] ^= 0xff
+			if err := os.WriteFile(archivePath, data, 0644); err != nil {
+				t.Fatalf("failed to write the archive: %v", err)
+			}
+
+			err = VerifyArchive(archivePath, "")
+			var failures VerificationErrors
+			if !errors.As(err, &failures) {
+				t.Fatalf("expected VerificationErrors, got %v", err)
+			}
+			if len(failures) != 1 || filepath.Base(failures[0].Name) != "b.txt" {
+				t.Fatalf("expected a single error naming b.txt, got %v", failures)
+			}
+			if !strings.Contains(err.Error(), "b.txt") {
+				t.Fatalf("expected the error to name b.txt, got %q", err)
+			}
+		})
+	}
+}
+
+func TestExtractFile(t *testing.T) {
+	inputDir := t.TempDir()
+	fileNames := []string{}
+	for _, name := range []string{"first.txt", "second.txt", "third.txt"} {
+		path := filepath.Join(inputDir, name)
+		if err := os.WriteFile(path, []byte("content of "+name), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		fileNames = append(fileNames, path)
+	}
+
+	compressedPath, _, err := Compress(context.Background(), fileNames, t.TempDir(), string(utils.HUFFMAN))
+	if err != nil {
+		t.Fatalf("failed to compress files: %v", err)
+	}
+	compressed, err := os.Open(compressedPath)
+	if err != nil {
+		t.Fatalf("failed to open the archive: %v", err)
+	}
+	defer compressed.Close()
+
+	archivePath := filepath.Join(t.TempDir(), "archive.sq")
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	if err := encryption.EncryptStream(context.Background(), compressed, archive, "password123"); err != nil {
+		t.Fatalf("failed to encrypt the archive: %v", err)
+	}
+	archive.Close()
+
+	outputDir := t.TempDir()
+	if err := ExtractFile(archivePath, "password123", "second.txt", outputDir); err != nil {
+		t.Fatalf("failed to extract second.txt: %v", err)
+	}
+
+	extracted, err := os.ReadFile(filepath.Join(outputDir, "second.txt"))
+	if err != nil || string(extracted) != "content of second.txt" {
+		t.Fatalf("expected the content of second.txt, got %q (%v)", extracted, err)
+	}
+	for _, name := range []string{"first.txt", "third.txt"} {
+		if _, err := os.Stat(filepath.Join(outputDir, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s should not be extracted, got %v", name, err)
+		}
+	}
+
+	err = ExtractFile(archivePath, "password123", "fourth.txt", t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "fourth.txt") {
+		t.Fatalf("expected an error naming fourth.txt, got %v", err)
+	}
+}
+
+func TestAuto(t *testing.T) {
+	photo, err := os.ReadFile("test_files/auto/photo.jpg")
+	if err != nil {
+		t.Fatalf("failed to read the photo: %v", err)
+	}
+	random := make([]byte, 20000)
+	rand.New(rand.NewSource(1)).Read(random)
+	contents := map[string][]byte{
+		"notes.txt":  []byte(strings.Repeat("plain text compresses well with huffman coding. ", 200)),
+		"photo.jpg":  photo,
+		"random.bin": random,
+	}
+	expected := map[string]utils.Algorithm{"notes.txt": utils.HUFFMAN, "photo.jpg": utils.STORE, "random.bin": utils.STORE}
+
+	inputDir := t.TempDir()
+	fileNames := []string{}
+	for name, content := range contents {
+		path := filepath.Join(inputDir, name)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		fileNames = append(fileNames, path)
+	}
+	sort.Strings(fileNames)
+
+	chosen := map[string]utils.Algorithm{}
+	compressedPath, _, err := Compress(context.Background(), fileNames, t.TempDir(), string(utils.AUTO), utils.WithAlgorithmChoices(func(filename string, algorithm utils.Algorithm) {
+		chosen[filepath.Base(filename)] = algorithm
+	}))
+	if err != nil {
+		t.Fatalf("failed to compress files: %v", err)
+	}
+	if !reflect.DeepEqual(chosen, expected) {
+		t.Fatalf("expected the algorithms %v, got %v", expected, chosen)
+	}
+
+	entries, err := List(compressedPath)
+	if err != nil {
+		t.Fatalf("failed to list the archive: %v", err)
+	}
+	if len(entries) != len(contents) {
+		t.Fatalf("expected %d entries, got %d", len(contents), len(entries))
+	}
+	for _, entry := range entries {
+		if algorithm := expected[filepath.Base(entry.Name)]; entry.Algorithm != string(algorithm) {
+			t.Fatalf("%s: expected the algorithm %s, got %s", entry.Name, algorithm, entry.Algorithm)
+		}
+	}
+
+	report, err := Verify(compressedPath)
+	if err != nil {
+		t.Fatalf("failed to verify the archive: %v", err)
+	}
+	if report.Status != utils.VERIFY_OK || report.Checked != uint64(len(contents)) {
+		t.Fatalf("expected %d intact entries, got %+v", len(contents), report)
+	}
+
+	outputDir := t.TempDir()
+	if _, _, err := Decompress(context.Background(), compressedPath, outputDir); err != nil {
+		t.Fatalf("failed to decompress the archive: %v", err)
+	}
+	for name, content := range contents {
+		data, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if !bytes.Equal(data, content) {
+			t.Fatalf("%s: the extracted content differs", name)
+		}
+	}
+
+	// an output that cannot seek gets a streamed Huffman group, a stored file needs to seek
+	files := []utils.FileData{{Name: "notes.txt", Size: int64(len(contents["notes.txt"])), Reader: bytes.NewReader(contents["notes.txt"])}}
+	var archive bytes.Buffer
+	if err := CompressFileData(files, &archive, string(utils.AUTO)); err != nil {
+		t.Fatalf("failed to compress to a buffer: %v", err)
+	}
+	entries, err = ListStream(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to list the streamed archive: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Algorithm != string(utils.HUFFMAN_STREAM) {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+}
+
+func TestAppendFiles(t *testing.T) {
+	for _, algorithm := range []utils.Algorithm{utils.HUFFMAN, utils.LZ77, utils.AUTO} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			inputDir := t.TempDir()
+			contents := map[string]string{"first.txt": "content of the first file", "dir/second.txt": "content of the second file", "third.txt": "appended later"}
+			for name, content := range contents {
+				path := filepath.Join(inputDir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatalf("failed to create the directory of %s: %v", name, err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatalf("failed to write %s: %v", name, err)
+				}
+			}
+
+			compressedPath, _, err := Compress(context.Background(), []string{filepath.Join(inputDir, "first.txt"), filepath.Join(inputDir, "dir")}, t.TempDir(), string(algorithm))
+			if err != nil {
+				t.Fatalf("failed to compress files: %v", err)
+			}
+			compressed, err := os.Open(compressedPath)
+			if err != nil {
+				t.Fatalf("failed to open the archive: %v", err)
+			}
+			defer compressed.Close()
+
+			archivePath := filepath.Join(t.TempDir(), "archive.sq")
+			archive, err := os.Create(archivePath)
+			if err != nil {
+				t.Fatalf("failed to create the archive: %v", err)
+			}
+			if err := encryption.EncryptStream(context.Background(), compressed, archive, "password123"); err != nil {
+				t.Fatalf("failed to encrypt the archive: %v", err)
+			}
+			archive.Close()
+
+			if err := AppendFiles(archivePath, "password123", []string{filepath.Join(inputDir, "third.txt")}); err != nil {
+				t.Fatalf("failed to append third.txt: %v", err)
+			}
+
+			entries, err := ListArchive(archivePath, "password123")
+			if err != nil {
+				t.Fatalf("failed to list the archive: %v", err)
+			}
+			names := []string{}
+			for _, entry := range entries {
+				names = append(names, filepath.ToSlash(entry.Name))
+			}
+			sort.Strings(names)
+			if expected := []string{"dir/second.txt", "first.txt", "third.txt"}; !reflect.DeepEqual(names, expected) {
+				t.Fatalf("expected the entries %v, got %v", expected, names)
+			}
+
+			outputDir := t.TempDir()
+			for name, content := range contents {
+				if err := ExtractFile(archivePath, "password123", name, outputDir); err != nil {
+					t.Fatalf("failed to extract %s: %v", name, err)
+				}
+				data, err := os.ReadFile(filepath.Join(outputDir, name))
+				if err != nil || string(data) != content {
+					t.Fatalf("%s: expected %q, got %q (%v)", name, content, data, err)
+				}
+			}
+
+			// appending a file again would create a second entry with the same name
+			err = AppendFiles(archivePath, "password123", []string{filepath.Join(inputDir, "third.txt")})
+			if err == nil || !strings.Contains(err.Error(), "third.txt") {
+				t.Fatalf("expected an error naming third.txt, got %v", err)
+			}
+
+			leftovers, err := os.ReadDir(filepath.Dir(archivePath))
+			if err != nil || len(leftovers) != 1 {
+				t.Fatalf("expected only the archive to be left, got %v (%v)", leftovers, err)
+			}
+		})
+	}
+}
+
+func TestMergeArchives(t *testing.T) {
+	// every archive has its own files, some of them under the same names
+	archives := []struct {
+		algorithm utils.Algorithm
+		contents  map[string]string
+	}{
+		{utils.HUFFMAN, map[string]string{"a.txt": "first version of a", "shared.txt": "in every archive"}},
+		{utils.DEFLATE, map[string]string{"shared.txt": "in every archive", "b.txt": "only in the second"}},
+		{utils.LZ77, map[string]string{"a.txt": "second version of a", "shared.txt": "in every archive", "c.txt": "only in the third"}},
+	}
+
+	archiveDir := t.TempDir()
+	inputs := []string{}
+	for i, archive := range archives {
+		inputDir := t.TempDir()
+		fileNames := []string{}
+		for name, content := range archive.contents {
+			path := filepath.Join(inputDir, name)
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			fileNames = append(fileNames, path)
+		}
+
+		compressedPath, _, err := Compress(context.Background(), fileNames, t.TempDir(), string(archive.algorithm))
+		if err != nil {
+			t.Fatalf("failed to compress with %s: %v", archive.algorithm, err)
+		}
+		compressed, err := os.Open(compressedPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer compressed.Close()
+
+		inputPath := filepath.Join(archiveDir, fmt.Sprintf("backup-%d.sq", i))
+		input, err := os.Create(inputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := encryption.EncryptStream(context.Background(), compressed, input, "password123"); err != nil {
+			t.Fatalf("failed to encrypt the archive: %v", err)
+		}
+		input.Close()
+		inputs = append(inputs, inputPath)
+	}
+
+	mergedPath := filepath.Join(archiveDir, "merged.sq")
+	if err := MergeArchives(inputs, "password123", mergedPath); err != nil {
+		t.Fatalf("failed to merge: %v", err)
+	}
+
+	entries, err := ListArchive(mergedPath, "password123")
+	if err != nil {
+		t.Fatalf("failed to list the merged archive: %v", err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+		// the algorithms differ, so the files are compressed again with huffman
+		if entry.Algorithm != string(utils.HUFFMAN) {
+			t.Fatalf("expected %s to be compressed with huffman, got %s", entry.Name, entry.Algorithm)
+		}
+	}
+	sort.Strings(names)
+	if expected := []string{"a.txt", "b.txt", "c.txt", "shared.txt"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected the entries %v, got %v", expected, names)
+	}
+
+	outputDir := t.TempDir()
+	// the later archive wins for a.txt
+	expected := map[string]string{"a.txt": "second version of a", "b.txt": "only in the second", "c.txt": "only in the third", "shared.txt": "in every archive"}
+	for name, content := range expected {
+		if err := ExtractFile(mergedPath, "password123", name, outputDir); err != nil {
+			t.Fatalf("failed to extract %s: %v", name, err)
+		}
+		if data, err := os.ReadFile(filepath.Join(outputDir, name)); err != nil || string(data) != content {
+			t.Fatalf("%s: expected %q, got %q (%v)", name, content, data, err)
+		}
+	}
+
+	// only the inputs and the merged archive are left
+	if leftovers, err := os.ReadDir(archiveDir); err != nil || len(leftovers) != len(inputs)+1 {
+		t.Fatalf("expected only the archives to be left, got %v (%v)", leftovers, err)
+	}
+
+	if err := MergeArchives(nil, "password123", mergedPath); err == nil {
+		t.Fatal("expected an error without inputs")
+	}
+	if err := MergeArchives(inputs, "wrong", filepath.Join(archiveDir, "wrong.sq")); err == nil {
+		t.Fatal("expected an error for a wrong password")
+	}
+}
+
+func TestCompressionStats(t *testing.T) {
+	inputDir := t.TempDir()
+	contents := map[string]string{"a.txt": strings.Repeat("squirrels bury acorns\n", 200), "b.txt": "a single line"}
+	fileNames := []string{}
+	for name, content := range contents {
+		path := filepath.Join(inputDir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		fileNames = append(fileNames, path)
+	}
+	originalBytes := uint64(len(contents["a.txt"]) + len(contents["b.txt"]))
+
+	// every file is reported with its sizes, in the order the codec processed it
+	checkFiles := func(t *testing.T, files []utils.FileStats) {
+		sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+		if len(files) != len(contents) {
+			t.Fatalf("expected %d files, got %+v", len(contents), files)
+		}
+		for _, file := range files {
+			if file.OriginalBytes != uint64(len(contents[file.Name])) || file.CompressedBytes == 0 {
+				t.Fatalf("unexpected sizes of %s: %+v", file.Name, file)
+			}
+		}
+	}
+
+	for _, algorithm := range []utils.Algorithm{utils.HUFFMAN, utils.ARITHMETIC, utils.LZ77, utils.DEFLATE, utils.RLE, utils.BWT, utils.LZ4, utils.LZ, utils.STORE, utils.AUTO} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			compressedPath, stats, err := Compress(context.Background(), fileNames, t.TempDir(), string(algorithm))
+			if err != nil {
+				t.Fatalf("failed to compress files: %v", err)
+			}
+			info, err := os.Stat(compressedPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.BytesPerSecond <= 0 || stats.Duration <= 0 {
+				t.Fatalf("expected a positive throughput, got %+v", stats)
+			}
+			if stats.Algorithm != string(algorithm) || stats.OriginalBytes != originalBytes || stats.CompressedBytes != uint64(info.Size()) || stats.EncryptedBytes != 0 || stats.FilesProcessed != len(contents) {
+				t.Fatalf("unexpected stats of the compression: %+v", stats)
+			}
+			checkFiles(t, stats.Files)
+
+			_, stats, err = Decompress(context.Background(), compressedPath, t.TempDir())
+			if err != nil {
+				t.Fatalf("failed to decompress: %v", err)
+			}
+			if stats.BytesPerSecond <= 0 || stats.Algorithm != string(algorithm) || stats.OriginalBytes != originalBytes || stats.CompressedBytes != uint64(info.Size()) || stats.FilesProcessed != len(contents) {
+				t.Fatalf("unexpected stats of the decompression: %+v", stats)
+			}
+			checkFiles(t, stats.Files)
+		})
+	}
+}
+
+func TestOverwritePolicies(t *testing.T) {
+	inputDir := t.TempDir()
+	fileNames := []string{}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		path := filepath.Join(inputDir, name)
+		if err := os.WriteFile(path, []byte("new "+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fileNames = append(fileNames, path)
+	}
+
+	for _, algorithm := range []utils.Algorithm{utils.HUFFMAN, utils.DEFLATE, utils.STORE} {
+		compressedPath, _, err := Compress(context.Background(), fileNames, t.TempDir(), string(algorithm))
+		if err != nil {
+			t.Fatalf("failed to compress with %s: %v", algorithm, err)
+		}
+
+		tests := []struct {
+			policy   utils.OverwritePolicy
+			expected map[string]string
+		}{
+			{"", map[string]string{"b.txt": "old b.txt"}},
+			{utils.OVERWRITE_REPLACE, map[string]string{"a.txt": "new a.txt", "b.txt": "new b.txt"}},
+			{utils.OVERWRITE_RENAME, map[string]string{"a.txt": "new a.txt", "b.txt": "old b.txt", "b_1.txt": "new b.txt"}},
+			{utils.OVERWRITE_SKIP, map[string]string{"a.txt": "new a.txt", "b.txt": "old b.txt"}},
+		}
+		for _, test := range tests {
+			t.Run(fmt.Sprintf("%s/%s", algorithm, test.policy), func(t *testing.T) {
+				outputDir := t.TempDir()
+				if err := os.WriteFile(filepath.Join(outputDir, "b.txt"), []byte("old b.txt"), 0644); err != nil {
+					t.Fatal(err)
+				}
+
+				warnings := []string{}
+				_, _, err := Decompress(context.Background(), compressedPath, outputDir, utils.WithOverwrite(test.policy), utils.WithWarnings(func(message string) {
+					warnings = append(warnings, message)
+				}))
+				var exists *utils.FileExistsError
+				if test.policy == "" {
+					if !errors.As(err, &exists) || exists.Path != filepath.Join(outputDir, "b.txt") || !strings.Contains(err.Error(), exists.Path) {
+						t.Fatalf("expected an error naming b.txt, got %v", err)
+					}
+				} else if err != nil {
+					t.Fatalf("failed to decompress: %v", err)
+				}
+				if (test.policy == utils.OVERWRITE_RENAME || test.policy == utils.OVERWRITE_SKIP) && (len(warnings) != 1 || !strings.Contains(warnings[0], "b.txt")) {
+					t.Fatalf("expected a warning about b.txt, got %v", warnings)
+				}
+
+				// a.txt comes first, an error on b.txt leaves it extracted and nothing of b.txt
+				if test.policy == "" {
+					test.expected["a.txt"] = "new a.txt"
+				}
+				found, err := os.ReadDir(outputDir)
+				if err != nil || len(found) != len(test.expected) {
+					t.Fatalf("expected the files %v, got %v (%v)", test.expected, found, err)
+				}
+				for name, content := range test.expected {
+					data, err := os.ReadFile(filepath.Join(outputDir, name))
+					if err != nil || string(data) != content {
+						t.Fatalf("%s: expected %q, got %q (%v)", name, content, data, err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSignedArchive(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublicKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputPath := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(inputPath, []byte("squirrels bury acorns"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, algorithm := range []utils.Algorithm{utils.HUFFMAN, utils.DEFLATE} {
+		compressedPath, _, err := Compress(context.Background(), []string{inputPath}, t.TempDir(), string(algorithm), utils.WithSignKey(privateKey))
+		if err != nil {
+			t.Fatalf("failed to compress with %s: %v", algorithm, err)
+		}
+
+		outputDir := t.TempDir()
+		if _, _, err := Decompress(context.Background(), compressedPath, outputDir, utils.WithVerifyKey(publicKey)); err != nil {
+			t.Fatalf("failed to decompress a signed %s archive: %v", algorithm, err)
+		}
+		if data, err := os.ReadFile(filepath.Join(outputDir, "notes.txt")); err != nil || string(data) != "squirrels bury acorns" {
+			t.Fatalf("unexpected extraction of a signed %s archive: %q, %v", algorithm, data, err)
+		}
+		if report, err := Verify(compressedPath, utils.WithVerifyKey(publicKey)); err != nil || report.Status != utils.VERIFY_OK {
+			t.Fatalf("failed to verify a signed %s archive: %+v, %v", algorithm, report, err)
+		}
+		if entries, err := List(compressedPath, utils.WithVerifyKey(publicKey)); err != nil || len(entries) != 1 {
+			t.Fatalf("failed to list a signed %s archive: %v, %v", algorithm, entries, err)
+		}
+
+		// the signature is not read as part of the archive without the key
+		outputDir = t.TempDir()
+		if _, _, err := Decompress(context.Background(), compressedPath, outputDir); !errors.Is(err, encryption.ErrVerifyKeyRequired) {
+			t.Fatalf("expected a signed %s archive to need the key, got %v", algorithm, err)
+		}
+		if _, err := Verify(compressedPath); !errors.Is(err, encryption.ErrVerifyKeyRequired) {
+			t.Fatalf("expected verifying a signed %s archive to need the key, got %v", algorithm, err)
+		}
+		if _, err := List(compressedPath); !errors.Is(err, encryption.ErrVerifyKeyRequired) {
+			t.Fatalf("expected listing a signed %s archive to need the key, got %v", algorithm, err)
+		}
+		if entries, _ := os.ReadDir(outputDir); len(entries) > 0 {
+			t.Fatalf("expected nothing to be extracted without the key, got %d files", len(entries))
+		}
+
+		outputDir = t.TempDir()
+		if _, _, err := Decompress(context.Background(), compressedPath, outputDir, utils.WithVerifyKey(otherPublicKey)); !errors.Is(err, encryption.ErrSignatureInvalid) {
+
+			t.Fatalf("expected another key to fail, got %v", err)
+		}
+		if entries, _ := os.ReadDir(outputDir); len(entries) > 0 {
+			t.Fatalf("expected nothing to be extracted before the signature is checked, got %d files", len(entries))
+		}
+	}
+}
+
+func TestSignedEncryptedArchive(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputPath := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(inputPath, []byte("squirrels bury acorns"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	compressedPath, _, err := Compress(context.Background(), []string{inputPath}, t.TempDir(), string(utils.HUFFMAN))
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	compressed, err := os.Open(compressedPath)
+	if err != nil {
+		t.Fatalf("failed to open the archive: %v", err)
+	}
+	defer compressed.Close()
+
+	archivePath := filepath.Join(t.TempDir(), "archive.sq")
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	if err := encryption.EncryptStream(context.Background(), compressed, archive, "password123"); err != nil {
+		t.Fatalf("failed to encrypt the archive: %v", err)
+	}
+	archive.Close()
+	if err := encryption.SignArchive(archivePath, privateKey); err != nil {
+		t.Fatalf("failed to sign the archive: %v", err)
+	}
+
+	// without the key the signature would be decrypted as data following the last chunk
+	if err := ExtractFile(archivePath, "password123", "notes.txt", t.TempDir()); !errors.Is(err, encryption.ErrVerifyKeyRequired) {
+		t.Fatalf("expected extracting without the key to fail, got %v", err)
+	}
+	if _, err := ListArchive(archivePath, "password123"); !errors.Is(err, encryption.ErrVerifyKeyRequired) {
+		t.Fatalf("expected listing without the key to fail, got %v", err)
+	}
+
+	outputDir := t.TempDir()
+	if err := ExtractFile(archivePath, "password123", "notes.txt", outputDir, encryption.EncryptionOptions{VerifyKey: publicKey}); err != nil {
+		t.Fatalf("failed to extract with the key: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(outputDir, "notes.txt")); err != nil || string(data) != "squirrels bury acorns" {
+		t.Fatalf("unexpected extraction: %q, %v", data, err)
+	}
+	if entries, err := ListArchive(archivePath, "password123", encryption.EncryptionOptions{VerifyKey: publicKey}); err != nil || len(entries) != 1 {
+		t.Fatalf("failed to list with the key: %v, %v", entries, err)
+	}
+}
+
+func TestUnsignedArchiveEndingLikeSignature(t *testing.T) {
+	// the data of a stored file ends the archive, these bytes look like a signature trailer
+	content := append([]byte("squirrels bury acorns"), encryption.SIGNATURE_MAGIC...)
+	content = append(content, bytes.Repeat([]byte{1}, ed25519.SignatureSize)...)
+	inputPath := filepath.Join(t.TempDir(), "notes.bin")
+	if err := os.WriteFile(inputPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	compressedPath, _, err := Compress(context.Background(), []string{inputPath}, t.TempDir(), string(utils.STORE))
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	archive, err := os.ReadFile(compressedPath)
+	if err != nil || !bytes.HasSuffix(archive, content[len(content)-encryption.SIGNATURE_TRAILER_SIZE:]) {
+		t.Fatalf("expected the archive to end like a signed one, %v", err)
+	}
+
+	// the trailer is only recognized by its bytes, such an archive is taken for a signed one
+	// rather than cut or read with the signature of a signed archive
+	if _, _, err := Decompress(context.Background(), compressedPath, t.TempDir()); !errors.Is(err, encryption.ErrVerifyKeyRequired) {
+		t.Fatalf("expected the archive to be taken for a signed one, got %v", err)
+	}
+	if _, err := List(compressedPath); !errors.Is(err, encryption.ErrVerifyKeyRequired) {
+		t.Fatalf("expected the archive to be taken for a signed one, got %v", err)
+	}
+}
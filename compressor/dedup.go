@@ -0,0 +1,80 @@
+package compressor
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"file-compressor/constants"
+	"file-compressor/utils"
+)
+
+// linksSupported reports whether the payload of algorithm stores the files with the same
+// content as an earlier one as links to it, see utils.FileData.Link. utils.AUTO passes the
+// links on to its Huffman groups, a file and its duplicates always end up in the same group.
+// utils.HUFFMAN is streamed as utils.HUFFMAN_STREAM to an output that cannot seek, which
+// stores the links as well.
+func linksSupported(algorithm string, options utils.Options) bool {
+	if options.ArchiveFormat == utils.TARGZ {
+		return false
+	}
+	switch utils.Algorithm(algorithm) {
+	case utils.HUFFMAN, utils.HUFFMAN_STREAM, utils.BWT, utils.AUTO:
+		return true
+	}
+	return false
+}
+
+// linkDuplicates sets the Link of every file whose content is the same as the one of an earlier
+// file to the name of that file, so it is stored once, such as the copies of a package in a
+// node_modules directory. Only files of the same size are hashed with SHA-256, and empty files
+// are left alone, they have no data to save. The readers are rewound after hashing.
+//
+// Parameters:
+//   - files: the files to compress, their readers must seek
+//
+// Returns:
+//   - error: if a file cannot be read or rewound
+func linkDuplicates(files []utils.FileData) error {
+	sizes := map[int64]int{}
+	for _, file := range files {
+		sizes[file.Size]++
+	}
+
+	// the name of the first file with a content, by its hash
+	originals := map[string]string{}
+	for i, file := range files {
+		if file.Size == 0 || sizes[file.Size] < 2 {
+			continue
+		}
+
+		hash, err := hashReader(file.Reader)
+		if err != nil {
+			return fmt.Errorf("failed to hash %s: %w", file.Name, err)
+		}
+		if original, found := originals[hash]; found {
+			files[i].Link = original
+		} else {
+			originals[hash] = file.Name
+		}
+	}
+
+	return nil
+}
+
+// hashReader returns the SHA-256 hash of everything reader holds and rewinds it.
+func hashReader(reader io.Reader) (string, error) {
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		return "", fmt.Errorf("cannot rewind a %T", reader)
+	}
+
+	hash := sha256.New()
+	if _, err := io.CopyBuffer(hash, reader, make([]byte, constants.BUFFER_SIZE)); err != nil {
+		return "", fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	return string(hash.Sum(nil)), nil
+}
@@ -0,0 +1,72 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+func TestDeduplicateFiles(t *testing.T) {
+	// four random letters are coded with about two bits each, a quarter of their size. The
+	// archive of the four files is only smaller than three quarters of one when the three
+	// copies are stored once
+	random := rand.New(rand.NewSource(1))
+	letters := func() []byte {
+		data := make([]byte, 64<<10)
+		for i := range data {
+			data[i] = byte('a' + random.Intn(4))
+		}
+		return data
+	}
+	content := letters()
+
+	inputDir := t.TempDir()
+	names := []string{"a.bin", "copy/b.bin", "copy/deeper/c.bin"}
+	for _, name := range names {
+		path := filepath.Join(inputDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the same size with another content is not a duplicate
+	other := letters()
+	if err := os.WriteFile(filepath.Join(inputDir, "other.bin"), other, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, algorithm := range []utils.Algorithm{utils.HUFFMAN, utils.BWT, utils.AUTO} {
+		archivePath, _, err := Compress(context.Background(), []string{inputDir}, t.TempDir(), string(algorithm))
+		if err != nil {
+			t.Fatalf("%s: failed to compress: %v", algorithm, err)
+		}
+		info, err := os.Stat(archivePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > int64(len(content))*3/4 {
+			t.Fatalf("%s: expected the copies to be stored once, the archive is %d bytes", algorithm, info.Size())
+		}
+
+		outputDir := t.TempDir()
+		if _, _, err := Decompress(context.Background(), archivePath, outputDir); err != nil {
+			t.Fatalf("%s: failed to decompress: %v", algorithm, err)
+		}
+		for _, name := range names {
+			extracted, err := os.ReadFile(filepath.Join(outputDir, filepath.Base(inputDir), filepath.FromSlash(name)))
+			if err != nil || !bytes.Equal(extracted, content) {
+				t.Fatalf("%s: expected %s to match the original: %v", algorithm, name, err)
+			}
+		}
+		if extracted, err := os.ReadFile(filepath.Join(outputDir, filepath.Base(inputDir), "other.bin")); err != nil || !bytes.Equal(extracted, other) {
+			t.Fatalf("%s: expected other.bin to match the original: %v", algorithm, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package deflate
+
+import (
+	"bufio"
+	"compress/flate"
+	"fmt"
+	"io"
+
+	"file-compressor/compressor/framing"
+	"file-compressor/constants"
+	"file-compressor/metrics"
+	"file-compressor/utils"
+)
+
+// Zip compresses multiple files with Deflate (RFC 1951) and writes them to output.
+// It writes the number of files followed by every entry, framed like the other codecs. The
+// compressed size of an entry is back-filled after its data, so output must also implement
+// io.Seeker.
+//
+// Parameters:
+//   - files: A slice of utils.FileData representing the files to be compressed.
+//   - output: An io.Writer where the compressed data will be written.
+//   - opts: Optional settings such as utils.WithMetrics, or utils.WithLevel to trade speed for
+//     size.
+//
+// Returns:
+//   - error: An error if the level is not between 1 and 9, or if any step in the compression
+//     process fails.
+func Zip(files []utils.FileData, output io.Writer, opts ...utils.Option) error {
+	options := utils.NewOptions(opts...)
+
+	if err := zipFiles(files, output, options); err != nil {
+		metrics.RecordError(options.Metrics, string(utils.DEFLATE), metrics.OP_COMPRESS, err)
+		return err
+	}
+
+	return nil
+}
+
+func zipFiles(files []utils.FileData, output io.Writer, options utils.Options) error {
+	// the levels of utils.CompressionLevel are the levels of flate
+	level := flate.DefaultCompression
+	if options.Level != 0 {
+		if options.Level < utils.LevelFast || options.Level > utils.LevelBest {
+			return fmt.Errorf("deflate level %d is outside of %d to %d", options.Level, utils.LevelFast, utils.LevelBest)
+		}
+		level = int(options.Level)
+	}
+
+	return framing.WriteEntries(files, output, utils.DEFLATE, func(input io.Reader, output io.Writer) (uint64, error) {
+		return compressData(input, output, level)
+	}, options)
+}
+
+// compressData writes the Deflate stream of input at the given flate level and returns the
+// number of bytes written.
+func compressData(input io.Reader, output io.Writer, level int) (uint64, error) {
+	counter := &utils.CountingWriter{Writer: output}
+	writer, err := flate.NewWriter(counter, level)
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, constants.BUFFER_SIZE)
+	if _, err := io.CopyBuffer(writer, input, buf); err != nil {
+		return 0, err
+	}
+	if err := writer.Close(); err != nil {
+		return 0, fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+
+	return uint64(counter.BytesWritten), nil
+}
+
+// decompressData decodes one entry of compressedSize bytes from input into output.
+// The whole entry is consumed, so input is positioned at the next entry afterwards.
+func decompressData(input io.Reader, output io.Writer, compressedSize uint64) error {
+	entry := &io.LimitedReader{R: input, N: int64(compressedSize)}
+	// the buffered reader lets flate read ahead without consuming the next entry
+	reader := flate.NewReader(bufio.NewReaderSize(entry, constants.BUFFER_SIZE))
+	defer reader.Close()
+
+	buf := make([]byte, constants.BUFFER_SIZE)
+	if _, err := io.CopyBuffer(output, reader, buf); err != nil {
+		return fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	// the Deflate stream may end before the padding of its last byte was read
+	if err := utils.SkipBytes(entry, uint64(entry.N)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Unzip decompresses a Deflate archive from input and writes the files below outputPath.
+// If the output path is an empty string, the current directory is used.
+//
+// Parameters:
+//   - input: An io.Reader from which the compressed data is read.
+//   - outputPath: A string specifying the directory where the decompressed files will be written.
+//   - opts: Optional settings, the same as for hfc.Unzip.
+//
+// Returns:
+//   - A slice of strings containing the paths of the decompressed files.
+//   - An error if any issue occurs during the decompression process.
+func Unzip(input io.Reader, outputPath string, opts ...utils.Option) ([]string, error) {
+	options := utils.NewOptions(opts...)
+
+	filePaths, err := framing.ReadEntries(input, outputPath, utils.DEFLATE, decompressData, options)
+	if err != nil {
+		metrics.RecordError(options.Metrics, string(utils.DEFLATE), metrics.OP_DECOMPRESS, err)
+		return nil, err
+	}
+
+	return filePaths, nil
+}
+
+// List reads the entry headers of a Deflate archive, skipping the entry data.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the Deflate payload.
+//
+// Returns:
+//   - []utils.EntryInfo: the entries in archive order
+//   - error: if the archive is truncated
+func List(input io.Reader) ([]utils.EntryInfo, error) {
+	return framing.List(input)
+}
+
+// Verify decodes every entry of a deflate archive without writing anything and reports all
+// damaged entries, like hfc.Verify.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the deflate payload.
+//
+// Returns:
+//   - utils.VerifyReport: the collected report. Offsets are relative to the start of input.
+func Verify(input io.Reader) utils.VerifyReport {
+	return utils.VerifyEntries(input, decompressData)
+}
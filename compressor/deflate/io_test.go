@@ -0,0 +1,134 @@
+package deflate
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+func testFiles(contents map[string][]byte) []utils.FileData {
+	files := []utils.FileData{}
+	for name, content := range contents {
+		files = append(files, utils.FileData{Name: name, Size: int64(len(content)), Reader: bytes.NewReader(content)})
+	}
+	return files
+}
+
+func zipToFile(t *testing.T, contents map[string][]byte, opts ...utils.Option) string {
+	archivePath := filepath.Join(t.TempDir(), "archive.sq")
+	output, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	defer output.Close()
+
+	if err := Zip(testFiles(contents), output, opts...); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+	return archivePath
+}
+
+func TestZipUnzip(t *testing.T) {
+	contents := map[string][]byte{
+		"text.txt":  bytes.Repeat([]byte("to be or not to be, "), 500),
+		"empty.txt": {},
+		"dir/b.bin": {0, 1, 2, 3, 255, 254, 0, 0},
+	}
+
+	input, err := os.Open(zipToFile(t, contents))
+	if err != nil {
+		t.Fatalf("failed to open the archive: %v", err)
+	}
+	defer input.Close()
+
+	outputDir := t.TempDir()
+	paths, err := Unzip(input, outputDir)
+	if err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+	if len(paths) != len(contents) {
+		t.Fatalf("expected %d files, got %d", len(contents), len(paths))
+	}
+
+	for name, content := range contents {
+		decompressed, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if !bytes.Equal(content, decompressed) {
+			t.Fatalf("%s does not match the original", name)
+		}
+	}
+}
+
+func TestLevels(t *testing.T) {
+	words := strings.Fields("a level only changes how hard the encoder looks for matches")
+	random := rand.New(rand.NewSource(1))
+	text := []byte{}
+	for len(text) < 200000 {
+		text = append(text, words[random.Intn(len(words))]...)
+		text = append(text, ' ')
+	}
+	contents := map[string][]byte{"text.txt": text}
+
+	sizes := map[utils.CompressionLevel]int64{}
+	for _, level := range []utils.CompressionLevel{utils.LevelFast, utils.LevelBest} {
+		archivePath := zipToFile(t, contents, utils.WithLevel(level))
+		info, err := os.Stat(archivePath)
+		if err != nil {
+			t.Fatalf("failed to stat the archive: %v", err)
+		}
+		sizes[level] = info.Size()
+
+		input, err := os.Open(archivePath)
+		if err != nil {
+			t.Fatalf("failed to open the archive: %v", err)
+		}
+		defer input.Close()
+		outputDir := t.TempDir()
+		if _, err := Unzip(input, outputDir); err != nil {
+			t.Fatalf("level %d: failed to unzip: %v", level, err)
+		}
+		decompressed, err := os.ReadFile(filepath.Join(outputDir, "text.txt"))
+		if err != nil || !bytes.Equal(decompressed, text) {
+			t.Fatalf("level %d: the extracted file does not match the original (%v)", level, err)
+		}
+	}
+	if sizes[utils.LevelBest] >= sizes[utils.LevelFast] {
+		t.Fatalf("expected level 9 to be smaller than level 1, got %d and %d bytes", sizes[utils.LevelBest], sizes[utils.LevelFast])
+	}
+
+	output, err := os.Create(filepath.Join(t.TempDir(), "archive.sq"))
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	defer output.Close()
+	if err := Zip(testFiles(contents), output, utils.WithLevel(10)); err == nil || !strings.Contains(err.Error(), "level 10") {
+		t.Fatalf("expected an error for level 10, got %v", err)
+	}
+}
+
+func TestZipRequiresSeeker(t *testing.T) {
+	if err := Zip(testFiles(map[string][]byte{"a.txt": []byte("abc")}), &bytes.Buffer{}); err == nil {
+		t.Fatal("expected an error for an output that cannot seek")
+	}
+}
+
+func TestUnzipCorruptData(t *testing.T) {
+	archivePath := zipToFile(t, map[string][]byte{"text.txt": bytes.Repeat([]byte("abcdefgh"), 100)})
+	archive, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("failed to read the archive: %v", err)
+	}
+
+	// the last bytes are Deflate data of the only entry
+	archive[len(archive)-2] ^= 0xff
+	if _, err := Unzip(bytes.NewReader(archive), t.TempDir()); err == nil {
+		t.Fatal("expected an error for corrupted entry data")
+	}
+}
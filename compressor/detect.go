@@ -0,0 +1,245 @@
+package compressor
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"file-compressor/compressor/bzip2"
+	"file-compressor/compressor/targz"
+	"file-compressor/constants"
+	"file-compressor/encryption"
+	"file-compressor/format"
+	"file-compressor/utils"
+)
+
+// Container is the kind of file DetectContainer recognizes from its first bytes.
+type Container string
+
+const (
+	// CONTAINER_NATIVE is an unencrypted SquirrelZip archive, or one of format.VERSION_1.
+	CONTAINER_NATIVE Container = "squirrelzip"
+	// CONTAINER_ENCRYPTED is a SquirrelZip archive as written by the CLI, the metadata of the
+	// encryption comes first, even without a password.
+	CONTAINER_ENCRYPTED Container = "encrypted"
+	CONTAINER_BZIP2     Container = "bzip2"
+	// CONTAINER_GZIP is read as a tar.gz, see the targz package.
+	CONTAINER_GZIP Container = "gzip"
+	CONTAINER_TAR  Container = "tar"
+	CONTAINER_ZIP  Container = "zip"
+	CONTAINER_7Z   Container = "7z"
+	CONTAINER_RAR  Container = "rar"
+	CONTAINER_XZ   Container = "xz"
+	CONTAINER_ZSTD Container = "zstd"
+	// CONTAINER_PLAIN is text that was never compressed.
+	CONTAINER_PLAIN Container = "plain"
+	// CONTAINER_UNKNOWN is anything else, such as a damaged archive.
+	CONTAINER_UNKNOWN Container = "unknown"
+)
+
+// DETECT_LEN is the number of bytes DetectContainer looks at, up to the magic of a tar header.
+const DETECT_LEN = TAR_MAGIC_OFFSET + len(TAR_MAGIC)
+
+// TAR_MAGIC is found at TAR_MAGIC_OFFSET in the first header of a POSIX or GNU tar archive.
+const (
+	TAR_MAGIC        = "ustar"
+	TAR_MAGIC_OFFSET = 257
+)
+
+// magics are the signatures of the containers SquirrelZip does not write, at the start of a file.
+var magics = []struct {
+	magic     string
+	container Container
+}{
+	{"PK\x03\x04", CONTAINER_ZIP},
+	// an empty zip archive, and a spanned one
+	{"PK\x05\x06", CONTAINER_ZIP},
+	{"PK\x07\x08", CONTAINER_ZIP},
+	{"7z\xbc\xaf\x27\x1c", CONTAINER_7Z},
+	{"Rar!\x1a\x07", CONTAINER_RAR},
+	{"\xfd7zXZ\x00", CONTAINER_XZ},
+	{"\x28\xb5\x2f\xfd", CONTAINER_ZSTD},
+}
+
+// containerNames are the names of the containers in the errors of UnsupportedContainerError.
+var containerNames = map[Container]string{
+	CONTAINER_ZIP:  "a ZIP archive",
+	CONTAINER_7Z:   "a 7-Zip archive",
+	CONTAINER_RAR:  "a RAR archive",
+	CONTAINER_XZ:   "an xz file",
+	CONTAINER_ZSTD: "a Zstandard file",
+}
+
+// DetectContainer recognizes a file from header, its first DETECT_LEN bytes or fewer when it is
+// shorter. Only the tar magic needs all of them.
+//
+// Parameters:
+//   - header: The first bytes of the file.
+//
+// Returns:
+//   - Container: what the file looks like, CONTAINER_UNKNOWN when nothing matches
+func DetectContainer(header []byte) Container {
+	switch {
+	case bytes.HasPrefix(header, []byte(format.MAGIC)) || isLegacyHeader(header) || isLegacyArchive(header):
+		return CONTAINER_NATIVE
+	case bzip2.IsBzip2(header):
+		return CONTAINER_BZIP2
+	case targz.IsTarGz(header):
+		return CONTAINER_GZIP
+	case len(header) >= DETECT_LEN && string(header[TAR_MAGIC_OFFSET:DETECT_LEN]) == TAR_MAGIC:
+		return CONTAINER_TAR
+	}
+	for _, signature := range magics {
+		if bytes.HasPrefix(header, []byte(signature.magic)) {
+			return signature.container
+		}
+	}
+
+	switch {
+	case encryption.LooksEncrypted(header):
+		return CONTAINER_ENCRYPTED
+	case isText(header):
+		return CONTAINER_PLAIN
+	case encryption.LooksLegacyEncrypted(header):
+		// an archive encrypted by the first releases, its nonce follows the first byte
+		return CONTAINER_ENCRYPTED
+	}
+	return CONTAINER_UNKNOWN
+}
+
+// isLegacyHeader reports whether header starts like a format.VERSION_1 archive, with the length
+// and the name of utils.HUFFMAN, the only algorithm of that version.
+func isLegacyHeader(header []byte) bool {
+	const algorithm = "huffman"
+	return len(header) > len(algorithm) && int(header[0]) == len(algorithm) && string(header[1:1+len(algorithm)]) == algorithm
+}
+
+// isLegacyArchive reports whether header starts like an archive the first releases wrote
+// without a password: the metadata byte constants.NO_PASSWORD followed by the
+// format.VERSION_1 header.
+func isLegacyArchive(header []byte) bool {
+	return len(header) > 0 && header[0] == constants.NO_PASSWORD && isLegacyHeader(header[1:])
+}
+
+// isText reports whether header is printable UTF-8 text. A character cut by the end of header
+// still counts as text.
+func isText(header []byte) bool {
+	if len(header) == 0 {
+		return false
+	}
+	for len(header) > 0 {
+		r, size := utf8.DecodeRune(header)
+		if r == utf8.RuneError && size <= 1 {
+			return len(header) < utf8.UTFMax && !utf8.FullRune(header)
+		}
+		if r < ' ' && r != '\t' && r != '\n' && r != '\r' && r != '\f' {
+			return false
+		}
+		header = header[size:]
+	}
+	return true
+}
+
+// UnsupportedContainerError is returned for a file SquirrelZip recognizes but cannot read. It
+// unwraps to *format.ErrNotAnArchive.
+type UnsupportedContainerError struct {
+	Container Container
+	// Found holds the first bytes of the file.
+	Found []byte
+}
+
+func (e *UnsupportedContainerError) Error() string {
+	switch e.Container {
+	case CONTAINER_PLAIN:
+		return "input is not compressed"
+	case CONTAINER_ENCRYPTED:
+		return "input is an encrypted archive, it has to be decrypted first"
+	case CONTAINER_BZIP2:
+		return "input is a bzip2 file, it can only be decompressed"
+	}
+	if name, ok := containerNames[e.Container]; ok {
+		return fmt.Sprintf("input looks like %s; SquirrelZip cannot read it", name)
+	}
+	return (&format.ErrNotAnArchive{Found: e.Found}).Error()
+}
+
+func (e *UnsupportedContainerError) Unwrap() error {
+	return &format.ErrNotAnArchive{Found: e.Found}
+}
+
+// peekContainer recognizes the file read by input without consuming it. A buffer smaller than
+// DETECT_LEN only misses the tar magic.
+func peekContainer(input *bufio.Reader) (Container, []byte, error) {
+	header, err := input.Peek(DETECT_LEN)
+	if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+		return CONTAINER_UNKNOWN, nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	return DetectContainer(header), header, nil
+}
+
+// sniffContainer recognizes compressedFile from its first bytes and seeks back to its start.
+func sniffContainer(compressedFile io.ReadSeeker) (Container, []byte, error) {
+	header := make([]byte, DETECT_LEN)
+	n, err := io.ReadFull(compressedFile, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return CONTAINER_UNKNOWN, nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	if _, err := compressedFile.Seek(0, io.SeekStart); err != nil {
+		return CONTAINER_UNKNOWN, nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	return DetectContainer(header[:n]), header[:n], nil
+}
+
+// CheckContainer returns an *UnsupportedContainerError for the files SquirrelZip cannot read at
+// all: ZIP, 7-Zip, RAR, xz and Zstandard files, text that is not compressed, and unknown files.
+// It returns nil for the others.
+//
+// Parameters:
+//   - container: The container found by DetectContainer.
+//   - header: The bytes it was found in, kept in the error.
+//
+// Returns:
+//   - error: the precise error, or nil
+func CheckContainer(container Container, header []byte) error {
+	if _, ok := containerNames[container]; ok || container == CONTAINER_PLAIN || container == CONTAINER_UNKNOWN {
+		return unsupportedContainer(container, header)
+	}
+	return nil
+}
+
+// unsupportedContainer returns the error for a container that cannot be read where it was found.
+func unsupportedContainer(container Container, header []byte) error {
+	return &UnsupportedContainerError{Container: container, Found: append([]byte(nil), header[:min(len(header), len(format.MAGIC))]...)}
+}
+
+// ArchiveAlgorithm returns the algorithm of the archive that starts with header, its first
+// DETECT_LEN bytes: the one of the container header of a SquirrelZip archive, utils.TARGZ for a
+// gzip stream, and the name of the container for a tar or a bzip2 file.
+//
+// Parameters:
+//   - header: The first bytes of the archive.
+//
+// Returns:
+//   - string: the algorithm, empty when it cannot be told, such as for an encrypted archive
+func ArchiveAlgorithm(header []byte) string {
+	switch container := DetectContainer(header); container {
+	case CONTAINER_NATIVE:
+		if !bytes.HasPrefix(header, []byte(format.MAGIC)) {
+			// format.VERSION_1 only holds Huffman data
+			return string(utils.HUFFMAN)
+		}
+		containerHeader, err := format.ReadContainerHeader(bytes.NewReader(header))
+		if err != nil {
+			return ""
+		}
+		return containerHeader.Algorithm
+	case CONTAINER_GZIP:
+		return string(utils.TARGZ)
+	case CONTAINER_TAR, CONTAINER_BZIP2:
+		return string(container)
+	}
+	return ""
+}
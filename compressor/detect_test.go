@@ -0,0 +1,158 @@
+package compressor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"file-compressor/constants"
+	"file-compressor/encryption"
+	"file-compressor/format"
+)
+
+// zipHeader returns the start of a ZIP archive with one file, as written by other tools.
+func zipHeader(t *testing.T) []byte {
+	output := &bytes.Buffer{}
+	writer := zip.NewWriter(output)
+	file, err := writer.Create("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("squirrels"))
+	writer.Close()
+	return output.Bytes()
+}
+
+func tarHeader(t *testing.T) []byte {
+	output := &bytes.Buffer{}
+	writer := tar.NewWriter(output)
+	if err := writer.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "a.txt", Mode: 0o644, Size: 9}); err != nil {
+		t.Fatal(err)
+	}
+	writer.Write([]byte("squirrels"))
+	writer.Close()
+	return output.Bytes()
+}
+
+func gzipHeader(t *testing.T) []byte {
+	output := &bytes.Buffer{}
+	writer := gzip.NewWriter(output)
+	writer.Write(tarHeader(t))
+	writer.Close()
+	return output.Bytes()
+}
+
+func encryptedHeader(t *testing.T, password string) []byte {
+	output := &bytes.Buffer{}
+	if err := encryption.EncryptStream(context.Background(), strings.NewReader("squirrels"), output, password, encryption.EncryptionOptions{KDFIterations: 1_000}); err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	return output.Bytes()
+}
+
+func TestDetectContainer(t *testing.T) {
+	bzip2File, err := os.ReadFile(filepath.Join("test_files", "bzip2", "notes.txt.bz2"))
+	if err != nil {
+		t.Fatalf("failed to read the bzip2 fixture: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		header   []byte
+		expected Container
+	}{
+		{"native", append([]byte(format.MAGIC), byte(format.CURRENT_VERSION)), CONTAINER_NATIVE},
+		{"version 1", []byte("\x07huffman\x00\x00\x00\x01"), CONTAINER_NATIVE},
+		{"version 1 without a password", []byte("+\x07huffman\x00\x00\x00"), CONTAINER_NATIVE},
+		{"bzip2", bzip2File, CONTAINER_BZIP2},
+		{"gzip", gzipHeader(t), CONTAINER_GZIP},
+		{"tar", tarHeader(t), CONTAINER_TAR},
+		{"zip", zipHeader(t), CONTAINER_ZIP},
+		{"empty zip", []byte("PK\x05\x06\x00\x00\x00\x00"), CONTAINER_ZIP},
+		{"7z", []byte("7z\xbc\xaf\x27\x1c\x00\x04"), CONTAINER_7Z},
+		{"rar", []byte("Rar!\x1a\x07\x01\x00"), CONTAINER_RAR},
+		{"xz", []byte("\xfd7zXZ\x00\x00\x04"), CONTAINER_XZ},
+		{"zstd", []byte("\x28\xb5\x2f\xfd\x24\x09"), CONTAINER_ZSTD},
+		{"encrypted", encryptedHeader(t, "secret"), CONTAINER_ENCRYPTED},
+		{"no password", encryptedHeader(t, ""), CONTAINER_ENCRYPTED},
+		{"version 1 encrypted", []byte{constants.PASSWORD, 0x99, 0x74, 0x47, 0xad, 0x70, 0xaa, 0xad, 0x40, 0xf1, 0x14, 0x9e}, CONTAINER_ENCRYPTED},
+		{"text", []byte("squirrels bury acorns\n"), CONTAINER_PLAIN},
+		{"utf-8 text", []byte("écureuil\tnoisette"), CONTAINER_PLAIN},
+		{"binary", []byte{0xde, 0xad, 0xbe, 0xef, 0x00, 0x01}, CONTAINER_UNKNOWN},
+		{"empty", nil, CONTAINER_UNKNOWN},
+	}
+
+	for _, test := range tests {
+		header := test.header[:min(len(test.header), DETECT_LEN)]
+		if container := DetectContainer(header); container != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, container)
+		}
+	}
+}
+
+func TestCheckContainer(t *testing.T) {
+	tests := []struct {
+		container Container
+		expected  string
+	}{
+		{CONTAINER_ZIP, "input looks like a ZIP archive; SquirrelZip cannot read it"},
+		{CONTAINER_7Z, "input looks like a 7-Zip archive; SquirrelZip cannot read it"},
+		{CONTAINER_PLAIN, "input is not compressed"},
+		{CONTAINER_UNKNOWN, "not a SquirrelZip archive"},
+		{CONTAINER_NATIVE, ""},
+		{CONTAINER_GZIP, ""},
+		{CONTAINER_TAR, ""},
+		{CONTAINER_BZIP2, ""},
+		{CONTAINER_ENCRYPTED, ""},
+	}
+
+	for _, test := range tests {
+		err := CheckContainer(test.container, []byte("PK\x03\x04"))
+		if test.expected == "" {
+			if err != nil {
+				t.Errorf("%s: expected no error, got %v", test.container, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("%s: expected %q, got %v", test.container, test.expected, err)
+		}
+		var notAnArchive *format.ErrNotAnArchive
+		if !errors.As(err, &notAnArchive) {
+			t.Errorf("%s: expected the error to unwrap to *format.ErrNotAnArchive", test.container)
+		}
+	}
+}
+
+func TestDecompressForeignContainers(t *testing.T) {
+	zipPath := filepath.Join(t.TempDir(), "archive.zip")
+	if err := os.WriteFile(zipPath, zipHeader(t), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var unsupported *UnsupportedContainerError
+	if _, _, err := Decompress(context.Background(), zipPath, t.TempDir()); !errors.As(err, &unsupported) || unsupported.Container != CONTAINER_ZIP {
+		t.Fatalf("expected a ZIP archive to be reported, got %v", err)
+	}
+
+	// a tar without gzip is extracted like a tar.gz
+	outputDir := t.TempDir()
+	paths, err := DecompressStream(context.Background(), bytes.NewReader(tarHeader(t)), outputDir, nil)
+	if err != nil {
+		t.Fatalf("failed to decompress a tar: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(outputDir, "a.txt")); err != nil || string(data) != "squirrels" || len(paths) != 1 {
+		t.Fatalf("unexpected extraction of a tar: %v, %q, %v", paths, data, err)
+	}
+
+	entries, err := ListStream(bytes.NewReader(tarHeader(t)))
+	if err != nil || len(entries) != 1 || entries[0].Algorithm != string(CONTAINER_TAR) {
+		t.Fatalf("unexpected entries of a tar: %+v, %v", entries, err)
+	}
+}
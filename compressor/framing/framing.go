@@ -0,0 +1,221 @@
+// Package framing writes and reads the entries of the codecs that frame them the same way: the
+// number of files, then every entry header followed by the entry data, see format.EntryHeader.
+// The codecs only encode and decode the data of a single entry, the arithmetic codec writes its
+// frequency table before the entries.
+package framing
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"file-compressor/constants"
+	"file-compressor/format"
+	"file-compressor/metrics"
+	"file-compressor/utils"
+)
+
+// CompressFunc writes the compressed data of one entry read from input to output and returns the
+// number of bytes written.
+type CompressFunc func(input io.Reader, output io.Writer) (uint64, error)
+
+// WriteEntries writes the number of files followed by every entry, its data compressed by
+// compress. The checksum and the sizes of an entry are back-filled after its data, so output
+// must also implement io.Seeker.
+//
+// Parameters:
+//   - files: The files to be compressed.
+//   - output: The writer the entries are written to.
+//   - algorithm: The algorithm of the codec, for the metrics and the errors.
+//   - compress: Compresses the data of a single entry.
+//   - options: The options of the codec, for the metrics and the progress.
+//
+// Returns:
+//   - error: if output cannot seek, or if any step in the compression process fails
+func WriteEntries(files []utils.FileData, output io.Writer, algorithm utils.Algorithm, compress CompressFunc, options utils.Options) error {
+	seeker, err := Seeker(output, algorithm)
+	if err != nil {
+		return err
+	}
+
+	if err := format.WriteEntryCount(output, uint64(len(files))); err != nil {
+		return err
+	}
+
+	total := utils.TotalSize(files)
+
+	for _, file := range files {
+		start := time.Now()
+		reader := &utils.CountingReader{Reader: file.Reader}
+
+		// the checksum and the sizes are filled in below
+		if err := format.WriteEntryHeader(output, format.EntryHeader{Name: []byte(file.Name), ModTime: utils.UnixNanos(file.ModTime), Mode: uint32(file.Mode.Perm())}); err != nil {
+			return err
+		}
+
+		checksum := crc32.NewIEEE()
+		compressedLen, err := compress(io.TeeReader(reader, checksum), output)
+		if err != nil {
+			return fmt.Errorf(constants.ERROR_COMPRESS, err)
+		}
+
+		if _, err := seeker.Seek(-int64(compressedLen+format.ENTRY_SIZE_LEN+format.ENTRY_ORIGINAL_SIZE_LEN+format.ENTRY_CRC_LEN), io.SeekCurrent); err != nil {
+			return fmt.Errorf("error seeking back to write the compressed size: %w", err)
+		}
+		if err := format.WriteEntryCRC(output, checksum.Sum32()); err != nil {
+			return err
+		}
+		if err := format.WriteEntryOriginalSize(output, uint64(reader.BytesRead)); err != nil {
+			return err
+		}
+		if err := format.WriteEntrySize(output, compressedLen); err != nil {
+			return err
+		}
+		if _, err := seeker.Seek(0, io.SeekEnd); err != nil {
+			return fmt.Errorf("error seeking to the end of the file: %w", err)
+		}
+
+		metrics.RecordEntry(options.Metrics, string(algorithm), metrics.OP_COMPRESS, reader.BytesRead, int64(compressedLen), time.Since(start))
+		options.Progress(file.Name, reader.BytesRead, total)
+	}
+
+	return nil
+}
+
+// Seeker returns output as the io.Seeker WriteEntries back-fills the entry headers with, a codec
+// that writes something before the entries checks it first.
+//
+// Parameters:
+//   - output: The writer the entries are written to.
+//   - algorithm: The algorithm of the codec, for the error.
+//
+// Returns:
+//   - io.Seeker: output
+//   - error: if output cannot seek
+func Seeker(output io.Writer, algorithm utils.Algorithm) (io.Seeker, error) {
+	seeker, ok := output.(io.Seeker)
+	if !ok {
+		return nil, fmt.Errorf("%s output must support seeking", algorithm)
+	}
+	return seeker, nil
+}
+
+// ReadEntries reads the number of files and extracts every entry selected by the options below
+// outputPath, its data decoded by decompress. The others are skipped without decoding.
+//
+// Parameters:
+//   - input: The reader positioned at the number of files.
+//   - outputPath: The directory where the files are written, the current directory when empty.
+//   - algorithm: The algorithm of the codec, for the metrics.
+//   - decompress: Decodes the data of a single entry and consumes all of it.
+//   - options: The options of the codec, the same as for hfc.Unzip.
+//
+// Returns:
+//   - []string: the paths of the extracted files
+//   - error: if any issue occurs during the decompression process
+func ReadEntries(input io.Reader, outputPath string, algorithm utils.Algorithm, decompress utils.DecodeFunc, options utils.Options) ([]string, error) {
+	numOfFiles, err := format.ReadEntryCount(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if numOfFiles < 1 {
+		return nil, errors.New("no files to decompress")
+	}
+
+	extractor := utils.NewExtractor(outputPath, options)
+
+	for i := uint64(0); i < numOfFiles; i++ {
+		start := time.Now()
+
+		header, err := format.ReadEntryHeader(input)
+		if err != nil {
+			return nil, err
+		}
+
+		// entries that were not asked for are skipped without decoding
+		if !options.Selects(string(header.Name)) {
+			if err := skipData(input, header); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		output, err := extractor.Create(string(header.Name))
+		if err != nil {
+			return nil, err
+		}
+		output.SetModTime(utils.FromUnixNanos(header.ModTime))
+		output.SetMode(os.FileMode(header.Mode))
+
+		checksum := crc32.NewIEEE()
+		if err := decompress(input, io.MultiWriter(output, checksum), header.CompressedSize); err != nil {
+			output.Abort()
+			return nil, fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+		}
+
+		if actualCRC := checksum.Sum32(); actualCRC != header.CRC32 {
+			output.Abort()
+			return nil, &utils.ErrChecksumMismatch{Filename: string(header.Name), Expected: header.CRC32, Got: actualCRC}
+		}
+
+		if err := output.Close(); err != nil {
+			return nil, err
+		}
+
+		metrics.RecordEntry(options.Metrics, string(algorithm), metrics.OP_DECOMPRESS, int64(header.CompressedSize), output.BytesWritten(), time.Since(start))
+		options.Progress(string(header.Name), output.BytesWritten(), -1)
+	}
+
+	return extractor.Finish()
+}
+
+// List reads the number of files and the entry headers, skipping the entry data.
+//
+// Parameters:
+//   - input: The reader positioned at the number of files.
+//
+// Returns:
+//   - []utils.EntryInfo: the entries in archive order
+//   - error: if the archive is truncated
+func List(input io.Reader) ([]utils.EntryInfo, error) {
+	numOfFiles, err := format.ReadEntryCount(input)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []utils.EntryInfo{}
+	for i := uint64(0); i < numOfFiles; i++ {
+		header, err := format.ReadEntryHeader(input)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := skipData(input, header); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, utils.EntryInfo{
+			Name:           string(header.Name),
+			OriginalSize:   header.OriginalSize,
+			CompressedSize: header.CompressedSize,
+			ModTime:        utils.FromUnixNanos(header.ModTime),
+			Mode:           os.FileMode(header.Mode),
+			Checksum:       utils.FormatChecksum(header.CRC32),
+		})
+	}
+
+	return entries, nil
+}
+
+// skipData moves input past the data of the entry whose header was read last. A reader that
+// cannot seek is read and the data is discarded, see utils.SkipBytes.
+func skipData(input io.Reader, header format.EntryHeader) error {
+	if err := utils.SkipBytes(input, header.CompressedSize); err != nil {
+		return fmt.Errorf("failed to skip the data of %s: %w", header.Name, err)
+	}
+	return nil
+}
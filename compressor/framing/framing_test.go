@@ -0,0 +1,86 @@
+package framing
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+// copyData stores the data of an entry as it is.
+func copyData(input io.Reader, output io.Writer) (uint64, error) {
+	written, err := io.Copy(output, input)
+	return uint64(written), err
+}
+
+// readData reads the stored data of an entry.
+func readData(input io.Reader, output io.Writer, compressedSize uint64) error {
+	_, err := io.CopyN(output, input, int64(compressedSize))
+	return err
+}
+
+func TestEntries(t *testing.T) {
+	contents := map[string]string{"a.txt": "first file", "dir/b.txt": "second file", "c.txt": "third file"}
+	files := []utils.FileData{}
+	for _, name := range []string{"a.txt", "dir/b.txt", "c.txt"} {
+		files = append(files, utils.FileData{Name: name, Size: int64(len(contents[name])), Reader: strings.NewReader(contents[name]), Mode: 0644})
+	}
+
+	if err := WriteEntries(files, &bytes.Buffer{}, utils.STORE, copyData, utils.NewOptions()); err == nil || !strings.Contains(err.Error(), "must support seeking") {
+		t.Fatalf("expected an output that cannot seek to fail, got %v", err)
+	}
+
+	archive, err := os.Create(filepath.Join(t.TempDir(), "archive"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	if err := WriteEntries(files, archive, utils.STORE, copyData, utils.NewOptions()); err != nil {
+		t.Fatalf("failed to write the entries: %v", err)
+	}
+	data, err := os.ReadFile(archive.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := List(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(entries) != len(files) {
+		t.Fatalf("expected %d entries, got %d", len(files), len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Name != files[i].Name || entry.OriginalSize != uint64(len(contents[entry.Name])) || entry.CompressedSize != entry.OriginalSize {
+			t.Fatalf("unexpected entry %+v", entry)
+		}
+	}
+
+	// a reader that cannot seek skips the entries that were not asked for by reading them
+	outputDir := t.TempDir()
+	paths, err := ReadEntries(struct{ io.Reader }{bytes.NewReader(data)}, outputDir, utils.STORE, readData, utils.NewOptions(utils.WithEntries([]string{"dir/b.txt"})))
+	if err != nil {
+		t.Fatalf("failed to read the entries: %v", err)
+	}
+	if len(paths) != 1 {
+		t.Fatalf("expected only dir/b.txt, got %v", paths)
+	}
+	if extracted, err := os.ReadFile(filepath.Join(outputDir, "dir", "b.txt")); err != nil || string(extracted) != contents["dir/b.txt"] {
+		t.Fatalf("unexpected content %q, %v", extracted, err)
+	}
+
+	// the checksum of every entry is compared
+	damaged := bytes.Clone(data)
+	damaged[len(damaged)-1] ^= 1
+	if _, err := ReadEntries(bytes.NewReader(damaged), t.TempDir(), utils.STORE, readData, utils.NewOptions()); err == nil {
+		t.Fatal("expected a damaged entry to fail")
+	}
+	// the data of the last entry is skipped with Seek, a cut header fails
+	if _, err := List(bytes.NewReader(data[:20])); err == nil {
+		t.Fatal("expected a truncated archive to fail")
+	}
+}
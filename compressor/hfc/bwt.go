@@ -0,0 +1,81 @@
+package hfc
+
+import (
+	"io"
+
+	"file-compressor/compressor/bwt"
+	"file-compressor/metrics"
+	"file-compressor/utils"
+)
+
+// ZipBWT compresses multiple files like Zip, but the data of every file is passed through the
+// Burrows-Wheeler transform and move-to-front coding first, see the bwt package. Text and other
+// data with repeated contexts turns into many small values that Huffman coding compresses
+// better. The primary index of every transformed block is stored in front of the block, the
+// entry headers and the checksums are the same as for Zip and describe the original data.
+//
+// Parameters:
+//   - files: A slice of utils.FileData representing the files to be compressed.
+//   - output: An io.Writer where the compressed data will be written, it must implement io.Seeker.
+//   - opts: Optional settings such as utils.WithMetrics.
+//
+// Returns:
+//   - error: An error if any step in the compression process fails.
+func ZipBWT(files []utils.FileData, output io.Writer, opts ...utils.Option) error {
+	options := utils.NewOptions(opts...)
+
+	if err := zipFiles(files, output, options, utils.BWT); err != nil {
+		metrics.RecordError(options.Metrics, string(utils.BWT), metrics.OP_COMPRESS, err)
+		return err
+	}
+
+	return nil
+}
+
+// UnzipBWT decompresses an archive written by ZipBWT, like Unzip does for Zip.
+//
+// Parameters:
+//   - input: An io.Reader from which the compressed data is read.
+//   - outputPath: A string specifying the directory where the decompressed files will be written.
+//   - opts: Optional settings, the same as for Unzip.
+//
+// Returns:
+//   - A slice of strings containing the paths of the decompressed files.
+//   - An error if any issue occurs during the decompression process.
+func UnzipBWT(input io.Reader, outputPath string, opts ...utils.Option) ([]string, error) {
+	options := utils.NewOptions(opts...)
+
+	filePaths, err := unzipFiles(input, outputPath, options, utils.BWT)
+	if err != nil {
+		metrics.RecordError(options.Metrics, string(utils.BWT), metrics.OP_DECOMPRESS, err)
+		return nil, err
+	}
+
+	return filePaths, nil
+}
+
+// encodeData returns the data of an entry as it is Huffman coded for algorithm: transformed by
+// a bwt.Encoder for utils.BWT, unchanged otherwise.
+func encodeData(algorithm utils.Algorithm, input io.Reader) io.Reader {
+	if algorithm == utils.BWT {
+		return bwt.NewEncoder(input)
+	}
+	return input
+}
+
+// decodeData returns the writer the Huffman decoded data of an entry is written to, which
+// reverses encodeData and passes the original data on to output.
+func decodeData(algorithm utils.Algorithm, output io.Writer) io.WriteCloser {
+	if algorithm == utils.BWT {
+		return bwt.NewDecoder(output)
+	}
+	return nopWriteCloser{output}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
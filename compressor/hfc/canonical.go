@@ -0,0 +1,141 @@
+package hfc
+
+import (
+	"fmt"
+	"sort"
+)
+
+// MAX_TABLE_BITS is the length of the longest code a CanonicalDecoder resolves in a single
+// table lookup, its table has 1<<MAX_TABLE_BITS entries at most.
+const MAX_TABLE_BITS = 15
+
+// CanonicalCodes generates the canonical Huffman codes of the given byte frequencies, see
+// GetHuffmanCodes. Symbols without occurrences get no code.
+//
+// Parameters:
+//   - freq: The number of occurrences of every byte.
+//
+// Returns:
+//   - map[rune]string: the canonical code of every symbol that occurs
+//   - error: if a symbol is not a byte, a frequency is negative, or nothing occurs
+func CanonicalCodes(freq map[rune]int) (map[rune]string, error) {
+	table := FrequencyTable{}
+	for char, count := range freq {
+		if char < 0 || char > 255 {
+			return nil, fmt.Errorf("symbol %d is not a byte", char)
+		}
+		if count < 0 {
+			return nil, fmt.Errorf("symbol %d has a negative frequency: %d", char, count)
+		}
+		table[char] = uint64(count)
+	}
+	return GetHuffmanCodes(&table)
+}
+
+// tableEntry is what the next bits of the data start with: a symbol and the length of its
+// code, or a code longer than the table resolves. Bits that start no code have neither.
+type tableEntry struct {
+	symbol byte
+	length uint8
+	long   bool
+}
+
+// longCode is a code longer than the table of a CanonicalDecoder resolves.
+type longCode struct {
+	code   string
+	symbol byte
+}
+
+// CanonicalDecoder decodes Huffman codes without walking a tree. The first bits of the data
+// index a table of the symbol and the length of the code they start with, the table is as
+// wide as the longest code but at most MAX_TABLE_BITS bits. The few longer codes are looked up
+// in a sorted list a bit at a time. Canonical codes of the same length are consecutive numbers,
+// but the codes of archives older than format.VERSION_3 are decoded the same way.
+type CanonicalDecoder struct {
+	bits      uint8
+	table     []tableEntry
+	long      []longCode
+	maxLength int
+}
+
+// NewCanonicalDecoder builds the decoder of codes. Runes above 255 never occur in the data and
+// are ignored, like empty codes.
+//
+// Parameters:
+//   - codes: A map where keys are runes and values are their Huffman codes.
+//
+// Returns:
+//   - *CanonicalDecoder: the decoder of the codes
+func NewCanonicalDecoder(codes map[rune]string) *CanonicalDecoder {
+	decoder := &CanonicalDecoder{}
+	for char, code := range codes {
+		if char >= 0 && char <= 255 {
+			decoder.maxLength = max(decoder.maxLength, len(code))
+		}
+	}
+	decoder.bits = uint8(min(decoder.maxLength, MAX_TABLE_BITS))
+	decoder.table = make([]tableEntry, 1<<decoder.bits)
+
+	for char, code := range codes {
+		if char < 0 || char > 255 || code == "" {
+			continue
+		}
+		if len(code) > int(decoder.bits) {
+			decoder.long = append(decoder.long, longCode{code: code, symbol: byte(char)})
+			// the table only knows that a longer code starts with these bits
+			decoder.table[codeBits(code[:decoder.bits])].long = true
+			continue
+		}
+		// every index starting with the code decodes to its symbol
+		shift := decoder.bits - uint8(len(code))
+		start := codeBits(code) << shift
+		for i := start; i < start+1<<shift; i++ {
+			decoder.table[i] = tableEntry{symbol: byte(char), length: uint8(len(code))}
+		}
+	}
+
+	// codes that start with the same bits are next to each other, ordered by their next bit
+	sort.Slice(decoder.long, func(i, j int) bool { return decoder.long[i].code < decoder.long[j].code })
+	return decoder
+}
+
+// codeBits packs a code of at most MAX_TABLE_BITS bits into an integer.
+func codeBits(code string) uint32 {
+	bits := uint32(0)
+	for _, bit := range code {
+		bits <<= 1
+		if bit == '1' {
+			bits |= 1
+		}
+	}
+	return bits
+}
+
+// longMatch is the range of long codes that start with the bits of an unfinished code.
+type longMatch struct {
+	low, high int // the codes in long[low:high] start with the depth bits read so far
+	depth     int
+}
+
+// next narrows the match to the codes that continue with bit. It returns the symbol and true
+// when the bits read so far are a whole code, and errInvalidCode when no code starts with them.
+func (d *CanonicalDecoder) next(match *longMatch, bit uint64) (byte, bool, error) {
+	codes := d.long[match.low:match.high]
+	// the codes with a 0 at depth come before the ones with a 1
+	split := sort.Search(len(codes), func(i int) bool { return codes[i].code[match.depth] == '1' })
+	if bit == 0 {
+		match.high = match.low + split
+	} else {
+		match.low += split
+	}
+	match.depth++
+
+	switch {
+	case match.low == match.high:
+		return 0, false, errInvalidCode
+	case len(d.long[match.low].code) == match.depth:
+		// no other code starts with a whole code
+		return d.long[match.low].symbol, true, nil
+	}
+	return 0, false, nil
+}
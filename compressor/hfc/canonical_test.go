@@ -0,0 +1,181 @@
+package hfc
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"file-compressor/format"
+)
+
+// referenceDecode decodes the data written by compressData a bit at a time, walking the tree of
+// the codes like the decoder did before the CanonicalDecoder.
+func referenceDecode(data []byte, codes map[rune]string) []byte {
+	root := rebuildHuffmanTree(codes)
+	output := []byte{}
+	lastByte, numOfBits := data[len(data)-2], data[len(data)-1]
+	data = append(data[:len(data)-2:len(data)-2], lastByte)
+
+	node := root
+	for i, b := range data {
+		bits := 8
+		if i == len(data)-1 {
+			bits = int(numOfBits)
+		}
+		for bit := 0; bit < bits; bit++ {
+			if b>>(7-bit)&1 == 0 {
+				node = node.left
+			} else {
+				node = node.right
+			}
+			if node.left == nil && node.right == nil {
+				output = append(output, byte(node.char))
+				node = root
+			}
+		}
+	}
+	return output
+}
+
+func TestCanonicalCodes(t *testing.T) {
+	codes, err := CanonicalCodes(map[rune]int{'a': 5, 'b': 2, 'c': 1, 'd': 1})
+	if err != nil {
+		t.Fatalf("failed to build the codes: %v", err)
+	}
+	want := map[rune]string{'a': "0", 'b': "10", 'c': "110", 'd': "111"}
+	for char, code := range want {
+		if codes[char] != code {
+			t.Fatalf("expected %q for %c, got %q", code, char, codes[char])
+		}
+	}
+
+	for name, freq := range map[string]map[rune]int{
+		"not a byte":         {'a': 1, 'ā': 1},
+		"negative frequency": {'a': 1, 'b': -1},
+		"nothing occurs":     {'a': 0},
+	} {
+		if _, err := CanonicalCodes(freq); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCanonicalDecoder(t *testing.T) {
+	// Fibonacci frequencies build codes far longer than MAX_TABLE_BITS
+	deep := map[rune]int{}
+	a, b := 1, 1
+	for i := 0; i < 40; i++ {
+		deep[rune(i)] = a
+		a, b = b, a+b
+	}
+	deepCodes, err := CanonicalCodes(deep)
+	if err != nil {
+		t.Fatalf("failed to build the codes: %v", err)
+	}
+
+	random := rand.New(rand.NewSource(3))
+	deepData := make([]byte, 300000)
+	for i := range deepData {
+		deepData[i] = byte(random.Intn(40))
+	}
+	text := benchmarkInput(300000)
+	textCodes, err := CanonicalCodes(byteFrequencies(text))
+	if err != nil {
+		t.Fatalf("failed to build the codes: %v", err)
+	}
+
+	tests := map[string]struct {
+		codes map[rune]string
+		data  []byte
+	}{
+		"text": {codes: textCodes, data: text},
+		"deep": {codes: deepCodes, data: deepData},
+		// archives older than format.VERSION_3 store codes that are not canonical
+		"not canonical": {codes: map[rune]string{'a': "1", 'b': "011", 'c': "010", 'd': "001", 'e': "0001", 'f': "0000"}, data: []byte(strings.Repeat("deadbeef cafe ", 1000)[:13000])},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			data := bytes.Map(func(r rune) rune {
+				if _, ok := test.codes[r]; ok {
+					return r
+				}
+				return 'a'
+			}, test.data)
+			compressed := referenceEncode(data, test.codes)
+
+			decoded := &bytes.Buffer{}
+			if err := decompressData(bytes.NewReader(compressed), decoded, NewCanonicalDecoder(test.codes), uint64(len(compressed))); err != nil {
+				t.Fatalf("failed to decompress data: %v", err)
+			}
+			if !bytes.Equal(decoded.Bytes(), referenceDecode(compressed, test.codes)) {
+				t.Fatal("the decoder does not match the tree")
+			}
+			if !bytes.Equal(decoded.Bytes(), data) {
+				t.Fatal("decompressed data does not match the input")
+			}
+		})
+	}
+
+	if decoder := NewCanonicalDecoder(deepCodes); decoder.bits != MAX_TABLE_BITS || len(decoder.long) == 0 {
+		t.Fatalf("expected a %d bit table and long codes, got %d bits and %d long codes", MAX_TABLE_BITS, decoder.bits, len(decoder.long))
+	}
+}
+
+func TestCanonicalDecoderLongCodeCutByTheEnd(t *testing.T) {
+	codes, err := format.CanonicalCodes(map[rune]int{'a': 1, 'b': 2, 'c': 20, 'd': 20})
+	if err != nil {
+		t.Fatalf("failed to build the codes: %v", err)
+	}
+	compressed := referenceEncode([]byte("abc"), codes)
+	// drop the last byte of c, the bits used in the byte before it are all of them
+	compressed = append(compressed[:len(compressed)-3], compressed[len(compressed)-3], 8)
+
+	err = decompressData(bytes.NewReader(compressed), io.Discard, NewCanonicalDecoder(codes), uint64(len(compressed)))
+	if err == nil || !strings.Contains(err.Error(), "ends in the middle of a code") {
+		t.Fatalf("expected the code to be cut, got %v", err)
+	}
+}
+
+func byteFrequencies(data []byte) map[rune]int {
+	freq := map[rune]int{}
+	for _, b := range data {
+		freq[rune(b)]++
+	}
+	return freq
+}
+
+// BenchmarkCanonicalDecoder compares the table of the CanonicalDecoder with walking the tree of
+// the codes a bit at a time, on 10 MB of text.
+func BenchmarkCanonicalDecoder(b *testing.B) {
+	data := benchmarkInput(10 << 20)
+	codes, err := CanonicalCodes(byteFrequencies(data))
+	if err != nil {
+		b.Fatal(err)
+	}
+	compressed := &bytes.Buffer{}
+	compressedLen, err := compressData(bytes.NewReader(data), compressed, codes)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("table", func(b *testing.B) {
+		decoder := NewCanonicalDecoder(codes)
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			if err := decompressData(bytes.NewReader(compressed.Bytes()), io.Discard, decoder, compressedLen); err != nil {
+				b.Fatal(err)
+			}
+		}
+		reportNsPerByte(b, len(data))
+	})
+	b.Run("tree", func(b *testing.B) {
+		b.SetBytes(int64(len(data)))
+		for i := 0; i < b.N; i++ {
+			referenceDecode(compressed.Bytes(), codes)
+		}
+		reportNsPerByte(b, len(data))
+	})
+}
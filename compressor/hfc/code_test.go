@@ -3,8 +3,14 @@ package hfc
 import (
 	"bytes"
 	"file-compressor/constants"
+	"file-compressor/format"
+	"file-compressor/utils"
+	"fmt"
 	"io"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -17,8 +23,8 @@ func PrintError(t *testing.T, msg string, err error) {
 func TestSimpleString(t *testing.T) {
 	data := []byte("aaaabbbbccccdddd")
 	reader := bytes.NewBuffer(data)
-	freq := make(map[rune]int)
-	if err := getFrequencyMap(reader, &freq); err != nil {
+	freq := FrequencyTable{}
+	if err := getFrequencyTable(reader, &freq); err != nil {
 		PrintError(t, constants.FAILED_GET_FREQ_MAP, err)
 	}
 
@@ -55,8 +61,8 @@ func TestSimpleString(t *testing.T) {
 func TestUniqueCharacters(t *testing.T) {
 	data := []byte("abcdefg")
 	reader := bytes.NewBuffer(data)
-	freq := make(map[rune]int)
-	if err := getFrequencyMap(reader, &freq); err != nil {
+	freq := FrequencyTable{}
+	if err := getFrequencyTable(reader, &freq); err != nil {
 		PrintError(t, constants.FAILED_GET_FREQ_MAP, err)
 	}
 
@@ -93,8 +99,8 @@ func TestUniqueCharacters(t *testing.T) {
 func TestSingleCharacterRepeated(t *testing.T) {
 	data := []byte("aaaaaaa")
 	reader := bytes.NewBuffer(data)
-	freq := make(map[rune]int)
-	if err := getFrequencyMap(reader, &freq); err != nil {
+	freq := FrequencyTable{}
+	if err := getFrequencyTable(reader, &freq); err != nil {
 		PrintError(t, constants.FAILED_GET_FREQ_MAP, err)
 	}
 
@@ -131,8 +137,8 @@ func TestSingleCharacterRepeated(t *testing.T) {
 func TestLongText(t *testing.T) {
 	data := []byte("this is a longer text to test the huffman encoding system with a more extensive input")
 	reader := bytes.NewBuffer(data)
-	freq := make(map[rune]int)
-	if err := getFrequencyMap(reader, &freq); err != nil {
+	freq := FrequencyTable{}
+	if err := getFrequencyTable(reader, &freq); err != nil {
 		PrintError(t, constants.FAILED_GET_FREQ_MAP, err)
 	}
 
@@ -169,8 +175,8 @@ func TestLongText(t *testing.T) {
 func TestSpecialCharacters(t *testing.T) {
 	data := []byte("hello, world!😠🤲🙈😁😒🥺😀\nThis is a test!")
 	reader := bytes.NewBuffer(data)
-	freq := make(map[rune]int)
-	if err := getFrequencyMap(reader, &freq); err != nil {
+	freq := FrequencyTable{}
+	if err := getFrequencyTable(reader, &freq); err != nil {
 		PrintError(t, constants.FAILED_GET_FREQ_MAP, err)
 	}
 
@@ -211,8 +217,8 @@ func TestLargeFile(t *testing.T) {
 	}
 	defer file.Close()
 
-	freq := make(map[rune]int)
-	if err := getFrequencyMap(file, &freq); err != nil {
+	freq := FrequencyTable{}
+	if err := getFrequencyTable(file, &freq); err != nil {
 		PrintError(t, constants.FAILED_GET_FREQ_MAP, err)
 	}
 
@@ -261,3 +267,376 @@ func compareHuffmanCodes(t *testing.T, codes1, codes2 map[rune]string) {
 		}
 	}
 }
+
+func TestSingleSymbolRoundTrip(t *testing.T) {
+	inputs := map[string][]byte{
+		"zeros":       make([]byte, 3*constants.BUFFER_SIZE+5),
+		"single byte": {'x'},
+	}
+
+	for name, data := range inputs {
+		t.Run(name, func(t *testing.T) {
+			freq := FrequencyTable{}
+			if err := getFrequencyTable(bytes.NewReader(data), &freq); err != nil {
+				PrintError(t, constants.FAILED_GET_FREQ_MAP, err)
+			}
+
+			codes, err := GetHuffmanCodes(&freq)
+			if err != nil {
+				PrintError(t, constants.FAILED_BUILD_HUFFMAN_CODES, err)
+			}
+			for char, code := range codes {
+				if code != "0" {
+					t.Fatalf("expected the one bit code for %q, got %q", char, code)
+				}
+			}
+
+			compressed := bytes.NewBuffer([]byte{})
+			compressedLen, err := compressData(bytes.NewReader(data), compressed, codes)
+			if err != nil {
+				t.Fatalf("failed to compress data: %v", err)
+			}
+
+			decompressed := bytes.NewBuffer([]byte{})
+			if err := decompressData(compressed, decompressed, NewCanonicalDecoder(codes), compressedLen); err != nil {
+				t.Fatalf("failed to decompress data: %v", err)
+			}
+			if !bytes.Equal(decompressed.Bytes(), data) {
+				t.Fatalf("expected %d bytes back, got %d", len(data), decompressed.Len())
+			}
+		})
+	}
+}
+
+func TestSingleCharacterFile(t *testing.T) {
+	// the name uses the same character, so the whole archive has a one symbol alphabet
+	content := "aaaaaaa"
+	files := []utils.FileData{{Name: "a", Size: int64(len(content)), Reader: bytes.NewReader([]byte(content))}}
+
+	archive, err := os.Create(filepath.Join(t.TempDir(), "archive.sq"))
+	if err != nil {
+		PrintError(t, constants.FILE_CREATE_ERROR, err)
+	}
+	defer archive.Close()
+
+	if err := Zip(files, archive); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	outputDir := t.TempDir()
+	if _, err := Unzip(archive, outputDir); err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "a"))
+	if err != nil {
+		PrintError(t, constants.FILE_READ_ERROR, err)
+	}
+	if string(data) != content {
+		t.Fatalf("expected %q, got %q", content, data)
+	}
+}
+
+func TestDecompressLeafRoot(t *testing.T) {
+	// the codes written for a single symbol before it got a one bit code
+	codes := map[rune]string{'a': ""}
+	if err := decompressData(bytes.NewReader([]byte{0, 0}), io.Discard, NewCanonicalDecoder(codes), 2); err == nil {
+		t.Fatal("expected an error for a tree without branches")
+	}
+}
+
+// benchmarkInput returns size bytes of text-like data with a skewed byte distribution.
+func benchmarkInput(size int) []byte {
+	random := rand.New(rand.NewSource(1))
+	words := strings.Fields("the quick brown fox jumps over the lazy dog while 42 zebras QUIETLY eat {json: [1, 2, 3]}")
+	data := make([]byte, 0, size+100)
+	for len(data) < size {
+		data = append(data, words[random.Intn(len(words))]...)
+		data = append(data, " \n"[random.Intn(8)/7])
+	}
+	return data[:size]
+}
+
+// reportNsPerByte adds the time per input byte to the results of b.
+func reportNsPerByte(b *testing.B, size int) {
+	b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/float64(size), "ns/byte")
+}
+
+func BenchmarkFrequencyTable(b *testing.B) {
+	data := benchmarkInput(8 << 20)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		freq := FrequencyTable{}
+		if err := getFrequencyTable(bytes.NewReader(data), &freq); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportNsPerByte(b, len(data))
+}
+
+func BenchmarkCompressData(b *testing.B) {
+	data := benchmarkInput(8 << 20)
+	freq := FrequencyTable{}
+	if err := getFrequencyTable(bytes.NewReader(data), &freq); err != nil {
+		b.Fatal(err)
+	}
+	codes, err := GetHuffmanCodes(&freq)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := compressData(bytes.NewReader(data), io.Discard, codes); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportNsPerByte(b, len(data))
+}
+
+// BenchmarkZipManySmallFiles compresses 10,000 files of one byte, where the allocations per
+// file outweigh the coding.
+func BenchmarkZipManySmallFiles(b *testing.B) {
+	files := make([]utils.FileData, 10_000)
+	for i := range files {
+		files[i] = utils.FileData{Name: fmt.Sprintf("dir/%05d.txt", i), Size: 1, Reader: bytes.NewReader([]byte{byte('a' + i%26)})}
+	}
+	output, err := os.Create(filepath.Join(b.TempDir(), "archive.sq"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer output.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, file := range files {
+			file.Reader.(io.Seeker).Seek(0, io.SeekStart)
+		}
+		output.Truncate(0)
+		output.Seek(0, io.SeekStart)
+		if err := Zip(files, output); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// referenceEncode writes the codes of data one bit at a time, the way compressData did before
+// the codes were packed, so the packed encoder can be checked against it.
+func referenceEncode(data []byte, codes map[rune]string) []byte {
+	output := []byte{}
+	var current byte
+	var count uint8
+	for _, b := range data {
+		for _, bit := range codes[rune(b)] {
+			current = current<<1 | byte(bit-'0')
+			count++
+			if count == 8 {
+				output = append(output, current)
+				current, count = 0, 0
+			}
+		}
+	}
+	if count > 0 {
+		current <<= 8 - count
+	}
+	return append(output, current, count)
+}
+
+func TestPackedCodesMatchReference(t *testing.T) {
+	// Fibonacci frequencies build the deepest possible tree, with codes longer than
+	// MAX_PACKED_CODE_LEN that are written a bit at a time
+	deep := FrequencyTable{}
+	a, b := uint64(1), uint64(1)
+	for i := 0; i < 80; i++ {
+		deep[i] = a
+		a, b = b, a+b
+	}
+
+	random := rand.New(rand.NewSource(7))
+	tests := map[string]struct {
+		freq *FrequencyTable
+		data []byte
+	}{
+		"text": {data: benchmarkInput(100000)},
+		"deep": {freq: &deep, data: func() []byte {
+			data := make([]byte, 5000)
+			for i := range data {
+				data[i] = byte(random.Intn(80))
+			}
+			return data
+		}()},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			freq := test.freq
+			if freq == nil {
+				freq = &FrequencyTable{}
+				if err := getFrequencyTable(bytes.NewReader(test.data), freq); err != nil {
+					PrintError(t, constants.FAILED_GET_FREQ_MAP, err)
+				}
+			}
+			codes, err := GetHuffmanCodes(freq)
+			if err != nil {
+				PrintError(t, constants.FAILED_BUILD_HUFFMAN_CODES, err)
+			}
+			if name == "deep" && len(codes[0]) <= MAX_PACKED_CODE_LEN {
+				t.Fatalf("expected a code longer than %d bits, got %d", MAX_PACKED_CODE_LEN, len(codes[0]))
+			}
+
+			compressed := &bytes.Buffer{}
+			compressedLen, err := compressData(bytes.NewReader(test.data), compressed, codes)
+			if err != nil {
+				t.Fatalf("failed to compress data: %v", err)
+			}
+			if !bytes.Equal(referenceEncode(test.data, codes), compressed.Bytes()) {
+				t.Fatal("the packed codes write different bits than the reference encoder")
+			}
+			if compressedLen != uint64(compressed.Len()) {
+				t.Fatalf("expected a length of %d, got %d", compressed.Len(), compressedLen)
+			}
+
+			decompressed := &bytes.Buffer{}
+			if err := decompressData(compressed, decompressed, NewCanonicalDecoder(codes), compressedLen); err != nil {
+				t.Fatalf("failed to decompress data: %v", err)
+			}
+			if !bytes.Equal(test.data, decompressed.Bytes()) {
+				t.Fatal("decompressed data does not match the input")
+			}
+		})
+	}
+}
+
+func BenchmarkDecompressData(b *testing.B) {
+	data := benchmarkInput(50 << 20)
+	freq := FrequencyTable{}
+	if err := getFrequencyTable(bytes.NewReader(data), &freq); err != nil {
+		b.Fatal(err)
+	}
+	codes, err := GetHuffmanCodes(&freq)
+	if err != nil {
+		b.Fatal(err)
+	}
+	compressed := &bytes.Buffer{}
+	compressedLen, err := compressData(bytes.NewReader(data), compressed, codes)
+	if err != nil {
+		b.Fatal(err)
+	}
+	table := NewCanonicalDecoder(codes)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := decompressData(bytes.NewReader(compressed.Bytes()), io.Discard, table, compressedLen); err != nil {
+			b.Fatal(err)
+		}
+	}
+	reportNsPerByte(b, len(data))
+}
+
+func TestDecompressInvalidCodes(t *testing.T) {
+	// 'b' is 10, so 11 leads out of the tree
+	codes := map[rune]string{'a': "0", 'b': "10"}
+	tests := map[string]struct {
+		data    []byte
+		wantErr string
+	}{
+		"invalid code in the table":     {data: []byte{0xff, 0xff, 0, 0}, wantErr: errInvalidCode.Error()},
+		"invalid code in the last bits": {data: []byte{0b11000000, 2}, wantErr: errInvalidCode.Error()},
+		"code cut by the end":           {data: []byte{0b00100000, 3}, wantErr: "ends in the middle of a code"},
+		"bit count above 8":             {data: []byte{0, 9}, wantErr: "invalid bit count"},
+		"too short":                     {data: []byte{0}, wantErr: "too short"},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := decompressData(bytes.NewReader(test.data), io.Discard, NewCanonicalDecoder(codes), uint64(len(test.data)))
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+
+	// 0 10 0 decodes to aba
+	decoded := &bytes.Buffer{}
+	if err := decompressData(bytes.NewReader([]byte{0b01000000, 4}), decoded, NewCanonicalDecoder(codes), 2); err != nil {
+		t.Fatalf("failed to decompress data: %v", err)
+	}
+	if decoded.String() != "aba" {
+		t.Fatalf("expected %q, got %q", "aba", decoded.String())
+	}
+}
+
+func TestCanonicalHeaderIsSmaller(t *testing.T) {
+	data, err := os.ReadFile("example.txt")
+	if err != nil {
+		t.Fatalf("failed to read the text: %v", err)
+	}
+	freq := FrequencyTable{}
+	if err := getFrequencyTable(bytes.NewReader(data), &freq); err != nil {
+		PrintError(t, constants.FAILED_GET_FREQ_MAP, err)
+	}
+	codes, err := GetHuffmanCodes(&freq)
+	if err != nil {
+		PrintError(t, constants.FAILED_BUILD_HUFFMAN_CODES, err)
+	}
+
+	var canonical, explicit bytes.Buffer
+	if err := WriteHuffmanCodes(&canonical, codes); err != nil {
+		PrintError(t, constants.FAILED_WRITE_HUFFMAN_CODES, err)
+	}
+	if err := format.WriteCodeTable(&explicit, codes); err != nil {
+		PrintError(t, constants.FAILED_WRITE_HUFFMAN_CODES, err)
+	}
+	if canonical.Len() >= explicit.Len() {
+		t.Fatalf("expected the code lengths to be smaller than the %d byte code table, got %d bytes", explicit.Len(), canonical.Len())
+	}
+	t.Logf("%d symbols: %d bytes of code lengths instead of %d", len(codes), canonical.Len(), explicit.Len())
+}
+
+func TestBothHeaderVersionsRoundTrip(t *testing.T) {
+	content := []byte("version 2 archives store every code, version 3 only the lengths")
+	files := []utils.FileData{{Name: "codes.txt", Size: int64(len(content)), Reader: bytes.NewReader(content)}}
+
+	var archive bytes.Buffer
+	if err := ZipStream(files, &archive); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+
+	// rewrite the payload without the links of version 4, and with the code table of version 2
+	reader := bytes.NewReader(archive.Bytes())
+	codes, err := ReadHuffmanCodes(reader)
+	if err != nil {
+		PrintError(t, constants.FAILED_READ_HUFFMAN_CODES, err)
+	}
+	if _, err := format.ReadLinkTable(reader, 1); err != nil {
+		t.Fatalf("failed to read the links: %v", err)
+	}
+	var version2, version3 bytes.Buffer
+	if err := format.WriteCodeTable(&version2, codes); err != nil {
+		PrintError(t, constants.FAILED_WRITE_HUFFMAN_CODES, err)
+	}
+	if err := WriteHuffmanCodes(&version3, codes); err != nil {
+		PrintError(t, constants.FAILED_WRITE_HUFFMAN_CODES, err)
+	}
+	entries, _ := io.ReadAll(reader)
+	version2.Write(entries)
+	version3.Write(entries)
+
+	for version, payload := range map[uint16][]byte{format.VERSION_2: version2.Bytes(), format.VERSION_3: version3.Bytes(), format.VERSION_4: archive.Bytes()} {
+		outputDir := t.TempDir()
+		if _, err := UnzipStream(bytes.NewReader(payload), outputDir, utils.WithFormatVersion(version)); err != nil {
+			t.Fatalf("version %d: failed to unzip: %v", version, err)
+		}
+		extracted, err := os.ReadFile(filepath.Join(outputDir, "codes.txt"))
+		if err != nil {
+			t.Fatalf("version %d: failed to read the file: %v", version, err)
+		}
+		if !bytes.Equal(extracted, content) {
+			t.Fatalf("version %d: expected %q, got %q", version, content, extracted)
+		}
+	}
+}
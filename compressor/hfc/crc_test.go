@@ -0,0 +1,72 @@
+package hfc
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+// buildTwoSymbolArchive zips a single entry that only uses 'a' and 'b'. Both get a one bit
+// code, so every flipped data bit still decodes, only to different content.
+func buildTwoSymbolArchive(t *testing.T) []byte {
+	content := strings.Repeat("ab", 64)
+	files := []utils.FileData{{Name: "ab", Size: int64(len(content)), Reader: bytes.NewReader([]byte(content))}}
+
+	archivePath := filepath.Join(t.TempDir(), "archive")
+	output, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	if err := Zip(files, output); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+	output.Close()
+
+	archive, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+	return archive
+}
+
+func TestUnzipChecksumMismatch(t *testing.T) {
+	archive := buildTwoSymbolArchive(t)
+
+	if _, err := Unzip(bytes.NewReader(archive), t.TempDir()); err != nil {
+		t.Fatalf("the intact archive should extract: %v", err)
+	}
+
+	// a byte in the middle of the data, before the last byte and its bit count
+	archive[len(archive)-4] ^= 0xFF
+
+	_, err := Unzip(bytes.NewReader(archive), t.TempDir())
+	if err == nil {
+		t.Fatal("a flipped data byte should be reported")
+	}
+	if !strings.Contains(err.Error(), "checksum mismatch in ab") || !strings.Contains(err.Error(), "expected crc32") {
+		t.Fatalf("expected a checksum mismatch naming the entry, got %v", err)
+	}
+
+	var mismatch *utils.ErrChecksumMismatch
+	if !errors.As(err, &mismatch) || mismatch.Filename != "ab" || mismatch.Expected == mismatch.Got {
+		t.Fatalf("expected *utils.ErrChecksumMismatch for ab, got %#v", err)
+	}
+}
+
+func TestVerifyChecksumMismatch(t *testing.T) {
+	archive := buildTwoSymbolArchive(t)
+	archive[len(archive)-4] ^= 0xFF
+
+	report := Verify(bytes.NewReader(archive))
+	if report.Status != utils.VERIFY_DAMAGED || len(report.Failures) != 1 {
+		t.Fatalf("expected one damaged entry, got %s: %s", report.Status, report.Table())
+	}
+	if failure := report.Failures[0]; failure.Kind != utils.FAILURE_CRC_MISMATCH || failure.Name != "ab" {
+		t.Fatalf("expected a crc mismatch for ab, got %+v", failure)
+	}
+}
@@ -0,0 +1,103 @@
+package hfc
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+var emptyTestContents = map[string]string{"empty.txt": "", "full.txt": "not empty at all", "dir/also-empty.txt": ""}
+
+func emptyTestFiles() []utils.FileData {
+	files := []utils.FileData{}
+	for name, content := range emptyTestContents {
+		files = append(files, utils.FileData{Name: name, Size: int64(len(content)), Reader: bytes.NewReader([]byte(content))})
+	}
+	return files
+}
+
+func checkEmptyTestOutput(t *testing.T, outputDir string, paths []string) {
+	t.Helper()
+	if len(paths) != len(emptyTestContents) {
+		t.Fatalf("expected %d files, got %d", len(emptyTestContents), len(paths))
+	}
+	for name, content := range emptyTestContents {
+		data, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if string(data) != content {
+			t.Fatalf("%s: expected %q, got %q", name, content, data)
+		}
+	}
+}
+
+func TestZipEmptyFiles(t *testing.T) {
+	archive, err := os.Create(filepath.Join(t.TempDir(), "archive.sq"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	if err := Zip(emptyTestFiles(), archive); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+
+	if _, err := archive.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := List(archive)
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.OriginalSize == 0 && entry.CompressedSize != 0 {
+			t.Fatalf("%s: empty entry stored with %d bytes of data", entry.Name, entry.CompressedSize)
+		}
+	}
+
+	if _, err := archive.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if report := Verify(archive); report.ExitCode() != 0 {
+		t.Fatalf("verification failed: %+v", report)
+	}
+
+	if _, err := archive.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	outputDir := t.TempDir()
+	paths, err := Unzip(archive, outputDir)
+	if err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+	checkEmptyTestOutput(t, outputDir, paths)
+}
+
+func TestZipStreamEmptyFiles(t *testing.T) {
+	var archive bytes.Buffer
+	if err := ZipStream(emptyTestFiles(), &archive); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+
+	outputDir := t.TempDir()
+	paths, err := UnzipStream(&archive, outputDir)
+	if err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+	checkEmptyTestOutput(t, outputDir, paths)
+}
+
+func TestCompressDataEmptyInput(t *testing.T) {
+	var output bytes.Buffer
+	length, err := compressData(bytes.NewReader(nil), &output, map[rune]string{'a': "0"})
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	if length != 0 || output.Len() != 0 {
+		t.Fatalf("expected no data for empty input, got %d bytes", output.Len())
+	}
+}
@@ -0,0 +1,53 @@
+package hfc
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+// zipSeed returns the archive Zip writes for the files, as compressed by TestFile.
+func zipSeed(f *testing.F, files []utils.FileData) []byte {
+	archive, err := os.CreateTemp(f.TempDir(), "seed")
+	if err != nil {
+		f.Fatalf("failed to create the seed: %v", err)
+	}
+	defer archive.Close()
+
+	if err := Zip(files, archive); err != nil {
+		f.Fatalf("failed to compress the seed: %v", err)
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		f.Fatal(err)
+	}
+	data, err := io.ReadAll(archive)
+	if err != nil {
+		f.Fatalf("failed to read the seed: %v", err)
+	}
+	return data
+}
+
+func FuzzUnzip(f *testing.F) {
+	example, err := os.ReadFile("input/example.txt")
+	if err != nil {
+		f.Fatalf("failed to read the input: %v", err)
+	}
+	f.Add(zipSeed(f, []utils.FileData{{Name: "input/example.txt", Size: int64(len(example)), Reader: bytes.NewReader(example)}}))
+	f.Add(zipSeed(f, []utils.FileData{
+		{Name: "a.txt", Size: 5, Reader: bytes.NewReader([]byte("hello"))},
+		{Name: "dir/empty.txt", Reader: bytes.NewReader(nil)},
+	}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// damaged archives must fail with an error, never panic
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("Unzip panicked on %d bytes: %v", len(data), r)
+			}
+		}()
+		Unzip(bytes.NewReader(data), t.TempDir())
+	})
+}
@@ -3,14 +3,26 @@ package hfc
 import (
 	"container/heap"
 	"errors"
+
+	"file-compressor/format"
 )
 
 // Node represents a node in the Huffman tree.
 type Node struct {
-	char  rune  // Character stored in the node
-	freq  int   // Frequency of the character
-	left  *Node // Left child node
-	right *Node // Right child node
+	char  rune   // Character stored in the node
+	freq  uint64 // Frequency of the character
+	left  *Node  // Left child node
+	right *Node  // Right child node
+}
+
+// FrequencyTable counts how often every byte value occurs, indexed by the byte.
+type FrequencyTable [256]uint64
+
+// Add adds the counts of other to the table.
+func (f *FrequencyTable) Add(other *FrequencyTable) {
+	for b, count := range other {
+		f[b] += count
+	}
 }
 
 // PriorityQueue implements heap.Interface and holds Nodes.
@@ -38,17 +50,17 @@ func (pq *PriorityQueue) Pop() interface{} {
 	return item
 }
 
-// buildHuffmanTree builds the Huffman tree from character frequencies.
-func buildHuffmanTree(freq *map[rune]int) (*Node, error) {
-	if len(*freq) == 0 {
-		return nil, errors.New("frequency map is empty")
+// buildHuffmanTree builds the Huffman tree from the byte frequencies, the bytes that do not
+// occur get no leaf.
+func buildHuffmanTree(freq *FrequencyTable) (*Node, error) {
+	pq := PriorityQueue{}
+	for b, f := range freq {
+		if f > 0 {
+			pq = append(pq, &Node{char: rune(b), freq: f})
+		}
 	}
-
-	pq := make(PriorityQueue, len(*freq))
-	i := 0
-	for char, f := range *freq {
-		pq[i] = &Node{char: char, freq: f}
-		i++
+	if len(pq) == 0 {
+		return nil, errors.New("frequency map is empty")
 	}
 
 	heap.Init(&pq)
@@ -65,17 +77,18 @@ func buildHuffmanTree(freq *map[rune]int) (*Node, error) {
 }
 
 
-// GetHuffmanCodes generates Huffman codes for the given frequency map of runes.
-// It builds a Huffman tree based on the frequencies and then traverses the tree
-// to generate the corresponding Huffman codes.
+// GetHuffmanCodes generates canonical Huffman codes for the given byte frequencies.
+// It builds a Huffman tree based on the frequencies and traverses the tree to get the length
+// of every code, then assigns the canonical codes of these lengths, so the archive only has to
+// store the lengths. When there is a single symbol its code is "0".
 //
 // Parameters:
-//   - freq: A pointer to a map where keys are runes and values are their frequencies.
+//   - freq: A pointer to the table of the frequency of every byte.
 //
 // Returns:
 //   - A map where keys are runes and values are their corresponding Huffman codes.
 //   - An error if there is an issue building the Huffman tree.
-func GetHuffmanCodes(freq *map[rune]int) (map[rune]string, error) {
+func GetHuffmanCodes(freq *FrequencyTable) (map[rune]string, error) {
 
 	codes := make(map[rune]string)
 
@@ -84,9 +97,19 @@ func GetHuffmanCodes(freq *map[rune]int) (map[rune]string, error) {
 		return nil, err
 	}
 
+	// a tree with a single leaf has no branches, its symbol still needs a bit per occurrence
+	if node.left == nil && node.right == nil {
+		codes[node.char] = "0"
+		return codes, nil
+	}
+
 	huffmanBuilder(node, "", &codes, freq)
 
-	return codes, nil
+	lengths := make(map[rune]int, len(codes))
+	for char, code := range codes {
+		lengths[char] = len(code)
+	}
+	return format.CanonicalCodes(lengths)
 }
 
 
@@ -97,12 +120,12 @@ func GetHuffmanCodes(freq *map[rune]int) (map[rune]string, error) {
 //   - node: A pointer to the current node in the Huffman tree.
 //   - prefix: The current binary prefix string representing the path taken to reach the node.
 //   - codes: A pointer to a map that stores the Huffman codes for each character.
-//   - frequency: A pointer to a map that stores the frequency of each character (not used in this function).
+//   - frequency: A pointer to the table of the frequency of each byte (not used in this function).
 //
 // If the current node is a leaf node (both left and right children are nil), the function assigns the current
 // prefix to the character stored in the node. Otherwise, it recursively traverses the left and right children,
 // appending '0' to the prefix for the left child and '1' for the right child.
-func huffmanBuilder(node *Node, prefix string, codes *map[rune]string, frequency *map[rune]int) {
+func huffmanBuilder(node *Node, prefix string, codes *map[rune]string, frequency *FrequencyTable) {
 	if node == nil {
 		return
 	}
@@ -113,36 +136,3 @@ func huffmanBuilder(node *Node, prefix string, codes *map[rune]string, frequency
 	huffmanBuilder(node.left, prefix+"0", codes, frequency)
 	huffmanBuilder(node.right, prefix+"1", codes, frequency)
 }
-
-// rebuildHuffmanTree reconstructs a Huffman tree from a given map of runes to their corresponding binary codes.
-// Each rune in the map represents a character, and the associated string represents the binary code for that character.
-// The function returns the root node of the reconstructed Huffman tree.
-//
-// Parameters:
-//   codes (map[rune]string): A map where keys are runes (characters) and values are strings representing the binary codes.
-//
-// Returns:
-//   *Node: The root node of the reconstructed Huffman tree.
-func rebuildHuffmanTree(codes map[rune]string) *Node {
-
-	root := &Node{}
-	for char, code := range codes {
-		node := root
-		for _, bit := range code {
-			if bit == '0' {
-				if node.left == nil {
-					node.left = &Node{}
-				}
-				node = node.left
-			} else {
-				if node.right == nil {
-					node.right = &Node{}
-				}
-				node = node.right
-			}
-		}
-		node.char = char
-	}
-
-	return root
-}
\ No newline at end of file
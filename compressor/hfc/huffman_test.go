@@ -23,8 +23,8 @@ func TestCompressedData(t *testing.T) {
 		t.Fatalf("failed to create output file: %v", err)
 	}
 
-	freq := make(map[rune]int)
-	getFrequencyMap(file, &freq)
+	freq := FrequencyTable{}
+	getFrequencyTable(file, &freq)
 
 	codes, err := GetHuffmanCodes(&freq)
 	if err != nil {
@@ -69,8 +69,8 @@ func TestSmallString(t *testing.T) {
 
 func TestBigCode(t *testing.T) {
 	testData := []byte("hello. lorem ipsum dolor sit amet, consectetur adipiscing elit. sed do eiusmod tempor incididunt ut labore et dolore magna aliqua. ut enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum. 😓🥲🐥🤲🐟😀📖💙🍂😃🐥🐥😓")
-	freq := make(map[rune]int)
-	err := getFrequencyMap(bytes.NewReader(testData), &freq)
+	freq := FrequencyTable{}
+	err := getFrequencyTable(bytes.NewReader(testData), &freq)
 	if err != nil {
 		t.Fatalf("failed to get frequency map: %v", err)
 	}
@@ -92,7 +92,7 @@ func TestBigCode(t *testing.T) {
 	decompressedBytes := []byte{}
 	decompressedBuffer := bytes.NewBuffer(decompressedBytes)
 
-	err = decompressData(compressedBuffer, decompressedBuffer, codes, compLen)
+	err = decompressData(compressedBuffer, decompressedBuffer, NewCanonicalDecoder(codes), compLen)
 	if err != nil {
 		t.Fatalf("failed to decompress: %v", err)
 	}
@@ -139,8 +139,8 @@ func CheckString(t *testing.T, testData []byte) error {
 	inputReader := bytes.NewReader(testData)
 
 	//test huffman
-	freq := make(map[rune]int)
-	getFrequencyMap(inputReader, &freq)
+	freq := FrequencyTable{}
+	getFrequencyTable(inputReader, &freq)
 	//reset the seek
 	inputReader.Seek(0, io.SeekStart)
 
@@ -168,7 +168,7 @@ func CheckString(t *testing.T, testData []byte) error {
 	decompressedBytes := []byte{}
 	decompressedBuffer := bytes.NewBuffer(decompressedBytes)
 
-	err = decompressData(compressedBuffer, decompressedBuffer, codes, compLen)
+	err = decompressData(compressedBuffer, decompressedBuffer, NewCanonicalDecoder(codes), compLen)
 	if err != nil {
 		t.Fatalf("failed to decompress: %v", err)
 	}
@@ -287,7 +287,8 @@ func RunFile(targetPath string, t *testing.T) {
 	compressedFile.Seek(0, io.SeekStart)
 
 	// Decompress
-	fileNames, err := Unzip(compressedFile, "decompress_output")
+	// the output of the previous run is kept in the repository and replaced
+	fileNames, err := Unzip(compressedFile, "decompress_output", utils.WithOverwrite(utils.OVERWRITE_REPLACE))
 	if err != nil {
 		t.Fatalf("failed to decompress file: %v", err)
 	}
@@ -2,29 +2,48 @@ package hfc
 
 import (
 	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
-	"path/filepath"
+	"sync"
+	"time"
 
 	"file-compressor/constants"
+	"file-compressor/format"
+	"file-compressor/metrics"
 	"file-compressor/utils"
 )
 
+// errInvalidCode is returned when the compressed bits do not lead to a symbol in the Huffman tree.
+var errInvalidCode = errors.New("invalid Huffman code in compressed data")
 
-// getFrequencyMap reads data from the provided io.Reader and populates the given frequency map
-// with the count of each rune encountered in the input.
+// bufPool holds the read buffers of the coding loops, which run once or twice for every file and
+// for every name. The buffers have room for the two bytes decompressData holds back.
+var bufPool = sync.Pool{New: func() any {
+	buf := make([]byte, constants.BUFFER_SIZE+2)
+	return &buf
+}}
+
+// nameBufPool holds the buffers the names are compressed into by writeEntryHeader.
+var nameBufPool = sync.Pool{New: func() any {
+	return &bytes.Buffer{}
+}}
+
+// getFrequencyTable reads data from the provided io.Reader and adds the count of each byte
+// encountered in the input to the given frequency table.
 //
 // Parameters:
 //   - input: an io.Reader from which data is read.
-//   - freq: a pointer to a map where the frequency of each rune will be stored.
+//   - freq: a pointer to the table the frequency of each byte is added to.
 //
 // Returns:
 //   - error: an error if reading from the input fails, otherwise nil.
-func getFrequencyMap(input io.Reader, freq *map[rune]int) error {
-	buf := make([]byte, constants.BUFFER_SIZE)
+func getFrequencyTable(input io.Reader, freq *FrequencyTable) error {
+	pooled := bufPool.Get().(*[]byte)
+	defer bufPool.Put(pooled)
+	buf := (*pooled)[:constants.BUFFER_SIZE]
 	for {
 		n, err := input.Read(buf)
 		if err != nil && err != io.EOF {
@@ -35,67 +54,28 @@ func getFrequencyMap(input io.Reader, freq *map[rune]int) error {
 		}
 
 		for _, b := range buf[:n] {
-			(*freq)[rune(b)]++
+			freq[b]++
 		}
 	}
 
 	return nil
 }
 
-// WriteHuffmanCodes writes Huffman codes to the provided io.Writer.
-// It first writes the number of codes, followed by each rune and its corresponding code.
-// Each code is written as a sequence of bytes, with the length of the code being a multiple of 8 bits.
-// If the length of the code is not a multiple of 8, it is rounded up to the nearest higher multiple of 8.
+// WriteHuffmanCodes writes the lengths of canonical Huffman codes to the provided io.Writer
+// using the code length layout defined in the format package.
 //
 // Parameters:
 //   - file: An io.Writer where the Huffman codes will be written.
-//   - codes: A map where the keys are runes and the values are their corresponding Huffman codes as strings.
+//   - codes: The canonical codes of the bytes, as returned by GetHuffmanCodes.
 //
 // Returns:
-//   - error: An error if any occurs during writing, otherwise nil.
+//   - error: An error if the codes are not canonical or writing fails, otherwise nil.
 func WriteHuffmanCodes(file io.Writer, codes map[rune]string) error {
-	//write the number of codes
-	binary.Write(file, binary.LittleEndian, uint64(len(codes)))
-
-	for k, v := range codes {
-		//write the rune
-		binary.Write(file, binary.LittleEndian, uint32(k))
-		//write the length of the code
-		// codelen must be a multiple of 8, if not round it up to the nearest higher multiple of 8
-		codeLen := len(v)
-		binary.Write(file, binary.LittleEndian, uint8(codeLen)) // bit length of the code
-		//write the code
-		completeByte := byte(0)
-		completeByteIndex := 0
-		for i := 0; i < len(v); i++ {
-			if v[i] == '1' {
-				completeByte |= 1 << uint8(7-completeByteIndex)
-			}
-			completeByteIndex++
-			if completeByteIndex == 8 {
-				binary.Write(file, binary.LittleEndian, completeByte)
-				completeByte = 0
-				completeByteIndex = 0
-			}
-		}
-
-		// Write the last byte if it is not complete
-		if completeByteIndex > 0 {
-			binary.Write(file, binary.LittleEndian, completeByte)
-		}
-	}
-
-	return nil
+	return format.WriteCodeLengths(file, codes)
 }
 
-// ReadHuffmanCodes reads Huffman codes from the provided io.Reader and returns a map
-// where the keys are runes and the values are their corresponding Huffman codes as strings.
-// The function expects the input to be in a specific binary format:
-// - The first 4 bytes represent the number of Huffman codes (uint32).
-// - For each Huffman code:
-//   - The next 4 bytes represent the rune (uint32).
-//   - The next byte represents the length of the Huffman code (uint8).
-//   - The subsequent bytes contain the Huffman code bits, packed into bytes.
+// ReadHuffmanCodes reads the code lengths written by WriteHuffmanCodes and returns the
+// canonical codes they describe.
 //
 // Parameters:
 // - file: An io.Reader from which the Huffman codes will be read.
@@ -104,51 +84,16 @@ func WriteHuffmanCodes(file io.Writer, codes map[rune]string) error {
 // - A map[rune]string where each rune is mapped to its corresponding Huffman code.
 // - An error if there is an issue reading from the file or if the data is in an unexpected format.
 func ReadHuffmanCodes(file io.Reader) (map[rune]string, error) {
-	codes := make(map[rune]string)
-
-	// Read the number of codes (4 bytes, uint32)
-	var numCodes uint64
-	if err := binary.Read(file, binary.LittleEndian, &numCodes); err != nil {
-		return nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
-	}
-
-	// Read each code
-	for i := uint64(0); i < numCodes; i++ {
-		// Read the rune
-		var r uint32
-		if err := binary.Read(file, binary.LittleEndian, &r); err != nil {
-			return nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
-		}
-
-		// Read the length of the Huffman code (1 byte)
-		var codeLen uint8
-		if err := binary.Read(file, binary.LittleEndian, &codeLen); err != nil {
-			return nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
-		}
-
-		// Read the code bits (packed into bytes)
-		codeBits := make([]byte, int((codeLen+7)/8)) // (codeLen+7)/8 ensures enough space to hold all bits
-		if _, err := file.Read(codeBits); err != nil {
-			return nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
-		}
-
-		// Convert the code bits back into a string of '0's and '1's
-		code := ""
-		for bitIndex := 0; bitIndex < int(codeLen); bitIndex++ {
-			byteIndex := bitIndex / 8
-			bitPos := 7 - (bitIndex % 8)
-			if (codeBits[byteIndex]>>bitPos)&1 == 1 {
-				code += "1"
-			} else {
-				code += "0"
-			}
-		}
+	return format.ReadCodeLengths(file)
+}
 
-		// Store the rune and its corresponding code
-		codes[rune(r)] = code
+// readCodes reads the Huffman codes of an archive of the given format version, archives older
+// than format.VERSION_3 store every code instead of the lengths.
+func readCodes(input io.Reader, version uint16) (map[rune]string, error) {
+	if version != 0 && version < format.VERSION_3 {
+		return format.ReadCodeTable(input)
 	}
-
-	return codes, nil
+	return ReadHuffmanCodes(input)
 }
 
 // compressData compresses data from the input reader and writes the compressed data to the output writer
@@ -166,12 +111,16 @@ func ReadHuffmanCodes(file io.Reader) (map[rune]string, error) {
 // The function reads data from the input in chunks, processes each chunk to compress it using the provided
 // Huffman codes, and writes the compressed data to the output. It handles padding of the last byte and writes
 // the number of bits used in the last byte to the output. If an error occurs during reading, processing, or
-// writing, the function returns the error.
+// writing, the function returns the error. Empty input writes nothing and returns a length of 0, so empty
+// files are stored without data and extracted without running the decoder.
 func compressData(input io.Reader, output io.Writer, codes map[rune]string) (uint64, error) {
-	var currentByte byte
-	var bitCount uint8
+	table := newCodeTable(codes)
+	bits := bitWriter{}
 	compressedLength := uint64(0)
-	buf := make([]byte, constants.BUFFER_SIZE)
+	bytesRead := 0
+	pooled := bufPool.Get().(*[]byte)
+	defer bufPool.Put(pooled)
+	buf := (*pooled)[:constants.BUFFER_SIZE]
 
 	for {
 		n, err := input.Read(buf)
@@ -181,25 +130,18 @@ func compressData(input io.Reader, output io.Writer, codes map[rune]string) (uin
 		if n == 0 {
 			break // EOF reached
 		}
+		bytesRead += n
 
-		if err := processByte(buf[:n], output, codes, &currentByte, &bitCount, &compressedLength); err != nil {
+		if err := processByte(buf[:n], output, table, &bits, &compressedLength); err != nil {
 			return 0, fmt.Errorf(constants.ERROR_COMPRESS, err)
 		}
 	}
-	// if there are remaining bits in the current byte, write them to the output
-	if bitCount > 0 {
-		// Pad the last byte with zeros
-		currentByte <<= 8 - bitCount
-		if err := binary.Write(output, binary.LittleEndian, currentByte); err != nil {
-			return 0, fmt.Errorf(constants.FILE_WRITE_ERROR, err)
-		}
-	} else {
-		if err := binary.Write(output, binary.LittleEndian, byte(0)); err != nil {
-			return 0, fmt.Errorf(constants.FILE_WRITE_ERROR, err)
-		}
+	if bytesRead == 0 {
+		return 0, nil
 	}
-	// Write the number of bits in the last byte
-	if err := binary.Write(output, binary.LittleEndian, bitCount); err != nil {
+
+	// Write the remaining bits padded with zeros, followed by the number of bits used in them
+	if _, err := output.Write([]byte{bits.pending(), byte(bits.count)}); err != nil {
 		return 0, fmt.Errorf(constants.FILE_WRITE_ERROR, err)
 	}
 
@@ -208,234 +150,288 @@ func compressData(input io.Reader, output io.Writer, codes map[rune]string) (uin
 	return compressedLength, nil
 }
 
+// MAX_PACKED_CODE_LEN is the length of the longest code packed into an integer, so it fits
+// next to the up to 7 bits of a partial byte.
+const MAX_PACKED_CODE_LEN = 56
+
+// huffmanCode is the Huffman code of a byte. Codes of up to MAX_PACKED_CODE_LEN bits are packed
+// into the low length bits of bits, longer ones are only kept as text.
+type huffmanCode struct {
+	bits   uint64
+	length uint8
+	text   string
+}
+
+// codeTable holds the Huffman code of every byte, indexed by the byte. Bytes without a code
+// have an empty text.
+type codeTable [256]huffmanCode
+
+// newCodeTable packs codes into a codeTable. Runes above 255 never occur in the data and are
+// ignored.
+func newCodeTable(codes map[rune]string) *codeTable {
+	table := &codeTable{}
+	for char, code := range codes {
+		if char < 0 || char > 255 {
+			continue
+		}
+		entry := &table[char]
+		entry.text = code
+		if len(code) > MAX_PACKED_CODE_LEN {
+			continue
+		}
+		for _, bit := range code {
+			entry.bits <<= 1
+			if bit == '1' {
+				entry.bits |= 1
+			}
+		}
+		entry.length = uint8(len(code))
+	}
+	return table
+}
+
+// bitWriter collects the bits of the codes into bytes.
+type bitWriter struct {
+	bits  uint64 // the bits that do not fill a byte yet, in the low count bits
+	count uint   // the number of bits that do not fill a byte yet, always below 8
+	out   []byte // the completed bytes
+}
+
+// write appends the low length bits of bits, length is at most MAX_PACKED_CODE_LEN.
+func (w *bitWriter) write(bits uint64, length uint8) {
+	w.bits = w.bits<<length | bits
+	w.count += uint(length)
+	for w.count >= 8 {
+		w.count -= 8
+		w.out = append(w.out, byte(w.bits>>w.count))
+	}
+}
+
+// pending returns the bits that do not fill a byte, padded with zeros to a byte.
+func (w *bitWriter) pending() byte {
+	return byte(w.bits << (8 - w.count))
+}
+
 // processByte processes a buffer of bytes, compressing it using Huffman codes and writing the result to an output writer.
-// 
+//
 // Parameters:
 //   - buf: A slice of bytes to be processed.
 //   - output: An io.Writer where the compressed data will be written.
-//   - codes: A map of runes to their corresponding Huffman codes as strings.
-//   - currentByte: A pointer to the current byte being constructed from the Huffman codes.
-//   - bitCount: A pointer to the count of bits currently in the current byte.
+//   - table: The Huffman code of every byte.
+//   - bits: The bits of the previous buffers that do not fill a byte yet.
 //   - compressedLength: A pointer to the total length of the compressed data.
 //
 // Returns:
 //   - error: An error if there is no Huffman code for a character in the buffer or if there is an issue writing to the output.
 //
-// The function iterates over each byte in the buffer, looks up its corresponding Huffman code, and writes the bits of the code
-// to the current byte. When the current byte is full (i.e., 8 bits), it writes the byte to the output and resets the current byte
-// and bit count. The compressed length is incremented each time a byte is written to the output.
-func processByte(buf []byte, output io.Writer, codes map[rune]string, currentByte *byte, bitCount *uint8, compressedLength *uint64) error {
+// The function iterates over each byte in the buffer, looks up its corresponding Huffman code, and appends the bits of the code
+// to bits. The completed bytes are written to the output in one call at the end of the buffer, and the compressed length is
+// incremented by their number.
+func processByte(buf []byte, output io.Writer, table *codeTable, bits *bitWriter, compressedLength *uint64) error {
+	bits.out = bits.out[:0]
 
 	for _, b := range buf {
-		char := rune(b)
-		code, exists := codes[char]
-		if !exists {
-			return fmt.Errorf("no Huffman code for character (%b) - (%c)", char, char)
-			//continue
-		}
-
-		for _, bit := range code {
-			*currentByte <<= 1
-			if bit == '1' {
-				//left shift the current byte by 1 and set the least significant bit to 1
-				*currentByte |= 1
-			}
-			*bitCount++
-			if *bitCount == 8 {
-				if _, err := output.Write([]byte{*currentByte}); err != nil {
-					return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
-				}
-				*currentByte = 0
-				*bitCount = 0
-				*compressedLength++
+		code := &table[b]
+		switch {
+		case code.length > 0:
+			bits.write(code.bits, code.length)
+		case code.text != "":
+			// too long to be packed, written a bit at a time
+			for _, bit := range code.text {
+				bits.write(uint64(bit-'0'), 1)
 			}
+		default:
+			return fmt.Errorf("no Huffman code for character (%b) - (%c)", rune(b), rune(b))
 		}
 	}
 
+	if _, err := output.Write(bits.out); err != nil {
+		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+	*compressedLength += uint64(len(bits.out))
+
 	return nil
 }
 
 // decompressData decompresses data from the provided reader and writes the decompressed data to the provided writer.
-// It uses the provided Huffman codes to decode the data and respects the limiter for the maximum number of bytes to read.
+// It uses the provided decoder to decode the data and respects the limiter for the maximum number of bytes to read.
 //
 // Parameters:
 //   - reader: An io.Reader from which compressed data is read.
 //   - writer: An io.Writer to which decompressed data is written.
-//   - codes: A map of Huffman codes used for decompression.
+//   - decoder: The decoder built from the Huffman codes of the archive by NewCanonicalDecoder.
 //   - limiter: A uint64 value specifying the maximum number of bytes to read. If set to -1, there is no limit.
 //
 // Returns:
 //   - error: An error if decompression fails, otherwise nil.
-func decompressData(reader io.Reader, writer io.Writer, codes map[rune]string, limiter uint64) error {
-
-	lastByte := make([]byte, 1) // last byte read from the reader
-	lastByteCount := make([]byte, 1) // number of bits in the last byte
-
-	leftOverByte := uint32(0)
-	leftOverByteCount := uint8(0)
-
-	loopFlag := 0
-	root := rebuildHuffmanTree(codes)
-	currentNode := root
+func decompressData(reader io.Reader, writer io.Writer, decoder *CanonicalDecoder, limiter uint64) error {
+	// archives written before single symbol inputs got a one bit code stored no data for them
+	if decoder.maxLength == 0 {
+		return errors.New("huffman tree has no branches, the data cannot be decoded")
+	}
 
-	// if the limiter is not -1, then we only read limiter bytes
+	bits := &bitDecoder{decoder: decoder, writer: writer}
 
+	// the last byte and the number of bits used in it are held back until the data ends
+	pooled := bufPool.Get().(*[]byte)
+	defer bufPool.Put(pooled)
+	buf := *pooled
+	held := 0
 	dataRead := uint64(0)
 
-	bytesToRead := constants.BUFFER_SIZE
-
-	for {
-
-		if dataRead <= limiter {
-			bytesToRead = int(min(constants.BUFFER_SIZE, limiter-dataRead))
-		}
-
-		readBuffer := make([]byte, bytesToRead)
-		n, err := reader.Read(readBuffer)
-		if err != nil && err != io.EOF {
+	for dataRead < limiter {
+		// a pipe hands over the data as it was written, fill the buffer so the first chunk
+		// holds at least the last byte and its bit count
+		toRead := int(min(constants.BUFFER_SIZE, limiter-dataRead))
+		n, err := io.ReadFull(reader, buf[held:held+toRead])
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
 			return err
 		}
-
 		dataRead += uint64(n)
-
 		if n == 0 {
-
-			err := decompressRemainingBits(leftOverByte, leftOverByteCount, uint8(lastByteCount[0]), lastByte[0], writer, root)
-			if err != nil {
-				return fmt.Errorf(constants.ERROR_COMPRESS, err)
-			}
-
 			break
-		} else {
-
-			adjustBuffer(loopFlag, &n, &lastByte, &lastByteCount, &readBuffer)
-
-			if err := decompressFullByte(readBuffer, &leftOverByte, &leftOverByteCount, &currentNode, &root, writer); err != nil {
-				return fmt.Errorf(constants.ERROR_COMPRESS, err)
-			}
 		}
 
-		loopFlag = 1
+		n += held
+		if n < 2 {
+			return errors.New("compressed data is too short")
+		}
+		if err := bits.feed(buf[:n-2]); err != nil {
+			return fmt.Errorf(constants.ERROR_COMPRESS, err)
+		}
+		copy(buf, buf[n-2:n])
+		held = 2
 	}
 
+	if held == 0 {
+		return nil
+	}
+	if err := bits.finish(buf[0], buf[1]); err != nil {
+		return fmt.Errorf(constants.ERROR_COMPRESS, err)
+	}
 	return nil
 }
 
-// adjustBuffer modifies the read buffer based on the loop flag and updates the last byte and its count.
-//
-// Parameters:
-// - loopFlag: An integer flag that determines if the buffer should be adjusted.
-// - n: A pointer to an integer that tracks the current position in the buffer.
-// - lastByte: A pointer to a byte slice that stores the last byte from the previous chunk.
-// - lastByteCount: A pointer to a byte slice that stores the bit count of the last byte from the previous chunk.
-// - readBuffer: A pointer to a byte slice that represents the current read buffer.
-//
-// If loopFlag is non-zero, the function increments the position by 2, appends the last byte and its count to the 
-// beginning of the read buffer, and then updates the last byte and its count based on the current position. 
-// Finally, it removes the last 2 bytes from the read buffer.
-func adjustBuffer(loopFlag int, n *int, lastByte *[]byte, lastByteCount *[]byte, readBuffer *[]byte) {
-	if loopFlag != 0 {
-		*n += 2
-		//add the last byte and bit count to the readBuffer
-		leftOverData := append(*lastByte, *lastByteCount...)
-		*readBuffer = append(leftOverData, *readBuffer...)
-	}
-
-	// add the last byte from the chunk to the lastByte buffer
-	*lastByte = (*readBuffer)[*n-2 : *n-1]
-	// add the last byte's bit count to the lastByteCount buffer
-	*lastByteCount = (*readBuffer)[*n-1 : *n]
-	// remove last 2 bytes from the chunk
-	*readBuffer = (*readBuffer)[:*n-2]
-}
-
-// decompressFullByte processes a buffer of bytes to decompress data using a Huffman tree.
-// It traverses the tree based on the bits of each byte in the buffer and writes the decompressed
-// characters to the provided writer.
-//
-// Parameters:
-// - readBuffer: A slice of bytes containing the compressed data.
-// - leftOverByte: A pointer to an uint32 that holds the leftover bits from the previous byte.
-// - leftOverByteCount: A pointer to an uint8 that counts the number of leftover bits.
-// - currentNode: A double pointer to the current node in the Huffman tree.
-// - root: A double pointer to the root node of the Huffman tree.
-// - writer: An io.Writer where the decompressed data will be written.
-//
-// Returns:
-// - error: An error if writing to the writer fails, otherwise nil.
-func decompressFullByte(readBuffer []byte, leftOverByte *uint32, leftOverByteCount *uint8, currentNode **Node, root **Node, writer io.Writer) error {
-	for _, b := range readBuffer {
-		for i := 7; i >= 0; i-- {
-			bit := (b >> i) & 1
-			*leftOverByte <<= 1
-			*leftOverByte |= uint32(bit)
-			*leftOverByteCount++
-			if bit == 0 {
-				*currentNode = (*currentNode).left
-			} else {
-				*currentNode = (*currentNode).right
-			}
-			if (*currentNode).left == nil && (*currentNode).right == nil {
-				if _, err := writer.Write([]byte{byte((*currentNode).char)}); err != nil {
-					return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
-				}
-				*currentNode = *root
-				*leftOverByte = 0
-				*leftOverByteCount = 0
+// bitDecoder decodes the bits of compressed data with a CanonicalDecoder, the bits of a code
+// that continues in the next buffer are kept between the calls of feed.
+type bitDecoder struct {
+	decoder *CanonicalDecoder
+	writer  io.Writer
+	bits    uint64     // the bits that are not decoded yet, in the low count bits
+	count   uint       // the number of bits that are not decoded yet
+	match   *longMatch // the long codes an unfinished code can still be, nil between codes
+	out     []byte     // the decoded bytes that are not written yet
+}
+
+// feed decodes the full bytes of data. The codes that do not end in data are completed by the
+// next call or by finish.
+func (d *bitDecoder) feed(data []byte) error {
+	for _, b := range data {
+		d.bits = d.bits<<8 | uint64(b)
+		d.count += 8
+		// keep room for the next byte in bits
+		if d.count > 56 {
+			if err := d.decode(); err != nil {
+				return err
 			}
 		}
 	}
-
-	return nil
+	if err := d.decode(); err != nil {
+		return err
+	}
+	return d.flush()
 }
 
-// decompressRemainingBits processes the remaining bits from the last byte of a compressed stream,
-// traversing the Huffman tree to decode the bits and write the corresponding characters to the output.
-//
-// Parameters:
-//   - remainingBits: The bits that are left to be processed.
-//   - remainingBitsLen: The length of the remaining bits.
-//   - numOfBits: The number of bits to process from the last byte.
-//   - lastByte: The last byte from the compressed stream.
-//   - output: The writer where the decompressed data will be written.
-//   - root: The root node of the Huffman tree.
-//
-// Returns:
-//   - error: An error if writing to the output fails, otherwise nil.
-func decompressRemainingBits(remainingBits uint32, remainingBitsLen uint8, numOfBits uint8, lastByte byte, output io.Writer, root *Node) error {
-	// include the last byte in the remaining bits
-	for j := 7; j >= 8-int(numOfBits); j-- {
-		bit := (lastByte >> j) & 1
-		//remainingBits = (remainingBits << 1) | bit
-		remainingBits <<= 1
-		remainingBits |= uint32(bit)
-		remainingBitsLen++
-	}
-
-	if remainingBitsLen == 0 {
-		return nil
+// finish decodes the bits used in the last byte and everything left before them.
+func (d *bitDecoder) finish(lastByte byte, numOfBits byte) error {
+	if numOfBits > 8 {
+		return fmt.Errorf("invalid bit count in last byte: %d", numOfBits)
+	}
+	if numOfBits > 0 {
+		d.bits = d.bits<<numOfBits | uint64(lastByte>>(8-numOfBits))
+		d.count += uint(numOfBits)
 	}
 
-	currentNode := root
-
-	for i := int(remainingBitsLen - 1); i >= 0; i-- {
-
-		bit := (remainingBits >> i) & 1
+	if err := d.decode(); err != nil {
+		return err
+	}
+	if d.match != nil {
+		return errors.New("compressed data ends in the middle of a code")
+	}
+	// fewer bits than a table index are left, they are looked up padded with zeros
+	for d.count > 0 {
+		tableBits := uint(d.decoder.bits)
+		entry := d.decoder.table[d.bits<<(tableBits-d.count)&(1<<tableBits-1)]
+		switch {
+		case entry.length > 0 && uint(entry.length) <= d.count:
+			d.count -= uint(entry.length)
+			if err := d.emit(entry.symbol); err != nil {
+				return err
+			}
+		case entry.length > 0 || entry.long:
+			return errors.New("compressed data ends in the middle of a code")
+		default:
+			return errInvalidCode
+		}
+	}
+	return d.flush()
+}
 
-		if bit == 0 {
-			currentNode = currentNode.left
-		} else {
-			currentNode = currentNode.right
+// decode decodes codes while at least a table index of bits is left, and the bits of a long
+// code that are left.
+func (d *bitDecoder) decode() error {
+	tableBits := uint(d.decoder.bits)
+	for d.count >= tableBits || (d.match != nil && d.count > 0) {
+		if d.match != nil {
+			if err := d.step(); err != nil {
+				return err
+			}
+			continue
 		}
 
-		if currentNode.left == nil && currentNode.right == nil {
-			if _, err := output.Write([]byte{byte(currentNode.char)}); err != nil {
-				return fmt.Errorf(constants.BUFFER_WRITE_ERROR, err)
+		entry := &d.decoder.table[d.bits>>(d.count-tableBits)&(1<<tableBits-1)]
+		switch {
+		case entry.length > 0:
+			d.count -= uint(entry.length)
+			if err := d.emit(entry.symbol); err != nil {
+				return err
 			}
-			currentNode = root
+		case entry.long:
+			d.match = &longMatch{high: len(d.decoder.long)}
+		default:
+			return errInvalidCode
 		}
 	}
+	return nil
+}
+
+// step reads the next bit of an unfinished long code.
+func (d *bitDecoder) step() error {
+	d.count--
+	symbol, done, err := d.decoder.next(d.match, d.bits>>d.count&1)
+	if err != nil || !done {
+		return err
+	}
+	d.match = nil
+	return d.emit(symbol)
+}
 
+func (d *bitDecoder) emit(symbol byte) error {
+	d.out = append(d.out, symbol)
+	if len(d.out) >= constants.BUFFER_SIZE {
+		return d.flush()
+	}
+	return nil
+}
+
+func (d *bitDecoder) flush() error {
+	if len(d.out) == 0 {
+		return nil
+	}
+	if _, err := d.writer.Write(d.out); err != nil {
+		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+	d.out = d.out[:0]
 	return nil
 }
 
@@ -444,59 +440,203 @@ func decompressRemainingBits(remainingBits uint32, remainingBitsLen uint8, numOf
 // It first generates compression codes for the files, writes the number of files, and then processes each file individually.
 // For each file, it compresses and writes the file name, writes a placeholder for the compressed size, compresses the file data,
 // and then updates the placeholder with the actual compressed size.
+// Files whose readers cannot seek, such as pipes, are buffered first, see utils.WithSpillThreshold.
 //
 // Parameters:
 //   - files: A slice of utils.FileData representing the files to be compressed.
 //   - output: An io.Writer where the compressed data will be written.
+//   - opts: Optional settings such as utils.WithMetrics.
 //
 // Returns:
 //   - error: An error if any step in the compression process fails.
-func Zip(files []utils.FileData, output io.Writer) error {
+func Zip(files []utils.FileData, output io.Writer, opts ...utils.Option) error {
+	options := utils.NewOptions(opts...)
+
+	if err := zipFiles(files, output, options, utils.HUFFMAN); err != nil {
+		metrics.RecordError(options.Metrics, string(utils.HUFFMAN), metrics.OP_COMPRESS, err)
+		return err
+	}
+
+	return nil
+}
+
+// zipFiles writes the Huffman coded archive of files, algorithm selects the preprocessing of
+// the entry data, see encodeData.
+func zipFiles(files []utils.FileData, output io.Writer, options utils.Options, algorithm utils.Algorithm) error {
+	seeker, ok := output.(io.Seeker)
+	if !ok {
+		return errors.New("huffman output must support seeking, use ZipStream otherwise")
+	}
+
+	// the links are coded like empty files, their data is not read
+	files, table, links := linkFiles(files)
 
-	codes, err := generateCodes(&files, output)
+	files, release, err := bufferUnseekable(files, options)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	codes, err := generateCodes(&files, output, algorithm, options)
 	if err != nil {
 		return fmt.Errorf("error preparing codes: %w", err)
 	}
 
-	// Write the number of files
+	// Write the number of files and the links
 	if err := writeNumOfFiles(uint64(len(files)), output); err != nil {
-		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+		return err
+	}
+	if err := format.WriteLinkTable(output, table); err != nil {
+		return err
 	}
 
-	for _, file := range files {
-		reader := file.Reader
+	if options.Threads > 1 && len(files) > 1 {
+		return zipEntriesParallel(files, output, options, algorithm, codes, links, false)
+	}
 
-		//Compress and write the file name
-		if err = writeFileName(file.Name, output, codes); err != nil {
-			return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
-		}
+	total := utils.TotalSize(files)
+
+	for i, file := range files {
+		start := time.Now()
+		reader := &utils.CountingReader{Reader: file.Reader}
 
-		//write 64 bit 0 for the compressed size
-		if err := binary.Write(output, binary.LittleEndian, uint64(0)); err != nil {
-			return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+		//Compress and write the file name, modification time and mode, with a zero compressed size that is filled in below
+		if err = writeEntryHeader(file.Name, entryHeader(file), output, codes); err != nil {
+			return err
 		}
-		//Compress and write the data
-		compressedLen, err := compressData(reader, output, codes)
+		//Compress and write the data, computing the checksum of the original content
+		checksum := crc32.NewIEEE()
+		compressedLen, err := compressData(encodeData(algorithm, io.TeeReader(reader, checksum)), output, codes)
 
 		if err != nil {
 			return fmt.Errorf(constants.ERROR_COMPRESS, err)
 		}
 
-		//seek back to compressedLen bytes and write the compressed size
-		if _, err := output.(io.Seeker).Seek(-int64(compressedLen+8), io.SeekCurrent); err != nil { // +4 for the 4 bytes of compressed size (uint64 -> 8 bytes) | 8bit = 1byte, 64bit = 8byte
-			return fmt.Errorf("error seeking back to write the compressed size: %w", err)
+		crc, originalSize := links.sums(i, checksum.Sum32(), uint64(reader.BytesRead))
+		if err := writeEntrySizes(output, seeker, crc, originalSize, compressedLen); err != nil {
+			return err
+		}
+
+		metrics.RecordEntry(options.Metrics, string(algorithm), metrics.OP_COMPRESS, reader.BytesRead, int64(compressedLen), time.Since(start))
+		options.Progress(file.Name, reader.BytesRead, total)
+	}
+
+	return nil
+}
+
+// writeEntrySizes seeks back over the compressedLen bytes of data just written to fill in the
+// checksum, the original size and the compressed size of the entry, then seeks to the end again.
+func writeEntrySizes(output io.Writer, seeker io.Seeker, crc uint32, originalSize uint64, compressedLen uint64) error {
+	//seek back to compressedLen bytes and write the checksum, the original size and the compressed size
+	if _, err := seeker.Seek(-int64(compressedLen+format.ENTRY_SIZE_LEN+format.ENTRY_ORIGINAL_SIZE_LEN+format.ENTRY_CRC_LEN), io.SeekCurrent); err != nil {
+		return fmt.Errorf("error seeking back to write the compressed size: %w", err)
+	}
+
+	if err := format.WriteEntryCRC(output, crc); err != nil {
+		return err
+	}
+	if err := format.WriteEntryOriginalSize(output, originalSize); err != nil {
+		return err
+	}
+	if err := format.WriteEntrySize(output, compressedLen); err != nil {
+		return err
+	}
+
+	//seek back to the end of the file
+	if _, err := seeker.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("error seeking to the end of the file: %w", err)
+	}
+	return nil
+}
+
+// bufferUnseekable returns files with the readers that cannot seek replaced by buffers of their
+// content, because the codes are built in a first pass over every file and the data is read
+// again after it. Up to options.SpillThreshold bytes of a file are kept in memory, the rest of
+// a larger file goes to a temporary file. files itself is not changed.
+//
+// Parameters:
+//   - files: the files to compress
+//   - options: the spill threshold
+//
+// Returns:
+//   - []utils.FileData: the files with readers that can seek
+//   - func(): releases the buffers, it must be called once the files are compressed
+//   - error: if a file cannot be read or buffered
+func bufferUnseekable(files []utils.FileData, options utils.Options) ([]utils.FileData, func(), error) {
+	buffered := make([]utils.FileData, len(files))
+	buffers := []*utils.SpillBuffer{}
+	release := func() {
+		for _, buffer := range buffers {
+			buffer.Close()
 		}
+	}
 
-		if err := binary.Write(output, binary.LittleEndian, compressedLen); err != nil {
-			return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	for i, file := range files {
+		buffered[i] = file
+		if canSeek(file.Reader) {
+			continue
 		}
 
-		//seek back to the end of the file
-		if _, err := output.(io.Seeker).Seek(0, io.SeekEnd); err != nil {
-			return fmt.Errorf("error seeking to the end of the file: %w", err)
+		buffer := utils.NewSpillBuffer(options.SpillThreshold)
+		buffers = append(buffers, buffer)
+		if _, err := io.Copy(buffer, file.Reader); err != nil {
+			release()
+			return nil, nil, fmt.Errorf("failed to buffer %s: %w", file.Name, err)
+		}
+		reader, err := buffer.Reader()
+		if err != nil {
+			release()
+			return nil, nil, err
 		}
+		buffered[i].Reader = reader
 	}
 
+	return buffered, release, nil
+}
+
+// canSeek reports whether reader can be rewound. The readers wrapping the files, such as the
+// progress reader, implement io.Seeker and fail when the reader they wrap cannot seek.
+func canSeek(reader io.Reader) bool {
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		return false
+	}
+	_, err := seeker.Seek(0, io.SeekCurrent)
+	return err == nil
+}
+
+// addNameFrequencies adds the bytes of the file names to freq. Archives are solid: the names
+// and the data of all files are coded with one set of codes, written once at the start of the
+// archive. By default the names count like the data, which gives the smallest archives when
+// the names are a large share of them, see BenchmarkSolidNames. With options.NoSolidNames every
+// byte of a name only gets a count of one if the data does not contain it, so it still has a
+// code, and the codes of files with the same data are the same whatever their names.
+//
+// Parameters:
+//   - freq: the frequencies of the data of all files
+//   - files: the files whose names are added
+//   - options: the NoSolidNames setting
+//
+// Returns:
+//   - error: if a name cannot be read
+func addNameFrequencies(freq *FrequencyTable, files []utils.FileData, options utils.Options) error {
+	names := FrequencyTable{}
+	for _, file := range files {
+		if err := getFrequencyTable(bytes.NewReader([]byte(file.Name)), &names); err != nil {
+			return fmt.Errorf("error generating frequency map for filename: %w", err)
+		}
+	}
+
+	for b, count := range names {
+		if count == 0 {
+			continue
+		}
+		if !options.NoSolidNames {
+			freq[b] += count
+		} else if freq[b] == 0 {
+			freq[b] = 1
+		}
+	}
 	return nil
 }
 
@@ -504,25 +644,22 @@ func Zip(files []utils.FileData, output io.Writer) error {
 // It returns a map of runes to their corresponding Huffman codes.
 //
 // Parameters:
-// - files: A pointer to a slice of utils.FileData, where each FileData contains the file name and a reader for the file content.
+// - files: A pointer to a slice of utils.FileData, where each FileData contains the file name and a reader for the file content,
+//   which must seek, see bufferUnseekable.
 // - output: An io.Writer where the frequency map and Huffman codes will be written.
+// - algorithm: The algorithm the archive is written with, the codes are built for the data encodeData returns for it.
+// - options: With options.NoSolidNames the file names are left out of the frequencies, see addNameFrequencies.
 //
 // Returns:
 // - A map[rune]string representing the Huffman codes for each rune.
 // - An error if there is any issue during the process of generating the frequency map, building Huffman codes, or writing the codes to the output.
-func generateCodes(files *[]utils.FileData, output io.Writer) (map[rune]string, error) {
-	freq := make(map[rune]int)
+func generateCodes(files *[]utils.FileData, output io.Writer, algorithm utils.Algorithm, options utils.Options) (map[rune]string, error) {
+	freq := FrequencyTable{}
 	//first, we need to get the frequency map
 	for _, file := range *files {
 
-		//Get frequency map of the input file name
-		nameBuf := bytes.NewReader([]byte(file.Name))
-		if err := getFrequencyMap(nameBuf, &freq); err != nil {
-			return nil, fmt.Errorf("error generating frequency map for filename: %w", err)
-		}
-
 		//Get frequency map of the input data
-		if err := getFrequencyMap(file.Reader, &freq); err != nil {
+		if err := getFrequencyTable(encodeData(algorithm, file.Reader), &freq); err != nil {
 			return nil, fmt.Errorf("error generating frequency map for filedata: %w", err)
 		}
 
@@ -532,6 +669,11 @@ func generateCodes(files *[]utils.FileData, output io.Writer) (map[rune]string,
 		}
 	}
 
+	//the names are coded with the same codes
+	if err := addNameFrequencies(&freq, *files, options); err != nil {
+		return nil, err
+	}
+
 	// Build Huffman codes
 	codes, err := GetHuffmanCodes(&freq)
 	if err != nil {
@@ -546,69 +688,163 @@ func generateCodes(files *[]utils.FileData, output io.Writer) (map[rune]string,
 	return codes, nil
 }
 
-func writeFileName(fileName string, output io.Writer, codes map[rune]string) error {
-	// Write the file name length after compressing it
+// writeEntryHeader compresses the file name and writes it with the other fields of header.
+// Zip passes zero checksum and sizes that are back-filled after the data.
+func writeEntryHeader(fileName string, header format.EntryHeader, output io.Writer, codes map[rune]string) error {
 	nameBuf := bytes.NewReader([]byte(fileName))
 
-	compressedNameBuf := bytes.NewBuffer([]byte{})
+	compressedNameBuf := nameBufPool.Get().(*bytes.Buffer)
+	compressedNameBuf.Reset()
+	defer nameBufPool.Put(compressedNameBuf)
 
-	compLen, err := compressData(nameBuf, compressedNameBuf, codes)
-	if err != nil {
+	if _, err := compressData(nameBuf, compressedNameBuf, codes); err != nil {
 		return fmt.Errorf(constants.ERROR_COMPRESS, err)
 	}
-	// write length of the file name buffer
-	if err := binary.Write(output, binary.LittleEndian, uint16(compLen)); err != nil {
-		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+
+	header.Name = compressedNameBuf.Bytes()
+	return format.WriteEntryHeader(output, header)
+}
+
+// unzipEntry reads the header of the entry at index at the start of input and extracts the
+// entry, or skips it when it is not selected. input is positioned at the next entry afterwards.
+// algorithm selects how the decoded data is restored, see decodeData. The data of a link is
+// copied from its original, which linked keeps.
+func unzipEntry(input io.Reader, table *CanonicalDecoder, extractor *utils.Extractor, options utils.Options, algorithm utils.Algorithm, linked *linkedData, index uint64) error {
+	start := time.Now()
+
+	// get the file name
+	fileName, err := readFileName(input, table)
+	if err != nil {
+		return err
 	}
 
-	// write the compressed file name
-	if err := binary.Write(output, binary.LittleEndian, compressedNameBuf.Bytes()); err != nil {
-		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	// read the modification time, the mode, the checksum and the sizes
+	modTime, err := format.ReadEntryModTime(input)
+	if err != nil {
+		return err
 	}
 
-	return nil
-}
+	mode, err := format.ReadEntryMode(input)
+	if err != nil {
+		return err
+	}
 
-func readNumOfFiles(input io.Reader) (uint64, error) {
-	var numOfFiles uint64
-	if err := binary.Read(input, binary.LittleEndian, &numOfFiles); err != nil {
-		return 0, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	expectedCRC, err := format.ReadEntryCRC(input)
+	if err != nil {
+		return err
 	}
 
-	return numOfFiles, nil
-}
+	// the original size is only needed when listing the archive
+	if _, err := format.ReadEntryOriginalSize(input); err != nil {
+		return err
+	}
 
-func writeNumOfFiles(numOfFiles uint64, output io.Writer) error {
+	compressedSize, err := format.ReadEntrySize(input)
+	if err != nil {
+		return err
+	}
 
-	if err := binary.Write(output, binary.LittleEndian, numOfFiles); err != nil {
-		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	_, isLink := linked.original(index)
+	if isLink && compressedSize > 0 {
+		return fmt.Errorf("link %s has data of its own", fileName)
 	}
+	// the data of an original is decoded for its links even when it was not asked for
+	keep := linked.keep(index)
+	selected := options.Selects(fileName)
 
-	return nil
-}
+	// entries that were not asked for are skipped without decoding
+	if !selected && keep == nil {
+		if isLink {
+			linked.done(index)
+		}
+		if err := SkipFile(readSeeker(input), compressedSize); err != nil {
+			return fmt.Errorf("failed to skip the data of %s: %w", fileName, err)
+		}
+		return nil
+	}
+
+	// writer
+	checksum := crc32.NewIEEE()
+	writer := io.Writer(checksum)
+	var output *utils.ExtractedEntry
+	if selected {
+		output, err = extractor.Create(fileName)
+		if err != nil {
+			return err
+		}
+		output.SetModTime(utils.FromUnixNanos(modTime))
+		output.SetMode(os.FileMode(mode))
+		writer = io.MultiWriter(output, checksum)
+	}
+	if keep != nil {
+		writer = io.MultiWriter(writer, keep)
+	}
+	abort := func() {
+		if output != nil {
+			output.Abort()
+		}
+	}
 
-func readFileName(input io.Reader, codes map[rune]string) (string, error) {
+	if isLink {
+		if err := linked.writeTo(index, writer); err != nil {
+			abort()
+			return fmt.Errorf("failed to copy the data of %s: %w", fileName, err)
+		}
+	} else if compressedSize > 0 {
+		// empty files have no data, the decoder is not needed
+		decoder := decodeData(algorithm, writer)
+		err = decompressData(input, decoder, table, compressedSize)
+		if err == nil {
+			err = decoder.Close()
+		}
+		if err != nil {
+			abort()
+			return fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+		}
+	}
 
-	var nameLen uint16
-	if err := binary.Read(input, binary.LittleEndian, &nameLen); err != nil {
-		return "", fmt.Errorf(constants.FILE_READ_ERROR, err)
+	if actualCRC := checksum.Sum32(); actualCRC != expectedCRC {
+		abort()
+		return &utils.ErrChecksumMismatch{Filename: fileName, Expected: expectedCRC, Got: actualCRC}
 	}
 
-	buf := make([]byte, nameLen)
-	if err := binary.Read(input, binary.LittleEndian, buf); err != nil {
-		return "", fmt.Errorf(constants.FILE_READ_ERROR, err)
+	if output == nil {
+		return nil
 	}
+	if err := output.Close(); err != nil {
+		return err
+	}
+
+	metrics.RecordEntry(options.Metrics, string(algorithm), metrics.OP_DECOMPRESS, int64(compressedSize), output.BytesWritten(), time.Since(start))
+	options.Progress(fileName, output.BytesWritten(), -1)
+	return nil
+}
 
-	compressedFilename := bytes.NewBuffer(buf)
+// entryHeader returns the header fields of file that are known before it is compressed.
+func entryHeader(file utils.FileData) format.EntryHeader {
+	return format.EntryHeader{ModTime: utils.UnixNanos(file.ModTime), Mode: uint32(file.Mode.Perm())}
+}
+
+func readNumOfFiles(input io.Reader) (uint64, error) {
+	return format.ReadEntryCount(input)
+}
+
+func writeNumOfFiles(numOfFiles uint64, output io.Writer) error {
+	return format.WriteEntryCount(output, numOfFiles)
+}
+
+func readFileName(input io.Reader, table *CanonicalDecoder) (string, error) {
+	compressedName, err := format.ReadEntryName(input)
+	if err != nil {
+		return "", err
+	}
 
 	nameBuffer := bytes.NewBuffer([]byte{})
-	if err := decompressData(compressedFilename, nameBuffer, codes, uint64(nameLen)); err != nil {
+	if err := decompressData(bytes.NewReader(compressedName), nameBuffer, table, uint64(len(compressedName))); err != nil {
 		return "", fmt.Errorf(constants.ERROR_DECOMPRESS, err)
 	}
 
-	name := nameBuffer.String()
-
-	return name, nil
+	return nameBuffer.String(), nil
 }
 
 
@@ -618,6 +854,11 @@ func readFileName(input io.Reader, codes map[rune]string) (string, error) {
 // Parameters:
 //   - input: An io.Reader from which the compressed data is read.
 //   - outputPath: A string specifying the directory where the decompressed files will be written.
+//   - opts: Optional settings. With utils.WithSplitOutput each entry is written as numbered parts
+//     and the path of its JSON descriptor is returned instead of the file path. With
+//     utils.WithTruncateLongNames long names are shortened and the path of the rename manifest
+//     is returned after the extracted files. With utils.WithEntries only the matching entries
+//     are extracted.
 //
 // Returns:
 //   - A slice of strings containing the paths of the decompressed files.
@@ -626,23 +867,32 @@ func readFileName(input io.Reader, codes map[rune]string) (string, error) {
 // The function performs the following steps:
 //   1. Reads Huffman codes from the input.
 //   2. Reads the number of files to be decompressed.
-//   3. Iterates over each file, reading its name and creating the necessary directories.
-//   4. Creates the output file and reads its compressed size.
-//   5. Decompresses the data and writes it to the output file.
-//   6. Closes the output file and appends its path to the result slice.
+//   3. Iterates over each file, reading its name, modification time, mode, checksum and sizes.
+//   4. Skips the entry if utils.WithEntries does not select it, otherwise creates the output file and its directories.
+//   5. Decompresses the data, writes it to the output file and compares its checksum.
+//   6. Closes the output file, restores its permissions and modification time and appends its path to the result slice.
 //
 // Possible errors include issues with reading Huffman codes, reading the number of files, creating directories, 
 // creating output files, reading compressed sizes, and decompressing data.
-func Unzip(input io.Reader, outputPath string) ([]string, error) {
+func Unzip(input io.Reader, outputPath string, opts ...utils.Option) ([]string, error) {
+	options := utils.NewOptions(opts...)
 
-	if outputPath == "" {
-		outputPath = "." // Use the current directory if no output path is provided
+	filePaths, err := unzipFiles(input, outputPath, options, utils.HUFFMAN)
+	if err != nil {
+		metrics.RecordError(options.Metrics, string(utils.HUFFMAN), metrics.OP_DECOMPRESS, err)
+		return nil, err
 	}
 
-	codes, err := ReadHuffmanCodes(input)
+	return filePaths, nil
+}
+
+func unzipFiles(input io.Reader, outputPath string, options utils.Options, algorithm utils.Algorithm) ([]string, error) {
+
+	codes, err := readCodes(input, options.FormatVersion)
 	if err != nil {
 		return nil, fmt.Errorf(constants.FAILED_READ_HUFFMAN_CODES, err)
 	}
+	table := NewCanonicalDecoder(codes)
 
 	numOfFiles, err := readNumOfFiles(input)
 	if err != nil {
@@ -653,44 +903,20 @@ func Unzip(input io.Reader, outputPath string) ([]string, error) {
 		return nil, errors.New("no files to decompress")
 	}
 
-	filePaths := []string{}
+	links, err := readLinks(input, options.FormatVersion, numOfFiles)
+	if err != nil {
+		return nil, err
+	}
+	linked := newLinkedData(links, options.SpillThreshold)
+	defer linked.Close()
+
+	extractor := utils.NewExtractor(outputPath, options)
 
 	for i := uint64(0); i < numOfFiles; i++ {
-		// get the file name
-		fileName, err := readFileName(input, codes)
-		if err != nil {
+		if err := unzipEntry(input, table, extractor, options, algorithm, linked, i); err != nil {
 			return nil, err
 		}
-
-		fileName = filepath.Join(outputPath, fileName)
-
-		dir := filepath.Dir(fileName)
-
-		if err := utils.MakeOutputDir(dir); err != nil {
-			return nil, fmt.Errorf(constants.ERROR_CREATE_DIR, err)
-		}
-
-		// writer
-		outputFile, err := os.Create(fileName)
-		if err != nil {
-			return nil, fmt.Errorf(constants.FILE_CREATE_ERROR, err)
-		}
-
-		// read the compressed size
-		var compressedSize uint64
-		if err := binary.Read(input, binary.LittleEndian, &compressedSize); err != nil {
-			return nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
-		}
-
-		err = decompressData(input, outputFile, codes, compressedSize)
-		if err != nil {
-			return nil, fmt.Errorf(constants.ERROR_DECOMPRESS, err)
-		}
-
-		outputFile.Close()
-
-		filePaths = append(filePaths, fileName)
 	}
 
-	return filePaths, nil
+	return extractor.Finish()
 }
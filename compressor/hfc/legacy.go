@@ -0,0 +1,103 @@
+package hfc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"file-compressor/constants"
+	"file-compressor/format"
+	"file-compressor/metrics"
+	"file-compressor/utils"
+)
+
+// UnzipLegacy decompresses a format.VERSION_1 Huffman archive like Unzip. Its entries carry
+// no modification time, mode or checksum, so the files keep the time of extraction and the
+// default permissions, and damaged data cannot be detected.
+//
+// Parameters:
+//   - input: An io.Reader positioned after the legacy container header.
+//   - outputPath: A string specifying the directory where the decompressed files will be written.
+//   - opts: Optional settings, the same as for Unzip.
+//
+// Returns:
+//   - A slice of strings containing the paths of the decompressed files.
+//   - An error if any issue occurs during the decompression process.
+func UnzipLegacy(input io.Reader, outputPath string, opts ...utils.Option) ([]string, error) {
+	options := utils.NewOptions(opts...)
+
+	filePaths, err := unzipLegacyFiles(input, outputPath, options)
+	if err != nil {
+		metrics.RecordError(options.Metrics, string(utils.HUFFMAN), metrics.OP_DECOMPRESS, err)
+		return nil, err
+	}
+
+	return filePaths, nil
+}
+
+func unzipLegacyFiles(input io.Reader, outputPath string, options utils.Options) ([]string, error) {
+	codes, err := readCodes(input, format.VERSION_1)
+	if err != nil {
+		return nil, fmt.Errorf(constants.FAILED_READ_HUFFMAN_CODES, err)
+	}
+	table := NewCanonicalDecoder(codes)
+
+	numOfFiles, err := readNumOfFiles(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if numOfFiles < 1 {
+		return nil, errors.New("no files to decompress")
+	}
+
+	extractor := utils.NewExtractor(outputPath, options)
+
+	for i := uint64(0); i < numOfFiles; i++ {
+		if err := unzipLegacyEntry(input, table, extractor, options); err != nil {
+			return nil, err
+		}
+	}
+
+	return extractor.Finish()
+}
+
+func unzipLegacyEntry(input io.Reader, table *CanonicalDecoder, extractor *utils.Extractor, options utils.Options) error {
+	start := time.Now()
+
+	fileName, err := readFileName(input, table)
+	if err != nil {
+		return err
+	}
+
+	compressedSize, err := format.ReadEntrySize(input)
+	if err != nil {
+		return err
+	}
+
+	if !options.Selects(fileName) {
+		if err := SkipFile(readSeeker(input), compressedSize); err != nil {
+			return fmt.Errorf("failed to skip the data of %s: %w", fileName, err)
+		}
+		return nil
+	}
+
+	output, err := extractor.Create(fileName)
+	if err != nil {
+		return err
+	}
+
+	if err := decompressData(input, output, table, compressedSize); err != nil {
+		output.Abort()
+		return fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+	}
+
+	if err := output.Close(); err != nil {
+		return err
+	}
+
+	metrics.RecordEntry(options.Metrics, string(utils.HUFFMAN), metrics.OP_DECOMPRESS, int64(compressedSize), output.BytesWritten(), time.Since(start))
+	options.Progress(fileName, output.BytesWritten(), -1)
+	return nil
+}
@@ -0,0 +1,151 @@
+package hfc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"file-compressor/format"
+	"file-compressor/utils"
+)
+
+// entryLinks holds the links of an archive being written, and the checksums and sizes of the
+// entries written so far, which the headers of their links repeat.
+type entryLinks struct {
+	originals map[int]int
+	crcs      []uint32
+	sizes     []uint64
+}
+
+// linkFiles finds the files whose utils.FileData.Link names an earlier file, a link to a link
+// points to its original. A link that names no earlier file is compressed like any other file.
+//
+// Parameters:
+//   - files: the files to compress
+//
+// Returns:
+//   - []utils.FileData: files with the data of the links left out, a link is coded like an
+//     empty file
+//   - []format.EntryLink: the links, written after the entry count
+//   - *entryLinks: fills in the headers of the links, see sums
+func linkFiles(files []utils.FileData) ([]utils.FileData, []format.EntryLink, *entryLinks) {
+	links := &entryLinks{originals: map[int]int{}, crcs: make([]uint32, len(files)), sizes: make([]uint64, len(files))}
+	table := []format.EntryLink{}
+	indexes := map[string]int{}
+	linked := files
+
+	for i, file := range files {
+		if original, found := indexes[file.Link]; file.Link != "" && found {
+			if next, isLink := links.originals[original]; isLink {
+				original = next
+			}
+			if len(table) == 0 {
+				linked = append([]utils.FileData{}, files...)
+			}
+			linked[i].Reader = bytes.NewReader(nil)
+			links.originals[i] = original
+			table = append(table, format.EntryLink{Entry: uint64(i), Original: uint64(original)})
+		}
+
+		if _, exists := indexes[file.Name]; !exists {
+			indexes[file.Name] = i
+		}
+	}
+
+	return linked, table, links
+}
+
+// sums records the checksum and the original size of the entry at index, and returns the ones
+// its header is written with: those of its original for a link. A nil entryLinks returns them
+// unchanged.
+func (l *entryLinks) sums(index int, crc uint32, size uint64) (uint32, uint64) {
+	if l == nil {
+		return crc, size
+	}
+	if original, isLink := l.originals[index]; isLink {
+		crc, size = l.crcs[original], l.sizes[original]
+	}
+	l.crcs[index], l.sizes[index] = crc, size
+	return crc, size
+}
+
+// readLinks reads the links that follow the entry count of an archive of the given format
+// version, archives older than format.VERSION_4 have none.
+func readLinks(input io.Reader, version uint16, numOfFiles uint64) ([]format.EntryLink, error) {
+	if version != 0 && version < format.VERSION_4 {
+		return nil, nil
+	}
+	links, err := format.ReadLinkTable(input, numOfFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the links: %w", err)
+	}
+	return links, nil
+}
+
+// linkedData keeps the data of the entries that links point to while an archive is extracted.
+// The data of an original is kept from its extraction until its last link is written, rather
+// than read back from its file, which may be split, skipped or not selected at all. It is held
+// in a utils.SpillBuffer, which moves it to a temporary file above the spill threshold.
+type linkedData struct {
+	originals map[uint64]uint64
+	pending   map[uint64]int
+	buffers   map[uint64]*utils.SpillBuffer
+	threshold int
+}
+
+func newLinkedData(links []format.EntryLink, threshold int) *linkedData {
+	data := &linkedData{originals: map[uint64]uint64{}, pending: map[uint64]int{}, buffers: map[uint64]*utils.SpillBuffer{}, threshold: threshold}
+	for _, link := range links {
+		data.originals[link.Entry] = link.Original
+		data.pending[link.Original]++
+	}
+	return data
+}
+
+// original returns the original of the entry at index, and whether the entry is a link.
+func (d *linkedData) original(index uint64) (uint64, bool) {
+	original, isLink := d.originals[index]
+	return original, isLink
+}
+
+// keep returns the buffer the data of the entry at index is kept in, nil when no link points
+// to it.
+func (d *linkedData) keep(index uint64) *utils.SpillBuffer {
+	if d.pending[index] == 0 {
+		return nil
+	}
+	buffer := utils.NewSpillBuffer(d.threshold)
+	d.buffers[index] = buffer
+	return buffer
+}
+
+// writeTo writes the data of the original of the link at index to output. The data is
+// released once the last link to it is written.
+func (d *linkedData) writeTo(index uint64, output io.Writer) error {
+	original := d.originals[index]
+	buffer, found := d.buffers[original]
+	if !found {
+		return fmt.Errorf("the original of entry %d was not extracted", index)
+	}
+	_, err := buffer.WriteTo(output)
+	d.done(index)
+	return err
+}
+
+// done releases the data of the original of the link at index if it was its last link.
+func (d *linkedData) done(index uint64) {
+	original := d.originals[index]
+	d.pending[original]--
+	if buffer, found := d.buffers[original]; found && d.pending[original] == 0 {
+		buffer.Close()
+		delete(d.buffers, original)
+	}
+}
+
+// Close releases the data that is kept, after an error.
+func (d *linkedData) Close() {
+	for index, buffer := range d.buffers {
+		buffer.Close()
+		delete(d.buffers, index)
+	}
+}
@@ -0,0 +1,132 @@
+package hfc
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+// linkedFiles returns three files with the same content, the last two linked to the first,
+// and a file with another content.
+func linkedFiles(content string) []utils.FileData {
+	files := namedFiles(content, "a.txt", "dir/b.txt", "dir/c.txt")
+	files[1].Link = "a.txt"
+	// a link to a link points to the original
+	files[2].Link = "dir/b.txt"
+	return append(files, namedFiles("other", "other.txt")...)
+}
+
+// zipToFile writes the archive of files to a temporary file, Zip needs to seek, and returns it.
+func zipToFile(t *testing.T, files []utils.FileData, opts ...utils.Option) []byte {
+	archivePath := filepath.Join(t.TempDir(), "archive.sq")
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	if err := Zip(files, archive, opts...); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestLinks(t *testing.T) {
+	content := strings.Repeat("the same content in every copy ", 100)
+
+	for _, threads := range []int{1, 4} {
+		data := zipToFile(t, linkedFiles(content), utils.WithThreads(threads))
+
+		// the links have no data, and the checksum and size of their original
+		entries, err := List(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%d threads: failed to list: %v", threads, err)
+		}
+		for _, entry := range entries[1:3] {
+			if entry.CompressedSize != 0 || entry.OriginalSize != uint64(len(content)) || entry.Checksum != entries[0].Checksum {
+				t.Fatalf("%d threads: expected %s to link to %s, got %+v", threads, entry.Name, entries[0].Name, entry)
+			}
+		}
+		if entries[3].CompressedSize == 0 {
+			t.Fatalf("%d threads: expected other.txt to have data", threads)
+		}
+
+		if report := Verify(bytes.NewReader(data)); report.Status != utils.VERIFY_OK {
+			t.Fatalf("%d threads: expected the archive to verify, got %+v", threads, report)
+		}
+
+		outputDir := t.TempDir()
+		if _, err := Unzip(bytes.NewReader(data), outputDir); err != nil {
+			t.Fatalf("%d threads: failed to unzip: %v", threads, err)
+		}
+		for _, name := range []string{"a.txt", "dir/b.txt", "dir/c.txt"} {
+			if extracted, err := os.ReadFile(filepath.Join(outputDir, name)); err != nil || string(extracted) != content {
+				t.Fatalf("%d threads: expected %s to hold the content, got %v", threads, name, err)
+			}
+		}
+	}
+}
+
+func TestLinkWithoutOriginal(t *testing.T) {
+	content := strings.Repeat("linked ", 100)
+	data := zipToFile(t, linkedFiles(content))
+
+	// a link is extracted on its own, its original is decoded but not written
+	outputDir := t.TempDir()
+	paths, err := Unzip(bytes.NewReader(data), outputDir, utils.WithEntries([]string{"dir/c.txt"}))
+	if err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+	if len(paths) != 1 {
+		t.Fatalf("expected only dir/c.txt, got %v", paths)
+	}
+	if extracted, err := os.ReadFile(filepath.Join(outputDir, "dir", "c.txt")); err != nil || string(extracted) != content {
+		t.Fatalf("expected dir/c.txt to hold the content, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected a.txt not to be extracted, got %v", err)
+	}
+}
+
+func TestStreamLinks(t *testing.T) {
+	content := strings.Repeat("the same content in every streamed copy ", 100)
+
+	for _, threads := range []int{1, 4} {
+		var archive bytes.Buffer
+		if err := ZipStream(linkedFiles(content), &archive, utils.WithThreads(threads)); err != nil {
+			t.Fatalf("%d threads: failed to zip: %v", threads, err)
+		}
+		data := archive.Bytes()
+
+		entries, err := ListStream(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%d threads: failed to list: %v", threads, err)
+		}
+		for _, entry := range entries[1:3] {
+			if entry.CompressedSize != 0 || entry.OriginalSize != uint64(len(content)) || entry.Checksum != entries[0].Checksum {
+				t.Fatalf("%d threads: expected %s to link to %s, got %+v", threads, entry.Name, entries[0].Name, entry)
+			}
+		}
+
+		if report := VerifyStream(bytes.NewReader(data)); report.Status != utils.VERIFY_OK {
+			t.Fatalf("%d threads: expected the archive to verify, got %+v", threads, report)
+		}
+
+		outputDir := t.TempDir()
+		if _, err := UnzipStream(bytes.NewReader(data), outputDir); err != nil {
+			t.Fatalf("%d threads: failed to unzip: %v", threads, err)
+		}
+		for _, name := range []string{"a.txt", "dir/b.txt", "dir/c.txt"} {
+			if extracted, err := os.ReadFile(filepath.Join(outputDir, name)); err != nil || string(extracted) != content {
+				t.Fatalf("%d threads: expected %s to hold the content, got %v", threads, name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package hfc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"file-compressor/constants"
+	"file-compressor/format"
+	"file-compressor/utils"
+)
+
+// List reads the entry headers of a Huffman archive without decoding the entry data.
+// Only the names are decompressed, the data is skipped using the stored compressed size.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the Huffman payload.
+//   - opts: Optional settings, only utils.WithFormatVersion is used.
+//
+// Returns:
+//   - []utils.EntryInfo: the entries in archive order
+//   - error: if the archive is truncated or an entry name cannot be decoded
+func List(input io.Reader, opts ...utils.Option) ([]utils.EntryInfo, error) {
+	version := utils.NewOptions(opts...).FormatVersion
+	codes, err := readCodes(input, version)
+	if err != nil {
+		return nil, fmt.Errorf(constants.FAILED_READ_HUFFMAN_CODES, err)
+	}
+	table := NewCanonicalDecoder(codes)
+
+	numOfFiles, err := readNumOfFiles(input)
+	if err != nil {
+		return nil, err
+	}
+	// a link is listed with the sizes and the checksum of its original, and no data
+	if _, err := readLinks(input, version, numOfFiles); err != nil {
+		return nil, err
+	}
+
+	entries := []utils.EntryInfo{}
+	for i := uint64(0); i < numOfFiles; i++ {
+		entry, err := listEntry(input, table)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// listEntry reads the entry header at the start of input and skips the entry data.
+func listEntry(input io.Reader, table *CanonicalDecoder) (utils.EntryInfo, error) {
+	entry, err := readHeader(input, table)
+	if err != nil {
+		return utils.EntryInfo{}, err
+	}
+
+	if err := SkipFile(readSeeker(input), entry.CompressedSize); err != nil {
+		return utils.EntryInfo{}, fmt.Errorf("failed to skip the data of %s: %w", entry.Name, err)
+	}
+
+	return entry, nil
+}
+
+// SkipFile moves r past the data of an entry without decoding it, compressedSize is the size
+// stored in the entry header by Zip. A reader whose Seek fails, such as one returned by
+// readSeeker for a pipe, is read and the data is discarded instead.
+//
+// Parameters:
+//   - r: The archive, positioned at the start of the entry data.
+//   - compressedSize: The compressed size of the entry.
+//
+// Returns:
+//   - error: if r cannot be moved, or ends before the end of the entry when it is read
+func SkipFile(r io.ReadSeeker, compressedSize uint64) error {
+	return utils.SkipBytes(r, compressedSize)
+}
+
+// errNotSeekable is returned by the Seek of a streamReader.
+var errNotSeekable = errors.New("input cannot seek")
+
+// streamReader passes a reader that cannot seek to SkipFile, its Seek always fails.
+type streamReader struct {
+	io.Reader
+}
+
+func (streamReader) Seek(int64, int) (int64, error) {
+	return 0, errNotSeekable
+}
+
+// readSeeker returns input as an io.ReadSeeker for SkipFile, a reader that cannot seek is
+// wrapped in a streamReader.
+func readSeeker(input io.Reader) io.ReadSeeker {
+	if seeker, ok := input.(io.ReadSeeker); ok {
+		return seeker
+	}
+	return streamReader{input}
+}
+
+// ReadHeader reads the entry header at the start of input without touching the entry data,
+// input is positioned at the start of the data afterwards. Only the name is decompressed.
+//
+// Parameters:
+//   - input: An io.Reader positioned at an entry header.
+//   - codes: The Huffman codes read from the start of the archive.
+//
+// Returns:
+//   - utils.EntryInfo: the name, sizes, modification time, mode and checksum of the entry
+//   - error: if the header is truncated or the name cannot be decoded
+func ReadHeader(input io.Reader, codes map[rune]string) (utils.EntryInfo, error) {
+	return readHeader(input, NewCanonicalDecoder(codes))
+}
+
+// readHeader is ReadHeader with the decoder the archive is listed with.
+func readHeader(input io.Reader, table *CanonicalDecoder) (utils.EntryInfo, error) {
+	fileName, err := readFileName(input, table)
+	if err != nil {
+		return utils.EntryInfo{}, err
+	}
+
+	// the name is huffman coded, so the rest of the header is read field by field
+	modTime, err := format.ReadEntryModTime(input)
+	if err != nil {
+		return utils.EntryInfo{}, err
+	}
+	mode, err := format.ReadEntryMode(input)
+	if err != nil {
+		return utils.EntryInfo{}, err
+	}
+	crc, err := format.ReadEntryCRC(input)
+	if err != nil {
+		return utils.EntryInfo{}, err
+	}
+	originalSize, err := format.ReadEntryOriginalSize(input)
+	if err != nil {
+		return utils.EntryInfo{}, err
+	}
+	compressedSize, err := format.ReadEntrySize(input)
+	if err != nil {
+		return utils.EntryInfo{}, err
+	}
+
+	return utils.EntryInfo{
+		Name:           fileName,
+		OriginalSize:   originalSize,
+		CompressedSize: compressedSize,
+		ModTime:        utils.FromUnixNanos(modTime),
+		Mode:           os.FileMode(mode),
+		Checksum:       utils.FormatChecksum(crc),
+	}, nil
+}
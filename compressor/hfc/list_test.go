@@ -0,0 +1,46 @@
+package hfc
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+// onlyReader hides the Seek of the reader below it, like a pipe.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestSkipFile(t *testing.T) {
+	// a reader that cannot seek is read up to the end of the entry
+	input := readSeeker(onlyReader{bytes.NewReader([]byte("entry datanext"))})
+	if err := SkipFile(input, uint64(len("entry data"))); err != nil {
+		t.Fatalf("failed to skip: %v", err)
+	}
+	if rest, err := io.ReadAll(input); err != nil || string(rest) != "next" {
+		t.Fatalf("expected the next entry to follow, got %q, %v", rest, err)
+	}
+	if err := SkipFile(readSeeker(onlyReader{bytes.NewReader([]byte("short"))}), 10); err == nil {
+		t.Fatal("expected an error for an entry cut short")
+	}
+
+	// the entries before and after the selected one are skipped without being decoded
+	data := zipToFile(t, namedFiles("some content of every file", "first.txt", "second.txt", "third.txt"))
+	outputDir := t.TempDir()
+	paths, err := Unzip(onlyReader{bytes.NewReader(data)}, outputDir, utils.WithEntries([]string{"second.txt"}))
+	if err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != filepath.Join(outputDir, "second.txt") {
+		t.Fatalf("expected only second.txt, got %v", paths)
+	}
+	for _, name := range []string{"first.txt", "third.txt"} {
+		if _, err := os.Stat(filepath.Join(outputDir, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s should not be extracted, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package hfc
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"file-compressor/metrics"
+	"file-compressor/utils"
+)
+
+func TestZipUnzipMetrics(t *testing.T) {
+	dir := t.TempDir()
+	contents := []string{"first file content", "second file, a little longer than the first", "third"}
+
+	files := []utils.FileData{}
+	total := int64(0)
+	for i, content := range contents {
+		files = append(files, utils.FileData{
+			Name:   filepath.Join("dir", string(rune('a'+i))+".txt"),
+			Size:   int64(len(content)),
+			Reader: bytes.NewReader([]byte(content)),
+		})
+		total += int64(len(content))
+	}
+
+	archivePath := filepath.Join(dir, "archive")
+	output, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+
+	m := metrics.NewExpvar("")
+	if err := Zip(files, output, utils.WithMetrics(m)); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+	output.Close()
+
+	compress := []string{metrics.LABEL_ALGORITHM, string(utils.HUFFMAN), metrics.LABEL_OPERATION, metrics.OP_COMPRESS}
+	if got := m.CounterValue(metrics.BYTES_IN, compress...); got != total {
+		t.Fatalf("expected %d bytes in, got %d", total, got)
+	}
+	if got := m.CounterValue(metrics.ENTRIES, compress...); got != int64(len(contents)) {
+		t.Fatalf("expected %d entries, got %d", len(contents), got)
+	}
+	if m.CounterValue(metrics.BYTES_OUT, compress...) <= 0 {
+		t.Fatal("expected compressed bytes to be counted")
+	}
+
+	input, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	defer input.Close()
+
+	if _, err := Unzip(input, filepath.Join(dir, "out"), utils.WithMetrics(m)); err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+
+	decompress := []string{metrics.LABEL_ALGORITHM, string(utils.HUFFMAN), metrics.LABEL_OPERATION, metrics.OP_DECOMPRESS}
+	if got := m.CounterValue(metrics.BYTES_OUT, decompress...); got != total {
+		t.Fatalf("expected %d bytes out, got %d", total, got)
+	}
+	if got := m.Histogram(metrics.ENTRY_DURATION, decompress...); got == nil || got.Count() != uint64(len(contents)) {
+		t.Fatalf("expected %d observed durations", len(contents))
+	}
+}
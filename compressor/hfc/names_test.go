@@ -0,0 +1,69 @@
+package hfc
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+func TestUnzipTruncateLongNames(t *testing.T) {
+	longName := filepath.Join("dir", strings.Repeat("n", 300)+".txt")
+	files := []utils.FileData{
+		{Name: longName, Size: 4, Reader: bytes.NewReader([]byte("long"))},
+		{Name: filepath.Join("dir", "short.txt"), Size: 5, Reader: bytes.NewReader([]byte("short"))},
+	}
+
+	archivePath := filepath.Join(t.TempDir(), "archive")
+	output, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	if err := Zip(files, output); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+	output.Close()
+
+	input, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	defer input.Close()
+
+	outputDir := t.TempDir()
+	paths, err := Unzip(input, outputDir, utils.WithTruncateLongNames(true))
+	if err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+
+	if len(paths) != 3 || filepath.Base(paths[2]) != utils.RENAMED_MANIFEST {
+		t.Fatalf("expected both files and the rename manifest, got %v", paths)
+	}
+
+	expected := filepath.Join(outputDir, utils.ShortenName(longName, utils.MAX_NAME_COMPONENT_LEN))
+	if paths[0] != expected {
+		t.Fatalf("expected %s, got %s", expected, paths[0])
+	}
+	if content, err := os.ReadFile(paths[0]); err != nil || string(content) != "long" {
+		t.Fatalf("shortened file has the wrong content: %v", err)
+	}
+	if paths[1] != filepath.Join(outputDir, "dir", "short.txt") {
+		t.Fatalf("short names should be kept: %s", paths[1])
+	}
+
+	data, err := os.ReadFile(paths[2])
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	renamed := []utils.RenamedEntry{}
+	if err := json.Unmarshal(data, &renamed); err != nil {
+		t.Fatalf("failed to decode manifest: %v", err)
+	}
+	if len(renamed) != 1 || renamed[0].Original != longName {
+		t.Fatalf("the manifest should record the original name: %s", data)
+	}
+}
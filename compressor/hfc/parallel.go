@@ -0,0 +1,282 @@
+package hfc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"file-compressor/constants"
+	"file-compressor/format"
+	"file-compressor/metrics"
+	"file-compressor/utils"
+)
+
+// compressedEntry is the data of a file compressed by a worker of zipEntriesParallel.
+type compressedEntry struct {
+	data         *utils.SpillBuffer
+	crc          uint32
+	originalSize int64
+	duration     time.Duration
+}
+
+// zipEntriesParallel compresses up to options.Threads files at the same time into buffers
+// that spill to temporary files above options.SpillThreshold bytes. The entries are
+// written in the order of files with their final checksums and sizes, so the archive is the
+// same as the one zipFiles writes on a single thread. ZipStream passes streamed to precede every
+// entry with its marker.
+//
+// Parameters:
+//   - files: the files to compress, each Reader is only used by one worker
+//   - output: the writer receiving the entries, positioned after the entry count
+//   - options: the threads, metrics and progress callback
+//   - algorithm: selects the preprocessing of the entry data, see encodeData
+//   - codes: the Huffman codes built for all files
+//   - links: fills in the headers of the links, nil when there are none
+//   - streamed: writes the entry marker of the ZipStream payload before every entry
+//
+// Returns:
+//   - error: the first failure, naming the file that could not be compressed
+func zipEntriesParallel(files []utils.FileData, output io.Writer, options utils.Options, algorithm utils.Algorithm, codes map[rune]string, links *entryLinks, streamed bool) error {
+	total := utils.TotalSize(files)
+
+	work := func(ctx context.Context, i int) (compressedEntry, error) {
+		start := time.Now()
+		// a failing worker cancels the others at their next read
+		reader := &utils.CountingReader{Reader: utils.CancelReader(ctx, files[i].Reader)}
+		checksum := crc32.NewIEEE()
+		data := utils.NewSpillBuffer(options.SpillThreshold)
+
+		if _, err := compressData(encodeData(algorithm, io.TeeReader(reader, checksum)), data, codes); err != nil {
+			data.Close()
+			return compressedEntry{}, fmt.Errorf("failed to compress %s: %w", files[i].Name, utils.ContextError(ctx, err))
+		}
+
+		return compressedEntry{data: data, crc: checksum.Sum32(), originalSize: reader.BytesRead, duration: time.Since(start)}, nil
+	}
+
+	emit := func(i int, entry compressedEntry) error {
+		defer entry.data.Close()
+
+		header := entryHeader(files[i])
+		header.CRC32, header.OriginalSize = links.sums(i, entry.crc, uint64(entry.originalSize))
+		header.CompressedSize = uint64(entry.data.Len())
+
+		if streamed {
+			if err := format.WriteEntryMarker(output, true); err != nil {
+				return err
+			}
+		}
+		if err := writeEntryHeader(files[i].Name, header, output, codes); err != nil {
+			return err
+		}
+		if _, err := entry.data.WriteTo(output); err != nil {
+			return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+		}
+
+		metrics.RecordEntry(options.Metrics, string(algorithm), metrics.OP_COMPRESS, entry.originalSize, entry.data.Len(), entry.duration)
+		options.Progress(files[i].Name, entry.originalSize, total)
+		return nil
+	}
+
+	discard := func(entry compressedEntry) {
+		entry.data.Close()
+	}
+
+	if err := utils.RunOrdered(options.Context, len(files), options.Threads, work, emit, discard); err != nil {
+		return fmt.Errorf(constants.ERROR_COMPRESS, err)
+	}
+	return nil
+}
+
+// BLOCK_SIZE is the number of bytes of a file ZipParallel codes in one piece.
+const BLOCK_SIZE = 1 << 20
+
+// compressedBlock is a block of a file coded by a worker of ZipParallel. The codes rarely end on
+// a byte boundary, the bits after the last complete byte are kept apart and joined with the next
+// block when it is written.
+type compressedBlock struct {
+	data  []byte
+	bits  uint64 // the bits after data, in the low count bits
+	count uint
+}
+
+// ZipParallel writes the same archive as Zip, but splits every file into blocks of BLOCK_SIZE
+// bytes that are coded on up to workers goroutines, so a single large file is compressed on
+// several cores. The blocks are coded with the codes of the whole archive and joined bit by bit
+// in their order, they need no header of their own and Unzip reads the archive as usual.
+//
+// Parameters:
+//   - files: A slice of utils.FileData representing the files to be compressed.
+//   - output: An io.Writer where the compressed data will be written, it must seek like for Zip.
+//   - workers: The number of goroutines coding blocks, 0 or less uses one per CPU.
+//   - opts: Optional settings such as utils.WithMetrics, utils.WithThreads is replaced by workers.
+//
+// Returns:
+//   - error: An error if any step in the compression process fails, or ErrFileChanged when a
+//     file is shorter or longer than it was when the codes were built.
+func ZipParallel(files []utils.FileData, output io.Writer, workers int, opts ...utils.Option) error {
+	options := utils.NewOptions(append(opts, utils.WithThreads(workers))...)
+
+	if err := zipBlocks(files, output, options, BLOCK_SIZE); err != nil {
+		metrics.RecordError(options.Metrics, string(utils.HUFFMAN), metrics.OP_COMPRESS, err)
+		return err
+	}
+
+	return nil
+}
+
+// zipBlocks writes the archive of ZipParallel with blocks of blockSize bytes.
+func zipBlocks(files []utils.FileData, output io.Writer, options utils.Options, blockSize int) error {
+	seeker, ok := output.(io.Seeker)
+	if !ok {
+		return errors.New("huffman output must support seeking, use ZipStream otherwise")
+	}
+
+	files, linkTable, links := linkFiles(files)
+
+	files, release, err := bufferUnseekable(files, options)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	codes, err := generateCodes(&files, output, utils.HUFFMAN, options)
+	if err != nil {
+		return fmt.Errorf("error preparing codes: %w", err)
+	}
+
+	if err := writeNumOfFiles(uint64(len(files)), output); err != nil {
+		return err
+	}
+	if err := format.WriteLinkTable(output, linkTable); err != nil {
+		return err
+	}
+
+	table := newCodeTable(codes)
+	total := utils.TotalSize(files)
+
+	for i, file := range files {
+		start := time.Now()
+
+		if err := writeEntryHeader(file.Name, entryHeader(file), output, codes); err != nil {
+			return err
+		}
+
+		checksum := crc32.NewIEEE()
+		originalSize, compressedLen, err := zipFileBlocks(file, output, table, checksum, options, blockSize)
+		if err != nil {
+			return err
+		}
+
+		crc, size := links.sums(i, checksum.Sum32(), uint64(originalSize))
+		if err := writeEntrySizes(output, seeker, crc, size, compressedLen); err != nil {
+			return err
+		}
+
+		metrics.RecordEntry(options.Metrics, string(utils.HUFFMAN), metrics.OP_COMPRESS, originalSize, int64(compressedLen), time.Since(start))
+		options.Progress(file.Name, originalSize, total)
+	}
+
+	return nil
+}
+
+// zipFileBlocks codes the data of file in blocks of blockSize bytes on options.Threads
+// goroutines and writes it to output like compressData does. The blocks are read one after
+// another, the reader is only passed on to the worker of the next block once a block is read,
+// so the reading overlaps with the coding of the blocks before it.
+//
+// Returns:
+//   - int64: the number of bytes read from file
+//   - uint64: the number of bytes written to output
+//   - error: the first failure, naming the file
+func zipFileBlocks(file utils.FileData, output io.Writer, table *codeTable, checksum hash.Hash32, options utils.Options, blockSize int) (int64, uint64, error) {
+	seeker := file.Reader.(io.Seeker)
+	size, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+
+	n := int((size + int64(blockSize) - 1) / int64(blockSize))
+	// turns[i] is closed once the blocks before block i are read
+	turns := make([]chan struct{}, n+1)
+	for i := range turns {
+		turns[i] = make(chan struct{})
+	}
+	close(turns[0])
+
+	work := func(ctx context.Context, i int) (compressedBlock, error) {
+		select {
+		case <-turns[i]:
+		case <-ctx.Done():
+			return compressedBlock{}, ctx.Err()
+		}
+
+		data := make([]byte, min(int64(blockSize), size-int64(i)*int64(blockSize)))
+		_, err := io.ReadFull(utils.CancelReader(ctx, file.Reader), data)
+		checksum.Write(data)
+		close(turns[i+1])
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return compressedBlock{}, fmt.Errorf("%s: %w", file.Name, ErrFileChanged)
+		}
+		if err != nil {
+			return compressedBlock{}, fmt.Errorf("failed to compress %s: %w", file.Name, utils.ContextError(ctx, err))
+		}
+
+		// processByte hands the completed bytes to its output and keeps them in bits.out
+		bits := bitWriter{}
+		length := uint64(0)
+		if err := processByte(data, io.Discard, table, &bits, &length); err != nil {
+			return compressedBlock{}, fmt.Errorf("failed to compress %s: %w", file.Name, err)
+		}
+		return compressedBlock{data: bits.out, bits: bits.bits & (1<<bits.count - 1), count: bits.count}, nil
+	}
+
+	bits := bitWriter{}
+	compressedLen := uint64(0)
+	emit := func(i int, block compressedBlock) error {
+		bits.out = bits.out[:0]
+		if bits.count == 0 {
+			if _, err := output.Write(block.data); err != nil {
+				return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+			}
+			compressedLen += uint64(len(block.data))
+		} else {
+			// shifted by the bits of the blocks before it that do not fill a byte
+			for _, b := range block.data {
+				bits.write(uint64(b), 8)
+			}
+		}
+		bits.write(block.bits, uint8(block.count))
+
+		if _, err := output.Write(bits.out); err != nil {
+			return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+		}
+		compressedLen += uint64(len(bits.out))
+		return nil
+	}
+
+	if err := utils.RunOrdered(options.Context, n, options.Threads, work, emit, nil); err != nil {
+		return 0, 0, fmt.Errorf(constants.ERROR_COMPRESS, err)
+	}
+
+	// a file that grew since its size was taken would be cut
+	if read, _ := file.Reader.Read(make([]byte, 1)); read > 0 {
+		return 0, 0, fmt.Errorf(constants.ERROR_COMPRESS, fmt.Errorf("%s: %w", file.Name, ErrFileChanged))
+	}
+	if size == 0 {
+		return 0, 0, nil
+	}
+
+	// the remaining bits padded with zeros, followed by the number of bits used in them
+	if _, err := output.Write([]byte{bits.pending(), byte(bits.count)}); err != nil {
+		return 0, 0, fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+	return size, compressedLen + 2, nil
+}
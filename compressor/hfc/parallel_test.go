@@ -0,0 +1,257 @@
+package hfc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+var errReadFailed = errors.New("read failed")
+
+// secondPassErrorReader reads like its bytes.Reader until it is rewound, then fails, so the
+// codes are built but compressing the file fails.
+type secondPassErrorReader struct {
+	*bytes.Reader
+	rewound bool
+}
+
+func (r *secondPassErrorReader) Read(p []byte) (int, error) {
+	if r.rewound {
+		return 0, errReadFailed
+	}
+	return r.Reader.Read(p)
+}
+
+func (r *secondPassErrorReader) Seek(offset int64, whence int) (int64, error) {
+	r.rewound = r.rewound || whence == io.SeekStart
+	return r.Reader.Seek(offset, whence)
+}
+
+// manyTestFiles returns count small text files with different contents.
+func manyTestFiles(count int) []utils.FileData {
+	files := []utils.FileData{}
+	for i := 0; i < count; i++ {
+		content := []byte(strings.Repeat(fmt.Sprintf("line %d of file %d, ", i%7, i), 50+i%13))
+		files = append(files, utils.FileData{Name: fmt.Sprintf("dir/%03d.txt", i), Size: int64(len(content)), Reader: bytes.NewReader(content)})
+	}
+	return files
+}
+
+func zipWithThreads(t testing.TB, files []utils.FileData, threads int) []byte {
+	archivePath := filepath.Join(t.TempDir(), "archive.sq")
+	output, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	defer output.Close()
+
+	for _, file := range files {
+		file.Reader.(io.Seeker).Seek(0, io.SeekStart)
+	}
+	if err := Zip(files, output, utils.WithThreads(threads)); err != nil {
+		t.Fatalf("failed to zip with %d threads: %v", threads, err)
+	}
+
+	archive, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("failed to read the archive: %v", err)
+	}
+	return archive
+}
+
+func TestZipThreadsIdentical(t *testing.T) {
+	files := manyTestFiles(40)
+	serial := zipWithThreads(t, files, 1)
+
+	for _, threads := range []int{2, 8} {
+		if parallel := zipWithThreads(t, files, threads); !bytes.Equal(serial, parallel) {
+			t.Fatalf("the archive written with %d threads differs from the serial one", threads)
+		}
+	}
+
+	outputDir := t.TempDir()
+	paths, err := Unzip(bytes.NewReader(serial), outputDir)
+	if err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+	if len(paths) != len(files) {
+		t.Fatalf("expected %d files, got %d", len(files), len(paths))
+	}
+}
+
+func TestZipParallelError(t *testing.T) {
+	files := manyTestFiles(20)
+	files[13].Reader = &secondPassErrorReader{Reader: bytes.NewReader([]byte("this file cannot be read twice"))}
+
+	output, err := os.Create(filepath.Join(t.TempDir(), "archive.sq"))
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	defer output.Close()
+
+	// the read error is only kept as text by compressData
+	err = Zip(files, output, utils.WithThreads(4))
+	if err == nil || !strings.Contains(err.Error(), errReadFailed.Error()) {
+		t.Fatalf("expected %v, got %v", errReadFailed, err)
+	}
+	if !strings.Contains(err.Error(), files[13].Name) {
+		t.Fatalf("expected the error to name %s, got %v", files[13].Name, err)
+	}
+}
+
+// BenchmarkZipThreads compresses a few hundred small files with a growing number of threads.
+func BenchmarkZipThreads(b *testing.B) {
+	files := manyTestFiles(300)
+	for _, threads := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("threads-%d", threads), func(b *testing.B) {
+			b.SetBytes(utils.TotalSize(files))
+			for i := 0; i < b.N; i++ {
+				zipWithThreads(b, files, threads)
+			}
+		})
+	}
+}
+
+// blockTestData returns size bytes of words from a fixed seed, coded with codes of different
+// lengths so the blocks end inside a byte.
+func blockTestData(size int) []byte {
+	random := rand.New(rand.NewSource(1))
+	words := strings.Fields("squirrels bury acorns in the autumn and forget where 42 of them are\n")
+	data := make([]byte, 0, size+16)
+	for len(data) < size {
+		data = append(data, words[random.Intn(len(words))]...)
+		data = append(data, ' ')
+	}
+	return data[:size]
+}
+
+// zipWithBlocks writes the archive of files with zipBlocks and blocks of blockSize bytes.
+func zipWithBlocks(t testing.TB, files []utils.FileData, workers int, blockSize int) ([]byte, error) {
+	archivePath := filepath.Join(t.TempDir(), "archive.sq")
+	output, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	defer output.Close()
+
+	for _, file := range files {
+		file.Reader.(io.Seeker).Seek(0, io.SeekStart)
+	}
+	if err := zipBlocks(files, output, utils.NewOptions(utils.WithThreads(workers)), blockSize); err != nil {
+		return nil, err
+	}
+
+	archive, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("failed to read the archive: %v", err)
+	}
+	return archive, nil
+}
+
+func TestZipBlocksIdentical(t *testing.T) {
+	large := blockTestData(10_007)
+	files := append(manyTestFiles(3),
+		utils.FileData{Name: "large.txt", Size: int64(len(large)), Reader: bytes.NewReader(large)},
+		utils.FileData{Name: "empty.txt", Reader: bytes.NewReader(nil)},
+	)
+	serial := zipWithThreads(t, files, 1)
+
+	// blocks of one byte, of a few bytes and larger than most files
+	for _, blockSize := range []int{1, 7, 1000, 1 << 16} {
+		for _, workers := range []int{1, 4} {
+			archive, err := zipWithBlocks(t, files, workers, blockSize)
+			if err != nil {
+				t.Fatalf("failed to zip with blocks of %d bytes: %v", blockSize, err)
+			}
+			if !bytes.Equal(serial, archive) {
+				t.Fatalf("the archive written with blocks of %d bytes on %d workers differs from the serial one", blockSize, workers)
+			}
+		}
+	}
+}
+
+func TestZipParallel(t *testing.T) {
+	data := blockTestData(2*BLOCK_SIZE + BLOCK_SIZE/2)
+	archivePath := filepath.Join(t.TempDir(), "archive.sq")
+	output, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	defer output.Close()
+
+	files := []utils.FileData{{Name: "large.txt", Size: int64(len(data)), Reader: bytes.NewReader(data)}}
+	if err := ZipParallel(files, output, 4); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+	archive, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputDir := t.TempDir()
+	if _, err := Unzip(bytes.NewReader(archive), outputDir); err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+	extracted, err := os.ReadFile(filepath.Join(outputDir, "large.txt"))
+	if err != nil || !bytes.Equal(extracted, data) {
+		t.Fatalf("the extracted file does not match the input: %v", err)
+	}
+}
+
+// shrinkingReader reads like its bytes.Reader until it is rewound, then ends after half of it,
+// like a file that is truncated while it is compressed.
+type shrinkingReader struct {
+	*bytes.Reader
+	rewound bool
+}
+
+func (r *shrinkingReader) Read(p []byte) (int, error) {
+	if r.rewound && r.Reader.Len() <= int(r.Reader.Size())/2 {
+		return 0, io.EOF
+	}
+	return r.Reader.Read(p)
+}
+
+func (r *shrinkingReader) Seek(offset int64, whence int) (int64, error) {
+	r.rewound = r.rewound || whence == io.SeekStart
+	return r.Reader.Seek(offset, whence)
+}
+
+func TestZipBlocksFileChanged(t *testing.T) {
+	files := []utils.FileData{{Name: "shrinking.txt", Reader: &shrinkingReader{Reader: bytes.NewReader(blockTestData(1000))}}}
+	if _, err := zipWithBlocks(t, files, 4, 100); !errors.Is(err, ErrFileChanged) {
+		t.Fatalf("expected %v, got %v", ErrFileChanged, err)
+	}
+}
+
+// BenchmarkZipParallel compresses a single file of 50MB with a growing number of workers.
+func BenchmarkZipParallel(b *testing.B) {
+	data := blockTestData(50 << 20)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers-%d", workers), func(b *testing.B) {
+			output, err := os.Create(filepath.Join(b.TempDir(), "archive.sq"))
+			if err != nil {
+				b.Fatalf("failed to create the archive: %v", err)
+			}
+			defer output.Close()
+
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				output.Truncate(0)
+				output.Seek(0, io.SeekStart)
+				files := []utils.FileData{{Name: "large.txt", Size: int64(len(data)), Reader: bytes.NewReader(data)}}
+				if err := ZipParallel(files, output, workers); err != nil {
+					b.Fatalf("failed to zip with %d workers: %v", workers, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package hfc
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+// zipNested writes an archive with one file at the bottom of a depth-level hierarchy
+// and one file in each of its first levels.
+func zipNested(t *testing.T, depth int) string {
+	files := []utils.FileData{}
+	name := ""
+	for i := 0; i < depth; i++ {
+		name = filepath.Join(name, "d")
+		if i < 10 {
+			files = append(files, utils.FileData{Name: filepath.Join(name, "f.txt"), Size: 1, Reader: bytes.NewReader([]byte("x"))})
+		}
+	}
+	files = append(files, utils.FileData{Name: filepath.Join(name, "bottom.txt"), Size: 6, Reader: bytes.NewReader([]byte("bottom"))})
+
+	archivePath := filepath.Join(t.TempDir(), "archive")
+	output, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	defer output.Close()
+
+	if err := Zip(files, output); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+	return archivePath
+}
+
+func unzipNested(t *testing.T, archivePath string, opts ...utils.Option) ([]string, error) {
+	input, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	defer input.Close()
+
+	return Unzip(input, t.TempDir(), opts...)
+}
+
+func TestUnzipDeepHierarchy(t *testing.T) {
+	archivePath := zipNested(t, 200)
+
+	paths, err := unzipNested(t, archivePath)
+	if err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+
+	bottom := paths[len(paths)-1]
+	content, err := os.ReadFile(bottom)
+	if err != nil || string(content) != "bottom" {
+		t.Fatalf("deepest file was not extracted: %v", err)
+	}
+}
+
+func TestUnzipPathLimits(t *testing.T) {
+	archivePath := zipNested(t, 50)
+
+	var limitErr *utils.PathLimitError
+	if _, err := unzipNested(t, archivePath, utils.WithMaxPath(20, 0)); !errors.As(err, &limitErr) {
+		t.Fatalf("expected a PathLimitError for depth, got %v", err)
+	}
+	if _, err := unzipNested(t, archivePath, utils.WithMaxPath(0, 60)); !errors.As(err, &limitErr) {
+		t.Fatalf("expected a PathLimitError for length, got %v", err)
+	}
+}
+
+func TestUnzipFailsCleanlyBeyondOSLimit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("extended-length paths allow this depth on Windows")
+	}
+
+	// 5000 levels exceed PATH_MAX on every Unix
+	archivePath := zipNested(t, 5000)
+
+	_, err := unzipNested(t, archivePath)
+	if err == nil {
+		t.Fatal("expected the OS to refuse the path")
+	}
+	var limitErr *utils.PathLimitError
+	if errors.As(err, &limitErr) {
+		t.Fatalf("the default limits should allow this depth: %v", err)
+	}
+	if !strings.Contains(err.Error(), "failed to") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
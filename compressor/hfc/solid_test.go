@@ -0,0 +1,109 @@
+package hfc
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+// namedFiles returns a file with content for every name.
+func namedFiles(content string, names ...string) []utils.FileData {
+	files := []utils.FileData{}
+	for _, name := range names {
+		files = append(files, utils.FileData{Name: name, Size: int64(len(content)), Reader: bytes.NewReader([]byte(content))})
+	}
+	return files
+}
+
+func TestSolidNames(t *testing.T) {
+	codeTable := func(files []utils.FileData, opts ...utils.Option) []byte {
+		var table bytes.Buffer
+		if _, err := generateCodes(&files, &table, utils.HUFFMAN, utils.NewOptions(opts...)); err != nil {
+			t.Fatalf("failed to generate the codes: %v", err)
+		}
+		return table.Bytes()
+	}
+
+	content := strings.Repeat("abcd", 100) + strings.Repeat("e", 10)
+	short := namedFiles(content, "a", "b")
+	long := namedFiles(content, "eeeeeeeeeeeeeeeeeeeeeee", "eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee")
+
+	// by default the names count like the data, names made of a rare byte change the codes
+	if bytes.Equal(codeTable(short), codeTable(long)) {
+		t.Fatal("expected the names to change the codes")
+	}
+	// without them the codes only depend on the data
+	if !bytes.Equal(codeTable(short, utils.WithNoSolidNames(true)), codeTable(long, utils.WithNoSolidNames(true))) {
+		t.Fatal("expected the names to be left out of the codes")
+	}
+
+	// the bytes of the names that are not in the data still get a code
+	files := namedFiles(content, "dir/XYZ.txt", "dir/sub/other name.txt")
+	archive, err := os.Create(filepath.Join(t.TempDir(), "archive.sq"))
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	defer archive.Close()
+	if err := Zip(files, archive, utils.WithNoSolidNames(true)); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+	if _, err := archive.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	outputDir := t.TempDir()
+	if _, err := Unzip(archive, outputDir); err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(outputDir, file.Name))
+		if err != nil || string(data) != content {
+			t.Fatalf("%s: expected the content back, got %q (%v)", file.Name, data, err)
+		}
+	}
+
+	var streamed bytes.Buffer
+	if err := ZipStream(namedFiles(content, "dir/XYZ.txt"), &streamed, utils.WithNoSolidNames(true)); err != nil {
+		t.Fatalf("failed to zip the stream: %v", err)
+	}
+	entries, err := ListStream(&streamed)
+	if err != nil || len(entries) != 1 || entries[0].Name != "dir/XYZ.txt" {
+		t.Fatalf("expected the entry dir/XYZ.txt, got %+v (%v)", entries, err)
+	}
+}
+
+// BenchmarkSolidNames compares the size of archives whose codes include the names with
+// archives whose codes are built from the data only, for many files with long names and
+// little data and for a few files with more data and names made of other bytes.
+func BenchmarkSolidNames(b *testing.B) {
+	manyNames := []string{}
+	for i := 0; i < 300; i++ {
+		manyNames = append(manyNames, fmt.Sprintf("exports/customers/2024/quarterly-report-%03d.csv", i))
+	}
+	sets := map[string]func() []utils.FileData{
+		"many-long-names": func() []utils.FileData { return namedFiles("id,amount\n1,20\n2,35\n", manyNames...) },
+		"few-names-more-data": func() []utils.FileData {
+			return namedFiles(strings.Repeat("the quick brown fox jumps over the lazy dog\n", 500), "IMG_0001.JPG", "IMG_0002.JPG", "IMG_0003.JPG")
+		},
+	}
+
+	for name, files := range sets {
+		for _, noSolidNames := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/no-solid-names=%v", name, noSolidNames), func(b *testing.B) {
+				var size int64
+				for i := 0; i < b.N; i++ {
+					var archive bytes.Buffer
+					if err := ZipStream(files(), &archive, utils.WithNoSolidNames(noSolidNames)); err != nil {
+						b.Fatalf("failed to zip: %v", err)
+					}
+					size = int64(archive.Len())
+				}
+				b.ReportMetric(float64(size), "bytes")
+			})
+		}
+	}
+}
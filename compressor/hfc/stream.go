@@ -0,0 +1,298 @@
+package hfc
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"time"
+
+	"file-compressor/constants"
+	"file-compressor/format"
+	"file-compressor/metrics"
+	"file-compressor/utils"
+)
+
+// ZipStream compresses multiple files like Zip, but never seeks in output, so it can write to
+// pipes, network connections and buffers. The payload has no entry count, every entry is
+// preceded by a marker instead. The files are read twice: the first pass builds the codes and
+// measures every entry, so its header is written with the final checksum and sizes and the
+// data is streamed after it without being held in memory. With utils.WithThreads the files are
+// compressed at the same time into buffers like Zip does instead. Files whose readers cannot
+// seek are buffered first, see utils.WithSpillThreshold. Like Zip, a file whose
+// utils.FileData.Link names an earlier file is stored as a link to it.
+//
+// Parameters:
+//   - files: A slice of utils.FileData representing the files to be compressed.
+//   - output: An io.Writer where the compressed data will be written.
+//   - opts: Optional settings such as utils.WithMetrics.
+//
+// Returns:
+//   - error: An error if any step in the compression process fails, or ErrFileChanged when a
+//     file reads differently the second time.
+func ZipStream(files []utils.FileData, output io.Writer, opts ...utils.Option) error {
+	options := utils.NewOptions(opts...)
+
+	if err := zipStreamFiles(files, output, options); err != nil {
+		metrics.RecordError(options.Metrics, string(utils.HUFFMAN), metrics.OP_COMPRESS, err)
+		return err
+	}
+
+	return nil
+}
+
+// ErrFileChanged is returned by ZipStream when a file changed between the two passes, the
+// header written before its data would not match it.
+var ErrFileChanged = errors.New("file changed while it was compressed")
+
+// streamEntry is what the first pass of ZipStream learns about a file.
+type streamEntry struct {
+	freq         FrequencyTable
+	crc          uint32
+	originalSize uint64
+}
+
+// compressedSize returns the number of bytes compressData writes for the entry with codes.
+func (e streamEntry) compressedSize(codes map[rune]string) uint64 {
+	if e.originalSize == 0 {
+		return 0
+	}
+	bits := uint64(0)
+	for b, count := range e.freq {
+		if count > 0 {
+			bits += count * uint64(len(codes[rune(b)]))
+		}
+	}
+	// the full bytes, then the last byte and the number of bits used in it
+	return bits/8 + 2
+}
+
+// generateStreamCodes reads every file once like generateCodes, and also returns the
+// frequencies, the checksum and the size of each file.
+func generateStreamCodes(files []utils.FileData, output io.Writer, options utils.Options) (map[rune]string, []streamEntry, error) {
+	freq := FrequencyTable{}
+	entries := make([]streamEntry, len(files))
+
+	for i, file := range files {
+		checksum := crc32.NewIEEE()
+		reader := &utils.CountingReader{Reader: io.TeeReader(file.Reader, checksum)}
+		if err := getFrequencyTable(reader, &entries[i].freq); err != nil {
+			return nil, nil, fmt.Errorf("error generating frequency map for filedata: %w", err)
+		}
+		entries[i].crc = checksum.Sum32()
+		entries[i].originalSize = uint64(reader.BytesRead)
+
+		freq.Add(&entries[i].freq)
+
+		if _, err := file.Reader.(io.Seeker).Seek(0, io.SeekStart); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := addNameFrequencies(&freq, files, options); err != nil {
+		return nil, nil, err
+	}
+
+	codes, err := GetHuffmanCodes(&freq)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := WriteHuffmanCodes(output, codes); err != nil {
+		return nil, nil, fmt.Errorf(constants.FAILED_WRITE_HUFFMAN_CODES, err)
+	}
+
+	return codes, entries, nil
+}
+
+func zipStreamFiles(files []utils.FileData, output io.Writer, options utils.Options) error {
+	// the links are coded like empty files, their data is not read
+	files, table, links := linkFiles(files)
+
+	files, release, err := bufferUnseekable(files, options)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// the parallel workers compress into buffers anyway, the sizes are known before the headers
+	if options.Threads > 1 && len(files) > 1 {
+		codes, err := generateCodes(&files, output, utils.HUFFMAN, options)
+		if err != nil {
+			return fmt.Errorf("error preparing codes: %w", err)
+		}
+		if err := format.WriteLinkTable(output, table); err != nil {
+			return err
+		}
+		if err := zipEntriesParallel(files, output, options, utils.HUFFMAN, codes, links, true); err != nil {
+			return err
+		}
+		return format.WriteEntryMarker(output, false)
+	}
+
+	codes, entries, err := generateStreamCodes(files, output, options)
+	if err != nil {
+		return fmt.Errorf("error preparing codes: %w", err)
+	}
+	if err := format.WriteLinkTable(output, table); err != nil {
+		return err
+	}
+
+	total := utils.TotalSize(files)
+
+	for i, file := range files {
+		start := time.Now()
+		reader := &utils.CountingReader{Reader: file.Reader}
+
+		header := entryHeader(file)
+		header.CRC32, header.OriginalSize = links.sums(i, entries[i].crc, entries[i].originalSize)
+		header.CompressedSize = entries[i].compressedSize(codes)
+
+		if err := format.WriteEntryMarker(output, true); err != nil {
+			return err
+		}
+		if err := writeEntryHeader(file.Name, header, output, codes); err != nil {
+			return err
+		}
+
+		checksum := crc32.NewIEEE()
+		compressedLen, err := compressData(io.TeeReader(reader, checksum), output, codes)
+		if err != nil {
+			return fmt.Errorf(constants.ERROR_COMPRESS, err)
+		}
+		if compressedLen != header.CompressedSize || checksum.Sum32() != entries[i].crc || uint64(reader.BytesRead) != entries[i].originalSize {
+			return fmt.Errorf("%s: %w", file.Name, ErrFileChanged)
+		}
+
+		metrics.RecordEntry(options.Metrics, string(utils.HUFFMAN), metrics.OP_COMPRESS, reader.BytesRead, int64(compressedLen), time.Since(start))
+		options.Progress(file.Name, reader.BytesRead, total)
+	}
+
+	return format.WriteEntryMarker(output, false)
+}
+
+// UnzipStream decompresses an archive written by ZipStream and writes the files below outputPath.
+// If the output path is an empty string, the current directory is used.
+//
+// Parameters:
+//   - input: An io.Reader from which the compressed data is read, it does not need to seek.
+//   - outputPath: A string specifying the directory where the decompressed files will be written.
+//   - opts: Optional settings, the same as for Unzip.
+//
+// Returns:
+//   - A slice of strings containing the paths of the decompressed files.
+//   - An error if any issue occurs during the decompression process.
+func UnzipStream(input io.Reader, outputPath string, opts ...utils.Option) ([]string, error) {
+	options := utils.NewOptions(opts...)
+
+	filePaths, err := unzipStreamFiles(input, outputPath, options)
+	if err != nil {
+		metrics.RecordError(options.Metrics, string(utils.HUFFMAN), metrics.OP_DECOMPRESS, err)
+		return nil, err
+	}
+
+	return filePaths, nil
+}
+
+func unzipStreamFiles(input io.Reader, outputPath string, options utils.Options) ([]string, error) {
+	codes, err := readCodes(input, options.FormatVersion)
+	if err != nil {
+		return nil, fmt.Errorf(constants.FAILED_READ_HUFFMAN_CODES, err)
+	}
+	table := NewCanonicalDecoder(codes)
+
+	links, err := readStreamLinks(input, options.FormatVersion)
+	if err != nil {
+		return nil, err
+	}
+	linked := newLinkedData(links, options.SpillThreshold)
+	defer linked.Close()
+
+	extractor := utils.NewExtractor(outputPath, options)
+
+	numOfFiles := uint64(0)
+	for {
+		next, err := format.ReadEntryMarker(input)
+		if err != nil {
+			return nil, err
+		}
+		if !next {
+			break
+		}
+
+		if err := unzipEntry(input, table, extractor, options, utils.HUFFMAN, linked, numOfFiles); err != nil {
+			return nil, err
+		}
+		numOfFiles++
+	}
+
+	if numOfFiles < 1 {
+		return nil, errors.New("no files to decompress")
+	}
+	if err := checkStreamLinks(links, numOfFiles); err != nil {
+		return nil, err
+	}
+
+	return extractor.Finish()
+}
+
+// readStreamLinks reads the links that follow the code lengths of a streamed payload. The
+// number of entries is only known at the end, see checkStreamLinks.
+func readStreamLinks(input io.Reader, version uint16) ([]format.EntryLink, error) {
+	return readLinks(input, version, math.MaxUint64)
+}
+
+// checkStreamLinks returns an error when a link read by readStreamLinks names an entry past the
+// last one of the payload.
+func checkStreamLinks(links []format.EntryLink, numOfFiles uint64) error {
+	if len(links) > 0 && links[len(links)-1].Entry >= numOfFiles {
+		last := links[len(links)-1]
+		return fmt.Errorf("failed to read the links: invalid link of entry %d to entry %d", last.Entry, last.Original)
+	}
+	return nil
+}
+
+// ListStream reads the entry headers of an archive written by ZipStream, like List.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the Huffman payload.
+//   - opts: Optional settings, only utils.WithFormatVersion is used.
+//
+// Returns:
+//   - []utils.EntryInfo: the entries in archive order
+//   - error: if the archive is truncated or an entry name cannot be decoded
+func ListStream(input io.Reader, opts ...utils.Option) ([]utils.EntryInfo, error) {
+	version := utils.NewOptions(opts...).FormatVersion
+	codes, err := readCodes(input, version)
+	if err != nil {
+		return nil, fmt.Errorf(constants.FAILED_READ_HUFFMAN_CODES, err)
+	}
+	table := NewCanonicalDecoder(codes)
+
+	// a link is listed with the sizes and the checksum of its original, and no data
+	links, err := readStreamLinks(input, version)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []utils.EntryInfo{}
+	for {
+		next, err := format.ReadEntryMarker(input)
+		if err != nil {
+			return nil, err
+		}
+		if !next {
+			if err := checkStreamLinks(links, uint64(len(entries))); err != nil {
+				return nil, err
+			}
+			return entries, nil
+		}
+
+		entry, err := listEntry(input, table)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+}
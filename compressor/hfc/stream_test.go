@@ -0,0 +1,206 @@
+package hfc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+func TestZipStreamThroughPipe(t *testing.T) {
+	contents := map[string]string{"a.txt": "first file content", "dir/b.txt": "second file, a little longer than the first"}
+
+	files := []utils.FileData{}
+	for name, content := range contents {
+		files = append(files, utils.FileData{Name: name, Size: int64(len(content)), Reader: bytes.NewReader([]byte(content))})
+	}
+
+	// a pipe cannot seek, so the sizes can only be written before the data
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(ZipStream(files, writer))
+	}()
+
+	outputDir := t.TempDir()
+	paths, err := UnzipStream(reader, outputDir)
+	if err != nil {
+		t.Fatalf("failed to unzip the stream: %v", err)
+	}
+	if len(paths) != len(contents) {
+		t.Fatalf("expected %d files, got %d", len(contents), len(paths))
+	}
+
+	for name, content := range contents {
+		data, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if string(data) != content {
+			t.Fatalf("%s: expected %q, got %q", name, content, data)
+		}
+	}
+}
+
+func TestListStream(t *testing.T) {
+	content := "some content to list"
+	files := []utils.FileData{{Name: "list.txt", Size: int64(len(content)), Reader: bytes.NewReader([]byte(content))}}
+
+	var archive bytes.Buffer
+	if err := ZipStream(files, &archive); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+
+	entries, err := ListStream(&archive)
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name != "list.txt" || entries[0].OriginalSize != uint64(len(content)) {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+}
+
+func TestVerifyStream(t *testing.T) {
+	first := []byte("a short first file")
+	second := bytes.Repeat([]byte("the second file is much longer "), 100)
+	files := []utils.FileData{
+		{Name: "first.txt", Size: int64(len(first)), Reader: bytes.NewReader(first)},
+		{Name: "second.txt", Size: int64(len(second)), Reader: bytes.NewReader(second)},
+	}
+
+	var archive bytes.Buffer
+	if err := ZipStream(files, &archive); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+
+	report := VerifyStream(bytes.NewReader(archive.Bytes()))
+	if report.Status != utils.VERIFY_OK || report.Entries != 2 {
+		t.Fatalf("expected 2 intact entries, got %+v", report)
+	}
+
+	// the data of second.txt ends right before the end marker
+	damaged := archive.Bytes()
+	damaged[len(damaged)-20] ^= 0xff
+	report = VerifyStream(bytes.NewReader(damaged))
+	if report.Status != utils.VERIFY_DAMAGED || report.Checked != 2 {
+		t.Fatalf("expected both entries to be checked, got %+v", report)
+	}
+	if len(report.Failures) != 1 || report.Failures[0].Name != "second.txt" {
+		t.Fatalf("expected a single failure in second.txt, got %+v", report.Failures)
+	}
+}
+
+func TestZipRequiresSeekableOutput(t *testing.T) {
+	files := []utils.FileData{{Name: "a.txt", Size: 1, Reader: bytes.NewReader([]byte("a"))}}
+	if err := Zip(files, &bytes.Buffer{}); err == nil {
+		t.Fatal("Zip should fail instead of panicking when the output cannot seek")
+	}
+}
+
+func TestZipStreamThreadsIdentical(t *testing.T) {
+	files := manyTestFiles(40)
+
+	zipStream := func(threads int) []byte {
+		for _, file := range files {
+			file.Reader.(io.Seeker).Seek(0, io.SeekStart)
+		}
+		var archive bytes.Buffer
+		if err := ZipStream(files, &archive, utils.WithThreads(threads)); err != nil {
+			t.Fatalf("failed to zip with %d threads: %v", threads, err)
+		}
+		return archive.Bytes()
+	}
+
+	serial := zipStream(1)
+	if parallel := zipStream(4); !bytes.Equal(serial, parallel) {
+		t.Fatal("the archive written with 4 threads differs from the one written with 1 thread")
+	}
+
+	paths, err := UnzipStream(bytes.NewReader(serial), t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to unzip the stream: %v", err)
+	}
+	if len(paths) != len(files) {
+		t.Fatalf("expected %d files, got %d", len(files), len(paths))
+	}
+}
+
+// changingReader reads other content once it is rewound to its start.
+type changingReader struct {
+	*bytes.Reader
+	changed []byte
+}
+
+func (r *changingReader) Seek(offset int64, whence int) (int64, error) {
+	if r.changed != nil && whence == io.SeekStart {
+		r.Reader = bytes.NewReader(r.changed)
+		r.changed = nil
+	}
+	return r.Reader.Seek(offset, whence)
+}
+
+func TestZipStreamFileChanged(t *testing.T) {
+	reader := &changingReader{Reader: bytes.NewReader([]byte("abcabc")), changed: []byte("abcab")}
+	files := []utils.FileData{{Name: "a.txt", Size: 6, Reader: reader}}
+
+	if err := ZipStream(files, io.Discard); !errors.Is(err, ErrFileChanged) {
+		t.Fatalf("expected %v, got %v", ErrFileChanged, err)
+	}
+}
+
+func TestZipUnseekableReaders(t *testing.T) {
+	contents := map[string]string{"small.txt": "a small file", "large.txt": strings.Repeat("a file larger than the spill threshold ", 100)}
+
+	// io.NopCloser hides the Seek method of the bytes.Reader
+	unseekable := func() []utils.FileData {
+		files := []utils.FileData{}
+		for _, name := range []string{"small.txt", "large.txt"} {
+			files = append(files, utils.FileData{Name: name, Size: int64(len(contents[name])), Reader: io.NopCloser(bytes.NewReader([]byte(contents[name])))})
+		}
+		return files
+	}
+
+	checkFiles := func(outputDir string) {
+		t.Helper()
+		for name, content := range contents {
+			data, err := os.ReadFile(filepath.Join(outputDir, name))
+			if err != nil || string(data) != content {
+				t.Fatalf("%s: expected %q, got %q (%v)", name, content, data, err)
+			}
+		}
+	}
+
+	// the large file goes to a temporary file
+	opts := []utils.Option{utils.WithSpillThreshold(1024)}
+
+	archive, err := os.Create(filepath.Join(t.TempDir(), "archive.sq"))
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	defer archive.Close()
+	if err := Zip(unseekable(), archive, opts...); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	outputDir := t.TempDir()
+	if _, err := Unzip(archive, outputDir); err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+	checkFiles(outputDir)
+
+	var streamed bytes.Buffer
+	if err := ZipStream(unseekable(), &streamed, opts...); err != nil {
+		t.Fatalf("failed to zip the stream: %v", err)
+	}
+	outputDir = t.TempDir()
+	if _, err := UnzipStream(&streamed, outputDir); err != nil {
+		t.Fatalf("failed to unzip the stream: %v", err)
+	}
+	checkFiles(outputDir)
+}
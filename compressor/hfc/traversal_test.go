@@ -0,0 +1,79 @@
+package hfc
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+// zipEntry returns an archive of a single entry named name.
+func zipEntry(t *testing.T, name, content string) []byte {
+	t.Helper()
+
+	files := []utils.FileData{{Name: name, Size: int64(len(content)), Reader: bytes.NewReader([]byte(content))}}
+	archivePath := filepath.Join(t.TempDir(), "archive")
+	output, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	if err := Zip(files, output); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+	output.Close()
+	archive, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+	return archive
+}
+
+func TestUnzipRejectsPathTraversal(t *testing.T) {
+	archive := zipEntry(t, "../escape.txt", "should never be written")
+
+	root := t.TempDir()
+	target := filepath.Join(root, "target")
+
+	_, err := Unzip(bytes.NewReader(archive), target)
+	var traversalErr *utils.PathTraversalError
+	if !errors.As(err, &traversalErr) {
+		t.Fatalf("expected a PathTraversalError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "../escape.txt") || !strings.Contains(err.Error(), "escapes the output directory") {
+		t.Fatalf("the error should name the entry, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "escape.txt")); !os.IsNotExist(err) {
+		t.Fatalf("nothing should be written outside the target directory, stat returned %v", err)
+	}
+}
+
+func TestUnzipRejectsTraversalNames(t *testing.T) {
+	for _, name := range []string{"../../etc/passwd", "..\\Windows\\System32\\file", "docs/../../escape.txt"} {
+		t.Run(name, func(t *testing.T) {
+			archive := zipEntry(t, name, "should never be written")
+
+			root := t.TempDir()
+			target := filepath.Join(root, "a", "b", "target")
+
+			_, err := Unzip(bytes.NewReader(archive), target)
+			var traversalErr *utils.PathTraversalError
+			if !errors.As(err, &traversalErr) || traversalErr.Name != name {
+				t.Fatalf("expected a PathTraversalError for %s, got %v", name, err)
+			}
+
+			// nothing is created outside of the target directory, nor the directory itself
+			dirEntries, err := os.ReadDir(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(dirEntries) != 0 {
+				t.Fatalf("expected nothing to be written, found %v", dirEntries)
+			}
+		})
+	}
+}
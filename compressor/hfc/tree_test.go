@@ -11,8 +11,8 @@ func TestTree(t *testing.T) {
 	testData := []byte("lorem ipsum dolor sit amet, consectetur adipiscing elit. sed do eiusmod tempor incididunt ut labore et dolore magna aliqua. ut enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat. duis aute irure dolor in reprehenderit in voluptate velit esse cillum dolore eu fugiat nulla pariatur. excepteur sint occaecat cupidatat non proident, sunt in culpa qui officia deserunt mollit anim id est laborum.")
 	reader := bytes.NewBuffer(testData)
 	//make frequency map
-	freq := make(map[rune]int)
-	getFrequencyMap(reader, &freq)
+	freq := FrequencyTable{}
+	getFrequencyTable(reader, &freq)
 
 	//make tree
 	root, err := buildHuffmanTree(&freq)
@@ -57,3 +57,37 @@ func compareHuffmanTrees(t *testing.T, root1, root2 *Node) error {
 
 	return nil
 }
+
+// rebuildHuffmanTree reconstructs a Huffman tree from a given map of runes to their corresponding binary codes.
+// Each rune in the map represents a character, and the associated string represents the binary code for that character.
+// The function returns the root node of the reconstructed Huffman tree. The decoder does not walk
+// a tree, the tests decode with it to check the CanonicalDecoder.
+//
+// Parameters:
+//   codes (map[rune]string): A map where keys are runes (characters) and values are strings representing the binary codes.
+//
+// Returns:
+//   *Node: The root node of the reconstructed Huffman tree.
+func rebuildHuffmanTree(codes map[rune]string) *Node {
+
+	root := &Node{}
+	for char, code := range codes {
+		node := root
+		for _, bit := range code {
+			if bit == '0' {
+				if node.left == nil {
+					node.left = &Node{}
+				}
+				node = node.left
+			} else {
+				if node.right == nil {
+					node.right = &Node{}
+				}
+				node = node.right
+			}
+		}
+		node.char = char
+	}
+
+	return root
+}
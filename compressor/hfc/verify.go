@@ -0,0 +1,233 @@
+package hfc
+
+import (
+	"fmt"
+	"io"
+
+	"file-compressor/constants"
+	"file-compressor/format"
+	"file-compressor/utils"
+)
+
+// Verify decodes every entry of a Huffman archive without writing anything and reports
+// all damaged entries instead of stopping at the first one. After an entry fails to decode,
+// the stored compressed size is used to skip to the next entry header.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the Huffman payload.
+//   - opts: Optional settings, only utils.WithFormatVersion is used.
+//
+// Returns:
+//   - utils.VerifyReport: the collected report. Offsets are relative to the start of input.
+func Verify(input io.Reader, opts ...utils.Option) utils.VerifyReport {
+	return verifyFiles(input, utils.HUFFMAN, utils.NewOptions(opts...).FormatVersion)
+}
+
+// VerifyBWT checks an archive written by ZipBWT, like Verify does for Zip.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the BWT payload.
+//   - opts: Optional settings, only utils.WithFormatVersion is used.
+//
+// Returns:
+//   - utils.VerifyReport: the collected report. Offsets are relative to the start of input.
+func VerifyBWT(input io.Reader, opts ...utils.Option) utils.VerifyReport {
+	return verifyFiles(input, utils.BWT, utils.NewOptions(opts...).FormatVersion)
+}
+
+func verifyFiles(input io.Reader, algorithm utils.Algorithm, version uint16) utils.VerifyReport {
+	report := utils.VerifyReport{}
+	counter := &utils.CountingReader{Reader: input}
+
+	codes, err := readCodes(counter, version)
+	if err != nil {
+		report.Structural = fmt.Sprintf(constants.FAILED_READ_HUFFMAN_CODES, err)
+		report.Finish()
+		return report
+	}
+	table := NewCanonicalDecoder(codes)
+
+	numOfFiles, err := readNumOfFiles(counter)
+	if err != nil {
+		report.Structural = err.Error()
+		report.Finish()
+		return report
+	}
+	report.Entries = numOfFiles
+
+	links, err := readLinks(counter, version, numOfFiles)
+	if err != nil {
+		report.Structural = err.Error()
+		report.Finish()
+		return report
+	}
+	originals := map[uint64]uint64{}
+	for _, link := range links {
+		originals[link.Entry] = link.Original
+	}
+	// the checksums in the headers, a link must repeat the one of its original
+	checksums := make([]uint32, numOfFiles)
+
+	for i := uint64(0); i < numOfFiles; i++ {
+		offset := counter.BytesRead
+
+		var originalCRC *uint32
+		if original, isLink := originals[i]; isLink {
+			originalCRC = &checksums[original]
+		}
+		failure, reachable := verifyEntry(counter, table, algorithm, originalCRC, &checksums[i])
+		report.Checked++
+		if failure != nil {
+			failure.Offset = offset
+			failure.RemainderReachable = reachable && i+1 < numOfFiles
+			report.AddFailure(*failure)
+		}
+
+		if !reachable {
+			break
+		}
+	}
+
+	report.Finish()
+	return report
+}
+
+// VerifyStream checks an archive written by ZipStream, like Verify. The archive does not
+// declare its number of entries, Entries is the number of entries that were reached.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the Huffman payload.
+//   - opts: Optional settings, only utils.WithFormatVersion is used.
+//
+// Returns:
+//   - utils.VerifyReport: the collected report. Offsets are relative to the start of input.
+func VerifyStream(input io.Reader, opts ...utils.Option) utils.VerifyReport {
+	report := utils.VerifyReport{}
+	counter := &utils.CountingReader{Reader: input}
+
+	version := utils.NewOptions(opts...).FormatVersion
+	codes, err := readCodes(counter, version)
+	if err != nil {
+		report.Structural = fmt.Sprintf(constants.FAILED_READ_HUFFMAN_CODES, err)
+		report.Finish()
+		return report
+	}
+	table := NewCanonicalDecoder(codes)
+
+	links, err := readStreamLinks(counter, version)
+	if err != nil {
+		report.Structural = err.Error()
+		report.Finish()
+		return report
+	}
+	originals := map[uint64]uint64{}
+	for _, link := range links {
+		originals[link.Entry] = link.Original
+	}
+	// the checksums in the headers, a link must repeat the one of its original
+	checksums := []uint32{}
+
+	for {
+		next, err := format.ReadEntryMarker(counter)
+		if err != nil {
+			report.Structural = err.Error()
+			break
+		}
+		if !next {
+			break
+		}
+
+		offset := counter.BytesRead
+		index := uint64(len(checksums))
+		checksums = append(checksums, 0)
+
+		var originalCRC *uint32
+		if original, isLink := originals[index]; isLink {
+			originalCRC = &checksums[original]
+		}
+		failure, reachable := verifyEntry(counter, table, utils.HUFFMAN, originalCRC, &checksums[index])
+		report.Checked++
+		if failure != nil {
+			failure.Offset = offset
+			// a marker follows every entry, whether there is another one is unknown here
+			failure.RemainderReachable = reachable
+			report.AddFailure(*failure)
+		}
+
+		if !reachable {
+			break
+		}
+	}
+	report.Entries = report.Checked
+	if report.Structural == "" {
+		if err := checkStreamLinks(links, report.Entries); err != nil {
+			report.Structural = err.Error()
+		}
+	}
+
+	report.Finish()
+	return report
+}
+
+// verifyEntry checks a single entry and stores the checksum of its header in checksum. A link,
+// whose originalCRC is set, has no data and must have the checksum of its original. It returns
+// the failure, if any, and whether the reader is positioned at the next entry header afterwards.
+func verifyEntry(input *utils.CountingReader, table *CanonicalDecoder, algorithm utils.Algorithm, originalCRC *uint32, checksum *uint32) (*utils.EntryFailure, bool) {
+	fileName, err := readFileName(input, table)
+	if err != nil {
+		kind := utils.FAILURE_UNDECODABLE
+		if input.EOF {
+			kind = utils.FAILURE_TRUNCATED
+		}
+		// without the name we cannot reach the size field, so the rest of the archive is lost
+		return &utils.EntryFailure{Kind: kind, Error: err.Error()}, false
+	}
+
+	if _, err := format.ReadEntryModTime(input); err != nil {
+		return &utils.EntryFailure{Name: fileName, Kind: utils.FAILURE_TRUNCATED, Error: err.Error()}, false
+	}
+
+	if _, err := format.ReadEntryMode(input); err != nil {
+		return &utils.EntryFailure{Name: fileName, Kind: utils.FAILURE_TRUNCATED, Error: err.Error()}, false
+	}
+
+	expectedCRC, err := format.ReadEntryCRC(input)
+	if err != nil {
+		return &utils.EntryFailure{Name: fileName, Kind: utils.FAILURE_TRUNCATED, Error: err.Error()}, false
+	}
+
+	if _, err := format.ReadEntryOriginalSize(input); err != nil {
+		return &utils.EntryFailure{Name: fileName, Kind: utils.FAILURE_TRUNCATED, Error: err.Error()}, false
+	}
+
+	compressedSize, err := format.ReadEntrySize(input)
+	if err != nil {
+		return &utils.EntryFailure{Name: fileName, Kind: utils.FAILURE_TRUNCATED, Error: err.Error()}, false
+	}
+	*checksum = expectedCRC
+
+	if originalCRC != nil {
+		if err := SkipFile(readSeeker(input), compressedSize); err != nil {
+			return &utils.EntryFailure{Name: fileName, Kind: utils.FAILURE_TRUNCATED, Error: err.Error()}, false
+		}
+		if compressedSize > 0 {
+			return &utils.EntryFailure{Name: fileName, Kind: utils.FAILURE_UNDECODABLE, Error: "the link has data of its own"}, true
+		}
+		if expectedCRC != *originalCRC {
+			return &utils.EntryFailure{
+				Name:  fileName,
+				Kind:  utils.FAILURE_CRC_MISMATCH,
+				Error: (&utils.ErrChecksumMismatch{Filename: fileName, Expected: expectedCRC, Got: *originalCRC}).Error(),
+			}, true
+		}
+		return nil, true
+	}
+
+	return utils.VerifyEntryData(input, fileName, expectedCRC, compressedSize, func(input io.Reader, output io.Writer, compressedSize uint64) error {
+		decoder := decodeData(algorithm, output)
+		if err := decompressData(input, decoder, table, compressedSize); err != nil {
+			return err
+		}
+		return decoder.Close()
+	})
+}
@@ -0,0 +1,163 @@
+package hfc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+// entrySpan is the position of an entry inside an archive.
+type entrySpan struct {
+	start   int64 // entry header
+	dataEnd int64 // first byte after the compressed data
+}
+
+// buildVerifyArchive zips three files into memory and returns the archive and the span of each entry.
+func buildVerifyArchive(t *testing.T) ([]byte, []entrySpan) {
+	archivePath := filepath.Join(t.TempDir(), "archive")
+	output, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+
+	contents := []string{"first file content", "second file, a little longer than the first", "third"}
+	files := []utils.FileData{}
+	for i, content := range contents {
+		files = append(files, utils.FileData{
+			Name:   filepath.Join("dir", string(rune('a'+i))+".txt"),
+			Size:   int64(len(content)),
+			Reader: bytes.NewReader([]byte(content)),
+		})
+	}
+
+	if err := Zip(files, output); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+	output.Close()
+
+	archive, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("failed to read archive: %v", err)
+	}
+
+	reader := bytes.NewReader(archive)
+	codes, err := ReadHuffmanCodes(reader)
+	if err != nil {
+		t.Fatalf("failed to read codes: %v", err)
+	}
+	numOfFiles, err := readNumOfFiles(reader)
+	if err != nil {
+		t.Fatalf("failed to read number of files: %v", err)
+	}
+	if _, err := readLinks(reader, 0, numOfFiles); err != nil {
+		t.Fatalf("failed to read the links: %v", err)
+	}
+
+	spans := []entrySpan{}
+	for i := uint64(0); i < numOfFiles; i++ {
+		start := reader.Size() - int64(reader.Len())
+		if _, err := readFileName(reader, NewCanonicalDecoder(codes)); err != nil {
+			t.Fatalf("failed to read file name: %v", err)
+		}
+		var modTime, originalSize, size uint64
+		var mode, checksum uint32
+		if err := binary.Read(reader, binary.LittleEndian, &modTime); err != nil {
+			t.Fatalf("failed to read modification time: %v", err)
+		}
+		if err := binary.Read(reader, binary.LittleEndian, &mode); err != nil {
+			t.Fatalf("failed to read mode: %v", err)
+		}
+		if err := binary.Read(reader, binary.LittleEndian, &checksum); err != nil {
+			t.Fatalf("failed to read checksum: %v", err)
+		}
+		if err := binary.Read(reader, binary.LittleEndian, &originalSize); err != nil {
+			t.Fatalf("failed to read original size: %v", err)
+		}
+		if err := binary.Read(reader, binary.LittleEndian, &size); err != nil {
+			t.Fatalf("failed to read size: %v", err)
+		}
+		reader.Seek(int64(size), io.SeekCurrent)
+		spans = append(spans, entrySpan{start: start, dataEnd: reader.Size() - int64(reader.Len())})
+	}
+
+	return archive, spans
+}
+
+func TestVerifyGoodArchive(t *testing.T) {
+	archive, _ := buildVerifyArchive(t)
+
+	report := Verify(bytes.NewReader(archive))
+	if report.Status != utils.VERIFY_OK || report.ExitCode() != utils.EXIT_VERIFY_OK {
+		t.Fatalf("expected ok, got %s: %s", report.Status, report.Table())
+	}
+	if report.Checked != 3 || report.Entries != 3 {
+		t.Fatalf("expected 3 checked entries, got %d of %d", report.Checked, report.Entries)
+	}
+}
+
+func TestVerifyContinuesAfterUndecodableEntry(t *testing.T) {
+	archive, spans := buildVerifyArchive(t)
+
+	// the last byte of an entry is the bit count of its final byte, anything above 8 is invalid
+	archive[spans[1].dataEnd-1] = 0xFF
+
+	report := Verify(bytes.NewReader(archive))
+	if report.Status != utils.VERIFY_DAMAGED || report.ExitCode() != utils.EXIT_VERIFY_DAMAGED {
+		t.Fatalf("expected damaged, got %s", report.Status)
+	}
+	if report.Checked != 3 {
+		t.Fatalf("verification should continue to the last entry, checked %d", report.Checked)
+	}
+	if len(report.Failures) != 1 {
+		t.Fatalf("expected exactly one failure, got %d: %s", len(report.Failures), report.Table())
+	}
+
+	failure := report.Failures[0]
+	if failure.Kind != utils.FAILURE_UNDECODABLE {
+		t.Fatalf("expected undecodable, got %s", failure.Kind)
+	}
+	if failure.Name != filepath.Join("dir", "b.txt") {
+		t.Fatalf("failure names the wrong entry: %s", failure.Name)
+	}
+	if failure.Offset != spans[1].start {
+		t.Fatalf("expected offset %d, got %d", spans[1].start, failure.Offset)
+	}
+	if !failure.RemainderReachable {
+		t.Fatal("the remaining entries should be reachable")
+	}
+}
+
+func TestVerifyTruncatedEntry(t *testing.T) {
+	archive, spans := buildVerifyArchive(t)
+
+	truncated := archive[:spans[2].dataEnd-3]
+
+	report := Verify(bytes.NewReader(truncated))
+	if report.Status != utils.VERIFY_DAMAGED {
+		t.Fatalf("expected damaged, got %s", report.Status)
+	}
+	if len(report.Failures) != 1 || report.Failures[0].Kind != utils.FAILURE_TRUNCATED {
+		t.Fatalf("expected one truncated entry: %s", report.Table())
+	}
+	if report.Failures[0].RemainderReachable {
+		t.Fatal("nothing can be reachable after a truncated entry")
+	}
+}
+
+func TestVerifyUnreadableArchive(t *testing.T) {
+	archive, _ := buildVerifyArchive(t)
+
+	report := Verify(bytes.NewReader(archive[:5]))
+	if report.Status != utils.VERIFY_UNREADABLE || report.ExitCode() != utils.EXIT_VERIFY_UNREADABLE {
+		t.Fatalf("expected unreadable, got %s", report.Status)
+	}
+
+	if _, err := report.JSON(); err != nil {
+		t.Fatalf("failed to encode report: %v", err)
+	}
+}
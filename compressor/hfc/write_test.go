@@ -0,0 +1,107 @@
+package hfc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+var errWriteFailed = errors.New("write failed")
+
+// errorWriter passes limit bytes to w and fails every write after that, like a full disk.
+type errorWriter struct {
+	w       io.Writer
+	limit   int
+	written int
+}
+
+func (e *errorWriter) Write(p []byte) (int, error) {
+	if e.written+len(p) > e.limit {
+		n, _ := e.w.Write(p[:e.limit-e.written])
+		e.written += n
+		return n, errWriteFailed
+	}
+	n, err := e.w.Write(p)
+	e.written += n
+	return n, err
+}
+
+// seekableErrorWriter is an errorWriter over a file, Zip needs to seek back to fill in the sizes.
+type seekableErrorWriter struct {
+	*errorWriter
+	io.Seeker
+}
+
+func writeTestFiles() []utils.FileData {
+	contents := []string{"first file content", "second file, a little longer than the first"}
+	files := []utils.FileData{}
+	for i, content := range contents {
+		name := string(rune('a'+i)) + ".txt"
+		files = append(files, utils.FileData{Name: name, Size: int64(len(content)), Reader: bytes.NewReader([]byte(content))})
+	}
+	return files
+}
+
+func TestWriteHuffmanCodesError(t *testing.T) {
+	codes := map[rune]string{'a': "0", 'b': "10", 'c': "11"}
+
+	encoded := bytes.NewBuffer([]byte{})
+	if err := WriteHuffmanCodes(encoded, codes); err != nil {
+		t.Fatalf("failed to write the codes: %v", err)
+	}
+
+	for limit := 0; limit < encoded.Len(); limit++ {
+		if err := WriteHuffmanCodes(&errorWriter{w: io.Discard, limit: limit}, codes); !errors.Is(err, errWriteFailed) {
+			t.Fatalf("failing after %d bytes: expected %v, got %v", limit, errWriteFailed, err)
+		}
+	}
+
+	if err := writeNumOfFiles(2, &errorWriter{w: io.Discard, limit: 4}); !errors.Is(err, errWriteFailed) {
+		t.Fatalf("expected %v from writeNumOfFiles, got %v", errWriteFailed, err)
+	}
+}
+
+func TestZipStreamWriteError(t *testing.T) {
+	complete := bytes.NewBuffer([]byte{})
+	if err := ZipStream(writeTestFiles(), complete); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+
+	// every byte of the archive is checked, a swallowed error would leave a truncated archive behind
+	for limit := 0; limit < complete.Len(); limit++ {
+		if err := ZipStream(writeTestFiles(), &errorWriter{w: io.Discard, limit: limit}); !errors.Is(err, errWriteFailed) {
+			t.Fatalf("ZipStream failing after %d of %d bytes: expected %v, got %v", limit, complete.Len(), errWriteFailed, err)
+		}
+	}
+}
+
+func TestZipWriteError(t *testing.T) {
+	dir := t.TempDir()
+
+	complete, err := os.Create(filepath.Join(dir, "complete.sqz"))
+	if err != nil {
+		t.Fatalf("failed to create the output: %v", err)
+	}
+	defer complete.Close()
+	counter := &errorWriter{w: complete, limit: 1 << 20}
+	if err := Zip(writeTestFiles(), seekableErrorWriter{counter, complete}); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+
+	for limit := 0; limit < counter.written; limit++ {
+		output, err := os.Create(filepath.Join(dir, "failing.sqz"))
+		if err != nil {
+			t.Fatalf("failed to create the output: %v", err)
+		}
+		err = Zip(writeTestFiles(), seekableErrorWriter{&errorWriter{w: output, limit: limit}, output})
+		output.Close()
+		if !errors.Is(err, errWriteFailed) {
+			t.Fatalf("Zip failing after %d of %d bytes: expected %v, got %v", limit, counter.written, errWriteFailed, err)
+		}
+	}
+}
@@ -1,72 +1,87 @@
 package lampelziv
 
 import (
+	"bufio"
 	"bytes"
-	"encoding/binary"
 	"fmt"
+	"io"
+
+	"file-compressor/format"
 )
 
+// historyLimit is the length the decoded history may grow to before its start is written out,
+// MAX_WINDOW_SIZE bytes are always kept for the matches that follow.
+const historyLimit = 4 * MAX_WINDOW_SIZE
+
 // DecompressData decompresses the given compressed data using a basic Lempel-Ziv algorithm.
 func DecompressData(compressed []byte) ([]byte, error) {
 	uncompressed := bytes.Buffer{}
-	reader := bytes.NewReader(compressed)
+	if err := decompressStream(bufio.NewReader(bytes.NewReader(compressed)), &uncompressed); err != nil {
+		return nil, err
+	}
+	return uncompressed.Bytes(), nil
+}
 
-	for reader.Len() > 0 {
-		flag, err := reader.ReadByte()
+// decompressStream decodes the tokens of input until it ends and writes the data to output.
+func decompressStream(input *bufio.Reader, output io.Writer) error {
+	history := make([]byte, 0, historyLimit+maxLength)
+
+	for {
+		flag, err := input.ReadByte()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to read flag byte: %v", err)
+			return fmt.Errorf("failed to read flag byte: %v", err)
 		}
 
 		switch flag {
 		case 0:
-			err := handleLiteral(reader, &uncompressed)
-			if err != nil {
-				return nil, err
-			}
+			history, err = handleLiteral(input, history)
 		case 1:
-			err := handleMatch(reader, &uncompressed)
-			if err != nil {
-				return nil, err
-			}
+			history, err = handleMatch(input, history)
 		default:
-			return nil, fmt.Errorf("unknown flag in compressed data: %d", flag)
+			return fmt.Errorf("unknown flag in compressed data: %d", flag)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(history) > historyLimit {
+			keep := len(history) - MAX_WINDOW_SIZE
+			if _, err := output.Write(history[:keep]); err != nil {
+				return err
+			}
+			history = history[:copy(history, history[keep:])]
 		}
 	}
 
-	return uncompressed.Bytes(), nil
+	_, err := output.Write(history)
+	return err
 }
 
-func handleLiteral(reader *bytes.Reader, uncompressed *bytes.Buffer) error {
+func handleLiteral(reader *bufio.Reader, history []byte) ([]byte, error) {
 	literal, err := reader.ReadByte()
 	if err != nil {
-		return fmt.Errorf("failed to read literal byte: %v", err)
+		return nil, fmt.Errorf("failed to read literal byte: %v", err)
 	}
-	uncompressed.WriteByte(literal)
-	return nil
+	return append(history, literal), nil
 }
 
-func handleMatch(reader *bytes.Reader, uncompressed *bytes.Buffer) error {
-	var offset uint8
-	var length uint8
-
-	if err := binary.Read(reader, binary.LittleEndian, &offset); err != nil {
-		return fmt.Errorf("failed to read offset: %v", err)
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &length); err != nil {
-		return fmt.Errorf("failed to read length: %v", err)
+func handleMatch(reader *bufio.Reader, history []byte) ([]byte, error) {
+	var fields [matchTokenLen - 1]byte
+	if _, err := io.ReadFull(reader, fields[:]); err != nil {
+		return nil, fmt.Errorf("failed to read offset and length: %v", err)
 	}
+	offset := format.ByteOrder.Uint16(fields[:2])
+	length := format.ByteOrder.Uint16(fields[2:])
 
 	// Validate offset and length
-	start := uncompressed.Len() - int(offset)
-	if start < 0 || start+int(length) > uncompressed.Len() {
-		return fmt.Errorf("invalid length for substring: start=%d, length=%d, buffer length=%d", start, length, uncompressed.Len())
+	start := len(history) - int(offset)
+	if offset == 0 || start < 0 || start+int(length) > len(history) {
+		return nil, fmt.Errorf("invalid length for substring: start=%d, length=%d, buffer length=%d", start, length, len(history))
 	}
 
-	fmt.Printf("Offset: %d, Length: %d\n", offset, length) // Debugging: print offset and length
-
 	// Extract and append the match
-	substr := uncompressed.Bytes()[start : start+int(length)]
-	uncompressed.Write(substr)
-
-	return nil
-}
\ No newline at end of file
+	return append(history, history[start:start+int(length)]...), nil
+}
@@ -2,44 +2,183 @@ package lampelziv
 
 import (
 	"bytes"
-	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"file-compressor/format"
+	"file-compressor/utils"
+)
+
+// Offsets and lengths are stored in 16 bits each, so a match can reach at most
+// MAX_WINDOW_SIZE bytes back and cover at most maxLength bytes.
+const (
+	// MAX_WINDOW_SIZE is the largest window utils.WithWindowSize accepts.
+	MAX_WINDOW_SIZE = math.MaxUint16
+	// DEFAULT_WINDOW_SIZE is the window used when utils.WithWindowSize is not given.
+	DEFAULT_WINDOW_SIZE = 32 << 10
+	maxLength           = math.MaxUint16
+	minMatchLength      = 3
+	// maxCandidates limits the earlier positions compared for every match, long runs of the
+	// same bytes would otherwise compare every position of the window.
+	maxCandidates = 64
+	// blockSize is the number of bytes compressStream reads at a time, matches reach back into
+	// the previous blocks through the window.
+	blockSize = 256 << 10
+	// matchTokenLen is the length of a match token: the flag, the offset and the length.
+	matchTokenLen = 5
 )
 
+// levelWindows is the window of every utils.CompressionLevel, the window of utils.LevelBest is
+// the largest an offset can reach.
+var levelWindows = [...]int{
+	utils.LevelFast: 64,
+	2:               256,
+	3:               1 << 10,
+	4:               4 << 10,
+	5:               8 << 10,
+	6:               16 << 10,
+	7:               32 << 10,
+	8:               48 << 10,
+	utils.LevelBest: MAX_WINDOW_SIZE,
+}
+
+// windowSize returns the window of options: the one of utils.WithWindowSize, the one of
+// utils.WithLevel, or DEFAULT_WINDOW_SIZE when neither is set.
+func windowSize(options utils.Options) (int, error) {
+	window := options.WindowSize
+	if window == 0 && options.Level != 0 {
+		if options.Level < utils.LevelFast || options.Level > utils.LevelBest {
+			return 0, fmt.Errorf("level %d is out of range, it must be between %d and %d", options.Level, utils.LevelFast, utils.LevelBest)
+		}
+		return levelWindows[options.Level], nil
+	}
+	if window == 0 {
+		return DEFAULT_WINDOW_SIZE, nil
+	}
+	if window < 0 || window > MAX_WINDOW_SIZE {
+		return 0, fmt.Errorf("window size %d is out of range, it must be between 1 and %d", window, MAX_WINDOW_SIZE)
+	}
+	return window, nil
+}
+
 // CompressData compresses the input data using a basic Lempel-Ziv algorithm.
-func CompressData(content []byte) ([]byte, error) {
+// Only utils.WithWindowSize and utils.WithLevel are used from opts.
+func CompressData(content []byte, opts ...utils.Option) ([]byte, error) {
+	window, err := windowSize(utils.NewOptions(opts...))
+	if err != nil {
+		return nil, err
+	}
+
 	var compressed bytes.Buffer
-	windowSize := 1024
-	currentPos := 0
+	if err := encode(content, 0, window, &compressed); err != nil {
+		return nil, err
+	}
+	return compressed.Bytes(), nil
+}
+
+// compressStream compresses input block by block, keeping the last window bytes of every block
+// so the matches of the next one can reach back into it.
+func compressStream(input io.Reader, output io.Writer, window int) error {
+	buf := make([]byte, window+blockSize)
+	history := 0
+
+	for {
+		n, err := io.ReadFull(input, buf[history:history+blockSize])
+		if n > 0 {
+			if err := encode(buf[:history+n], history, window, output); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		end := history + n
+		history = min(window, end)
+		copy(buf, buf[end-history:end])
+	}
+}
+
+// encode writes the tokens of content from start on. The bytes before start are the history
+// the matches may reach back into, they are not written.
+func encode(content []byte, start, window int, output io.Writer) error {
 	bufferSize := len(content)
 
+	// positions of every 3 byte sequence seen so far, oldest first
+	chains := make(map[uint32][]int)
+	for pos := max(0, start-window); pos < start && pos+minMatchLength <= bufferSize; pos++ {
+		key := hash3(content, pos)
+		chains[key] = append(chains[key], pos)
+	}
+
+	token := make([]byte, matchTokenLen)
+	currentPos := start
 	for currentPos < bufferSize {
-		bestMatchLength, bestMatchOffset := findBestMatch(content, currentPos, windowSize, bufferSize)
+		bestMatchLength, bestMatchOffset := findBestMatch(content, currentPos, bufferSize, window, chains)
 
-		if bestMatchLength >= 3 { // Minimum match length threshold
+		advance := 1
+		if bestMatchLength >= minMatchLength { // Minimum match length threshold
 			// Encode the match with a flag of 1
-			compressed.WriteByte(1) // Match flag
-			binary.Write(&compressed, binary.LittleEndian, uint8(bestMatchOffset))
-			binary.Write(&compressed, binary.LittleEndian, uint8(bestMatchLength))
-			currentPos += bestMatchLength
+			token[0] = 1 // Match flag
+			format.ByteOrder.PutUint16(token[1:], uint16(bestMatchOffset))
+			format.ByteOrder.PutUint16(token[3:], uint16(bestMatchLength))
+			if _, err := output.Write(token); err != nil {
+				return err
+			}
+			advance = bestMatchLength
 		} else {
 			// Encode literal with a flag of 0
-			compressed.WriteByte(0) // Literal flag
-			compressed.WriteByte(content[currentPos])
-			currentPos++
+			if _, err := output.Write([]byte{0, content[currentPos]}); err != nil {
+				return err
+			}
+		}
+
+		// every consumed position becomes a candidate for later matches
+		for end := currentPos + advance; currentPos < end; currentPos++ {
+			if currentPos+minMatchLength <= bufferSize {
+				key := hash3(content, currentPos)
+				chains[key] = append(chains[key], currentPos)
+			}
 		}
 	}
 
-	return compressed.Bytes(), nil
+	return nil
+}
+
+// hash3 is the key of the 3 bytes starting at pos.
+func hash3(content []byte, pos int) uint32 {
+	return uint32(content[pos])<<16 | uint32(content[pos+1])<<8 | uint32(content[pos+2])
 }
 
-func findBestMatch(content []byte, currentPos, windowSize, bufferSize int) (int, int) {
+// findBestMatch looks up the earlier positions that start with the same 3 bytes as currentPos
+// and returns the length and offset of the longest match inside the window. Only these
+// candidates are compared instead of every position of the window, at most maxCandidates of them.
+func findBestMatch(content []byte, currentPos, bufferSize, window int, chains map[uint32][]int) (int, int) {
 	bestMatchLength := 0
 	bestMatchOffset := 0
 
-	// Search for the best match within the sliding window
-	for offset := max(0, currentPos-windowSize); offset < currentPos; offset++ {
+	if currentPos+minMatchLength > bufferSize {
+		return bestMatchLength, bestMatchOffset
+	}
+
+	key := hash3(content, currentPos)
+	candidates := chains[key]
+
+	// newest first, stop at the first position that left the window
+	for i := len(candidates) - 1; i >= 0 && i >= len(candidates)-maxCandidates; i-- {
+		offset := candidates[i]
+		if currentPos-offset > window {
+			// the older positions are out of the window for every later lookup as well
+			chains[key] = candidates[i+1:]
+			break
+		}
+
 		length := 0
-		for length < bufferSize-currentPos &&
+		for length < bufferSize-currentPos && length < maxLength &&
 			content[offset+length] == content[currentPos+length] {
 			length++
 			if offset+length >= currentPos {
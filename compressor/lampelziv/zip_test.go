@@ -0,0 +1,176 @@
+package lampelziv
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+func TestCompressDecompress(t *testing.T) {
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	inputs := [][]byte{
+		{},
+		[]byte("a"),
+		[]byte("abracadabra abracadabra"),
+		bytes.Repeat([]byte("to be or not to be, "), 100),
+		bytes.Repeat([]byte{0}, 1000),
+		random,
+		append(random, random...), // repeats farther back than the window
+	}
+
+	for _, input := range inputs {
+		compressed, err := CompressData(input)
+		if err != nil {
+			t.Fatalf("failed to compress %d bytes: %v", len(input), err)
+		}
+
+		decompressed, err := DecompressData(compressed)
+		if err != nil {
+			t.Fatalf("failed to decompress %d bytes: %v", len(input), err)
+		}
+		if !bytes.Equal(input, decompressed) {
+			t.Fatalf("round trip of %d bytes returned %d different bytes", len(input), len(decompressed))
+		}
+	}
+}
+
+func TestCompressFindsMatches(t *testing.T) {
+	input := bytes.Repeat([]byte("abcdefgh"), 128)
+
+	compressed, err := CompressData(input)
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	if len(compressed) >= len(input)/4 {
+		t.Fatalf("expected repeated input to compress well, got %d bytes from %d", len(compressed), len(input))
+	}
+}
+
+func BenchmarkCompressLargeInput(b *testing.B) {
+	input := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog. "), 1<<20/45)
+
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := CompressData(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestWindowSize(t *testing.T) {
+	// the second copy starts 1000 bytes after the first, farther than the old 255 byte window
+	random := make([]byte, 1000)
+	rand.New(rand.NewSource(2)).Read(random)
+	input := append(append([]byte{}, random...), random...)
+
+	compressed, err := CompressData(input)
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	// the literals of random data take two bytes each, the repeat a few matches
+	if len(compressed) >= 2*len(random)+100 {
+		t.Fatalf("expected the repeat to be found, got %d bytes from %d", len(compressed), len(input))
+	}
+
+	small, err := CompressData(input, utils.WithWindowSize(500))
+	if err != nil {
+		t.Fatalf("failed to compress with a small window: %v", err)
+	}
+	if len(small) <= len(compressed) {
+		t.Fatalf("expected the small window to miss the repeat, got %d bytes, %d with the default window", len(small), len(compressed))
+	}
+	decompressed, err := DecompressData(small)
+	if err != nil || !bytes.Equal(decompressed, input) {
+		t.Fatalf("round trip with a small window failed: %v", err)
+	}
+
+	if _, err := CompressData(input, utils.WithWindowSize(MAX_WINDOW_SIZE+1)); err == nil {
+		t.Fatal("expected a window larger than MAX_WINDOW_SIZE to fail")
+	}
+}
+
+func TestLevelWindows(t *testing.T) {
+	tests := []struct {
+		opts   []utils.Option
+		window int
+	}{
+		{nil, DEFAULT_WINDOW_SIZE},
+		{[]utils.Option{utils.WithLevel(utils.LevelFast)}, 64},
+		{[]utils.Option{utils.WithLevel(utils.LevelDefault)}, 8 << 10},
+		{[]utils.Option{utils.WithLevel(utils.LevelBest)}, MAX_WINDOW_SIZE},
+		// an explicit window wins over the level
+		{[]utils.Option{utils.WithLevel(utils.LevelFast), utils.WithWindowSize(1000)}, 1000},
+	}
+	for _, test := range tests {
+		window, err := windowSize(utils.NewOptions(test.opts...))
+		if err != nil || window != test.window {
+			t.Fatalf("expected a window of %d, got %d (%v)", test.window, window, err)
+		}
+	}
+
+	if _, err := windowSize(utils.NewOptions(utils.WithLevel(10))); err == nil {
+		t.Fatal("expected level 10 to fail")
+	}
+}
+
+func TestZipUnzip(t *testing.T) {
+	random := make([]byte, blockSize-1000)
+	rand.New(rand.NewSource(3)).Read(random)
+	// the repeat of the last 30000 bytes crosses the block boundary of compressStream
+	large := append(append([]byte{}, random...), random[len(random)-30000:]...)
+	contents := map[string][]byte{
+		"text.txt":  bytes.Repeat([]byte("to be or not to be, "), 5000),
+		"large.bin": large,
+		"empty.txt": {},
+	}
+
+	files := []utils.FileData{}
+	for name, content := range contents {
+		files = append(files, utils.FileData{Name: name, Size: int64(len(content)), Reader: bytes.NewReader(content)})
+	}
+
+	archivePath := filepath.Join(t.TempDir(), "archive")
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	defer archive.Close()
+	if err := Zip(files, archive, utils.WithWindowSize(MAX_WINDOW_SIZE)); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := List(archive)
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.Name == "large.bin" && entry.CompressedSize >= uint64(2*len(random)+1000) {
+			t.Fatalf("expected the repeat across blocks to be found, got %d bytes from %d", entry.CompressedSize, entry.OriginalSize)
+		}
+	}
+	if _, err := archive.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	outputDir := t.TempDir()
+	if _, err := Unzip(archive, outputDir); err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+	for name, content := range contents {
+		data, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil || !bytes.Equal(data, content) {
+			t.Fatalf("%s: the extracted content differs (%v)", name, err)
+		}
+	}
+}
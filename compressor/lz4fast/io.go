@@ -0,0 +1,164 @@
+package lz4fast
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"file-compressor/compressor/framing"
+	"file-compressor/constants"
+	"file-compressor/format"
+	"file-compressor/metrics"
+	"file-compressor/utils"
+)
+
+// Zip compresses multiple files with CompressBlock and writes them to output. It writes the
+// number of files followed by every entry, framed like the other codecs. The data of an entry is
+// split into blocks of BLOCK_SIZE bytes, see compressData. The
+// compressed size of an entry is back-filled after its data, so output must also implement
+// io.Seeker.
+//
+// Parameters:
+//   - files: A slice of utils.FileData representing the files to be compressed.
+//   - output: An io.Writer where the compressed data will be written.
+//   - opts: Optional settings such as utils.WithMetrics.
+//
+// Returns:
+//   - error: An error if any step in the compression process fails.
+func Zip(files []utils.FileData, output io.Writer, opts ...utils.Option) error {
+	options := utils.NewOptions(opts...)
+
+	if err := framing.WriteEntries(files, output, utils.LZ4, compressData, options); err != nil {
+		metrics.RecordError(options.Metrics, string(utils.LZ4), metrics.OP_COMPRESS, err)
+		return err
+	}
+
+	return nil
+}
+
+// compressData splits input into blocks of BLOCK_SIZE bytes and writes every block as its
+// length, the length of the compressed block, 4 bytes each, and the block compressed by
+// CompressBlock. It returns the number of bytes written.
+func compressData(input io.Reader, output io.Writer) (uint64, error) {
+	writer := bufio.NewWriterSize(output, constants.BUFFER_SIZE)
+	block := make([]byte, BLOCK_SIZE)
+	written := uint64(0)
+
+	for {
+		n, err := io.ReadFull(input, block)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return 0, fmt.Errorf(constants.FILE_READ_ERROR, err)
+		}
+
+		compressed, compressErr := CompressBlock(block[:n])
+		if compressErr != nil {
+			return 0, compressErr
+		}
+		header := make([]byte, 0, BLOCK_HEADER_LEN)
+		header = format.ByteOrder.AppendUint32(header, uint32(n))
+		header = format.ByteOrder.AppendUint32(header, uint32(len(compressed)))
+		if _, err := writer.Write(header); err != nil {
+			return 0, err
+		}
+		if _, err := writer.Write(compressed); err != nil {
+			return 0, err
+		}
+		written += uint64(len(header) + len(compressed))
+
+		if err == io.ErrUnexpectedEOF {
+			break
+		}
+	}
+
+	return written, writer.Flush()
+}
+
+// decompressData decodes the blocks of one entry of compressedSize bytes from input into output.
+func decompressData(input io.Reader, output io.Writer, compressedSize uint64) error {
+	reader := &io.LimitedReader{R: input, N: int64(compressedSize)}
+	header := make([]byte, BLOCK_HEADER_LEN)
+	block := make([]byte, BLOCK_SIZE)
+	compressed := []byte{}
+
+	for reader.N > 0 {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return fmt.Errorf("failed to read the block header: %w", err)
+		}
+		length := format.ByteOrder.Uint32(header)
+		compressedLen := format.ByteOrder.Uint32(header[4:])
+		if length > BLOCK_SIZE || int64(compressedLen) > reader.N {
+			return ErrCorruptBlock
+		}
+
+		if cap(compressed) < int(compressedLen) {
+			compressed = make([]byte, compressedLen)
+		}
+		compressed = compressed[:compressedLen]
+		if _, err := io.ReadFull(reader, compressed); err != nil {
+			return fmt.Errorf(constants.FILE_READ_ERROR, err)
+		}
+
+		n, err := DecompressBlock(compressed, block[:length])
+		if err != nil {
+			return err
+		}
+		if n != int(length) {
+			return ErrCorruptBlock
+		}
+		if _, err := output.Write(block[:n]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Unzip decompresses an archive written by Zip from input and writes the files below outputPath.
+// If the output path is an empty string, the current directory is used.
+//
+// Parameters:
+//   - input: An io.Reader from which the compressed data is read.
+//   - outputPath: A string specifying the directory where the decompressed files will be written.
+//   - opts: Optional settings, the same as for hfc.Unzip.
+//
+// Returns:
+//   - A slice of strings containing the paths of the decompressed files.
+//   - An error if any issue occurs during the decompression process.
+func Unzip(input io.Reader, outputPath string, opts ...utils.Option) ([]string, error) {
+	options := utils.NewOptions(opts...)
+
+	filePaths, err := framing.ReadEntries(input, outputPath, utils.LZ4, decompressData, options)
+	if err != nil {
+		metrics.RecordError(options.Metrics, string(utils.LZ4), metrics.OP_DECOMPRESS, err)
+		return nil, err
+	}
+
+	return filePaths, nil
+}
+
+// List reads the entry headers of an archive written by Zip, skipping the entry data.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the LZ4 payload.
+//
+// Returns:
+//   - []utils.EntryInfo: the entries in archive order
+//   - error: if the archive is truncated
+func List(input io.Reader) ([]utils.EntryInfo, error) {
+	return framing.List(input)
+}
+
+// Verify decodes every entry of an LZ4 archive without writing anything and reports all
+// damaged entries, like hfc.Verify.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the LZ4 payload.
+//
+// Returns:
+//   - utils.VerifyReport: the collected report. Offsets are relative to the start of input.
+func Verify(input io.Reader) utils.VerifyReport {
+	return utils.VerifyEntries(input, decompressData)
+}
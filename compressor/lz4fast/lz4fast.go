@@ -0,0 +1,162 @@
+// Package lz4fast implements a simplified LZ4 style block format that trades compression ratio
+// for speed. It is not compatible with the LZ4 frame or block formats.
+package lz4fast
+
+import (
+	"errors"
+	"math"
+
+	"file-compressor/format"
+)
+
+const (
+	// MIN_MATCH_LEN is the shortest match a sequence can describe, the length of the hashed sequences.
+	MIN_MATCH_LEN = 4
+	// MAX_MATCH_LEN is the longest match a single sequence can describe.
+	MAX_MATCH_LEN = math.MaxUint16 + MIN_MATCH_LEN
+	// MAX_OFFSET is the farthest back a match can start.
+	MAX_OFFSET = math.MaxUint16
+	// HASH_TABLE_SIZE is the number of positions remembered by CompressBlock, indexed by the
+	// hash of the 4 bytes starting there.
+	HASH_TABLE_SIZE = 1 << hashBits
+
+	// BLOCK_SIZE is the number of bytes of an entry Zip compresses at once, matches never reach
+	// into the previous block.
+	BLOCK_SIZE = 64 << 10
+	// BLOCK_HEADER_LEN is the length of the original and the compressed length in front of every block Zip writes.
+	BLOCK_HEADER_LEN = 8
+
+	// LITERAL_LEN_LEN, OFFSET_LEN and MATCH_LEN_LEN are the sizes of the fields of a sequence.
+	LITERAL_LEN_LEN = 4
+	OFFSET_LEN      = 2
+	MATCH_LEN_LEN   = 2
+	// SEQUENCE_HEADER_LEN is the overhead of a sequence, CompressBlock only writes matches longer than that.
+	SEQUENCE_HEADER_LEN = LITERAL_LEN_LEN + OFFSET_LEN + MATCH_LEN_LEN
+
+	hashBits = 12
+)
+
+var (
+	// ErrBlockTooLarge is returned by CompressBlock for input whose length does not fit the literal length field.
+	ErrBlockTooLarge = errors.New("lz4fast: block too large")
+	// ErrCorruptBlock is returned by DecompressBlock when a sequence is truncated or refers to data before the block.
+	ErrCorruptBlock = errors.New("lz4fast: corrupt block")
+	// ErrShortBuffer is returned by DecompressBlock when the decompressed data does not fit dst.
+	ErrShortBuffer = errors.New("lz4fast: destination buffer too small")
+)
+
+// CompressBlock compresses src into a series of sequences. Every sequence is the number of
+// literals as a 4 byte little-endian integer, the literals, then the offset of the match as a
+// 2 byte integer and its length minus MIN_MATCH_LEN as a 2 byte integer. The last sequence
+// only has literals, possibly none. Matches are found through a table of the last position
+// of every hashed 4 byte sequence, so the search is a single lookup per position.
+//
+// Parameters:
+//   - src: the data to compress
+//
+// Returns:
+//   - []byte: the compressed block, DecompressBlock restores src from it
+//   - error: ErrBlockTooLarge when src is longer than the literal length field can describe
+func CompressBlock(src []byte) ([]byte, error) {
+	if uint64(len(src)) > math.MaxUint32 {
+		return nil, ErrBlockTooLarge
+	}
+
+	dst := make([]byte, 0, len(src)/2+LITERAL_LEN_LEN)
+	var table [HASH_TABLE_SIZE]int32
+	// positions are stored plus one so the zero value means no position
+	literalStart := 0
+
+	for position := 0; position+MIN_MATCH_LEN <= len(src); {
+		sequence := format.ByteOrder.Uint32(src[position:])
+		hash := hashSequence(sequence)
+		candidate := int(table[hash]) - 1
+		table[hash] = int32(position + 1)
+
+		if candidate < 0 || position-candidate > MAX_OFFSET || format.ByteOrder.Uint32(src[candidate:]) != sequence {
+			position++
+			continue
+		}
+
+		length := MIN_MATCH_LEN
+		for position+length < len(src) && length < MAX_MATCH_LEN && src[candidate+length] == src[position+length] {
+			length++
+		}
+		// a short match costs more than its bytes as literals
+		if length <= SEQUENCE_HEADER_LEN {
+			position++
+			continue
+		}
+
+		dst = appendLiterals(dst, src[literalStart:position])
+		dst = format.ByteOrder.AppendUint16(dst, uint16(position-candidate))
+		dst = format.ByteOrder.AppendUint16(dst, uint16(length-MIN_MATCH_LEN))
+
+		position += length
+		literalStart = position
+	}
+
+	return appendLiterals(dst, src[literalStart:]), nil
+}
+
+// hashSequence maps 4 bytes to an index of the hash table, using the multiplicative hash of LZ4.
+func hashSequence(sequence uint32) uint32 {
+	return (sequence * 2654435761) >> (32 - hashBits)
+}
+
+func appendLiterals(dst, literals []byte) []byte {
+	dst = format.ByteOrder.AppendUint32(dst, uint32(len(literals)))
+	return append(dst, literals...)
+}
+
+// DecompressBlock restores the data of a block written by CompressBlock into dst.
+//
+// Parameters:
+//   - src: the compressed block
+//   - dst: the buffer receiving the decompressed data, it must be large enough to hold it
+//
+// Returns:
+//   - int: the number of bytes written to dst
+//   - error: ErrCorruptBlock for a damaged block, ErrShortBuffer when dst is too small
+func DecompressBlock(src, dst []byte) (int, error) {
+	written := 0
+	for {
+		if len(src) < LITERAL_LEN_LEN {
+			return written, ErrCorruptBlock
+		}
+		literalLen := uint64(format.ByteOrder.Uint32(src))
+		src = src[LITERAL_LEN_LEN:]
+		if literalLen > uint64(len(src)) {
+			return written, ErrCorruptBlock
+		}
+		if literalLen > uint64(len(dst)-written) {
+			return written, ErrShortBuffer
+		}
+		written += copy(dst[written:], src[:literalLen])
+		src = src[literalLen:]
+
+		// the last sequence has no match
+		if len(src) == 0 {
+			return written, nil
+		}
+		if len(src) < OFFSET_LEN+MATCH_LEN_LEN {
+			return written, ErrCorruptBlock
+		}
+		offset := int(format.ByteOrder.Uint16(src))
+		length := int(format.ByteOrder.Uint16(src[OFFSET_LEN:])) + MIN_MATCH_LEN
+		src = src[OFFSET_LEN+MATCH_LEN_LEN:]
+		if offset == 0 || offset > written {
+			return written, ErrCorruptBlock
+		}
+		if length > len(dst)-written {
+			return written, ErrShortBuffer
+		}
+
+		// byte by byte, a match may overlap the data it produces
+		start := written - offset
+		for i := 0; i < length; i++ {
+			dst[written+i] = dst[start+i]
+		}
+		written += length
+	}
+}
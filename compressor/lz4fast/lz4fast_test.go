@@ -0,0 +1,173 @@
+package lz4fast
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+func roundTrip(t *testing.T, input []byte) []byte {
+	t.Helper()
+
+	compressed, err := CompressBlock(input)
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+
+	decompressed := make([]byte, len(input))
+	n, err := DecompressBlock(compressed, decompressed)
+	if err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+	if !bytes.Equal(input, decompressed[:n]) {
+		t.Fatalf("decompressed data does not match the %d byte input", len(input))
+	}
+
+	return compressed
+}
+
+func TestBlockHfcInputs(t *testing.T) {
+	inputs, err := filepath.Glob("../hfc/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	more, err := filepath.Glob("../hfc/input/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inputs = append(inputs, more...)
+	if len(inputs) == 0 {
+		t.Fatal("no hfc test inputs found")
+	}
+
+	for _, input := range inputs {
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			data, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatalf("failed to read the input: %v", err)
+			}
+			roundTrip(t, data)
+		})
+	}
+}
+
+func TestBlockEmpty(t *testing.T) {
+	compressed := roundTrip(t, []byte{})
+
+	// a single sequence without literals
+	if len(compressed) != LITERAL_LEN_LEN {
+		t.Fatalf("expected %d bytes, got %d", LITERAL_LEN_LEN, len(compressed))
+	}
+}
+
+func TestBlockAllZeros(t *testing.T) {
+	compressed := roundTrip(t, make([]byte, 100000))
+
+	// the first 4 zeros are literals, the rest overlapping matches of offset 1
+	if len(compressed) > 100 {
+		t.Fatalf("expected the zeros to compress to a few sequences, got %d bytes", len(compressed))
+	}
+}
+
+func TestBlockRandom(t *testing.T) {
+	input := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(input)
+	compressed := roundTrip(t, input)
+
+	// almost nothing repeats, random data grows by the few sequence headers only
+	if len(compressed) > len(input)+4*LITERAL_LEN_LEN {
+		t.Fatalf("expected at most %d bytes, got %d", len(input)+4*LITERAL_LEN_LEN, len(compressed))
+	}
+}
+
+func TestDecompressBlockErrors(t *testing.T) {
+	compressed, err := CompressBlock(bytes.Repeat([]byte("squirrel "), 100))
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+
+	if _, err := DecompressBlock(compressed[:len(compressed)-1], make([]byte, 900)); !errors.Is(err, ErrCorruptBlock) {
+		t.Fatalf("expected %v for a truncated block, got %v", ErrCorruptBlock, err)
+	}
+	if _, err := DecompressBlock(compressed, make([]byte, 899)); !errors.Is(err, ErrShortBuffer) {
+		t.Fatalf("expected %v for a short buffer, got %v", ErrShortBuffer, err)
+	}
+
+	// a match before the start of the block
+	invalidOffset := []byte{1, 0, 0, 0, 'a', 2, 0, 0, 0, 0, 0, 0, 0}
+	if _, err := DecompressBlock(invalidOffset, make([]byte, 10)); !errors.Is(err, ErrCorruptBlock) {
+		t.Fatalf("expected %v for an invalid offset, got %v", ErrCorruptBlock, err)
+	}
+}
+
+func TestZipUnzip(t *testing.T) {
+	inputs := map[string][]byte{
+		"empty.txt": {},
+		"text.txt":  bytes.Repeat([]byte("the squirrel hides the nuts "), 10000),
+	}
+	random := make([]byte, BLOCK_SIZE+100)
+	rand.New(rand.NewSource(1)).Read(random)
+	inputs["random.bin"] = random
+
+	names := []string{"empty.txt", "text.txt", "random.bin"}
+	files := []utils.FileData{}
+	for _, name := range names {
+		files = append(files, utils.FileData{Name: name, Size: int64(len(inputs[name])), Reader: bytes.NewReader(inputs[name])})
+	}
+
+	archive, err := os.Create(filepath.Join(t.TempDir(), "archive.sq"))
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	defer archive.Close()
+	if err := Zip(files, archive); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+
+	if _, err := archive.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := List(archive)
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(entries) != len(names) {
+		t.Fatalf("expected %d entries, got %d", len(names), len(entries))
+	}
+	if entries[1].CompressedSize >= entries[1].OriginalSize/10 {
+		t.Fatalf("expected the repeated text to compress well, got %d of %d bytes", entries[1].CompressedSize, entries[1].OriginalSize)
+	}
+
+	if _, err := archive.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	outputDir := t.TempDir()
+	paths, err := Unzip(archive, outputDir)
+	if err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+	if len(paths) != len(names) {
+		t.Fatalf("expected %d files, got %d", len(names), len(paths))
+	}
+	for _, name := range names {
+		extracted, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if !bytes.Equal(inputs[name], extracted) {
+			t.Fatalf("%s does not match the original", name)
+		}
+	}
+}
+
+func TestZipRequiresSeeker(t *testing.T) {
+	files := []utils.FileData{{Name: "a.txt", Size: 3, Reader: bytes.NewReader([]byte("abc"))}}
+	if err := Zip(files, &bytes.Buffer{}); err == nil {
+		t.Fatal("expected an error for an output that cannot seek")
+	}
+}
@@ -0,0 +1,117 @@
+package lz77
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"file-compressor/compressor/framing"
+	"file-compressor/constants"
+	"file-compressor/metrics"
+	"file-compressor/utils"
+)
+
+// Zip compresses multiple files with LZ77 and writes them to output.
+// It writes the number of files followed by every entry. The token stream of an entry has no
+// end marker, so its compressed size is back-filled after the data and output must also
+// implement io.Seeker.
+//
+// Parameters:
+//   - files: A slice of utils.FileData representing the files to be compressed.
+//   - output: An io.Writer where the compressed data will be written.
+//   - opts: Optional settings such as utils.WithMetrics.
+//
+// Returns:
+//   - error: An error if any step in the compression process fails.
+func Zip(files []utils.FileData, output io.Writer, opts ...utils.Option) error {
+	options := utils.NewOptions(opts...)
+
+	if err := framing.WriteEntries(files, output, utils.LZ77, compressData, options); err != nil {
+		metrics.RecordError(options.Metrics, string(utils.LZ77), metrics.OP_COMPRESS, err)
+		return err
+	}
+
+	return nil
+}
+
+// compressData writes the tokens of input and returns the number of bytes written.
+// The tokens are buffered because each of them is only a few bytes long.
+func compressData(input io.Reader, output io.Writer) (uint64, error) {
+	counter := &utils.CountingWriter{Writer: output}
+	buffered := bufio.NewWriterSize(counter, constants.BUFFER_SIZE)
+
+	if err := compressLZ77(input, buffered); err != nil {
+		return 0, err
+	}
+	if err := buffered.Flush(); err != nil {
+		return 0, fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+
+	return uint64(counter.BytesWritten), nil
+}
+
+// decompressData decodes one entry of compressedSize bytes from input into output.
+// The whole entry is consumed, so input is positioned at the next entry afterwards.
+func decompressData(input io.Reader, output io.Writer, compressedSize uint64) error {
+	entry := &io.LimitedReader{R: input, N: int64(compressedSize)}
+	buffered := bufio.NewWriterSize(output, constants.BUFFER_SIZE)
+
+	if err := decompressLZ77(bufio.NewReaderSize(entry, constants.BUFFER_SIZE), buffered); err != nil {
+		return fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf(constants.BUFFER_WRITE_ERROR, err)
+	}
+	if entry.N > 0 {
+		return fmt.Errorf("entry data ends %d bytes early", entry.N)
+	}
+
+	return nil
+}
+
+// Unzip decompresses an LZ77 archive from input and writes the files below outputPath.
+// If the output path is an empty string, the current directory is used.
+//
+// Parameters:
+//   - input: An io.Reader from which the compressed data is read.
+//   - outputPath: A string specifying the directory where the decompressed files will be written.
+//   - opts: Optional settings, the same as for hfc.Unzip.
+//
+// Returns:
+//   - A slice of strings containing the paths of the decompressed files.
+//   - An error if any issue occurs during the decompression process.
+func Unzip(input io.Reader, outputPath string, opts ...utils.Option) ([]string, error) {
+	options := utils.NewOptions(opts...)
+
+	filePaths, err := framing.ReadEntries(input, outputPath, utils.LZ77, decompressData, options)
+	if err != nil {
+		metrics.RecordError(options.Metrics, string(utils.LZ77), metrics.OP_DECOMPRESS, err)
+		return nil, err
+	}
+
+	return filePaths, nil
+}
+
+// List reads the entry headers of an LZ77 archive, skipping the entry data.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the LZ77 payload.
+//
+// Returns:
+//   - []utils.EntryInfo: the entries in archive order
+//   - error: if the archive is truncated
+func List(input io.Reader) ([]utils.EntryInfo, error) {
+	return framing.List(input)
+}
+
+// Verify decodes every entry of an LZ77 archive without writing anything and reports all
+// damaged entries, like hfc.Verify.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the lz77 payload.
+//
+// Returns:
+//   - utils.VerifyReport: the collected report. Offsets are relative to the start of input.
+func Verify(input io.Reader) utils.VerifyReport {
+	return utils.VerifyEntries(input, decompressData)
+}
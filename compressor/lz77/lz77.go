@@ -2,16 +2,22 @@ package lz77
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
+
+	"file-compressor/format"
 )
 
+// Token is a back reference of Length bytes starting Offset bytes before the end of the
+// sliding window, followed by a literal Char. Offset and Length are int16 on disk, so a
+// window can never be larger than 32767 bytes without changing the encoding.
 type Token struct {
 	Offset int16
 	Length int16
 	Char   byte
 }
 
-const windowSize = 20
+const windowSize = 20 // must stay below 32768, see Token
 const chunkSize = 32
 
 // LZ77 compression function using io.Reader and io.Writer
@@ -21,32 +27,39 @@ func compressLZ77(r io.Reader, w io.Writer) error {
 
 	for {
 		n, err := r.Read(buffer)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
 		if n == 0 {
 			break
 		}
 
-		if err != nil && err != io.EOF {
+		inputBytes := buffer[:n]
+		if err := processChunk(inputBytes, &slidingWindow, w); err != nil {
 			return err
 		}
-
-		inputBytes := buffer[:n]
-		processChunk(inputBytes, &slidingWindow, w)
 	}
 
 	return nil
 }
 
-func processChunk(inputBytes []byte, slidingWindow *[]byte, w io.Writer) {
+// processChunk writes the tokens of one chunk. A match never covers the last byte of the
+// chunk, so every token carries a literal next char, including 0 bytes.
+func processChunk(inputBytes []byte, slidingWindow *[]byte, w io.Writer) error {
 	for i := 0; i < len(inputBytes); {
 		window := getWindow(*slidingWindow, i)
-		longestOffset, longestLength := findLongestMatch(window, inputBytes[i:])
-		nextChar := getNextChar(inputBytes, i, longestLength)
+		longestOffset, longestLength := findLongestMatch(window, inputBytes[i:len(inputBytes)-1])
+		nextChar := inputBytes[i+int(longestLength)]
 
-		binary.Write(w, binary.LittleEndian, Token{Offset: longestOffset, Length: longestLength, Char: nextChar})
+		if err := binary.Write(w, format.ByteOrder, Token{Offset: longestOffset, Length: longestLength, Char: nextChar}); err != nil {
+			return err
+		}
 
 		*slidingWindow = updateSlidingWindow(*slidingWindow, inputBytes[i:i+int(longestLength)+1])
 		i += int(longestLength) + 1
 	}
+	return nil
 }
 
 func getWindow(slidingWindow []byte, i int) []byte {
@@ -72,13 +85,6 @@ func findLongestMatch(window, inputBytes []byte) (int16, int16) {
 	return longestOffset, longestLength
 }
 
-func getNextChar(inputBytes []byte, i int, longestLength int16) byte {
-	if i+int(longestLength) < len(inputBytes) {
-		return inputBytes[i+int(longestLength)]
-	}
-	return 0
-}
-
 func updateSlidingWindow(slidingWindow, newBytes []byte) []byte {
 	slidingWindow = append(slidingWindow, newBytes...)
 	if len(slidingWindow) > windowSize {
@@ -94,25 +100,29 @@ func decompressLZ77(r io.Reader, w io.Writer) error {
 
 	for {
 		// Read the token from io.Reader
-		err := binary.Read(r, binary.LittleEndian, &token)
+		err := binary.Read(r, format.ByteOrder, &token)
 		if err == io.EOF {
 			break
 		} else if err != nil {
 			return err
 		}
 
-		// Get the match from the sliding window
+		// Get the match from the sliding window, damaged input may point outside of it
 		start := len(slidingWindow) - int(token.Offset)
-		for i := 0; i < int(token.Length); i++ {
-			w.Write([]byte{slidingWindow[start+i]})
-			slidingWindow = append(slidingWindow, slidingWindow[start+i])
+		if token.Length < 0 || start < 0 || start+int(token.Length) > len(slidingWindow) {
+			return fmt.Errorf("invalid lz77 token: offset %d and length %d outside of the %d byte window", token.Offset, token.Length, len(slidingWindow))
+		}
+		match := slidingWindow[start : start+int(token.Length)]
+		if _, err := w.Write(match); err != nil {
+			return err
 		}
+		slidingWindow = append(slidingWindow, match...)
 
 		// Add the next character
-		if token.Char != 0 {
-			w.Write([]byte{token.Char})
-			slidingWindow = append(slidingWindow, token.Char)
+		if _, err := w.Write([]byte{token.Char}); err != nil {
+			return err
 		}
+		slidingWindow = append(slidingWindow, token.Char)
 
 		// Maintain sliding window size
 		if len(slidingWindow) > windowSize {
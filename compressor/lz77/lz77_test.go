@@ -2,8 +2,13 @@ package lz77
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
+	"io"
+	"strings"
 	"testing"
+
+	"file-compressor/format"
 )
 
 func TestLz77(t *testing.T) {
@@ -27,8 +32,8 @@ func TestCompressLZ77(t *testing.T) {
 				{Offset: 0, Length: 0, Char: 'b'},
 				{Offset: 0, Length: 0, Char: 'r'},
 				{Offset: 3, Length: 1, Char: 'c'},
-				{Offset: 4, Length: 1, Char: 'd'},
-				{Offset: 8, Length: 3, Char: 0},
+				{Offset: 5, Length: 1, Char: 'd'},
+				{Offset: 7, Length: 3, Char: 'a'},
 			},
 		},
 		{
@@ -38,7 +43,6 @@ func TestCompressLZ77(t *testing.T) {
 				{Offset: 0, Length: 0, Char: 'a'},
 				{Offset: 0, Length: 0, Char: 'n'},
 				{Offset: 2, Length: 2, Char: 'a'},
-				{Offset: 3, Length: 3, Char: 0},
 			},
 		},
 		{
@@ -49,15 +53,12 @@ func TestCompressLZ77(t *testing.T) {
 				{Offset: 0, Length: 0, Char: ' '},
 				{Offset: 0, Length: 0, Char: 'b'},
 				{Offset: 0, Length: 0, Char: 'e'},
-				{Offset: 0, Length: 0, Char: ' '},
-				{Offset: 0, Length: 0, Char: 'o'},
+				{Offset: 3, Length: 1, Char: 'o'},
 				{Offset: 0, Length: 0, Char: 'r'},
-				{Offset: 0, Length: 0, Char: ' '},
-				{Offset: 0, Length: 0, Char: 'n'},
-				{Offset: 0, Length: 0, Char: 'o'},
-				{Offset: 0, Length: 0, Char: 't'},
-				{Offset: 6, Length: 3, Char: 'b'},
-				{Offset: 2, Length: 2, Char: 0},
+				{Offset: 6, Length: 1, Char: 'n'},
+				{Offset: 9, Length: 1, Char: 't'},
+				{Offset: 10, Length: 1, Char: 't'},
+				{Offset: 13, Length: 3, Char: 'e'},
 			},
 		},
 	}
@@ -69,6 +70,19 @@ func TestCompressLZ77(t *testing.T) {
 		if err != nil {
 			t.Fatalf("compressLZ77 failed: %v", err)
 		}
+
+		for i, expected := range test.expected {
+			var token Token
+			if err := binary.Read(outputBuffer, format.ByteOrder, &token); err != nil {
+				t.Fatalf("%s: failed to read token %d: %v", test.input, i, err)
+			}
+			if token != expected {
+				t.Fatalf("%s: token %d: expected %+v, got %+v", test.input, i, expected, token)
+			}
+		}
+		if outputBuffer.Len() != 0 {
+			t.Fatalf("%s: %d unexpected bytes after the tokens", test.input, outputBuffer.Len())
+		}
 	}
 }
 
@@ -102,3 +116,49 @@ func CheckString(t *testing.T, input string) {
 
 	fmt.Println()
 }
+
+func TestLz77ZeroBytes(t *testing.T) {
+	CheckString(t, "a\x00b\x00a\x00b\x00")
+	CheckString(t, strings.Repeat("\x00", 100))
+	CheckString(t, strings.Repeat("abc\x00", 40))
+}
+
+func TestDecompressInvalidToken(t *testing.T) {
+	tokens := []Token{
+		{Offset: 5, Length: 1, Char: 'a'},  // nothing in the window yet
+		{Offset: 0, Length: 1, Char: 'a'},  // starts at the end of the window
+		{Offset: -1, Length: 0, Char: 'a'}, // negative offset
+		{Offset: 1, Length: -1, Char: 'a'}, // negative length
+	}
+
+	for _, token := range tokens {
+		var input bytes.Buffer
+		binary.Write(&input, format.ByteOrder, Token{Char: 'x'})
+		binary.Write(&input, format.ByteOrder, token)
+
+		if err := decompressLZ77(&input, &bytes.Buffer{}); err == nil {
+			t.Fatalf("expected an error for %+v", token)
+		}
+	}
+}
+
+func FuzzDecompressLZ77(f *testing.F) {
+	for _, seed := range []string{"abracadabra", "banana", "a\x00b\x00a\x00b\x00"} {
+		var compressed bytes.Buffer
+		if err := compressLZ77(strings.NewReader(seed), &compressed); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(compressed.Bytes())
+	}
+	f.Add([]byte{0xFF, 0x7F, 0x01, 0x00, 'a'})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// damaged input must fail with an error, never panic
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("decompressLZ77 panicked on %d bytes: %v", len(data), r)
+			}
+		}()
+		decompressLZ77(bytes.NewReader(data), io.Discard)
+	})
+}
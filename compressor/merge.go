@@ -0,0 +1,198 @@
+package compressor
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"file-compressor/constants"
+	"file-compressor/encryption"
+	"file-compressor/utils"
+)
+
+// mergedEntry is a file extracted from one of the archives merged by MergeArchives.
+type mergedEntry struct {
+	name string
+	path string
+	hash [sha256.Size]byte
+	info os.FileInfo
+}
+
+// MergeArchives combines archives as written by the CLI into one, such as the archives of
+// incremental backups. Like AppendFiles, every input is extracted into a temporary directory
+// next to outputPath and the files are compressed again, so the Huffman codes are built from
+// the files of all inputs and archives of different algorithms can be merged.
+//
+// An entry found in several inputs with the same content is kept once. When the content
+// differs, the entry of the later input replaces the earlier one, the inputs are expected from
+// the oldest to the newest. The merged archive uses the algorithm of the inputs, or
+// utils.HUFFMAN when they differ, and is encrypted with the password and options. outputPath
+// may be one of the inputs, it is only replaced once the merged archive is complete.
+//
+// Parameters:
+//   - inputs: The paths of the archives, from the oldest to the newest.
+//   - password: The password of the inputs and of the merged archive, empty when they have none.
+//   - outputPath: The path of the merged archive.
+//   - options: Optional encryption settings, used to decrypt the inputs and encrypt the merged
+//     archive.
+//
+// Returns:
+//   - error: if no input is given, if an input cannot be decrypted or extracted, or if the
+//     merged archive cannot be written
+func MergeArchives(inputs []string, password, outputPath string, options ...encryption.EncryptionOptions) error {
+	ctx := context.Background()
+
+	if len(inputs) == 0 {
+		return errors.New("no archives to merge")
+	}
+
+	tempDir, err := os.MkdirTemp(filepath.Dir(outputPath), "squirrelzip-merge-*")
+	if err != nil {
+		return fmt.Errorf(constants.FILE_CREATE_ERROR, err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	entries := []mergedEntry{}
+	// the index of every name in entries, so a later input replaces the entry in place
+	indexes := map[string]int{}
+	algorithm := ""
+	for i, input := range inputs {
+		inputDir := filepath.Join(tempDir, fmt.Sprintf("input-%d", i))
+		if err := os.Mkdir(inputDir, 0o700); err != nil {
+			return fmt.Errorf(constants.FILE_CREATE_ERROR, err)
+		}
+
+		inputAlgorithm, err := extractForAppend(ctx, input, password, inputDir, options...)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", input, err)
+		}
+		if i == 0 {
+			algorithm = inputAlgorithm
+		} else if algorithm != inputAlgorithm {
+			algorithm = string(utils.HUFFMAN)
+		}
+
+		extracted, err := extractedEntries(inputDir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range extracted {
+			index, found := indexes[entry.name]
+			switch {
+			case !found:
+				indexes[entry.name] = len(entries)
+				entries = append(entries, entry)
+			case entries[index].hash != entry.hash:
+				entries[index] = entry
+			}
+		}
+	}
+
+	files := []utils.FileData{}
+	for _, entry := range entries {
+		file, err := os.Open(entry.path)
+		if err != nil {
+			return fmt.Errorf(constants.FILE_OPEN_ERROR, err)
+		}
+		defer file.Close()
+
+		files = append(files, utils.FileData{
+			Name:    entry.name,
+			Size:    entry.info.Size(),
+			Reader:  file,
+			ModTime: entry.info.ModTime(),
+			Mode:    entry.info.Mode(),
+		})
+	}
+
+	compressed, err := os.CreateTemp(tempDir, "archive-*"+constants.COMPRESSED_FILE_EXT)
+	if err != nil {
+		return fmt.Errorf(constants.FILE_CREATE_ERROR, err)
+	}
+	defer compressed.Close()
+
+	if err := CompressFileData(files, compressed, algorithm); err != nil {
+		return err
+	}
+	if _, err := compressed.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+
+	// an input is only replaced by the merged archive once it is complete
+	archive, err := os.CreateTemp(filepath.Dir(outputPath), filepath.Base(outputPath)+".*")
+	if err != nil {
+		return fmt.Errorf(constants.FILE_CREATE_ERROR, err)
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	buffered := bufio.NewWriterSize(archive, constants.BUFFER_SIZE)
+	if err := encryption.EncryptStream(ctx, compressed, buffered, password, options...); err != nil {
+		return fmt.Errorf(constants.FAILED_TO_ENCRYPT, err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+
+	if err := os.Rename(archive.Name(), outputPath); err != nil {
+		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+	return nil
+}
+
+// extractedEntries returns the files extracted below dir, named relative to it like the
+// entries they were extracted from, with the SHA-256 hash of their content.
+func extractedEntries(dir string) ([]mergedEntry, error) {
+	entries := []mergedEntry{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("failed to walk path: %v", err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf(constants.FILE_STAT_ERROR, err)
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+
+		entries = append(entries, mergedEntry{name: filepath.ToSlash(name), path: path, hash: hash, info: info})
+		return nil
+	})
+	return entries, err
+}
+
+// hashFile returns the SHA-256 hash of the content of a file, read without loading it whole.
+func hashFile(path string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	file, err := os.Open(path)
+	if err != nil {
+		return sum, fmt.Errorf(constants.FILE_OPEN_ERROR, err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return sum, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	copy(sum[:], hash.Sum(nil))
+	return sum, nil
+}
@@ -0,0 +1,94 @@
+package rle
+
+import (
+	"io"
+
+	"file-compressor/compressor/framing"
+	"file-compressor/metrics"
+	"file-compressor/utils"
+)
+
+// Zip compresses multiple files with run-length encoding and writes them to output.
+// It writes the number of files followed by every entry, framed like the other codecs. The
+// compressed size of an entry is back-filled after its data, so output must also implement
+// io.Seeker.
+//
+// Parameters:
+//   - files: A slice of utils.FileData representing the files to be compressed.
+//   - output: An io.Writer where the compressed data will be written.
+//   - opts: Optional settings such as utils.WithMetrics.
+//
+// Returns:
+//   - error: An error if any step in the compression process fails.
+func Zip(files []utils.FileData, output io.Writer, opts ...utils.Option) error {
+	options := utils.NewOptions(opts...)
+
+	if err := framing.WriteEntries(files, output, utils.RLE, compressData, options); err != nil {
+		metrics.RecordError(options.Metrics, string(utils.RLE), metrics.OP_COMPRESS, err)
+		return err
+	}
+
+	return nil
+}
+
+// compressData writes the run-length encoded blocks of input and returns the number of bytes written.
+func compressData(input io.Reader, output io.Writer) (uint64, error) {
+	counter := &utils.CountingWriter{Writer: output}
+	if err := CompressRLE(input, counter); err != nil {
+		return 0, err
+	}
+	return uint64(counter.BytesWritten), nil
+}
+
+// decompressData decodes one entry of compressedSize bytes from input into output.
+// The blocks have no end marker, the entry ends after compressedSize bytes.
+func decompressData(input io.Reader, output io.Writer, compressedSize uint64) error {
+	return DecompressRLE(&io.LimitedReader{R: input, N: int64(compressedSize)}, output)
+}
+
+// Unzip decompresses a RLE archive from input and writes the files below outputPath.
+// If the output path is an empty string, the current directory is used.
+//
+// Parameters:
+//   - input: An io.Reader from which the compressed data is read.
+//   - outputPath: A string specifying the directory where the decompressed files will be written.
+//   - opts: Optional settings, the same as for hfc.Unzip.
+//
+// Returns:
+//   - A slice of strings containing the paths of the decompressed files.
+//   - An error if any issue occurs during the decompression process.
+func Unzip(input io.Reader, outputPath string, opts ...utils.Option) ([]string, error) {
+	options := utils.NewOptions(opts...)
+
+	filePaths, err := framing.ReadEntries(input, outputPath, utils.RLE, decompressData, options)
+	if err != nil {
+		metrics.RecordError(options.Metrics, string(utils.RLE), metrics.OP_DECOMPRESS, err)
+		return nil, err
+	}
+
+	return filePaths, nil
+}
+
+// List reads the entry headers of a RLE archive, skipping the entry data.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the RLE payload.
+//
+// Returns:
+//   - []utils.EntryInfo: the entries in archive order
+//   - error: if the archive is truncated
+func List(input io.Reader) ([]utils.EntryInfo, error) {
+	return framing.List(input)
+}
+
+// Verify decodes every entry of a RLE archive without writing anything and reports all
+// damaged entries, like hfc.Verify.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the rle payload.
+//
+// Returns:
+//   - utils.VerifyReport: the collected report. Offsets are relative to the start of input.
+func Verify(input io.Reader) utils.VerifyReport {
+	return utils.VerifyEntries(input, decompressData)
+}
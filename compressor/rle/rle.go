@@ -0,0 +1,178 @@
+package rle
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	"file-compressor/constants"
+)
+
+const (
+	// MAX_BLOCK_LEN is the longest run or literal block a single header byte can describe.
+	MAX_BLOCK_LEN = 128
+	// MIN_RUN_LEN is the shortest run that is written as a run, shorter ones are cheaper
+	// as part of a literal block.
+	MIN_RUN_LEN = 3
+	// LITERAL_FLAG marks a header byte that is followed by literal bytes instead of one repeated byte.
+	LITERAL_FLAG = 0x80
+)
+
+// ErrTruncatedBlock is returned by DecompressRLE when the input ends inside a block.
+var ErrTruncatedBlock = errors.New("rle: input ends inside a block")
+
+// CompressRLE encodes r with a PackBits style run-length encoding and writes it to w.
+// A run of N identical bytes is written as [N-1, byte], and N bytes that do not repeat
+// as [0x80|(N-1), bytes...], N being at most MAX_BLOCK_LEN in both cases.
+//
+// Parameters:
+//   - r: the data to encode
+//   - w: the writer receiving the encoded blocks
+//
+// Returns:
+//   - error: if reading r or writing w fails
+func CompressRLE(r io.Reader, w io.Writer) error {
+	reader := bufio.NewReaderSize(r, constants.BUFFER_SIZE)
+	writer := bufio.NewWriterSize(w, constants.BUFFER_SIZE)
+	literals := make([]byte, 0, MAX_BLOCK_LEN)
+
+	flushLiterals := func() error {
+		if len(literals) == 0 {
+			return nil
+		}
+		if err := writer.WriteByte(LITERAL_FLAG | byte(len(literals)-1)); err != nil {
+			return err
+		}
+		if _, err := writer.Write(literals); err != nil {
+			return err
+		}
+		literals = literals[:0]
+		return nil
+	}
+
+	for {
+		current, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf(constants.FILE_READ_ERROR, err)
+		}
+
+		runLen, err := countRun(reader, current)
+		if err != nil {
+			return fmt.Errorf(constants.FILE_READ_ERROR, err)
+		}
+
+		if runLen >= MIN_RUN_LEN {
+			if err := flushLiterals(); err != nil {
+				return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+			}
+			if _, err := writer.Write([]byte{byte(runLen - 1), current}); err != nil {
+				return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+			}
+			continue
+		}
+
+		for i := 0; i < runLen; i++ {
+			literals = append(literals, current)
+			if len(literals) == MAX_BLOCK_LEN {
+				if err := flushLiterals(); err != nil {
+					return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+				}
+			}
+		}
+	}
+
+	if err := flushLiterals(); err != nil {
+		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+
+	return nil
+}
+
+// countRun returns how often current repeats, itself included, consuming the repetitions
+// from reader up to MAX_BLOCK_LEN.
+func countRun(reader *bufio.Reader, current byte) (int, error) {
+	runLen := 1
+	for runLen < MAX_BLOCK_LEN {
+		next, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if next != current {
+			// the byte starts the next block
+			if err := reader.UnreadByte(); err != nil {
+				return 0, err
+			}
+			break
+		}
+		runLen++
+	}
+	return runLen, nil
+}
+
+// DecompressRLE decodes the blocks written by CompressRLE from r until it ends and writes
+// the data to w.
+//
+// Parameters:
+//   - r: the encoded blocks, read to the end
+//   - w: the writer receiving the decoded data
+//
+// Returns:
+//   - error: ErrTruncatedBlock if r ends inside a block, or an error if reading or writing fails
+func DecompressRLE(r io.Reader, w io.Writer) error {
+	reader := bufio.NewReaderSize(r, constants.BUFFER_SIZE)
+	writer := bufio.NewWriterSize(w, constants.BUFFER_SIZE)
+	block := make([]byte, MAX_BLOCK_LEN)
+
+	for {
+		header, err := reader.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf(constants.FILE_READ_ERROR, err)
+		}
+
+		blockLen := int(header&^LITERAL_FLAG) + 1
+		if header&LITERAL_FLAG != 0 {
+			if _, err := io.ReadFull(reader, block[:blockLen]); err != nil {
+				return readError(err)
+			}
+		} else {
+			value, err := reader.ReadByte()
+			if err != nil {
+				return readError(err)
+			}
+			for i := 0; i < blockLen; i++ {
+				block[i] = value
+			}
+		}
+
+		if _, err := writer.Write(block[:blockLen]); err != nil {
+			return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+
+	return nil
+}
+
+// readError reports the end of the input inside a block as ErrTruncatedBlock.
+func readError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncatedBlock
+	}
+	return fmt.Errorf(constants.FILE_READ_ERROR, err)
+}
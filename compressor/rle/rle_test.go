@@ -0,0 +1,139 @@
+package rle
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+func roundTrip(t *testing.T, input []byte) []byte {
+	t.Helper()
+
+	encoded := &bytes.Buffer{}
+	if err := CompressRLE(bytes.NewReader(input), encoded); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+
+	decoded := &bytes.Buffer{}
+	if err := DecompressRLE(bytes.NewReader(encoded.Bytes()), decoded); err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+	if !bytes.Equal(input, decoded.Bytes()) {
+		t.Fatalf("decompressed data does not match the %d byte input", len(input))
+	}
+
+	return encoded.Bytes()
+}
+
+func TestRLEAllZeros(t *testing.T) {
+	encoded := roundTrip(t, make([]byte, 1000))
+
+	// 7 full runs of 128 and one run of 104, two bytes each
+	if len(encoded) != 16 {
+		t.Fatalf("expected 16 encoded bytes, got %d", len(encoded))
+	}
+	if !bytes.Equal(encoded[:2], []byte{127, 0}) {
+		t.Fatalf("expected a full run of zeros first, got %v", encoded[:2])
+	}
+}
+
+func TestRLEAllUnique(t *testing.T) {
+	input := make([]byte, 256)
+	for i := range input {
+		input[i] = byte(i)
+	}
+	encoded := roundTrip(t, input)
+
+	// two full literal blocks, one header byte each
+	if len(encoded) != len(input)+2 {
+		t.Fatalf("expected %d encoded bytes, got %d", len(input)+2, len(encoded))
+	}
+	if encoded[0] != LITERAL_FLAG|127 {
+		t.Fatalf("expected a full literal block header, got %#x", encoded[0])
+	}
+}
+
+func TestRLEAlternatingBytes(t *testing.T) {
+	encoded := roundTrip(t, bytes.Repeat([]byte{0xAA, 0x55}, 100))
+
+	// 200 literals need two blocks of 128 and 72
+	if len(encoded) != 202 {
+		t.Fatalf("expected 202 encoded bytes, got %d", len(encoded))
+	}
+}
+
+func TestRLEMixed(t *testing.T) {
+	tests := [][]byte{
+		{},
+		{7},
+		{1, 1},
+		{1, 1, 1},
+		append(append([]byte("header"), make([]byte, 300)...), []byte("trailer, trailer")...),
+		bytes.Repeat([]byte("aaab"), 100),
+	}
+
+	for _, input := range tests {
+		roundTrip(t, input)
+	}
+}
+
+func TestDecompressTruncated(t *testing.T) {
+	tests := [][]byte{
+		{5},                      // a run without its byte
+		{LITERAL_FLAG | 3, 1, 2}, // a literal block missing two bytes
+	}
+
+	for _, input := range tests {
+		if err := DecompressRLE(bytes.NewReader(input), &bytes.Buffer{}); !errors.Is(err, ErrTruncatedBlock) {
+			t.Fatalf("expected %v for %v, got %v", ErrTruncatedBlock, input, err)
+		}
+	}
+}
+
+func TestZipUnzip(t *testing.T) {
+	contents := map[string][]byte{
+		"sparse.bin": append(make([]byte, 4096), 1),
+		"log.txt":    bytes.Repeat([]byte("GET /index.html 200\n"), 50),
+		"empty.txt":  {},
+	}
+
+	archivePath := filepath.Join(t.TempDir(), "archive.sq")
+	output, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create the archive: %v", err)
+	}
+	files := []utils.FileData{}
+	for name, content := range contents {
+		files = append(files, utils.FileData{Name: name, Size: int64(len(content)), Reader: bytes.NewReader(content)})
+	}
+	err = Zip(files, output)
+	output.Close()
+	if err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+
+	input, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatalf("failed to open the archive: %v", err)
+	}
+	defer input.Close()
+
+	outputDir := t.TempDir()
+	if _, err := Unzip(input, outputDir); err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+
+	for name, content := range contents {
+		decompressed, err := os.ReadFile(filepath.Join(outputDir, name))
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", name, err)
+		}
+		if !bytes.Equal(content, decompressed) {
+			t.Fatalf("%s does not match the original", name)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package compressor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"file-compressor/constants"
+	"file-compressor/utils"
+)
+
+// SplitArchive copies the archive src into parts of at most partSizeBytes bytes, named after it
+// as archive.sq.001, archive.sq.002 and so on, so it can be uploaded or mailed in pieces. The
+// archive is split verbatim: an encrypted archive stays encrypted in its parts, nothing is
+// decrypted or encrypted again. Unlike the parts of utils.WithSplitOutput, no descriptor or
+// hash is written, a damaged part shows when the joined archive is decrypted or verified.
+// An empty archive is split into a single empty part.
+//
+// Parameters:
+//   - src: The path of the archive.
+//   - partSizeBytes: The maximum size of a part, greater than zero.
+//   - outDir: The directory of the parts, the directory of src when empty.
+//
+// Returns:
+//   - []string: the paths of the parts, in the order JoinArchiveParts needs them
+//   - error: if the part size is invalid, or the archive cannot be read or a part written, the
+//     parts written so far are removed
+func SplitArchive(src string, partSizeBytes int64, outDir string) ([]string, error) {
+	if partSizeBytes <= 0 {
+		return nil, fmt.Errorf("invalid part size: %d", partSizeBytes)
+	}
+	if outDir == "" {
+		outDir = filepath.Dir(src)
+	}
+	if err := utils.MakeOutputDir(outDir); err != nil {
+		return nil, err
+	}
+
+	source, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf(constants.FILE_OPEN_ERROR, err)
+	}
+	defer source.Close()
+
+	parts := []string{}
+	if err := splitParts(bufio.NewReaderSize(source, constants.BUFFER_SIZE), partSizeBytes, filepath.Join(outDir, filepath.Base(src)), &parts); err != nil {
+		for _, part := range parts {
+			os.Remove(part)
+		}
+		return nil, err
+	}
+	return parts, nil
+}
+
+// splitParts writes the parts of source next to each other below base, adding every part to
+// parts as soon as it is created so it can be removed after a failure.
+func splitParts(source *bufio.Reader, partSize int64, base string, parts *[]string) error {
+	for {
+		partPath := fmt.Sprintf("%s.%03d", base, len(*parts)+1)
+		part, err := os.Create(partPath)
+		if err != nil {
+			return fmt.Errorf(constants.FILE_CREATE_ERROR, err)
+		}
+		*parts = append(*parts, partPath)
+
+		n, err := io.CopyN(part, source, partSize)
+		if closeErr := part.Close(); err == nil && closeErr != nil {
+			return fmt.Errorf(constants.FILE_CLOSE_ERROR, closeErr)
+		}
+		if err != nil && err != io.EOF {
+			return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+		}
+		if n < partSize {
+			return nil
+		}
+
+		// a part is only started when there is data for it, an archive whose size is a
+		// multiple of the part size has no empty last part
+		if _, err := source.Peek(1); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf(constants.FILE_READ_ERROR, err)
+		}
+	}
+}
+
+// JoinArchiveParts concatenates the parts written by SplitArchive into output, restoring the
+// archive byte for byte. The parts are joined in the order they are given, output is removed
+// again when a part cannot be read.
+//
+// Parameters:
+//   - parts: The paths of the parts, in order.
+//   - output: The path of the joined archive, it must not be one of the parts.
+//
+// Returns:
+//   - error: if no part is given, output is one of them, or a part cannot be read or the
+//     archive written
+func JoinArchiveParts(parts []string, output string) error {
+	if len(parts) == 0 {
+		return errors.New("no parts to join")
+	}
+	for _, part := range parts {
+		if filepath.Clean(part) == filepath.Clean(output) {
+			return fmt.Errorf("cannot join the parts into %s, it is one of them", output)
+		}
+	}
+
+	joined, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf(constants.FILE_CREATE_ERROR, err)
+	}
+
+	buffered := bufio.NewWriterSize(joined, constants.BUFFER_SIZE)
+	err = joinArchiveParts(parts, buffered)
+	if err == nil {
+		if flushErr := buffered.Flush(); flushErr != nil {
+			err = fmt.Errorf(constants.FILE_WRITE_ERROR, flushErr)
+		}
+	}
+	if closeErr := joined.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf(constants.FILE_CLOSE_ERROR, closeErr)
+	}
+	if err != nil {
+		os.Remove(output)
+		return err
+	}
+	return nil
+}
+
+func joinArchiveParts(parts []string, output io.Writer) error {
+	for _, partPath := range parts {
+		part, err := os.Open(partPath)
+		if err != nil {
+			return fmt.Errorf(constants.FILE_OPEN_ERROR, err)
+		}
+		_, err = io.Copy(output, part)
+		part.Close()
+		if err != nil {
+			return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+		}
+	}
+	return nil
+}
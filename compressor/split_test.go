@@ -0,0 +1,127 @@
+package compressor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"file-compressor/utils"
+)
+
+func TestSplitArchive(t *testing.T) {
+	// random data is stored as it is, the archive is a little over 1 MB
+	content := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(content)
+	inputPath := filepath.Join(t.TempDir(), "random.bin")
+	if err := os.WriteFile(inputPath, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	archivePath, _, err := Compress(context.Background(), []string{inputPath}, t.TempDir(), string(utils.STORE))
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	archive, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const partSize = 100 << 10
+	partsDir := t.TempDir()
+	parts, err := SplitArchive(archivePath, partSize, partsDir)
+	if err != nil {
+		t.Fatalf("failed to split: %v", err)
+	}
+	if expected := (len(archive) + partSize - 1) / partSize; len(parts) != expected {
+		t.Fatalf("expected %d parts, got %d", expected, len(parts))
+	}
+	for i, part := range parts {
+		if expected := filepath.Join(partsDir, fmt.Sprintf("%s.%03d", filepath.Base(archivePath), i+1)); part != expected {
+			t.Fatalf("expected part %d at %s, got %s", i+1, expected, part)
+		}
+		info, err := os.Stat(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i < len(parts)-1 && info.Size() != partSize {
+			t.Fatalf("expected %s to be %d bytes, got %d", part, partSize, info.Size())
+		}
+	}
+
+	joinedPath := filepath.Join(t.TempDir(), "joined.sq")
+	if err := JoinArchiveParts(parts, joinedPath); err != nil {
+		t.Fatalf("failed to join: %v", err)
+	}
+	joined, err := os.ReadFile(joinedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(joined, archive) {
+		t.Fatal("the joined archive does not match the original")
+	}
+
+	outputDir := t.TempDir()
+	if _, _, err := Decompress(context.Background(), joinedPath, outputDir); err != nil {
+		t.Fatalf("failed to decompress the joined archive: %v", err)
+	}
+	if extracted, err := os.ReadFile(filepath.Join(outputDir, "random.bin")); err != nil || !bytes.Equal(extracted, content) {
+		t.Fatalf("the extracted file does not match the original: %v", err)
+	}
+
+	// the parts are joined in the order they are given
+	swapped := append([]string{parts[1], parts[0]}, parts[2:]...)
+	if err := JoinArchiveParts(swapped, joinedPath); err != nil {
+		t.Fatalf("failed to join: %v", err)
+	}
+	if joined, err := os.ReadFile(joinedPath); err != nil || bytes.Equal(joined, archive) {
+		t.Fatalf("expected swapped parts to change the archive, got %v", err)
+	}
+}
+
+func TestSplitArchiveSizes(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		size     int
+		partSize int64
+		parts    int
+	}{
+		{0, 10, 1},
+		{10, 10, 1},
+		{20, 10, 2},
+		{21, 10, 3},
+	}
+	for _, test := range tests {
+		archivePath := filepath.Join(dir, fmt.Sprintf("archive-%d.sq", test.size))
+		if err := os.WriteFile(archivePath, bytes.Repeat([]byte{'a'}, test.size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// the parts are written next to the archive without outDir
+		parts, err := SplitArchive(archivePath, test.partSize, "")
+		if err != nil || len(parts) != test.parts || filepath.Dir(parts[0]) != dir {
+			t.Fatalf("%d bytes: expected %d parts next to the archive, got %v (%v)", test.size, test.parts, parts, err)
+		}
+	}
+
+	if _, err := SplitArchive(filepath.Join(dir, "archive-10.sq"), 0, ""); err == nil {
+		t.Fatal("expected an error for a part size of 0")
+	}
+	if _, err := SplitArchive(filepath.Join(dir, "missing.sq"), 10, ""); err == nil {
+		t.Fatal("expected an error for a missing archive")
+	}
+	if err := JoinArchiveParts(nil, filepath.Join(dir, "joined.sq")); err == nil {
+		t.Fatal("expected an error without parts")
+	}
+	part := filepath.Join(dir, "archive-10.sq.001")
+	if err := JoinArchiveParts([]string{part}, part); err == nil {
+		t.Fatal("expected an error when joining into a part")
+	}
+	if err := JoinArchiveParts([]string{part, filepath.Join(dir, "missing.sq.002")}, filepath.Join(dir, "joined.sq")); err == nil {
+		t.Fatal("expected an error for a missing part")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "joined.sq")); !os.IsNotExist(err) {
+		t.Fatalf("expected the partially joined archive to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+// Package store keeps the data of the entries as it is, for files that do not get smaller when
+// they are compressed, such as images and archives.
+package store
+
+import (
+	"fmt"
+	"io"
+
+	"file-compressor/compressor/framing"
+	"file-compressor/metrics"
+	"file-compressor/utils"
+)
+
+// Zip stores multiple files without compressing them and writes them to output.
+// It writes the number of files followed by every entry, framed like the other codecs. The
+// compressed size of an entry is back-filled after its data, so output must also implement
+// io.Seeker.
+//
+// Parameters:
+//   - files: A slice of utils.FileData representing the files to be compressed.
+//   - output: An io.Writer where the compressed data will be written.
+//   - opts: Optional settings such as utils.WithMetrics.
+//
+// Returns:
+//   - error: An error if any step in the compression process fails.
+func Zip(files []utils.FileData, output io.Writer, opts ...utils.Option) error {
+	options := utils.NewOptions(opts...)
+
+	if err := framing.WriteEntries(files, output, utils.STORE, compressData, options); err != nil {
+		metrics.RecordError(options.Metrics, string(utils.STORE), metrics.OP_COMPRESS, err)
+		return err
+	}
+
+	return nil
+}
+
+// compressData copies input to output and returns the number of bytes written.
+func compressData(input io.Reader, output io.Writer) (uint64, error) {
+	counter := &utils.CountingWriter{Writer: output}
+	if _, err := io.Copy(counter, input); err != nil {
+		return 0, err
+	}
+	return uint64(counter.BytesWritten), nil
+}
+
+// decompressData copies the compressedSize bytes of one entry from input to output.
+func decompressData(input io.Reader, output io.Writer, compressedSize uint64) error {
+	written, err := io.CopyN(output, input, int64(compressedSize))
+	if err == io.EOF {
+		return fmt.Errorf("entry data ends %d bytes early", int64(compressedSize)-written)
+	}
+	return err
+}
+
+// Unzip decompresses a store archive from input and writes the files below outputPath.
+// If the output path is an empty string, the current directory is used.
+//
+// Parameters:
+//   - input: An io.Reader from which the compressed data is read.
+//   - outputPath: A string specifying the directory where the decompressed files will be written.
+//   - opts: Optional settings, the same as for hfc.Unzip.
+//
+// Returns:
+//   - A slice of strings containing the paths of the decompressed files.
+//   - An error if any issue occurs during the decompression process.
+func Unzip(input io.Reader, outputPath string, opts ...utils.Option) ([]string, error) {
+	options := utils.NewOptions(opts...)
+
+	filePaths, err := framing.ReadEntries(input, outputPath, utils.STORE, decompressData, options)
+	if err != nil {
+		metrics.RecordError(options.Metrics, string(utils.STORE), metrics.OP_DECOMPRESS, err)
+		return nil, err
+	}
+
+	return filePaths, nil
+}
+
+// List reads the entry headers of a store archive, skipping the entry data.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the store payload.
+//
+// Returns:
+//   - []utils.EntryInfo: the entries in archive order
+//   - error: if the archive is truncated
+func List(input io.Reader) ([]utils.EntryInfo, error) {
+	return framing.List(input)
+}
+
+// Verify decodes every entry of a store archive without writing anything and reports all
+// damaged entries, like hfc.Verify.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the store payload.
+//
+// Returns:
+//   - utils.VerifyReport: the collected report. Offsets are relative to the start of input.
+func Verify(input io.Reader) utils.VerifyReport {
+	return utils.VerifyEntries(input, decompressData)
+}
@@ -0,0 +1,328 @@
+// Package targz writes and reads tar streams compressed with gzip, the archives exported with
+// utils.TARGZ. They are readable by tar and most other tools, but unlike the SquirrelZip archive
+// they hold no checksum per entry, gzip checks the whole stream instead. Tar streams without
+// gzip are read as well.
+package targz
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"file-compressor/constants"
+	"file-compressor/metrics"
+	"file-compressor/utils"
+)
+
+// MAGIC starts every gzip stream, followed by the deflate method byte.
+const MAGIC = "\x1f\x8b"
+
+// MAGIC_LEN is the number of bytes IsTarGz needs, the magic and the method byte.
+const MAGIC_LEN = len(MAGIC) + 1
+
+// DEFAULT_MODE is the mode stored for files without permission bits.
+const DEFAULT_MODE = 0o644
+
+// IsTarGz reports whether header, the first MAGIC_LEN bytes of a file, starts a gzip stream.
+// The tar stream inside is only checked when it is read.
+func IsTarGz(header []byte) bool {
+	// 8 is deflate, the only method of gzip
+	return len(header) >= MAGIC_LEN && bytes.HasPrefix(header, []byte(MAGIC)) && header[len(MAGIC)] == 8
+}
+
+// Zip writes files to output as a tar stream compressed with gzip. The names, sizes,
+// permissions and modification times of the files are kept, the sizes must match the
+// readers. output does not need to seek.
+//
+// Parameters:
+//   - files: A slice of utils.FileData representing the files to be compressed.
+//   - output: An io.Writer where the tar.gz stream will be written.
+//   - opts: Optional settings such as utils.WithMetrics, utils.WithLevel sets the gzip level.
+//
+// Returns:
+//   - error: An error if the level is invalid, a file does not match its size or writing fails.
+func Zip(files []utils.FileData, output io.Writer, opts ...utils.Option) error {
+	options := utils.NewOptions(opts...)
+
+	if err := zipFiles(files, output, options); err != nil {
+		metrics.RecordError(options.Metrics, string(utils.TARGZ), metrics.OP_COMPRESS, err)
+		return err
+	}
+
+	return nil
+}
+
+func zipFiles(files []utils.FileData, output io.Writer, options utils.Options) error {
+	level := gzip.DefaultCompression
+	if options.Level != 0 {
+		if options.Level < utils.LevelFast || options.Level > utils.LevelBest {
+			return fmt.Errorf("invalid compression level %d, it must be between %d and %d", options.Level, utils.LevelFast, utils.LevelBest)
+		}
+		level = int(options.Level)
+	}
+
+	compressed := &utils.CountingWriter{Writer: output}
+	gzipWriter, err := gzip.NewWriterLevel(compressed, level)
+	if err != nil {
+		return err
+	}
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	total := utils.TotalSize(files)
+
+	for _, file := range files {
+		start := time.Now()
+		written := compressed.BytesWritten
+
+		mode := int64(file.Mode.Perm())
+		if mode == 0 {
+			mode = DEFAULT_MODE
+		}
+		header := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     filepath.ToSlash(file.Name),
+			Size:     file.Size,
+			Mode:     mode,
+			ModTime:  file.ModTime,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write the tar header of %s: %w", file.Name, err)
+		}
+
+		reader := &utils.CountingReader{Reader: file.Reader}
+		if _, err := io.Copy(tarWriter, reader); err != nil {
+			return fmt.Errorf(constants.ERROR_COMPRESS, err)
+		}
+		if reader.BytesRead != file.Size {
+			return fmt.Errorf("%s is %d bytes, not %d", file.Name, reader.BytesRead, file.Size)
+		}
+
+		metrics.RecordEntry(options.Metrics, string(utils.TARGZ), metrics.OP_COMPRESS, reader.BytesRead, compressed.BytesWritten-written, time.Since(start))
+		options.Progress(file.Name, reader.BytesRead, total)
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf(constants.ERROR_COMPRESS, err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return fmt.Errorf(constants.ERROR_COMPRESS, err)
+	}
+
+	return nil
+}
+
+// Unzip extracts the regular files of a tar.gz or a tar stream below outputPath, restoring their
+// permissions and modification times. Directories are created for the files in them, other
+// entries such as links are skipped with a warning. The gzip checksum is verified once the
+// tar stream ends.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the gzip or the tar stream.
+//   - outputPath: A string specifying the directory where the decompressed files will be written.
+//   - opts: Optional settings, the same as for hfc.Unzip.
+//
+// Returns:
+//   - A slice of strings containing the paths of the decompressed files.
+//   - An error if any issue occurs during the decompression process.
+func Unzip(input io.Reader, outputPath string, opts ...utils.Option) ([]string, error) {
+	options := utils.NewOptions(opts...)
+
+	filePaths, err := unzipFiles(input, outputPath, options)
+	if err != nil {
+		metrics.RecordError(options.Metrics, string(utils.TARGZ), metrics.OP_DECOMPRESS, err)
+		return nil, err
+	}
+
+	return filePaths, nil
+}
+
+func unzipFiles(input io.Reader, outputPath string, options utils.Options) ([]string, error) {
+	compressed := &utils.CountingReader{Reader: input}
+	tarReader, stream, err := openTar(compressed)
+	if err != nil {
+		return nil, fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+	}
+
+	extractor := utils.NewExtractor(outputPath, options)
+
+	for {
+		start := time.Now()
+		read := compressed.BytesRead
+
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, tarError(err)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeReg:
+		case tar.TypeDir:
+			continue
+		default:
+			options.Warn(fmt.Sprintf("skipped %s, only regular files are extracted", header.Name))
+			continue
+		}
+
+		// entries that were not asked for are read past by the next call
+		if !options.Selects(header.Name) {
+			continue
+		}
+
+		output, err := extractor.Create(header.Name)
+		if err != nil {
+			return nil, err
+		}
+		output.SetModTime(header.ModTime)
+		output.SetMode(os.FileMode(header.Mode))
+
+		if _, err := io.Copy(output, tarReader); err != nil {
+			output.Abort()
+			return nil, fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+		}
+
+		if err := output.Close(); err != nil {
+			return nil, err
+		}
+
+		metrics.RecordEntry(options.Metrics, string(utils.TARGZ), metrics.OP_DECOMPRESS, compressed.BytesRead-read, output.BytesWritten(), time.Since(start))
+		options.Progress(header.Name, output.BytesWritten(), -1)
+	}
+
+	// the checksum of gzip is only read at the end of its stream, after the end of the tar
+	if _, err := io.Copy(io.Discard, stream); err != nil {
+		return nil, fmt.Errorf(constants.ERROR_DECOMPRESS, err)
+	}
+
+	return extractor.Finish()
+}
+
+// openTar returns the reader of the tar stream read from input, decompressed when it starts with
+// MAGIC. The stream is read to its end after the last entry, where gzip checks its checksum.
+func openTar(input io.Reader) (*tar.Reader, io.Reader, error) {
+	buffered := bufio.NewReader(input)
+	magic, _ := buffered.Peek(MAGIC_LEN)
+	if !IsTarGz(magic) {
+		return tar.NewReader(buffered), buffered, nil
+	}
+
+	gzipReader, err := gzip.NewReader(buffered)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tar.NewReader(gzipReader), gzipReader, nil
+}
+
+// tarError describes an error of the tar reader, a gzip file that holds no tar stream fails
+// on its first header.
+func tarError(err error) error {
+	if errors.Is(err, tar.ErrHeader) {
+		return fmt.Errorf("not a tar stream, only tar and tar.gz archives are read: %w", err)
+	}
+	return fmt.Errorf("failed to read the tar stream: %w", err)
+}
+
+// List reads the headers of the regular files of a tar.gz or a tar stream. The data of every
+// entry has to be decompressed to reach the next header, but it is not kept. Tar stores no
+// compressed size or checksum per entry, they are left empty.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the gzip or the tar stream.
+//
+// Returns:
+//   - []utils.EntryInfo: the entries in archive order
+//   - error: if the stream is not a tar.gz or a tar stream, or is truncated
+func List(input io.Reader) ([]utils.EntryInfo, error) {
+	tarReader, _, err := openTar(input)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []utils.EntryInfo{}
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, tarError(err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		entries = append(entries, utils.EntryInfo{
+			Name:         header.Name,
+			OriginalSize: uint64(header.Size),
+			ModTime:      header.ModTime,
+			Mode:         os.FileMode(header.Mode).Perm(),
+		})
+	}
+}
+
+// Verify decompresses a tar.gz or reads a tar stream without writing anything. The first damaged entry ends
+// the check, the entries after it cannot be reached without their headers. Offsets are not
+// known inside the compressed stream and are left at 0.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the start of the gzip or the tar stream.
+//
+// Returns:
+//   - utils.VerifyReport: the collected report
+func Verify(input io.Reader) utils.VerifyReport {
+	report := utils.VerifyReport{}
+	verifyEntries(input, &report)
+	report.Finish()
+	return report
+}
+
+func verifyEntries(input io.Reader, report *utils.VerifyReport) {
+	tarReader, stream, err := openTar(input)
+	if err != nil {
+		report.Structural = err.Error()
+		return
+	}
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			report.AddFailure(verifyFailure("", err))
+			return
+		}
+
+		report.Entries++
+		if _, err := io.Copy(io.Discard, tarReader); err != nil {
+			report.AddFailure(verifyFailure(header.Name, err))
+			return
+		}
+		report.Checked++
+	}
+
+	if _, err := io.Copy(io.Discard, stream); err != nil {
+		report.AddFailure(verifyFailure("", err))
+	}
+}
+
+// verifyFailure classifies an error of the gzip or the tar reader.
+func verifyFailure(name string, err error) utils.EntryFailure {
+	kind := utils.FAILURE_UNDECODABLE
+	switch {
+	case errors.Is(err, gzip.ErrChecksum):
+		kind = utils.FAILURE_CRC_MISMATCH
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		kind = utils.FAILURE_TRUNCATED
+	}
+	return utils.EntryFailure{Name: name, Kind: kind, Error: err.Error()}
+}
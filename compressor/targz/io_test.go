@@ -0,0 +1,199 @@
+package targz
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"file-compressor/utils"
+)
+
+var modTime = time.Date(2024, 5, 17, 10, 30, 0, 0, time.UTC)
+
+// testFiles returns the files the tests compress, a nested one and an empty one among them.
+func testFiles() []utils.FileData {
+	contents := map[string]string{
+		"a.txt":            strings.Repeat("squirrels bury acorns\n", 100),
+		"dir/nested/b.bin": string([]byte{0, 1, 2, 255}),
+		"empty.txt":        "",
+	}
+	files := []utils.FileData{}
+	for _, name := range []string{"a.txt", "dir/nested/b.bin", "empty.txt"} {
+		files = append(files, utils.FileData{Name: name, Size: int64(len(contents[name])), Reader: strings.NewReader(contents[name]), ModTime: modTime, Mode: 0o600})
+	}
+	return files
+}
+
+func zipTestFiles(t *testing.T, opts ...utils.Option) []byte {
+	output := &bytes.Buffer{}
+	if err := Zip(testFiles(), output, opts...); err != nil {
+		t.Fatalf("failed to zip: %v", err)
+	}
+	return output.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	compressed := zipTestFiles(t)
+	if !IsTarGz(compressed[:MAGIC_LEN]) {
+		t.Fatal("the output does not start with the gzip magic")
+	}
+
+	outputDir := t.TempDir()
+	paths, err := Unzip(bytes.NewReader(compressed), outputDir)
+	if err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+	if len(paths) != 3 {
+		t.Fatalf("expected 3 files, got %v", paths)
+	}
+
+	for _, file := range testFiles() {
+		path := filepath.Join(outputDir, filepath.FromSlash(file.Name))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", file.Name, err)
+		}
+		expected, _ := io.ReadAll(file.Reader)
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("%s does not match the input", file.Name)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(modTime) {
+			t.Fatalf("expected %s to be modified at %v, got %v", file.Name, modTime, info.ModTime())
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Fatalf("expected %s to have mode 0600, got %v", file.Name, info.Mode().Perm())
+		}
+	}
+}
+
+// TestReadWithArchiveTar reads the output with the standard library alone, like other tools do.
+func TestReadWithArchiveTar(t *testing.T) {
+	gzipReader, err := gzip.NewReader(bytes.NewReader(zipTestFiles(t, utils.WithLevel(utils.LevelBest))))
+	if err != nil {
+		t.Fatalf("not a gzip stream: %v", err)
+	}
+	tarReader := tar.NewReader(gzipReader)
+
+	for _, file := range testFiles() {
+		header, err := tarReader.Next()
+		if err != nil {
+			t.Fatalf("failed to read the header of %s: %v", file.Name, err)
+		}
+		if header.Name != file.Name || header.Size != file.Size || header.Mode != 0o600 || !header.ModTime.Equal(modTime) {
+			t.Fatalf("expected %s of %d bytes, got %s of %d bytes, mode %o, modified at %v", file.Name, file.Size, header.Name, header.Size, header.Mode, header.ModTime)
+		}
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", file.Name, err)
+		}
+		expected, _ := io.ReadAll(file.Reader)
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("%s does not match the input", file.Name)
+		}
+	}
+	if _, err := tarReader.Next(); err != io.EOF {
+		t.Fatalf("expected the end of the archive, got %v", err)
+	}
+}
+
+func TestZipSizeMismatch(t *testing.T) {
+	files := []utils.FileData{{Name: "a.txt", Size: 10, Reader: strings.NewReader("abc")}}
+	if err := Zip(files, io.Discard); err == nil {
+		t.Fatal("expected an error for a file shorter than its size")
+	}
+	if err := Zip(testFiles(), io.Discard, utils.WithLevel(10)); err == nil {
+		t.Fatal("expected an error for an invalid level")
+	}
+}
+
+func TestUnzipSkipsOtherEntries(t *testing.T) {
+	compressed := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(compressed)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for _, header := range []*tar.Header{
+		{Typeflag: tar.TypeDir, Name: "dir/", Mode: 0o755},
+		{Typeflag: tar.TypeSymlink, Name: "dir/link", Linkname: "/etc/passwd"},
+		{Typeflag: tar.TypeReg, Name: "dir/a.txt", Mode: 0o644, Size: 2},
+	} {
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tarWriter.Write([]byte("hi"))
+	tarWriter.Close()
+	gzipWriter.Close()
+
+	warnings := []string{}
+	outputDir := t.TempDir()
+	paths, err := Unzip(bytes.NewReader(compressed.Bytes()), outputDir, utils.WithWarnings(func(message string) {
+		warnings = append(warnings, message)
+	}))
+	if err != nil {
+		t.Fatalf("failed to unzip: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != filepath.Join(outputDir, "dir", "a.txt") {
+		t.Fatalf("expected only dir/a.txt, got %v", paths)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "dir/link") {
+		t.Fatalf("expected a warning for the link, got %v", warnings)
+	}
+}
+
+func TestUnzipRejectsTraversal(t *testing.T) {
+	compressed := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(compressed)
+	tarWriter := tar.NewWriter(gzipWriter)
+	tarWriter.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "../escaped.txt", Mode: 0o644, Size: 1})
+	tarWriter.Write([]byte("x"))
+	tarWriter.Close()
+	gzipWriter.Close()
+
+	outputDir := filepath.Join(t.TempDir(), "out")
+	if _, err := Unzip(bytes.NewReader(compressed.Bytes()), outputDir); err == nil {
+		t.Fatal("expected an error for an entry outside of the output directory")
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "..", "escaped.txt")); !os.IsNotExist(err) {
+		t.Fatalf("the entry was written outside of the output directory: %v", err)
+	}
+}
+
+func TestListAndVerify(t *testing.T) {
+	compressed := zipTestFiles(t)
+
+	entries, err := List(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("failed to list: %v", err)
+	}
+	if len(entries) != 3 || entries[1].Name != "dir/nested/b.bin" || entries[1].OriginalSize != 4 || !entries[1].ModTime.Equal(modTime) {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	if report := Verify(bytes.NewReader(compressed)); report.Status != utils.VERIFY_OK || report.Checked != 3 {
+		t.Fatalf("expected 3 entries to be checked, got %+v", report)
+	}
+
+	// the checksum of gzip covers every byte, including the data of the last entry
+	damaged := append([]byte(nil), compressed...)
+	damaged[len(damaged)-8] ^= 0xff
+	if report := Verify(bytes.NewReader(damaged)); report.Status != utils.VERIFY_DAMAGED || report.Failures[0].Kind != utils.FAILURE_CRC_MISMATCH {
+		t.Fatalf("expected a checksum mismatch, got %+v", report)
+	}
+	if _, err := Unzip(bytes.NewReader(damaged), t.TempDir()); err == nil {
+		t.Fatal("expected the damaged checksum to fail the extraction")
+	}
+
+	if report := Verify(bytes.NewReader(compressed[:len(compressed)/2])); report.Status != utils.VERIFY_DAMAGED {
+		t.Fatalf("expected a truncated archive to be damaged, got %+v", report)
+	}
+}
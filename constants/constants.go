@@ -2,14 +2,36 @@ package constants
 
 const (
 
-	BUFFER_SIZE = 256
+	// BUFFER_SIZE is the default size of the I/O buffers and of the encrypted chunks,
+	// utils.WithBufferSize and encryption.EncryptionOptions.ChunkSize change it.
+	BUFFER_SIZE = 64 << 10
+	// MAX_BUFFER_SIZE limits the buffer size, a whole encrypted chunk is held in memory.
+	MAX_BUFFER_SIZE = 16 << 20
 	NO_PASSWORD byte = 43
 	PASSWORD    byte = 57
+	// PASSWORD_ARGON2ID is PASSWORD with the key derived by Argon2id instead of PBKDF2.
+	PASSWORD_ARGON2ID byte = 58
+	// KEYFILE marks a key derived from a key file, combined with a password when one was given.
+	KEYFILE byte = 59
 
 	COMPRESSED_FILE_EXT = ".compressed"
+	// ARCHIVE_FILE_EXT is the extension of the final, encrypted archive.
+	ARCHIVE_FILE_EXT = ".sq"
+	// TARGZ_FILE_EXT is the extension of an unencrypted archive exported as tar.gz.
+	TARGZ_FILE_EXT = ".tar.gz"
+
+	// MAGIC_BYTES start every archive, after decryption when it is encrypted. Archives
+	// written before they were added are read by a legacy path, see format.VERSION_1.
+	MAGIC_BYTES     = "SQZP"
+	MAGIC_BYTES_LEN = len(MAGIC_BYTES)
+
+	// ARCHIVE_VERSION_CURRENT is the format version written after MAGIC_BYTES, and the
+	// newest one this build reads. MIN_SUPPORTED_VERSION is the oldest one it reads.
+	ARCHIVE_VERSION_CURRENT = uint16(4)
+	MIN_SUPPORTED_VERSION   = uint16(1)
 
 	FILE_CREATE_ERROR = "failed to create file: %v"
-	FILE_WRITE_ERROR = "failed to write file: %v"
+	FILE_WRITE_ERROR = "failed to write file: %w"
 	FILE_READ_ERROR = "failed to read file: %v"
 	FILE_REMOVE_ERROR = "failed to remove file: %v"
 
@@ -21,16 +43,18 @@ const (
 	ERROR_CREATE_DIR = "failed to create directory: %v"
 
 	BUFFER_READ_ERROR = "failed to read buffer: %v"
-	BUFFER_WRITE_ERROR = "failed to write buffer: %v"
+	BUFFER_WRITE_ERROR = "failed to write buffer: %w"
 
-	ERROR_DECOMPRESS = "failed to decompress file: %v"
-	ERROR_COMPRESS = "failed to compress file: %v"
+	ERROR_DECOMPRESS = "failed to decompress file: %w"
+	ERROR_COMPRESS = "failed to compress file: %w"
 
-	FAILED_TO_ENCRYPT = "failed to encrypt file: %v"
-	FAILED_TO_DECRYPT = "failed to decrypt file: %v"
+	FAILED_TO_ENCRYPT = "failed to encrypt file: %w"
+	FAILED_TO_DECRYPT = "failed to decrypt file: %w"
 
 	FAILED_GET_FREQ_MAP = "failed to get frequency map: %v"
 	FAILED_BUILD_HUFFMAN_CODES = "failed to build huffman codes: %v"
 	FAILED_READ_HUFFMAN_CODES = "failed to read huffman codes: %v"
-	FAILED_WRITE_HUFFMAN_CODES = "failed to write huffman codes: %v"
+	FAILED_WRITE_HUFFMAN_CODES = "failed to write huffman codes: %w"
+
+	CHECKSUM_MISMATCH = "checksum mismatch in %s: expected crc32 %08x, got %08x"
 )
\ No newline at end of file
@@ -0,0 +1,73 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// CipherSuite selects the AEAD cipher of an encrypted archive. It is stored in the
+// metadata block right after the password flag byte.
+type CipherSuite byte
+
+const (
+	// AES_GCM is AES-256 in Galois/Counter Mode, fast on CPUs with AES instructions.
+	AES_GCM CipherSuite = 0x01
+	// CHACHA20_POLY1305 is faster than AES_GCM on CPUs without AES instructions, such as small ARM boards.
+	CHACHA20_POLY1305 CipherSuite = 0x02
+
+	// DEFAULT_CIPHER_SUITE is used when no cipher suite is requested.
+	DEFAULT_CIPHER_SUITE = AES_GCM
+)
+
+// String returns the name of the cipher suite as accepted by ParseCipherSuite.
+func (suite CipherSuite) String() string {
+	switch suite {
+	case AES_GCM:
+		return "aes-gcm"
+	case CHACHA20_POLY1305:
+		return "chacha20-poly1305"
+	default:
+		return fmt.Sprintf("unknown cipher suite 0x%02x", byte(suite))
+	}
+}
+
+// ParseCipherSuite returns the cipher suite with the given name, "aes-gcm" or "chacha20-poly1305".
+// The match is case insensitive and "chacha20" is accepted as a short form.
+func ParseCipherSuite(name string) (CipherSuite, error) {
+	switch strings.ToLower(name) {
+	case "aes-gcm", "aes":
+		return AES_GCM, nil
+	case "chacha20-poly1305", "chacha20":
+		return CHACHA20_POLY1305, nil
+	default:
+		return 0, fmt.Errorf("unsupported cipher: %s", name)
+	}
+}
+
+// newAEAD creates the AEAD cipher of the suite for a KEY_SIZE byte key.
+//
+// Parameters:
+//   - suite: the cipher suite
+//   - key: the derived key
+//
+// Returns:
+//   - cipher.AEAD: the cipher, its nonce size is the same for every suite
+//   - error: if the suite is unknown or the key is invalid
+func newAEAD(suite CipherSuite, key []byte) (cipher.AEAD, error) {
+	switch suite {
+	case AES_GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case CHACHA20_POLY1305:
+		return chacha20poly1305.New(key)
+	default:
+		return nil, fmt.Errorf("unsupported cipher suite 0x%02x", byte(suite))
+	}
+}
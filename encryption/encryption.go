@@ -1,115 +1,683 @@
 package encryption
 
 import (
-	"crypto/aes"
+	"bytes"
+	"context"
 	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
+	"time"
 
 	"file-compressor/constants"
+	"file-compressor/format"
+	"file-compressor/metrics"
+	"file-compressor/utils"
 )
 
+// ErrTamperedStream is returned when chunks of an encrypted stream were removed, appended or
+// reordered. Each chunk authenticates on its own, so this is only detected through the chunk
+// counter and the final chunk flag, see chunkAdditionalData.
+var ErrTamperedStream = errors.New("decryption failed: the encrypted stream was truncated, extended or reordered")
+
+// errInvalidMetadata is returned by readMetadata for a field that no version of writeMetadata
+// writes. After constants.NO_PASSWORD or constants.PASSWORD it marks an archive of the first
+// releases, see decryptLegacy.
+var errInvalidMetadata = errors.New("invalid metadata")
+
+// authError is a password or a key file that is missing, or a chunk that does not authenticate
+// with the key derived from them, usually a wrong password. It is reported as
+// metrics.ERROR_AUTH.
+type authError string
+
+func (e authError) Error() string {
+	return string(e)
+}
+
+func (authError) ErrorType() string {
+	return metrics.ERROR_AUTH
+}
+
+// EncryptionOptions holds the optional settings of EncryptStream and DecryptStream.
+type EncryptionOptions struct {
+	// Metrics receives byte counts, errors and durations. Defaults to metrics.Nop.
+	Metrics metrics.Metrics
+	// CipherSuite selects the cipher. EncryptStream uses DEFAULT_CIPHER_SUITE when it is zero.
+	// DecryptStream uses the suite stored in the archive when it is zero, otherwise the
+	// archive must have been encrypted with this suite.
+	CipherSuite CipherSuite
+	// KDF is the key derivation function used by EncryptStream, DEFAULT_KDF when zero.
+	// It is stored in the archive together with its parameters, so DecryptStream always
+	// uses the stored function and ignores KDF, KDFIterations, KDFMemory and KDFThreads.
+	KDF KDF
+	// KDFIterations is the PBKDF2 iteration count, DEFAULT_KDF_ITERATIONS when zero, or the
+	// number of Argon2id passes, DEFAULT_ARGON2_TIME when zero.
+	KDFIterations int
+	// KDFMemory is the Argon2id memory size in KiB, DEFAULT_ARGON2_MEMORY when zero.
+	KDFMemory uint32
+	// KDFThreads is the Argon2id parallelism, DEFAULT_ARGON2_THREADS when zero.
+	KDFThreads uint8
+	// HMAC makes EncryptStream append an HMAC-SHA256 tag over the whole stream. With a
+	// password the integrity key is derived from it, otherwise a random key is stored in the
+	// header, which only detects damage, not deliberate tampering: whoever can change the
+	// archive can also recompute the tag or remove it. DecryptStream verifies a tag whenever
+	// the stream has one and needs a seekable reader to do so.
+	HMAC bool
+	// KeyFile is the path of a KEY_FILE_SIZE byte key file. EncryptStream derives the key
+	// from it, combined with the password when one is given, and records in the archive that
+	// a key file is required. DecryptStream then needs the same key file, it ignores KeyFile
+	// for archives encrypted without one.
+	KeyFile string
+	// Salt is the key derivation salt used by EncryptStream, format.SALT_LEN bytes long.
+	// A random salt is generated when it is nil, which is what callers should almost always
+	// want; a fixed salt is only useful for reproducible output. DecryptStream ignores it.
+	Salt []byte
+	// Progress receives the bytes EncryptStream reads, see utils.NewProgressTracker. Nil
+	// reports nothing. DecryptStream ignores it.
+	Progress *utils.ProgressTracker
+	// ChunkSize is the number of plaintext bytes EncryptStream seals at a time,
+	// constants.BUFFER_SIZE when zero. Every chunk carries the overhead of the cipher, so small
+	// chunks make the archive larger. It is stored in the archive, DecryptStream ignores it.
+	ChunkSize int
+	// VerifyKey is the public key a signed archive is read with by the functions that open an
+	// archive file, see ArchiveSection. DecryptStream ignores it.
+	VerifyKey ed25519.PublicKey
+}
+
+const (
+	// LEGACY_CHUNK_SIZE is the chunk size of archives that do not store theirs, they were
+	// written before it could be chosen.
+	LEGACY_CHUNK_SIZE = 256
+	// MAX_CHUNK_SIZE limits the chunk size, a chunk is held in memory while it is sealed or opened.
+	MAX_CHUNK_SIZE = constants.MAX_BUFFER_SIZE
+)
+
+// CHUNK_SIZE_FLAG is set in the integrity mode byte of the metadata when the chunk size
+// follows the integrity fields.
+const CHUNK_SIZE_FLAG byte = 0x80
+
+// resolveOptions returns the first options value, or the defaults when none is given.
+func resolveOptions(options []EncryptionOptions) EncryptionOptions {
+	resolved := EncryptionOptions{}
+	if len(options) > 0 {
+		resolved = options[0]
+	}
+	resolved.Metrics = metrics.OrNop(resolved.Metrics)
+	return resolved
+}
+
+// cipherName is the algorithm label reported to metrics, suite is zero when no password is used.
+func cipherName(suite CipherSuite) string {
+	if suite == 0 {
+		return "none"
+	}
+	return suite.String()
+}
+
 
 // EncryptStream reads data from the provided reader, encrypts it, and writes the encrypted data to the provided writer.
 // If a password is provided, the data will be encrypted using the password. If no password is provided, the data will
 // be copied without encryption.
 //
 // Parameters:
+//   - ctx: Cancels the encryption, the error is then ctx.Err().
 //   - reader: An io.Reader from which the data will be read.
 //   - writer: An io.Writer to which the encrypted data will be written.
 //   - password: A string used as the password for encryption. If empty, no encryption will be applied.
+//   - options: Optional settings, only the first value is used.
 //
 // Returns:
 //   - error: An error if any occurs during the encryption or writing process, otherwise nil.
-func EncryptStream(reader io.Reader, writer io.Writer, password string) error {
-	// Write the metadata based on whether a password is provided
-	if err := writeMetadata(writer, password); err != nil {
+func EncryptStream(ctx context.Context, reader io.Reader, writer io.Writer, password string, options ...EncryptionOptions) error {
+	opts := resolveOptions(options)
+	start := time.Now()
+
+	in := &utils.CountingReader{Reader: opts.Progress.Reader("", utils.CancelReader(ctx, reader))}
+	out := &utils.CountingWriter{Writer: writer}
+
+	suite := CipherSuite(0)
+	if password != "" || opts.KeyFile != "" {
+		suite = opts.CipherSuite
+		if suite == 0 {
+			suite = DEFAULT_CIPHER_SUITE
+		}
+	}
+
+	err := encryptStream(in, out, password, suite, opts)
+	if err != nil {
+		err = utils.ContextError(ctx, err)
+		metrics.RecordError(opts.Metrics, cipherName(suite), metrics.OP_ENCRYPT, err)
 		return err
 	}
 
-	// Encrypt with or without a password
-	if password == "" {
-		return copyData(reader, writer)
+	metrics.RecordEntry(opts.Metrics, cipherName(suite), metrics.OP_ENCRYPT, in.BytesRead, out.BytesWritten, time.Since(start))
+	opts.Progress.Done("")
+	return nil
+}
+
+func encryptStream(reader io.Reader, writer io.Writer, password string, suite CipherSuite, opts EncryptionOptions) error {
+	header := metadata{HMAC: opts.HMAC, ChunkSize: opts.ChunkSize}
+	if header.ChunkSize == 0 {
+		header.ChunkSize = constants.BUFFER_SIZE
+	}
+	if header.ChunkSize < 0 || header.ChunkSize > MAX_CHUNK_SIZE {
+		return fmt.Errorf("chunk size %d is outside of 1 to %d bytes", header.ChunkSize, MAX_CHUNK_SIZE)
+	}
+
+	var keyFile []byte
+	if opts.KeyFile != "" {
+		var err error
+		if keyFile, err = ReadKeyFile(opts.KeyFile); err != nil {
+			return err
+		}
 	}
-	return encryptWithPassword(reader, writer, password)
+
+	var key []byte
+	if password != "" || keyFile != nil {
+		params, err := newKeyDerivationParams(opts)
+		if err != nil {
+			return err
+		}
+		key, err = deriveKey(keySecret(password, keyFile), params)
+		if err != nil {
+			return err
+		}
+		header.Suite = suite
+		header.KDF = &params
+		header.Password = password != ""
+		header.KeyFile = keyFile != nil
+	}
+
+	// the HMAC covers everything written before the tag, the header included
+	output := writer
+	var mac hash.Hash
+	if opts.HMAC {
+		integrityKey, err := newIntegrityKey(key)
+		if err != nil {
+			return err
+		}
+		if key == nil {
+			header.HMACKey = integrityKey
+		}
+		mac = hmac.New(sha256.New, integrityKey)
+		output = io.MultiWriter(writer, mac)
+	}
+
+	if err := writeMetadata(output, header); err != nil {
+		return err
+	}
+
+	// Without a password the data is stored after the metadata as is
+	var err error
+	if key == nil {
+		err = copyData(reader, output)
+	} else {
+		err = encryptWithPassword(reader, output, key, suite, header.ChunkSize)
+	}
+	if err != nil {
+		return err
+	}
+
+	if mac != nil {
+		if _, err := writer.Write(mac.Sum(nil)); err != nil {
+			return fmt.Errorf("failed to write HMAC: %v", err)
+		}
+	}
+	return nil
 }
 
 // DecryptStream reads encrypted data from the provided reader, decrypts it using the given password,
 // and writes the decrypted data to the provided writer. If the data does not require a password,
-// it is copied directly from the reader to the writer.
+// it is copied directly from the reader to the writer. If the stream ends with an HMAC, the whole
+// stream is verified before anything is written and ErrIntegrityFailure is returned on a mismatch.
 //
 // Parameters:
+//   - ctx: Cancels the decryption, the error is then ctx.Err().
 //   - reader: An io.Reader from which the encrypted data is read.
 //   - writer: An io.Writer to which the decrypted data is written.
 //   - password: A string containing the password used for decryption.
+//   - options: Optional settings, only the first value is used.
 //
 // Returns:
 //   - error: An error if any issues occur during the decryption process, or nil if successful.
-func DecryptStream(reader io.Reader, writer io.Writer, password string) error {
-	// Parse metadata to determine if password is required
-	hasPassword, err := readMetadata(reader)
+func DecryptStream(ctx context.Context, reader io.Reader, writer io.Writer, password string, options ...EncryptionOptions) error {
+	opts := resolveOptions(options)
+	start := time.Now()
+
+	in := &utils.CountingReader{Reader: utils.CancelReader(ctx, reader)}
+	out := &utils.CountingWriter{Writer: writer}
+
+	suite, err := decryptStream(in, out, password, opts)
 	if err != nil {
+		err = utils.ContextError(ctx, err)
+		metrics.RecordError(opts.Metrics, cipherName(suite), metrics.OP_DECRYPT, err)
 		return err
 	}
 
-	// If no password was used, copy the data directly
-	if !hasPassword {
-		return copyData(reader, writer)
+	metrics.RecordEntry(opts.Metrics, cipherName(suite), metrics.OP_DECRYPT, in.BytesRead, out.BytesWritten, time.Since(start))
+	return nil
+}
+
+// decryptStream decrypts the stream and returns the cipher suite it was encrypted with,
+// zero when no password was used or the metadata could not be read.
+func decryptStream(in *utils.CountingReader, writer io.Writer, password string, opts EncryptionOptions) (CipherSuite, error) {
+	// Parse metadata to determine if password is required, keeping its bytes for the HMAC
+	var headerBytes bytes.Buffer
+	header, err := readMetadata(io.TeeReader(in, &headerBytes))
+	if errors.Is(err, errInvalidMetadata) && isLegacyFlag(headerBytes.Bytes()[0]) {
+		// only the first byte is metadata, the bytes read after it belong to the payload
+		payload := io.MultiReader(bytes.NewReader(headerBytes.Bytes()[1:]), in)
+		return decryptLegacy(payload, writer, password, headerBytes.Bytes()[0] == constants.PASSWORD, opts)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var key []byte
+	if header.KDF != nil {
+		if opts.CipherSuite != 0 && opts.CipherSuite != header.Suite {
+			return header.Suite, fmt.Errorf("archive is encrypted with %s, not %s", header.Suite, opts.CipherSuite)
+		}
+		if header.Password && password == "" {
+			return header.Suite, authError("password required for decryption")
+		}
+		if !header.Password {
+			// a password given for a key file only archive is not part of the key
+			password = ""
+		}
+
+		var keyFile []byte
+		if header.KeyFile {
+			if opts.KeyFile == "" {
+				return header.Suite, authError("key file required for decryption")
+			}
+			if keyFile, err = ReadKeyFile(opts.KeyFile); err != nil {
+				return header.Suite, err
+			}
+		}
+
+		key, err = deriveKey(keySecret(password, keyFile), *header.KDF)
+		if err != nil {
+			return header.Suite, err
+		}
+	}
+
+	var reader io.Reader = in
+	if header.HMAC {
+		integrityKey := header.HMACKey
+		if key != nil {
+			integrityKey = deriveIntegrityKey(key)
+		}
+
+		// nothing is written before the whole stream is authenticated, the verification
+		// reads the underlying input so the byte counts only include the decryption pass
+		dataLen, err := verifyStream(in.Reader, headerBytes.Bytes(), integrityKey)
+		if err != nil {
+			return header.Suite, err
+		}
+		reader = io.LimitReader(in, dataLen)
 	}
 
-	// Decrypt the data
-	return decryptWithPassword(reader, writer, password)
+	// If no password was used, copy the data directly, otherwise decrypt it
+	if key == nil {
+		err = copyData(reader, writer)
+	} else {
+		err = decryptWithPassword(reader, writer, key, header.Suite, header.ChunkSize)
+	}
+	if err != nil {
+		return header.Suite, err
+	}
+
+	if header.HMAC {
+		// consume the verified tag
+		if _, err := io.Copy(io.Discard, in); err != nil {
+			return header.Suite, err
+		}
+	}
+	return header.Suite, nil
 }
 
+// metadata is the header of an encrypted stream, written by writeMetadata.
+type metadata struct {
+	// Suite is the cipher suite when a password is used.
+	Suite CipherSuite
+	// KDF holds the key derivation parameters when a password or a key file is used, nil otherwise.
+	KDF *KeyDerivationParams
+	// Password is set when the key is derived from a password.
+	Password bool
+	// KeyFile is set when the key is derived from a key file, combined with the password if
+	// Password is set as well.
+	KeyFile bool
+	// HMAC is set when the stream ends with an HMAC-SHA256 tag.
+	HMAC bool
+	// HMACKey is the integrity key, stored in plaintext only when no password is used.
+	// With a password it is derived from the encryption key.
+	HMACKey []byte
+	// ChunkSize is the number of plaintext bytes sealed at a time when a password is used.
+	ChunkSize int
+}
 
 // writeMetadata writes metadata to the provided writer indicating whether a password is used.
-// If the password is an empty string, it writes a constant indicating no password is used.
-// Otherwise, it writes a constant indicating a password is used.
+// Without key derivation parameters it writes a constant indicating no password is used.
+// Otherwise, it writes a constant indicating a password and the key derivation function, followed
+// by the cipher suite and the salt and parameters needed to derive the key again. With a key
+// file the constant is followed by the key derivation function and whether a password is
+// combined with the key file, then by the same fields. Both are followed by the
+// integrity mode, and without a password by the integrity key when an HMAC is used. With a
+// password the integrity mode has CHUNK_SIZE_FLAG set and the chunk size follows.
 //
 // Parameters:
 //   - writer: An io.Writer where the metadata will be written.
-//   - password: A string representing the password. If empty, it indicates no password.
+//   - header: The metadata to write.
 //
 // Returns:
 //   - error: An error if writing to the writer fails, otherwise nil.
-func writeMetadata(writer io.Writer, password string) error {
-	var metadata []byte
-	if password == "" {
-		metadata = append(metadata, constants.NO_PASSWORD) // No password
+func writeMetadata(writer io.Writer, header metadata) error {
+	var data []byte
+	if header.KDF == nil {
+		data = append(data, constants.NO_PASSWORD) // No password
+	} else if header.KeyFile {
+		data = append(data, constants.KEYFILE, byte(header.KDF.KDF), boolByte(header.Password), byte(header.Suite))
+	} else if header.KDF.KDF == ARGON2ID {
+		data = append(data, constants.PASSWORD_ARGON2ID, byte(header.Suite))
 	} else {
-		metadata = append(metadata, constants.PASSWORD) // Password used
+		data = append(data, constants.PASSWORD, byte(header.Suite)) // Password used
 	}
-	_, err := writer.Write(metadata)
-	return err
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+
+	if header.KDF != nil && header.KDF.KDF == ARGON2ID {
+		if err := format.WriteArgon2Header(writer, format.Argon2Header{
+			Salt:    header.KDF.Salt,
+			Time:    uint32(header.KDF.Iterations),
+			Memory:  header.KDF.Memory,
+			Threads: header.KDF.Threads,
+		}); err != nil {
+			return err
+		}
+	} else if header.KDF != nil {
+		if err := format.WriteKeyDerivationHeader(writer, format.KeyDerivationHeader{
+			Salt:       header.KDF.Salt,
+			Iterations: uint32(header.KDF.Iterations),
+		}); err != nil {
+			return err
+		}
+	}
+
+	data = []byte{INTEGRITY_NONE}
+	if header.HMAC {
+		data[0] = INTEGRITY_HMAC_SHA256
+		if header.KDF == nil {
+			data = append(data, header.HMACKey...)
+		}
+	}
+	if header.KDF == nil {
+		_, err := writer.Write(data)
+		return err
+	}
+	data[0] |= CHUNK_SIZE_FLAG
+	if _, err := writer.Write(data); err != nil {
+		return err
+	}
+	return format.WriteChunkSize(writer, uint32(header.ChunkSize))
+}
+
+// LooksEncrypted reports whether header, the first bytes of a file, could start the metadata
+// EncryptStream writes. Only the flags at the start are checked, a byte of text never passes
+// for them; DecryptStream reads the whole metadata. A header cut before a flag passes.
+func LooksEncrypted(header []byte) bool {
+	if len(header) == 0 {
+		return false
+	}
+	switch header[0] {
+	case constants.NO_PASSWORD:
+		return len(header) < 2 || header[1] == INTEGRITY_NONE || header[1] == INTEGRITY_HMAC_SHA256
+	case constants.PASSWORD, constants.PASSWORD_ARGON2ID:
+		return len(header) < 2 || isCipherSuite(header[1])
+	case constants.KEYFILE:
+		if len(header) > 1 && KDF(header[1]) != PBKDF2 && KDF(header[1]) != ARGON2ID {
+			return false
+		}
+		if len(header) > 2 && header[2] > 1 {
+			return false
+		}
+		return len(header) < 4 || isCipherSuite(header[3])
+	}
+	return false
+}
+
+// LooksLegacyEncrypted reports whether header could start an archive encrypted by the first
+// releases: constants.PASSWORD followed by a random nonce, see decryptLegacy. Any bytes pass
+// after the flag, so text starting with it has to be ruled out first.
+func LooksLegacyEncrypted(header []byte) bool {
+	return len(header) > 0 && header[0] == constants.PASSWORD
+}
+
+func isCipherSuite(flag byte) bool {
+	return CipherSuite(flag) == AES_GCM || CipherSuite(flag) == CHACHA20_POLY1305
 }
 
-// readMetadata reads a single byte of metadata from the provided io.Reader.
-// It returns a boolean indicating whether a password is required and an error if any occurs during reading.
-// The metadata byte is interpreted as follows:
-// - constants.NO_PASSWORD: returns false, nil
-// - constants.PASSWORD: returns true, nil
-// - Any other value: returns false, fmt.Errorf("invalid metadata")
+// readMetadata reads the metadata written by writeMetadata from the provided io.Reader.
+// The first byte is interpreted as follows:
+// - constants.NO_PASSWORD: no cipher suite and key derivation parameters follow
+// - constants.PASSWORD: the cipher suite and the PBKDF2 parameters follow
+// - constants.PASSWORD_ARGON2ID: the cipher suite and the Argon2id parameters follow
+// - constants.KEYFILE: the key derivation function, the password flag, the cipher suite and
+//   the key derivation parameters follow
+// - Any other value: returns errInvalidMetadata
+//
+// Archives without CHUNK_SIZE_FLAG in the integrity mode get LEGACY_CHUNK_SIZE.
 //
 // Parameters:
-// - reader: an io.Reader from which the metadata byte is read.
+// - reader: an io.Reader from which the metadata is read.
 //
 // Returns:
-// - bool: true if a password is required, false otherwise.
+// - metadata: the decoded metadata, its KDF field is nil if no password is required.
 // - error: an error if there is an issue reading the metadata or if the metadata is invalid.
-func readMetadata(reader io.Reader) (bool, error) {
-	metadata := make([]byte, 1)
-	if _, err := io.ReadFull(reader, metadata); err != nil {
-		return false, fmt.Errorf("failed to read metadata: %v", err)
+func readMetadata(reader io.Reader) (metadata, error) {
+	header := metadata{}
+
+	flag := make([]byte, 1)
+	if _, err := io.ReadFull(reader, flag); err != nil {
+		return header, fmt.Errorf("failed to read metadata: %v", err)
 	}
-	switch metadata[0] {
+	switch flag[0] {
 	case constants.NO_PASSWORD:
-		return false, nil
 	case constants.PASSWORD:
-		return true, nil
+		header.Password = true
+		if err := readPasswordMetadata(reader, PBKDF2, &header); err != nil {
+			return metadata{}, err
+		}
+	case constants.PASSWORD_ARGON2ID:
+		header.Password = true
+		if err := readPasswordMetadata(reader, ARGON2ID, &header); err != nil {
+			return metadata{}, err
+		}
+	case constants.KEYFILE:
+		if err := readKeyFileMetadata(reader, &header); err != nil {
+			return metadata{}, err
+		}
 	default:
-		return false, fmt.Errorf("invalid metadata")
+		return header, errInvalidMetadata
 	}
+
+	if _, err := io.ReadFull(reader, flag); err != nil {
+		return metadata{}, fmt.Errorf("failed to read metadata: %v", err)
+	}
+	hasChunkSize := flag[0]&CHUNK_SIZE_FLAG != 0
+	switch flag[0] &^ CHUNK_SIZE_FLAG {
+	case INTEGRITY_NONE:
+	case INTEGRITY_HMAC_SHA256:
+		header.HMAC = true
+		if header.KDF == nil {
+			header.HMACKey = make([]byte, HMAC_KEY_SIZE)
+			if _, err := io.ReadFull(reader, header.HMACKey); err != nil {
+				return metadata{}, fmt.Errorf("failed to read metadata: %v", err)
+			}
+		}
+	default:
+		return metadata{}, fmt.Errorf("%w: unknown integrity mode %d", errInvalidMetadata, flag[0])
+	}
+
+	header.ChunkSize = LEGACY_CHUNK_SIZE
+	if hasChunkSize {
+		chunkSize, err := format.ReadChunkSize(reader)
+		if err != nil {
+			return metadata{}, fmt.Errorf("failed to read metadata: %v", err)
+		}
+		header.ChunkSize = int(chunkSize)
+		if header.ChunkSize < 1 || header.ChunkSize > MAX_CHUNK_SIZE {
+			return metadata{}, fmt.Errorf("%w: chunk size %d", errInvalidMetadata, header.ChunkSize)
+		}
+	}
+
+	return header, nil
+}
+
+// isLegacyFlag reports whether flag is the first byte of the archives of the first releases,
+// which wrote constants.NO_PASSWORD or constants.PASSWORD and nothing else before the payload.
+func isLegacyFlag(flag byte) bool {
+	return flag == constants.NO_PASSWORD || flag == constants.PASSWORD
+}
+
+// decryptLegacy decrypts an archive of the first releases, whose metadata is only its first
+// byte. Without a password the payload follows it unchanged. With one it is followed by a
+// single nonce and the payload sealed with AES-GCM in LEGACY_CHUNK_SIZE byte chunks, all with
+// that nonce and the key of legacyKey. Those chunks carry no counter, so an archive cut after
+// a full chunk decrypts without an error; the payload checks catch it.
+//
+// Parameters:
+//   - reader: the archive after its first byte
+//   - writer: receives the payload
+//   - password: the password the archive was encrypted with
+//   - encrypted: whether the first byte was constants.PASSWORD
+//   - opts: only CipherSuite is checked
+//
+// Returns:
+//   - CipherSuite: AES_GCM for an encrypted archive, zero otherwise
+//   - error: if the password is missing or wrong, or reading or writing fails
+func decryptLegacy(reader io.Reader, writer io.Writer, password string, encrypted bool, opts EncryptionOptions) (CipherSuite, error) {
+	if !encrypted {
+		return 0, copyData(reader, writer)
+	}
+	if opts.CipherSuite != 0 && opts.CipherSuite != AES_GCM {
+		return AES_GCM, fmt.Errorf("archive is encrypted with %s, not %s", AES_GCM, opts.CipherSuite)
+	}
+	if password == "" {
+		return AES_GCM, authError("password required for decryption")
+	}
+
+	key, err := legacyKey(password)
+	if err != nil {
+		return AES_GCM, err
+	}
+	gcm, err := newAEAD(AES_GCM, key)
+	if err != nil {
+		return AES_GCM, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(reader, nonce); err != nil {
+		return AES_GCM, fmt.Errorf("failed to read nonce: %v", err)
+	}
+
+	buf := make([]byte, LEGACY_CHUNK_SIZE+gcm.Overhead())
+	for {
+		n, err := io.ReadFull(reader, buf)
+		if err == io.EOF {
+			return AES_GCM, nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return AES_GCM, err
+		}
+
+		plaintext, err := gcm.Open(nil, nonce, buf[:n], nil)
+		if err != nil {
+			return AES_GCM, authError(fmt.Sprintf("decryption failed: %v", err))
+		}
+		if _, err := writer.Write(plaintext); err != nil {
+			return AES_GCM, err
+		}
+
+		if n < len(buf) {
+			return AES_GCM, nil
+		}
+	}
+}
+
+// readKeyFileMetadata reads the key derivation function and the password flag of a key file
+// archive, followed by the fields read by readPasswordMetadata.
+func readKeyFileMetadata(reader io.Reader, header *metadata) error {
+	fields := make([]byte, 2)
+	if _, err := io.ReadFull(reader, fields); err != nil {
+		return fmt.Errorf("failed to read metadata: %v", err)
+	}
+
+	kdf := KDF(fields[0])
+	if kdf != PBKDF2 && kdf != ARGON2ID {
+		return fmt.Errorf("%w: %s", errInvalidMetadata, kdf)
+	}
+	switch fields[1] {
+	case 0:
+	case 1:
+		header.Password = true
+	default:
+		return fmt.Errorf("%w: unknown password flag %d", errInvalidMetadata, fields[1])
+	}
+
+	header.KeyFile = true
+	return readPasswordMetadata(reader, kdf, header)
+}
+
+// readPasswordMetadata reads the cipher suite and the parameters of the key derivation function kdf.
+func readPasswordMetadata(reader io.Reader, kdf KDF, header *metadata) error {
+	suite := make([]byte, 1)
+	if _, err := io.ReadFull(reader, suite); err != nil {
+		return fmt.Errorf("failed to read metadata: %v", err)
+	}
+	header.Suite = CipherSuite(suite[0])
+	if header.Suite != AES_GCM && header.Suite != CHACHA20_POLY1305 {
+		return fmt.Errorf("%w: %s", errInvalidMetadata, header.Suite)
+	}
+
+	if kdf == ARGON2ID {
+		argon, err := format.ReadArgon2Header(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read metadata: %v", err)
+		}
+		params := KeyDerivationParams{KDF: ARGON2ID, Salt: argon.Salt, Iterations: int(argon.Time), Memory: argon.Memory, Threads: argon.Threads}
+		if err := params.validate(); err != nil {
+			return fmt.Errorf("%w: %v", errInvalidMetadata, err)
+		}
+		header.KDF = &params
+		return nil
+	}
+
+	pbkdf2, err := format.ReadKeyDerivationHeader(reader)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata: %v", err)
+	}
+	if pbkdf2.Iterations < 1 || pbkdf2.Iterations > MAX_KDF_ITERATIONS {
+		return fmt.Errorf("%w: key derivation iteration count %d", errInvalidMetadata, pbkdf2.Iterations)
+	}
+
+	header.KDF = &KeyDerivationParams{KDF: PBKDF2, Salt: pbkdf2.Salt, Iterations: int(pbkdf2.Iterations)}
+	return nil
+}
+
+// boolByte returns 1 for true and 0 for false.
+func boolByte(value bool) byte {
+	if value {
+		return 1
+	}
+	return 0
 }
 
 // simply copies data from the reader to the writer without encryption
@@ -119,28 +687,20 @@ func copyData(reader io.Reader, writer io.Writer) error {
 }
 
 
-// encryptWithPassword encrypts data from the provided reader using the given password
-// and writes the encrypted data to the provided writer.
+// encryptWithPassword encrypts data from the provided reader with the key derived from the
+// password and writes the encrypted data to the provided writer.
 //
 // Parameters:
 //   - reader: An io.Reader from which the plaintext data is read.
 //   - writer: An io.Writer to which the encrypted data is written.
-//   - password: A string used to generate the encryption key.
+//   - key: The key derived from the password with the parameters written by writeMetadata.
+//   - suite: The cipher suite to encrypt with.
+//   - chunkSize: The number of plaintext bytes sealed at a time.
 //
 // Returns:
 //   - error: An error if any step of the encryption process fails, otherwise nil.
-func encryptWithPassword(reader io.Reader, writer io.Writer, password string) error {
-	key, err := generateKey(password)
-	if err != nil {
-		return err
-	}
-
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return err
-	}
-
-	gcm, err := cipher.NewGCM(block)
+func encryptWithPassword(reader io.Reader, writer io.Writer, key []byte, suite CipherSuite, chunkSize int) error {
+	gcm, err := newAEAD(suite, key)
 	if err != nil {
 		return err
 	}
@@ -156,46 +716,30 @@ func encryptWithPassword(reader io.Reader, writer io.Writer, password string) er
 	}
 
 	// Encrypt and write the data in chunks
-	return processStream(reader, writer, gcm, nonce)
+	return processStream(reader, writer, gcm, nonce, chunkSize)
 }
 
 
-// decryptWithPassword decrypts data from the provided reader using the given password
-// and writes the decrypted data to the provided writer. It returns an error if the
+// decryptWithPassword decrypts data from the provided reader with the key derived from the
+// password and writes the decrypted data to the provided writer. It returns an error if the
 // decryption process fails at any step.
 //
 // Parameters:
-// - reader: an io.Reader from which the encrypted data is read.
+// - reader: an io.Reader from which the encrypted data is read, positioned after the metadata.
 // - writer: an io.Writer to which the decrypted data is written.
-// - password: a string used to derive the decryption key.
+// - key: the key derived from the password with the parameters read by readMetadata.
+// - suite: the cipher suite read by readMetadata.
+// - chunkSize: the chunk size read by readMetadata.
 //
 // Returns:
 // - error: an error if the decryption fails, or nil if the decryption is successful.
 //
 // The function performs the following steps:
-// 1. Validates that the password is not empty.
-// 2. Generates a decryption key from the password.
-// 3. Creates a new AES cipher block using the generated key.
-// 4. Creates a Galois/Counter Mode (GCM) cipher from the AES block.
-// 5. Reads and validates the nonce from the reader.
-// 6. Decrypts the data in chunks and writes it to the writer.
-func decryptWithPassword(reader io.Reader, writer io.Writer, password string) error {
-
-	if password == "" {
-		return fmt.Errorf("password required for decryption")
-	}
-
-	key, err := generateKey(password)
-	if err != nil {
-		return err
-	}
-
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return err
-	}
-
-	gcm, err := cipher.NewGCM(block)
+// 1. Creates the AEAD cipher of the suite with the key.
+// 2. Reads and validates the nonce from the reader.
+// 3. Decrypts the data in chunks and writes it to the writer.
+func decryptWithPassword(reader io.Reader, writer io.Writer, key []byte, suite CipherSuite, chunkSize int) error {
+	gcm, err := newAEAD(suite, key)
 	if err != nil {
 		return err
 	}
@@ -208,7 +752,7 @@ func decryptWithPassword(reader io.Reader, writer io.Writer, password string) er
 	}
 
 	// Decrypt and write the data in chunks
-	return decryptStream(reader, writer, gcm, nonce)
+	return processDecryptStream(reader, writer, gcm, nonce, chunkSize)
 }
 
 
@@ -231,72 +775,170 @@ func generateNonce(gcm cipher.AEAD) ([]byte, error) {
 }
 
 
+// chunkAdditionalData returns the additional data a chunk is sealed with, the big-endian chunk
+// counter followed by 1 for the last chunk of the stream and 0 otherwise. A chunk moved to
+// another position or a stream cut off after any chunk but the last one fails to open.
+//
+// Parameters:
+//   - counter: the position of the chunk in the stream
+//   - final: whether the chunk is the last one
+//
+// Returns:
+//   - []byte: the additional data
+func chunkAdditionalData(counter uint64, final bool) []byte {
+	data := make([]byte, 9)
+	binary.BigEndian.PutUint64(data, counter)
+	if final {
+		data[8] = 1
+	}
+	return data
+}
+
+// chunkNonce derives the nonce of a chunk by XORing the big-endian chunk counter into the
+// last 8 bytes of the base nonce, so every chunk of a stream uses a different nonce.
+//
+// Parameters:
+//   - base: the random nonce stored at the start of the stream
+//   - counter: the position of the chunk in the stream
+//
+// Returns:
+//   - []byte: the nonce for the chunk, base is left unchanged
+func chunkNonce(base []byte, counter uint64) []byte {
+	nonce := make([]byte, len(base))
+	copy(nonce, base)
+
+	var counterBytes [8]byte
+	binary.BigEndian.PutUint64(counterBytes[:], counter)
+	offset := len(nonce) - len(counterBytes)
+	for i, b := range counterBytes {
+		nonce[offset+i] ^= b
+	}
+
+	return nonce
+}
+
 // processStream reads data from the provided io.Reader, encrypts it using the given
-// cipher.AEAD and nonce, and writes the encrypted data to the provided io.Writer.
-// 
+// cipher.AEAD and base nonce, and writes the encrypted data to the provided io.Writer.
+//
 // Parameters:
 //   - reader: an io.Reader from which the data is read.
 //   - writer: an io.Writer to which the encrypted data is written.
 //   - gcm: a cipher.AEAD instance used for encryption.
-//   - nonce: a byte slice used as the nonce for encryption.
+//   - nonce: the base nonce, every chunk is sealed with its own nonce derived by chunkNonce.
+//   - chunkSize: the number of plaintext bytes sealed at a time.
 //
 // Returns:
 //   - error: an error if any occurs during reading, encrypting, or writing the data.
 //
-// The function reads data in chunks of size constants.BUFFER_SIZE, encrypts each chunk
-// using the provided AEAD cipher and nonce, and writes the encrypted chunk to the writer.
-// The process continues until the end of the reader is reached.
-func processStream(reader io.Reader, writer io.Writer, gcm cipher.AEAD, nonce []byte) error {
-	buf := make([]byte, constants.BUFFER_SIZE)
-	for {
-		n, err := reader.Read(buf)
-		if err != nil && err != io.EOF {
+// The function reads data in chunks of chunkSize bytes and writes every sealed
+// chunk after a format.ChunkHeader holding the chunk counter and the sealed length. It reads
+// one chunk ahead to seal the last chunk as final, an empty input gives a single empty chunk.
+func processStream(reader io.Reader, writer io.Writer, gcm cipher.AEAD, nonce []byte, chunkSize int) error {
+	buf := make([]byte, chunkSize)
+	next := make([]byte, chunkSize)
+
+	n, err := readChunk(reader, buf)
+	if err != nil {
+		return err
+	}
+	for counter := uint64(0); ; counter++ {
+		nextLen, err := readChunk(reader, next)
+		if err != nil {
 			return err
 		}
-		if n == 0 {
-			break
-		}
+		final := nextLen == 0
 
-		// Encrypt the chunk and write it
-		ciphertext := gcm.Seal(nil, nonce, buf[:n], nil)
+		// Encrypt the chunk and write it with its header
+		ciphertext := gcm.Seal(nil, chunkNonce(nonce, counter), buf[:n], chunkAdditionalData(counter, final))
+		if err := format.WriteChunkHeader(writer, format.ChunkHeader{Counter: counter, Length: uint32(len(ciphertext))}); err != nil {
+			return err
+		}
 		if _, err := writer.Write(ciphertext); err != nil {
 			return err
 		}
+
+		if final {
+			return nil
+		}
+		buf, next, n = next, buf, nextLen
 	}
-	return nil
+}
+
+// readChunk fills buf from reader and returns the number of bytes read, 0 at the end of the input.
+func readChunk(reader io.Reader, buf []byte) (int, error) {
+	n, err := io.ReadFull(reader, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	return n, nil
 }
 
 
-// decryptStream decrypts data from the provided io.Reader and writes the decrypted data to the provided io.Writer.
-// It uses the given cipher.AEAD and nonce for decryption.
+// processDecryptStream decrypts data from the provided io.Reader and writes the decrypted data to the provided io.Writer.
+// It uses the given cipher.AEAD and base nonce for decryption.
 //
 // Parameters:
 //   - reader: an io.Reader from which encrypted data is read.
 //   - writer: an io.Writer to which decrypted data is written.
 //   - gcm: a cipher.AEAD instance used for decryption.
-//   - nonce: a byte slice containing the nonce used for decryption.
+//   - nonce: the base nonce read from the start of the stream.
+//   - chunkSize: the chunk size the stream was sealed with, longer chunks are rejected.
 //
 // Returns:
-//   - error: an error if decryption or writing fails, otherwise nil.
-func decryptStream(reader io.Reader, writer io.Writer, gcm cipher.AEAD, nonce []byte) error {
-	buf := make([]byte, constants.BUFFER_SIZE+gcm.Overhead())
-	for {
-		n, err := reader.Read(buf)
-		if err != nil && err != io.EOF {
-			return err
+//   - error: ErrTamperedStream if chunks were removed, appended or reordered, an error if a
+//     chunk is truncated, fails authentication, or writing fails, otherwise nil.
+//
+// The header of the next chunk is read before a chunk is opened, the chunk is the final one
+// when there is none.
+func processDecryptStream(reader io.Reader, writer io.Writer, gcm cipher.AEAD, nonce []byte, chunkSize int) error {
+	maxLength := uint32(chunkSize + gcm.Overhead())
+	buf := make([]byte, maxLength)
+
+	header, err := format.ReadChunkHeader(reader)
+	if err == io.EOF {
+		return fmt.Errorf("%w: the stream has no chunks", ErrTamperedStream)
+	}
+	if err != nil {
+		return err
+	}
+	for counter := uint64(0); ; counter++ {
+		if header.Counter != counter {
+			return fmt.Errorf("%w: expected chunk %d, found chunk %d", ErrTamperedStream, counter, header.Counter)
+		}
+		if header.Length > maxLength {
+			return fmt.Errorf("decryption failed: chunk %d is %d bytes long, the limit is %d", counter, header.Length, maxLength)
 		}
-		if n == 0 {
-			break
+
+		if _, err := io.ReadFull(reader, buf[:header.Length]); err != nil {
+			return fmt.Errorf("decryption failed: chunk %d is truncated: %v", counter, err)
+		}
+
+		next, err := format.ReadChunkHeader(reader)
+		final := err == io.EOF
+		if err != nil && !final {
+			return err
 		}
 
 		// Decrypt the chunk and write it
-		plaintext, err := gcm.Open(nil, nonce, buf[:n], nil)
+		chunkNonce := chunkNonce(nonce, counter)
+		plaintext, err := gcm.Open(nil, chunkNonce, buf[:header.Length], chunkAdditionalData(counter, final))
 		if err != nil {
-			return fmt.Errorf("decryption failed: %v", err)
+			// a chunk that opens with the other flag is authentic, but the stream was cut or extended
+			if _, flagErr := gcm.Open(nil, chunkNonce, buf[:header.Length], chunkAdditionalData(counter, !final)); flagErr == nil {
+				if final {
+					return fmt.Errorf("%w: the stream ends after chunk %d, before its final chunk", ErrTamperedStream, counter)
+				}
+				return fmt.Errorf("%w: data follows the final chunk %d", ErrTamperedStream, counter)
+			}
+			return authError(fmt.Sprintf("decryption failed: %v", err))
 		}
 		if _, err := writer.Write(plaintext); err != nil {
 			return err
 		}
+
+		if final {
+			return nil
+		}
+		header = next
 	}
-	return nil
 }
@@ -2,8 +2,21 @@ package encryption
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"file-compressor/constants"
+	"file-compressor/format"
+	"file-compressor/metrics"
 )
 
 var input []byte = []byte("Hello world")
@@ -20,7 +33,7 @@ func TestEncryptWithPassword(t *testing.T) {
 
 	encryptedData := bytes.NewBuffer([]byte{})
 
-	err := EncryptStream(reader, encryptedData, password)
+	err := EncryptStream(context.Background(), reader, encryptedData, password)
 	if err != nil {
 		t.Fatalf(fatalEncrPassErr, err)
 	}
@@ -28,7 +41,7 @@ func TestEncryptWithPassword(t *testing.T) {
 	decryptedData := bytes.NewBuffer([]byte{})
 	encryptedReader := bytes.NewReader(encryptedData.Bytes())
 
-	err = DecryptStream(encryptedReader, decryptedData, password)
+	err = DecryptStream(context.Background(), encryptedReader, decryptedData, password)
 	if err != nil {
 		t.Fatalf(fatalDecrPassErr, err)
 	}
@@ -44,7 +57,7 @@ func TestEncryptWithoutPassword(t *testing.T) {
 
 	encryptedData := bytes.NewBuffer([]byte{})
 
-	err := EncryptStream(reader, encryptedData, "")
+	err := EncryptStream(context.Background(), reader, encryptedData, "")
 	if err != nil {
 		t.Fatalf(fatalEncrPassErr, err)
 	}
@@ -52,7 +65,7 @@ func TestEncryptWithoutPassword(t *testing.T) {
 	decryptedData := bytes.NewBuffer([]byte{})
 	encryptedReader := bytes.NewReader(encryptedData.Bytes())
 
-	err = DecryptStream(encryptedReader, decryptedData, "")
+	err = DecryptStream(context.Background(), encryptedReader, decryptedData, "")
 	if err != nil {
 		t.Fatalf(fatalDecrPassErr, err)
 	}
@@ -68,7 +81,7 @@ func TestDecryptInvalidData(t *testing.T) {
 
 	encryptedData := bytes.NewBuffer([]byte{})
 
-	err := EncryptStream(reader, encryptedData, "")
+	err := EncryptStream(context.Background(), reader, encryptedData, "")
 	if err != nil {
 		t.Fatalf(fatalEncrPassErr, err)
 	}
@@ -79,7 +92,7 @@ func TestDecryptInvalidData(t *testing.T) {
 	decryptedData := bytes.NewBuffer([]byte{})
 	encryptedReader := bytes.NewReader(encryptedData.Bytes())
 
-	err = DecryptStream(encryptedReader, decryptedData, "")
+	err = DecryptStream(context.Background(), encryptedReader, decryptedData, "")
 	if err == nil {
 		t.Fatal(DECRYPT_SHOULD_FAIL)
 	}
@@ -91,7 +104,7 @@ func TestDecryptInvalidPassword(t *testing.T) {
 
 	encryptedData := bytes.NewBuffer([]byte{})
 
-	err := EncryptStream(reader, encryptedData, password)
+	err := EncryptStream(context.Background(), reader, encryptedData, password)
 	if err != nil {
 		t.Fatalf(fatalEncrPassErr, err)
 	}
@@ -99,7 +112,7 @@ func TestDecryptInvalidPassword(t *testing.T) {
 	decryptedData := bytes.NewBuffer([]byte{})
 	encryptedReader := bytes.NewReader(encryptedData.Bytes())
 
-	err = DecryptStream(encryptedReader, decryptedData, "invalid")
+	err = DecryptStream(context.Background(), encryptedReader, decryptedData, "invalid")
 	if err == nil {
 		t.Fatal(DECRYPT_SHOULD_FAIL)
 	}
@@ -113,7 +126,7 @@ func TestEncryptWithPassDecryptWithNoPass(t *testing.T) {
 
 	encryptedData := bytes.NewBuffer([]byte{})
 
-	err := EncryptStream(reader, encryptedData, password)
+	err := EncryptStream(context.Background(), reader, encryptedData, password)
 	if err != nil {
 		t.Fatalf(fatalEncrPassErr, err)
 	}
@@ -121,10 +134,1082 @@ func TestEncryptWithPassDecryptWithNoPass(t *testing.T) {
 	decryptedData := bytes.NewBuffer([]byte{})
 	encryptedReader := bytes.NewReader(encryptedData.Bytes())
 
-	err = DecryptStream(encryptedReader, decryptedData, "")
+	err = DecryptStream(context.Background(), encryptedReader, decryptedData, "")
 	if err == nil {
 		t.Fatal(DECRYPT_SHOULD_FAIL)
 	}
 
 	fmt.Printf("Error successfully caught: %v\n", err)
-}
\ No newline at end of file
+}
+func TestEncryptionMetrics(t *testing.T) {
+	m := metrics.NewExpvar("")
+	options := EncryptionOptions{Metrics: m}
+
+	encryptedData := bytes.NewBuffer([]byte{})
+	if err := EncryptStream(context.Background(), bytes.NewReader(input), encryptedData, password, options); err != nil {
+		t.Fatalf(fatalEncrPassErr, err)
+	}
+	encryptedSize := int64(encryptedData.Len())
+
+	decryptedData := bytes.NewBuffer([]byte{})
+	if err := DecryptStream(context.Background(), bytes.NewReader(encryptedData.Bytes()), decryptedData, password, options); err != nil {
+		t.Fatalf(fatalDecrPassErr, err)
+	}
+
+	encrypt := []string{metrics.LABEL_ALGORITHM, "aes-gcm", metrics.LABEL_OPERATION, metrics.OP_ENCRYPT}
+	decrypt := []string{metrics.LABEL_ALGORITHM, "aes-gcm", metrics.LABEL_OPERATION, metrics.OP_DECRYPT}
+
+	if got := m.CounterValue(metrics.BYTES_IN, encrypt...); got != int64(len(input)) {
+		t.Fatalf("expected %d bytes in, got %d", len(input), got)
+	}
+	if got := m.CounterValue(metrics.BYTES_OUT, encrypt...); got != encryptedSize {
+		t.Fatalf("expected %d bytes out, got %d", encryptedSize, got)
+	}
+	if got := m.CounterValue(metrics.BYTES_IN, decrypt...); got != encryptedSize {
+		t.Fatalf("expected %d bytes in, got %d", encryptedSize, got)
+	}
+	if got := m.CounterValue(metrics.BYTES_OUT, decrypt...); got != int64(len(input)) {
+		t.Fatalf("expected %d bytes out, got %d", len(input), got)
+	}
+
+	if err := DecryptStream(context.Background(), bytes.NewReader(encryptedData.Bytes()), io.Discard, "wrong password", options); err == nil {
+		t.Fatal(DECRYPT_SHOULD_FAIL)
+	}
+	if got := m.CounterValue(metrics.ERRORS, metrics.LABEL_ALGORITHM, "aes-gcm", metrics.LABEL_OPERATION, metrics.OP_DECRYPT, metrics.LABEL_TYPE, metrics.ERROR_AUTH); got != 1 {
+		t.Fatalf("expected 1 decryption error, got %d", got)
+	}
+}
+
+// saltOffset is the position of the salt, after the metadata byte and the cipher suite.
+const saltOffset = 2
+
+// headerLen is the size of the metadata byte, the cipher suite, the key derivation parameters,
+// the integrity mode, the chunk size and the nonce.
+const headerLen = saltOffset + format.KEY_DERIVATION_HEADER_LEN + 1 + format.CHUNK_SIZE_LEN + 12
+
+// sealedChunks splits an encrypted stream into its sealed chunks.
+func sealedChunks(t *testing.T, encrypted []byte) [][]byte {
+	reader := bytes.NewReader(encrypted[headerLen:])
+	chunks := [][]byte{}
+	for {
+		header, err := format.ReadChunkHeader(reader)
+		if err == io.EOF {
+			return chunks
+		}
+		if err != nil {
+			t.Fatalf("failed to read chunk header: %v", err)
+		}
+		if header.Counter != uint64(len(chunks)) {
+			t.Fatalf("expected chunk %d, got %d", len(chunks), header.Counter)
+		}
+		chunk := make([]byte, header.Length)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			t.Fatalf("failed to read chunk: %v", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+func TestSameChunksEncryptDifferently(t *testing.T) {
+	chunk := bytes.Repeat([]byte{'x'}, constants.BUFFER_SIZE)
+	plaintext := append(append([]byte{}, chunk...), chunk...)
+
+	encryptedData := bytes.NewBuffer([]byte{})
+	if err := EncryptStream(context.Background(), bytes.NewReader(plaintext), encryptedData, password); err != nil {
+		t.Fatalf(fatalEncrPassErr, err)
+	}
+
+	chunks := sealedChunks(t, encryptedData.Bytes())
+	if len(chunks) != 2 {
+		t.Fatalf("expected 2 chunks, got %d", len(chunks))
+	}
+	if bytes.Equal(chunks[0], chunks[1]) {
+		t.Fatal("identical plaintext chunks must not produce identical ciphertext")
+	}
+
+	decryptedData := bytes.NewBuffer([]byte{})
+	if err := DecryptStream(context.Background(), bytes.NewReader(encryptedData.Bytes()), decryptedData, password); err != nil {
+		t.Fatalf(fatalDecrPassErr, err)
+	}
+	if !bytes.Equal(decryptedData.Bytes(), plaintext) {
+		t.Fatal("decrypted data does not match original data")
+	}
+}
+
+func TestDecryptReorderedChunks(t *testing.T) {
+	plaintext := bytes.Repeat([]byte{'y'}, constants.BUFFER_SIZE*2)
+
+	encryptedData := bytes.NewBuffer([]byte{})
+	if err := EncryptStream(context.Background(), bytes.NewReader(plaintext), encryptedData, password); err != nil {
+		t.Fatalf(fatalEncrPassErr, err)
+	}
+
+	encrypted := encryptedData.Bytes()
+	chunks := sealedChunks(t, encrypted)
+
+	// swap the chunks but keep their headers in order, so only the nonce can catch it
+	swapped := bytes.NewBuffer(append([]byte{}, encrypted[:headerLen]...))
+	format.WriteChunkHeader(swapped, format.ChunkHeader{Counter: 0, Length: uint32(len(chunks[1]))})
+	swapped.Write(chunks[1])
+	format.WriteChunkHeader(swapped, format.ChunkHeader{Counter: 1, Length: uint32(len(chunks[0]))})
+	swapped.Write(chunks[0])
+
+	if err := DecryptStream(context.Background(), bytes.NewReader(swapped.Bytes()), io.Discard, password); err == nil {
+		t.Fatal(DECRYPT_SHOULD_FAIL)
+	}
+}
+
+func TestDecryptTruncatedChunk(t *testing.T) {
+	encryptedData := bytes.NewBuffer([]byte{})
+	if err := EncryptStream(context.Background(), bytes.NewReader(input), encryptedData, password); err != nil {
+		t.Fatalf(fatalEncrPassErr, err)
+	}
+
+	truncated := encryptedData.Bytes()[:encryptedData.Len()-1]
+	if err := DecryptStream(context.Background(), bytes.NewReader(truncated), io.Discard, password); err == nil {
+		t.Fatal(DECRYPT_SHOULD_FAIL)
+	}
+}
+
+// rebuildStream writes the header of encrypted followed by the given chunks, numbered by counters.
+func rebuildStream(encrypted []byte, chunks [][]byte, counters []uint64) []byte {
+	stream := bytes.NewBuffer(append([]byte{}, encrypted[:headerLen]...))
+	for i, chunk := range chunks {
+		format.WriteChunkHeader(stream, format.ChunkHeader{Counter: counters[i], Length: uint32(len(chunk))})
+		stream.Write(chunk)
+	}
+	return stream.Bytes()
+}
+
+func TestDecryptTamperedStream(t *testing.T) {
+	plaintext := bytes.Repeat([]byte{'z'}, constants.BUFFER_SIZE*3)
+
+	encryptedData := bytes.NewBuffer([]byte{})
+	if err := EncryptStream(context.Background(), bytes.NewReader(plaintext), encryptedData, password); err != nil {
+		t.Fatalf(fatalEncrPassErr, err)
+	}
+	encrypted := encryptedData.Bytes()
+	chunks := sealedChunks(t, encrypted)
+	if len(chunks) != 3 {
+		t.Fatalf("expected 3 chunks, got %d", len(chunks))
+	}
+
+	tests := []struct {
+		name   string
+		stream []byte
+	}{
+		// every remaining chunk authenticates, only the missing final flag shows the cut
+		{"drop last chunk", rebuildStream(encrypted, chunks[:2], []uint64{0, 1})},
+		{"drop all chunks", encrypted[:headerLen]},
+		{"swap two chunks", rebuildStream(encrypted, [][]byte{chunks[1], chunks[0], chunks[2]}, []uint64{1, 0, 2})},
+		{"append a chunk", rebuildStream(encrypted, append(chunks, chunks[1]), []uint64{0, 1, 2, 3})},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := DecryptStream(context.Background(), bytes.NewReader(test.stream), io.Discard, password)
+			if !errors.Is(err, ErrTamperedStream) {
+				t.Fatalf("expected %v, got %v", ErrTamperedStream, err)
+			}
+		})
+	}
+
+	// a wrong password is not reported as tampering
+	err := DecryptStream(context.Background(), bytes.NewReader(encrypted), io.Discard, "invalid")
+	if err == nil || errors.Is(err, ErrTamperedStream) {
+		t.Fatalf("expected an authentication error, got %v", err)
+	}
+}
+
+func TestEncryptEmptyStream(t *testing.T) {
+	encryptedData := bytes.NewBuffer([]byte{})
+	if err := EncryptStream(context.Background(), bytes.NewReader(nil), encryptedData, password); err != nil {
+		t.Fatalf(fatalEncrPassErr, err)
+	}
+
+	// the final chunk is written even without data
+	if chunks := sealedChunks(t, encryptedData.Bytes()); len(chunks) != 1 {
+		t.Fatalf("expected 1 chunk, got %d", len(chunks))
+	}
+
+	decryptedData := bytes.NewBuffer([]byte{})
+	if err := DecryptStream(context.Background(), bytes.NewReader(encryptedData.Bytes()), decryptedData, password); err != nil {
+		t.Fatalf(fatalDecrPassErr, err)
+	}
+	if decryptedData.Len() != 0 {
+		t.Fatalf("expected no data, got %d bytes", decryptedData.Len())
+	}
+}
+
+func TestKeyDerivationHeader(t *testing.T) {
+	first := bytes.NewBuffer([]byte{})
+	second := bytes.NewBuffer([]byte{})
+	for _, encrypted := range []*bytes.Buffer{first, second} {
+		if err := EncryptStream(context.Background(), bytes.NewReader(input), encrypted, password); err != nil {
+			t.Fatalf(fatalEncrPassErr, err)
+		}
+	}
+
+	header, err := readMetadata(bytes.NewReader(first.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to read metadata: %v", err)
+	}
+	params := header.KDF
+	if params == nil || len(params.Salt) != format.SALT_LEN || params.Iterations != DEFAULT_KDF_ITERATIONS {
+		t.Fatalf("unexpected key derivation parameters %+v", params)
+	}
+
+	// the salt is random, so the same password must not give the same key twice
+	if bytes.Equal(first.Bytes()[saltOffset:saltOffset+format.SALT_LEN], second.Bytes()[saltOffset:saltOffset+format.SALT_LEN]) {
+		t.Fatal("two archives share a salt")
+	}
+
+	// a changed salt derives a different key and must fail authentication
+	tampered := append([]byte{}, first.Bytes()...)
+	tampered[saltOffset] ^= 0xFF
+	if err := DecryptStream(context.Background(), bytes.NewReader(tampered), io.Discard, password); err == nil {
+		t.Fatal(DECRYPT_SHOULD_FAIL)
+	}
+
+	// an absurd iteration count is rejected before any key is derived
+	tampered = append([]byte{}, first.Bytes()...)
+	format.ByteOrder.PutUint32(tampered[saltOffset+format.SALT_LEN:], 0)
+	if err := DecryptStream(context.Background(), bytes.NewReader(tampered), io.Discard, password); err == nil {
+		t.Fatal(DECRYPT_SHOULD_FAIL)
+	}
+}
+
+func TestGenerateKey(t *testing.T) {
+	salt := bytes.Repeat([]byte{1}, format.SALT_LEN)
+
+	key, err := generateKey(password, salt, 1000)
+	if err != nil {
+		t.Fatalf("failed to derive key: %v", err)
+	}
+	if len(key) != KEY_SIZE {
+		t.Fatalf("expected a %d byte key, got %d", KEY_SIZE, len(key))
+	}
+
+	again, _ := generateKey(password, salt, 1000)
+	otherSalt, _ := generateKey(password, bytes.Repeat([]byte{2}, format.SALT_LEN), 1000)
+	otherIterations, _ := generateKey(password, salt, 1001)
+	if !bytes.Equal(key, again) || bytes.Equal(key, otherSalt) || bytes.Equal(key, otherIterations) {
+		t.Fatal("the key must depend on exactly the password, salt and iteration count")
+	}
+
+	// passwords longer than the key are fine now
+	if _, err := generateKey(string(bytes.Repeat([]byte{'p'}, 100)), salt, 1000); err != nil {
+		t.Fatalf("failed to derive key from a long password: %v", err)
+	}
+
+	if _, err := generateKey(password, nil, 1000); err == nil {
+		t.Fatal("an empty salt should fail")
+	}
+	if _, err := generateKey(password, salt, 0); err == nil {
+		t.Fatal("zero iterations should fail")
+	}
+}
+
+func TestCipherSuites(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("squirrel "), constants.BUFFER_SIZE/4)
+
+	tests := []struct {
+		name    string
+		encrypt CipherSuite
+		decrypt CipherSuite
+		fail    bool
+	}{
+		{"default", 0, 0, false},
+		{"aes-gcm", AES_GCM, AES_GCM, false},
+		{"chacha20-poly1305", CHACHA20_POLY1305, CHACHA20_POLY1305, false},
+		{"chacha20-poly1305 detected", CHACHA20_POLY1305, 0, false},
+		{"aes-gcm as chacha20-poly1305", AES_GCM, CHACHA20_POLY1305, true},
+		{"chacha20-poly1305 as aes-gcm", CHACHA20_POLY1305, AES_GCM, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encryptedData := bytes.NewBuffer([]byte{})
+			if err := EncryptStream(context.Background(), bytes.NewReader(plaintext), encryptedData, password, EncryptionOptions{CipherSuite: test.encrypt}); err != nil {
+				t.Fatalf(fatalEncrPassErr, err)
+			}
+
+			expected := test.encrypt
+			if expected == 0 {
+				expected = DEFAULT_CIPHER_SUITE
+			}
+			if suite := CipherSuite(encryptedData.Bytes()[1]); suite != expected {
+				t.Fatalf("expected %s in the header, got %s", expected, suite)
+			}
+
+			decryptedData := bytes.NewBuffer([]byte{})
+			err := DecryptStream(context.Background(), bytes.NewReader(encryptedData.Bytes()), decryptedData, password, EncryptionOptions{CipherSuite: test.decrypt})
+			if test.fail {
+				if err == nil {
+					t.Fatal(DECRYPT_SHOULD_FAIL)
+				}
+				if decryptedData.Len() != 0 {
+					t.Fatal("a failed decryption must not write any data")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf(fatalDecrPassErr, err)
+			}
+			if !bytes.Equal(decryptedData.Bytes(), plaintext) {
+				t.Fatal("decrypted data does not match original data")
+			}
+		})
+	}
+}
+
+func TestDecryptForgedCipherSuite(t *testing.T) {
+	encryptedData := bytes.NewBuffer([]byte{})
+	if err := EncryptStream(context.Background(), bytes.NewReader(input), encryptedData, password, EncryptionOptions{CipherSuite: AES_GCM}); err != nil {
+		t.Fatalf(fatalEncrPassErr, err)
+	}
+
+	for _, suite := range []byte{byte(CHACHA20_POLY1305), 0, 0x7F} {
+		forged := append([]byte{}, encryptedData.Bytes()...)
+		forged[1] = suite
+		if err := DecryptStream(context.Background(), bytes.NewReader(forged), io.Discard, password); err == nil {
+			t.Fatalf("decrypting with cipher suite 0x%02x %s", suite, DECRYPT_SHOULD_FAIL)
+		}
+	}
+}
+
+func TestParseCipherSuite(t *testing.T) {
+	for _, suite := range []CipherSuite{AES_GCM, CHACHA20_POLY1305} {
+		parsed, err := ParseCipherSuite(suite.String())
+		if err != nil || parsed != suite {
+			t.Fatalf("expected %s, got %s (%v)", suite, parsed, err)
+		}
+	}
+	if _, err := ParseCipherSuite("rot13"); err == nil {
+		t.Fatal("an unknown cipher should fail")
+	}
+}
+
+func TestKeyDerivationOptions(t *testing.T) {
+	salt := bytes.Repeat([]byte{9}, format.SALT_LEN)
+	options := EncryptionOptions{KDFIterations: 1000, Salt: salt}
+
+	encryptedData := bytes.NewBuffer([]byte{})
+	if err := EncryptStream(context.Background(), bytes.NewReader(input), encryptedData, password, options); err != nil {
+		t.Fatalf(fatalEncrPassErr, err)
+	}
+
+	header, err := readMetadata(bytes.NewReader(encryptedData.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to read metadata: %v", err)
+	}
+	params := header.KDF
+	if params.Iterations != 1000 || !bytes.Equal(params.Salt, salt) {
+		t.Fatalf("expected the requested parameters, got %+v", params)
+	}
+
+	// the stored iteration count wins over the options of the reader
+	decryptedData := bytes.NewBuffer([]byte{})
+	if err := DecryptStream(context.Background(), bytes.NewReader(encryptedData.Bytes()), decryptedData, password, EncryptionOptions{KDFIterations: 5}); err != nil {
+		t.Fatalf(fatalDecrPassErr, err)
+	}
+	if decryptedData.String() != string(input) {
+		t.Fatal("decrypted data does not match original data")
+	}
+
+	invalid := []EncryptionOptions{
+		{KDFIterations: -1},
+		{KDFIterations: MAX_KDF_ITERATIONS + 1},
+		{Salt: []byte{1, 2, 3}},
+	}
+	for _, options := range invalid {
+		if err := EncryptStream(context.Background(), bytes.NewReader(input), io.Discard, password, options); err == nil {
+			t.Fatalf("encrypting with %+v should have failed", options)
+		}
+	}
+}
+
+func TestKeyDerivationFunctions(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("squirrel "), constants.BUFFER_SIZE/4)
+
+	tests := []struct {
+		name    string
+		options EncryptionOptions
+		flag    byte
+	}{
+		{"default", EncryptionOptions{KDFIterations: 1000}, constants.PASSWORD},
+		{"pbkdf2", EncryptionOptions{KDF: PBKDF2, KDFIterations: 1000}, constants.PASSWORD},
+		// small parameters keep the test fast, the defaults need 64 MiB
+		{"argon2id", EncryptionOptions{KDF: ARGON2ID, KDFIterations: 1, KDFMemory: 64, KDFThreads: 1}, constants.PASSWORD_ARGON2ID},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encryptedData := bytes.NewBuffer([]byte{})
+			if err := EncryptStream(context.Background(), bytes.NewReader(plaintext), encryptedData, password, test.options); err != nil {
+				t.Fatalf(fatalEncrPassErr, err)
+			}
+			if flag := encryptedData.Bytes()[0]; flag != test.flag {
+				t.Fatalf("expected metadata flag %d, got %d", test.flag, flag)
+			}
+
+			// the parameters come from the header, the reader needs no options
+			decryptedData := bytes.NewBuffer([]byte{})
+			if err := DecryptStream(context.Background(), bytes.NewReader(encryptedData.Bytes()), decryptedData, password); err != nil {
+				t.Fatalf(fatalDecrPassErr, err)
+			}
+			if !bytes.Equal(decryptedData.Bytes(), plaintext) {
+				t.Fatal("decrypted data does not match original data")
+			}
+
+			decryptedData.Reset()
+			if err := DecryptStream(context.Background(), bytes.NewReader(encryptedData.Bytes()), decryptedData, "invalid"); err == nil {
+				t.Fatal(DECRYPT_SHOULD_FAIL)
+			}
+			if decryptedData.Len() != 0 {
+				t.Fatal("a failed decryption must not write any data")
+			}
+		})
+	}
+}
+
+// writeKeyFile writes a key file of size bytes, all set to fill, and returns its path.
+func writeKeyFile(t *testing.T, fill byte, size int) string {
+	path := filepath.Join(t.TempDir(), "backup.key")
+	if err := os.WriteFile(path, bytes.Repeat([]byte{fill}, size), 0600); err != nil {
+		t.Fatalf("failed to write the key file: %v", err)
+	}
+	return path
+}
+
+func TestKeyFile(t *testing.T) {
+	keyFile := writeKeyFile(t, 7, KEY_FILE_SIZE)
+	otherKeyFile := writeKeyFile(t, 8, KEY_FILE_SIZE)
+
+	type credentials struct {
+		password string
+		keyFile  string
+	}
+
+	tests := []struct {
+		name     string
+		encrypt  credentials
+		flag     byte
+		failures []credentials
+	}{
+		{"password only", credentials{password, ""}, constants.PASSWORD, []credentials{{"invalid", ""}, {"", keyFile}}},
+		{"key file only", credentials{"", keyFile}, constants.KEYFILE, []credentials{{"", otherKeyFile}, {password, ""}}},
+		// every credential the archive was encrypted with is needed
+		{"password and key file", credentials{password, keyFile}, constants.KEYFILE, []credentials{{"invalid", keyFile}, {password, otherKeyFile}, {password, ""}, {"", keyFile}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := EncryptionOptions{KDFIterations: 1000, KeyFile: test.encrypt.keyFile}
+			encryptedData := bytes.NewBuffer([]byte{})
+			if err := EncryptStream(context.Background(), bytes.NewReader(input), encryptedData, test.encrypt.password, options); err != nil {
+				t.Fatalf(fatalEncrPassErr, err)
+			}
+			encrypted := encryptedData.Bytes()
+			if encrypted[0] != test.flag {
+				t.Fatalf("expected metadata flag %d, got %d", test.flag, encrypted[0])
+			}
+
+			decryptedData := bytes.NewBuffer([]byte{})
+			if err := DecryptStream(context.Background(), bytes.NewReader(encrypted), decryptedData, test.encrypt.password, EncryptionOptions{KeyFile: test.encrypt.keyFile}); err != nil {
+				t.Fatalf(fatalDecrPassErr, err)
+			}
+			if !bytes.Equal(decryptedData.Bytes(), input) {
+				t.Fatal("decrypted data does not match original data")
+			}
+
+			for _, failure := range test.failures {
+				err := DecryptStream(context.Background(), bytes.NewReader(encrypted), io.Discard, failure.password, EncryptionOptions{KeyFile: failure.keyFile})
+				if err == nil {
+					t.Fatalf("decrypting with password %q and key file %q %s", failure.password, failure.keyFile, DECRYPT_SHOULD_FAIL)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyFileErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		keyFile  string
+		expected string
+	}{
+		{"missing", filepath.Join(t.TempDir(), "missing.key"), "does not exist"},
+		{"too short", writeKeyFile(t, 1, KEY_FILE_SIZE-1), "must be exactly 32 bytes"},
+		{"too long", writeKeyFile(t, 1, KEY_FILE_SIZE+1), "must be exactly 32 bytes"},
+	}
+
+	for _, test := range tests {
+		err := EncryptStream(context.Background(), bytes.NewReader(input), io.Discard, "", EncryptionOptions{KeyFile: test.keyFile})
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Fatalf("%s: expected an error containing %q, got %v", test.name, test.expected, err)
+		}
+	}
+
+	// the archive records that a key file is needed
+	encryptedData := bytes.NewBuffer([]byte{})
+	if err := EncryptStream(context.Background(), bytes.NewReader(input), encryptedData, "", EncryptionOptions{KDFIterations: 1000, KeyFile: writeKeyFile(t, 2, KEY_FILE_SIZE)}); err != nil {
+		t.Fatalf(fatalEncrPassErr, err)
+	}
+	err := DecryptStream(context.Background(), bytes.NewReader(encryptedData.Bytes()), io.Discard, "")
+	if err == nil || !strings.Contains(err.Error(), "key file required") {
+		t.Fatalf("expected a missing key file error, got %v", err)
+	}
+}
+
+func TestArgon2Options(t *testing.T) {
+	salt := bytes.Repeat([]byte{9}, format.SALT_LEN)
+	params, err := newKeyDerivationParams(EncryptionOptions{KDF: ARGON2ID, Salt: salt})
+	if err != nil {
+		t.Fatalf("failed to create parameters: %v", err)
+	}
+	if params.Iterations != DEFAULT_ARGON2_TIME || params.Memory != DEFAULT_ARGON2_MEMORY || params.Threads != DEFAULT_ARGON2_THREADS {
+		t.Fatalf("expected the default argon2id parameters, got %+v", params)
+	}
+
+	invalid := []EncryptionOptions{
+		{KDF: ARGON2ID, KDFIterations: MAX_ARGON2_TIME + 1},
+		{KDF: ARGON2ID, KDFMemory: 4, KDFThreads: 1},
+		{KDF: ARGON2ID, KDFMemory: MAX_ARGON2_MEMORY + 1},
+		{KDF: KDF(0x7F)},
+	}
+	for _, options := range invalid {
+		if err := EncryptStream(context.Background(), bytes.NewReader(input), io.Discard, password, options); err == nil {
+			t.Fatalf("encrypting with %+v should have failed", options)
+		}
+	}
+}
+
+func TestParseKDF(t *testing.T) {
+	for _, kdf := range []KDF{PBKDF2, ARGON2ID} {
+		parsed, err := ParseKDF(kdf.String())
+		if err != nil || parsed != kdf {
+			t.Fatalf("expected %s, got %s (%v)", kdf, parsed, err)
+		}
+	}
+	if parsed, err := ParseKDF("Argon2"); err != nil || parsed != ARGON2ID {
+		t.Fatalf("expected argon2 to select %s, got %s (%v)", ARGON2ID, parsed, err)
+	}
+	if _, err := ParseKDF("scrypt"); err == nil {
+		t.Fatal("an unknown key derivation function should fail")
+	}
+}
+
+func BenchmarkEncryptDecrypt(b *testing.B) {
+	plaintext := bytes.Repeat([]byte("squirrel "), 1<<16)
+
+	for _, iterations := range []int{1_000, 10_000, 100_000, DEFAULT_KDF_ITERATIONS, 1_000_000} {
+		options := EncryptionOptions{KDFIterations: iterations}
+		b.Run(fmt.Sprintf("iterations=%d", iterations), func(b *testing.B) {
+			b.SetBytes(int64(len(plaintext)))
+			for i := 0; i < b.N; i++ {
+				encryptedData := bytes.NewBuffer([]byte{})
+				if err := EncryptStream(context.Background(), bytes.NewReader(plaintext), encryptedData, password, options); err != nil {
+					b.Fatalf(fatalEncrPassErr, err)
+				}
+				if err := DecryptStream(context.Background(), encryptedData, io.Discard, password, options); err != nil {
+					b.Fatalf(fatalDecrPassErr, err)
+				}
+			}
+		})
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("squirrel "), constants.BUFFER_SIZE)
+
+	for _, pass := range []string{"", password} {
+		encryptedData := bytes.NewBuffer([]byte{})
+		if err := EncryptStream(context.Background(), bytes.NewReader(plaintext), encryptedData, pass, EncryptionOptions{HMAC: true}); err != nil {
+			t.Fatalf(fatalEncrPassErr, err)
+		}
+		encrypted := encryptedData.Bytes()
+
+		decryptedData := bytes.NewBuffer([]byte{})
+		if err := DecryptStream(context.Background(), bytes.NewReader(encrypted), decryptedData, pass); err != nil {
+			t.Fatalf(fatalDecrPassErr, err)
+		}
+		if !bytes.Equal(decryptedData.Bytes(), plaintext) {
+			t.Fatalf("password %q: decrypted data does not match original data", pass)
+		}
+
+		// every flipped bit, in the header, the data or the tag, must be caught before any output
+		for _, offset := range []int{0, len(encrypted) / 2, len(encrypted) - HMAC_TAG_SIZE - 1, len(encrypted) - 1} {
+			tampered := append([]byte{}, encrypted...)
+			tampered[offset] ^= 0x01
+
+			decryptedData.Reset()
+			err := DecryptStream(context.Background(), bytes.NewReader(tampered), decryptedData, pass)
+			if err == nil {
+				t.Fatalf("password %q: flipping byte %d %s", pass, offset, DECRYPT_SHOULD_FAIL)
+			}
+			if decryptedData.Len() != 0 {
+				t.Fatalf("password %q: %d bytes were written before the HMAC was checked", pass, decryptedData.Len())
+			}
+			// the first byte breaks the metadata itself
+			if offset != 0 && !errors.Is(err, ErrIntegrityFailure) {
+				t.Fatalf("password %q: expected ErrIntegrityFailure for byte %d, got %v", pass, offset, err)
+			}
+		}
+
+		truncated := encrypted[:len(encrypted)-HMAC_TAG_SIZE]
+		if err := DecryptStream(context.Background(), bytes.NewReader(truncated), io.Discard, pass); !errors.Is(err, ErrIntegrityFailure) {
+			t.Fatalf("password %q: expected ErrIntegrityFailure for a missing tag, got %v", pass, err)
+		}
+	}
+}
+
+func TestComputeAndVerifyHMAC(t *testing.T) {
+	key := bytes.Repeat([]byte{3}, HMAC_KEY_SIZE)
+
+	tag, err := ComputeHMAC(bytes.NewReader(input), key)
+	if err != nil {
+		t.Fatalf("failed to compute HMAC: %v", err)
+	}
+	if len(tag) != HMAC_TAG_SIZE {
+		t.Fatalf("expected a %d byte tag, got %d", HMAC_TAG_SIZE, len(tag))
+	}
+
+	if err := VerifyHMAC(bytes.NewReader(input), key, tag); err != nil {
+		t.Fatalf("a matching tag should verify: %v", err)
+	}
+	if err := VerifyHMAC(bytes.NewReader([]byte("Hello World")), key, tag); !errors.Is(err, ErrIntegrityFailure) {
+		t.Fatalf("expected ErrIntegrityFailure for changed data, got %v", err)
+	}
+	if err := VerifyHMAC(bytes.NewReader(input), bytes.Repeat([]byte{4}, HMAC_KEY_SIZE), tag); !errors.Is(err, ErrIntegrityFailure) {
+		t.Fatalf("expected ErrIntegrityFailure for another key, got %v", err)
+	}
+}
+
+func TestHMACRequiresSeekableInput(t *testing.T) {
+	encryptedData := bytes.NewBuffer([]byte{})
+	if err := EncryptStream(context.Background(), bytes.NewReader(input), encryptedData, "", EncryptionOptions{HMAC: true}); err != nil {
+		t.Fatalf(fatalEncrPassErr, err)
+	}
+
+	// a bytes.Buffer cannot seek, so the stream cannot be verified before it is written
+	decryptedData := bytes.NewBuffer([]byte{})
+	if err := DecryptStream(context.Background(), encryptedData, decryptedData, ""); err == nil {
+		t.Fatal(DECRYPT_SHOULD_FAIL)
+	}
+	if decryptedData.Len() != 0 {
+		t.Fatal("nothing should be written without verification")
+	}
+}
+
+// cancelAfterReader cancels its context once limit bytes have been read.
+type cancelAfterReader struct {
+	reader io.Reader
+	limit  int
+	cancel context.CancelFunc
+}
+
+func (r *cancelAfterReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if r.limit -= n; r.limit <= 0 {
+		r.cancel()
+	}
+	return n, err
+}
+
+func TestEncryptStreamCanceled(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("chunk "), 4*constants.BUFFER_SIZE)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reader := &cancelAfterReader{reader: bytes.NewReader(plaintext), limit: constants.BUFFER_SIZE, cancel: cancel}
+
+	if err := EncryptStream(ctx, reader, io.Discard, password); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestDecryptStreamCanceled(t *testing.T) {
+	encryptedData := bytes.NewBuffer([]byte{})
+	if err := EncryptStream(context.Background(), bytes.NewReader(input), encryptedData, password); err != nil {
+		t.Fatalf(fatalEncrPassErr, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := DecryptStream(ctx, encryptedData, io.Discard, password); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+// BenchmarkCipherSuites compares the ciphers on a 100 MB stream, run it with
+// go test ./encryption -run '^$' -bench CipherSuites
+func BenchmarkCipherSuites(b *testing.B) {
+	plaintext := bytes.Repeat([]byte("squirrel"), 100<<20/8)
+	// a cheap key derivation keeps the cipher the dominant cost
+	const iterations = 1_000
+
+	for _, suite := range []CipherSuite{AES_GCM, CHACHA20_POLY1305} {
+		options := EncryptionOptions{CipherSuite: suite, KDFIterations: iterations}
+
+		b.Run(suite.String()+"/encrypt", func(b *testing.B) {
+			b.SetBytes(int64(len(plaintext)))
+			for i := 0; i < b.N; i++ {
+				if err := EncryptStream(context.Background(), bytes.NewReader(plaintext), io.Discard, password, options); err != nil {
+					b.Fatalf(fatalEncrPassErr, err)
+				}
+			}
+		})
+
+		encryptedData := bytes.NewBuffer([]byte{})
+		if err := EncryptStream(context.Background(), bytes.NewReader(plaintext), encryptedData, password, options); err != nil {
+			b.Fatalf(fatalEncrPassErr, err)
+		}
+		b.Run(suite.String()+"/decrypt", func(b *testing.B) {
+			b.SetBytes(int64(len(plaintext)))
+			for i := 0; i < b.N; i++ {
+				if err := DecryptStream(context.Background(), bytes.NewReader(encryptedData.Bytes()), io.Discard, password); err != nil {
+					b.Fatalf(fatalDecrPassErr, err)
+				}
+			}
+		})
+	}
+}
+
+func TestDecryptPipe(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("pipe "), PIPE_BUFFER_SIZE)
+	encryptedData := bytes.NewBuffer([]byte{})
+	if err := EncryptStream(context.Background(), bytes.NewReader(plaintext), encryptedData, password); err != nil {
+		t.Fatalf(fatalEncrPassErr, err)
+	}
+	encrypted := encryptedData.Bytes()
+
+	decrypted := []byte{}
+	err := DecryptPipe(context.Background(), bytes.NewReader(encrypted), password, func(r io.Reader) error {
+		var err error
+		decrypted, err = io.ReadAll(r)
+		return err
+	})
+	if err != nil {
+		t.Fatalf(fatalDecrPassErr, err)
+	}
+	if !bytes.Equal(plaintext, decrypted) {
+		t.Fatal("decrypted data does not match the original data")
+	}
+
+	// a consumer that stops early still gets the end of the stream authenticated
+	readFirst := func(r io.Reader) error {
+		_, err := io.ReadFull(r, make([]byte, 10))
+		return err
+	}
+	if err := DecryptPipe(context.Background(), bytes.NewReader(encrypted), password, readFirst); err != nil {
+		t.Fatalf("expected no error for a consumer that stops early, got %v", err)
+	}
+	truncated := encrypted[:len(encrypted)-1]
+	if err := DecryptPipe(context.Background(), bytes.NewReader(truncated), password, readFirst); err == nil || !strings.Contains(err.Error(), "failed to decrypt") {
+		t.Fatalf("expected a decryption error for a truncated stream, got %v", err)
+	}
+
+	// the error of the consumer is returned as is
+	consumerErr := errors.New("consumer failed")
+	if err := DecryptPipe(context.Background(), bytes.NewReader(encrypted), password, func(io.Reader) error { return consumerErr }); !errors.Is(err, consumerErr) {
+		t.Fatalf("expected %v, got %v", consumerErr, err)
+	}
+
+	if err := DecryptPipe(context.Background(), bytes.NewReader(encrypted), "wrong", readFirst); err == nil || !strings.Contains(err.Error(), "failed to decrypt") {
+		t.Fatalf("expected a decryption error for a wrong password, got %v", err)
+	}
+}
+
+func TestEncryptPipe(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("pipe "), PIPE_BUFFER_SIZE)
+
+	encrypted := bytes.NewBuffer([]byte{})
+	err := EncryptPipe(context.Background(), encrypted, password, func(w io.Writer) error {
+		// small writes are handed over in larger pieces
+		for i := 0; i < len(plaintext); i += 1000 {
+			if _, err := w.Write(plaintext[i:min(i+1000, len(plaintext))]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf(fatalEncrPassErr, err)
+	}
+
+	decrypted := bytes.NewBuffer([]byte{})
+	if err := DecryptStream(context.Background(), encrypted, decrypted, password); err != nil {
+		t.Fatalf(fatalDecrPassErr, err)
+	}
+	if !bytes.Equal(plaintext, decrypted.Bytes()) {
+		t.Fatal("decrypted data does not match the original data")
+	}
+
+	// the error of the producer is returned as is
+	producerErr := errors.New("producer failed")
+	if err := EncryptPipe(context.Background(), io.Discard, password, func(io.Writer) error { return producerErr }); !errors.Is(err, producerErr) {
+		t.Fatalf("expected %v, got %v", producerErr, err)
+	}
+
+	// a failing output stops the producer
+	writeErr := errors.New("disk full")
+	err = EncryptPipe(context.Background(), &failingWriter{err: writeErr}, password, func(w io.Writer) error {
+		_, err := io.Copy(w, bytes.NewReader(plaintext))
+		return err
+	})
+	if !errors.Is(err, writeErr) || !strings.Contains(err.Error(), "failed to encrypt") {
+		t.Fatalf("expected an encryption error wrapping %v, got %v", writeErr, err)
+	}
+}
+
+// failingWriter fails every write with err.
+type failingWriter struct {
+	err error
+}
+
+func (w *failingWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
+
+func TestChunkSize(t *testing.T) {
+	plaintext := bytes.Repeat([]byte("chunk size "), 1000)
+
+	encrypt := func(chunkSize int) []byte {
+		encryptedData := bytes.NewBuffer([]byte{})
+		if err := EncryptStream(context.Background(), bytes.NewReader(plaintext), encryptedData, password, EncryptionOptions{ChunkSize: chunkSize}); err != nil {
+			t.Fatalf(fatalEncrPassErr, err)
+		}
+		return encryptedData.Bytes()
+	}
+	decrypt := func(encrypted []byte) {
+		decrypted := bytes.NewBuffer([]byte{})
+		if err := DecryptStream(context.Background(), bytes.NewReader(encrypted), decrypted, password); err != nil {
+			t.Fatalf(fatalDecrPassErr, err)
+		}
+		if !bytes.Equal(plaintext, decrypted.Bytes()) {
+			t.Fatal("decrypted data does not match the original data")
+		}
+	}
+
+	// the chunk size is stored, decryption does not need to be told
+	encrypted := encrypt(1000)
+	header, err := readMetadata(bytes.NewReader(encrypted))
+	if err != nil {
+		t.Fatalf("failed to read the metadata: %v", err)
+	}
+	if header.ChunkSize != 1000 {
+		t.Fatalf("expected a chunk size of 1000, got %d", header.ChunkSize)
+	}
+	if chunks := sealedChunks(t, encrypted); len(chunks) != 11 || len(chunks[0]) != 1000+16 {
+		t.Fatalf("expected 11 chunks of 1000 bytes, got %d chunks", len(chunks))
+	}
+	decrypt(encrypted)
+
+	if header, err := readMetadata(bytes.NewReader(encrypt(0))); err != nil || header.ChunkSize != constants.BUFFER_SIZE {
+		t.Fatalf("expected the default chunk size %d, got %d (%v)", constants.BUFFER_SIZE, header.ChunkSize, err)
+	}
+
+	// archives written before the chunk size was stored use 256 byte chunks
+	legacy := encrypt(LEGACY_CHUNK_SIZE)
+	integrityOffset := headerLen - 12 - format.CHUNK_SIZE_LEN - 1
+	legacy[integrityOffset] &^= CHUNK_SIZE_FLAG
+	legacy = append(legacy[:integrityOffset+1], legacy[integrityOffset+1+format.CHUNK_SIZE_LEN:]...)
+	decrypt(legacy)
+
+	if err := EncryptStream(context.Background(), bytes.NewReader(plaintext), io.Discard, password, EncryptionOptions{ChunkSize: MAX_CHUNK_SIZE + 1}); err == nil {
+		t.Fatal("expected an error for a chunk size above the limit")
+	}
+}
+
+func TestDecryptLegacyArchive(t *testing.T) {
+	// written by the first releases, their metadata is only the first byte: legacy.sq with the
+	// password "squirrel", legacy-nopass.sq without one. legacy.payload is what the first
+	// releases decrypted legacy.sq to
+	encrypted, err := os.ReadFile("testdata/legacy.sq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := os.ReadFile("testdata/legacy.payload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unencrypted, err := os.ReadFile("testdata/legacy-nopass.sq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !LooksLegacyEncrypted(encrypted) || LooksEncrypted(encrypted) {
+		t.Fatal("expected the archive to only look like an archive of the first releases")
+	}
+
+	var decrypted bytes.Buffer
+	if err := DecryptStream(context.Background(), bytes.NewReader(encrypted), &decrypted, "squirrel"); err != nil {
+		t.Fatalf(fatalDecrPassErr, err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), payload) {
+		t.Fatal("decrypted data does not match the payload")
+	}
+
+	decrypted.Reset()
+	if err := DecryptStream(context.Background(), bytes.NewReader(unencrypted), &decrypted, ""); err != nil {
+		t.Fatalf("failed to read the unencrypted archive: %v", err)
+	}
+	if !bytes.Equal(decrypted.Bytes(), unencrypted[1:]) {
+		t.Fatal("expected the payload after the first byte")
+	}
+
+	err = DecryptStream(context.Background(), bytes.NewReader(encrypted), io.Discard, "")
+	if err == nil || !strings.Contains(err.Error(), "password required") {
+		t.Fatalf("expected an error asking for the password, got %v", err)
+	}
+	err = DecryptStream(context.Background(), bytes.NewReader(encrypted), io.Discard, "acorn")
+	if metrics.ErrorType(metrics.OP_DECRYPT, err) != metrics.ERROR_AUTH {
+		t.Fatalf("expected an authentication error for a wrong password, got %v", err)
+	}
+}
+
+// BenchmarkChunkSize encrypts and decrypts 100 MB with the old 256 byte chunks and the
+// default chunk size.
+func BenchmarkChunkSize(b *testing.B) {
+	plaintext := bytes.Repeat([]byte("squirrel "), 100<<20/9)
+	for _, chunkSize := range []int{LEGACY_CHUNK_SIZE, constants.BUFFER_SIZE} {
+		b.Run(fmt.Sprintf("%d", chunkSize), func(b *testing.B) {
+			b.SetBytes(int64(len(plaintext)))
+			for i := 0; i < b.N; i++ {
+				encrypted := bytes.NewBuffer(make([]byte, 0, len(plaintext)+len(plaintext)/8))
+				options := EncryptionOptions{ChunkSize: chunkSize, KDFIterations: 1}
+				if err := EncryptStream(context.Background(), bytes.NewReader(plaintext), encrypted, password, options); err != nil {
+					b.Fatalf(fatalEncrPassErr, err)
+				}
+				b.ReportMetric(float64(encrypted.Len())/float64(len(plaintext)), "size/plaintext")
+				if err := DecryptStream(context.Background(), encrypted, io.Discard, password); err != nil {
+					b.Fatalf(fatalDecrPassErr, err)
+				}
+			}
+		})
+	}
+}
+
+// writeSignedArchive writes an archive to a temporary file and signs it with privateKey.
+func writeSignedArchive(t *testing.T, content []byte, privateKey ed25519.PrivateKey) string {
+	archivePath := filepath.Join(t.TempDir(), "archive.sq")
+	if err := os.WriteFile(archivePath, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SignArchive(archivePath, privateKey); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	return archivePath
+}
+
+func TestSignArchive(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublicKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := bytes.Repeat(input, 100)
+	archivePath := writeSignedArchive(t, content, privateKey)
+	if err := VerifyArchive(archivePath, publicKey); err != nil {
+		t.Fatalf("failed to verify: %v", err)
+	}
+	if err := VerifyArchive(archivePath, otherPublicKey); !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("expected another key to fail, got %v", err)
+	}
+	if err := SignArchive(archivePath, privateKey); err == nil || !strings.Contains(err.Error(), "signed already") {
+		t.Fatalf("expected signing twice to fail, got %v", err)
+	}
+
+	// the archive is read without its signature
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	section, err := ArchiveSection(archive, publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read, err := io.ReadAll(section); err != nil || !bytes.Equal(read, content) {
+		t.Fatalf("expected the section to hold the archive only, got %d bytes, %v", len(read), err)
+	}
+	// without a key the signature is not read as part of the archive
+	if _, err := ArchiveSection(archive, nil); !errors.Is(err, ErrVerifyKeyRequired) {
+		t.Fatalf("expected a signed archive to need the key, got %v", err)
+	}
+
+	// a single flipped byte of the archive fails the check
+	signed, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed[len(content)/2] ^= 1
+	if err := os.WriteFile(archivePath, signed, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyArchive(archivePath, publicKey); !errors.Is(err, ErrSignatureInvalid) {
+		t.Fatalf("expected a modified archive to fail, got %v", err)
+	}
+
+	unsignedPath := filepath.Join(t.TempDir(), "unsigned.sq")
+	if err := os.WriteFile(unsignedPath, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyArchive(unsignedPath, publicKey); !errors.Is(err, ErrNotSigned) {
+		t.Fatalf("expected an unsigned archive to be reported, got %v", err)
+	}
+}
+
+func TestReadSigningKeys(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"private.pem": pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+		"public.pem":  pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}),
+		"seed.key":    privateKey.Seed(),
+		"private.key": privateKey,
+		"public.key":  publicKey,
+		"short.key":   publicKey[:16],
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"private.pem", "seed.key", "private.key"} {
+		key, err := ReadSigningKey(filepath.Join(dir, name))
+		if err != nil || !key.Equal(privateKey) {
+			t.Fatalf("%s: unexpected signing key, %v", name, err)
+		}
+	}
+	for _, name := range []string{"public.pem", "public.key"} {
+		key, err := ReadVerifyKey(filepath.Join(dir, name))
+		if err != nil || !key.Equal(publicKey) {
+			t.Fatalf("%s: unexpected verification key, %v", name, err)
+		}
+	}
+
+	if _, err := ReadSigningKey(filepath.Join(dir, "short.key")); err == nil {
+		t.Fatal("expected a key of 16 bytes to be rejected")
+	}
+	if _, err := ReadVerifyKey(filepath.Join(dir, "private.pem")); err == nil {
+		t.Fatal("expected a private key to be rejected as a verification key")
+	}
+}
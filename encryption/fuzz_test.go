@@ -0,0 +1,56 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+// FUZZ_MAX_KDF_COST bounds the key derivation of the fuzzed streams. A damaged header can ask
+// for up to MAX_KDF_ITERATIONS, which is slow by design, not a finding.
+const FUZZ_MAX_KDF_COST = 10_000
+
+func FuzzDecryptStream(f *testing.F) {
+	vectors := []EncryptionOptions{
+		{CipherSuite: AES_GCM, KDFIterations: 1_000},
+		{CipherSuite: CHACHA20_POLY1305, KDFIterations: 1_000},
+		{KDF: ARGON2ID, KDFIterations: 1, KDFMemory: 64, KDFThreads: 1},
+		{KDFIterations: 1_000, HMAC: true},
+		{KDFIterations: 1_000, ChunkSize: 16},
+	}
+	for _, options := range vectors {
+		encrypted := &bytes.Buffer{}
+		if err := EncryptStream(context.Background(), bytes.NewReader(input), encrypted, password, options); err != nil {
+			f.Fatalf(fatalEncrPassErr, err)
+		}
+		f.Add(encrypted.Bytes())
+	}
+	for _, options := range []EncryptionOptions{{}, {HMAC: true}} {
+		encrypted := &bytes.Buffer{}
+		if err := EncryptStream(context.Background(), bytes.NewReader(input), encrypted, "", options); err != nil {
+			f.Fatalf(fatalEncrPassErr, err)
+		}
+		f.Add(encrypted.Bytes())
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if header, err := readMetadata(bytes.NewReader(data)); err == nil && header.KDF != nil {
+			cost := header.KDF.Iterations
+			if header.KDF.KDF == ARGON2ID {
+				cost *= int(header.KDF.Memory)
+			}
+			if cost > FUZZ_MAX_KDF_COST {
+				t.Skip("the key derivation is too slow to fuzz")
+			}
+		}
+
+		// damaged streams must fail with an error, never panic
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("DecryptStream panicked on %d bytes: %v", len(data), r)
+			}
+		}()
+		DecryptStream(context.Background(), bytes.NewReader(data), io.Discard, password)
+	})
+}
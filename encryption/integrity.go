@@ -0,0 +1,143 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	// HMAC_KEY_SIZE is the size of the integrity key. Without a password it is stored in the header.
+	HMAC_KEY_SIZE = 32
+
+	// HMAC_TAG_SIZE is the size of the HMAC-SHA256 tag at the end of the stream.
+	HMAC_TAG_SIZE = sha256.Size
+)
+
+// Integrity modes, stored in the metadata block.
+const (
+	INTEGRITY_NONE        byte = 0
+	INTEGRITY_HMAC_SHA256 byte = 1
+)
+
+// hmacKeyLabel separates the integrity key from the encryption key derived from the same password.
+const hmacKeyLabel = "SquirrelZip HMAC-SHA256 key"
+
+// ErrIntegrityFailure is returned when the HMAC at the end of a stream does not match its content.
+var ErrIntegrityFailure = errors.New("integrity check failed: the archive is damaged or was modified")
+
+// ComputeHMAC returns the HMAC-SHA256 of everything read from r.
+//
+// Parameters:
+//   - r: the data to authenticate, read until io.EOF
+//   - key: the integrity key
+//
+// Returns:
+//   - []byte: the HMAC_TAG_SIZE byte tag
+//   - error: if reading fails
+func ComputeHMAC(r io.Reader, key []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, key)
+	if _, err := io.Copy(mac, r); err != nil {
+		return nil, fmt.Errorf("failed to compute HMAC: %v", err)
+	}
+	return mac.Sum(nil), nil
+}
+
+// VerifyHMAC checks the HMAC-SHA256 of everything read from r against expected in constant time.
+//
+// Parameters:
+//   - r: the authenticated data, read until io.EOF
+//   - key: the integrity key
+//   - expected: the stored tag
+//
+// Returns:
+//   - error: ErrIntegrityFailure if the tags differ, or an error if reading fails
+func VerifyHMAC(r io.Reader, key []byte, expected []byte) error {
+	actual, err := ComputeHMAC(r, key)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(actual, expected) {
+		return ErrIntegrityFailure
+	}
+	return nil
+}
+
+// newIntegrityKey returns the integrity key of a new stream. With a password it is derived
+// from the encryption key, otherwise it is random and must be stored in the header.
+func newIntegrityKey(encryptionKey []byte) ([]byte, error) {
+	if encryptionKey != nil {
+		return deriveIntegrityKey(encryptionKey), nil
+	}
+
+	key := make([]byte, HMAC_KEY_SIZE)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate integrity key: %v", err)
+	}
+	return key, nil
+}
+
+// deriveIntegrityKey derives the integrity key from the encryption key, so a single password
+// derivation serves both and the two keys are still independent.
+func deriveIntegrityKey(encryptionKey []byte) []byte {
+	mac := hmac.New(sha256.New, encryptionKey)
+	mac.Write([]byte(hmacKeyLabel))
+	return mac.Sum(nil)
+}
+
+// verifyStream checks the tag at the end of input before anything is decrypted. The header
+// is authenticated as well, it has already been read and is passed in. Afterwards input is
+// positioned where it was, right after the header.
+//
+// Parameters:
+//   - input: the stream after the header, it must implement io.Seeker
+//   - header: the bytes of the header that were read from the stream
+//   - key: the integrity key
+//
+// Returns:
+//   - int64: the length of the data between the header and the tag
+//   - error: ErrIntegrityFailure if the tag is missing or does not match, or an error if input cannot seek
+func verifyStream(input io.Reader, header []byte, key []byte) (int64, error) {
+	seeker, ok := input.(io.ReadSeeker)
+	if !ok {
+		return 0, errors.New("verifying the HMAC requires a seekable input")
+	}
+
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	dataLen := end - start - HMAC_TAG_SIZE
+	if dataLen < 0 {
+		return 0, fmt.Errorf("%w: the HMAC is missing", ErrIntegrityFailure)
+	}
+
+	tag := make([]byte, HMAC_TAG_SIZE)
+	if _, err := seeker.Seek(start+dataLen, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if _, err := io.ReadFull(seeker, tag); err != nil {
+		return 0, fmt.Errorf("failed to read HMAC: %v", err)
+	}
+
+	if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if err := VerifyHMAC(io.MultiReader(bytes.NewReader(header), io.LimitReader(seeker, dataLen)), key, tag); err != nil {
+		return 0, err
+	}
+
+	if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return dataLen, nil
+}
@@ -1,15 +1,265 @@
 package encryption
 
-import "fmt"
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
 
-// Function to generate key from password
-func generateKey(password string) ([]byte, error) {
-	key := []byte(password)
-	if len(key) > 32 {
-		return nil, fmt.Errorf("password too long")
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+
+	"file-compressor/format"
+)
+
+const (
+	// KEY_SIZE is the size of the derived key, AES-256.
+	KEY_SIZE = 32
+
+	// DEFAULT_KDF_ITERATIONS is the PBKDF2 iteration count used for new archives.
+	DEFAULT_KDF_ITERATIONS = 200_000
+
+	// MAX_KDF_ITERATIONS bounds the iteration count read from an archive, so a damaged or
+	// hostile header cannot make key derivation run for hours.
+	MAX_KDF_ITERATIONS = 100_000_000
+
+	// DEFAULT_ARGON2_TIME, DEFAULT_ARGON2_MEMORY (in KiB) and DEFAULT_ARGON2_THREADS are the
+	// Argon2id parameters used for new archives, 3 passes over 64 MiB.
+	DEFAULT_ARGON2_TIME    = 3
+	DEFAULT_ARGON2_MEMORY  = 64 * 1024
+	DEFAULT_ARGON2_THREADS = 4
+
+	// MAX_ARGON2_TIME and MAX_ARGON2_MEMORY bound the parameters read from an archive like
+	// MAX_KDF_ITERATIONS, the memory limit is 4 GiB.
+	MAX_ARGON2_TIME   = 1000
+	MAX_ARGON2_MEMORY = 4 * 1024 * 1024
+)
+
+// KEY_FILE_SIZE is the size of a key file, for example 32 random bytes from head -c 32 /dev/urandom.
+const KEY_FILE_SIZE = 32
+
+// ReadKeyFile reads the key material of a key file.
+//
+// Parameters:
+//   - path: the path of the key file
+//
+// Returns:
+//   - []byte: the KEY_FILE_SIZE bytes of key material
+//   - error: if the key file does not exist, cannot be read or does not have KEY_FILE_SIZE bytes
+func ReadKeyFile(path string) ([]byte, error) {
+	material, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("key file %s does not exist", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file %s: %v", path, err)
+	}
+	if len(material) != KEY_FILE_SIZE {
+		return nil, fmt.Errorf("key file %s is %d bytes long, it must be exactly %d bytes", path, len(material), KEY_FILE_SIZE)
+	}
+	return material, nil
+}
+
+// keySecret returns the secret passed to the key derivation function, the key file material
+// followed by the password. Either may be empty. The key file has a fixed size, so no two
+// combinations give the same secret.
+func keySecret(password string, keyFile []byte) string {
+	return string(keyFile) + password
+}
+
+// KDF selects the key derivation function of an encrypted archive. It is stored in the
+// metadata byte, see writeMetadata.
+type KDF byte
+
+const (
+	// PBKDF2 is PBKDF2-HMAC-SHA256.
+	PBKDF2 KDF = 0x01
+	// ARGON2ID is memory-hard, guessing passwords on GPUs costs far more than with PBKDF2.
+	ARGON2ID KDF = 0x02
+
+	// DEFAULT_KDF is used when no key derivation function is requested.
+	DEFAULT_KDF = PBKDF2
+)
+
+// String returns the name of the key derivation function as accepted by ParseKDF.
+func (kdf KDF) String() string {
+	switch kdf {
+	case PBKDF2:
+		return "pbkdf2"
+	case ARGON2ID:
+		return "argon2id"
+	default:
+		return fmt.Sprintf("unknown key derivation function 0x%02x", byte(kdf))
+	}
+}
+
+// ParseKDF returns the key derivation function with the given name, "pbkdf2" or "argon2id".
+// The match is case insensitive and "argon2" is accepted as a short form.
+func ParseKDF(name string) (KDF, error) {
+	switch strings.ToLower(name) {
+	case "pbkdf2":
+		return PBKDF2, nil
+	case "argon2id", "argon2":
+		return ARGON2ID, nil
+	default:
+		return 0, fmt.Errorf("unsupported key derivation function: %s", name)
+	}
+}
+
+// KeyDerivationParams are the key derivation parameters of an encrypted archive.
+// They are stored in the archive header after the metadata byte.
+type KeyDerivationParams struct {
+	// KDF is the key derivation function, PBKDF2 when zero.
+	KDF KDF
+	// Salt is random for every archive and format.SALT_LEN bytes long.
+	Salt []byte
+	// Iterations is the PBKDF2 iteration count, or the number of Argon2id passes.
+	Iterations int
+	// Memory is the Argon2id memory size in KiB, unused by PBKDF2.
+	Memory uint32
+	// Threads is the Argon2id parallelism, unused by PBKDF2.
+	Threads uint8
+}
+
+// newKeyDerivationParams returns the parameters for a new archive from the KDF, Salt,
+// KDFIterations, KDFMemory and KDFThreads options. Zero values select the defaults.
+//
+// Parameters:
+//   - opts: the options passed to EncryptStream
+//
+// Returns:
+//   - KeyDerivationParams: the parameters
+//   - error: if the salt has the wrong length, a parameter is out of range or no salt could be generated
+func newKeyDerivationParams(opts EncryptionOptions) (KeyDerivationParams, error) {
+	params := KeyDerivationParams{KDF: opts.KDF, Iterations: opts.KDFIterations, Memory: opts.KDFMemory, Threads: opts.KDFThreads}
+	if params.KDF == 0 {
+		params.KDF = DEFAULT_KDF
+	}
+
+	switch params.KDF {
+	case PBKDF2:
+		if params.Iterations == 0 {
+			params.Iterations = DEFAULT_KDF_ITERATIONS
+		}
+	case ARGON2ID:
+		if params.Iterations == 0 {
+			params.Iterations = DEFAULT_ARGON2_TIME
+		}
+		if params.Memory == 0 {
+			params.Memory = DEFAULT_ARGON2_MEMORY
+		}
+		if params.Threads == 0 {
+			params.Threads = DEFAULT_ARGON2_THREADS
+		}
 	}
-	for len(key) < 32 {
+	if err := params.validate(); err != nil {
+		return KeyDerivationParams{}, err
+	}
+
+	salt := opts.Salt
+
+	if salt == nil {
+		salt = make([]byte, format.SALT_LEN)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return KeyDerivationParams{}, fmt.Errorf("failed to generate salt: %v", err)
+		}
+	} else if len(salt) != format.SALT_LEN {
+		return KeyDerivationParams{}, fmt.Errorf("salt must be %d bytes long, got %d", format.SALT_LEN, len(salt))
+	}
+
+	params.Salt = salt
+	return params, nil
+}
+
+// validate checks that the parameters are in range, for new archives and for the values
+// read from an archive alike.
+func (params KeyDerivationParams) validate() error {
+	switch params.KDF {
+	case PBKDF2:
+		if params.Iterations < 1 || params.Iterations > MAX_KDF_ITERATIONS {
+			return fmt.Errorf("key derivation iteration count must be between 1 and %d, got %d", MAX_KDF_ITERATIONS, params.Iterations)
+		}
+	case ARGON2ID:
+		if params.Iterations < 1 || params.Iterations > MAX_ARGON2_TIME {
+			return fmt.Errorf("argon2id time must be between 1 and %d, got %d", MAX_ARGON2_TIME, params.Iterations)
+		}
+		if params.Threads < 1 {
+			return fmt.Errorf("argon2id needs at least 1 thread")
+		}
+		// argon2 needs 8 KiB per thread
+		if params.Memory < 8*uint32(params.Threads) || params.Memory > MAX_ARGON2_MEMORY {
+			return fmt.Errorf("argon2id memory must be between %d and %d KiB, got %d", 8*uint32(params.Threads), MAX_ARGON2_MEMORY, params.Memory)
+		}
+	default:
+		return fmt.Errorf("unsupported key derivation function: %s", params.KDF)
+	}
+	return nil
+}
+
+// deriveKey derives the KEY_SIZE byte key from the password with the function and the
+// parameters of params.
+//
+// Parameters:
+//   - password: the password, of any length
+//   - params: the parameters stored in the archive
+//
+// Returns:
+//   - []byte: the derived key
+//   - error: if the salt is empty or a parameter is out of range
+func deriveKey(password string, params KeyDerivationParams) ([]byte, error) {
+	if params.KDF != ARGON2ID {
+		return generateKey(password, params.Salt, params.Iterations)
+	}
+
+	if len(params.Salt) == 0 {
+		return nil, fmt.Errorf("key derivation requires a salt")
+	}
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	return argon2.IDKey([]byte(password), params.Salt, uint32(params.Iterations), params.Memory, params.Threads, KEY_SIZE), nil
+}
+
+// legacyKey returns the key of the archives of the first releases, the password padded with
+// '0' bytes to KEY_SIZE bytes. It is only used to decrypt them, see decryptLegacy.
+//
+// Parameters:
+//   - password: the password, at most KEY_SIZE bytes long
+//
+// Returns:
+//   - []byte: the key
+//   - error: if the password is longer than KEY_SIZE bytes, no such archive could be written
+func legacyKey(password string) ([]byte, error) {
+	if len(password) > KEY_SIZE {
+		return nil, authError("password too long for an archive of the first releases")
+	}
+	key := []byte(password)
+	for len(key) < KEY_SIZE {
 		key = append(key, '0')
 	}
 	return key, nil
-}
\ No newline at end of file
+}
+
+// generateKey derives a KEY_SIZE byte key from the password with PBKDF2-HMAC-SHA256.
+//
+// Parameters:
+//   - password: the password, of any length
+//   - salt: the salt stored in the archive
+//   - iterations: the iteration count stored in the archive
+//
+// Returns:
+//   - []byte: the derived key
+//   - error: if the salt is empty or the iteration count is out of range
+func generateKey(password string, salt []byte, iterations int) ([]byte, error) {
+	if len(salt) == 0 {
+		return nil, fmt.Errorf("key derivation requires a salt")
+	}
+	if iterations < 1 || iterations > MAX_KDF_ITERATIONS {
+		return nil, fmt.Errorf("invalid key derivation iteration count %d", iterations)
+	}
+	return pbkdf2.Key([]byte(password), salt, iterations, KEY_SIZE, sha256.New), nil
+}
@@ -0,0 +1,111 @@
+package encryption
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"file-compressor/constants"
+)
+
+// PIPE_BUFFER_SIZE is the size of the buffers on both ends of the pipe of DecryptPipe, so
+// the small decrypted chunks are handed over in larger pieces.
+const PIPE_BUFFER_SIZE = 64 << 10
+
+// errConsumerStopped is passed to the decryption when the consumer of DecryptPipe returned early.
+var errConsumerStopped = errors.New("the decrypted data is no longer read")
+
+// DecryptPipe decrypts reader like DecryptStream and passes the plaintext to consume as it is
+// decrypted, through a pipe instead of a temporary file, so the plaintext never reaches the
+// disk. The decryption runs in its own goroutine. When consume returns without reading
+// everything, the rest is read and discarded, so the end of the stream is still authenticated.
+//
+// Parameters:
+//   - ctx: Cancels the decryption.
+//   - reader: An io.Reader from which the encrypted data is read.
+//   - password: A string containing the password used for decryption.
+//   - consume: Reads the decrypted data. A read fails with the decryption error when the
+//     decryption fails.
+//   - options: Optional settings, the same as for DecryptStream.
+//
+// Returns:
+//   - error: the decryption error wrapped in constants.FAILED_TO_DECRYPT, otherwise the error
+//     returned by consume
+func DecryptPipe(ctx context.Context, reader io.Reader, password string, consume func(plaintext io.Reader) error, options ...EncryptionOptions) error {
+	pipeReader, pipeWriter := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		buffered := bufio.NewWriterSize(pipeWriter, PIPE_BUFFER_SIZE)
+		err := DecryptStream(ctx, reader, buffered, password, options...)
+		if err == nil {
+			err = buffered.Flush()
+		}
+		// a nil error ends the plaintext with io.EOF
+		pipeWriter.CloseWithError(err)
+		done <- err
+	}()
+
+	err := consume(bufio.NewReaderSize(pipeReader, PIPE_BUFFER_SIZE))
+	if err == nil {
+		_, err = io.Copy(io.Discard, pipeReader)
+	}
+	// unblocks the decryption when consume failed
+	pipeReader.CloseWithError(errConsumerStopped)
+
+	decryptErr := <-done
+	if decryptErr != nil && !errors.Is(decryptErr, errConsumerStopped) {
+		return fmt.Errorf(constants.FAILED_TO_DECRYPT, decryptErr)
+	}
+	return err
+}
+
+// errProducerStopped is passed to the encryption when the producer of EncryptPipe failed.
+var errProducerStopped = errors.New("the plaintext was not written to its end")
+
+// EncryptPipe encrypts the plaintext written by produce into writer like EncryptStream, through
+// a pipe instead of a temporary file, so the plaintext never reaches the disk. The encryption
+// runs in its own goroutine and memory use stays bounded by the buffers of the pipe.
+//
+// Parameters:
+//   - ctx: Cancels the encryption.
+//   - writer: An io.Writer where the encrypted data is written.
+//   - password: A string containing the password used for encryption.
+//   - produce: Writes the plaintext. A write fails with the encryption error when the
+//     encryption fails.
+//   - options: Optional settings, the same as for EncryptStream.
+//
+// Returns:
+//   - error: the encryption error wrapped in constants.FAILED_TO_ENCRYPT, otherwise the error
+//     returned by produce
+func EncryptPipe(ctx context.Context, writer io.Writer, password string, produce func(plaintext io.Writer) error, options ...EncryptionOptions) error {
+	pipeReader, pipeWriter := io.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		err := EncryptStream(ctx, bufio.NewReaderSize(pipeReader, PIPE_BUFFER_SIZE), writer, password, options...)
+		// unblocks produce when the encryption failed
+		pipeReader.CloseWithError(err)
+		done <- err
+	}()
+
+	buffered := bufio.NewWriterSize(pipeWriter, PIPE_BUFFER_SIZE)
+	err := produce(buffered)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		// the encryption must not finish an archive of the partial plaintext
+		pipeWriter.CloseWithError(errProducerStopped)
+	} else {
+		pipeWriter.Close()
+	}
+
+	encryptErr := <-done
+	if encryptErr != nil && !errors.Is(encryptErr, errProducerStopped) {
+		return fmt.Errorf(constants.FAILED_TO_ENCRYPT, encryptErr)
+	}
+	return err
+}
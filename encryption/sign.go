@@ -0,0 +1,250 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"file-compressor/constants"
+)
+
+const (
+	// SIGNATURE_MAGIC precedes the Ed25519 signature appended to an archive by SignArchive.
+	SIGNATURE_MAGIC = "\xed\x25"
+
+	// SIGNATURE_TRAILER_SIZE is the size of the trailer, the magic and the signature.
+	SIGNATURE_TRAILER_SIZE = len(SIGNATURE_MAGIC) + ed25519.SignatureSize
+)
+
+var (
+	// ErrSignatureInvalid is returned when the signature of an archive does not match its
+	// content or the public key.
+	ErrSignatureInvalid = errors.New("signature check failed: the archive was modified or signed with another key")
+	// ErrNotSigned is returned when a signature is verified on an archive that has none.
+	ErrNotSigned = errors.New("the archive is not signed")
+	// ErrVerifyKeyRequired is returned when a signed archive is read without a key.
+	ErrVerifyKeyRequired = errors.New("archive is signed; supply a verify key")
+)
+
+// SignArchive appends an Ed25519 signature of the SHA-256 hash of the archive to it, preceded
+// by SIGNATURE_MAGIC. The archive is read as it is, so an encrypted archive is signed as well
+// as an unencrypted one.
+//
+// Parameters:
+//   - archivePath: the path of the archive
+//   - privateKey: the key it is signed with, see ReadSigningKey
+//
+// Returns:
+//   - error: if the archive is signed already, or cannot be read or written
+func SignArchive(archivePath string, privateKey ed25519.PrivateKey) error {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return fmt.Errorf("invalid Ed25519 private key of %d bytes", len(privateKey))
+	}
+
+	archive, err := os.OpenFile(archivePath, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf(constants.FILE_OPEN_ERROR, err)
+	}
+	defer archive.Close()
+
+	content, signed, err := archiveSection(archive)
+	if err != nil {
+		return err
+	}
+	if signed {
+		return fmt.Errorf("%s is signed already", archivePath)
+	}
+
+	digest, err := hashArchive(content)
+	if err != nil {
+		return err
+	}
+
+	trailer := append([]byte(SIGNATURE_MAGIC), ed25519.Sign(privateKey, digest)...)
+	if _, err := archive.WriteAt(trailer, content.Size()); err != nil {
+		return fmt.Errorf("failed to write the signature: %v", err)
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write the signature: %v", err)
+	}
+	return nil
+}
+
+// VerifyArchive checks the signature appended to an archive by SignArchive.
+//
+// Parameters:
+//   - archivePath: the path of the archive
+//   - publicKey: the key matching the one it was signed with, see ReadVerifyKey
+//
+// Returns:
+//   - error: ErrNotSigned if the archive has no signature, ErrSignatureInvalid if it does not
+//     match, or an error if the archive cannot be read
+func VerifyArchive(archivePath string, publicKey ed25519.PublicKey) error {
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf(constants.FILE_OPEN_ERROR, err)
+	}
+	defer archive.Close()
+
+	_, err = ArchiveSection(archive, publicKey)
+	return err
+}
+
+// ArchiveSection returns the content of an archive file to read it. With a publicKey the
+// archive must be signed by SignArchive, the signature is checked and left out, the codecs and
+// the decryption do not expect anything after their end. Without one an archive that ends with
+// a signature is refused, it is only read with the key of its signature.
+//
+// Parameters:
+//   - archive: the opened archive
+//   - publicKey: the key matching the one it was signed with, nil for an unsigned archive
+//
+// Returns:
+//   - *io.SectionReader: the archive up to its signature
+//   - error: ErrNotSigned if the archive has no signature, ErrVerifyKeyRequired if it has one
+//     but publicKey is nil, ErrSignatureInvalid if it does not match, or an error if the
+//     archive cannot be read
+func ArchiveSection(archive *os.File, publicKey ed25519.PublicKey) (*io.SectionReader, error) {
+	if publicKey != nil && len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid Ed25519 public key of %d bytes", len(publicKey))
+	}
+
+	content, signed, err := archiveSection(archive)
+	if err != nil {
+		return nil, err
+	}
+	if publicKey == nil {
+		if signed {
+			return nil, ErrVerifyKeyRequired
+		}
+		return content, nil
+	}
+	if !signed {
+		return nil, ErrNotSigned
+	}
+
+	digest, err := hashArchive(content)
+	if err != nil {
+		return nil, err
+	}
+
+	signature := make([]byte, ed25519.SignatureSize)
+	if _, err := archive.ReadAt(signature, content.Size()+int64(len(SIGNATURE_MAGIC))); err != nil {
+		return nil, fmt.Errorf("failed to read the signature: %v", err)
+	}
+	if !ed25519.Verify(publicKey, digest, signature) {
+		return nil, ErrSignatureInvalid
+	}
+	// hashing read content to its end
+	return io.NewSectionReader(archive, 0, content.Size()), nil
+}
+
+// archiveSection returns the content of archive and whether it seems to end with a signature.
+// A trailer is recognized when it starts with SIGNATURE_MAGIC and holds a canonical Ed25519
+// signature, so an unsigned archive is mistaken for a signed one when its last 66 bytes match
+// both by chance. ArchiveSection relies on it to refuse reading a signed archive without a key,
+// and SignArchive to refuse signing an archive twice.
+func archiveSection(archive *os.File) (*io.SectionReader, bool, error) {
+	info, err := archive.Stat()
+	if err != nil {
+		return nil, false, fmt.Errorf(constants.FILE_STAT_ERROR, err)
+	}
+	size := info.Size()
+	if size < int64(SIGNATURE_TRAILER_SIZE) {
+		return io.NewSectionReader(archive, 0, size), false, nil
+	}
+
+	trailer := make([]byte, SIGNATURE_TRAILER_SIZE)
+	if _, err := archive.ReadAt(trailer, size-int64(SIGNATURE_TRAILER_SIZE)); err != nil {
+		return nil, false, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	// the highest 3 bits of the scalar of a canonical signature are 0
+	if !bytes.HasPrefix(trailer, []byte(SIGNATURE_MAGIC)) || trailer[SIGNATURE_TRAILER_SIZE-1]&0xe0 != 0 {
+		return io.NewSectionReader(archive, 0, size), false, nil
+	}
+	return io.NewSectionReader(archive, 0, size-int64(SIGNATURE_TRAILER_SIZE)), true, nil
+}
+
+// hashArchive returns the SHA-256 hash of content, the digest that is signed.
+func hashArchive(content io.Reader) ([]byte, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	return hash.Sum(nil), nil
+}
+
+// ReadSigningKey reads the Ed25519 private key of a key file, in PEM as written by
+// openssl genpkey -algorithm ed25519, or as the raw 32 byte seed or 64 byte key.
+//
+// Parameters:
+//   - path: the path of the key file
+//
+// Returns:
+//   - ed25519.PrivateKey: the key
+//   - error: if the file cannot be read or holds no Ed25519 private key
+func ReadSigningKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key %s: %v", path, err)
+	}
+
+	if block, _ := pem.Decode(data); block != nil {
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %v", path, err)
+		}
+		privateKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("signing key %s is not an Ed25519 key", path)
+		}
+		return privateKey, nil
+	}
+
+	switch len(data) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(data), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(data), nil
+	}
+	return nil, fmt.Errorf("signing key %s is neither PEM nor a raw Ed25519 key of %d or %d bytes", path, ed25519.SeedSize, ed25519.PrivateKeySize)
+}
+
+// ReadVerifyKey reads the Ed25519 public key of a key file, in PEM as written by
+// openssl pkey -pubout, or as the raw 32 byte key.
+//
+// Parameters:
+//   - path: the path of the key file
+//
+// Returns:
+//   - ed25519.PublicKey: the key
+//   - error: if the file cannot be read or holds no Ed25519 public key
+func ReadVerifyKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read verification key %s: %v", path, err)
+	}
+
+	if block, _ := pem.Decode(data); block != nil {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("verification key %s: %v", path, err)
+		}
+		publicKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("verification key %s is not an Ed25519 key", path)
+		}
+		return publicKey, nil
+	}
+
+	if len(data) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("verification key %s is neither PEM nor a raw Ed25519 key of %d bytes", path, ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(data), nil
+}
@@ -0,0 +1,1140 @@
+// Package format defines the binary layout of a SquirrelZip archive. Every field that is
+// written to or read from an archive goes through this package, so a change to the
+// layout is confined to this file.
+//
+// Layout of version 4:
+//
+//	container header  [4 byte MAGIC][u16 version][u8 algorithm length][algorithm name]
+//	code lengths      [u16 count]{[u8 symbol][u8 bit length]}
+//	entry count       [u64 count]
+//	links             [u64 count]{[u64 entry index][u64 original index]}
+//	entry             [u16 name length][compressed name][u64 modification time][u32 mode][u32 crc32][u64 original size][u64 data length][compressed data]
+//
+// The modification time is in nanoseconds since the Unix epoch, the mode holds the Unix permission
+// bits. Both are 0 when unknown. The CRC32 (IEEE) is computed over the original content of the entry,
+// the original size is its length.
+//
+// The links list the entries whose content is the same as the one of an earlier entry, their
+// original, see WriteLinkTable. A link has the header of an entry with the checksum and the
+// original size of its original, and no data. Only Huffman and BWT payloads have links, version
+// 3 has none.
+//
+// The Huffman codes are canonical, see CanonicalCodes, so their lengths are enough to rebuild
+// them. Version 2 stored every code instead:
+//
+//	code table        [u64 count]{[u32 symbol][u8 bit length][bits packed MSB first]}
+//
+// A streamed Huffman payload, algorithm "huffman-stream", is written without seeking. It has no
+// entry count, the links follow the code lengths, every entry is preceded by a marker and the
+// payload ends with ENTRY_MARKER_END:
+//
+//	entry marker      [u8 ENTRY_MARKER_NEXT]
+//
+// An "auto" payload groups the entries by the algorithm picked for them. Every group holds a
+// complete payload of its algorithm, and the payload ends with ENTRY_MARKER_END:
+//
+//	group             [u8 ENTRY_MARKER_NEXT][u8 algorithm length][algorithm name][payload]
+//
+// The arithmetic codec replaces the code table with a frequency table and stores entry names as is:
+//
+//	frequency table   [u16 count]{[u8 symbol][u32 frequency]}
+//
+// A BWT payload is laid out like a Huffman one. The data of an entry is cut into blocks before
+// it is Huffman coded, every block is transformed and move-to-front coded, see BWTBlockHeader:
+//
+//	bwt block         [u32 primary index][u32 length][transformed bytes]
+//
+// The encryption layer wraps the whole archive. With a password the metadata byte is followed by
+//
+//	cipher suite      [u8 suite]
+//	key derivation    [16 byte salt][u32 PBKDF2 iterations]
+//
+// or, when the metadata byte selects Argon2id, by
+//
+//	cipher suite      [u8 suite]
+//	key derivation    [16 byte salt][u32 time][u32 memory in KiB][u8 threads]
+//
+// With a key file the metadata byte is followed by the key derivation function and whether a
+// password is combined with the key file, then by the cipher suite and the parameters above:
+//
+//	key file          [u8 key derivation function][u8 password]
+//
+// With and without a password the metadata ends with the integrity mode, followed by the
+// HMAC key only when there is no password. With a password the mode has its high bit set and
+// the size of the plaintext chunks follows, archives without it use 256 byte chunks:
+//
+//	integrity         [u8 mode]([32 byte HMAC key])([u32 chunk size])
+//
+// With a password the payload is framed as
+//
+//	nonce             [12 byte base nonce]
+//	chunk             [u64 counter][u32 sealed length][sealed bytes]
+//
+// Every chunk is sealed with its counter and a final flag as additional data. Only the last
+// chunk has the flag set, a stream of an empty input consists of one empty final chunk.
+//
+// With an HMAC the stream ends with a 32 byte HMAC-SHA256 tag over everything before it.
+//
+// Multi-byte fields use ByteOrder.
+package format
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"file-compressor/constants"
+)
+
+// ByteOrder is the byte order of every multi-byte field in an archive.
+var ByteOrder = binary.LittleEndian
+
+// MAGIC identifies a SquirrelZip archive, it is the first field of every archive.
+const MAGIC = constants.MAGIC_BYTES
+
+// Format versions.
+const (
+	// VERSION_1 is the original layout, it started directly with the algorithm name and
+	// carried neither MAGIC nor a version field, see ReadLegacyHeader. Its entries only
+	// hold the name and the data length:
+	//
+	//	entry             [u16 name length][compressed name][u64 data length][compressed data]
+	VERSION_1 uint16 = 1
+
+	// VERSION_2 adds MAGIC and the version field in front of the algorithm name.
+	VERSION_2 uint16 = 2
+
+	// VERSION_3 stores canonical Huffman code lengths instead of the codes, see WriteCodeLengths.
+	VERSION_3 uint16 = 3
+
+	// VERSION_4 adds the links of Huffman and BWT payloads, see WriteLinkTable.
+	VERSION_4 uint16 = 4
+
+	// CURRENT_VERSION is the version written by this build, and the newest one it reads.
+	CURRENT_VERSION = constants.ARCHIVE_VERSION_CURRENT
+
+	// MIN_SUPPORTED_VERSION is the oldest version this build reads.
+	MIN_SUPPORTED_VERSION = constants.MIN_SUPPORTED_VERSION
+)
+
+// ErrUnsupportedVersion is returned for an archive whose version this build cannot read,
+// usually one written by a newer build. Max is the newest version this build reads.
+type ErrUnsupportedVersion struct {
+	Got uint16
+	Max uint16
+}
+
+func (e *ErrUnsupportedVersion) Error() string {
+	return fmt.Sprintf("unsupported archive version %d, this build reads versions %d to %d", e.Got, MIN_SUPPORTED_VERSION, e.Max)
+}
+
+// ErrNotAnArchive is returned when the input does not start with MAGIC. Found holds the bytes
+// read instead, fewer than MAGIC when the input is shorter.
+type ErrNotAnArchive struct {
+	Found []byte
+}
+
+func (e *ErrNotAnArchive) Error() string {
+	return "not a SquirrelZip archive"
+}
+
+// Field limits of the current version.
+const (
+	MAX_ALGORITHM_LEN = math.MaxUint8
+	MAX_NAME_LEN      = math.MaxUint16
+	MAX_CODE_BITS     = math.MaxUint8
+
+	// ENTRY_SIZE_LEN is the size of the data length field that follows an entry name.
+	// Writers that back-fill the length seek back by this amount plus the data length.
+	ENTRY_SIZE_LEN = 8
+
+	// ENTRY_MOD_TIME_LEN is the size of the modification time field that follows the name.
+	ENTRY_MOD_TIME_LEN = 8
+
+	// ENTRY_MODE_LEN is the size of the mode field that follows the modification time.
+	ENTRY_MODE_LEN = 4
+
+	// ENTRY_ORIGINAL_SIZE_LEN is the size of the original size field that precedes the data length.
+	ENTRY_ORIGINAL_SIZE_LEN = 8
+
+	// ENTRY_CRC_LEN is the size of the checksum field that precedes the original size.
+	// Writers back-fill it together with the data length once the entry is written.
+	ENTRY_CRC_LEN = 4
+
+	// BWT_BLOCK_HEADER_LEN is the size of a BWTBlockHeader on disk.
+	BWT_BLOCK_HEADER_LEN = 8
+
+	// CHUNK_HEADER_LEN is the size of a ChunkHeader on disk.
+	CHUNK_HEADER_LEN = 12
+
+	// CHUNK_SIZE_LEN is the size of the chunk size field at the end of the metadata.
+	CHUNK_SIZE_LEN = 4
+
+	// SALT_LEN is the size of the key derivation salt.
+	SALT_LEN = 16
+
+	// KEY_DERIVATION_HEADER_LEN is the size of a KeyDerivationHeader on disk.
+	KEY_DERIVATION_HEADER_LEN = SALT_LEN + 4
+
+	// ARGON2_HEADER_LEN is the size of an Argon2Header on disk.
+	ARGON2_HEADER_LEN = SALT_LEN + 4 + 4 + 1
+)
+
+// Entry markers of a streamed payload.
+const (
+	ENTRY_MARKER_END  uint8 = 0
+	ENTRY_MARKER_NEXT uint8 = 1
+)
+
+// ContainerHeader is the first field of an archive.
+type ContainerHeader struct {
+	// Version is the format version of the archive. WriteContainerHeader writes
+	// CURRENT_VERSION when it is zero.
+	Version uint16
+	// Algorithm names the codec used for the payload.
+	Algorithm string
+}
+
+// CodeTable maps every symbol of a Huffman payload to its code written as '0' and '1' characters.
+type CodeTable map[rune]string
+
+// EntryHeader precedes the data of every entry.
+type EntryHeader struct {
+	// Name is the entry name as stored by the codec. Huffman compresses it with the payload codes.
+	Name []byte
+	// ModTime is the modification time of the source file in nanoseconds since the Unix epoch, 0 when unknown.
+	ModTime int64
+	// Mode holds the Unix permission bits of the source file, 0 when unknown.
+	Mode uint32
+	// CRC32 is the IEEE CRC32 of the original content.
+	CRC32 uint32
+	// OriginalSize is the length of the original content.
+	OriginalSize uint64
+	// CompressedSize is the length of the compressed data that follows the header.
+	CompressedSize uint64
+}
+
+// EntryLink is an entry of the links of a Huffman or BWT payload.
+type EntryLink struct {
+	// Entry is the index of the link in the payload, the link has no data.
+	Entry uint64
+	// Original is the index of the earlier entry whose data the link shares.
+	Original uint64
+}
+
+// BWTBlockHeader precedes every block of the data of a BWT entry.
+type BWTBlockHeader struct {
+	// Primary is the row of the sorted rotations holding the original block.
+	Primary uint32
+	// Length is the number of bytes of the block.
+	Length uint32
+}
+
+// FrequencyTable holds the frequency of every byte value of an arithmetic payload.
+type FrequencyTable [256]uint32
+
+// ChunkHeader precedes every sealed chunk of an encrypted archive.
+type ChunkHeader struct {
+	// Counter is the position of the chunk in the stream, starting at 0. It is mixed into
+	// the nonce of the chunk so no two chunks are sealed with the same nonce.
+	Counter uint64
+	// Length is the size of the sealed chunk, including the authentication tag.
+	Length uint32
+}
+
+// ContainerHeaderLen returns the size on disk of the container header for algorithm.
+// Offsets into the payload are relative to the end of the header.
+func ContainerHeaderLen(algorithm string) int {
+	return len(MAGIC) + 2 + 1 + len(algorithm)
+}
+
+// KeyDerivationHeader holds the parameters used to derive the key of an encrypted archive.
+type KeyDerivationHeader struct {
+	// Salt is the random PBKDF2 salt, SALT_LEN bytes long.
+	Salt []byte
+	// Iterations is the PBKDF2 iteration count.
+	Iterations uint32
+}
+
+// Argon2Header holds the Argon2id parameters used to derive the key of an encrypted archive.
+type Argon2Header struct {
+	// Salt is the random salt, SALT_LEN bytes long.
+	Salt []byte
+	// Time is the number of passes over the memory.
+	Time uint32
+	// Memory is the memory size in KiB.
+	Memory uint32
+	// Threads is the degree of parallelism.
+	Threads uint8
+}
+
+// WriteContainerHeader writes MAGIC, the format version and the algorithm name.
+//
+// Parameters:
+//   - w: the archive writer
+//   - header: the header to write
+//
+// Returns:
+//   - error: if the algorithm name is too long or writing fails
+func WriteContainerHeader(w io.Writer, header ContainerHeader) error {
+	if len(header.Algorithm) > MAX_ALGORITHM_LEN {
+		return fmt.Errorf("algorithm name is %d bytes long, the limit is %d", len(header.Algorithm), MAX_ALGORITHM_LEN)
+	}
+
+	version := header.Version
+	if version == 0 {
+		version = CURRENT_VERSION
+	}
+
+	if err := writeBytes(w, []byte(MAGIC)); err != nil {
+		return err
+	}
+	if err := writeUint16(w, version); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(len(header.Algorithm))); err != nil {
+		return err
+	}
+	return writeBytes(w, []byte(header.Algorithm))
+}
+
+// ReadContainerHeader reads and validates the container header.
+//
+// Parameters:
+//   - r: the archive reader
+//
+// Returns:
+//   - ContainerHeader: the decoded header
+//   - error: *ErrNotAnArchive if the input does not start with MAGIC, *ErrUnsupportedVersion
+//     if this build cannot read the version, or an error if reading fails
+func ReadContainerHeader(r io.Reader) (ContainerHeader, error) {
+	magic := make([]byte, constants.MAGIC_BYTES_LEN)
+	if n, err := io.ReadFull(r, magic); err != nil {
+		// input shorter than the magic cannot be an archive either
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ContainerHeader{}, &ErrNotAnArchive{Found: magic[:n]}
+		}
+		return ContainerHeader{}, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	if !bytes.Equal(magic, []byte(MAGIC)) {
+		return ContainerHeader{}, &ErrNotAnArchive{Found: magic}
+	}
+
+	version, err := readUint16(r)
+	if err != nil {
+		return ContainerHeader{}, err
+	}
+	// version 1 archives have no version field, so a header with MAGIC is at least version 2
+	if version < VERSION_2 || version > CURRENT_VERSION {
+		return ContainerHeader{}, &ErrUnsupportedVersion{Got: version, Max: CURRENT_VERSION}
+	}
+
+	length, err := readUint8(r)
+	if err != nil {
+		return ContainerHeader{}, err
+	}
+
+	algorithm, err := readBytes(r, int(length))
+	if err != nil {
+		return ContainerHeader{}, err
+	}
+
+	return ContainerHeader{Version: version, Algorithm: string(algorithm)}, nil
+}
+
+// ReadLegacyHeader reads the container header of a VERSION_1 archive, which is only the
+// algorithm name. Such a header cannot be recognized by itself, so callers should only try
+// it after ReadContainerHeader returned *ErrNotAnArchive, and check the algorithm name.
+//
+// Parameters:
+//   - r: the archive reader, positioned at the start of the archive
+//
+// Returns:
+//   - ContainerHeader: the decoded header with Version set to VERSION_1
+//   - error: if reading fails
+func ReadLegacyHeader(r io.Reader) (ContainerHeader, error) {
+	length, err := readUint8(r)
+	if err != nil {
+		return ContainerHeader{}, err
+	}
+
+	algorithm, err := readBytes(r, int(length))
+	if err != nil {
+		return ContainerHeader{}, err
+	}
+
+	return ContainerHeader{Version: VERSION_1, Algorithm: string(algorithm)}, nil
+}
+
+// WriteCodeTable writes a Huffman code table. Symbols are written in ascending order so
+// the same table always produces the same bytes.
+//
+// Parameters:
+//   - w: the archive writer
+//   - table: the codes to write
+//
+// Returns:
+//   - error: if a code is too long, contains anything but '0' and '1', or writing fails
+func WriteCodeTable(w io.Writer, table CodeTable) error {
+	symbols := make([]rune, 0, len(table))
+	for symbol := range table {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i] < symbols[j] })
+
+	if err := writeUint64(w, uint64(len(symbols))); err != nil {
+		return err
+	}
+
+	for _, symbol := range symbols {
+		code := table[symbol]
+		if len(code) > MAX_CODE_BITS {
+			return fmt.Errorf("code for symbol %d is %d bits long, the limit is %d", symbol, len(code), MAX_CODE_BITS)
+		}
+
+		packed := make([]byte, (len(code)+7)/8)
+		for i := 0; i < len(code); i++ {
+			switch code[i] {
+			case '1':
+				packed[i/8] |= 1 << uint8(7-i%8)
+			case '0':
+			default:
+				return fmt.Errorf("code for symbol %d contains %q", symbol, code[i])
+			}
+		}
+
+		if err := writeUint32(w, uint32(symbol)); err != nil {
+			return err
+		}
+		if err := writeUint8(w, uint8(len(code))); err != nil {
+			return err
+		}
+		if err := writeBytes(w, packed); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadCodeTable reads a Huffman code table.
+//
+// Parameters:
+//   - r: the archive reader
+//
+// Returns:
+//   - CodeTable: the decoded codes
+//   - error: if reading fails
+func ReadCodeTable(r io.Reader) (CodeTable, error) {
+	count, err := readUint64(r)
+	if err != nil {
+		return nil, err
+	}
+
+	table := make(CodeTable)
+	for i := uint64(0); i < count; i++ {
+		symbol, err := readUint32(r)
+		if err != nil {
+			return nil, err
+		}
+
+		bits, err := readUint8(r)
+		if err != nil {
+			return nil, err
+		}
+
+		packed, err := readBytes(r, (int(bits)+7)/8)
+		if err != nil {
+			return nil, err
+		}
+
+		code := make([]byte, bits)
+		for bit := range code {
+			code[bit] = '0' + (packed[bit/8]>>uint8(7-bit%8))&1
+		}
+
+		table[rune(symbol)] = string(code)
+	}
+
+	return table, nil
+}
+
+// CanonicalCodes assigns the canonical Huffman codes for the given code lengths. Symbols are
+// ordered by code length, then by value, and every code is the previous one plus one, shifted
+// left by the difference in length, the first one is all zeros.
+//
+// Parameters:
+//   - lengths: the code length of every symbol
+//
+// Returns:
+//   - CodeTable: the codes
+//   - error: if a length is 0 or the lengths need more codes than there are
+func CanonicalCodes(lengths map[rune]int) (CodeTable, error) {
+	symbols := make([]rune, 0, len(lengths))
+	for symbol := range lengths {
+		symbols = append(symbols, symbol)
+	}
+	sort.Slice(symbols, func(i, j int) bool {
+		if lengths[symbols[i]] != lengths[symbols[j]] {
+			return lengths[symbols[i]] < lengths[symbols[j]]
+		}
+		return symbols[i] < symbols[j]
+	})
+
+	table := make(CodeTable, len(symbols))
+	// codes can be longer than any integer, they are counted up as text
+	code := []byte{}
+	for i, symbol := range symbols {
+		length := lengths[symbol]
+		if length < 1 || length > MAX_CODE_BITS {
+			return nil, fmt.Errorf("code for symbol %d is %d bits long, the limit is 1 to %d", symbol, length, MAX_CODE_BITS)
+		}
+		if i > 0 && !incrementCode(code) {
+			return nil, fmt.Errorf("the code lengths need more than %d bit codes", len(code))
+		}
+		for len(code) < length {
+			code = append(code, '0')
+		}
+		table[symbol] = string(code)
+	}
+
+	return table, nil
+}
+
+// incrementCode adds one to code, it returns false when all its bits were already set.
+func incrementCode(code []byte) bool {
+	for i := len(code) - 1; i >= 0; i-- {
+		if code[i] == '0' {
+			code[i] = '1'
+			return true
+		}
+		code[i] = '0'
+	}
+	return false
+}
+
+// WriteCodeLengths writes the length of every code of a canonical Huffman code table in
+// ascending symbol order, ReadCodeLengths rebuilds the codes from them.
+//
+// Parameters:
+//   - w: the archive writer
+//   - table: the codes to write, as returned by CanonicalCodes
+//
+// Returns:
+//   - error: if a symbol is not a byte, the codes are not canonical, or writing fails
+func WriteCodeLengths(w io.Writer, table CodeTable) error {
+	lengths := make(map[rune]int, len(table))
+	for symbol, code := range table {
+		if symbol < 0 || symbol > math.MaxUint8 {
+			return fmt.Errorf("symbol %d of the code table is not a byte", symbol)
+		}
+		lengths[symbol] = len(code)
+	}
+
+	// the codes are not written, data encoded with other codes could not be decoded
+	canonical, err := CanonicalCodes(lengths)
+	if err != nil {
+		return err
+	}
+	for symbol, code := range table {
+		if canonical[symbol] != code {
+			return fmt.Errorf("code for symbol %d is not canonical", symbol)
+		}
+	}
+
+	if err := writeUint16(w, uint16(len(table))); err != nil {
+		return err
+	}
+
+	for symbol := rune(0); symbol <= math.MaxUint8; symbol++ {
+		length, ok := lengths[symbol]
+		if !ok {
+			continue
+		}
+		if err := writeUint8(w, uint8(symbol)); err != nil {
+			return err
+		}
+		if err := writeUint8(w, uint8(length)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadCodeLengths reads the code lengths written by WriteCodeLengths and rebuilds the codes.
+//
+// Parameters:
+//   - r: the archive reader
+//
+// Returns:
+//   - CodeTable: the canonical codes
+//   - error: if reading fails or the lengths do not describe a code table
+func ReadCodeLengths(r io.Reader) (CodeTable, error) {
+	count, err := readUint16(r)
+	if err != nil {
+		return nil, err
+	}
+	if count > math.MaxUint8+1 {
+		return nil, fmt.Errorf("code table lists %d symbols, the limit is %d", count, math.MaxUint8+1)
+	}
+
+	lengths := make(map[rune]int, count)
+	for i := 0; i < int(count); i++ {
+		symbol, err := readUint8(r)
+		if err != nil {
+			return nil, err
+		}
+		length, err := readUint8(r)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := lengths[rune(symbol)]; ok {
+			return nil, fmt.Errorf("code table lists symbol %d twice", symbol)
+		}
+		lengths[rune(symbol)] = int(length)
+	}
+
+	return CanonicalCodes(lengths)
+}
+
+// WriteFrequencyTable writes the frequencies of the byte values that occur, in ascending order.
+//
+// Parameters:
+//   - w: the archive writer
+//   - table: the frequencies, zero entries are not written
+//
+// Returns:
+//   - error: if writing fails
+func WriteFrequencyTable(w io.Writer, table FrequencyTable) error {
+	count := 0
+	for _, frequency := range table {
+		if frequency > 0 {
+			count++
+		}
+	}
+
+	if err := writeUint16(w, uint16(count)); err != nil {
+		return err
+	}
+
+	for symbol, frequency := range table {
+		if frequency == 0 {
+			continue
+		}
+		if err := writeUint8(w, uint8(symbol)); err != nil {
+			return err
+		}
+		if err := writeUint32(w, frequency); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadFrequencyTable reads a frequency table.
+//
+// Parameters:
+//   - r: the archive reader
+//
+// Returns:
+//   - FrequencyTable: the decoded frequencies
+//   - error: if reading fails or the table lists more than 256 symbols
+func ReadFrequencyTable(r io.Reader) (FrequencyTable, error) {
+	table := FrequencyTable{}
+
+	count, err := readUint16(r)
+	if err != nil {
+		return table, err
+	}
+	if int(count) > len(table) {
+		return table, fmt.Errorf("frequency table lists %d symbols, the limit is %d", count, len(table))
+	}
+
+	for i := 0; i < int(count); i++ {
+		symbol, err := readUint8(r)
+		if err != nil {
+			return table, err
+		}
+		frequency, err := readUint32(r)
+		if err != nil {
+			return table, err
+		}
+		table[symbol] = frequency
+	}
+
+	return table, nil
+}
+
+// WriteEntryCount writes the number of entries in the archive.
+func WriteEntryCount(w io.Writer, count uint64) error {
+	return writeUint64(w, count)
+}
+
+// ReadEntryCount reads the number of entries in the archive.
+func ReadEntryCount(r io.Reader) (uint64, error) {
+	return readUint64(r)
+}
+
+// WriteLinkTable writes the links of a Huffman or BWT payload, after the entry count.
+//
+// Parameters:
+//   - w: the archive writer
+//   - links: the links, ordered by Entry
+//
+// Returns:
+//   - error: if writing fails
+func WriteLinkTable(w io.Writer, links []EntryLink) error {
+	data := ByteOrder.AppendUint64(nil, uint64(len(links)))
+	for _, link := range links {
+		data = ByteOrder.AppendUint64(data, link.Entry)
+		data = ByteOrder.AppendUint64(data, link.Original)
+	}
+	return writeBytes(w, data)
+}
+
+// ReadLinkTable reads the links written by WriteLinkTable.
+//
+// Parameters:
+//   - r: the archive reader
+//   - entries: the entry count of the payload, math.MaxUint64 for a streamed payload, whose
+//     links are checked against the entries it holds once they are read
+//
+// Returns:
+//   - []EntryLink: the links, ordered by Entry
+//   - error: if reading fails, or a link is not ordered, is out of range or does not point to
+//     an earlier entry
+func ReadLinkTable(r io.Reader, entries uint64) ([]EntryLink, error) {
+	count, err := readUint64(r)
+	if err != nil {
+		return nil, err
+	}
+	if count > entries {
+		return nil, fmt.Errorf("%d links for %d entries", count, entries)
+	}
+
+	// the count is not trusted with the allocation, a damaged one fails at the end of the table
+	links := make([]EntryLink, 0, min(count, 1024))
+	for i := uint64(0); i < count; i++ {
+		entry, err := readUint64(r)
+		if err != nil {
+			return nil, err
+		}
+		original, err := readUint64(r)
+		if err != nil {
+			return nil, err
+		}
+		if entry >= entries || original >= entry || (i > 0 && entry <= links[i-1].Entry) {
+			return nil, fmt.Errorf("invalid link of entry %d to entry %d", entry, original)
+		}
+		links = append(links, EntryLink{Entry: entry, Original: original})
+	}
+	return links, nil
+}
+
+// WriteEntryMarker writes whether another entry follows in a streamed payload.
+func WriteEntryMarker(w io.Writer, next bool) error {
+	if next {
+		return writeUint8(w, ENTRY_MARKER_NEXT)
+	}
+	return writeUint8(w, ENTRY_MARKER_END)
+}
+
+// ReadEntryMarker reads the marker before an entry of a streamed payload.
+//
+// Parameters:
+//   - r: the archive reader
+//
+// Returns:
+//   - bool: true if an entry follows, false at the end of the payload
+//   - error: if reading fails or the marker is neither ENTRY_MARKER_NEXT nor ENTRY_MARKER_END
+func ReadEntryMarker(r io.Reader) (bool, error) {
+	marker, err := readUint8(r)
+	if err != nil {
+		return false, err
+	}
+	switch marker {
+	case ENTRY_MARKER_NEXT:
+		return true, nil
+	case ENTRY_MARKER_END:
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid entry marker %d", marker)
+	}
+}
+
+// WriteGroupHeader starts a group of an "auto" payload, the payload of algorithm follows.
+// WriteEntryMarker ends the last group.
+//
+// Parameters:
+//   - w: the archive writer
+//   - algorithm: the algorithm of the group
+//
+// Returns:
+//   - error: if the algorithm name is too long or writing fails
+func WriteGroupHeader(w io.Writer, algorithm string) error {
+	if len(algorithm) > MAX_ALGORITHM_LEN {
+		return fmt.Errorf("algorithm name is %d bytes long, the limit is %d", len(algorithm), MAX_ALGORITHM_LEN)
+	}
+	if err := WriteEntryMarker(w, true); err != nil {
+		return err
+	}
+	if err := writeUint8(w, uint8(len(algorithm))); err != nil {
+		return err
+	}
+	return writeBytes(w, []byte(algorithm))
+}
+
+// ReadGroupHeader reads the start of a group of an "auto" payload.
+//
+// Parameters:
+//   - r: the archive reader
+//
+// Returns:
+//   - string: the algorithm of the group
+//   - bool: false after the last group
+//   - error: if reading fails or the marker is invalid
+func ReadGroupHeader(r io.Reader) (string, bool, error) {
+	next, err := ReadEntryMarker(r)
+	if err != nil || !next {
+		return "", false, err
+	}
+
+	length, err := readUint8(r)
+	if err != nil {
+		return "", false, err
+	}
+	algorithm, err := readBytes(r, int(length))
+	if err != nil {
+		return "", false, err
+	}
+	return string(algorithm), true, nil
+}
+
+// WriteEntryHeader writes the header of an entry.
+//
+// Parameters:
+//   - w: the archive writer
+//   - header: the header to write, CRC32, OriginalSize and CompressedSize may be placeholders that are
+//     back-filled with WriteEntryCRC, WriteEntryOriginalSize and WriteEntrySize
+//
+// Returns:
+//   - error: if the name is too long or writing fails
+func WriteEntryHeader(w io.Writer, header EntryHeader) error {
+	if len(header.Name) > MAX_NAME_LEN {
+		return fmt.Errorf("compressed entry name is %d bytes long, the limit is %d", len(header.Name), MAX_NAME_LEN)
+	}
+
+	if err := writeUint16(w, uint16(len(header.Name))); err != nil {
+		return err
+	}
+	if err := writeBytes(w, header.Name); err != nil {
+		return err
+	}
+	if err := WriteEntryModTime(w, header.ModTime); err != nil {
+		return err
+	}
+	if err := WriteEntryMode(w, header.Mode); err != nil {
+		return err
+	}
+	if err := WriteEntryCRC(w, header.CRC32); err != nil {
+		return err
+	}
+	if err := WriteEntryOriginalSize(w, header.OriginalSize); err != nil {
+		return err
+	}
+	return WriteEntrySize(w, header.CompressedSize)
+}
+
+// ReadEntryHeader reads the header of an entry.
+//
+// Parameters:
+//   - r: the archive reader
+//
+// Returns:
+//   - EntryHeader: the decoded header
+//   - error: if reading fails
+func ReadEntryHeader(r io.Reader) (EntryHeader, error) {
+	name, err := ReadEntryName(r)
+	if err != nil {
+		return EntryHeader{}, err
+	}
+
+	modTime, err := ReadEntryModTime(r)
+	if err != nil {
+		return EntryHeader{}, err
+	}
+
+	mode, err := ReadEntryMode(r)
+	if err != nil {
+		return EntryHeader{}, err
+	}
+
+	checksum, err := ReadEntryCRC(r)
+	if err != nil {
+		return EntryHeader{}, err
+	}
+
+	originalSize, err := ReadEntryOriginalSize(r)
+	if err != nil {
+		return EntryHeader{}, err
+	}
+
+	size, err := ReadEntrySize(r)
+	if err != nil {
+		return EntryHeader{}, err
+	}
+
+	return EntryHeader{Name: name, ModTime: modTime, Mode: mode, CRC32: checksum, OriginalSize: originalSize, CompressedSize: size}, nil
+}
+
+// ReadEntryName reads only the name field of an entry header, for readers that
+// need to tell a damaged name apart from a damaged size.
+func ReadEntryName(r io.Reader) ([]byte, error) {
+	length, err := readUint16(r)
+	if err != nil {
+		return nil, err
+	}
+	return readBytes(r, int(length))
+}
+
+// WriteEntryModTime writes the modification time field of an entry header.
+func WriteEntryModTime(w io.Writer, modTime int64) error {
+	return writeUint64(w, uint64(modTime))
+}
+
+// ReadEntryModTime reads the modification time field of an entry header.
+func ReadEntryModTime(r io.Reader) (int64, error) {
+	value, err := readUint64(r)
+	return int64(value), err
+}
+
+// WriteEntryMode writes the mode field of an entry header.
+func WriteEntryMode(w io.Writer, mode uint32) error {
+	return writeUint32(w, mode)
+}
+
+// ReadEntryMode reads the mode field of an entry header.
+func ReadEntryMode(r io.Reader) (uint32, error) {
+	return readUint32(r)
+}
+
+// WriteEntryCRC writes the checksum field of an entry header.
+func WriteEntryCRC(w io.Writer, checksum uint32) error {
+	return writeUint32(w, checksum)
+}
+
+// ReadEntryCRC reads the checksum field of an entry header.
+func ReadEntryCRC(r io.Reader) (uint32, error) {
+	return readUint32(r)
+}
+
+// WriteEntryOriginalSize writes the original size field of an entry header.
+func WriteEntryOriginalSize(w io.Writer, size uint64) error {
+	return writeUint64(w, size)
+}
+
+// ReadEntryOriginalSize reads the original size field of an entry header.
+func ReadEntryOriginalSize(r io.Reader) (uint64, error) {
+	return readUint64(r)
+}
+
+// WriteEntrySize writes the data length field of an entry header.
+func WriteEntrySize(w io.Writer, size uint64) error {
+	return writeUint64(w, size)
+}
+
+// ReadEntrySize reads the data length field of an entry header.
+func ReadEntrySize(r io.Reader) (uint64, error) {
+	return readUint64(r)
+}
+
+// AppendBWTBlockHeader appends the header of a BWT block to data. The blocks are built in
+// memory before they are Huffman coded, so the header is appended rather than written.
+func AppendBWTBlockHeader(data []byte, header BWTBlockHeader) []byte {
+	data = ByteOrder.AppendUint32(data, header.Primary)
+	return ByteOrder.AppendUint32(data, header.Length)
+}
+
+// ParseBWTBlockHeader decodes the header of a BWT block from the first BWT_BLOCK_HEADER_LEN
+// bytes of data.
+func ParseBWTBlockHeader(data []byte) BWTBlockHeader {
+	return BWTBlockHeader{Primary: ByteOrder.Uint32(data), Length: ByteOrder.Uint32(data[4:])}
+}
+
+// WriteChunkHeader writes the header of a sealed chunk.
+func WriteChunkHeader(w io.Writer, header ChunkHeader) error {
+	data := ByteOrder.AppendUint64(nil, header.Counter)
+	data = ByteOrder.AppendUint32(data, header.Length)
+	return writeBytes(w, data)
+}
+
+// ReadChunkHeader reads the header of a sealed chunk. It returns io.EOF unwrapped when
+// the stream ends cleanly before a header, so readers can tell the end of the stream
+// apart from a truncated header.
+func ReadChunkHeader(r io.Reader) (ChunkHeader, error) {
+	data := make([]byte, CHUNK_HEADER_LEN)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			return ChunkHeader{}, io.EOF
+		}
+		return ChunkHeader{}, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+
+	return ChunkHeader{Counter: ByteOrder.Uint64(data), Length: ByteOrder.Uint32(data[8:])}, nil
+}
+
+// WriteChunkSize writes the size of the plaintext chunks of an encrypted archive.
+func WriteChunkSize(w io.Writer, size uint32) error {
+	return writeBytes(w, ByteOrder.AppendUint32(nil, size))
+}
+
+// ReadChunkSize reads the size of the plaintext chunks of an encrypted archive.
+func ReadChunkSize(r io.Reader) (uint32, error) {
+	return readUint32(r)
+}
+
+// WriteKeyDerivationHeader writes the key derivation parameters of an encrypted archive.
+//
+// Parameters:
+//   - w: the archive writer
+//   - header: the parameters to write
+//
+// Returns:
+//   - error: if the salt is not SALT_LEN bytes long or writing fails
+func WriteKeyDerivationHeader(w io.Writer, header KeyDerivationHeader) error {
+	if len(header.Salt) != SALT_LEN {
+		return fmt.Errorf("salt is %d bytes long, expected %d", len(header.Salt), SALT_LEN)
+	}
+
+	data := append([]byte{}, header.Salt...)
+	data = ByteOrder.AppendUint32(data, header.Iterations)
+	return writeBytes(w, data)
+}
+
+// ReadKeyDerivationHeader reads the key derivation parameters of an encrypted archive.
+//
+// Parameters:
+//   - r: the archive reader
+//
+// Returns:
+//   - KeyDerivationHeader: the decoded parameters
+//   - error: if reading fails
+func ReadKeyDerivationHeader(r io.Reader) (KeyDerivationHeader, error) {
+	data, err := readBytes(r, KEY_DERIVATION_HEADER_LEN)
+	if err != nil {
+		return KeyDerivationHeader{}, err
+	}
+
+	return KeyDerivationHeader{Salt: data[:SALT_LEN], Iterations: ByteOrder.Uint32(data[SALT_LEN:])}, nil
+}
+
+// WriteArgon2Header writes the Argon2id parameters of an encrypted archive.
+//
+// Parameters:
+//   - w: the archive writer
+//   - header: the parameters to write
+//
+// Returns:
+//   - error: if the salt is not SALT_LEN bytes long or writing fails
+func WriteArgon2Header(w io.Writer, header Argon2Header) error {
+	if len(header.Salt) != SALT_LEN {
+		return fmt.Errorf("salt is %d bytes long, expected %d", len(header.Salt), SALT_LEN)
+	}
+
+	data := append([]byte{}, header.Salt...)
+	data = ByteOrder.AppendUint32(data, header.Time)
+	data = ByteOrder.AppendUint32(data, header.Memory)
+	data = append(data, header.Threads)
+	return writeBytes(w, data)
+}
+
+// ReadArgon2Header reads the Argon2id parameters of an encrypted archive.
+//
+// Parameters:
+//   - r: the archive reader
+//
+// Returns:
+//   - Argon2Header: the decoded parameters
+//   - error: if reading fails
+func ReadArgon2Header(r io.Reader) (Argon2Header, error) {
+	data, err := readBytes(r, ARGON2_HEADER_LEN)
+	if err != nil {
+		return Argon2Header{}, err
+	}
+
+	return Argon2Header{
+		Salt:    data[:SALT_LEN],
+		Time:    ByteOrder.Uint32(data[SALT_LEN:]),
+		Memory:  ByteOrder.Uint32(data[SALT_LEN+4:]),
+		Threads: data[SALT_LEN+8],
+	}, nil
+}
+
+func writeUint8(w io.Writer, value uint8) error {
+	return writeBytes(w, []byte{value})
+}
+
+func writeUint16(w io.Writer, value uint16) error {
+	return writeBytes(w, ByteOrder.AppendUint16(nil, value))
+}
+
+func writeUint32(w io.Writer, value uint32) error {
+	return writeBytes(w, ByteOrder.AppendUint32(nil, value))
+}
+
+func writeUint64(w io.Writer, value uint64) error {
+	return writeBytes(w, ByteOrder.AppendUint64(nil, value))
+}
+
+func writeBytes(w io.Writer, data []byte) error {
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+	return nil
+}
+
+func readUint8(r io.Reader) (uint8, error) {
+	data, err := readBytes(r, 1)
+	if err != nil {
+		return 0, err
+	}
+	return data[0], nil
+}
+
+func readUint16(r io.Reader) (uint16, error) {
+	data, err := readBytes(r, 2)
+	if err != nil {
+		return 0, err
+	}
+	return ByteOrder.Uint16(data), nil
+}
+
+func readUint32(r io.Reader) (uint32, error) {
+	data, err := readBytes(r, 4)
+	if err != nil {
+		return 0, err
+	}
+	return ByteOrder.Uint32(data), nil
+}
+
+func readUint64(r io.Reader) (uint64, error) {
+	data, err := readBytes(r, 8)
+	if err != nil {
+		return 0, err
+	}
+	return ByteOrder.Uint64(data), nil
+}
+
+// readBytes reads exactly n bytes, a short read is an error.
+func readBytes(r io.Reader, n int) ([]byte, error) {
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,525 @@
+package format
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContainerHeaderRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{"", "huffman", strings.Repeat("a", MAX_ALGORITHM_LEN)} {
+		var buf bytes.Buffer
+		if err := WriteContainerHeader(&buf, ContainerHeader{Algorithm: algorithm}); err != nil {
+			t.Fatalf("failed to write %q: %v", algorithm, err)
+		}
+		if buf.Len() != ContainerHeaderLen(algorithm) {
+			t.Fatalf("expected %d bytes, got %d", ContainerHeaderLen(algorithm), buf.Len())
+		}
+
+		header, err := ReadContainerHeader(&buf)
+		if err != nil {
+			t.Fatalf("failed to read %q: %v", algorithm, err)
+		}
+		if header.Algorithm != algorithm || header.Version != CURRENT_VERSION {
+			t.Fatalf("expected %q version %d, got %q version %d", algorithm, CURRENT_VERSION, header.Algorithm, header.Version)
+		}
+	}
+
+	if err := WriteContainerHeader(&bytes.Buffer{}, ContainerHeader{Algorithm: strings.Repeat("a", MAX_ALGORITHM_LEN+1)}); err == nil {
+		t.Fatal("an algorithm name above the limit should fail")
+	}
+}
+
+func TestContainerHeaderRejectsBadInput(t *testing.T) {
+	notAnArchive := (&ErrNotAnArchive{}).Error()
+
+	var future bytes.Buffer
+	WriteContainerHeader(&future, ContainerHeader{Version: CURRENT_VERSION + 1, Algorithm: "huffman"})
+
+	var legacy bytes.Buffer
+	legacy.WriteByte(7)
+	legacy.WriteString("huffman")
+
+	tests := []struct {
+		name     string
+		input    []byte
+		expected string
+	}{
+		{"empty", nil, notAnArchive},
+		{"short", []byte("SQ"), notAnArchive},
+		{"random", []byte("PK\x03\x04 some zip data"), notAnArchive},
+		{"version 1", legacy.Bytes(), notAnArchive},
+		{"future version", future.Bytes(), fmt.Sprintf("unsupported archive version %d", CURRENT_VERSION+1)},
+		{"missing version", []byte(MAGIC), "failed to read"},
+	}
+
+	for _, test := range tests {
+		_, err := ReadContainerHeader(bytes.NewReader(test.input))
+		if err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Fatalf("%s: expected an error containing %q, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+func TestNotAnArchiveError(t *testing.T) {
+	_, err := ReadContainerHeader(bytes.NewReader([]byte("PK\x03\x04 some zip data")))
+
+	var notAnArchive *ErrNotAnArchive
+	if !errors.As(err, &notAnArchive) {
+		t.Fatalf("expected *ErrNotAnArchive, got %v", err)
+	}
+	if string(notAnArchive.Found) != "PK\x03\x04" {
+		t.Fatalf("expected the first bytes of the input, got %q", notAnArchive.Found)
+	}
+}
+
+func TestUnsupportedVersionError(t *testing.T) {
+	for _, version := range []uint16{0, VERSION_1, CURRENT_VERSION + 1} {
+		var header bytes.Buffer
+		header.WriteString(MAGIC)
+		writeUint16(&header, version)
+		header.WriteByte(7)
+		header.WriteString("huffman")
+
+		_, err := ReadContainerHeader(&header)
+		var unsupported *ErrUnsupportedVersion
+		if !errors.As(err, &unsupported) {
+			t.Fatalf("version %d: expected *ErrUnsupportedVersion, got %v", version, err)
+		}
+		if unsupported.Got != version || unsupported.Max != CURRENT_VERSION {
+			t.Fatalf("version %d: unexpected %+v", version, unsupported)
+		}
+	}
+}
+
+func TestReadLegacyHeader(t *testing.T) {
+	var legacy bytes.Buffer
+	legacy.WriteByte(7)
+	legacy.WriteString("huffman")
+	legacy.WriteString("payload")
+
+	header, err := ReadLegacyHeader(&legacy)
+	if err != nil {
+		t.Fatalf("failed to read the header: %v", err)
+	}
+	if header.Version != VERSION_1 || header.Algorithm != "huffman" {
+		t.Fatalf("unexpected header %+v", header)
+	}
+	if legacy.String() != "payload" {
+		t.Fatalf("expected the payload to follow the header, got %q", legacy.String())
+	}
+
+	if _, err := ReadLegacyHeader(bytes.NewReader([]byte{7, 'h'})); err == nil {
+		t.Fatal("expected an error for a truncated header")
+	}
+}
+
+func TestCodeTableRoundTrip(t *testing.T) {
+	tables := []CodeTable{
+		{},
+		{'a': "0"},
+		{'a': "0", 'b': "10", 'c': "11"},
+		{'x': "10110011", 'y': "101100110", 0x10FFFF: strings.Repeat("1", MAX_CODE_BITS)},
+	}
+
+	for _, table := range tables {
+		var buf bytes.Buffer
+		if err := WriteCodeTable(&buf, table); err != nil {
+			t.Fatalf("failed to write %v: %v", table, err)
+		}
+
+		decoded, err := ReadCodeTable(&buf)
+		if err != nil {
+			t.Fatalf("failed to read %v: %v", table, err)
+		}
+		if !reflect.DeepEqual(decoded, table) {
+			t.Fatalf("expected %v, got %v", table, decoded)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("%d bytes left after reading the table", buf.Len())
+		}
+	}
+}
+
+func TestCodeTableIsDeterministic(t *testing.T) {
+	table := CodeTable{'c': "11", 'a': "0", 'b': "10"}
+
+	var first, second bytes.Buffer
+	WriteCodeTable(&first, table)
+	WriteCodeTable(&second, table)
+
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Fatal("the same table should always produce the same bytes")
+	}
+}
+
+func TestCodeTableRejectsInvalidCodes(t *testing.T) {
+	if err := WriteCodeTable(&bytes.Buffer{}, CodeTable{'a': strings.Repeat("0", MAX_CODE_BITS+1)}); err == nil {
+		t.Fatal("a code above the limit should fail")
+	}
+	if err := WriteCodeTable(&bytes.Buffer{}, CodeTable{'a': "012"}); err == nil {
+		t.Fatal("a code with a character other than 0 or 1 should fail")
+	}
+}
+
+func TestCanonicalCodes(t *testing.T) {
+	codes, err := CanonicalCodes(map[rune]int{'a': 2, 'b': 1, 'c': 3, 'd': 3})
+	if err != nil {
+		t.Fatalf("failed to assign the codes: %v", err)
+	}
+	expected := CodeTable{'b': "0", 'a': "10", 'c': "110", 'd': "111"}
+	if !reflect.DeepEqual(codes, expected) {
+		t.Fatalf("expected %v, got %v", expected, codes)
+	}
+
+	for _, lengths := range []map[rune]int{{'a': 1, 'b': 1, 'c': 1}, {'a': 0}, {'a': MAX_CODE_BITS + 1}} {
+		if _, err := CanonicalCodes(lengths); err == nil {
+			t.Fatalf("lengths %v should fail", lengths)
+		}
+	}
+}
+
+func TestCodeLengthsRoundTrip(t *testing.T) {
+	deep := map[rune]int{}
+	for symbol := 0; symbol < 100; symbol++ {
+		deep[rune(symbol)] = symbol + 1
+	}
+	deep[100] = 100
+
+	for _, lengths := range []map[rune]int{{}, {'a': 1}, {'a': 2, 'b': 1, 'c': 3, 'd': 3}, deep} {
+		table, err := CanonicalCodes(lengths)
+		if err != nil {
+			t.Fatalf("failed to assign the codes of %v: %v", lengths, err)
+		}
+
+		var buf bytes.Buffer
+		if err := WriteCodeLengths(&buf, table); err != nil {
+			t.Fatalf("failed to write %v: %v", table, err)
+		}
+		if expected := 2 + 2*len(table); buf.Len() != expected {
+			t.Fatalf("expected %d bytes, got %d", expected, buf.Len())
+		}
+
+		decoded, err := ReadCodeLengths(&buf)
+		if err != nil {
+			t.Fatalf("failed to read %v: %v", table, err)
+		}
+		if !reflect.DeepEqual(decoded, table) {
+			t.Fatalf("expected %v, got %v", table, decoded)
+		}
+	}
+}
+
+func TestCodeLengthsRejectsInvalidTables(t *testing.T) {
+	if err := WriteCodeLengths(&bytes.Buffer{}, CodeTable{'a': "1", 'b': "0"}); err == nil {
+		t.Fatal("codes that are not canonical should fail")
+	}
+	if err := WriteCodeLengths(&bytes.Buffer{}, CodeTable{0x100: "0"}); err == nil {
+		t.Fatal("a symbol that is not a byte should fail")
+	}
+
+	for name, data := range map[string][]byte{
+		"oversubscribed": {3, 0, 'a', 1, 'b', 1, 'c', 1},
+		"duplicate":      {2, 0, 'a', 1, 'a', 1},
+		"too many":       {0x01, 0x01},
+	} {
+		if _, err := ReadCodeLengths(bytes.NewReader(data)); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestEntryCountRoundTrip(t *testing.T) {
+	for _, count := range []uint64{0, 1, 1 << 40, ^uint64(0)} {
+		var buf bytes.Buffer
+		if err := WriteEntryCount(&buf, count); err != nil {
+			t.Fatalf("failed to write %d: %v", count, err)
+		}
+		decoded, err := ReadEntryCount(&buf)
+		if err != nil {
+			t.Fatalf("failed to read %d: %v", count, err)
+		}
+		if decoded != count {
+			t.Fatalf("expected %d, got %d", count, decoded)
+		}
+	}
+}
+
+func TestLinkTableRoundTrip(t *testing.T) {
+	links := []EntryLink{{Entry: 1, Original: 0}, {Entry: 2, Original: 0}, {Entry: 5, Original: 3}}
+	var buf bytes.Buffer
+	if err := WriteLinkTable(&buf, links); err != nil {
+		t.Fatalf("failed to write the links: %v", err)
+	}
+	decoded, err := ReadLinkTable(&buf, 6)
+	if err != nil {
+		t.Fatalf("failed to read the links: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, links) {
+		t.Fatalf("expected %v, got %v", links, decoded)
+	}
+
+	invalid := map[string][]EntryLink{
+		"out of range":   {{Entry: 6, Original: 0}},
+		"to itself":      {{Entry: 2, Original: 2}},
+		"to a later one": {{Entry: 1, Original: 3}},
+		"not ordered":    {{Entry: 3, Original: 0}, {Entry: 2, Original: 0}},
+		"too many":       {{Entry: 1}, {Entry: 2}, {Entry: 3}, {Entry: 4}, {Entry: 5}, {Entry: 5}, {Entry: 5}},
+	}
+	for name, links := range invalid {
+		var buf bytes.Buffer
+		WriteLinkTable(&buf, links)
+		if _, err := ReadLinkTable(&buf, 6); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestEntryHeaderRoundTrip(t *testing.T) {
+	headers := []EntryHeader{
+		{Name: []byte{}, CompressedSize: 0},
+		{Name: []byte{0x01, 0xFF}, ModTime: 1700000000123456789, CompressedSize: 2},
+		{Name: []byte{0x02}, ModTime: -1, Mode: 0755, CRC32: 0xCBF43926, OriginalSize: 9, CompressedSize: 3},
+		{Name: bytes.Repeat([]byte{0xAB}, MAX_NAME_LEN), CompressedSize: ^uint64(0)},
+	}
+
+	for _, header := range headers {
+		var buf bytes.Buffer
+		if err := WriteEntryHeader(&buf, header); err != nil {
+			t.Fatalf("failed to write header: %v", err)
+		}
+		if buf.Len() != 2+len(header.Name)+ENTRY_MOD_TIME_LEN+ENTRY_MODE_LEN+ENTRY_CRC_LEN+ENTRY_ORIGINAL_SIZE_LEN+ENTRY_SIZE_LEN {
+			t.Fatalf("unexpected header size %d", buf.Len())
+		}
+
+		decoded, err := ReadEntryHeader(&buf)
+		if err != nil {
+			t.Fatalf("failed to read header: %v", err)
+		}
+		if !bytes.Equal(decoded.Name, header.Name) || decoded.CompressedSize != header.CompressedSize || decoded.ModTime != header.ModTime || decoded.Mode != header.Mode || decoded.CRC32 != header.CRC32 || decoded.OriginalSize != header.OriginalSize {
+			t.Fatalf("expected %d byte name and size %d, got %d byte name and size %d",
+				len(header.Name), header.CompressedSize, len(decoded.Name), decoded.CompressedSize)
+		}
+	}
+
+	if err := WriteEntryHeader(&bytes.Buffer{}, EntryHeader{Name: make([]byte, MAX_NAME_LEN+1)}); err == nil {
+		t.Fatal("a name above the limit should fail")
+	}
+}
+
+func TestEntryMarkerRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	WriteEntryMarker(&buf, true)
+	WriteEntryMarker(&buf, false)
+	if !bytes.Equal(buf.Bytes(), []byte{ENTRY_MARKER_NEXT, ENTRY_MARKER_END}) {
+		t.Fatalf("unexpected markers %v", buf.Bytes())
+	}
+
+	for _, expected := range []bool{true, false} {
+		next, err := ReadEntryMarker(&buf)
+		if err != nil {
+			t.Fatalf("failed to read marker: %v", err)
+		}
+		if next != expected {
+			t.Fatalf("expected %v, got %v", expected, next)
+		}
+	}
+
+	if _, err := ReadEntryMarker(bytes.NewReader([]byte{7})); err == nil {
+		t.Fatal("an unknown marker should fail")
+	}
+}
+
+func TestGroupHeaderRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	WriteGroupHeader(&buf, "store")
+	WriteEntryMarker(&buf, false)
+	if !bytes.Equal(buf.Bytes(), []byte{ENTRY_MARKER_NEXT, 5, 's', 't', 'o', 'r', 'e', ENTRY_MARKER_END}) {
+		t.Fatalf("unexpected groups %v", buf.Bytes())
+	}
+
+	algorithm, next, err := ReadGroupHeader(&buf)
+	if err != nil || !next || algorithm != "store" {
+		t.Fatalf("expected the store group, got %q %v (%v)", algorithm, next, err)
+	}
+	if _, next, err := ReadGroupHeader(&buf); err != nil || next {
+		t.Fatalf("expected the end of the groups, got %v (%v)", next, err)
+	}
+}
+
+func TestLayoutIsLittleEndian(t *testing.T) {
+	var buf bytes.Buffer
+	WriteContainerHeader(&buf, ContainerHeader{Algorithm: "hf"})
+	WriteCodeLengths(&buf, CodeTable{'a': "0"})
+	WriteEntryCount(&buf, 1)
+	WriteLinkTable(&buf, nil)
+	WriteEntryHeader(&buf, EntryHeader{Name: []byte{0xAA}, OriginalSize: 0x0304, CompressedSize: 0x0102})
+
+	expected := []byte{
+		'S', 'Q', 'Z', 'P', 4, 0, // magic and version
+		2, 'h', 'f', // algorithm
+		1, 0, // one code
+		'a', 1, // symbol and bit length
+		1, 0, 0, 0, 0, 0, 0, 0, // one entry
+		0, 0, 0, 0, 0, 0, 0, 0, // no links
+		1, 0, 0xAA, // name length and name
+		0, 0, 0, 0, 0, 0, 0, 0, // modification time
+		0, 0, 0, 0, // mode
+		0, 0, 0, 0, // crc32
+		0x04, 0x03, 0, 0, 0, 0, 0, 0, // original size
+		0x02, 0x01, 0, 0, 0, 0, 0, 0, // compressed size
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Fatalf("unexpected layout:\n got %v\nwant %v", buf.Bytes(), expected)
+	}
+}
+
+func TestTruncatedInput(t *testing.T) {
+	var buf bytes.Buffer
+	WriteContainerHeader(&buf, ContainerHeader{Algorithm: "huffman"})
+	WriteCodeLengths(&buf, CodeTable{'a': "0", 'b': "1"})
+	WriteEntryHeader(&buf, EntryHeader{Name: []byte{1, 2, 3}, CompressedSize: 9})
+	data := buf.Bytes()
+
+	// every prefix of a valid stream must fail instead of returning partial values
+	for length := 0; length < len(data); length++ {
+		reader := bytes.NewReader(data[:length])
+		_, err := ReadContainerHeader(reader)
+		if err == nil {
+			_, err = ReadCodeLengths(reader)
+		}
+		if err == nil {
+			_, err = ReadEntryHeader(reader)
+		}
+		if err == nil {
+			t.Fatalf("reading %d of %d bytes should fail", length, len(data))
+		}
+	}
+}
+
+func TestChunkHeaderRoundTrip(t *testing.T) {
+	headers := []ChunkHeader{{}, {Counter: 1, Length: 272}, {Counter: ^uint64(0), Length: ^uint32(0)}}
+
+	for _, header := range headers {
+		var buf bytes.Buffer
+		if err := WriteChunkHeader(&buf, header); err != nil {
+			t.Fatalf("failed to write header: %v", err)
+		}
+		if buf.Len() != CHUNK_HEADER_LEN {
+			t.Fatalf("expected %d bytes, got %d", CHUNK_HEADER_LEN, buf.Len())
+		}
+
+		decoded, err := ReadChunkHeader(&buf)
+		if err != nil {
+			t.Fatalf("failed to read header: %v", err)
+		}
+		if decoded != header {
+			t.Fatalf("expected %+v, got %+v", header, decoded)
+		}
+	}
+
+	if _, err := ReadChunkHeader(bytes.NewReader(nil)); err != io.EOF {
+		t.Fatalf("expected io.EOF at the end of the stream, got %v", err)
+	}
+	if _, err := ReadChunkHeader(bytes.NewReader(make([]byte, CHUNK_HEADER_LEN-1))); err == nil || err == io.EOF {
+		t.Fatalf("a truncated header should be an error, got %v", err)
+	}
+}
+
+func TestBWTBlockHeader(t *testing.T) {
+	header := BWTBlockHeader{Primary: 0x0102, Length: 0x030405}
+	data := AppendBWTBlockHeader([]byte{0xFF}, header)
+
+	expected := []byte{0xFF, 0x02, 0x01, 0, 0, 0x05, 0x04, 0x03, 0}
+	if !bytes.Equal(data, expected) {
+		t.Fatalf("unexpected layout:\n got %v\nwant %v", data, expected)
+	}
+	if decoded := ParseBWTBlockHeader(data[1:]); decoded != header {
+		t.Fatalf("expected %+v, got %+v", header, decoded)
+	}
+}
+
+func TestFrequencyTableRoundTrip(t *testing.T) {
+	full := FrequencyTable{}
+	for i := range full {
+		full[i] = uint32(i*i + 1)
+	}
+	sparse := FrequencyTable{}
+	sparse['a'] = 3
+	sparse[0] = 1
+	sparse[255] = ^uint32(0)
+
+	for _, table := range []FrequencyTable{{}, sparse, full} {
+		var buf bytes.Buffer
+		if err := WriteFrequencyTable(&buf, table); err != nil {
+			t.Fatalf("failed to write table: %v", err)
+		}
+
+		decoded, err := ReadFrequencyTable(&buf)
+		if err != nil {
+			t.Fatalf("failed to read table: %v", err)
+		}
+		if decoded != table {
+			t.Fatalf("expected %v, got %v", table, decoded)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("%d bytes left after reading the table", buf.Len())
+		}
+	}
+
+	if _, err := ReadFrequencyTable(bytes.NewReader([]byte{0x01, 0x01})); err == nil {
+		t.Fatal("a table with more than 256 symbols should fail")
+	}
+}
+
+func TestKeyDerivationHeaderRoundTrip(t *testing.T) {
+	header := KeyDerivationHeader{Salt: bytes.Repeat([]byte{7}, SALT_LEN), Iterations: 100_000}
+
+	var buf bytes.Buffer
+	if err := WriteKeyDerivationHeader(&buf, header); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if buf.Len() != KEY_DERIVATION_HEADER_LEN {
+		t.Fatalf("expected %d bytes, got %d", KEY_DERIVATION_HEADER_LEN, buf.Len())
+	}
+
+	decoded, err := ReadKeyDerivationHeader(&buf)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, header) {
+		t.Fatalf("expected %+v, got %+v", header, decoded)
+	}
+
+	if err := WriteKeyDerivationHeader(&bytes.Buffer{}, KeyDerivationHeader{Salt: []byte{1}}); err == nil {
+		t.Fatal("a short salt should fail")
+	}
+}
+
+func TestArgon2HeaderRoundTrip(t *testing.T) {
+	header := Argon2Header{Salt: bytes.Repeat([]byte{7}, SALT_LEN), Time: 3, Memory: 64 * 1024, Threads: 4}
+
+	var buf bytes.Buffer
+	if err := WriteArgon2Header(&buf, header); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if buf.Len() != ARGON2_HEADER_LEN {
+		t.Fatalf("expected %d bytes, got %d", ARGON2_HEADER_LEN, buf.Len())
+	}
+
+	decoded, err := ReadArgon2Header(&buf)
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, header) {
+		t.Fatalf("expected %+v, got %+v", header, decoded)
+	}
+
+	if err := WriteArgon2Header(&bytes.Buffer{}, Argon2Header{Salt: []byte{1}}); err == nil {
+		t.Fatal("a short salt should fail")
+	}
+}
@@ -1,126 +1,373 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"errors"
 	"file-compressor/compressor"
 	"file-compressor/constants"
 	"file-compressor/encryption"
+	"file-compressor/metrics"
+	"file-compressor/squirrelzip"
 	"file-compressor/utils"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
-	"strings"
+	"os/signal"
 	"time"
 )
 
+// handleDecompress extracts the archive of options. It is read from stdin when
+// options.Archive is utils.STDIO. jsonOutput prints a utils.RunReport instead of the messages.
+func handleDecompress(ctx context.Context, options squirrelzip.Options, bar *utils.ProgressBar, jsonOutput bool) {
+	if options.Archive == utils.STDIO {
+		// hide the Seek of os.Stdin, a pipe can only be read once
+		options.Archive = ""
+		options.Input = struct{ io.Reader }{os.Stdin}
+	}
 
-func handleDecompress(fileName, outputDir, password string) {
-	encryptedFile, err := os.Open(fileName)
+	result, err := squirrelzip.DecompressArchive(ctx, options)
+	bar.Clear()
+	if jsonOutput {
+		// the progress only reports the extracted sizes, the compressed ones are listed from
+		// the archive, a pipe cannot be read again
+		if err == nil && options.Archive != "" {
+			listing := options.Encryption
+			listing.Metrics = nil
+			if entries, err := compressor.ListArchive(options.Archive, options.Password, listing); err == nil {
+				result.Stats.SetEntrySizes(entries)
+			}
+		}
+		printReport(utils.NewRunReport(utils.DECOMPRESS, result.Stats, result.Paths), result.Warnings, err)
+		if err != nil {
+			os.Exit(-1)
+		}
+		return
+	}
+	for _, warning := range result.Warnings {
+		utils.ColorPrint(utils.YELLOW, "Warning: "+warning+"\n")
+	}
 	if err != nil {
-		utils.ColorPrint(utils.RED, fmt.Sprintf(constants.FILE_OPEN_ERROR, err.Error()))
+		printError(err)
 		os.Exit(-1)
 	}
 
-	defer encryptedFile.Close()
+	utils.ColorPrint(utils.GREY, result.Stats.Summary()+"\n")
+	for _, path := range result.Paths {
+		utils.ColorPrint(utils.GREEN, "Output file: "+path+"\n")
+	}
+}
 
-	decryptedFilePath := fileName + ".decrypted"
-	decryptedFile, err := os.Create(decryptedFilePath)
+func handleVerify(ctx context.Context, fileName, password string, options encryption.EncryptionOptions, jsonOutput bool) {
+	report, err := compressor.VerifyArchiveReport(ctx, fileName, password, options)
 	if err != nil {
-		utils.ColorPrint(utils.RED, fmt.Sprintf(constants.FILE_CREATE_ERROR, err.Error())+"\n")
-		os.Exit(-1)
+		report.Structural = err.Error()
+		report.Finish()
 	}
 
-	err = encryption.DecryptStream(encryptedFile, decryptedFile, password)
-	if err != nil {
-		utils.ColorPrint(utils.RED, fmt.Sprintf(constants.FAILED_TO_DECRYPT, err.Error())+"\n")
-		//release file
-		decryptedFile.Close()
-		// delete the decrypted file
-		utils.SafeDeleteFile(decryptedFilePath)
-		os.Exit(-1)
+	if jsonOutput {
+		data, err := report.JSON()
+		if err != nil {
+			utils.ColorPrint(utils.RED, err.Error()+"\n")
+			os.Exit(utils.EXIT_VERIFY_UNREADABLE)
+		}
+		fmt.Println(string(data))
+	} else if report.Status == utils.VERIFY_OK {
+		utils.ColorPrint(utils.GREEN, report.Table())
+	} else {
+		utils.ColorPrint(utils.RED, report.Table())
 	}
 
-	decryptedFile.Close()
+	os.Exit(report.ExitCode())
+}
 
-	paths, err := compressor.Decompress(decryptedFilePath, outputDir)
+// handleList prints the entries of an archive without extracting it.
+func handleList(fileName, password string, options encryption.EncryptionOptions, jsonOutput bool) {
+	entries, err := compressor.ListArchive(fileName, password, options)
 	if err != nil {
 		utils.ColorPrint(utils.RED, err.Error()+"\n")
-		// delete the decrypted file
-		//utils.SafeDeleteFile(decryptedFilePath)
 		os.Exit(-1)
 	}
 
-	// delete the decrypted file
-	utils.SafeDeleteFile(decryptedFilePath)
+	if jsonOutput {
+		data, err := utils.EntriesJSON(entries)
+		if err != nil {
+			utils.ColorPrint(utils.RED, err.Error()+"\n")
+			os.Exit(-1)
+		}
+		fmt.Println(string(data))
+		os.Exit(0)
+	}
 
-	for _, path := range paths {
-		utils.ColorPrint(utils.GREEN, "Output file: "+path+"\n")
+	if algorithm := utils.EntriesAlgorithm(entries); algorithm != "" {
+		utils.ColorPrint(utils.GREY, "Algorithm: "+algorithm+"\n")
+	} else if len(entries) > 0 {
+		utils.ColorPrint(utils.GREY, "Algorithm: "+string(utils.AUTO)+"\n")
 	}
+	fmt.Print(utils.EntryTable(entries))
 }
 
-func handleCompress(fileNames []string, outputDir, password, algorithm string) {
-	outputPath, fileMeta, err := compressor.Compress(fileNames, outputDir, algorithm)
+// handleCompress creates the archive of options. The input is read from stdin when
+// options.Inputs is utils.STDIO, and the archive is written to stdout when options.OutputDir
+// is. jsonOutput prints a utils.RunReport instead of the messages.
+func handleCompress(ctx context.Context, options squirrelzip.Options, bar *utils.ProgressBar, jsonOutput bool) {
+	if len(options.Inputs) == 1 && options.Inputs[0] == utils.STDIO {
+		stdin, err := readStdin()
+		if err != nil {
+			exitWithError(utils.COMPRESS, err, jsonOutput, -1)
+		}
+		defer stdin.Close()
+
+		reader, err := stdin.Reader()
+		if err != nil {
+			exitWithError(utils.COMPRESS, err, jsonOutput, -1)
+		}
+		options.Inputs = nil
+		options.Files = []utils.FileData{{Name: utils.STDIN_NAME, Size: stdin.Len(), Reader: reader, ModTime: time.Now()}}
+	}
+	if options.OutputDir == utils.STDIO {
+		options.OutputDir = ""
+		options.Output = os.Stdout
+	}
+
+	result, err := squirrelzip.CompressFiles(ctx, options)
+	bar.Clear()
+	if jsonOutput {
+		outputs := []string{}
+		if err == nil && result.Path != "" {
+			outputs = append(outputs, result.Path)
+			// the progress only reports the original sizes, the compressed ones are listed
+			// from the archive
+			listing := options.Encryption
+			listing.Metrics = nil
+			if entries, err := compressor.ListArchive(result.Path, options.Password, listing); err == nil {
+				result.Stats.SetEntrySizes(entries)
+			}
+		}
+		printReport(utils.NewRunReport(utils.COMPRESS, result.Stats, outputs), result.Warnings, err)
+		if err != nil {
+			os.Exit(-1)
+		}
+		return
+	}
+	for _, warning := range result.Warnings {
+		utils.ColorPrint(utils.YELLOW, "Warning: "+warning+"\n")
+	}
 	if err != nil {
-		utils.ColorPrint(utils.RED, err.Error()+"\n")
-		utils.SafeDeleteFile(outputPath)
+		printError(err)
 		os.Exit(-1)
 	}
 
-	fileMeta.PrintFileInfo()
-	fileMeta.PrintCompressionRatio()
+	ratio := result.Stats.Ratio()
+	ratio.PrintFileInfo()
+	ratio.PrintCompressionRatio()
+	utils.ColorPrint(utils.GREY, result.Stats.Summary()+"\n")
 
-	compressedFile, err := os.Open(outputPath)
-	if err != nil {
-		utils.ColorPrint(utils.RED, fmt.Sprintf(constants.FILE_OPEN_ERROR, err.Error())+"\n")
-		os.Exit(-1)
+	for _, chosen := range result.Algorithms {
+		utils.ColorPrint(utils.GREY, fmt.Sprintf("%-8s %s\n", chosen.Algorithm, chosen.Name))
+	}
+	if result.ExcludedFiles > 0 || result.ExcludedDirs > 0 {
+		utils.ColorPrint(utils.GREY, fmt.Sprintf("Excluded: %d files, %d directories\n", result.ExcludedFiles, result.ExcludedDirs))
 	}
 
-	fileName := outputPath
-	fileExt := filepath.Ext(fileName)
-	fileName = strings.TrimSuffix(fileName, fileExt)
+	if result.Path != "" {
+		utils.ColorPrint(utils.GREEN, "Output file: "+result.Path+"\n")
+	}
+}
 
-	finalFileName := utils.InvalidateFileName(fileName+".sq", "")
+// readStdin buffers stdin, because the codes of a file are built in a first pass over it
+// before it is compressed in a second one. Large inputs spill to a temporary file.
+func readStdin() (*utils.SpillBuffer, error) {
+	buffer := utils.NewSpillBuffer(utils.DEFAULT_SPILL_THRESHOLD)
+	if _, err := io.Copy(buffer, os.Stdin); err != nil {
+		buffer.Close()
+		return nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	return buffer, nil
+}
 
-	finalFile, err := os.Create(finalFileName)
+// printError prints err, or only that the run was interrupted when Ctrl+C canceled it.
+// The partial output that was removed is listed by the warnings printed before.
+func printError(err error) {
+	if errors.Is(err, context.Canceled) {
+		utils.ColorPrint(utils.RED, "Interrupted, the partial output was removed\n")
+		return
+	}
+	utils.ColorPrint(utils.RED, err.Error()+"\n")
+}
+
+// printReport prints report as JSON on stdout, together with the warnings and the error of the
+// run. It is the only output of -json, scripts read it instead of the colored messages.
+func printReport(report utils.RunReport, warnings []string, err error) {
+	report.Warnings = warnings
 	if err != nil {
-		utils.ColorPrint(utils.RED, fmt.Sprintf(constants.FILE_CREATE_ERROR, err.Error())+"\n")
-		//release file
-		compressedFile.Close()
-		utils.SafeDeleteFile(outputPath)
+		report.Error = err.Error()
+	}
+	data, marshalErr := report.JSON()
+	if marshalErr != nil {
+		fmt.Fprintln(os.Stderr, marshalErr.Error())
 		os.Exit(-1)
 	}
+	fmt.Println(string(data))
+}
+
+// exitWithError reports an error that ended a compression or a decompression before it ran, as
+// a utils.RunReport when jsonOutput is set, and exits with code.
+func exitWithError(mode utils.MODE, err error, jsonOutput bool, code int) {
+	if jsonOutput {
+		printReport(utils.NewRunReport(mode, utils.CompressionStats{}, nil), nil, err)
+	} else {
+		printError(err)
+	}
+	os.Exit(code)
+}
 
-	err = encryption.EncryptStream(compressedFile, finalFile, password)
+// handleJoin joins the parts of a split file, drawing the progress unless quiet is set.
+func handleJoin(descriptorPath, outputDir string, quiet bool) {
+	outputPath, err := utils.JoinParts(descriptorPath, outputDir, !quiet)
 	if err != nil {
-		utils.ColorPrint(utils.RED, fmt.Sprintf(constants.FAILED_TO_ENCRYPT, err.Error())+"\n")
-		//release file
-		compressedFile.Close()
-		finalFile.Close()
-		utils.SafeDeleteFile(outputPath)
-		utils.SafeDeleteFile(finalFileName)
+		utils.ColorPrint(utils.RED, err.Error()+"\n")
 		os.Exit(-1)
 	}
 
-	utils.ColorPrint(utils.GREEN, "Output file: "+finalFileName+"\n")
-
-	compressedFile.Close()
-	// delete the compressed file
-	utils.SafeDeleteFile(outputPath)
+	utils.ColorPrint(utils.GREEN, "Output file: "+outputPath+"\n")
 }
 
-
 func main() {
 
 	startTime := time.Now()
 
 	//cli arguments
-	filenameStrs, outputDir, password, mode, algorithm := utils.ParseCLI()
+	config := utils.ParseCLI()
 
-	if mode == utils.DECOMPRESS {
-		handleDecompress(filenameStrs[0], outputDir, password)
-	} else {
-		handleCompress(filenameStrs, outputDir, password, algorithm)
+	// metrics are only collected when they will be printed
+	var collector *metrics.Expvar
+	var recorder metrics.Metrics = metrics.Nop{}
+	if config.Verbose {
+		collector = metrics.NewExpvar("squirrelzip")
+		recorder = collector
+	}
+
+	// the limiters are shared by the whole run, a zero rate only measures the throughput
+	readLimiter := utils.NewRateLimiter(config.ReadRate)
+	writeLimiter := utils.NewRateLimiter(config.WriteRate)
+
+	// the archive written to stdout must not be mixed with the messages
+	if config.OutputDir == utils.STDIO {
+		utils.Messages = utils.NewPrinter(os.Stderr, config.NoColor)
+	}
+	// the document printed by -json replaces the messages of a compression or a decompression
+	if config.JSON && (config.Mode == utils.COMPRESS || config.Mode == utils.DECOMPRESS) {
+		utils.Messages = utils.NewPrinter(io.Discard, true)
+	}
+
+	// the progress bar is only drawn on a terminal, redirected output stays clean
+	bar := utils.NewTerminalProgressBar(config.Quiet)
+
+	// Ctrl+C stops at the next chunk and removes the partial output
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// a signed archive is only read with the key of its signature
+	var verifyKey ed25519.PublicKey
+	if config.VerifyKey != "" {
+		var err error
+		verifyKey, err = encryption.ReadVerifyKey(config.VerifyKey)
+		if err != nil {
+			exitWithError(config.Mode, err, config.JSON, 1)
+		}
+	}
+
+	// the metrics, the rate limits and the progress of a compression or a decompression
+	progress := []utils.Option{utils.WithMetrics(recorder), utils.WithRateLimits(readLimiter, writeLimiter), utils.WithProgressEvents(bar.Events(), 0)}
+
+	switch config.Mode {
+	case utils.DECOMPRESS:
+		options := squirrelzip.Options{
+			Archive:    config.Files[0],
+			OutputDir:  config.OutputDir,
+			Password:   config.Password,
+			Entries:    config.Entries,
+			Encryption: encryption.EncryptionOptions{Metrics: recorder, KeyFile: config.KeyFile},
+			Codec: append(progress,
+				utils.WithSplitOutput(config.SplitSize),
+				utils.WithMaxPath(config.MaxPathDepth, config.MaxPathLength),
+				utils.WithTruncateLongNames(config.TruncateLongNames),
+				utils.WithNoPreserveAttrs(config.NoPreserveAttrs),
+				utils.WithOverwrite(config.Overwrite),
+				utils.WithBufferSize(config.BufferSize),
+				utils.WithVerifyKey(verifyKey),
+			),
+		}
+		handleDecompress(ctx, options, bar, config.JSON)
+	case utils.JOIN:
+		handleJoin(config.Files[0], config.OutputDir, config.Quiet)
+	case utils.VERIFY:
+		handleVerify(ctx, config.Files[0], config.Password, encryption.EncryptionOptions{KeyFile: config.KeyFile, VerifyKey: verifyKey}, config.JSON)
+	case utils.LIST:
+		handleList(config.Files[0], config.Password, encryption.EncryptionOptions{KeyFile: config.KeyFile, VerifyKey: verifyKey}, config.JSON)
+	default:
+		suite := encryption.DEFAULT_CIPHER_SUITE
+		if config.Cipher != "" {
+			var err error
+			suite, err = encryption.ParseCipherSuite(config.Cipher)
+			if err != nil {
+				exitWithError(config.Mode, err, config.JSON, 1)
+			}
+		}
+		kdf := encryption.DEFAULT_KDF
+		if config.KDF != "" {
+			var err error
+			kdf, err = encryption.ParseKDF(config.KDF)
+			if err != nil {
+				exitWithError(config.Mode, err, config.JSON, 1)
+			}
+		}
+		// a missing or damaged key file is reported before anything is compressed
+		if config.KeyFile != "" {
+			if _, err := encryption.ReadKeyFile(config.KeyFile); err != nil {
+				exitWithError(config.Mode, err, config.JSON, 1)
+			}
+		}
+		var signKey ed25519.PrivateKey
+		if config.SignKey != "" {
+			var err error
+			signKey, err = encryption.ReadSigningKey(config.SignKey)
+			if err != nil {
+				exitWithError(config.Mode, err, config.JSON, 1)
+			}
+		}
+		options := squirrelzip.Options{
+			Inputs:     config.Files,
+			OutputDir:  config.OutputDir,
+			Name:       config.ArchiveName,
+			Password:   config.Password,
+			Algorithm:  config.Algorithm,
+			BufferSize: config.BufferSize,
+			Encryption: encryption.EncryptionOptions{Metrics: recorder, CipherSuite: suite, KDF: kdf, KeyFile: config.KeyFile, HMAC: config.HMAC},
+			Codec: append(progress,
+				utils.WithThreads(config.Threads),
+				utils.WithKeepPaths(config.KeepPaths),
+				utils.WithExclude(config.Exclude),
+				utils.WithNoSolidNames(config.NoSolidNames),
+				utils.WithLevel(config.Level),
+				utils.WithArchiveFormat(config.Format),
+				utils.WithSignKey(signKey),
+			),
+		}
+		handleCompress(ctx, options, bar, config.JSON)
 	}
 
 	endTime := time.Now()
 	utils.ColorPrint(utils.GREEN, "Time taken: "+utils.TimeTrack(startTime, endTime)+"\n")
+
+	if config.Verbose {
+		utils.ColorPrint(utils.GREY, fmt.Sprintf("Average read rate: %s/s (%s)\n", utils.FileSize(uint64(readLimiter.AverageRate())), utils.FileSize(uint64(readLimiter.Total()))))
+		utils.ColorPrint(utils.GREY, fmt.Sprintf("Average write rate: %s/s (%s)\n", utils.FileSize(uint64(writeLimiter.AverageRate())), utils.FileSize(uint64(writeLimiter.Total()))))
+	}
+
+	if collector != nil {
+		utils.ColorPrint(utils.GREY, "Metrics:\n")
+		collector.Dump(utils.Messages)
+	}
 }
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"file-compressor/constants"
+	"file-compressor/encryption"
+	"file-compressor/squirrelzip"
+	"file-compressor/utils"
+)
+
+// withPipes runs fn with os.Stdin reading input and returns what fn wrote to os.Stdout. Both
+// are real pipes, so nothing can seek in them.
+func withPipes(t *testing.T, input []byte, fn func()) []byte {
+	t.Helper()
+
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create the stdin pipe: %v", err)
+	}
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create the stdout pipe: %v", err)
+	}
+
+	stdin, stdout, messages := os.Stdin, os.Stdout, utils.Messages
+	os.Stdin, os.Stdout, utils.Messages = stdinReader, stdoutWriter, utils.NewPrinter(io.Discard, true)
+	defer func() {
+		os.Stdin, os.Stdout, utils.Messages = stdin, stdout, messages
+	}()
+
+	go func() {
+		stdinWriter.Write(input)
+		stdinWriter.Close()
+	}()
+	output := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(stdoutReader)
+		output <- data
+	}()
+
+	fn()
+	stdoutWriter.Close()
+	stdinReader.Close()
+	return <-output
+}
+
+func TestStdinStdoutPipeline(t *testing.T) {
+	content := []byte(strings.Repeat("cat file.txt | sq -c - -o - | ssh host \"cat > archive.sq\"\n", 5000))
+
+	for _, algorithm := range []string{string(utils.HUFFMAN), string(utils.LZ4)} {
+		t.Run(algorithm, func(t *testing.T) {
+			ctx := context.Background()
+			outputDir := t.TempDir()
+
+			archive := withPipes(t, content, func() {
+				handleCompress(ctx, squirrelzip.Options{Inputs: []string{utils.STDIO}, OutputDir: utils.STDIO, Password: "pipeline", Algorithm: algorithm, Codec: []utils.Option{utils.WithThreads(1)}}, nil, false)
+			})
+			if len(archive) == 0 {
+				t.Fatal("expected the archive on stdout")
+			}
+			entries, err := os.ReadDir(outputDir)
+			if err != nil || len(entries) != 0 {
+				t.Fatalf("expected no file next to the archive, got %v (%v)", entries, err)
+			}
+
+			written := withPipes(t, archive, func() {
+				handleDecompress(ctx, squirrelzip.Options{Archive: utils.STDIO, OutputDir: outputDir, Password: "pipeline"}, nil, false)
+			})
+			if len(written) != 0 {
+				t.Fatalf("expected nothing on stdout while extracting, got %d bytes", len(written))
+			}
+
+			extracted, err := os.ReadFile(filepath.Join(outputDir, utils.STDIN_NAME))
+			if err != nil {
+				t.Fatalf("failed to read the extracted file: %v", err)
+			}
+			if !bytes.Equal(content, extracted) {
+				t.Fatal("the extracted file does not match stdin")
+			}
+		})
+	}
+}
+
+var update = flag.Bool("update", false, "rewrite the golden files of the JSON reports")
+
+// checkGolden compares the report printed by -json to testdata/name, after removing what
+// changes from run to run: the elapsed time and the directories of the outputs.
+func checkGolden(t *testing.T, name string, printed []byte) {
+	t.Helper()
+
+	report := utils.RunReport{}
+	if err := json.Unmarshal(printed, &report); err != nil {
+		t.Fatalf("expected a single JSON document, got %q: %v", printed, err)
+	}
+	report.Elapsed = 0
+	for i, output := range report.Outputs {
+		report.Outputs[i] = filepath.Base(output)
+	}
+	data, err := report.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	golden := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(golden, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read the golden file, run the test with -update to create it: %v", err)
+	}
+	if string(expected) != string(data)+"\n" {
+		t.Fatalf("the report does not match %s:\n%s", golden, data)
+	}
+}
+
+func TestJSONReports(t *testing.T) {
+	content := []byte(strings.Repeat("squirrels bury acorns\n", 500))
+	ctx := context.Background()
+	archiveDir := t.TempDir()
+
+	printed := withPipes(t, content, func() {
+		handleCompress(ctx, squirrelzip.Options{Inputs: []string{utils.STDIO}, OutputDir: archiveDir, Name: "acorns", Algorithm: string(utils.HUFFMAN), Encryption: encryption.EncryptionOptions{KDFIterations: 1_000}, Codec: []utils.Option{utils.WithThreads(1)}}, nil, true)
+	})
+	checkGolden(t, "compress.golden", printed)
+
+	outputDir := t.TempDir()
+	printed = withPipes(t, nil, func() {
+		handleDecompress(ctx, squirrelzip.Options{Archive: filepath.Join(archiveDir, "acorns"+constants.ARCHIVE_FILE_EXT), OutputDir: outputDir}, nil, true)
+	})
+	checkGolden(t, "decompress.golden", printed)
+}
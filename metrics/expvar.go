@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the duration histograms.
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10, 60}
+
+// Histogram is a cumulative histogram with fixed bucket bounds.
+type Histogram struct {
+	mu      sync.Mutex
+	bounds  []float64
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, buckets: make([]uint64, len(bounds))}
+}
+
+// Observe records a value.
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+// Count returns the number of observed values.
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// String implements expvar.Var.
+func (h *Histogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buckets := make(map[string]uint64, len(h.bounds))
+	for i, bound := range h.bounds {
+		buckets[fmt.Sprintf("%g", bound)] = h.buckets[i]
+	}
+
+	data, _ := json.Marshal(struct {
+		Count   uint64            `json:"count"`
+		Sum     float64           `json:"sum"`
+		Buckets map[string]uint64 `json:"buckets"`
+	}{h.count, h.sum, buckets})
+
+	return string(data)
+}
+
+// Expvar is a Metrics implementation backed by an expvar.Map, so the values show up
+// under /debug/vars when the embedding service serves expvar.
+type Expvar struct {
+	mu   sync.Mutex
+	vars *expvar.Map
+}
+
+// NewExpvar creates an Expvar and publishes it under name. Like expvar.Publish it
+// panics if name is already in use; use an empty name to keep it unpublished.
+func NewExpvar(name string) *Expvar {
+	vars := new(expvar.Map).Init()
+	if name != "" {
+		expvar.Publish(name, vars)
+	}
+	return &Expvar{vars: vars}
+}
+
+// Counter implements Metrics.
+func (e *Expvar) Counter(name string, delta int64, labels ...string) {
+	e.vars.Add(Key(name, labels...), delta)
+}
+
+// Observe implements Metrics.
+func (e *Expvar) Observe(name string, value float64, labels ...string) {
+	key := Key(name, labels...)
+
+	e.mu.Lock()
+	histogram, ok := e.vars.Get(key).(*Histogram)
+	if !ok {
+		histogram = newHistogram(DefaultBuckets)
+		e.vars.Set(key, histogram)
+	}
+	e.mu.Unlock()
+
+	histogram.Observe(value)
+}
+
+// CounterValue returns the current value of a counter, 0 if it was never incremented.
+func (e *Expvar) CounterValue(name string, labels ...string) int64 {
+	if counter, ok := e.vars.Get(Key(name, labels...)).(*expvar.Int); ok {
+		return counter.Value()
+	}
+	return 0
+}
+
+// Histogram returns the histogram for name and labels, or nil if nothing was observed.
+func (e *Expvar) Histogram(name string, labels ...string) *Histogram {
+	histogram, _ := e.vars.Get(Key(name, labels...)).(*Histogram)
+	return histogram
+}
+
+// Dump writes every metric as a "key value" line, sorted by key.
+func (e *Expvar) Dump(w io.Writer) error {
+	lines := []string{}
+	e.vars.Do(func(kv expvar.KeyValue) {
+		lines = append(lines, kv.Key+" "+kv.Value.String())
+	})
+	sort.Strings(lines)
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
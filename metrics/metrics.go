@@ -0,0 +1,132 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Metric names reported by the codecs and the encryption layer.
+const (
+	BYTES_IN       = "squirrelzip_bytes_in_total"
+	BYTES_OUT      = "squirrelzip_bytes_out_total"
+	ENTRIES        = "squirrelzip_entries_total"
+	ERRORS         = "squirrelzip_errors_total"
+	ENTRY_DURATION = "squirrelzip_entry_duration_seconds"
+)
+
+// Label names used with the metrics above.
+const (
+	LABEL_ALGORITHM = "algorithm"
+	LABEL_OPERATION = "operation"
+	LABEL_TYPE      = "type"
+)
+
+// Operations reported in the operation label.
+const (
+	OP_COMPRESS   = "compress"
+	OP_DECOMPRESS = "decompress"
+	OP_ENCRYPT    = "encrypt"
+	OP_DECRYPT    = "decrypt"
+)
+
+// Error types reported in the type label of ERRORS, see ErrorType.
+const (
+	ERROR_CANCELED = "canceled"
+	ERROR_IO       = "io"
+	ERROR_AUTH     = "auth"
+	ERROR_CORRUPT  = "corrupt"
+	ERROR_OTHER    = "other"
+)
+
+// Metrics receives Prometheus-style measurements. Labels are passed as alternating
+// name/value pairs, e.g. Counter(BYTES_IN, 42, LABEL_ALGORITHM, "huffman").
+// Implementations must be safe for concurrent use.
+type Metrics interface {
+	// Counter adds delta to the counter identified by name and labels.
+	Counter(name string, delta int64, labels ...string)
+	// Observe records value in the histogram identified by name and labels.
+	Observe(name string, value float64, labels ...string)
+}
+
+// Nop discards every measurement. It is the default when no Metrics is configured.
+type Nop struct{}
+
+func (Nop) Counter(name string, delta int64, labels ...string)   {}
+func (Nop) Observe(name string, value float64, labels ...string) {}
+
+// OrNop returns m, or Nop when m is nil.
+func OrNop(m Metrics) Metrics {
+	if m == nil {
+		return Nop{}
+	}
+	return m
+}
+
+// Key renders a metric name and its labels in the Prometheus exposition format,
+// e.g. squirrelzip_bytes_in_total{algorithm="huffman"}. Labels are sorted by name.
+func Key(name string, labels ...string) string {
+	if len(labels) < 2 {
+		return name
+	}
+
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, labels[i]+"=\""+labels[i+1]+"\"")
+	}
+	sort.Strings(pairs)
+
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// RecordEntry reports a successfully processed entry: its input and output byte counts,
+// the entry counter and the time it took.
+func RecordEntry(m Metrics, algorithm, operation string, bytesIn, bytesOut int64, duration time.Duration) {
+	labels := []string{LABEL_ALGORITHM, algorithm, LABEL_OPERATION, operation}
+	m.Counter(BYTES_IN, bytesIn, labels...)
+	m.Counter(BYTES_OUT, bytesOut, labels...)
+	m.Counter(ENTRIES, 1, labels...)
+	m.Observe(ENTRY_DURATION, duration.Seconds(), labels...)
+}
+
+// RecordError reports a failed operation, with the type of err in the type label.
+func RecordError(m Metrics, algorithm, operation string, err error) {
+	m.Counter(ERRORS, 1, LABEL_ALGORITHM, algorithm, LABEL_OPERATION, operation, LABEL_TYPE, ErrorType(operation, err))
+}
+
+// TypedError is implemented by the errors that know their type, such as the authentication
+// failures of the encryption package.
+type TypedError interface {
+	error
+	ErrorType() string
+}
+
+// ErrorType classifies the error of a failed operation for the type label: ERROR_CANCELED for
+// a canceled context, the type of a TypedError, ERROR_IO for a failed file or system call, and
+// ERROR_CORRUPT for data that ends early. Any other error of a decompression or a decryption
+// is ERROR_CORRUPT as well, reading an archive only fails on its data, and ERROR_OTHER
+// otherwise.
+func ErrorType(operation string, err error) string {
+	var typed TypedError
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	var syscallErr *os.SyscallError
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ERROR_CANCELED
+	case errors.As(err, &typed):
+		return typed.ErrorType()
+	case errors.As(err, &pathErr), errors.As(err, &linkErr), errors.As(err, &syscallErr):
+		return ERROR_IO
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return ERROR_CORRUPT
+	case operation == OP_DECOMPRESS || operation == OP_DECRYPT:
+		return ERROR_CORRUPT
+	}
+	return ERROR_OTHER
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeySortsLabels(t *testing.T) {
+	key := Key(BYTES_IN, LABEL_OPERATION, OP_COMPRESS, LABEL_ALGORITHM, "huffman")
+	expected := `squirrelzip_bytes_in_total{algorithm="huffman",operation="compress"}`
+	if key != expected {
+		t.Fatalf("expected %s, got %s", expected, key)
+	}
+
+	if Key(ENTRIES) != ENTRIES {
+		t.Fatalf("a key without labels should be the bare name, got %s", Key(ENTRIES))
+	}
+}
+
+func TestExpvarRecordEntry(t *testing.T) {
+	m := NewExpvar("")
+
+	RecordEntry(m, "huffman", OP_COMPRESS, 100, 60, 2*time.Millisecond)
+	RecordEntry(m, "huffman", OP_COMPRESS, 50, 30, 20*time.Millisecond)
+	RecordError(m, "huffman", OP_COMPRESS, &os.PathError{Op: "open", Path: "notes.txt", Err: os.ErrNotExist})
+
+	labels := []string{LABEL_ALGORITHM, "huffman", LABEL_OPERATION, OP_COMPRESS}
+	if got := m.CounterValue(BYTES_IN, labels...); got != 150 {
+		t.Fatalf("expected 150 bytes in, got %d", got)
+	}
+	if got := m.CounterValue(BYTES_OUT, labels...); got != 90 {
+		t.Fatalf("expected 90 bytes out, got %d", got)
+	}
+	if got := m.CounterValue(ENTRIES, labels...); got != 2 {
+		t.Fatalf("expected 2 entries, got %d", got)
+	}
+	if got := m.CounterValue(ERRORS, LABEL_ALGORITHM, "huffman", LABEL_OPERATION, OP_COMPRESS, LABEL_TYPE, ERROR_IO); got != 1 {
+		t.Fatalf("expected 1 error, got %d", got)
+	}
+
+	histogram := m.Histogram(ENTRY_DURATION, labels...)
+	if histogram == nil || histogram.Count() != 2 {
+		t.Fatalf("expected 2 observed durations")
+	}
+
+	var out bytes.Buffer
+	if err := m.Dump(&out); err != nil {
+		t.Fatalf("failed to dump metrics: %v", err)
+	}
+	if !strings.Contains(out.String(), Key(BYTES_IN, labels...)+" 150") {
+		t.Fatalf("dump is missing the byte counter:\n%s", out.String())
+	}
+}
+
+func TestOrNop(t *testing.T) {
+	if _, ok := OrNop(nil).(Nop); !ok {
+		t.Fatal("nil metrics should become Nop")
+	}
+	m := NewExpvar("")
+	if OrNop(m) != Metrics(m) {
+		t.Fatal("a configured metrics should be kept")
+	}
+}
+
+// typed is an error that knows its type.
+type typed string
+
+func (e typed) Error() string     { return string(e) }
+func (e typed) ErrorType() string { return ERROR_AUTH }
+
+func TestErrorType(t *testing.T) {
+	tests := []struct {
+		operation string
+		err       error
+		expected  string
+	}{
+		{OP_COMPRESS, context.Canceled, ERROR_CANCELED},
+		{OP_DECOMPRESS, fmt.Errorf("failed to read: %w", context.DeadlineExceeded), ERROR_CANCELED},
+		{OP_DECRYPT, fmt.Errorf("wrapped: %w", typed("wrong password")), ERROR_AUTH},
+		{OP_COMPRESS, &os.PathError{Op: "open", Path: "notes.txt", Err: os.ErrNotExist}, ERROR_IO},
+		{OP_COMPRESS, io.ErrUnexpectedEOF, ERROR_CORRUPT},
+		{OP_DECOMPRESS, errors.New("invalid code"), ERROR_CORRUPT},
+		{OP_COMPRESS, errors.New("output must support seeking"), ERROR_OTHER},
+	}
+
+	for _, test := range tests {
+		if got := ErrorType(test.operation, test.err); got != test.expected {
+			t.Errorf("%s %v: expected %s, got %s", test.operation, test.err, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package squirrelzip_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"file-compressor/squirrelzip"
+	"file-compressor/utils"
+)
+
+// An archive is built from data in memory and extracted again, without touching the
+// disk except for the extracted files.
+func ExampleCompressFiles() {
+	contents := map[string]string{
+		"notes.txt":      "squirrels bury nuts, squirrels find nuts",
+		"docs/readme.md": "# hello",
+	}
+
+	files := []utils.FileData{}
+	for _, name := range []string{"notes.txt", "docs/readme.md"} {
+		reader := bytes.NewReader([]byte(contents[name]))
+		files = append(files, utils.FileData{Name: name, Size: reader.Size(), Reader: reader})
+	}
+
+	archive := &bytes.Buffer{}
+	result, err := squirrelzip.CompressFiles(context.Background(), squirrelzip.Options{
+		Files:     files,
+		Output:    archive,
+		Password:  "hunter2",
+		Algorithm: string(utils.DEFLATE),
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("original size:", result.OriginalSize)
+	fmt.Println("archive written:", result.CompressedSize == uint64(archive.Len()))
+
+	outputDir, err := os.MkdirTemp("", "squirrelzip-example")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(outputDir)
+
+	_, err = squirrelzip.DecompressArchive(context.Background(), squirrelzip.Options{
+		Input:     bytes.NewReader(archive.Bytes()),
+		OutputDir: outputDir,
+		Password:  "hunter2",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	readme, _ := os.ReadFile(filepath.Join(outputDir, "docs", "readme.md"))
+	fmt.Println(string(readme))
+	// Output:
+	// original size: 47
+	// archive written: true
+	// # hello
+}
+
+// Only the entries matching Options.Entries are extracted.
+func ExampleDecompressArchive() {
+	reader := bytes.NewReader([]byte("only this one"))
+	archive := &bytes.Buffer{}
+	_, err := squirrelzip.CompressFiles(context.Background(), squirrelzip.Options{
+		Files: []utils.FileData{
+			{Name: "keep.txt", Size: reader.Size(), Reader: reader},
+			{Name: "skip.txt", Size: 4, Reader: bytes.NewReader([]byte("skip"))},
+		},
+		Output: archive,
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	outputDir, err := os.MkdirTemp("", "squirrelzip-example")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(outputDir)
+
+	result, err := squirrelzip.DecompressArchive(context.Background(), squirrelzip.Options{
+		Input:     archive,
+		OutputDir: outputDir,
+		Entries:   []string{"keep.txt"},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	for _, path := range result.Paths {
+		fmt.Println(filepath.Base(path))
+	}
+	// Output:
+	// keep.txt
+}
@@ -0,0 +1,634 @@
+// Package squirrelzip creates and extracts SquirrelZip archives. It is the API behind the
+// command line tool: nothing is printed and nothing exits the process, every failure is
+// returned as an error.
+package squirrelzip
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"file-compressor/compressor"
+	"file-compressor/compressor/bzip2"
+	"file-compressor/constants"
+	"file-compressor/encryption"
+	"file-compressor/utils"
+)
+
+var (
+	// ErrNoInput is returned by CompressFiles when neither Options.Inputs nor Options.Files is
+	// set, and by DecompressArchive when neither Options.Archive nor Options.Input is set.
+	ErrNoInput = errors.New("no input given")
+	// ErrConflictingInputs is returned when both inputs of an operation are set.
+	ErrConflictingInputs = errors.New("only one of the inputs may be given")
+	// ErrSignOutput is returned by CompressFiles when an archive written to Options.Output
+	// should be signed, only archive files are.
+	ErrSignOutput = errors.New("only an archive file can be signed, not Options.Output")
+	// ErrVerifyInput is returned by DecompressArchive when the signature of Options.Input
+	// should be verified, only the one of an Options.Archive file is.
+	ErrVerifyInput = errors.New("only the signature of an archive file can be verified, not of Options.Input")
+)
+
+// Options configures CompressFiles and DecompressArchive. The zero value of every field
+// keeps the default behavior.
+type Options struct {
+	// Inputs are the paths of the files and directories to compress.
+	Inputs []string
+	// Files are compressed from their readers instead of Inputs, so an archive can be built
+	// from data in memory.
+	Files []utils.FileData
+	// Archive is the path of the archive to extract.
+	Archive string
+	// Input is read as the archive to extract instead of Archive.
+	Input io.Reader
+	// Output receives the archive written by CompressFiles. When nil, the archive is created
+	// in OutputDir and named after the inputs, see utils.ArchiveName.
+	Output io.Writer
+	// Name is the file name of the archive created in OutputDir instead of the one derived from
+	// the inputs. constants.ARCHIVE_FILE_EXT is appended unless it ends with it already, or
+	// constants.TARGZ_FILE_EXT for an unencrypted tar.gz.
+	Name string
+	// OutputDir is the directory of the created archive or of the extracted files. Empty
+	// uses the directory of the first input or of the archive, and "." for readers.
+	OutputDir string
+	// Password encrypts the archive, empty writes it unencrypted unless a key file is set.
+	Password string
+	// Algorithm is the compression algorithm, utils.HUFFMAN when empty.
+	Algorithm string
+	// BufferSize is the size of the buffers the archive is written and read through, and the
+	// size of its encrypted chunks unless Encryption.ChunkSize is set. constants.BUFFER_SIZE
+	// when 0.
+	BufferSize int
+	// Entries limits extraction to the entries matching one of these patterns, see
+	// utils.MatchEntry. Empty extracts every entry. Patterns that match no entry are an error
+	// before anything is extracted, unless the archive is an Input that cannot seek.
+	Entries []string
+	// Encryption selects the cipher suite, the key derivation and the key file.
+	Encryption encryption.EncryptionOptions
+	// Codec holds the options passed to the compressor, such as utils.WithMetrics.
+	// utils.WithArchiveFormat(utils.TARGZ) writes a tar.gz, which is left unencrypted unless a
+	// password or a key file is set. The
+	// limiters of utils.WithRateLimits throttle reading the inputs and writing the archive
+	// while compressing, and reading the archive and writing the files while extracting.
+	// utils.WithProgressEvents also reports the encryption of an archive that is compressed
+	// into a temporary file first, see CompressFiles. utils.WithSignKey signs the archive file
+	// once it is written, it cannot sign an Output, and utils.WithVerifyKey checks the signature
+	// of Archive before anything is extracted, an Input cannot be verified.
+	Codec []utils.Option
+}
+
+// CompressResult describes an archive written by CompressFiles.
+type CompressResult struct {
+	// Path is the path of the created archive, empty when it was written to Options.Output.
+	Path string
+	// OriginalSize is the total size of the compressed files.
+	OriginalSize uint64
+	// CompressedSize is the size of the archive, including the encryption metadata.
+	CompressedSize uint64
+	// Warnings lists the problems that did not stop the compression, such as names that are
+	// too long to be extracted on most filesystems, and the partial archive removed after a failure.
+	Warnings []string
+	// Algorithms lists the algorithm picked for every file by utils.AUTO, in the order the
+	// files were read.
+	Algorithms []FileAlgorithm
+	// ExcludedFiles and ExcludedDirs count what the patterns of utils.WithExclude skipped. The
+	// files below a skipped directory are not counted, they are never read.
+	ExcludedFiles int
+	ExcludedDirs  int
+	// Stats holds the sizes before and after encryption, the number of compressed files and
+	// the throughput.
+	Stats utils.CompressionStats
+}
+
+// FileAlgorithm is the algorithm utils.AUTO picked for a file.
+type FileAlgorithm struct {
+	Name      string
+	Algorithm utils.Algorithm
+}
+
+// Ratio returns the sizes of the result for printing.
+func (r CompressResult) Ratio() utils.FilesRatio {
+	return r.Stats.Ratio()
+}
+
+// DecompressResult describes the files written by DecompressArchive.
+type DecompressResult struct {
+	// Paths are the paths of the extracted files, in archive order.
+	Paths []string
+	// Warnings lists the partially extracted files that were removed after a failure.
+	Warnings []string
+	// Stats holds the size of the archive, the size and the number of the extracted files and
+	// the throughput. The algorithm is empty when it cannot be read from the archive.
+	Stats utils.CompressionStats
+}
+
+// CompressFiles compresses Options.Inputs or Options.Files and encrypts the result into an
+// archive, written to Options.Output or to a new file in Options.OutputDir. A utils.HUFFMAN
+// archive is encrypted while it is compressed, so only the final archive is written. The other
+// codecs seek back in their output, their archive is compressed into a temporary file first.
+// A utils.TARGZ archive is written as it is, or encrypted while it is compressed with a
+// password or a key file.
+//
+// Parameters:
+//   - ctx: Cancels the compression, a partially written archive file is removed.
+//   - opts: The inputs, the output and the settings of the archive.
+//
+// Returns:
+//   - CompressResult: the path and the sizes of the archive
+//   - error: ErrNoInput, ErrConflictingInputs or ErrSignOutput for invalid options, ctx.Err()
+//     when canceled, or the error of the compression, the encryption or the signing
+func CompressFiles(ctx context.Context, opts Options) (CompressResult, error) {
+	start := time.Now()
+	result := CompressResult{}
+
+	if len(opts.Inputs) == 0 && len(opts.Files) == 0 {
+		return result, ErrNoInput
+	}
+	if len(opts.Inputs) > 0 && len(opts.Files) > 0 {
+		return result, ErrConflictingInputs
+	}
+
+	opts = applyBufferSize(opts)
+
+	algorithm := opts.Algorithm
+	if algorithm == "" {
+		algorithm = string(utils.HUFFMAN)
+	}
+	if err := compressor.CheckCompressionAlgorithm(algorithm); err != nil {
+		return result, err
+	}
+
+	for _, input := range opts.Inputs {
+		if _, err := os.Stat(input); os.IsNotExist(err) {
+			return result, fmt.Errorf("file '%s' does not exist", input)
+		}
+	}
+
+	names := opts.Inputs
+	if len(names) == 0 {
+		for _, file := range opts.Files {
+			names = append(names, file.Name)
+		}
+	}
+
+	if opts.Name != "" && strings.ContainsAny(opts.Name, `/\`) {
+		return result, fmt.Errorf("archive name '%s' cannot contain a directory, use the output directory instead", opts.Name)
+	}
+
+	outputDir := opts.OutputDir
+	if outputDir == "" && len(opts.Inputs) > 0 {
+		outputDir = filepath.Dir(names[0])
+	} else if outputDir == "" {
+		outputDir = "."
+	}
+
+	// a tar.gz without a password or a key file stays readable by other tools
+	encrypted := opts.Password != "" || opts.Encryption.KeyFile != ""
+	exported := utils.NewOptions(opts.Codec...).ArchiveFormat == utils.TARGZ
+	extension := constants.ARCHIVE_FILE_EXT
+	if exported && !encrypted {
+		extension = constants.TARGZ_FILE_EXT
+	}
+
+	// the signature covers the whole file, it is appended once the archive is written
+	signKey := utils.NewOptions(opts.Codec...).SignKey
+	if signKey != nil && opts.Output != nil {
+		return result, ErrSignOutput
+	}
+
+	output := opts.Output
+	if output == nil {
+		if err := utils.MakeOutputDir(outputDir); err != nil {
+			return result, err
+		}
+
+		name := utils.ArchiveName(names, extension)
+		if opts.Name != "" {
+			name = opts.Name
+			if !strings.HasSuffix(name, extension) {
+				name += extension
+			}
+		}
+		result.Path = utils.InvalidateFileName(name, outputDir)
+
+		archiveFile, err := os.Create(result.Path)
+		if err != nil {
+			return result, fmt.Errorf(constants.FILE_CREATE_ERROR, err)
+		}
+		defer archiveFile.Close()
+		output = archiveFile
+	}
+
+	codecOpts := append(append([]utils.Option{}, opts.Codec...), utils.WithContext(ctx), utils.WithWarnings(func(message string) {
+		result.Warnings = append(result.Warnings, message)
+	}), utils.WithAlgorithmChoices(func(filename string, algorithm utils.Algorithm) {
+		result.Algorithms = append(result.Algorithms, FileAlgorithm{Name: filename, Algorithm: algorithm})
+	}), utils.WithExcluded(func(name string, dir bool) {
+		if dir {
+			result.ExcludedDirs++
+		} else {
+			result.ExcludedFiles++
+		}
+	}))
+	codecOpts = result.Stats.CountFiles(codecOpts, false)
+	compress := func(compressed io.Writer) (err error) {
+		// the archive is measured before it is encrypted, the codecs that seek back in a file
+		// must still see the file
+		seeker, seekable := compressed.(io.Seeker)
+		counter := &utils.CountingWriter{Writer: compressed}
+		if !seekable {
+			compressed = counter
+		}
+		if len(opts.Inputs) > 0 {
+			result.OriginalSize, err = compressor.ReadAndCompressFiles(opts.Inputs, compressed, algorithm, codecOpts...)
+		} else {
+			result.OriginalSize = uint64(utils.TotalSize(opts.Files))
+			err = compressor.CompressFileData(opts.Files, compressed, algorithm, codecOpts...)
+		}
+		if err != nil {
+			return err
+		}
+
+		if seekable {
+			counter.BytesWritten, err = seeker.Seek(0, io.SeekEnd)
+			if err != nil {
+				return fmt.Errorf(constants.FILE_READ_ERROR, err)
+			}
+		}
+		result.Stats.CompressedBytes = uint64(counter.BytesWritten)
+		return nil
+	}
+
+	var err error
+	if exported && !encrypted {
+		result.CompressedSize, err = writeUnencrypted(compress, output, opts)
+	} else if utils.Algorithm(algorithm) == utils.HUFFMAN || exported {
+		// a Huffman archive or a tar.gz is written without seeking, so it is encrypted while it
+		// is compressed and only the final archive reaches the disk
+		result.CompressedSize, err = encryptWhileCompressing(ctx, compress, output, opts)
+	} else {
+		result.CompressedSize, err = compressThenEncrypt(ctx, compress, output, outputDir, opts)
+	}
+	if err == nil && signKey != nil {
+		if err = encryption.SignArchive(result.Path, signKey); err == nil {
+			result.CompressedSize += uint64(encryption.SIGNATURE_TRAILER_SIZE)
+		}
+	}
+	if err != nil {
+		// do not leave a partial archive behind
+		if result.Path != "" {
+			if removeErr := os.Remove(result.Path); removeErr != nil {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("failed to remove the partial archive %s: %v", result.Path, removeErr))
+			} else {
+				result.Warnings = append(result.Warnings, "removed the partial archive "+result.Path)
+			}
+		}
+		return result, utils.ContextError(ctx, err)
+	}
+
+	result.Stats.Algorithm = algorithm
+	if exported {
+		result.Stats.Algorithm = string(utils.TARGZ)
+	}
+	result.Stats.OriginalBytes = result.OriginalSize
+	if encrypted || !exported {
+		result.Stats.EncryptedBytes = result.CompressedSize
+	}
+	result.Stats.Finish(start)
+
+	return result, nil
+}
+
+// encryptWhileCompressing passes the archive written by compress to the encryption through a
+// pipe and returns the size of the encrypted archive. The progress events of the compression
+// cover the encryption, it is not reported on its own.
+func encryptWhileCompressing(ctx context.Context, compress func(io.Writer) error, output io.Writer, opts Options) (uint64, error) {
+	counter, buffered := archiveWriter(output, opts)
+
+	if err := encryption.EncryptPipe(ctx, buffered, opts.Password, compress, opts.Encryption); err != nil {
+		return 0, err
+	}
+	if err := buffered.Flush(); err != nil {
+		return 0, fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+
+	return uint64(counter.BytesWritten), nil
+}
+
+// writeUnencrypted writes the archive written by compress to output as it is and returns its
+// size.
+func writeUnencrypted(compress func(io.Writer) error, output io.Writer, opts Options) (uint64, error) {
+	counter, buffered := archiveWriter(output, opts)
+
+	if err := compress(buffered); err != nil {
+		return 0, err
+	}
+	if err := buffered.Flush(); err != nil {
+		return 0, fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+
+	return uint64(counter.BytesWritten), nil
+}
+
+// compressThenEncrypt compresses into a temporary file in outputDir, because the codecs seek
+// back to fill in the entry sizes, then encrypts it into output and returns the size of the
+// encrypted archive.
+func compressThenEncrypt(ctx context.Context, compress func(io.Writer) error, output io.Writer, outputDir string, opts Options) (uint64, error) {
+	tempDir := ""
+	if opts.Output == nil {
+		tempDir = outputDir
+	}
+	compressedFile, err := os.CreateTemp(tempDir, "squirrelzip-*"+constants.COMPRESSED_FILE_EXT)
+	if err != nil {
+		return 0, fmt.Errorf(constants.FILE_CREATE_ERROR, err)
+	}
+	defer os.Remove(compressedFile.Name())
+	defer compressedFile.Close()
+
+	if err := compress(compressedFile); err != nil {
+		return 0, err
+	}
+
+	compressedSize, err := compressedFile.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	if _, err := compressedFile.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+
+	// the events of utils.WithProgressEvents continue with the encryption of the whole archive
+	options := utils.NewOptions(opts.Codec...)
+	opts.Encryption.Progress = utils.NewProgressTracker(options.ProgressEvents, options.ProgressInterval, utils.PHASE_ENCRYPT, compressedSize)
+
+	counter, buffered := archiveWriter(output, opts)
+
+	if err := encryption.EncryptStream(ctx, compressedFile, buffered, opts.Password, opts.Encryption); err != nil {
+		return 0, fmt.Errorf(constants.FAILED_TO_ENCRYPT, err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return 0, fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+
+	return uint64(counter.BytesWritten), nil
+}
+
+// archiveWriter returns the buffer of Options.BufferSize the encrypted archive is written
+// through, and the counter of the bytes that reached output.
+func archiveWriter(output io.Writer, opts Options) (*utils.CountingWriter, *bufio.Writer) {
+	counter := &utils.CountingWriter{Writer: utils.LimitWriter(output, utils.NewOptions(opts.Codec...).WriteLimiter)}
+	return counter, bufio.NewWriterSize(counter, bufferSize(opts))
+}
+
+// DecompressArchive decrypts Options.Archive or Options.Input and extracts its files, or only
+// the entries matching Options.Entries, below Options.OutputDir. The archive is decompressed
+// while it is decrypted, the plaintext is never written to disk. The input is recognized with
+// compressor.DetectContainer: a bzip2 file made by another tool, a tar or a tar.gz, and an
+// archive written without encryption are extracted without decryption, a ZIP archive or a file
+// that is not compressed fails with a *compressor.UnsupportedContainerError.
+//
+// Parameters:
+//   - ctx: Cancels the decompression, the file being extracted is removed.
+//   - opts: The archive, the output directory and the credentials of the archive.
+//
+// Returns:
+//   - DecompressResult: the paths of the extracted files
+//   - error: ErrNoInput, ErrConflictingInputs or ErrVerifyInput for invalid options, ctx.Err()
+//     when canceled, the error of the signature check, or the error of the decryption or the
+//     decompression
+func DecompressArchive(ctx context.Context, opts Options) (DecompressResult, error) {
+	start := time.Now()
+	result := DecompressResult{}
+
+	if opts.Archive == "" && opts.Input == nil {
+		return result, ErrNoInput
+	}
+	if opts.Archive != "" && opts.Input != nil {
+		return result, ErrConflictingInputs
+	}
+	opts = applyBufferSize(opts)
+
+	verifyKey := utils.NewOptions(opts.Codec...).VerifyKey
+	if verifyKey != nil && opts.Input != nil {
+		return result, ErrVerifyInput
+	}
+
+	input := opts.Input
+	outputDir := opts.OutputDir
+	if opts.Archive != "" {
+		archiveFile, err := os.Open(opts.Archive)
+		if err != nil {
+			return result, fmt.Errorf(constants.FILE_OPEN_ERROR, err)
+		}
+		defer archiveFile.Close()
+		// a signed archive is checked before anything is read from it, the signature appended
+		// by encryption.SignArchive is not part of the archive
+		input, err = encryption.ArchiveSection(archiveFile, verifyKey)
+		if err != nil {
+			return result, err
+		}
+
+		if outputDir == "" {
+			outputDir = filepath.Dir(opts.Archive)
+		}
+	} else if outputDir == "" {
+		outputDir = "."
+	}
+
+	// a bzip2 file made by another tool is not encrypted and holds a single file, and neither is
+	// a tar.gz exported without a password
+	input, header, err := sniffHeader(input, opts)
+	if err != nil {
+		return result, err
+	}
+	container := compressor.DetectContainer(header)
+	if err := compressor.CheckContainer(container, header); err != nil {
+		return result, err
+	}
+	input, archiveSize, err := measureInput(input)
+	if err != nil {
+		return result, err
+	}
+
+	codecOpts := append(append([]utils.Option{}, opts.Codec...), utils.WithWarnings(func(message string) {
+		result.Warnings = append(result.Warnings, message)
+	}))
+	codecOpts = result.Stats.CountFiles(codecOpts, true)
+	switch container {
+	case compressor.CONTAINER_BZIP2:
+		reader := utils.CancelReader(ctx, utils.LimitReader(input, utils.NewOptions(opts.Codec...).ReadLimiter))
+		result.Paths, err = bzip2.Unzip(reader, outputDir, bzip2.EntryName(opts.Archive), append(codecOpts, utils.WithEntries(opts.Entries))...)
+		if err != nil {
+			return result, utils.ContextError(ctx, err)
+		}
+		result.Stats.Algorithm = compressor.ArchiveAlgorithm(header)
+		result.Stats.CompressedBytes = archiveSize()
+		result.Stats.Finish(start)
+		return result, nil
+	case compressor.CONTAINER_GZIP, compressor.CONTAINER_TAR, compressor.CONTAINER_NATIVE:
+		reader := utils.LimitReader(input, utils.NewOptions(opts.Codec...).ReadLimiter)
+		result.Paths, err = compressor.DecompressStream(ctx, reader, outputDir, nil, append(codecOpts, utils.WithEntries(opts.Entries))...)
+		if err != nil {
+			return result, utils.ContextError(ctx, err)
+		}
+		result.Stats.Algorithm = compressor.ArchiveAlgorithm(header)
+		result.Stats.CompressedBytes = archiveSize()
+		result.Stats.Finish(start)
+		return result, nil
+	}
+
+	entries, err := listEntries(ctx, input, opts)
+	if err != nil {
+		return result, err
+	}
+
+	// the plaintext is decompressed while it is decrypted, it never reaches the disk
+	err = encryption.DecryptPipe(ctx, encryptedReader(input, opts), opts.Password, func(plaintext io.Reader) error {
+		buffered := bufio.NewReaderSize(plaintext, bufferSize(opts))
+		// a buffer smaller than compressor.DETECT_LEN still holds the container header
+		magic, _ := buffered.Peek(compressor.DETECT_LEN)
+		result.Stats.Algorithm = compressor.ArchiveAlgorithm(magic)
+
+		compressed := &utils.CountingReader{Reader: buffered}
+		result.Paths, err = compressor.DecompressStream(ctx, compressed, outputDir, entries, append(codecOpts, utils.WithEntries(opts.Entries))...)
+		result.Stats.CompressedBytes = uint64(compressed.BytesRead)
+		return err
+	}, opts.Encryption)
+	if err != nil {
+		return result, utils.ContextError(ctx, err)
+	}
+
+	result.Stats.EncryptedBytes = archiveSize()
+	result.Stats.Finish(start)
+	return result, nil
+}
+
+// measureInput returns the reader the archive is read from and a function returning the size of
+// the archive once it is read. A seekable input is measured up to its end right away, the others
+// are counted while they are read.
+func measureInput(input io.Reader) (io.Reader, func() uint64, error) {
+	if seeker, ok := input.(io.Seeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+		}
+		end, err := seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+		}
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+		}
+		return input, func() uint64 { return uint64(end - start) }, nil
+	}
+
+	counter := &utils.CountingReader{Reader: input}
+	return counter, func() uint64 { return uint64(counter.BytesRead) }, nil
+}
+
+// listEntries lists the entries of an archive that is read from a file or another seekable
+// input, in a first pass that only decrypts it, when the entries are needed: to report the
+// patterns of Options.Entries that match no entry before anything is extracted, and for the
+// total of the progress events. The input is positioned at the start of the archive again.
+// It returns nil for other inputs, which can only be read once.
+func listEntries(ctx context.Context, input io.Reader, opts Options) ([]utils.EntryInfo, error) {
+	seeker, ok := input.(io.Seeker)
+	if !ok || (len(opts.Entries) == 0 && utils.NewOptions(opts.Codec...).ProgressEvents == nil) {
+		return nil, nil
+	}
+
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+
+	// the archive is only counted once in the metrics
+	listing := opts.Encryption
+	listing.Metrics = nil
+
+	var entries []utils.EntryInfo
+	err = encryption.DecryptPipe(ctx, encryptedReader(input, opts), opts.Password, func(plaintext io.Reader) error {
+		entries, err = compressor.ListStream(plaintext)
+		return err
+	}, listing)
+	// an archive of the first releases stored no sizes, it is extracted without its entries
+	if errors.Is(err, compressor.ErrVersion1) {
+		entries, err = nil, nil
+	}
+	if err != nil {
+		return nil, utils.ContextError(ctx, err)
+	}
+
+	if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+		return nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	return entries, nil
+}
+
+// encryptedReader returns the reader the archive is decrypted from, throttled by the read
+// limiter of Options.Codec.
+func encryptedReader(input io.Reader, opts Options) io.Reader {
+	reader := utils.LimitReader(input, utils.NewOptions(opts.Codec...).ReadLimiter)
+	// a seekable archive is read directly, verifying an HMAC seeks to the end of it
+	if _, ok := input.(io.Seeker); !ok {
+		reader = bufio.NewReaderSize(reader, bufferSize(opts))
+	}
+	return reader
+}
+
+// SNIFF_LEN is the number of bytes sniffHeader reads, the ones compressor.DetectContainer needs.
+const SNIFF_LEN = compressor.DETECT_LEN
+
+// sniffHeader returns the first SNIFF_LEN bytes of input, fewer when it is shorter, to recognize
+// the files made by other tools. It returns the reader to continue with, positioned at the start
+// of the archive again.
+func sniffHeader(input io.Reader, opts Options) (io.Reader, []byte, error) {
+	if seeker, ok := input.(io.ReadSeeker); ok {
+		start, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+		}
+		header := make([]byte, SNIFF_LEN)
+		n, err := io.ReadFull(seeker, header)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+		}
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+		}
+		return input, header[:n], nil
+	}
+
+	buffered := bufio.NewReaderSize(input, bufferSize(opts))
+	// a buffer smaller than SNIFF_LEN only misses the magic of tar
+	header, err := buffered.Peek(SNIFF_LEN)
+	if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+		return nil, nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	return buffered, header, nil
+}
+
+// applyBufferSize passes Options.BufferSize on to the codecs and the encryption.
+func applyBufferSize(opts Options) Options {
+	if opts.BufferSize <= 0 {
+		return opts
+	}
+	opts.Codec = append(append([]utils.Option{}, opts.Codec...), utils.WithBufferSize(opts.BufferSize))
+	if opts.Encryption.ChunkSize == 0 {
+		opts.Encryption.ChunkSize = opts.BufferSize
+	}
+	return opts
+}
+
+func bufferSize(opts Options) int {
+	if opts.BufferSize > 0 {
+		return opts.BufferSize
+	}
+	return constants.BUFFER_SIZE
+}
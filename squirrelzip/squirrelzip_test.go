@@ -0,0 +1,714 @@
+package squirrelzip
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"testing"
+	"time"
+
+	"file-compressor/compressor"
+	"file-compressor/constants"
+	"file-compressor/encryption"
+	"file-compressor/utils"
+)
+
+func TestCompressFilesToDir(t *testing.T) {
+	inputDir := t.TempDir()
+	inputPath := filepath.Join(inputDir, "report.txt")
+	content := bytes.Repeat([]byte("squirrel "), 100)
+	if err := os.WriteFile(inputPath, content, 0644); err != nil {
+		t.Fatalf("failed to write the input: %v", err)
+	}
+
+	result, err := CompressFiles(context.Background(), Options{Inputs: []string{inputPath}, Password: "secret"})
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	if result.Path != filepath.Join(inputDir, "report.txt.sq") {
+		t.Fatalf("expected the archive next to the input, got %s", result.Path)
+	}
+	if result.OriginalSize != uint64(len(content)) {
+		t.Fatalf("expected an original size of %d, got %d", len(content), result.OriginalSize)
+	}
+	stat, err := os.Stat(result.Path)
+	if err != nil {
+		t.Fatalf("failed to stat the archive: %v", err)
+	}
+	if uint64(stat.Size()) != result.CompressedSize {
+		t.Fatalf("expected a compressed size of %d, got %d", stat.Size(), result.CompressedSize)
+	}
+	stats := result.Stats
+	if stats.Algorithm != string(utils.HUFFMAN) || stats.OriginalBytes != result.OriginalSize || stats.EncryptedBytes != result.CompressedSize || stats.CompressedBytes == 0 || stats.CompressedBytes >= stats.EncryptedBytes || stats.FilesProcessed != 1 || stats.BytesPerSecond <= 0 {
+		t.Fatalf("unexpected stats of the compression: %+v", stats)
+	}
+
+	// only the archive and the input are left, the temporary files are removed
+	dirEntries, err := os.ReadDir(inputDir)
+	if err != nil {
+		t.Fatalf("failed to read the input directory: %v", err)
+	}
+	if len(dirEntries) != 2 {
+		t.Fatalf("expected the input and the archive, got %d files", len(dirEntries))
+	}
+
+	outputDir := t.TempDir()
+	decompressed, err := DecompressArchive(context.Background(), Options{Archive: result.Path, OutputDir: outputDir, Password: "secret"})
+	if err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+	if len(decompressed.Paths) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(decompressed.Paths))
+	}
+	// the archive names the codec it was written with, Huffman streams into the encryption
+	expected := stats
+	expected.Algorithm = string(utils.HUFFMAN_STREAM)
+	expected.Duration, expected.BytesPerSecond = decompressed.Stats.Duration, decompressed.Stats.BytesPerSecond
+	if !reflect.DeepEqual(decompressed.Stats, expected) || expected.BytesPerSecond <= 0 {
+		t.Fatalf("expected the stats of the decompression to match %+v, got %+v", expected, decompressed.Stats)
+	}
+	extracted, err := os.ReadFile(decompressed.Paths[0])
+	if err != nil {
+		t.Fatalf("failed to read the extracted file: %v", err)
+	}
+	if !bytes.Equal(content, extracted) {
+		t.Fatal("the extracted file does not match the original")
+	}
+}
+
+func TestCompressArchiveName(t *testing.T) {
+	inputDir := filepath.Join(t.TempDir(), "reports")
+	if err := os.Mkdir(inputDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	inputs := []string{}
+	for _, name := range []string{"report.pdf", "report.txt"} {
+		inputs = append(inputs, filepath.Join(inputDir, name))
+		if err := os.WriteFile(inputs[len(inputs)-1], []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write the input: %v", err)
+		}
+	}
+
+	tests := []struct {
+		opts Options
+		want string
+	}{
+		{Options{Inputs: inputs[:1]}, "report.pdf.sq"},
+		{Options{Inputs: inputs[1:]}, "report.txt.sq"},
+		// several inputs are named after their directory
+		{Options{Inputs: inputs}, "reports.sq"},
+		{Options{Inputs: inputs, Name: "backup"}, "backup.sq"},
+		{Options{Inputs: inputs, Name: "backup.sq"}, "backup_1.sq"},
+	}
+
+	for _, test := range tests {
+		test.opts.OutputDir = filepath.Dir(inputDir)
+		result, err := CompressFiles(context.Background(), test.opts)
+		if err != nil {
+			t.Fatalf("failed to compress: %v", err)
+		}
+		if result.Path != filepath.Join(test.opts.OutputDir, test.want) {
+			t.Fatalf("expected %s, got %s", test.want, result.Path)
+		}
+	}
+
+	if _, err := CompressFiles(context.Background(), Options{Inputs: inputs, Name: "../backup"}); err == nil {
+		t.Fatal("expected an error for a name with a directory")
+	}
+}
+
+func TestDecompressBzip2(t *testing.T) {
+	compressed, err := os.ReadFile("../compressor/test_files/bzip2/notes.txt.bz2")
+	if err != nil {
+		t.Fatalf("failed to read the fixture: %v", err)
+	}
+
+	// a buffer cannot seek, the magic is peeked instead
+	outputDir := t.TempDir()
+	result, err := DecompressArchive(context.Background(), Options{Input: bytes.NewBuffer(compressed), OutputDir: outputDir})
+	if err != nil {
+		t.Fatalf("failed to decompress the bzip2 file: %v", err)
+	}
+	if len(result.Paths) != 1 || result.Paths[0] != filepath.Join(outputDir, "decompressed") {
+		t.Fatalf("expected %s, got %v", filepath.Join(outputDir, "decompressed"), result.Paths)
+	}
+
+	decompressed, err := os.ReadFile(result.Paths[0])
+	if err != nil {
+		t.Fatalf("failed to read the decompressed file: %v", err)
+	}
+	if !bytes.HasPrefix(decompressed, []byte("SquirrelZip reads bzip2 files")) {
+		t.Fatalf("unexpected content %q", decompressed)
+	}
+}
+
+func TestDecompressFirstRelease(t *testing.T) {
+	// written by the CLI of the first releases, with and without the password "squirrel"
+	for _, name := range []string{"v1.sq", "v1-password.sq"} {
+		archive := filepath.Join("..", "compressor", "test_files", "legacy", name)
+		for _, entries := range [][]string{nil, {"legacyin/a.txt"}} {
+			outputDir := t.TempDir()
+			result, err := DecompressArchive(context.Background(), Options{Archive: archive, OutputDir: outputDir, Password: "squirrel", Entries: entries})
+			if err != nil {
+				t.Fatalf("%s: failed to decompress %v: %v", name, entries, err)
+			}
+			expected := 2
+			if entries != nil {
+				expected = len(entries)
+			}
+			if len(result.Paths) != expected {
+				t.Fatalf("%s: unexpected files %v for %v", name, result.Paths, entries)
+			}
+
+			data, err := os.ReadFile(filepath.Join(outputDir, "legacyin", "a.txt"))
+			if err != nil {
+				t.Fatalf("%s: failed to read the file: %v", name, err)
+			}
+			if string(data) != "first legacy file\n" {
+				t.Fatalf("%s: unexpected content %q", name, data)
+			}
+		}
+	}
+
+	archive := filepath.Join("..", "compressor", "test_files", "legacy", "v1-password.sq")
+	if _, err := DecompressArchive(context.Background(), Options{Archive: archive, OutputDir: t.TempDir(), Password: "acorn"}); err == nil {
+		t.Fatal("expected an error for a wrong password")
+	}
+}
+
+func TestTarGz(t *testing.T) {
+	inputDir := t.TempDir()
+	inputPath := filepath.Join(inputDir, "notes.txt")
+	content := bytes.Repeat([]byte("export "), 300)
+	if err := os.WriteFile(inputPath, content, 0644); err != nil {
+		t.Fatalf("failed to write the input: %v", err)
+	}
+	codec := []utils.Option{utils.WithArchiveFormat(utils.TARGZ)}
+
+	// without a password the archive is a plain tar.gz
+	plain, err := CompressFiles(context.Background(), Options{Inputs: []string{inputPath}, Codec: codec})
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	if plain.Path != filepath.Join(inputDir, "notes.txt"+constants.TARGZ_FILE_EXT) {
+		t.Fatalf("expected notes.txt%s, got %s", constants.TARGZ_FILE_EXT, plain.Path)
+	}
+	archive, err := os.Open(plain.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	gzipReader, err := gzip.NewReader(archive)
+	if err != nil {
+		t.Fatalf("not a gzip file: %v", err)
+	}
+	header, err := tar.NewReader(gzipReader).Next()
+	if err != nil || header.Name != "notes.txt" || header.Size != int64(len(content)) {
+		t.Fatalf("expected notes.txt of %d bytes, got %+v, %v", len(content), header, err)
+	}
+
+	// with a password it is the plaintext of the encrypted archive
+	encrypted, err := CompressFiles(context.Background(), Options{Inputs: []string{inputPath}, Password: "secret", Codec: codec})
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	if !strings.HasSuffix(encrypted.Path, constants.ARCHIVE_FILE_EXT) {
+		t.Fatalf("expected a %s archive, got %s", constants.ARCHIVE_FILE_EXT, encrypted.Path)
+	}
+
+	for name, opts := range map[string]Options{
+		"plain":     {Archive: plain.Path},
+		"stream":    {Input: bytes.NewBuffer(mustRead(t, plain.Path))},
+		"encrypted": {Archive: encrypted.Path, Password: "secret"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			opts.OutputDir = t.TempDir()
+			result, err := DecompressArchive(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("failed to decompress: %v", err)
+			}
+			if len(result.Paths) != 1 || !bytes.Equal(mustRead(t, result.Paths[0]), content) {
+				t.Fatalf("expected the original file, got %v", result.Paths)
+			}
+		})
+	}
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	return data
+}
+
+func TestEncryptProgressEvents(t *testing.T) {
+	content := bytes.Repeat([]byte("progress "), 1000)
+	events := []utils.ProgressEvent{}
+	result, err := CompressFiles(context.Background(), Options{
+		Files:     []utils.FileData{{Name: "a.txt", Size: int64(len(content)), Reader: bytes.NewReader(content)}},
+		Output:    &bytes.Buffer{},
+		Password:  "secret",
+		Algorithm: string(utils.LZ77),
+		Codec:     []utils.Option{utils.WithProgressEvents(func(event utils.ProgressEvent) { events = append(events, event) }, 512)},
+	})
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+
+	phases := []utils.ProgressPhase{}
+	for _, event := range events {
+		if event.Done {
+			phases = append(phases, event.Phase)
+		}
+	}
+	if len(phases) != 2 || phases[0] != utils.PHASE_COMPRESS || phases[1] != utils.PHASE_ENCRYPT {
+		t.Fatalf("expected a final compress and encrypt event, got %v", phases)
+	}
+
+	final := events[len(events)-1]
+	if final.BytesProcessed != final.TotalBytes || uint64(final.TotalBytes) >= result.CompressedSize {
+		t.Fatalf("expected the whole compressed archive to be encrypted, got %+v for a %d byte archive", final, result.CompressedSize)
+	}
+}
+
+func TestOptionErrors(t *testing.T) {
+	files := []utils.FileData{{Name: "a.txt", Size: 1, Reader: bytes.NewReader([]byte("a"))}}
+
+	if _, err := CompressFiles(context.Background(), Options{}); !errors.Is(err, ErrNoInput) {
+		t.Fatalf("expected %v, got %v", ErrNoInput, err)
+	}
+	if _, err := CompressFiles(context.Background(), Options{Inputs: []string{"a.txt"}, Files: files}); !errors.Is(err, ErrConflictingInputs) {
+		t.Fatalf("expected %v, got %v", ErrConflictingInputs, err)
+	}
+	if _, err := CompressFiles(context.Background(), Options{Files: files, Output: &bytes.Buffer{}, Algorithm: "zip"}); err == nil {
+		t.Fatal("expected an error for an unsupported algorithm")
+	}
+
+	if _, err := DecompressArchive(context.Background(), Options{}); !errors.Is(err, ErrNoInput) {
+		t.Fatalf("expected %v, got %v", ErrNoInput, err)
+	}
+	if _, err := DecompressArchive(context.Background(), Options{Archive: "a.sq", Input: &bytes.Buffer{}}); !errors.Is(err, ErrConflictingInputs) {
+		t.Fatalf("expected %v, got %v", ErrConflictingInputs, err)
+	}
+}
+
+func TestSignedArchive(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("squirrels bury acorns")
+	files := func() []utils.FileData {
+		return []utils.FileData{{Name: "a.txt", Size: int64(len(content)), Reader: bytes.NewReader(content)}}
+	}
+
+	if _, err := CompressFiles(context.Background(), Options{Files: files(), Output: &bytes.Buffer{}, Codec: []utils.Option{utils.WithSignKey(privateKey)}}); !errors.Is(err, ErrSignOutput) {
+		t.Fatalf("expected %v, got %v", ErrSignOutput, err)
+	}
+	if _, err := DecompressArchive(context.Background(), Options{Input: &bytes.Buffer{}, Codec: []utils.Option{utils.WithVerifyKey(publicKey)}}); !errors.Is(err, ErrVerifyInput) {
+		t.Fatalf("expected %v, got %v", ErrVerifyInput, err)
+	}
+
+	tests := []struct {
+		name     string
+		password string
+		options  Options
+	}{
+		{"unencrypted", "", Options{Algorithm: string(utils.DEFLATE)}},
+		{"encrypted", "secret", Options{Algorithm: string(utils.DEFLATE)}},
+		{"encrypted huffman with hmac", "secret", Options{Encryption: encryption.EncryptionOptions{HMAC: true}}},
+		{"tar.gz", "", Options{Codec: []utils.Option{utils.WithArchiveFormat(utils.TARGZ)}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := test.options
+			opts.Files = files()
+			opts.OutputDir = t.TempDir()
+			opts.Password = test.password
+			opts.Encryption.KDFIterations = 1_000
+			opts.Codec = append(opts.Codec, utils.WithSignKey(privateKey))
+			result, err := CompressFiles(context.Background(), opts)
+			if err != nil {
+				t.Fatalf("failed to compress: %v", err)
+			}
+			if stat, err := os.Stat(result.Path); err != nil || uint64(stat.Size()) != result.CompressedSize {
+				t.Fatalf("expected the compressed size to include the signature, got %d, %v", result.CompressedSize, err)
+			}
+			if err := encryption.VerifyArchive(result.Path, publicKey); err != nil {
+				t.Fatalf("failed to verify: %v", err)
+			}
+
+			outputDir := t.TempDir()
+			if _, err := DecompressArchive(context.Background(), Options{Archive: result.Path, OutputDir: outputDir, Password: test.password, Codec: []utils.Option{utils.WithVerifyKey(publicKey)}}); err != nil {
+				t.Fatalf("failed to decompress: %v", err)
+			}
+			if data, err := os.ReadFile(filepath.Join(outputDir, "a.txt")); err != nil || !bytes.Equal(data, content) {
+				t.Fatalf("unexpected extraction: %q, %v", data, err)
+			}
+		})
+	}
+}
+
+func TestDecompressWrongPassword(t *testing.T) {
+	archive := &bytes.Buffer{}
+	files := []utils.FileData{{Name: "a.txt", Size: 3, Reader: bytes.NewReader([]byte("abc"))}}
+	if _, err := CompressFiles(context.Background(), Options{Files: files, Output: archive, Password: "right"}); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+
+	archivePath := filepath.Join(t.TempDir(), "a.sq")
+	if err := os.WriteFile(archivePath, archive.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write the archive: %v", err)
+	}
+
+	outputDir := t.TempDir()
+	if _, err := DecompressArchive(context.Background(), Options{Archive: archivePath, OutputDir: outputDir, Password: "wrong"}); err == nil {
+		t.Fatal("expected an error for a wrong password")
+	}
+
+	// nothing is left next to the archive
+	dirEntries, err := os.ReadDir(filepath.Dir(archivePath))
+	if err != nil {
+		t.Fatalf("failed to read the archive directory: %v", err)
+	}
+	if len(dirEntries) != 1 {
+		t.Fatalf("expected only the archive to be left, got %d files", len(dirEntries))
+	}
+}
+
+func TestCompressCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	outputDir := t.TempDir()
+	files := []utils.FileData{{Name: "a.txt", Size: 3, Reader: bytes.NewReader([]byte("abc"))}}
+	if _, err := CompressFiles(ctx, Options{Files: files, OutputDir: outputDir}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	dirEntries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatalf("failed to read the output directory: %v", err)
+	}
+	if len(dirEntries) != 0 {
+		t.Fatalf("expected no files to be left, got %d", len(dirEntries))
+	}
+}
+
+// slowReader returns endless data a little at a time, like a slow network share.
+type slowReader struct{}
+
+func (slowReader) Read(p []byte) (int, error) {
+	time.Sleep(time.Millisecond)
+	if len(p) > 64 {
+		p = p[:64]
+	}
+	for i := range p {
+		p[i] = byte(i)
+	}
+	return len(p), nil
+}
+
+func TestCompressCanceledMidStream(t *testing.T) {
+	incompressible := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(incompressible)
+
+	tests := map[string]Options{
+		// canceled while the input is compressed, before the archive is created
+		"reading": {Files: []utils.FileData{{Name: "slow.bin", Size: -1, Reader: slowReader{}}}},
+		// canceled while the throttled archive is written, about a second at this rate
+		"writing": {
+			Files: []utils.FileData{{Name: "random.bin", Size: int64(len(incompressible)), Reader: bytes.NewReader(incompressible)}},
+			Codec: []utils.Option{utils.WithRateLimits(nil, utils.NewRateLimiter(1<<20))},
+		},
+	}
+
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			time.AfterFunc(100*time.Millisecond, cancel)
+
+			opts.OutputDir = t.TempDir()
+			opts.Algorithm = string(utils.DEFLATE)
+			result, err := CompressFiles(ctx, opts)
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("expected %v, got %v", context.Canceled, err)
+			}
+
+			dirEntries, err := os.ReadDir(opts.OutputDir)
+			if err != nil {
+				t.Fatalf("failed to read the output directory: %v", err)
+			}
+			if len(dirEntries) != 0 {
+				t.Fatalf("expected no files to be left, got %v", dirEntries)
+			}
+			if name == "writing" && (len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "removed the partial archive")) {
+				t.Fatalf("expected the removal of the archive to be reported, got %v", result.Warnings)
+			}
+		})
+	}
+}
+
+func TestCompressSinglePass(t *testing.T) {
+	const size = 8 << 20
+	input := filepath.Join(t.TempDir(), "large.txt")
+	content := bytes.Repeat([]byte("the squirrel buries a nut and forgets where "), size/44)
+	if err := os.WriteFile(input, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	content = nil
+	// collect often, so the heap shows what is kept rather than the garbage
+	gcPercent := debug.SetGCPercent(10)
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	baseline := stats.HeapAlloc
+
+	// watch the output directory and the heap while the archive is written
+	outputDir := t.TempDir()
+	stop := make(chan struct{})
+	type observed struct {
+		files   []string
+		maxHeap uint64
+	}
+	found := make(chan observed, 1)
+	go func() {
+		seen := observed{}
+		var stats runtime.MemStats
+		for {
+			dirEntries, _ := os.ReadDir(outputDir)
+			if len(dirEntries) > 1 {
+				for _, entry := range dirEntries {
+					seen.files = append(seen.files, entry.Name())
+				}
+			}
+			runtime.ReadMemStats(&stats)
+			seen.maxHeap = max(seen.maxHeap, stats.HeapAlloc)
+			select {
+			case <-stop:
+				found <- seen
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}()
+
+	result, err := CompressFiles(context.Background(), Options{Inputs: []string{input}, OutputDir: outputDir, Password: "secret"})
+	close(stop)
+	seen := <-found
+	debug.SetGCPercent(gcPercent)
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	if len(seen.files) != 0 {
+		t.Fatalf("expected only the archive in the output directory, found %v", seen.files)
+	}
+	if seen.maxHeap > baseline+size/4 {
+		t.Fatalf("expected the memory use to stay bounded, the heap grew by %d bytes for a %d byte input", seen.maxHeap-baseline, size)
+	}
+
+	decompressed, err := DecompressArchive(context.Background(), Options{Archive: result.Path, OutputDir: t.TempDir(), Password: "secret"})
+	if err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+	original, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	extracted, err := os.ReadFile(decompressed.Paths[0])
+	if err != nil {
+		t.Fatalf("failed to read the extracted file: %v", err)
+	}
+	if !bytes.Equal(original, extracted) {
+		t.Fatal("the extracted file does not match the original")
+	}
+}
+
+func TestCompressDuplicates(t *testing.T) {
+	content := bytes.Repeat([]byte("a copy of the same nut "), 1000)
+	inputDir := filepath.Join(t.TempDir(), "nuts")
+	for _, name := range []string{"a.txt", "copy/b.txt"} {
+		path := filepath.Join(inputDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a Huffman archive is streamed while it is encrypted, the copy is stored as a link either way
+	for _, password := range []string{"", "secret"} {
+		result, err := CompressFiles(context.Background(), Options{Inputs: []string{inputDir}, OutputDir: t.TempDir(), Password: password})
+		if err != nil {
+			t.Fatalf("password %q: failed to compress: %v", password, err)
+		}
+
+		entries, err := compressor.ListArchive(result.Path, password)
+		if err != nil {
+			t.Fatalf("password %q: failed to list: %v", password, err)
+		}
+		if len(entries) != 2 || entries[0].CompressedSize == 0 || entries[1].CompressedSize != 0 {
+			t.Fatalf("password %q: expected the copy to have no data, got %+v", password, entries)
+		}
+
+		decompressed, err := DecompressArchive(context.Background(), Options{Archive: result.Path, OutputDir: t.TempDir(), Password: password})
+		if err != nil {
+			t.Fatalf("password %q: failed to decompress: %v", password, err)
+		}
+		for _, path := range decompressed.Paths {
+			if extracted := mustRead(t, path); !bytes.Equal(extracted, content) {
+				t.Fatalf("password %q: expected %s to match the original", password, path)
+			}
+		}
+	}
+}
+
+func TestDecompressLargeArchiveWithoutTempFile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compresses 200 MB")
+	}
+
+	const size = 200 << 20
+	content := func() io.Reader { return io.LimitReader(rand.New(rand.NewSource(1)), size) }
+	archiveDir := t.TempDir()
+	result, err := CompressFiles(context.Background(), Options{
+		Files:     []utils.FileData{{Name: "large.bin", Size: size, Reader: content()}},
+		OutputDir: archiveDir,
+		Password:  "secret",
+		Algorithm: string(utils.LZ4),
+	})
+	if err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+
+	// watch the archive directory for a decrypted copy while the archive is extracted
+	stop := make(chan struct{})
+	found := make(chan []string, 1)
+	go func() {
+		created := []string{}
+		for {
+			dirEntries, _ := os.ReadDir(archiveDir)
+			for _, entry := range dirEntries {
+				if entry.Name() != filepath.Base(result.Path) {
+					created = append(created, entry.Name())
+				}
+			}
+			select {
+			case <-stop:
+				found <- created
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}()
+
+	outputDir := t.TempDir()
+	decompressed, err := DecompressArchive(context.Background(), Options{Archive: result.Path, OutputDir: outputDir, Password: "secret"})
+	close(stop)
+	if err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+	if created := <-found; len(created) != 0 {
+		t.Fatalf("expected no files next to the archive, found %v", created)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(outputDir, "*.decrypted")); len(matches) != 0 {
+		t.Fatalf("expected no decrypted copy, found %v", matches)
+	}
+
+	expected := sha256.New()
+	if _, err := io.Copy(expected, content()); err != nil {
+		t.Fatal(err)
+	}
+	extracted, err := os.Open(decompressed.Paths[0])
+	if err != nil {
+		t.Fatalf("failed to open the extracted file: %v", err)
+	}
+	defer extracted.Close()
+	got := sha256.New()
+	if _, err := io.Copy(got, extracted); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected.Sum(nil), got.Sum(nil)) {
+		t.Fatal("the extracted file does not match the original")
+	}
+}
+
+func TestDecompressEntriesFromStream(t *testing.T) {
+	archive := &bytes.Buffer{}
+	files := []utils.FileData{
+		{Name: "a.txt", Size: 3, Reader: bytes.NewReader([]byte("abc"))},
+		{Name: "b.txt", Size: 3, Reader: bytes.NewReader([]byte("def"))},
+	}
+	if _, err := CompressFiles(context.Background(), Options{Files: files, Output: archive, Password: "secret"}); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+
+	// a seekable input is listed first, so a missing entry fails before anything is extracted
+	outputDir := t.TempDir()
+	_, err := DecompressArchive(context.Background(), Options{Input: bytes.NewReader(archive.Bytes()), OutputDir: outputDir, Password: "secret", Entries: []string{"b.txt", "c.txt"}})
+	if err == nil || !strings.Contains(err.Error(), "c.txt") {
+		t.Fatalf("expected c.txt to be reported missing, got %v", err)
+	}
+	if dirEntries, _ := os.ReadDir(outputDir); len(dirEntries) != 0 {
+		t.Fatalf("expected nothing to be extracted, got %v", dirEntries)
+	}
+
+	result, err := DecompressArchive(context.Background(), Options{Input: bytes.NewBuffer(archive.Bytes()), OutputDir: outputDir, Password: "secret", Entries: []string{"b.txt"}})
+	if err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+	if len(result.Paths) != 1 || result.Paths[0] != filepath.Join(outputDir, "b.txt") {
+		t.Fatalf("expected only b.txt, got %v", result.Paths)
+	}
+}
+
+// BenchmarkBufferSize compresses and encrypts a 100 MB file with the old 256 byte buffers and
+// with the default buffer size.
+func BenchmarkBufferSize(b *testing.B) {
+	const size = 100 << 20
+	input := filepath.Join(b.TempDir(), "large.bin")
+	file, err := os.Create(input)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := io.Copy(file, io.LimitReader(rand.New(rand.NewSource(1)), size)); err != nil {
+		b.Fatal(err)
+	}
+	file.Close()
+
+	for _, bufferSize := range []int{256, constants.BUFFER_SIZE} {
+		b.Run(fmt.Sprintf("%d", bufferSize), func(b *testing.B) {
+			b.SetBytes(size)
+			for i := 0; i < b.N; i++ {
+				result, err := CompressFiles(context.Background(), Options{
+					Inputs:     []string{input},
+					OutputDir:  b.TempDir(),
+					Password:   "secret",
+					Algorithm:  string(utils.LZ4),
+					BufferSize: bufferSize,
+					Encryption: encryption.EncryptionOptions{KDFIterations: 1},
+				})
+				if err != nil {
+					b.Fatalf("failed to compress: %v", err)
+				}
+				b.ReportMetric(float64(result.CompressedSize)/size, "size/original")
+			}
+		})
+	}
+}
@@ -6,7 +6,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+
+	"file-compressor/constants"
 )
 
 type MODE string
@@ -14,10 +18,89 @@ type MODE string
 const (
 	COMPRESS   MODE = "compress"
 	DECOMPRESS MODE = "decompress"
+	JOIN       MODE = "join"
+	VERIFY     MODE = "verify"
+	LIST       MODE = "list"
+)
+
+const (
+	// STDIO is given instead of a file to compress or decompress to read it from stdin, and
+	// instead of the output directory to write the archive to stdout.
+	STDIO = "-"
+	// STDIN_NAME is the name of the entry compressed from stdin.
+	STDIN_NAME = "stdin"
 )
 
+// Config holds everything parsed from the command line.
+type Config struct {
+	Files     []string
+	OutputDir string
+	// ArchiveName replaces the archive name derived from the inputs.
+	ArchiveName string
+	Password  string
+	// KeyFile is the path of a key file used instead of or together with the password.
+	KeyFile   string
+	// Cipher names the cipher used with a password, empty selects the default.
+	Cipher    string
+	// KDF names the key derivation function used with a password, empty selects the default.
+	KDF       string
+	// HMAC appends an HMAC-SHA256 tag that is verified before extraction.
+	HMAC      bool
+	// SignKey is the path of the Ed25519 private key the archive is signed with.
+	SignKey string
+	// VerifyKey is the path of the Ed25519 public key the signature is checked with before
+	// the archive is extracted, listed or verified. A signed archive is only read with it.
+	VerifyKey string
+	Mode      MODE
+	Algorithm string
+	// SplitSize is the maximum size of an extracted part, 0 means no splitting.
+	SplitSize int64
+	// JSON selects machine readable output where supported.
+	JSON bool
+	// Verbose prints the collected metrics at exit.
+	Verbose bool
+	// MaxPathDepth and MaxPathLength limit extracted paths, 0 keeps the defaults.
+	MaxPathDepth  int
+	MaxPathLength int
+	// ReadRate and WriteRate limit the I/O in bytes per second, 0 means unlimited.
+	ReadRate  int64
+	WriteRate int64
+	// TruncateLongNames shortens names that are too long for the filesystem on extraction.
+	TruncateLongNames bool
+	// Entries limits extraction to the entries matching these names or glob patterns.
+	Entries []string
+	// NoPreserveAttrs keeps the extraction time and default permissions on extracted files.
+	NoPreserveAttrs bool
+	// Overwrite is what extraction does with the files that exist already, set by -f, -rename
+	// and -skip.
+	Overwrite OverwritePolicy
+	// Quiet disables the progress bar.
+	Quiet bool
+	// NoColor prints the messages without colors.
+	NoColor bool
+	// Threads is the number of files compressed at the same time, 0 uses one per CPU.
+	Threads int
+	// KeepPaths stores the compressed files under the paths given on the command line.
+	KeepPaths bool
+	// NoSolidNames builds the Huffman codes from the file data only, without the names.
+	NoSolidNames bool
+	// Level trades the speed of the compression for the size of the archive, 0 keeps the
+	// default of the algorithm.
+	Level CompressionLevel
+	// Format is the container of the archive, NATIVE unless -format is given.
+	Format ArchiveFormat
+	// Exclude skips the files and directories matching these glob patterns while compressing.
+	Exclude []string
+	// BufferSize is the size of the I/O buffers and of the encrypted chunks, 0 keeps the default.
+	BufferSize int
+}
+
 type FlagSet struct {
-	flags       map[string]*Flag
+	flags map[string]*Flag
+	// aliases maps the long names registered with Alias to the flags they stand for.
+	aliases map[string]string
+	// order holds the flag names in the order they were registered, Usage lists them in it.
+	order       []string
 	parsedFlags map[string]interface{}
 }
 
@@ -26,29 +109,55 @@ type Flag struct {
 	Usage   string
 	IsBool  bool
 	IsArray bool
+	// Aliases are the long names of the flag, see FlagSet.Alias.
+	Aliases []string
 }
 
 func NewFlagSet() *FlagSet {
 	return &FlagSet{
 		flags:       make(map[string]*Flag),
+		aliases:     make(map[string]string),
 		parsedFlags: make(map[string]interface{}),
 	}
 }
 
+func (fs *FlagSet) add(flag *Flag) {
+	if _, exists := fs.flags[flag.Name]; !exists {
+		fs.order = append(fs.order, flag.Name)
+	}
+	fs.flags[flag.Name] = flag
+}
+
 func (fs *FlagSet) Bool(name, usage string) {
-	fs.flags[name] = &Flag{Name: name, Usage: usage, IsBool: true}
+	fs.add(&Flag{Name: name, Usage: usage, IsBool: true})
 	fs.parsedFlags[name] = false
 }
 
 func (fs *FlagSet) String(name, usage string) {
-	fs.flags[name] = &Flag{Name: name, Usage: usage, IsBool: false}
+	fs.add(&Flag{Name: name, Usage: usage, IsBool: false})
 }
 
 func (fs *FlagSet) ArrayStr(name, usage string) {
-	fs.flags[name] = &Flag{Name: name, Usage: usage, IsBool: false, IsArray: true}
+	fs.add(&Flag{Name: name, Usage: usage, IsBool: false, IsArray: true})
 	fs.parsedFlags[name] = []string{}
 }
 
+// Alias registers alias as a long name of the flag name, which is registered already. The
+// value given as --alias is stored under name.
+func (fs *FlagSet) Alias(alias, name string) {
+	fs.aliases[alias] = name
+	fs.flags[name].Aliases = append(fs.flags[name].Aliases, alias)
+}
+
+// lookup returns the flag registered under name, or the flag name is an alias of.
+func (fs *FlagSet) lookup(name string) (*Flag, bool) {
+	if target, isAlias := fs.aliases[name]; isAlias {
+		name = target
+	}
+	flag, exists := fs.flags[name]
+	return flag, exists
+}
+
 func (fs *FlagSet) Parse(args []string) error {
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
@@ -59,29 +168,68 @@ func (fs *FlagSet) Parse(args []string) error {
 	return nil
 }
 
+// processArg parses the flag arg. --name is accepted as well as -name, and -name=value as well
+// as -name value. A boolean takes true or false after =, the value of a string may be empty.
+// Single letter booleans can be combined, -fP sets -f and -P.
 func (fs *FlagSet) processArg(arg string, i *int, args []string) error {
 	if !strings.HasPrefix(arg, "-") {
 		return fmt.Errorf("invalid argument: %s", arg)
 	}
-	flagName := arg[1:]
-	flag, exists := fs.flags[flagName]
+	flagName, value, hasValue := strings.Cut(strings.TrimPrefix(arg[1:], "-"), "=")
+	flag, exists := fs.lookup(flagName)
 	if !exists {
+		if !hasValue && !strings.HasPrefix(arg, "--") && fs.setShorthands(flagName) {
+			return nil
+		}
 		return fmt.Errorf("unknown flag: %s", flagName)
 	}
-	if flag.IsBool {
+
+	switch {
+	case flag.IsBool && hasValue:
+		set, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("flag -%s takes true or false, got %q", flag.Name, value)
+		}
+		fs.parsedFlags[flag.Name] = set
+	case flag.IsBool:
 		fs.parsedFlags[flag.Name] = true
-	} else if flag.IsArray {
-		return fs.collectArrayValues(flagName, i, args)
-	} else {
-		return fs.collectValues(flagName, i, args)
+	case flag.IsArray:
+		return fs.collectArrayValues(flag.Name, value, hasValue, i, args)
+	case hasValue:
+		fs.parsedFlags[flag.Name] = value
+	default:
+		return fs.collectValues(flag.Name, i, args)
 	}
 	return nil
 }
 
-func (fs *FlagSet) collectArrayValues(flagName string, i *int, args []string) error {
+// setShorthands sets the booleans of combined single letter flags such as -fP, it reports
+// false and sets nothing unless every letter is a boolean flag.
+func (fs *FlagSet) setShorthands(letters string) bool {
+	if len(letters) < 2 {
+		return false
+	}
+	for _, letter := range letters {
+		flag, exists := fs.flags[string(letter)]
+		if !exists || !flag.IsBool {
+			return false
+		}
+	}
+	for _, letter := range letters {
+		fs.parsedFlags[string(letter)] = true
+	}
+	return true
+}
+
+// collectArrayValues collects the values of an array flag, the value given after = and the
+// arguments that follow up to the next flag.
+func (fs *FlagSet) collectArrayValues(flagName, value string, hasValue bool, i *int, args []string) error {
 	values := []string{}
+	if hasValue && value != "" {
+		values = append(values, value)
+	}
 	for j := *i + 1; j < len(args); j++ {
-		if strings.HasPrefix(args[j], "-") {
+		if isFlag(args[j]) {
 			break
 		}
 		values = append(values, args[j])
@@ -90,12 +238,14 @@ func (fs *FlagSet) collectArrayValues(flagName string, i *int, args []string) er
 	if len(values) == 0 {
 		return fmt.Errorf("flag -%s requires a value", flagName)
 	}
-	fs.parsedFlags[flagName] = values
+	// a repeated flag adds its values to the earlier ones
+	previous, _ := fs.parsedFlags[flagName].([]string)
+	fs.parsedFlags[flagName] = append(previous, values...)
 	return nil
 }
 
 func (fs *FlagSet) collectValues(flagName string, i *int, args []string) error {
-	if *i+1 >= len(args) || strings.HasPrefix(args[*i+1], "-") {
+	if *i+1 >= len(args) || isFlag(args[*i+1]) {
 		return fmt.Errorf("flag -%s requires a value", flagName)
 	}
 	fs.parsedFlags[flagName] = args[*i+1]
@@ -103,6 +253,11 @@ func (fs *FlagSet) collectValues(flagName string, i *int, args []string) error {
 	return nil
 }
 
+// isFlag reports whether arg is a flag rather than a value, STDIO is a value.
+func isFlag(arg string) bool {
+	return strings.HasPrefix(arg, "-") && arg != STDIO
+}
+
 func (fs *FlagSet) Get(flagName string) (interface{}, bool) {
 	value, exists := fs.parsedFlags[flagName]
 	return value, exists
@@ -110,10 +265,17 @@ func (fs *FlagSet) Get(flagName string) (interface{}, bool) {
 
 func (fs *FlagSet) Usage() {
 	fmt.Println("Usage: Chipmunk file archiver [options]")
-	fmt.Println("Options:")
-	for _, flag := range fs.flags {
-		fmt.Printf("  -%s: %s\n", flag.Name, flag.Usage)
+	fmt.Println("       Chipmunk file archiver join <descriptor.parts.json> [-o output]")
+	fmt.Println("Options, given as -name value, -name=value or with two dashes:")
+	for _, name := range fs.order {
+		flag := fs.flags[name]
+		names := "-" + flag.Name
+		for _, alias := range flag.Aliases {
+			names += ", --" + alias
+		}
+		fmt.Printf("  %s: %s\n", names, flag.Usage)
 	}
+	fmt.Println("Single letter switches can be combined, e.g. -fP.")
 }
 
 var flagSet = NewFlagSet()
@@ -122,13 +284,67 @@ func initFlags() (map[string]interface{}, error) {
 	flagSet.Bool("v", "Print version")
 	flagSet.ArrayStr("c", "Input files or directory to be compressed [strings]")
 	flagSet.String("o", "Output directory to compressed/decompress files (Optional) [string]")
-	flagSet.String("a", "Algorithm to use for compression (Optional) [string]")
+	flagSet.String("n", "Name of the archive, by default the input file name or the directory of several inputs (Optional) [string]")
+	flagSet.String("a", "Algorithm to use for compression: "+AlgorithmNames()+", default "+string(HUFFMAN)+". Extraction reads it from the archive (Optional) [string]")
+	flagSet.String("algo", "Same as -a (Optional) [string]")
 	flagSet.String("p", "Password for encryption (Optional) [string]")
+	flagSet.Bool("P", "Prompt for the password without showing it, instead of -p (Optional)")
+	flagSet.String("keyfile", "Key file of 32 bytes used instead of or together with the password (Optional) [string]")
+	flagSet.String("cipher", "Cipher used with a password, aes-gcm or chacha20-poly1305 (Optional) [string]")
+	flagSet.String("kdf", "Key derivation function used with a password, pbkdf2 or argon2 (Optional) [string]")
+	flagSet.Bool("hmac", "Append an HMAC-SHA256 tag that is verified before extraction (Optional)")
+	flagSet.String("sign-key", "Ed25519 private key, PEM or raw, the archive is signed with (Optional) [string]")
+	flagSet.String("verify-key", "Ed25519 public key, PEM or raw, the signature of the archive is checked with before it is read, required for a signed archive (Optional) [string]")
 	flagSet.Bool("all", "Read all files in the input directory (Optional)")
 	flagSet.ArrayStr("d", "Input file to decompress [strings]")
+	flagSet.ArrayStr("files", "Only extract the entries matching these names or glob patterns (Optional) [strings]")
+	flagSet.String("t", "Test the integrity of an archive without extracting it [string]")
+	flagSet.String("l", "List the contents of an archive without extracting it [string]")
+	flagSet.String("list", "Same as -l [string]")
+	flagSet.Bool("json", "Print the result of a compression or a decompression, the verification report or the listing as JSON (Optional)")
+	flagSet.String("split-output", "Split every extracted file into parts of at most SIZE, e.g. 4GB (Optional) [string]")
+	flagSet.String("max-path-depth", "Maximum number of directories in an extracted path (Optional) [int]")
+	flagSet.String("max-path-length", "Maximum length of an extracted path (Optional) [int]")
+	flagSet.String("max-read-rate", "Limit reading input to RATE per second, e.g. 50MB/s (Optional) [string]")
+	flagSet.String("max-write-rate", "Limit writing output to RATE per second, e.g. 50MB/s (Optional) [string]")
+	flagSet.Bool("truncate-long-names", "Shorten extracted names longer than 255 bytes and list the originals in renamed-entries.json (Optional)")
+	flagSet.Bool("f", "Overwrite the extracted files that exist already, extraction stops at the first one otherwise (Optional)")
+	flagSet.Bool("rename", "Extract the files that exist already under a numbered name, e.g. notes_1.txt (Optional)")
+	flagSet.Bool("skip", "Keep the files that exist already and do not extract those entries (Optional)")
+	flagSet.Bool("no-preserve-attrs", "Do not restore the modification times and permissions of extracted files (Optional)")
+	flagSet.Bool("vv", "Print the collected metrics at exit (Optional)")
+	flagSet.Bool("quiet", "Do not draw the progress bar on stderr (Optional)")
+	flagSet.Bool("no-color", "Print the messages without colors, as when NO_COLOR is set or the output is not a terminal (Optional)")
+	flagSet.Bool("no-progress", "Same as -quiet (Optional)")
+	flagSet.ArrayStr("exclude", "Skip the files and directories matching these glob patterns while compressing, e.g. '*.log' '.git/**', case sensitive (Optional) [strings]")
+	flagSet.ArrayStr("x", "Same as -exclude, can be repeated (Optional) [strings]")
+	flagSet.Bool("keep-paths", "Store files under the paths they were given as instead of relative to their argument (Optional)")
+	flagSet.Bool("no-solid-names", "Build the Huffman codes from the file data only, the names do not count (Optional)")
+	flagSet.String("level", "Compression level from 1, the fastest, to 9, the smallest, or fast, balanced or best. Used by deflate, lz and targz (Optional) [string]")
+	flagSet.String("format", "Format of the archive, sq or targz for a tar.gz other tools can read, encrypted only with a password (Optional) [string]")
+	flagSet.String("bufsize", "Size of the I/O buffers and of the encrypted chunks, e.g. 1MB, default 64KB (Optional) [string]")
+	flagSet.String("threads", "Number of files compressed at the same time, default one per CPU (Optional) [int]")
 	flagSet.Bool("h", "Print help")
 
-	err := flagSet.Parse(os.Args[1:])
+	flagSet.Alias("compress", "c")
+	flagSet.Alias("decompress", "d")
+	flagSet.Alias("output", "o")
+	flagSet.Alias("password", "p")
+	flagSet.Alias("help", "h")
+	flagSet.Alias("version", "v")
+
+	args := os.Args[1:]
+	// join subcommand: join <descriptor> [flags]
+	if len(args) > 0 && args[0] == string(JOIN) {
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			flagSet.Usage()
+			return nil, fmt.Errorf("join requires a split descriptor")
+		}
+		flagSet.parsedFlags[string(JOIN)] = args[1]
+		args = args[2:]
+	}
+
+	err := flagSet.Parse(args)
 	if err != nil {
 		flagSet.Usage()
 		return nil, err
@@ -141,15 +357,26 @@ func setupCompressMode(Mode *MODE, readAllFiles *bool, inputToCompress []string,
 	// compress mode
 	*Mode = COMPRESS
 	// Handle reading all files in the input directory
+	if *readAllFiles && inputToCompress[0] == STDIO {
+		ColorPrint(RED, "stdin cannot be read as a directory\n")
+		os.Exit(1)
+	}
+	if len(inputToCompress) > 1 && slices.Contains(inputToCompress, STDIO) {
+		ColorPrint(RED, "stdin can only be compressed on its own\n")
+		os.Exit(1)
+	}
 	if *readAllFiles {
-		var err error
-
-		*filenameStrs, err = GetAllFileNamesFromDir(&inputToCompress[0])
-
-		if err != nil {
-			ColorPrint(RED, err.Error()+"\n")
+		// the compressor walks the directory itself, so the files are stored relative to it
+		info, err := os.Stat(inputToCompress[0])
+		if os.IsNotExist(err) {
+			ColorPrint(RED, "input directory does not exist\n")
+			os.Exit(1)
+		}
+		if err != nil || !info.IsDir() {
+			ColorPrint(RED, "input is not a directory\n")
 			os.Exit(1)
 		}
+		*filenameStrs = inputToCompress[:1]
 	} else {
 		*filenameStrs = inputToCompress
 	}
@@ -176,7 +403,7 @@ func setupDecompressMode(Mode *MODE, inputToDecompress []string, filenameStrs *[
 	*filenameStrs = append(*filenameStrs, inputToDecompress[0])
 }
 
-func ParseCLI() ([]string, string, string, MODE, string) {
+func ParseCLI() Config {
 	// CLI arguments
 
 	values, err := initFlags()
@@ -187,14 +414,64 @@ func ParseCLI() ([]string, string, string, MODE, string) {
 	}
 
 	// flags
+	// read first, so the errors reported while parsing the other flags are plain as well
+	noColor, _ := values["no-color"].(bool)
+	if noColor {
+		Messages = NewPrinter(os.Stdout, true)
+	}
 	help, _ := values["h"].(bool)
 	version, _ := values["v"].(bool)
 	inputToCompress, _ := values["c"].([]string)
 	outputDir, _ := values["o"].(string)
-	password, _ := values["p"].(string)
+	archiveName, _ := values["n"].(string)
+	password, passwordGiven := values["p"].(string)
+	promptPassword, _ := values["P"].(bool)
+	keyFile, _ := values["keyfile"].(string)
+	cipherName, _ := values["cipher"].(string)
+	kdfName, _ := values["kdf"].(string)
+	hmacTag, _ := values["hmac"].(bool)
+	signKey, _ := values["sign-key"].(string)
+	verifyKey, _ := values["verify-key"].(string)
 	readAllFiles, _ := values["all"].(bool)
 	inputToDecompress, _ := values["d"].([]string)
 	algorithm, _ := values["a"].(string)
+	if algorithm == "" {
+		algorithm, _ = values["algo"].(string)
+	}
+	algorithmGiven := algorithm != ""
+	splitOutput, _ := values["split-output"].(string)
+	joinDescriptor, _ := values[string(JOIN)].(string)
+	archiveToVerify, _ := values["t"].(string)
+	archiveToList, _ := values["l"].(string)
+	if archiveToList == "" {
+		archiveToList, _ = values["list"].(string)
+	}
+	jsonOutput, _ := values["json"].(bool)
+	verbose, _ := values["vv"].(bool)
+	maxPathDepthStr, _ := values["max-path-depth"].(string)
+	maxPathLengthStr, _ := values["max-path-length"].(string)
+	maxReadRate, _ := values["max-read-rate"].(string)
+	maxWriteRate, _ := values["max-write-rate"].(string)
+	truncateLongNames, _ := values["truncate-long-names"].(bool)
+	entries, _ := values["files"].([]string)
+	noPreserveAttrs, _ := values["no-preserve-attrs"].(bool)
+	overwrite, _ := values["f"].(bool)
+	renameExisting, _ := values["rename"].(bool)
+	skipExisting, _ := values["skip"].(bool)
+	quiet, _ := values["quiet"].(bool)
+	if noProgress, _ := values["no-progress"].(bool); noProgress {
+		quiet = true
+	}
+	threadsStr, _ := values["threads"].(string)
+	keepPaths, _ := values["keep-paths"].(bool)
+	noSolidNames, _ := values["no-solid-names"].(bool)
+	levelStr, _ := values["level"].(string)
+	formatStr, _ := values["format"].(string)
+	exclude, _ := values["exclude"].([]string)
+	if patterns, _ := values["x"].([]string); len(patterns) > 0 {
+		exclude = append(append([]string{}, exclude...), patterns...)
+	}
+	bufsizeStr, _ := values["bufsize"].(string)
 
 
 	if version {
@@ -211,6 +488,62 @@ func ParseCLI() ([]string, string, string, MODE, string) {
 		os.Exit(0)
 	}
 
+	if joinDescriptor != "" {
+		return Config{Files: []string{joinDescriptor}, OutputDir: outputDir, Mode: JOIN, Quiet: quiet}
+	}
+
+	// extraction, listing and verification read the algorithm of every entry from the archive
+	if algorithmGiven && (len(inputToCompress) == 0 || archiveToVerify != "" || archiveToList != "") {
+		ColorPrint(RED, "An algorithm can only be chosen when compressing, it is read from the archive otherwise\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	// nothing is prompted for when the command is missing its input anyway
+	hasInput := len(inputToCompress) > 0 || len(inputToDecompress) > 0 || archiveToVerify != "" || archiveToList != ""
+	if promptPassword && hasInput {
+		if passwordGiven {
+			ColorPrint(RED, "Cannot use -p and -P at the same time\n")
+			flagSet.Usage()
+			os.Exit(1)
+		}
+		// a new archive is only protected by what was typed, so it is typed twice
+		creating := len(inputToCompress) > 0 && archiveToVerify == "" && archiveToList == ""
+		if creating {
+			password, err = PromptNewPassword()
+		} else {
+			password, err = PromptPassword("Password: ")
+		}
+		if err != nil {
+			ColorPrint(RED, err.Error()+"\n")
+			os.Exit(1)
+		}
+	}
+
+	if archiveToVerify != "" && archiveToList != "" {
+		ColorPrint(RED, "Cannot verify and list at the same time\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	if archiveToVerify != "" {
+		if len(inputToCompress) > 0 || len(inputToDecompress) > 0 {
+			ColorPrint(RED, "Cannot verify and compress/decompress at the same time\n")
+			flagSet.Usage()
+			os.Exit(1)
+		}
+		return Config{Files: []string{archiveToVerify}, Password: password, KeyFile: keyFile, VerifyKey: verifyKey, Mode: VERIFY, JSON: jsonOutput}
+	}
+
+	if archiveToList != "" {
+		if len(inputToCompress) > 0 || len(inputToDecompress) > 0 {
+			ColorPrint(RED, "Cannot list and compress/decompress at the same time\n")
+			flagSet.Usage()
+			os.Exit(1)
+		}
+		return Config{Files: []string{archiveToList}, Password: password, KeyFile: keyFile, VerifyKey: verifyKey, Mode: LIST, JSON: jsonOutput}
+	}
+
 	//mode check
 	if len(inputToDecompress) > 0 && len(inputToCompress) > 0 {
 		ColorPrint(RED, "Cannot compress and decompress at the same time\n")
@@ -236,34 +569,302 @@ func ParseCLI() ([]string, string, string, MODE, string) {
 	}
 
 	//check if algorithm is provided
-	switch algorithm {
-	case "":
-		algorithm = "huffman"
-	case "huffman":
-		break
-	default:
-		ColorPrint(RED, fmt.Sprintf("Unsupported algorithm: %s\n", algorithm))
+	chosen, err := ParseAlgorithm(algorithm)
+	if err != nil {
+		ColorPrint(RED, err.Error()+"\n")
 		flagSet.Usage()
 		os.Exit(1)
 	}
+	algorithm = string(chosen)
 
-	return filenameStrs, outputDir, password, Mode, algorithm
+	if cipherName != "" && (Mode != COMPRESS || (password == "" && keyFile == "")) {
+		ColorPrint(RED, "A cipher can only be chosen when compressing with a password or a key file\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	if kdfName != "" && (Mode != COMPRESS || (password == "" && keyFile == "")) {
+		ColorPrint(RED, "A key derivation function can only be chosen when compressing with a password or a key file\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	if hmacTag && Mode != COMPRESS {
+		ColorPrint(RED, "HMAC tags are only added when compressing, extraction verifies them automatically\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	if len(exclude) > 0 && Mode != COMPRESS {
+		ColorPrint(RED, "Excluding files is only supported for compression\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+	if _, err := MatchesAnyPattern("", exclude); err != nil {
+		ColorPrint(RED, err.Error()+"\n")
+		os.Exit(1)
+	}
+
+	if len(entries) > 0 && Mode != DECOMPRESS {
+		ColorPrint(RED, "Selecting entries is only supported for decompression\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	if noPreserveAttrs && Mode != DECOMPRESS {
+		ColorPrint(RED, "Attributes are only restored on decompression\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	overwritePolicy := OVERWRITE_ERROR
+	policies := 0
+	for _, policy := range []struct {
+		given  bool
+		policy OverwritePolicy
+	}{{overwrite, OVERWRITE_REPLACE}, {renameExisting, OVERWRITE_RENAME}, {skipExisting, OVERWRITE_SKIP}} {
+		if policy.given {
+			overwritePolicy = policy.policy
+			policies++
+		}
+	}
+	if policies > 1 {
+		ColorPrint(RED, "Only one of -f, -rename and -skip can be given\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+	if policies > 0 && Mode != DECOMPRESS {
+		ColorPrint(RED, "-f, -rename and -skip are only used for decompression\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	if signKey != "" && (Mode != COMPRESS || outputDir == STDIO) {
+		ColorPrint(RED, "-sign-key is only used for compression into an archive file\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+	if verifyKey != "" && (Mode != DECOMPRESS || filenameStrs[0] == STDIO) {
+		ColorPrint(RED, "-verify-key is only used for reading an archive file\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	var splitSize int64
+	if splitOutput != "" {
+		if Mode != DECOMPRESS {
+			ColorPrint(RED, "Split output is only supported for decompression\n")
+			flagSet.Usage()
+			os.Exit(1)
+		}
+		splitSize, err = ParseSize(splitOutput)
+		if err != nil {
+			ColorPrint(RED, err.Error()+"\n")
+			os.Exit(1)
+		}
+	}
+
+	maxPathDepth, err := parseLimit("max-path-depth", maxPathDepthStr)
+	if err != nil {
+		ColorPrint(RED, err.Error()+"\n")
+		os.Exit(1)
+	}
+	maxPathLength, err := parseLimit("max-path-length", maxPathLengthStr)
+	if err != nil {
+		ColorPrint(RED, err.Error()+"\n")
+		os.Exit(1)
+	}
+
+	if archiveName != "" && Mode != COMPRESS {
+		ColorPrint(RED, "An archive name can only be given when compressing\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	if outputDir == STDIO && Mode != COMPRESS {
+		ColorPrint(RED, "Only archives can be written to stdout\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+	if outputDir == STDIO && jsonOutput {
+		ColorPrint(RED, "-json prints to stdout, it cannot be used when the archive is written there\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+	// the document is the only output, the progress bar is not drawn either
+	if jsonOutput {
+		quiet = true
+	}
+
+	if outputDir == STDIO && archiveName != "" {
+		ColorPrint(RED, "An archive written to stdout has no name\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	if keepPaths && Mode != COMPRESS {
+		ColorPrint(RED, "Paths are only stored when compressing\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	if noSolidNames && (Mode != COMPRESS || (algorithm != string(HUFFMAN) && algorithm != string(BWT) && algorithm != string(AUTO))) {
+		ColorPrint(RED, "Names can only be left out of the codes when compressing with huffman, bwt or auto\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	level := CompressionLevel(0)
+	if levelStr != "" {
+		level, err = ParseCompressionLevel(levelStr)
+		if err != nil {
+			ColorPrint(RED, err.Error()+"\n")
+			os.Exit(1)
+		}
+	}
+	if level > 0 && Mode != COMPRESS {
+		ColorPrint(RED, "A level can only be set when compressing\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	archiveFormat := NATIVE
+	if formatStr != "" {
+		archiveFormat, err = ParseArchiveFormat(formatStr)
+		if err != nil {
+			ColorPrint(RED, err.Error()+"\n")
+			os.Exit(1)
+		}
+		if Mode != COMPRESS {
+			ColorPrint(RED, "A format can only be chosen when compressing, extraction recognizes it\n")
+			flagSet.Usage()
+			os.Exit(1)
+		}
+	}
+	if archiveFormat == TARGZ && (algorithmGiven || noSolidNames) {
+		ColorPrint(RED, "A tar.gz is always compressed with gzip, it takes no algorithm\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	bufferSize := int64(0)
+	if bufsizeStr != "" {
+		bufferSize, err = ParseSize(bufsizeStr)
+		if err == nil && (bufferSize < 1 || bufferSize > constants.MAX_BUFFER_SIZE) {
+			err = fmt.Errorf("invalid -bufsize %s, it must be between 1 byte and %s", bufsizeStr, FileSize(constants.MAX_BUFFER_SIZE))
+		}
+		if err != nil {
+			ColorPrint(RED, err.Error()+"\n")
+			os.Exit(1)
+		}
+	}
+
+	threads, err := parseLimit("threads", threadsStr)
+	if err != nil {
+		ColorPrint(RED, err.Error()+"\n")
+		os.Exit(1)
+	}
+	if threads > 0 && Mode != COMPRESS {
+		ColorPrint(RED, "Threads are only used for compression\n")
+		flagSet.Usage()
+		os.Exit(1)
+	}
+
+	readRate, err := parseRate(maxReadRate)
+	if err != nil {
+		ColorPrint(RED, err.Error()+"\n")
+		os.Exit(1)
+	}
+	writeRate, err := parseRate(maxWriteRate)
+	if err != nil {
+		ColorPrint(RED, err.Error()+"\n")
+		os.Exit(1)
+	}
+
+	return Config{
+		Files:         filenameStrs,
+		OutputDir:     outputDir,
+		ArchiveName:   archiveName,
+		Password:      password,
+		KeyFile:       keyFile,
+		Cipher:        cipherName,
+		KDF:           kdfName,
+		HMAC:          hmacTag,
+		SignKey:       signKey,
+		VerifyKey:     verifyKey,
+		Mode:          Mode,
+		Algorithm:     algorithm,
+		SplitSize:     splitSize,
+		Verbose:       verbose,
+		MaxPathDepth:  maxPathDepth,
+		MaxPathLength: maxPathLength,
+		ReadRate:      readRate,
+		WriteRate:     writeRate,
+
+		TruncateLongNames: truncateLongNames,
+		Entries:           entries,
+		NoPreserveAttrs:   noPreserveAttrs,
+		Overwrite:         overwritePolicy,
+		Quiet:             quiet,
+		NoColor:           noColor,
+		JSON:              jsonOutput,
+		Threads:           threads,
+		KeepPaths:         keepPaths,
+		NoSolidNames:      noSolidNames,
+		Level:             level,
+		Format:            archiveFormat,
+		Exclude:           exclude,
+		BufferSize:        int(bufferSize),
+	}
 }
 
+// parseRate parses an optional rate flag, an empty value means unlimited.
+func parseRate(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return ParseRate(value)
+}
 
+// parseLimit parses an optional positive integer flag, an empty value means 0.
+func parseLimit(flagName, value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("flag -%s requires a positive number, got %q", flagName, value)
+	}
+	return limit, nil
+}
 
-func GetAllFileNamesFromDir(dir *string) ([]string, error) {
+
+
+// GetAllFileNamesFromDir returns the paths of the files below dir. The files and directories
+// whose paths relative to dir match one of the patterns of exclude are skipped, see
+// MatchesAnyPattern, and nothing below a skipped directory is read.
+//
+// Parameters:
+//   - dir: The directory to walk.
+//   - exclude: The patterns of the files and directories to skip, nil keeps every file.
+//
+// Returns:
+//   - []string: the paths of the files that are not excluded
+//   - int: the number of files and directories that were skipped
+//   - error: if dir is not a directory, a pattern is malformed or the walk fails
+func GetAllFileNamesFromDir(dir *string, exclude []string) ([]string, int, error) {
 
 	var filenameStrs []string
+	excluded := 0
 
 	// Check if input is a directory
 	info, err := os.Stat(*dir)
 	if os.IsNotExist(err) {
-		return nil, fmt.Errorf("input directory does not exist")
+		return nil, 0, fmt.Errorf("input directory does not exist")
 	}
 
 	if !info.IsDir() {
-		return nil, fmt.Errorf("input is not a directory")
+		return nil, 0, fmt.Errorf("input is not a directory")
 	}
 
 	// Read all files in the directory
@@ -271,14 +872,33 @@ func GetAllFileNamesFromDir(dir *string) ([]string, error) {
 		if err != nil {
 			return err
 		}
+
+		relative, err := filepath.Rel(*dir, path)
+		if err != nil {
+			return err
+		}
+		if relative != "." {
+			skip, err := MatchesAnyPattern(relative, exclude)
+			if err != nil {
+				return err
+			}
+			if skip {
+				excluded++
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
 		if !info.IsDir() {
 			filenameStrs = append(filenameStrs, path)
 		}
 		return nil
 	})
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return filenameStrs, nil
+	return filenameStrs, excluded, nil
 }
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRepeatedArrayFlag(t *testing.T) {
+	flags := NewFlagSet()
+	flags.ArrayStr("x", "patterns")
+	flags.Bool("all", "all files")
+
+	if err := flags.Parse([]string{"-x", "*.log", "*.tmp", "-all", "--x", "node_modules"}); err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	patterns, _ := flags.Get("x")
+	if expected := []string{"*.log", "*.tmp", "node_modules"}; !slices.Equal(patterns.([]string), expected) {
+		t.Fatalf("expected %v, got %v", expected, patterns)
+	}
+}
+
+// testFlagSet registers flags like initFlags does.
+func testFlagSet() *FlagSet {
+	flags := NewFlagSet()
+	flags.ArrayStr("c", "inputs")
+	flags.String("o", "output")
+	flags.String("p", "password")
+	flags.Bool("f", "overwrite")
+	flags.Bool("P", "prompt")
+	flags.Bool("quiet", "quiet")
+	flags.Bool("vv", "metrics")
+	flags.Bool("v", "version")
+	flags.Alias("compress", "c")
+	flags.Alias("output", "o")
+	flags.Alias("password", "p")
+	flags.Alias("version", "v")
+	return flags
+}
+
+func TestFlagSyntax(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected map[string]interface{}
+	}{
+		{"single dash", []string{"-c", "a", "b", "-o", "dir"}, map[string]interface{}{"c": []string{"a", "b"}, "o": "dir"}},
+		{"double dash", []string{"--c", "a", "--o", "dir", "--quiet"}, map[string]interface{}{"c": []string{"a"}, "o": "dir", "quiet": true}},
+		{"long alias", []string{"--compress", "a", "--output", "dir", "--password", "secret", "--version"}, map[string]interface{}{"c": []string{"a"}, "o": "dir", "p": "secret", "v": true}},
+		{"equals", []string{"-o=dir", "--password=a=b"}, map[string]interface{}{"o": "dir", "p": "a=b"}},
+		{"empty value", []string{"-p=", "-o", "dir"}, map[string]interface{}{"p": "", "o": "dir"}},
+		{"array equals", []string{"-c=a", "b", "--compress=c"}, map[string]interface{}{"c": []string{"a", "b", "c"}}},
+		{"stdio", []string{"-c", "-", "-o=-"}, map[string]interface{}{"c": []string{"-"}, "o": "-"}},
+		{"bool equals", []string{"-quiet=false", "--f=true"}, map[string]interface{}{"quiet": false, "f": true}},
+		{"combined shorthands", []string{"-fP", "-v"}, map[string]interface{}{"f": true, "P": true, "v": true}},
+		{"registered before shorthands", []string{"-vv"}, map[string]interface{}{"vv": true, "v": false}},
+	}
+
+	for _, test := range tests {
+		flags := testFlagSet()
+		if err := flags.Parse(test.args); err != nil {
+			t.Fatalf("%s: failed to parse %v: %v", test.name, test.args, err)
+		}
+		for name, expected := range test.expected {
+			if value, _ := flags.Get(name); !reflect.DeepEqual(value, expected) {
+				t.Fatalf("%s: expected -%s to be %#v, got %#v", test.name, name, expected, value)
+			}
+		}
+	}
+}
+
+func TestFlagSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		args  []string
+		error string
+	}{
+		{[]string{"-unknown"}, "unknown flag: unknown"},
+		{[]string{"--help"}, "unknown flag: help"},
+		{[]string{"-o"}, "flag -o requires a value"},
+		{[]string{"--output", "-f"}, "flag -o requires a value"},
+		{[]string{"-c="}, "flag -c requires a value"},
+		{[]string{"-quiet=maybe"}, "flag -quiet takes true or false"},
+		// only single letter booleans combine
+		{[]string{"-fo"}, "unknown flag: fo"},
+		{[]string{"--fP"}, "unknown flag: fP"},
+		{[]string{"-fP=true"}, "unknown flag: fP"},
+		{[]string{"value"}, "invalid argument: value"},
+	}
+
+	for _, test := range tests {
+		err := testFlagSet().Parse(test.args)
+		if err == nil || !strings.Contains(err.Error(), test.error) {
+			t.Fatalf("%v: expected %q, got %v", test.args, test.error, err)
+		}
+	}
+}
+
+func TestFlagUsage(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = writer
+	testFlagSet().Usage()
+	os.Stdout = stdout
+	writer.Close()
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the flags are listed in the order they were registered, with their long names
+	usage := string(output)
+	for _, line := range []string{"  -c, --compress: inputs\n", "  -o, --output: output\n", "  -f: overwrite\n"} {
+		if !strings.Contains(usage, line) {
+			t.Fatalf("expected %q in the usage, got:\n%s", line, usage)
+		}
+	}
+	if strings.Index(usage, "-c, --compress") > strings.Index(usage, "-o, --output") {
+		t.Fatalf("expected the flags in the order they were registered, got:\n%s", usage)
+	}
+}
+
+func TestGetAllFileNamesFromDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"main.go", "debug.log", "Debug.LOG", "node_modules/pkg/index.js", ".git/HEAD", "src/.git/keep.go", "src/app.go"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths, excluded, err := GetAllFileNamesFromDir(&dir, []string{"*.log", ".git/**", "node_modules"})
+	if err != nil {
+		t.Fatalf("failed to walk: %v", err)
+	}
+	names := []string{}
+	for _, path := range paths {
+		relative, _ := filepath.Rel(dir, path)
+		names = append(names, filepath.ToSlash(relative))
+	}
+	slices.Sort(names)
+
+	// .git/** is anchored at dir, *.LOG is another pattern than *.log
+	expected := []string{"Debug.LOG", "main.go", "src/.git/keep.go", "src/app.go"}
+	if !slices.Equal(names, expected) {
+		t.Fatalf("expected %v, got %v", expected, names)
+	}
+	// debug.log, .git and node_modules, without the files below the directories
+	if excluded != 3 {
+		t.Fatalf("expected 3 excluded files and directories, got %d", excluded)
+	}
+
+	if _, _, err := GetAllFileNamesFromDir(&dir, []string{"["}); err == nil || !strings.Contains(err.Error(), "invalid pattern") {
+		t.Fatalf("expected an invalid pattern error, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// CancelableReader stops reading once Ctx is done. The codecs and the encryption read their
+// input in chunks of constants.BUFFER_SIZE, so the context is checked once per chunk.
+type CancelableReader struct {
+	Reader io.Reader
+	Ctx    context.Context
+}
+
+func (r *CancelableReader) Read(p []byte) (int, error) {
+	if err := r.Ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.Reader.Read(p)
+}
+
+// Seek lets the codecs rewind the files to compress and skip entries through the wrapper.
+func (r *CancelableReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := r.Reader.(io.Seeker)
+	if !ok {
+		return 0, errors.New("underlying reader does not support seeking")
+	}
+	return seeker.Seek(offset, whence)
+}
+
+// CancelReader wraps reader so it fails with ctx.Err() once ctx is done, or returns reader
+// unchanged when ctx can never be canceled.
+func CancelReader(ctx context.Context, reader io.Reader) io.Reader {
+	if ctx == nil || ctx.Done() == nil {
+		return reader
+	}
+	return &CancelableReader{Reader: reader, Ctx: ctx}
+}
+
+// ContextError returns the error of ctx when it is done, so callers see context.Canceled or
+// context.DeadlineExceeded instead of the wrapped read error, and err otherwise.
+func ContextError(ctx context.Context, err error) error {
+	if ctx != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
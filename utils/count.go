@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"bufio"
+	"io"
+)
+
+// CountingReader wraps an io.Reader, tracking how many bytes have been read and
+// whether the end of the input was reached.
+type CountingReader struct {
+	Reader    io.Reader
+	BytesRead int64
+	EOF       bool
+}
+
+func (c *CountingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.BytesRead += int64(n)
+	if err == io.EOF {
+		c.EOF = true
+	}
+	return n, err
+}
+
+// CountingWriter wraps an io.Writer, tracking how many bytes have been written.
+type CountingWriter struct {
+	Writer       io.Writer
+	BytesWritten int64
+}
+
+func (c *CountingWriter) Write(p []byte) (int, error) {
+	n, err := c.Writer.Write(p)
+	c.BytesWritten += int64(n)
+	return n, err
+}
+
+// BufferedWriteSeeker buffers the writes to an io.WriteSeeker like bufio.Writer, and flushes
+// the buffer before every seek, so the codecs that seek back to fill in the sizes can write
+// their output a few bytes at a time.
+type BufferedWriteSeeker struct {
+	writer *bufio.Writer
+	seeker io.Seeker
+}
+
+// NewBufferedWriteSeeker returns a BufferedWriteSeeker writing to ws through a buffer of size bytes.
+func NewBufferedWriteSeeker(ws io.WriteSeeker, size int) *BufferedWriteSeeker {
+	return &BufferedWriteSeeker{writer: bufio.NewWriterSize(ws, size), seeker: ws}
+}
+
+func (b *BufferedWriteSeeker) Write(p []byte) (int, error) {
+	return b.writer.Write(p)
+}
+
+// Seek writes the buffered data and seeks in the underlying writer.
+func (b *BufferedWriteSeeker) Seek(offset int64, whence int) (int64, error) {
+	if err := b.writer.Flush(); err != nil {
+		return 0, err
+	}
+	return b.seeker.Seek(offset, whence)
+}
+
+// Flush writes the buffered data to the underlying writer.
+func (b *BufferedWriteSeeker) Flush() error {
+	return b.writer.Flush()
+}
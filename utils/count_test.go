@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBufferedWriteSeeker(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// a header that is filled in after the data, like the codecs do
+	buffered := NewBufferedWriteSeeker(file, 16)
+	buffered.Write([]byte("????"))
+	buffered.Write([]byte("data"))
+	if _, err := buffered.Seek(-8, io.SeekCurrent); err != nil {
+		t.Fatalf("failed to seek: %v", err)
+	}
+	buffered.Write([]byte("size"))
+	if _, err := buffered.Seek(0, io.SeekEnd); err != nil {
+		t.Fatalf("failed to seek: %v", err)
+	}
+	buffered.Write([]byte("end"))
+	if err := buffered.Flush(); err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+
+	written, err := os.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != "sizedataend" {
+		t.Fatalf("expected %q, got %q", "sizedataend", written)
+	}
+}
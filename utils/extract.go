@@ -0,0 +1,325 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"file-compressor/constants"
+)
+
+// OverwritePolicy decides what an Extractor does with an entry whose file exists already.
+type OverwritePolicy string
+
+const (
+	// OVERWRITE_ERROR stops the extraction with a *FileExistsError, the existing file is left
+	// as it is.
+	OVERWRITE_ERROR OverwritePolicy = "error"
+	// OVERWRITE_REPLACE replaces the existing file.
+	OVERWRITE_REPLACE OverwritePolicy = "overwrite"
+	// OVERWRITE_RENAME extracts the entry next to the existing file with a number added before
+	// its extension, like InvalidateFileName does: notes.txt becomes notes_1.txt.
+	OVERWRITE_RENAME OverwritePolicy = "rename"
+	// OVERWRITE_SKIP keeps the existing file. The entry is still decoded, but nothing is written.
+	OVERWRITE_SKIP OverwritePolicy = "skip"
+)
+
+// FileExistsError is returned by Extractor.Create for an entry whose file exists already when
+// the policy is OVERWRITE_ERROR.
+type FileExistsError struct {
+	Path string
+}
+
+func (e *FileExistsError) Error() string {
+	return fmt.Sprintf("%s already exists", e.Path)
+}
+
+// Extractor creates the output files of an archive. It applies the extraction options that
+// are the same for every codec: name truncation, path limits, directory creation, split
+// output and the write rate limit. Codecs only decode the entry data into the writer.
+type Extractor struct {
+	outputPath string
+	options    Options
+	dirs       *DirCache
+	renamed    []RenamedEntry
+	paths      []string
+	progress   *ProgressTracker
+}
+
+// ExtractedEntry is the writer of a single extracted entry.
+type ExtractedEntry struct {
+	// Path is the path of the extracted file, or of its split descriptor.
+	Path string
+
+	name      string
+	extractor *Extractor
+	output    io.WriteCloser
+	writer    *CountingWriter
+	split     bool
+	skipped   bool
+	streamed  bool
+	modTime   time.Time
+	mode      os.FileMode
+}
+
+// NewExtractor creates an Extractor writing below outputPath, "." when empty.
+func NewExtractor(outputPath string, options Options) *Extractor {
+	if outputPath == "" {
+		outputPath = "." // Use the current directory if no output path is provided
+	}
+	total := options.ProgressTotal
+	if total <= 0 {
+		total = -1
+	}
+	progress := NewProgressTracker(options.ProgressEvents, options.ProgressInterval, PHASE_EXTRACT, total)
+	return &Extractor{outputPath: outputPath, options: options, dirs: NewDirCache(), progress: progress}
+}
+
+// Create opens the output of the entry with the given name, the writer of
+// Options.EntryWriter when it is set.
+//
+// Parameters:
+//   - name: the entry name stored in the archive
+//
+// Returns:
+//   - *ExtractedEntry: the writer of the entry, it must be closed
+//   - error: a *PathTraversalError if the entry would be written outside of the output path, a *PathLimitError
+//     if the path exceeds the limits, a *FileExistsError if its file exists and Options.Overwrite
+//     is OVERWRITE_ERROR, or an error if the output could not be created
+func (e *Extractor) Create(name string) (*ExtractedEntry, error) {
+	if e.options.EntryWriter != nil {
+		writer, err := e.options.EntryWriter(name)
+		if err != nil {
+			return nil, err
+		}
+		return &ExtractedEntry{
+			Path:      name,
+			name:      name,
+			extractor: e,
+			output:    nopWriteCloser{writer},
+			writer:    &CountingWriter{Writer: writer},
+			streamed:  true,
+		}, nil
+	}
+
+	entryName := name
+	if e.options.TruncateLongNames {
+		entryName = ShortenName(name, MAX_NAME_COMPONENT_LEN)
+		if entryName != name {
+			e.renamed = append(e.renamed, RenamedEntry{Original: name, Extracted: entryName})
+		}
+	}
+	fileName, err := ResolveEntryPath(e.outputPath, entryName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckPathLimits(entryName, fileName, e.options.MaxPathDepth, e.options.MaxPathLength); err != nil {
+		return nil, err
+	}
+
+	// each directory is created once per run, even for thousands of nested entries
+	if err := e.dirs.Ensure(filepath.Dir(fileName)); err != nil {
+		return nil, err
+	}
+
+	if e.outputExists(fileName) {
+		switch e.options.Overwrite {
+		case OVERWRITE_SKIP:
+			e.options.Warn(fmt.Sprintf("skipped %s, the file exists already", name))
+			return &ExtractedEntry{
+				Path:      fileName,
+				name:      name,
+				extractor: e,
+				output:    nopWriteCloser{io.Discard},
+				writer:    &CountingWriter{Writer: io.Discard},
+				skipped:   true,
+			}, nil
+		case OVERWRITE_RENAME:
+			renamed := e.availablePath(fileName)
+			e.options.Warn(fmt.Sprintf("extracted %s as %s, the file exists already", name, renamed))
+			fileName = renamed
+		case OVERWRITE_REPLACE:
+		default:
+			return nil, &FileExistsError{Path: e.existingPath(fileName)}
+		}
+	}
+
+	output, path, err := createOutput(fileName, e.options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExtractedEntry{
+		Path:      path,
+		name:      name,
+		extractor: e,
+		output:    output,
+		writer:    &CountingWriter{Writer: LimitWriter(output, e.options.WriteLimiter)},
+		split:     e.options.SplitSize > 0,
+	}, nil
+}
+
+// existingPath returns the file that exists when the entry is extracted to fileName, the
+// descriptor of split output.
+func (e *Extractor) existingPath(fileName string) string {
+	if e.options.SplitSize > 0 {
+		return fileName + SPLIT_DESCRIPTOR_EXT
+	}
+	return fileName
+}
+
+// outputExists reports whether extracting an entry to fileName would replace a file.
+func (e *Extractor) outputExists(fileName string) bool {
+	_, err := os.Lstat(LongPath(e.existingPath(fileName)))
+	return err == nil
+}
+
+// availablePath returns fileName with the first number added before its extension that does
+// not exist yet.
+func (e *Extractor) availablePath(fileName string) string {
+	ext := filepath.Ext(fileName)
+	base := strings.TrimSuffix(fileName, ext)
+	renamed := fileName
+	for count := 1; e.outputExists(renamed); count++ {
+		renamed = fmt.Sprintf("%s_%d%s", base, count, ext)
+	}
+	return renamed
+}
+
+// nopWriteCloser discards the data of a skipped entry.
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// Finish writes the rename manifest when names were shortened.
+//
+// Returns:
+//   - []string: the paths of all closed entries, followed by the manifest if one was written
+//   - error: if the manifest could not be written
+func (e *Extractor) Finish() ([]string, error) {
+	paths := e.paths
+
+	// keep the original names of shortened entries next to them
+	if len(e.renamed) > 0 {
+		manifestPath, err := WriteRenameManifest(e.outputPath, e.renamed)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, manifestPath)
+	}
+
+	return paths, nil
+}
+
+func (x *ExtractedEntry) Write(p []byte) (int, error) {
+	n, err := x.writer.Write(p)
+	x.extractor.progress.Add(x.name, int64(n))
+	return n, err
+}
+
+// BytesWritten returns the number of decompressed bytes written so far.
+func (x *ExtractedEntry) BytesWritten() int64 {
+	return x.writer.BytesWritten
+}
+
+// SetModTime sets the modification time applied to the file when it is closed.
+// The zero time keeps the time of extraction. Split output keeps it as well, the
+// parts are new files that are joined later.
+func (x *ExtractedEntry) SetModTime(modTime time.Time) {
+	x.modTime = modTime
+}
+
+// SetMode sets the permission bits applied to the file when it is closed, 0 keeps the defaults.
+// Split output keeps the defaults as well.
+func (x *ExtractedEntry) SetMode(mode os.FileMode) {
+	x.mode = mode.Perm()
+}
+
+// Close closes the output, restores the permissions and the modification time unless
+// Options.NoPreserveAttrs is set, and records the entry as extracted.
+func (x *ExtractedEntry) Close() error {
+	if err := x.output.Close(); err != nil {
+		return fmt.Errorf(constants.FILE_CLOSE_ERROR, err)
+	}
+	if x.skipped {
+		x.extractor.progress.Done(x.name)
+		return nil
+	}
+	if x.extractor.options.NoPreserveAttrs || x.streamed {
+		x.extractor.paths = append(x.extractor.paths, x.Path)
+		x.extractor.progress.Done(x.name)
+		return nil
+	}
+	if x.mode != 0 && !x.split {
+		// Windows only knows the read-only attribute, so permissions are applied best-effort there
+		if err := os.Chmod(LongPath(x.Path), x.mode); err != nil && runtime.GOOS != "windows" {
+			return fmt.Errorf("failed to set the permissions of %s: %v", x.Path, err)
+		}
+	}
+	if !x.modTime.IsZero() && !x.split {
+		if err := os.Chtimes(LongPath(x.Path), x.modTime, x.modTime); err != nil {
+			return fmt.Errorf("failed to set the modification time of %s: %v", x.Path, err)
+		}
+	}
+	x.extractor.paths = append(x.extractor.paths, x.Path)
+	x.extractor.progress.Done(x.name)
+	return nil
+}
+
+// Abort closes the output after a failed or canceled entry and removes what was written of it,
+// so no partial file is left behind. The removal is reported through Options.Warn. The data
+// written to an Options.EntryWriter is left to its caller.
+func (x *ExtractedEntry) Abort() {
+	if x.skipped || x.streamed {
+		return
+	}
+	var err error
+	if splitWriter, ok := x.output.(*SplitWriter); ok {
+		err = splitWriter.Abort()
+	} else {
+		x.output.Close()
+		err = os.Remove(LongPath(x.Path))
+	}
+
+	if err != nil {
+		x.extractor.options.Warn(fmt.Sprintf("failed to remove the partially extracted %s: %v", x.Path, err))
+		return
+	}
+	x.extractor.options.Warn("removed the partially extracted " + x.Path)
+}
+
+// createOutput opens the writer for an extracted entry. When a split size is configured the
+// entry is written through a SplitWriter and the returned name is its descriptor path.
+func createOutput(fileName string, options Options) (io.WriteCloser, string, error) {
+	if options.SplitSize > 0 {
+		splitWriter, err := NewSplitWriter(fileName, options.SplitSize)
+		if err != nil {
+			return nil, "", err
+		}
+		return splitWriter, splitWriter.DescriptorPath(), nil
+	}
+
+	// a file created since Create checked for it is not replaced either
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if options.Overwrite != OVERWRITE_REPLACE {
+		flags |= os.O_EXCL
+	}
+	outputFile, err := os.OpenFile(LongPath(fileName), flags, 0o666)
+	if os.IsExist(err) {
+		return nil, "", &FileExistsError{Path: fileName}
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf(constants.FILE_CREATE_ERROR, err)
+	}
+
+	return outputFile, fileName, nil
+}
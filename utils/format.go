@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ArchiveFormat is the container the compressed files are written in.
+type ArchiveFormat string
+
+const (
+	// NATIVE is the SquirrelZip archive, compressed with one of the algorithms.
+	NATIVE ArchiveFormat = "sq"
+	// TARGZ is a tar stream compressed with gzip, readable by tar and other tools. The
+	// algorithm is ignored.
+	TARGZ ArchiveFormat = "targz"
+)
+
+// ParseArchiveFormat parses the name of a format, sq or targz. tar.gz and tgz are accepted
+// for TARGZ.
+func ParseArchiveFormat(value string) (ArchiveFormat, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case string(NATIVE):
+		return NATIVE, nil
+	case string(TARGZ), "tar.gz", "tgz":
+		return TARGZ, nil
+	}
+	return "", fmt.Errorf("invalid format %q, it must be %s or %s", value, NATIVE, TARGZ)
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -14,17 +15,106 @@ type FileData struct {
 	Name   string
 	Size   int64
 	Reader io.Reader
+	// ModTime is the modification time of the source file, restored on extraction.
+	// The zero time is stored as unknown and leaves the extracted file untouched.
+	ModTime time.Time
+	// Mode holds the permission bits of the source file, restored on extraction. 0 leaves
+	// the extracted file with the default permissions.
+	Mode os.FileMode
+	// Link names an earlier file with the same content. The Huffman and BWT codecs store the
+	// file as a link to it without data, the others compress Reader as usual.
+	Link string
+}
+
+// TotalSize returns the sum of the sizes of files, the total reported to a ProgressFunc.
+func TotalSize(files []FileData) int64 {
+	total := int64(0)
+	for _, file := range files {
+		total += file.Size
+	}
+	return total
+}
+
+// UnixNanos converts a modification time to the value stored in an archive, 0 for the zero time.
+func UnixNanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// FromUnixNanos converts a stored modification time back, 0 gives the zero time.
+func FromUnixNanos(nanos int64) time.Time {
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
 }
 
 type Algorithm string
 
 const (
 	HUFFMAN Algorithm = "huffman"
+	// HUFFMAN_STREAM is written instead of HUFFMAN when the output cannot seek.
+	HUFFMAN_STREAM Algorithm = "huffman-stream"
 	ARITHMETIC Algorithm = "arithmetic"
+	LZ77 Algorithm = "lz77"
+	DEFLATE Algorithm = "deflate"
+	RLE Algorithm = "rle"
+	// BWT applies the Burrows-Wheeler transform and move-to-front coding before Huffman coding.
+	BWT Algorithm = "bwt"
+	// LZ4 uses the simplified LZ4 block format of the lz4fast package, fast but larger than the others.
+	LZ4 Algorithm = "lz4"
+	// BZIP2 can only be decompressed, from files made by other tools.
+	BZIP2 Algorithm = "bzip2"
+	// STORE keeps the data as it is.
+	STORE Algorithm = "store"
+	// LZ uses the Lempel-Ziv codec of the lampelziv package, with a window of up to 64 KB.
+	LZ Algorithm = "lz"
+	// AUTO picks HUFFMAN or STORE for every file from a sample of its content.
+	AUTO Algorithm = "auto"
 
 	UNSUPPORTED Algorithm = "unsupported"
 )
 
+// COMPRESSION_ALGORITHMS are the algorithms a user can compress with, HUFFMAN first as the
+// default. HUFFMAN_STREAM is picked by the codec itself and BZIP2 is only read.
+var COMPRESSION_ALGORITHMS = []Algorithm{HUFFMAN, ARITHMETIC, LZ77, DEFLATE, RLE, BWT, LZ4, LZ, STORE, AUTO}
+
+// ParseAlgorithm reads the name of an algorithm of COMPRESSION_ALGORITHMS, an empty name is
+// HUFFMAN.
+//
+// Parameters:
+//   - value: The name given by the user.
+//
+// Returns:
+//   - Algorithm: the algorithm to compress with
+//   - error: if value names no algorithm or one that cannot compress
+func ParseAlgorithm(value string) (Algorithm, error) {
+	if value == "" {
+		return HUFFMAN, nil
+	}
+	for _, algorithm := range COMPRESSION_ALGORITHMS {
+		if value == string(algorithm) {
+			return algorithm, nil
+		}
+	}
+	if value == string(BZIP2) {
+		return "", fmt.Errorf("%s can only be decompressed, choose one of %s", BZIP2, AlgorithmNames())
+	}
+	return "", fmt.Errorf("unsupported algorithm %q, choose one of %s", value, AlgorithmNames())
+}
+
+// AlgorithmNames returns the names of COMPRESSION_ALGORITHMS separated by commas, for help and
+// error messages.
+func AlgorithmNames() string {
+	names := make([]string, len(COMPRESSION_ALGORITHMS))
+	for i, algorithm := range COMPRESSION_ALGORITHMS {
+		names[i] = string(algorithm)
+	}
+	return strings.Join(names, ", ")
+}
+
 const (
 	FailedToCompress string = "failed to compress data: %v"
 	FailedToDecompress string = "failed to decompress data: %v"
@@ -44,16 +134,21 @@ const (
 	WHITE  COLOR = "\033[1;37m%s\033[0m"
 )
 
+// Messages receives everything ColorPrint and FilesRatio print. The CLI points it at os.Stderr
+// when the archive is written to stdout, so the messages do not end up in the archive.
+var Messages = NewPrinter(os.Stdout, false)
+
+// ColorPrint prints message to Messages, in color when it writes colors.
 func ColorPrint(color COLOR, message string) {
-	fmt.Printf(string(color), message)
+	Messages.Print(color, message)
 }
 
+// MakeOutputDir creates outputDir together with any missing parent directories. It
+// succeeds when the directory already exists.
 func MakeOutputDir(outputDir string) error {
-	if _, err := os.Stat(outputDir); os.IsNotExist(err) {
-		err := os.MkdirAll(outputDir, 0777)
-		if err != nil {
-			return fmt.Errorf("failed to create output directory: %v", err)
-		}
+	// MkdirAll is idempotent, checking for the directory first would only race with it
+	if err := os.MkdirAll(outputDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
 	}
 	return nil
 }
@@ -72,6 +167,30 @@ func FileSize(sizeBytes uint64) string {
 		float64(sizeBytes)/float64(div), "KMGTPE"[exp])
 }
 
+// ParseSize parses a human readable size such as "512", "64KB", "100MB" or "4G" into bytes.
+// Units are powers of 1024, matching FileSize.
+func ParseSize(size string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(size))
+	value = strings.TrimSuffix(value, "B")
+
+	multiplier := int64(1)
+	if value != "" {
+		if exp := strings.IndexByte("KMGTPE", value[len(value)-1]); exp >= 0 {
+			for i := 0; i <= exp; i++ {
+				multiplier *= 1024
+			}
+			value = value[:len(value)-1]
+		}
+	}
+
+	number, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid size: %s", size)
+	}
+
+	return number * multiplier, nil
+}
+
 func TimeTrack(startTime, endTime time.Time) string {
 	elapsedTime := endTime.Sub(startTime)
 	//return nanoseconds, microseconds, milliseconds, seconds, minutes, hours
@@ -111,18 +230,51 @@ func NewFilesRatio(initial, compressed uint64) FilesRatio {
 }
 
 func (f *FilesRatio) PrintFileInfo() {
-	fmt.Printf("Target size: %s\n", FileSize(f.inital))
-	fmt.Printf("Compressed size: %s\n", FileSize(f.compressed))
+	fmt.Fprintf(Messages, "Target size: %s\n", FileSize(f.inital))
+	fmt.Fprintf(Messages, "Compressed size: %s\n", FileSize(f.compressed))
 }
 
 func (f *FilesRatio) PrintCompressionRatio() {
 	compressionRatio := (float64(f.compressed) / float64(f.inital))  * 100
-	fmt.Printf("Compression ratio: %.2f%%\n", compressionRatio)
+	fmt.Fprintf(Messages, "Compression ratio: %.2f%%\n", compressionRatio)
 }
 
+// ArchiveName returns the default name of an archive of inputs, ext appended. A single input
+// keeps its full name, extension included, so report.pdf and report.txt do not both become
+// report.sq. Several inputs are named after the directory of the first one, and "archive" is
+// used when that is the root of the filesystem.
+//
+// Parameters:
+//   - inputs: the paths of the compressed files and directories, at least one
+//   - ext: the extension of the archive, such as constants.ARCHIVE_FILE_EXT
+//
+// Returns:
+//   - string: the file name of the archive, without a directory
+func ArchiveName(inputs []string, ext string) string {
+	path := inputs[0]
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if len(inputs) > 1 {
+		path = filepath.Dir(path)
+	}
+
+	name := filepath.Base(path)
+	if name == string(filepath.Separator) || name == "." {
+		name = "archive"
+	}
+	return name + ext
+}
+
+// InvalidateFileName returns the path of fileBase in outputDir, with a number added before the
+// extension when a file of that name exists already: report.pdf.sq becomes report.pdf_1.sq.
 func InvalidateFileName(fileBase string, outputDir string) string {
 	fileDir := filepath.Dir(fileBase)
 	fileExt := filepath.Ext(fileBase)
+	// the number goes before the whole .tar.gz, tar_1.gz is not understood by other tools
+	if strings.HasSuffix(fileBase, constants.TARGZ_FILE_EXT) {
+		fileExt = constants.TARGZ_FILE_EXT
+	}
 	fileBase = filepath.Base(fileBase)
 	originalName := strings.TrimSuffix(fileBase, fileExt)
 
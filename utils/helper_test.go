@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMakeOutputDirNested(t *testing.T) {
+	root := t.TempDir()
+	outputDir := filepath.Join(root, "output", "2024", "january")
+
+	if err := MakeOutputDir(outputDir); err != nil {
+		t.Fatalf("failed to create %s: %v", outputDir, err)
+	}
+	for _, dir := range []string{filepath.Join(root, "output"), filepath.Join(root, "output", "2024"), outputDir} {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			t.Fatalf("expected %s to be a directory: %v", dir, err)
+		}
+	}
+
+	// an existing directory is not an error
+	if err := MakeOutputDir(outputDir); err != nil {
+		t.Fatalf("creating %s again failed: %v", outputDir, err)
+	}
+
+	file := filepath.Join(root, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := MakeOutputDir(filepath.Join(file, "dir")); err == nil {
+		t.Fatal("creating a directory below a file should fail")
+	}
+}
+
+func TestArchiveName(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		inputs []string
+		want   string
+	}{
+		{[]string{filepath.Join(dir, "report.pdf")}, "report.pdf.sq"},
+		{[]string{filepath.Join(dir, "report.txt")}, "report.txt.sq"},
+		{[]string{filepath.Join(dir, "photos")}, "photos.sq"},
+		{[]string{filepath.Join(dir, "photos", "a.jpg"), filepath.Join(dir, "b.jpg")}, "photos.sq"},
+		{[]string{string(filepath.Separator) + "a.txt", string(filepath.Separator) + "b.txt"}, "archive.sq"},
+	}
+
+	for _, test := range tests {
+		if got := ArchiveName(test.inputs, ".sq"); got != test.want {
+			t.Errorf("ArchiveName(%v) = %s, want %s", test.inputs, got, test.want)
+		}
+	}
+}
+
+func TestInvalidateFileName(t *testing.T) {
+	dir := t.TempDir()
+
+	if got := InvalidateFileName("report.pdf.sq", dir); got != filepath.Join(dir, "report.pdf.sq") {
+		t.Fatalf("expected an unused name to be kept, got %s", got)
+	}
+
+	// the number goes before the archive extension, the original extension stays
+	for _, name := range []string{"report.pdf.sq", "report.pdf_1.sq"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := InvalidateFileName("report.pdf.sq", dir); got != filepath.Join(dir, "report.pdf_2.sq") {
+		t.Fatalf("expected report.pdf_2.sq, got %s", got)
+	}
+	if got := InvalidateFileName("report.txt.sq", dir); got != filepath.Join(dir, "report.txt.sq") {
+		t.Fatalf("expected a different extension not to collide, got %s", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "report.pdf.tar.gz"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := InvalidateFileName("report.pdf.tar.gz", dir); got != filepath.Join(dir, "report.pdf_1.tar.gz") {
+		t.Fatalf("expected report.pdf_1.tar.gz, got %s", got)
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	tests := map[string]Algorithm{"": HUFFMAN, "huffman": HUFFMAN, "lz4": LZ4, "auto": AUTO, "store": STORE}
+	for value, expected := range tests {
+		algorithm, err := ParseAlgorithm(value)
+		if err != nil || algorithm != expected {
+			t.Fatalf("ParseAlgorithm(%q) = %q, %v, expected %q", value, algorithm, err, expected)
+		}
+	}
+
+	// bzip2 and the streamed huffman are only read, never chosen
+	for _, value := range []string{"bzip2", "huffman-stream", "zip", "LZ4"} {
+		if _, err := ParseAlgorithm(value); err == nil || !strings.Contains(err.Error(), AlgorithmNames()) {
+			t.Fatalf("expected an error listing the algorithms for %q, got %v", value, err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CompressionLevel trades the speed of the compression for the size of the archive, from
+// LevelFast to LevelBest. 0 keeps the default of every codec.
+type CompressionLevel int
+
+const (
+	// LevelFast compresses the fastest and makes the largest archives.
+	LevelFast CompressionLevel = 1
+	// LevelDefault balances the speed and the size.
+	LevelDefault CompressionLevel = 5
+	// LevelBest makes the smallest archives and compresses the slowest.
+	LevelBest CompressionLevel = 9
+)
+
+// levelNames are the names ParseCompressionLevel accepts instead of a number.
+var levelNames = map[string]CompressionLevel{
+	"fast":     LevelFast,
+	"balanced": LevelDefault,
+	"default":  LevelDefault,
+	"best":     LevelBest,
+}
+
+// ParseCompressionLevel parses a level from LevelFast to LevelBest, given as a number or as
+// fast, balanced or best.
+func ParseCompressionLevel(value string) (CompressionLevel, error) {
+	name := strings.ToLower(strings.TrimSpace(value))
+	if level, ok := levelNames[name]; ok {
+		return level, nil
+	}
+
+	number, err := strconv.Atoi(name)
+	if err != nil || number < int(LevelFast) || number > int(LevelBest) {
+		return 0, fmt.Errorf("invalid level %q, it must be between %d and %d, fast, balanced or best", value, LevelFast, LevelBest)
+	}
+	return CompressionLevel(number), nil
+}
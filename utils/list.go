@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// EntryInfo describes an archive entry as stored in its header, without its data.
+type EntryInfo struct {
+	Name string `json:"name"`
+	// OriginalSize is the size of the entry once extracted.
+	OriginalSize uint64 `json:"original_size"`
+	// CompressedSize is the size of the entry data in the archive.
+	CompressedSize uint64 `json:"compressed_size"`
+	// ModTime is the zero time when the archive does not know it.
+	ModTime time.Time   `json:"mod_time"`
+	Mode    os.FileMode `json:"mode"`
+	// Algorithm is the compression algorithm of the archive the entry belongs to.
+	Algorithm string `json:"algorithm,omitempty"`
+	// Checksum is the CRC-32 of the original data in hexadecimal, see FormatChecksum.
+	Checksum string `json:"checksum"`
+}
+
+// FormatChecksum formats the CRC-32 stored in an entry header for EntryInfo.Checksum.
+func FormatChecksum(crc uint32) string {
+	return fmt.Sprintf("%08x", crc)
+}
+
+// EntriesAlgorithm returns the algorithm shared by all entries, or an empty string when the
+// entries of a utils.AUTO archive use different ones.
+func EntriesAlgorithm(entries []EntryInfo) string {
+	if len(entries) == 0 {
+		return ""
+	}
+	for _, entry := range entries[1:] {
+		if entry.Algorithm != entries[0].Algorithm {
+			return ""
+		}
+	}
+	return entries[0].Algorithm
+}
+
+// EntryTable renders the entries as columns followed by the totals. The algorithm of every
+// entry is shown in front of its name when they do not share one.
+func EntryTable(entries []EntryInfo) string {
+	var sb strings.Builder
+
+	// the name column is the last one, the algorithm becomes part of it
+	mixed := len(entries) > 0 && EntriesAlgorithm(entries) == ""
+	name := func(entry EntryInfo) string {
+		if mixed {
+			return fmt.Sprintf("%-15s %s", entry.Algorithm, entry.Name)
+		}
+		return entry.Name
+	}
+
+	header := "NAME"
+	if mixed {
+		header = fmt.Sprintf("%-15s %s", "ALGORITHM", "NAME")
+	}
+	fmt.Fprintf(&sb, "%-10s %12s %12s %-19s %-8s %s\n", "MODE", "SIZE", "COMPRESSED", "MODIFIED", "CRC32", header)
+
+	var originalTotal, compressedTotal uint64
+	for _, entry := range entries {
+		modified := "-"
+		if !entry.ModTime.IsZero() {
+			modified = entry.ModTime.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(&sb, "%-10s %12s %12s %-19s %-8s %s\n", entry.Mode.Perm(), FileSize(entry.OriginalSize), FileSize(entry.CompressedSize), modified, entry.Checksum, name(entry))
+
+		originalTotal += entry.OriginalSize
+		compressedTotal += entry.CompressedSize
+	}
+
+	fmt.Fprintf(&sb, "%-10s %12s %12s %-19s %-8s %d files\n", "", FileSize(originalTotal), FileSize(compressedTotal), "", "", len(entries))
+
+	return sb.String()
+}
+
+// EntriesJSON renders the entries as indented JSON.
+func EntriesJSON(entries []EntryInfo) ([]byte, error) {
+	if entries == nil {
+		entries = []EntryInfo{}
+	}
+	return json.MarshalIndent(entries, "", "  ")
+}
+
+// SkipBytes advances r by n bytes. A reader that can seek is moved without reading, so a
+// truncated input is only noticed by the next read. The wrappers such as CancelableReader
+// implement io.Seeker whether the reader below them can seek or not, so the position is
+// queried first and the bytes are read and discarded when that fails.
+func SkipBytes(r io.Reader, n uint64) error {
+	if seeker, ok := r.(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			_, err = seeker.Seek(int64(n), io.SeekCurrent)
+			return err
+		}
+	}
+
+	skipped, err := io.CopyN(io.Discard, r, int64(n))
+	if err == io.EOF {
+		return fmt.Errorf("input ends %d bytes early", int64(n)-skipped)
+	}
+	return err
+}
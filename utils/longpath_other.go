@@ -0,0 +1,8 @@
+//go:build !windows
+
+package utils
+
+// LongPath returns path unchanged, only Windows needs a prefix for long paths.
+func LongPath(path string) string {
+	return path
+}
@@ -0,0 +1,31 @@
+//go:build windows
+
+package utils
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// windowsMaxPath is the length from which Windows needs the extended-length prefix.
+// Directories are limited to MAX_PATH minus room for an 8.3 file name.
+const windowsMaxPath = 248
+
+// LongPath adds the \\?\ extended-length prefix to paths that would otherwise hit the
+// MAX_PATH limit, so deep hierarchies can be created and opened on Windows.
+func LongPath(path string) string {
+	if len(path) < windowsMaxPath || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	// UNC paths use \\?\UNC\server\share
+	if strings.HasPrefix(absolute, `\\`) {
+		return `\\?\UNC\` + absolute[2:]
+	}
+	return `\\?\` + absolute
+}
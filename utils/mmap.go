@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"file-compressor/constants"
+)
+
+// DEFAULT_MMAP_THRESHOLD is the size from which the files to compress are mapped into memory
+// instead of read, see WithMmapThreshold.
+const DEFAULT_MMAP_THRESHOLD = 64 << 20
+
+// mappedFile reads a file mapped into memory. The codecs read it like any other file, but the
+// data is copied straight from the page cache instead of through a read buffer.
+type mappedFile struct {
+	*bytes.Reader
+	data []byte
+	file *os.File
+}
+
+// Close unmaps the data and closes the file.
+func (m *mappedFile) Close() error {
+	err := munmap(m.data)
+	m.Reader = bytes.NewReader(nil)
+	if closeErr := m.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// MmapReader maps f into memory and returns a reader over it from its start, which also seeks
+// and implements io.ReaderAt. When f cannot be mapped, because it is empty, not a regular file
+// or the platform has no mmap, f itself is returned and read as usual. Closing the reader
+// closes f. A file that is truncated while it is mapped may crash the process when the missing
+// pages are read, it is only meant for files that do not change while they are compressed.
+//
+// Parameters:
+//   - f: The file to read, opened for reading.
+//
+// Returns:
+//   - io.ReadCloser: the reader of the mapped file, or f
+//   - error: if the size of f cannot be read
+func MmapReader(f *os.File) (io.ReadCloser, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+
+	// an empty mapping is invalid, and a file larger than the address space is read instead
+	size := info.Size()
+	if !info.Mode().IsRegular() || size <= 0 || int64(int(size)) != size {
+		return f, nil
+	}
+
+	data, err := mmap(f, int(size))
+	if err != nil {
+		return f, nil
+	}
+	return &mappedFile{Reader: bytes.NewReader(data), data: data, file: f}, nil
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMmapReaderRoundtrip(t *testing.T) {
+	data := make([]byte, 3<<20+17)
+	rand.New(rand.NewSource(1)).Read(data)
+	path := filepath.Join(t.TempDir(), "large.bin")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := MmapReader(file)
+	if err != nil {
+		t.Fatalf("failed to map the file: %v", err)
+	}
+	defer reader.Close()
+
+	read, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to read the mapped file: %v", err)
+	}
+	if !bytes.Equal(read, expected) {
+		t.Fatal("the mapped file does not match os.ReadFile")
+	}
+
+	// the codecs read the files twice, the first time for the Huffman codes
+	seeker, ok := reader.(io.Seeker)
+	if !ok {
+		t.Fatalf("expected the reader to seek, got %T", reader)
+	}
+	if _, err := seeker.Seek(1<<20, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if read, err := io.ReadAll(reader); err != nil || !bytes.Equal(read, expected[1<<20:]) {
+		t.Fatalf("the mapped file does not match after seeking: %v", err)
+	}
+}
+
+func TestMmapReaderEmptyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.bin")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an empty file cannot be mapped and is read as it is
+	reader, err := MmapReader(file)
+	if err != nil {
+		t.Fatalf("expected the empty file to be read, got %v", err)
+	}
+	if reader != io.ReadCloser(file) {
+		t.Fatalf("expected the file itself, got %T", reader)
+	}
+	if err := reader.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
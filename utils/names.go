@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"file-compressor/constants"
+)
+
+const (
+	// MAX_NAME_COMPONENT_LEN is the longest file or directory name, in bytes, that common
+	// filesystems (ext4, XFS, APFS, NTFS) accept.
+	MAX_NAME_COMPONENT_LEN = 255
+
+	// RENAMED_MANIFEST is written to the output directory when extraction shortens names.
+	RENAMED_MANIFEST = "renamed-entries.json"
+
+	// shortHashLen is the number of hex digits of the SHA-256 hash appended to a shortened name.
+	shortHashLen = 8
+)
+
+// RenamedEntry records an entry that was extracted under a shortened name.
+type RenamedEntry struct {
+	Original  string `json:"original"`
+	Extracted string `json:"extracted"`
+}
+
+// splitName splits an entry name into its components, accepting both separators.
+func splitName(name string) []string {
+	return strings.Split(filepath.ToSlash(name), "/")
+}
+
+// LongNameComponents returns the components of name that are longer than max bytes.
+func LongNameComponents(name string, max int) []string {
+	long := []string{}
+	for _, component := range splitName(name) {
+		if len(component) > max {
+			long = append(long, component)
+		}
+	}
+	return long
+}
+
+// ShortenComponent shortens a single file or directory name to at most max bytes.
+// Names that fit are returned unchanged. Longer names keep as much of their start as fits,
+// followed by "~" and a short hash of the full name so different names stay different,
+// and the original extension. The result only depends on the input, so the same name is
+// always shortened the same way, and it is always valid UTF-8 when the input is.
+//
+// Parameters:
+//   - component: the name to shorten, without separators
+//   - max: the maximum length in bytes, at least 32 so the hash and an extension fit
+//
+// Returns:
+//   - string: the shortened name
+func ShortenComponent(component string, max int) string {
+	if len(component) <= max {
+		return component
+	}
+
+	sum := sha256.Sum256([]byte(component))
+	suffix := "~" + hex.EncodeToString(sum[:])[:shortHashLen]
+
+	// an extension that would take most of the budget is not worth preserving
+	ext := filepath.Ext(component)
+	if len(ext)+len(suffix) > max/2 {
+		ext = ""
+	}
+
+	keep := max - len(suffix) - len(ext)
+	if keep < 0 {
+		keep = 0
+	}
+	// do not cut a multi-byte character in half
+	for keep > 0 && !utf8.RuneStart(component[keep]) {
+		keep--
+	}
+
+	return component[:keep] + suffix + ext
+}
+
+// ShortenName applies ShortenComponent to every component of an entry name.
+//
+// Parameters:
+//   - name: the entry name
+//   - max: the maximum length in bytes of every component
+//
+// Returns:
+//   - string: the name with long components shortened, using the OS separator
+func ShortenName(name string, max int) string {
+	components := splitName(name)
+	for i, component := range components {
+		components[i] = ShortenComponent(component, max)
+	}
+	return filepath.FromSlash(strings.Join(components, "/"))
+}
+
+// WriteRenameManifest writes the list of renamed entries to RENAMED_MANIFEST in dir.
+//
+// Parameters:
+//   - dir: the output directory
+//   - entries: the renamed entries
+//
+// Returns:
+//   - string: the path of the manifest
+//   - error: if the manifest could not be written
+func WriteRenameManifest(dir string, entries []RenamedEntry) (string, error) {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode renamed entries: %v", err)
+	}
+
+	path := filepath.Join(dir, RENAMED_MANIFEST)
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		return "", fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+
+	return path, nil
+}
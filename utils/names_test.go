@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestShortenComponentKeepsShortNames(t *testing.T) {
+	for _, name := range []string{"", "a.txt", strings.Repeat("a", MAX_NAME_COMPONENT_LEN)} {
+		if got := ShortenComponent(name, MAX_NAME_COMPONENT_LEN); got != name {
+			t.Errorf("%q should be unchanged, got %q", name, got)
+		}
+	}
+}
+
+func TestShortenComponent(t *testing.T) {
+	long := strings.Repeat("report-", 60) + ".tar.gz"
+
+	short := ShortenComponent(long, MAX_NAME_COMPONENT_LEN)
+	if len(short) != MAX_NAME_COMPONENT_LEN {
+		t.Fatalf("expected %d bytes, got %d", MAX_NAME_COMPONENT_LEN, len(short))
+	}
+	if !strings.HasPrefix(short, "report-report-") {
+		t.Fatalf("the start of the name should be kept: %s", short)
+	}
+	if !strings.HasSuffix(short, ".gz") {
+		t.Fatalf("the extension should be kept: %s", short)
+	}
+	if !strings.Contains(short, "~") {
+		t.Fatalf("a hash should be appended: %s", short)
+	}
+
+	if again := ShortenComponent(long, MAX_NAME_COMPONENT_LEN); again != short {
+		t.Fatalf("shortening should be deterministic: %s != %s", again, short)
+	}
+
+	// names that only differ after the cut must not collide
+	other := strings.Repeat("report-", 60) + "x.tar.gz"
+	if ShortenComponent(other, MAX_NAME_COMPONENT_LEN) == short {
+		t.Fatal("different names should shorten differently")
+	}
+}
+
+func TestShortenComponentMultiByte(t *testing.T) {
+	long := strings.Repeat("ü", 200) + ".txt" // 404 bytes
+
+	for max := 32; max < 80; max++ {
+		short := ShortenComponent(long, max)
+		if len(short) > max {
+			t.Fatalf("max %d: got %d bytes", max, len(short))
+		}
+		if !utf8.ValidString(short) {
+			t.Fatalf("max %d: a character was cut in half: %q", max, short)
+		}
+	}
+}
+
+func TestShortenComponentDropsHugeExtension(t *testing.T) {
+	long := "a." + strings.Repeat("x", 300)
+
+	short := ShortenComponent(long, MAX_NAME_COMPONENT_LEN)
+	if len(short) > MAX_NAME_COMPONENT_LEN {
+		t.Fatalf("expected at most %d bytes, got %d", MAX_NAME_COMPONENT_LEN, len(short))
+	}
+}
+
+func TestShortenName(t *testing.T) {
+	longDir := strings.Repeat("d", 300)
+	longFile := strings.Repeat("f", 300) + ".txt"
+	name := filepath.Join("root", longDir, "ok", longFile)
+
+	if got := LongNameComponents(name, MAX_NAME_COMPONENT_LEN); len(got) != 2 {
+		t.Fatalf("expected 2 long components, got %d", len(got))
+	}
+
+	short := ShortenName(name, MAX_NAME_COMPONENT_LEN)
+	components := strings.Split(short, string(filepath.Separator))
+	if len(components) != 4 || components[0] != "root" || components[2] != "ok" {
+		t.Fatalf("only long components should change: %s", short)
+	}
+	if len(LongNameComponents(short, MAX_NAME_COMPONENT_LEN)) != 0 {
+		t.Fatalf("no component should be too long after shortening: %s", short)
+	}
+	if !strings.HasSuffix(short, ".txt") {
+		t.Fatalf("the extension should be kept: %s", short)
+	}
+}
@@ -0,0 +1,478 @@
+package utils
+
+import (
+	"context"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"file-compressor/constants"
+	"file-compressor/metrics"
+)
+
+// Options holds the optional settings shared by the compressor and the codec packages.
+// The zero value keeps the default behavior.
+type Options struct {
+	// SplitSize caps the size of every extracted file. When greater than zero, each
+	// entry is written as a series of numbered parts plus a JSON descriptor.
+	SplitSize int64
+	// Metrics receives per entry measurements. NewOptions sets it to metrics.Nop when unset.
+	Metrics metrics.Metrics
+	// MaxPathDepth and MaxPathLength limit extracted paths. NewOptions sets them to
+	// DEFAULT_MAX_PATH_DEPTH and DEFAULT_MAX_PATH_LENGTH when unset.
+	MaxPathDepth  int
+	MaxPathLength int
+	// ReadLimiter throttles reading the files to compress, WriteLimiter throttles writing
+	// extracted files. Nil means no limit.
+	ReadLimiter  *RateLimiter
+	WriteLimiter *RateLimiter
+	// TruncateLongNames shortens extracted names with components longer than
+	// MAX_NAME_COMPONENT_LEN and records the original names in RENAMED_MANIFEST.
+	TruncateLongNames bool
+	// Overwrite decides what extraction does with the files that exist already. NewOptions sets
+	// it to OVERWRITE_ERROR when unset.
+	Overwrite OverwritePolicy
+	// NoPreserveAttrs leaves the modification time and the permissions of extracted files at
+	// the values of the extraction instead of restoring the stored ones.
+	NoPreserveAttrs bool
+	// KeepPaths stores the files to compress under the paths they were given as, instead of
+	// paths relative to the argument they were found through.
+	KeepPaths bool
+	// Exclude skips the files to compress, and the directories below the inputs, whose names
+	// match one of these patterns, see MatchesAnyPattern.
+	Exclude []string
+	// Excluded receives the name of every file and directory skipped because of Exclude, the
+	// contents of a skipped directory are not read. NewOptions sets it to a no-op when unset.
+	Excluded func(name string, dir bool)
+	// Entries limits extraction to the entries matching one of these patterns, see MatchEntry.
+	// Empty extracts every entry.
+	Entries []string
+	// EntryWriter receives the data of the extracted entries instead of files below the output
+	// directory, see WithEntryWriter. Nil extracts to files.
+	EntryWriter func(name string) (io.Writer, error)
+	// Progress is called after every file is compressed or extracted. NewOptions sets it to a
+	// no-op when unset.
+	Progress ProgressFunc
+	// ProgressEvents receives the progress within files while they are compressed or
+	// extracted, at most every ProgressInterval bytes. Nil reports nothing.
+	ProgressEvents   ProgressEventFunc
+	ProgressInterval int64
+	// ProgressTotal is the total reported by extraction events, the compressor sets it from
+	// the sizes stored in the archive. 0 reports the total as unknown.
+	ProgressTotal int64
+	// Context cancels reading the files to compress. NewOptions sets it to context.Background
+	// when unset.
+	Context context.Context
+	// Warn receives the problems that do not stop the operation, such as names too long to
+	// extract. NewOptions sets it to print the message in yellow when unset.
+	Warn func(message string)
+	// Threads is the number of files the Huffman codecs compress at the same time. NewOptions
+	// sets it to 1 when unset, which compresses the files one after another without buffering.
+	Threads int
+	// BufferSize is the size of the buffers the archive is written and read through.
+	// NewOptions sets it to constants.BUFFER_SIZE when unset.
+	BufferSize int
+	// FormatVersion is the format version of the archive being read, 0 for the current one.
+	FormatVersion uint16
+	// AlgorithmChosen receives the algorithm AUTO picked for every file, before it is compressed.
+	// NewOptions sets it to do nothing when unset.
+	AlgorithmChosen func(filename string, algorithm Algorithm)
+	// NoSolidNames builds the Huffman codes from the data of the files only, the names are
+	// coded with them but do not count towards the frequencies. The archives are usually a
+	// little larger, but the codes no longer depend on the names.
+	NoSolidNames bool
+	// WindowSize is how far back the matches of the lz codec reach, 0 keeps its default.
+	WindowSize int
+	// Level trades speed for size, from LevelFast to LevelBest, 0 keeps the default of every
+	// codec. Deflate passes it to its encoder and lz picks its window from it, see
+	// WithWindowSize. The other codecs accept it but always compress the same way.
+	Level CompressionLevel
+	// ArchiveFormat is the container the files are compressed into, NATIVE when empty. With
+	// TARGZ the algorithm is ignored and gzip uses Level.
+	ArchiveFormat ArchiveFormat
+	// SpillThreshold is the number of bytes a buffer of the codecs keeps in memory before it
+	// moves to a temporary file. NewOptions sets it to DEFAULT_SPILL_THRESHOLD when unset.
+	SpillThreshold int
+	// MmapThreshold is the size from which the files to compress are mapped into memory, see
+	// MmapReader. NewOptions sets it to DEFAULT_MMAP_THRESHOLD when unset, a negative value
+	// never maps them.
+	MmapThreshold int64
+	// SignKey signs the archive once it is written, see encryption.SignArchive. Nil leaves it
+	// unsigned.
+	SignKey ed25519.PrivateKey
+	// VerifyKey checks the signature of the archive before anything is extracted, see
+	// encryption.VerifyArchive. Nil extracts signed and unsigned archives without a check.
+	VerifyKey ed25519.PublicKey
+}
+
+// ProgressFunc receives the name and the original size of a file once it is processed, and the
+// total size of all files of the operation, or -1 when it is not known in advance.
+type ProgressFunc func(filename string, bytesProcessed, totalBytes int64)
+
+// Option configures an Options value.
+type Option func(*Options)
+
+// WithSplitOutput makes extraction write every entry in parts of at most size bytes.
+func WithSplitOutput(size int64) Option {
+	return func(o *Options) {
+		o.SplitSize = size
+	}
+}
+
+// WithMetrics reports byte counts, entry counts, errors and durations to m.
+func WithMetrics(m metrics.Metrics) Option {
+	return func(o *Options) {
+		o.Metrics = m
+	}
+}
+
+// WithMaxPath limits the number of components and the length of extracted paths.
+// Zero keeps the default limit.
+func WithMaxPath(depth, length int) Option {
+	return func(o *Options) {
+		o.MaxPathDepth = depth
+		o.MaxPathLength = length
+	}
+}
+
+// WithRateLimits throttles the input files while compressing and the extracted files while
+// decompressing. The limiters may be shared with other pipelines, the limit then applies to all of them.
+func WithRateLimits(read, write *RateLimiter) Option {
+	return func(o *Options) {
+		o.ReadLimiter = read
+		o.WriteLimiter = write
+	}
+}
+
+// WithOverwrite sets what extraction does with the files that exist already, see
+// OverwritePolicy.
+func WithOverwrite(policy OverwritePolicy) Option {
+	return func(o *Options) {
+		o.Overwrite = policy
+	}
+}
+
+// WithSignKey signs the written archive with key.
+func WithSignKey(key ed25519.PrivateKey) Option {
+	return func(o *Options) {
+		o.SignKey = key
+	}
+}
+
+// WithVerifyKey makes extraction fail unless the archive carries a signature matching key.
+func WithVerifyKey(key ed25519.PublicKey) Option {
+	return func(o *Options) {
+		o.VerifyKey = key
+	}
+}
+
+// WithTruncateLongNames shortens long names on extraction instead of failing with the OS error.
+func WithTruncateLongNames(enabled bool) Option {
+	return func(o *Options) {
+		o.TruncateLongNames = enabled
+	}
+}
+
+// WithNoPreserveAttrs skips restoring the stored modification times and permissions on extraction.
+func WithNoPreserveAttrs(enabled bool) Option {
+	return func(o *Options) {
+		o.NoPreserveAttrs = enabled
+	}
+}
+
+// WithKeepPaths stores the compressed files under the paths they were given as, absolute
+// paths included, instead of paths relative to their argument.
+func WithKeepPaths(enabled bool) Option {
+	return func(o *Options) {
+		o.KeepPaths = enabled
+	}
+}
+
+// WithExclude skips the files and directories matching one of the patterns while the inputs
+// are collected for compression.
+func WithExclude(patterns []string) Option {
+	return func(o *Options) {
+		o.Exclude = patterns
+	}
+}
+
+// WithExcluded passes the files and directories skipped because of WithExclude to fn.
+func WithExcluded(fn func(name string, dir bool)) Option {
+	return func(o *Options) {
+		o.Excluded = fn
+	}
+}
+
+// WithEntries extracts only the entries matching one of the patterns and skips the others.
+func WithEntries(patterns []string) Option {
+	return func(o *Options) {
+		o.Entries = patterns
+	}
+}
+
+// WithEntryWriter extracts every entry to the writer fn returns for its name instead of a
+// file, nothing is written below the output directory. The paths, limits and overwrite options
+// do not apply, and neither do the modification time and the permissions.
+func WithEntryWriter(fn func(name string) (io.Writer, error)) Option {
+	return func(o *Options) {
+		o.EntryWriter = fn
+	}
+}
+
+// WithProgress calls fn after every file is compressed or extracted.
+func WithProgress(fn ProgressFunc) Option {
+	return func(o *Options) {
+		o.Progress = fn
+	}
+}
+
+// WithProgressEvents sends events to fn while files are compressed or extracted, at most one
+// every interval bytes plus a final one per file. An interval of 0 uses DEFAULT_PROGRESS_INTERVAL.
+func WithProgressEvents(fn ProgressEventFunc, interval int64) Option {
+	return func(o *Options) {
+		o.ProgressEvents = fn
+		o.ProgressInterval = interval
+	}
+}
+
+// WithThreads compresses up to n files at the same time, n of 0 or less uses one thread per
+// CPU. The archive is the same as with a single thread.
+func WithThreads(n int) Option {
+	return func(o *Options) {
+		if n <= 0 {
+			n = runtime.GOMAXPROCS(0)
+		}
+		o.Threads = n
+	}
+}
+
+// WithBufferSize writes and reads the archive through buffers of n bytes, n of 0 or less keeps
+// constants.BUFFER_SIZE.
+func WithBufferSize(n int) Option {
+	return func(o *Options) {
+		o.BufferSize = n
+	}
+}
+
+// WithNoSolidNames leaves the file names out of the frequencies the Huffman codes are built
+// from, the data of all files still shares one set of codes.
+func WithNoSolidNames(enabled bool) Option {
+	return func(o *Options) {
+		o.NoSolidNames = enabled
+	}
+}
+
+// WithWindowSize sets how many bytes back the matches of the lz codec reach. Larger windows
+// find more matches but compress slower, the window is not needed to decompress. It takes
+// precedence over the window of WithLevel.
+func WithWindowSize(n int) Option {
+	return func(o *Options) {
+		o.WindowSize = n
+	}
+}
+
+// WithLevel sets the compression level, from LevelFast for the fastest to LevelBest for the
+// smallest archives. The level is not needed to decompress.
+func WithLevel(level CompressionLevel) Option {
+	return func(o *Options) {
+		o.Level = level
+	}
+}
+
+// WithArchiveFormat writes the files in format instead of the SquirrelZip archive. Extraction
+// recognizes the format by itself.
+func WithArchiveFormat(format ArchiveFormat) Option {
+	return func(o *Options) {
+		o.ArchiveFormat = format
+	}
+}
+
+// WithSpillThreshold keeps up to n bytes of a codec buffer in memory, such as the content of a
+// file that cannot seek, and moves larger buffers to temporary files. n of 0 or less keeps
+// DEFAULT_SPILL_THRESHOLD.
+func WithSpillThreshold(n int) Option {
+	return func(o *Options) {
+		o.SpillThreshold = n
+	}
+}
+
+// WithMmapThreshold maps the files of at least n bytes into memory while they are compressed
+// instead of reading them through a buffer. n of 0 keeps DEFAULT_MMAP_THRESHOLD, a negative n
+// reads every file.
+func WithMmapThreshold(n int64) Option {
+	return func(o *Options) {
+		o.MmapThreshold = n
+	}
+}
+
+// WithProgressTotal sets the total reported by extraction events.
+func WithProgressTotal(total int64) Option {
+	return func(o *Options) {
+		o.ProgressTotal = total
+	}
+}
+
+// WithContext stops compressing with ctx.Err() once ctx is done.
+func WithContext(ctx context.Context) Option {
+	return func(o *Options) {
+		o.Context = ctx
+	}
+}
+
+// WithWarnings passes the warnings of the operation to fn instead of printing them.
+func WithWarnings(fn func(message string)) Option {
+	return func(o *Options) {
+		o.Warn = fn
+	}
+}
+
+// WithFormatVersion reads the archive as the given format version, the container header tells
+// which one it is.
+func WithFormatVersion(version uint16) Option {
+	return func(o *Options) {
+		o.FormatVersion = version
+	}
+}
+
+// WithAlgorithmChoices passes the algorithm AUTO picks for every file to fn.
+func WithAlgorithmChoices(fn func(filename string, algorithm Algorithm)) Option {
+	return func(o *Options) {
+		o.AlgorithmChosen = fn
+	}
+}
+
+// Selects reports whether the entry with the given name is extracted.
+func (o Options) Selects(name string) bool {
+	if len(o.Entries) == 0 {
+		return true
+	}
+	for _, pattern := range o.Entries {
+		if MatchEntry(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchEntry reports whether an entry name matches a pattern. Patterns use the path.Match
+// syntax with forward slashes, and an element "**" matches any number of directories, none
+// included, so ".git/**" matches .git and everything below it. A pattern without a slash is
+// also matched against the last element of the name, so "a.txt" or "*.txt" select files in any
+// directory. Patterns are case sensitive on every platform.
+func MatchEntry(pattern, name string) bool {
+	name = filepath.ToSlash(name)
+	pattern = filepath.ToSlash(pattern)
+
+	if strings.Contains(pattern, "**") {
+		if matchElements(strings.Split(pattern, "/"), strings.Split(name, "/")) {
+			return true
+		}
+	} else if matched, err := path.Match(pattern, name); err == nil && matched {
+		return true
+	}
+	if !strings.Contains(pattern, "/") {
+		matched, err := path.Match(pattern, path.Base(name))
+		return err == nil && matched
+	}
+	return false
+}
+
+// matchElements matches the elements of a name against the elements of a pattern, "**" matches
+// any number of elements.
+func matchElements(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElements(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if matched, err := path.Match(pattern[0], name[0]); err != nil || !matched {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// MatchesAnyPattern reports whether name matches one of the patterns, like MatchEntry, so a
+// pattern without a slash such as "*.log" or ".git" matches the last element of name.
+//
+// Parameters:
+//   - name: the path to test, with slashes or the separators of the platform
+//   - patterns: the patterns in the path.Match syntax
+//
+// Returns:
+//   - bool: true when one of the patterns matches
+//   - error: path.ErrBadPattern for the first malformed pattern, even when an earlier one matched
+func MatchesAnyPattern(name string, patterns []string) (bool, error) {
+	matched := false
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return false, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+		}
+		if !matched && MatchEntry(pattern, name) {
+			matched = true
+		}
+	}
+	return matched, nil
+}
+
+// NewOptions applies the given options on top of the defaults.
+func NewOptions(opts ...Option) Options {
+	options := Options{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+	options.Metrics = metrics.OrNop(options.Metrics)
+	if options.Context == nil {
+		options.Context = context.Background()
+	}
+	if options.Warn == nil {
+		options.Warn = func(message string) {
+			ColorPrint(YELLOW, "Warning: "+message+"\n")
+		}
+	}
+	if options.Progress == nil {
+		options.Progress = func(string, int64, int64) {}
+	}
+	if options.AlgorithmChosen == nil {
+		options.AlgorithmChosen = func(string, Algorithm) {}
+	}
+	if options.Excluded == nil {
+		options.Excluded = func(string, bool) {}
+	}
+	if options.Overwrite == "" {
+		options.Overwrite = OVERWRITE_ERROR
+	}
+	if options.MaxPathDepth <= 0 {
+		options.MaxPathDepth = DEFAULT_MAX_PATH_DEPTH
+	}
+	if options.MaxPathLength <= 0 {
+		options.MaxPathLength = DEFAULT_MAX_PATH_LENGTH
+	}
+	if options.Threads <= 0 {
+		options.Threads = 1
+	}
+	if options.BufferSize <= 0 {
+		options.BufferSize = constants.BUFFER_SIZE
+	}
+	if options.SpillThreshold <= 0 {
+		options.SpillThreshold = DEFAULT_SPILL_THRESHOLD
+	}
+	if options.MmapThreshold == 0 {
+		options.MmapThreshold = DEFAULT_MMAP_THRESHOLD
+	}
+	return options
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"errors"
+	"path"
+	"testing"
+)
+
+func TestMatchEntry(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"a.txt", "a.txt", true},
+		{"a.txt", "dir/a.txt", true},
+		{"*.txt", "dir/sub/b.txt", true},
+		{"dir/a.txt", "dir/a.txt", true},
+		{"dir/*.txt", "dir/a.txt", true},
+		{"dir/*.txt", "dir/sub/a.txt", false},
+		{"other/a.txt", "dir/a.txt", false},
+		{"b.txt", "a.txt", false},
+		{"[", "[", false},
+		{".git/**", ".git", true},
+		{".git/**", ".git/objects/ab/cdef", true},
+		{".git/**", "project/.git/HEAD", false},
+		{"**/.git/**", "project/.git/HEAD", true},
+		{"**/*.log", "logs/2024/debug.log", true},
+		{"dir/**/a.txt", "dir/a.txt", true},
+		{"dir/**/a.txt", "dir/x/y/a.txt", true},
+		{"dir/**/a.txt", "dir/x/b.txt", false},
+		// patterns are case sensitive on every platform
+		{"*.LOG", "debug.log", false},
+		{"Node_Modules", "node_modules", false},
+	}
+
+	for _, test := range tests {
+		if matched := MatchEntry(test.pattern, test.name); matched != test.expected {
+			t.Fatalf("MatchEntry(%q, %q) = %v, expected %v", test.pattern, test.name, matched, test.expected)
+		}
+	}
+}
+
+func TestMatchesAnyPattern(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		expected bool
+	}{
+		{"project/main.go", nil, false},
+		{"project/main.go", []string{"*.txt"}, false},
+		{"project/notes.txt", []string{"*.go", "*.txt"}, true},
+		{"project/.git", []string{".git"}, true},
+		{"project/build/out.o", []string{"project/build/*"}, true},
+	}
+
+	for _, test := range tests {
+		matched, err := MatchesAnyPattern(test.name, test.patterns)
+		if err != nil {
+			t.Fatalf("MatchesAnyPattern(%q, %q) failed: %v", test.name, test.patterns, err)
+		}
+		if matched != test.expected {
+			t.Fatalf("MatchesAnyPattern(%q, %q) = %v, expected %v", test.name, test.patterns, matched, test.expected)
+		}
+	}
+
+	// a malformed pattern is reported even after a match
+	if _, err := MatchesAnyPattern("a.txt", []string{"*.txt", "["}); !errors.Is(err, path.ErrBadPattern) {
+		t.Fatalf("expected %v, got %v", path.ErrBadPattern, err)
+	}
+}
+
+func TestSelectsEverythingWithoutEntries(t *testing.T) {
+	if !NewOptions().Selects("any/name") {
+		t.Fatal("without entries every name should be selected")
+	}
+	if NewOptions(WithEntries([]string{"a.txt"})).Selects("b.txt") {
+		t.Fatal("b.txt should not be selected")
+	}
+}
+
+func TestParseCompressionLevel(t *testing.T) {
+	tests := map[string]CompressionLevel{"fast": LevelFast, "Balanced": LevelDefault, "best": LevelBest, "1": 1, " 7 ": 7, "9": 9}
+	for value, expected := range tests {
+		level, err := ParseCompressionLevel(value)
+		if err != nil || level != expected {
+			t.Fatalf("ParseCompressionLevel(%q) = %d, %v, expected %d", value, level, err, expected)
+		}
+	}
+
+	for _, value := range []string{"", "0", "10", "-1", "fastest"} {
+		if _, err := ParseCompressionLevel(value); err == nil {
+			t.Fatalf("expected an error for %q", value)
+		}
+	}
+}
+
+func TestParseArchiveFormat(t *testing.T) {
+	tests := map[string]ArchiveFormat{"sq": NATIVE, "targz": TARGZ, "TarGz": TARGZ, "tar.gz": TARGZ, " tgz": TARGZ}
+	for value, expected := range tests {
+		format, err := ParseArchiveFormat(value)
+		if err != nil || format != expected {
+			t.Fatalf("ParseArchiveFormat(%q) = %q, %v, expected %q", value, format, err, expected)
+		}
+	}
+
+	for _, value := range []string{"", "zip", "tar"} {
+		if _, err := ParseArchiveFormat(value); err == nil {
+			t.Fatalf("expected an error for %q", value)
+		}
+	}
+}
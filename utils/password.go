@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"golang.org/x/term"
+)
+
+var (
+	// ErrNotTerminal is returned by PromptPassword when stdin is redirected, there is nobody
+	// to type the password.
+	ErrNotTerminal = errors.New("cannot prompt for the password, stdin is not a terminal")
+	// ErrPasswordMismatch is returned by PromptNewPassword when the confirmation differs.
+	ErrPasswordMismatch = errors.New("the passwords do not match")
+	// ErrEmptyPassword is returned by PromptNewPassword when nothing was typed, -p "" is the
+	// explicit choice of an archive without password.
+	ErrEmptyPassword = errors.New("the password is empty")
+)
+
+// PromptPassword prints prompt on stderr and reads a password from the terminal without
+// echoing it, so it never shows up in ps or the shell history like -p does.
+//
+// Parameters:
+//   - prompt: The text printed before the input, such as "Password: ".
+//
+// Returns:
+//   - string: the password that was typed
+//   - error: ErrNotTerminal when stdin is not a terminal, or the error of reading it
+func PromptPassword(prompt string) (string, error) {
+	return readPassword(prompt, int(syscall.Stdin), os.Stderr)
+}
+
+// PromptNewPassword prompts for the password of a new archive twice, so a typo does not make
+// the archive impossible to open.
+//
+// Returns:
+//   - string: the password that was typed
+//   - error: ErrEmptyPassword, ErrPasswordMismatch, or the error of PromptPassword
+func PromptNewPassword() (string, error) {
+	return confirmPassword(PromptPassword)
+}
+
+func readPassword(prompt string, fd int, output io.Writer) (string, error) {
+	if !term.IsTerminal(fd) {
+		return "", ErrNotTerminal
+	}
+
+	fmt.Fprint(output, prompt)
+	password, err := term.ReadPassword(fd)
+	// the newline typed by the user is not echoed either
+	fmt.Fprintln(output)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the password: %w", err)
+	}
+	return string(password), nil
+}
+
+func confirmPassword(prompt func(string) (string, error)) (string, error) {
+	password, err := prompt("Password: ")
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", ErrEmptyPassword
+	}
+
+	confirmation, err := prompt("Confirm password: ")
+	if err != nil {
+		return "", err
+	}
+	if confirmation != password {
+		return "", ErrPasswordMismatch
+	}
+	return password, nil
+}
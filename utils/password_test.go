@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestConfirmPassword(t *testing.T) {
+	tests := []struct {
+		name    string
+		typed   []string
+		want    string
+		wantErr error
+	}{
+		{name: "matching", typed: []string{"secret", "secret"}, want: "secret"},
+		{name: "mismatch", typed: []string{"secret", "secert"}, wantErr: ErrPasswordMismatch},
+		{name: "empty", typed: []string{""}, wantErr: ErrEmptyPassword},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prompts := 0
+			password, err := confirmPassword(func(string) (string, error) {
+				if prompts == len(test.typed) {
+					t.Fatalf("prompted %d times, expected at most %d", prompts+1, len(test.typed))
+				}
+				prompts++
+				return test.typed[prompts-1], nil
+			})
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("expected %v, got %v", test.wantErr, err)
+			}
+			if password != test.want {
+				t.Fatalf("expected %q, got %q", test.want, password)
+			}
+		})
+	}
+}
+
+func TestReadPasswordNotTerminal(t *testing.T) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("failed to create a pipe: %v", err)
+	}
+	defer reader.Close()
+	defer writer.Close()
+
+	// a redirected stdin fails instead of reading the password from the data
+	if _, err := readPassword("Password: ", int(reader.Fd()), io.Discard); !errors.Is(err, ErrNotTerminal) {
+		t.Fatalf("expected %v, got %v", ErrNotTerminal, err)
+	}
+}
@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"file-compressor/constants"
+)
+
+const (
+	// DEFAULT_MAX_PATH_DEPTH is the maximum number of components in an extracted entry name.
+	DEFAULT_MAX_PATH_DEPTH = 8192
+	// DEFAULT_MAX_PATH_LENGTH is the maximum length in bytes of an extracted path,
+	// the same as the Windows extended-length path limit.
+	DEFAULT_MAX_PATH_LENGTH = 32767
+)
+
+// PathLimitError is returned when an extracted path exceeds the configured depth or length.
+type PathLimitError struct {
+	Path      string
+	Depth     int
+	Length    int
+	MaxDepth  int
+	MaxLength int
+}
+
+func (e *PathLimitError) Error() string {
+	if e.Depth > e.MaxDepth {
+		return fmt.Sprintf("path is %d levels deep, the limit is %d: %s", e.Depth, e.MaxDepth, shortenForError(e.Path))
+	}
+	return fmt.Sprintf("path is %d bytes long, the limit is %d: %s", e.Length, e.MaxLength, shortenForError(e.Path))
+}
+
+// PathTraversalError is returned when an entry name would be extracted outside of the output directory.
+type PathTraversalError struct {
+	Name   string
+	Reason string
+}
+
+func (e *PathTraversalError) Error() string {
+	return fmt.Sprintf("entry %q escapes the output directory: %s", shortenForError(e.Name), e.Reason)
+}
+
+// ResolveEntryPath joins an entry name with the output directory and makes sure the result
+// stays inside it. Names with a drive letter or volume and names with ".." components are
+// rejected, with either kind of slash. A leading slash is dropped, so absolute names are
+// extracted below outputPath like relative ones.
+//
+// Parameters:
+//   - outputPath: the directory the entries are extracted to
+//   - name: the entry name stored in the archive
+//
+// Returns:
+//   - string: the path to extract the entry to
+//   - error: a *PathTraversalError if the entry would leave outputPath
+func ResolveEntryPath(outputPath, name string) (string, error) {
+	if filepath.VolumeName(name) != "" || hasDriveLetter(name) {
+		return "", &PathTraversalError{Name: name, Reason: "names with a drive letter or volume are not allowed"}
+	}
+
+	for _, component := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if component == ".." {
+			return "", &PathTraversalError{Name: name, Reason: "names with \"..\" components are not allowed"}
+		}
+	}
+
+	fileName := filepath.Join(outputPath, name)
+
+	// the checks above should make this impossible, it guards against anything they miss
+	absOutput, err := filepath.Abs(outputPath)
+	if err != nil {
+		return "", err
+	}
+	absFile, err := filepath.Abs(fileName)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absOutput, absFile)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", &PathTraversalError{Name: name, Reason: "the path does not resolve below " + outputPath}
+	}
+
+	return fileName, nil
+}
+
+// hasDriveLetter reports whether name starts like a Windows drive path, on any platform.
+func hasDriveLetter(name string) bool {
+	return len(name) >= 2 && name[1] == ':' && (name[0] >= 'a' && name[0] <= 'z' || name[0] >= 'A' && name[0] <= 'Z')
+}
+
+// shortenForError keeps error messages readable when the offending path is huge.
+func shortenForError(path string) string {
+	const max = 120
+	if len(path) <= max {
+		return path
+	}
+	return path[:max/2] + "..." + path[len(path)-max/2:]
+}
+
+// PathDepth returns the number of components in a relative path.
+func PathDepth(path string) int {
+	path = filepath.Clean(path)
+	if path == "." || path == "" {
+		return 0
+	}
+	return strings.Count(strings.Trim(path, string(filepath.Separator)), string(filepath.Separator)) + 1
+}
+
+// CheckPathLimits validates an entry name and the path it extracts to.
+//
+// Parameters:
+//   - name: the entry name stored in the archive, its depth is checked
+//   - path: the full output path, its length is checked
+//   - maxDepth, maxLength: the limits, zero or less disables the check
+//
+// Returns:
+//   - error: a *PathLimitError if a limit is exceeded
+func CheckPathLimits(name, path string, maxDepth, maxLength int) error {
+	depth := PathDepth(name)
+	if (maxDepth > 0 && depth > maxDepth) || (maxLength > 0 && len(path) > maxLength) {
+		return &PathLimitError{Path: path, Depth: depth, Length: len(path), MaxDepth: maxDepth, MaxLength: maxLength}
+	}
+	return nil
+}
+
+// DirCache remembers directories that are known to exist, so extracting many entries
+// into the same deep hierarchy creates every directory once instead of re-walking
+// the whole chain with MkdirAll for every entry. It is not safe for concurrent use.
+type DirCache struct {
+	dirs map[string]struct{}
+}
+
+// NewDirCache creates an empty DirCache.
+func NewDirCache() *DirCache {
+	return &DirCache{dirs: make(map[string]struct{})}
+}
+
+// Ensure creates dir and any missing parents, unless it was already ensured.
+//
+// Parameters:
+//   - dir: the directory to create
+//
+// Returns:
+//   - error: if the directory could not be created, or something else than a directory exists
+//     at its path
+func (c *DirCache) Ensure(dir string) error {
+	dir = filepath.Clean(dir)
+	if _, ok := c.dirs[dir]; ok {
+		return nil
+	}
+
+	parent := filepath.Dir(dir)
+	if _, ok := c.dirs[parent]; ok {
+		// only the last component is missing, no need to walk the chain
+		if err := os.Mkdir(LongPath(dir), 0777); err != nil {
+			if !errors.Is(err, os.ErrExist) {
+				return fmt.Errorf(constants.ERROR_CREATE_DIR, err)
+			}
+			// a file of that name would only fail later, when an entry is created below it
+			if info, statErr := os.Lstat(LongPath(dir)); statErr != nil || !info.IsDir() {
+				return fmt.Errorf(constants.ERROR_CREATE_DIR, fmt.Sprintf("%s exists and is not a directory", dir))
+			}
+		}
+	} else if err := os.MkdirAll(LongPath(dir), 0777); err != nil {
+		return fmt.Errorf(constants.ERROR_CREATE_DIR, err)
+	}
+
+	// every parent exists now as well
+	for current := dir; ; current = filepath.Dir(current) {
+		if _, ok := c.dirs[current]; ok {
+			break
+		}
+		c.dirs[current] = struct{}{}
+		if filepath.Dir(current) == current {
+			break
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPathDepth(t *testing.T) {
+	cases := map[string]int{
+		"":                                0,
+		".":                               0,
+		"a.txt":                           1,
+		filepath.Join("a", "b", "c.txt"):  3,
+		filepath.Join("a", "..", "b.txt"): 1,
+	}
+	for path, expected := range cases {
+		if got := PathDepth(path); got != expected {
+			t.Errorf("PathDepth(%q) = %d, expected %d", path, got, expected)
+		}
+	}
+}
+
+func TestResolveEntryPath(t *testing.T) {
+	output := filepath.Join("out", "dir")
+
+	allowed := map[string]string{
+		"a.txt":          filepath.Join(output, "a.txt"),
+		"sub/b.txt":      filepath.Join(output, "sub", "b.txt"),
+		"/abs/c.txt":     filepath.Join(output, "abs", "c.txt"),
+		"./d.txt":        filepath.Join(output, "d.txt"),
+		"dots..name.txt": filepath.Join(output, "dots..name.txt"),
+	}
+	for name, expected := range allowed {
+		path, err := ResolveEntryPath(output, name)
+		if err != nil {
+			t.Fatalf("%q should be allowed: %v", name, err)
+		}
+		if path != expected {
+			t.Fatalf("%q: expected %s, got %s", name, expected, path)
+		}
+	}
+
+	rejected := []string{
+		"../escape.txt",
+		"../../etc/cron.d/evil",
+		"sub/../../escape.txt",
+		"..\\escape.txt",
+		"sub\\..\\..\\escape.txt",
+		"C:\\Windows\\System32\\evil.dll",
+		"c:evil.txt",
+		"",
+		"/",
+	}
+	for _, name := range rejected {
+		var traversalErr *PathTraversalError
+		if _, err := ResolveEntryPath(output, name); !errors.As(err, &traversalErr) {
+			t.Fatalf("%q should be rejected with a PathTraversalError, got %v", name, err)
+		}
+	}
+}
+
+func TestCheckPathLimits(t *testing.T) {
+	name := filepath.Join("a", "b", "c", "d.txt")
+	path := filepath.Join("out", name)
+
+	if err := CheckPathLimits(name, path, 4, len(path)); err != nil {
+		t.Fatalf("path at the limits should pass: %v", err)
+	}
+
+	var limitErr *PathLimitError
+	if err := CheckPathLimits(name, path, 3, 0); !errors.As(err, &limitErr) || limitErr.Depth != 4 {
+		t.Fatalf("expected a depth PathLimitError, got %v", err)
+	}
+	if err := CheckPathLimits(name, path, 0, len(path)-1); !errors.As(err, &limitErr) || limitErr.Length != len(path) {
+		t.Fatalf("expected a length PathLimitError, got %v", err)
+	}
+}
+
+func TestDirCacheCreatesEachDirectoryOnce(t *testing.T) {
+	root := t.TempDir()
+	cache := NewDirCache()
+
+	deep := root
+	for i := 0; i < 100; i++ {
+		deep = filepath.Join(deep, "d")
+		if err := cache.Ensure(deep); err != nil {
+			t.Fatalf("failed to create %d levels: %v", i+1, err)
+		}
+	}
+
+	if info, err := os.Stat(deep); err != nil || !info.IsDir() {
+		t.Fatalf("deep directory was not created: %v", err)
+	}
+
+	// a cached directory must not be touched again, even if it was removed behind our back
+	if err := os.RemoveAll(filepath.Join(root, "d")); err != nil {
+		t.Fatalf("failed to remove tree: %v", err)
+	}
+	if err := cache.Ensure(deep); err != nil {
+		t.Fatalf("cached directory should be a no-op: %v", err)
+	}
+	if _, err := os.Stat(deep); !os.IsNotExist(err) {
+		t.Fatal("expected the cached directory to be skipped")
+	}
+
+	// a sibling of a cached directory only needs its last component
+	sibling := filepath.Join(root, "sibling")
+	if err := cache.Ensure(sibling); err != nil {
+		t.Fatalf("failed to create sibling: %v", err)
+	}
+	if _, err := os.Stat(sibling); err != nil {
+		t.Fatalf("sibling was not created: %v", err)
+	}
+}
+
+func TestDirCacheReportsOSFailure(t *testing.T) {
+	root := t.TempDir()
+	blocker := filepath.Join(root, "file")
+	if err := os.WriteFile(blocker, []byte("x"), 0666); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	err := NewDirCache().Ensure(filepath.Join(blocker, strings.Repeat("x", 3)))
+	if err == nil {
+		t.Fatal("creating a directory below a file should fail")
+	}
+}
+
+func TestDirCacheRejectsFile(t *testing.T) {
+	root := t.TempDir()
+	cache := NewDirCache()
+	if err := cache.Ensure(root); err != nil {
+		t.Fatalf("failed to ensure the root: %v", err)
+	}
+
+	// the parent is cached, so only the last component is created
+	blocker := filepath.Join(root, "file")
+	if err := os.WriteFile(blocker, []byte("x"), 0666); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	err := cache.Ensure(blocker)
+	if err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Fatalf("expected an error for the file, got %v", err)
+	}
+	if err := cache.Ensure(blocker); err == nil {
+		t.Fatal("the file should not be cached as a directory")
+	}
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"file-compressor/constants"
+)
+
+// DEFAULT_SPILL_THRESHOLD is the number of bytes a SpillBuffer keeps in memory.
+const DEFAULT_SPILL_THRESHOLD = 8 << 20
+
+// RunOrdered calls work for the indexes 0 to n-1 on up to threads goroutines and passes the
+// results to emit in index order on the calling goroutine, so the output of concurrent work
+// can be written as if it was done one after another. At most 2*threads results wait for
+// emit at any time.
+//
+// The first error of work or emit cancels the context passed to the calls of work that are
+// still running and is returned once they stopped. The results that were not emitted are
+// passed to discard, which may be nil.
+//
+// Parameters:
+//   - ctx: cancels the work, its error is returned when it is done first
+//   - n: the number of indexes
+//   - threads: the number of goroutines calling work, less than 1 uses 1
+//   - work: produces the result of an index
+//   - emit: consumes the results in index order
+//   - discard: releases a result that is not emitted because of an error
+//
+// Returns:
+//   - error: the first error of work or emit
+func RunOrdered[T any](ctx context.Context, n, threads int, work func(ctx context.Context, i int) (T, error), emit func(i int, result T) error, discard func(result T)) error {
+	threads = max(threads, 1)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var failure error
+	fail := func(err error) {
+		mu.Lock()
+		if failure == nil {
+			failure = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	type outcome struct {
+		result T
+		err    error
+	}
+	outcomes := make([]chan outcome, n)
+	for i := range outcomes {
+		outcomes[i] = make(chan outcome, 1)
+	}
+
+	// a token is taken for every dispatched index and returned once its result is consumed
+	tokens := make(chan struct{}, 2*threads)
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		for i := 0; i < n; i++ {
+			tokens <- struct{}{}
+			jobs <- i
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(threads, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// once something failed the remaining indexes are only passed through
+				if err := ctx.Err(); err != nil {
+					outcomes[i] <- outcome{err: err}
+					continue
+				}
+				result, err := work(ctx, i)
+				if err != nil {
+					fail(err)
+				}
+				outcomes[i] <- outcome{result: result, err: err}
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		o := <-outcomes[i]
+		<-tokens
+		switch {
+		case o.err != nil:
+			fail(o.err)
+		case ctx.Err() != nil:
+			if discard != nil {
+				discard(o.result)
+			}
+		default:
+			if err := emit(i, o.result); err != nil {
+				fail(err)
+			}
+		}
+	}
+	wg.Wait()
+
+	return failure
+}
+
+// SpillBuffer is an io.Writer that keeps the first limit bytes written to it in memory and
+// moves everything to a temporary file once more is written. Close removes the file.
+type SpillBuffer struct {
+	limit  int
+	memory bytes.Buffer
+	file   *os.File
+	size   int64
+}
+
+// NewSpillBuffer creates a SpillBuffer keeping up to limit bytes in memory.
+func NewSpillBuffer(limit int) *SpillBuffer {
+	return &SpillBuffer{limit: limit}
+}
+
+func (b *SpillBuffer) Write(p []byte) (int, error) {
+	if b.file == nil && b.memory.Len()+len(p) > b.limit {
+		file, err := os.CreateTemp("", "squirrelzip-spill-*")
+		if err != nil {
+			return 0, fmt.Errorf(constants.FILE_CREATE_ERROR, err)
+		}
+		b.file = file
+		if _, err := b.memory.WriteTo(file); err != nil {
+			return 0, fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+		}
+	}
+
+	var n int
+	var err error
+	if b.file != nil {
+		n, err = b.file.Write(p)
+	} else {
+		n, err = b.memory.Write(p)
+	}
+	b.size += int64(n)
+	return n, err
+}
+
+// Len returns the number of bytes written to the buffer.
+func (b *SpillBuffer) Len() int64 {
+	return b.size
+}
+
+// WriteTo writes everything written to the buffer to w.
+func (b *SpillBuffer) WriteTo(w io.Writer) (int64, error) {
+	if b.file == nil {
+		return io.Copy(w, bytes.NewReader(b.memory.Bytes()))
+	}
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.CopyBuffer(w, b.file, make([]byte, constants.BUFFER_SIZE))
+}
+
+// Reader returns a reader over everything written to the buffer, positioned at its start.
+// It is only valid until the next Write or Close.
+func (b *SpillBuffer) Reader() (io.ReadSeeker, error) {
+	if b.file == nil {
+		return bytes.NewReader(b.memory.Bytes()), nil
+	}
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+	return b.file, nil
+}
+
+// Close releases the memory and removes the temporary file, if one was created.
+func (b *SpillBuffer) Close() error {
+	b.memory = bytes.Buffer{}
+	if b.file == nil {
+		return nil
+	}
+	b.file.Close()
+	err := os.Remove(b.file.Name())
+	b.file = nil
+	return err
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRunOrdered(t *testing.T) {
+	emitted := []int{}
+	work := func(ctx context.Context, i int) (int, error) {
+		// later indexes finish first
+		time.Sleep(time.Duration(20-i) * time.Millisecond)
+		return i * i, nil
+	}
+	emit := func(i, result int) error {
+		if result != i*i {
+			t.Fatalf("index %d: unexpected result %d", i, result)
+		}
+		emitted = append(emitted, i)
+		return nil
+	}
+
+	if err := RunOrdered(context.Background(), 20, 4, work, emit, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, index := range emitted {
+		if index != i {
+			t.Fatalf("expected the results in order, got %v", emitted)
+		}
+	}
+	if len(emitted) != 20 {
+		t.Fatalf("expected 20 results, got %d", len(emitted))
+	}
+}
+
+func TestRunOrderedError(t *testing.T) {
+	errFailed := errors.New("failed")
+	work := func(ctx context.Context, i int) (int, error) {
+		if i == 5 {
+			return 0, errFailed
+		}
+		// the others wait for the failure to cancel them
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(time.Duration(i) * time.Millisecond):
+			return i, nil
+		}
+	}
+	emit := func(i, result int) error {
+		if i >= 5 {
+			t.Fatalf("index %d was emitted after the failure", i)
+		}
+		return nil
+	}
+
+	err := RunOrdered(context.Background(), 100, 4, work, emit, nil)
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("expected %v, got %v", errFailed, err)
+	}
+}
+
+func TestSpillBuffer(t *testing.T) {
+	for _, limit := range []int{1 << 10, 10} {
+		buffer := NewSpillBuffer(limit)
+		content := bytes.Repeat([]byte("spill "), 100)
+		for i := 0; i < len(content); i += 50 {
+			if _, err := buffer.Write(content[i:min(i+50, len(content))]); err != nil {
+				t.Fatalf("failed to write: %v", err)
+			}
+		}
+		if buffer.Len() != int64(len(content)) {
+			t.Fatalf("expected %d bytes, got %d", len(content), buffer.Len())
+		}
+
+		spilled := buffer.file
+		if (spilled != nil) != (limit < len(content)) {
+			t.Fatalf("limit %d: expected a temporary file only when the content does not fit", limit)
+		}
+
+		output := &bytes.Buffer{}
+		if _, err := buffer.WriteTo(output); err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+		if !bytes.Equal(content, output.Bytes()) {
+			t.Fatalf("limit %d: the copy does not match what was written", limit)
+		}
+
+		// the reader starts over every time, the codes of a file are built in a first pass
+		for pass := 0; pass < 2; pass++ {
+			reader, err := buffer.Reader()
+			if err != nil {
+				t.Fatalf("failed to get a reader: %v", err)
+			}
+			read, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("failed to read: %v", err)
+			}
+			if !bytes.Equal(content, read) {
+				t.Fatalf("limit %d, pass %d: the reader does not match what was written", limit, pass)
+			}
+		}
+
+		if err := buffer.Close(); err != nil {
+			t.Fatalf("failed to close: %v", err)
+		}
+		if spilled != nil {
+			if _, err := os.Stat(spilled.Name()); !os.IsNotExist(err) {
+				t.Fatalf("expected the temporary file to be removed, got %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+)
+
+// NO_COLOR_ENV disables the colors of every Printer when it is set to any value, see
+// https://no-color.org.
+const NO_COLOR_ENV = "NO_COLOR"
+
+// colorCodes matches the escape sequences of the COLOR formats.
+var colorCodes = regexp.MustCompile("\033\\[[0-9;]*m")
+
+// Printer writes the status messages of the CLI and the warnings of the codecs. Colors are
+// only written to a terminal, text written to a file or a pipe stays plain. Messages holds
+// the Printer everything is written to, library callers replace it to redirect or silence the
+// output, see NewPrinter.
+type Printer struct {
+	out   io.Writer
+	color bool
+}
+
+// NewPrinter returns a Printer writing to out. It writes colors only when out is a terminal,
+// NO_COLOR_ENV is not set and noColor is false. NewPrinter(io.Discard, true) prints nothing.
+//
+// Parameters:
+//   - out: the writer of the messages
+//   - noColor: disables the colors, as the -no-color flag does
+//
+// Returns:
+//   - *Printer: the printer
+func NewPrinter(out io.Writer, noColor bool) *Printer {
+	color := !noColor && os.Getenv(NO_COLOR_ENV) == ""
+	if file, ok := out.(*os.File); !ok || !IsTerminal(file) {
+		color = false
+	}
+	return &Printer{out: out, color: color}
+}
+
+// Color reports whether the printer writes colors.
+func (p *Printer) Color() bool {
+	return p.color
+}
+
+// Print writes message in color, or as plain text when the colors are disabled.
+func (p *Printer) Print(color COLOR, message string) {
+	if p.color {
+		fmt.Fprintf(p.out, string(color), message)
+		return
+	}
+	io.WriteString(p.out, message)
+}
+
+// Write writes b as it is, without the color codes it holds when the colors are disabled, so
+// the printer can be passed wherever an io.Writer is expected.
+func (p *Printer) Write(b []byte) (int, error) {
+	if p.color {
+		return p.out.Write(b)
+	}
+	if _, err := p.out.Write(colorCodes.ReplaceAll(b, nil)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestPrinterWithoutColor(t *testing.T) {
+	var out bytes.Buffer
+	printer := NewPrinter(&out, false)
+	// a buffer is not a terminal, the colors are disabled without -no-color
+	if printer.Color() {
+		t.Fatal("expected no colors for a buffer")
+	}
+
+	printer.Print(GREEN, "Output file: archive.sq\n")
+	printer.Print(RED, "failed\n")
+	fmt.Fprintf(printer, string(YELLOW)+"\n", "Warning: 100%")
+	if expected := "Output file: archive.sq\nfailed\nWarning: 100%\n"; out.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestPrinterColor(t *testing.T) {
+	var out bytes.Buffer
+	printer := &Printer{out: &out, color: true}
+	printer.Print(GREEN, "done")
+	if expected := fmt.Sprintf(string(GREEN), "done"); out.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestPrinterNoColorEnv(t *testing.T) {
+	t.Setenv(NO_COLOR_ENV, "1")
+	if NewPrinter(nil, false).Color() {
+		t.Fatal("expected NO_COLOR to disable the colors")
+	}
+}
+
+func TestColorPrintMessages(t *testing.T) {
+	var out bytes.Buffer
+	defer func(messages *Printer) { Messages = messages }(Messages)
+	Messages = NewPrinter(&out, true)
+
+	ColorPrint(GREY, "Time taken: 1s\n")
+	if expected := "Time taken: 1s\n"; out.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, out.String())
+	}
+}
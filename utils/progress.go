@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ProgressPhase names the stage of an operation a ProgressEvent belongs to.
+type ProgressPhase string
+
+const (
+	PHASE_COMPRESS ProgressPhase = "compress"
+	PHASE_ENCRYPT  ProgressPhase = "encrypt"
+	PHASE_EXTRACT  ProgressPhase = "extract"
+
+	// DEFAULT_PROGRESS_INTERVAL is the number of bytes between two events of the same phase.
+	DEFAULT_PROGRESS_INTERVAL = 1 << 20
+)
+
+// ProgressEvent reports how far a phase of an operation got.
+type ProgressEvent struct {
+	// Filename is the entry being processed, empty while the archive is encrypted.
+	Filename string
+	// BytesProcessed counts the bytes of the phase processed so far over all files, it never decreases.
+	BytesProcessed int64
+	// TotalBytes is the number of bytes the phase will process, -1 when it is not known.
+	TotalBytes int64
+	Phase      ProgressPhase
+	// Done marks the last event of a file, or of the archive for PHASE_ENCRYPT.
+	Done bool
+}
+
+// ProgressEventFunc receives the events of an operation, see WithProgressEvents.
+type ProgressEventFunc func(event ProgressEvent)
+
+// ProgressTracker sends the events of one phase to a ProgressEventFunc, at most one every
+// interval bytes plus a final one per file. A nil tracker reports nothing, so callers use it
+// without checking whether progress was asked for. It may be used by several goroutines, the
+// events are sent one at a time.
+type ProgressTracker struct {
+	mu        sync.Mutex
+	fn        ProgressEventFunc
+	interval  int64
+	phase     ProgressPhase
+	total     int64
+	processed int64
+	reported  int64
+}
+
+// NewProgressTracker creates a tracker for phase, or returns nil when fn is nil.
+//
+// Parameters:
+//   - fn: the callback receiving the events
+//   - interval: the minimum number of bytes between two events, DEFAULT_PROGRESS_INTERVAL when 0 or less
+//   - phase: the phase reported in every event
+//   - total: the number of bytes the phase will process, -1 when it is not known
+//
+// Returns:
+//   - *ProgressTracker: the tracker, nil when fn is nil
+func NewProgressTracker(fn ProgressEventFunc, interval int64, phase ProgressPhase, total int64) *ProgressTracker {
+	if fn == nil {
+		return nil
+	}
+	if interval <= 0 {
+		interval = DEFAULT_PROGRESS_INTERVAL
+	}
+	return &ProgressTracker{fn: fn, interval: interval, phase: phase, total: total}
+}
+
+// Add accounts for n more bytes of filename and sends an event once interval bytes passed since the last one.
+func (t *ProgressTracker) Add(filename string, n int64) {
+	if t == nil || n <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.processed += n
+	if t.processed-t.reported >= t.interval {
+		t.send(filename, false)
+	}
+}
+
+// Done sends the final event of filename.
+func (t *ProgressTracker) Done(filename string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.send(filename, true)
+}
+
+func (t *ProgressTracker) send(filename string, done bool) {
+	t.reported = t.processed
+	t.fn(ProgressEvent{Filename: filename, BytesProcessed: t.processed, TotalBytes: t.total, Phase: t.phase, Done: done})
+}
+
+// Reader wraps the reader of filename so the bytes read are added to the tracker, or returns
+// reader unchanged for a nil tracker. Bytes read again after seeking back are only counted once,
+// the Huffman and arithmetic codecs read every file twice.
+func (t *ProgressTracker) Reader(filename string, reader io.Reader) io.Reader {
+	if t == nil {
+		return reader
+	}
+	return &progressReader{reader: reader, filename: filename, tracker: t}
+}
+
+type progressReader struct {
+	reader   io.Reader
+	filename string
+	tracker  *ProgressTracker
+	offset   int64
+	counted  int64
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.offset += int64(n)
+	if r.offset > r.counted {
+		r.tracker.Add(r.filename, r.offset-r.counted)
+		r.counted = r.offset
+	}
+	return n, err
+}
+
+func (r *progressReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := r.reader.(io.Seeker)
+	if !ok {
+		return 0, errors.New("underlying reader does not support seeking")
+	}
+	position, err := seeker.Seek(offset, whence)
+	if err == nil {
+		r.offset = position
+	}
+	return position, err
+}
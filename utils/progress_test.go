@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestProgressTrackerInterval(t *testing.T) {
+	events := []ProgressEvent{}
+	tracker := NewProgressTracker(func(event ProgressEvent) { events = append(events, event) }, 100, PHASE_COMPRESS, 250)
+
+	for i := 0; i < 25; i++ {
+		tracker.Add("a.txt", 10)
+	}
+	tracker.Done("a.txt")
+
+	expected := []int64{100, 200, 250}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), events)
+	}
+	for i, event := range events {
+		if event.BytesProcessed != expected[i] || event.TotalBytes != 250 || event.Phase != PHASE_COMPRESS {
+			t.Fatalf("event %d: unexpected %+v", i, event)
+		}
+		if event.Done != (i == len(events)-1) {
+			t.Fatalf("event %d: expected only the last event to be final, got %+v", i, event)
+		}
+	}
+}
+
+func TestProgressTrackerNil(t *testing.T) {
+	tracker := NewProgressTracker(nil, 0, PHASE_EXTRACT, -1)
+	if tracker != nil {
+		t.Fatal("expected no tracker without a callback")
+	}
+
+	// a nil tracker is usable and leaves the reader alone
+	reader := bytes.NewReader([]byte("abc"))
+	if tracker.Reader("a.txt", reader) != io.Reader(reader) {
+		t.Fatal("expected the reader to be returned unchanged")
+	}
+	tracker.Add("a.txt", 3)
+	tracker.Done("a.txt")
+}
+
+func TestProgressReaderCountsOnce(t *testing.T) {
+	last := int64(0)
+	tracker := NewProgressTracker(func(event ProgressEvent) { last = event.BytesProcessed }, 1, PHASE_COMPRESS, 6)
+	reader := tracker.Reader("a.txt", bytes.NewReader([]byte("abcdef")))
+
+	// read twice like the Huffman codec, once for the frequencies and once to compress
+	for pass := 0; pass < 2; pass++ {
+		if _, err := io.ReadAll(reader); err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		if _, err := reader.(io.Seeker).Seek(0, io.SeekStart); err != nil {
+			t.Fatalf("failed to seek: %v", err)
+		}
+	}
+	tracker.Done("a.txt")
+
+	if last != 6 {
+		t.Fatalf("expected 6 bytes to be counted, got %d", last)
+	}
+}
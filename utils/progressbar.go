@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PROGRESS_BAR_REFRESH is the minimum time between two redraws of a ProgressBar.
+	PROGRESS_BAR_REFRESH = 100 * time.Millisecond
+	// PROGRESS_BAR_WIDTH is the number of cells of the bar itself.
+	PROGRESS_BAR_WIDTH = 20
+	// PROGRESS_LINE_WIDTH is the longest line a ProgressBar draws, longer file names are shortened
+	// from the left so the line never wraps on a standard terminal.
+	PROGRESS_LINE_WIDTH = 79
+)
+
+// ProgressBar draws the events of WithProgressEvents as a single line that is redrawn in place:
+// the share of the phase done, the throughput and the file being processed. A nil bar draws
+// nothing, so callers use it without checking whether the bar was enabled.
+type ProgressBar struct {
+	mu       sync.Mutex
+	out      io.Writer
+	now      func() time.Time
+	phase    ProgressPhase
+	start    time.Time
+	lastDraw time.Time
+	drawn    int
+}
+
+// NewProgressBar creates a bar drawn on out.
+func NewProgressBar(out io.Writer) *ProgressBar {
+	return &ProgressBar{out: out, now: time.Now}
+}
+
+// NewTerminalProgressBar creates a bar drawn on stderr, or returns nil when quiet is set or
+// stderr is redirected, where the redrawn line would only clutter the output.
+func NewTerminalProgressBar(quiet bool) *ProgressBar {
+	if quiet || !IsTerminal(os.Stderr) {
+		return nil
+	}
+	return NewProgressBar(os.Stderr)
+}
+
+// IsTerminal reports whether file is a character device such as a terminal.
+func IsTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Update redraws the bar for event, at most once every PROGRESS_BAR_REFRESH. It is a
+// ProgressEventFunc, pass it to WithProgressEvents.
+func (b *ProgressBar) Update(event ProgressEvent) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	// throughput is measured per phase, encrypting is much faster than compressing
+	if event.Phase != b.phase {
+		b.phase = event.Phase
+		b.start = now
+	}
+	if now.Sub(b.lastDraw) < PROGRESS_BAR_REFRESH {
+		return
+	}
+	b.lastDraw = now
+
+	b.draw(formatProgress(event, now.Sub(b.start)))
+}
+
+// Events returns the function to pass to WithProgressEvents, nil for a nil bar so no events
+// are tracked at all.
+func (b *ProgressBar) Events() ProgressEventFunc {
+	if b == nil {
+		return nil
+	}
+	return b.Update
+}
+
+// Clear removes the bar from the terminal, so the lines printed next start at an empty line.
+// The next event draws the bar again.
+func (b *ProgressBar) Clear() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.drawn > 0 {
+		fmt.Fprintf(b.out, "\r%s\r", strings.Repeat(" ", b.drawn))
+		b.drawn = 0
+	}
+	b.lastDraw = time.Time{}
+}
+
+func (b *ProgressBar) draw(line string) {
+	// pad with spaces to overwrite the rest of a longer previous line
+	padding := ""
+	if b.drawn > len([]rune(line)) {
+		padding = strings.Repeat(" ", b.drawn-len([]rune(line)))
+	}
+	fmt.Fprintf(b.out, "\r%s%s", line, padding)
+	b.drawn = len([]rune(line))
+}
+
+// formatProgress returns the line drawn for event after elapsed time in its phase.
+func formatProgress(event ProgressEvent, elapsed time.Duration) string {
+	line := ""
+	if event.TotalBytes > 0 {
+		done := min(event.BytesProcessed, event.TotalBytes)
+		filled := int(done * PROGRESS_BAR_WIDTH / event.TotalBytes)
+		line = fmt.Sprintf("[%s%s] %3d%%", strings.Repeat("#", filled), strings.Repeat("-", PROGRESS_BAR_WIDTH-filled), done*100/event.TotalBytes)
+	} else {
+		line = FileSize(uint64(event.BytesProcessed))
+	}
+
+	rate := int64(0)
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		rate = int64(float64(event.BytesProcessed) / seconds)
+	}
+	line += fmt.Sprintf(" %s/s %s", FileSize(uint64(rate)), event.Phase)
+
+	if event.Filename != "" {
+		name := []rune(event.Filename)
+		if room := PROGRESS_LINE_WIDTH - len([]rune(line)) - 1; len(name) > room {
+			name = append([]rune("..."), name[len(name)-max(room-3, 0):]...)
+		}
+		line += " " + string(name)
+	}
+
+	return line
+}
+
+// ProgressWriter is an io.WriteCloser that passes everything written to it on to another
+// writer and draws the progress of the bytes written as a ProgressBar line, redrawn after every
+// percent of the total. Close ends the line, it does not close the underlying writer.
+type ProgressWriter struct {
+	writer  io.Writer
+	bar     *ProgressBar
+	label   string
+	total   int64
+	written int64
+	percent int64
+	start   time.Time
+}
+
+// NewProgressWriter wraps w and draws the progress towards totalBytes on stderr, labeled with
+// label. Nothing is drawn when stderr is not a terminal. Without a total, totalBytes 0 or less,
+// only the bytes written are drawn, at most once every PROGRESS_BAR_REFRESH.
+func NewProgressWriter(w io.Writer, totalBytes int64, label string) *ProgressWriter {
+	var bar *ProgressBar
+	if IsTerminal(os.Stderr) {
+		bar = NewProgressBar(os.Stderr)
+	}
+	return &ProgressWriter{writer: w, bar: bar, label: label, total: totalBytes, percent: -1}
+}
+
+// Write writes p to the underlying writer and redraws the line when a percent was completed.
+func (w *ProgressWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+	w.draw()
+	return n, err
+}
+
+// Written returns the number of bytes written to the underlying writer so far.
+func (w *ProgressWriter) Written() int64 {
+	return w.written
+}
+
+// Close moves the cursor to the next line, below the last drawn progress.
+func (w *ProgressWriter) Close() error {
+	if w.bar == nil {
+		return nil
+	}
+	w.bar.mu.Lock()
+	defer w.bar.mu.Unlock()
+
+	if w.bar.drawn > 0 {
+		fmt.Fprintln(w.bar.out)
+		w.bar.drawn = 0
+	}
+	return nil
+}
+
+func (w *ProgressWriter) draw() {
+	if w.bar == nil {
+		return
+	}
+	w.bar.mu.Lock()
+	defer w.bar.mu.Unlock()
+
+	now := w.bar.now()
+	if w.start.IsZero() {
+		w.start = now
+	}
+	if w.total > 0 {
+		percent := min(w.written, w.total) * 100 / w.total
+		if percent == w.percent {
+			return
+		}
+		w.percent = percent
+	} else if now.Sub(w.bar.lastDraw) < PROGRESS_BAR_REFRESH {
+		return
+	}
+	w.bar.lastDraw = now
+
+	event := ProgressEvent{Phase: ProgressPhase(w.label), BytesProcessed: w.written, TotalBytes: w.total}
+	w.bar.draw(formatProgress(event, now.Sub(w.start)))
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatProgress(t *testing.T) {
+	event := ProgressEvent{Filename: "docs/report.txt", BytesProcessed: 5 << 20, TotalBytes: 20 << 20, Phase: PHASE_COMPRESS}
+	line := formatProgress(event, 2*time.Second)
+
+	expected := "[#####---------------]  25% 2.5 MB/s compress docs/report.txt"
+	if line != expected {
+		t.Fatalf("expected %q, got %q", expected, line)
+	}
+
+	// without a total only the bytes processed are shown
+	event.TotalBytes = -1
+	if line := formatProgress(event, 0); !strings.HasPrefix(line, "5.0 MB 0 B/s compress") {
+		t.Fatalf("unexpected line %q", line)
+	}
+}
+
+func TestFormatProgressLongName(t *testing.T) {
+	event := ProgressEvent{Filename: strings.Repeat("d/", 100) + "last.txt", BytesProcessed: 1, TotalBytes: 2, Phase: PHASE_EXTRACT}
+	line := formatProgress(event, time.Second)
+
+	if len(line) != PROGRESS_LINE_WIDTH {
+		t.Fatalf("expected a line of %d characters, got %d: %q", PROGRESS_LINE_WIDTH, len(line), line)
+	}
+	if !strings.HasSuffix(line, "d/last.txt") || !strings.Contains(line, " extract ...d/") {
+		t.Fatalf("expected the start of the name to be shortened, got %q", line)
+	}
+}
+
+func TestProgressBarRefresh(t *testing.T) {
+	out := &bytes.Buffer{}
+	bar := NewProgressBar(out)
+	now := time.Unix(0, 0)
+	bar.now = func() time.Time { return now }
+
+	event := ProgressEvent{Filename: "a.txt", BytesProcessed: 1, TotalBytes: 10, Phase: PHASE_COMPRESS}
+	for i := 0; i < 10; i++ {
+		bar.Update(event)
+		now = now.Add(PROGRESS_BAR_REFRESH / 4)
+	}
+
+	// 10 events over 250ms are drawn at 0, 100 and 200ms
+	if draws := strings.Count(out.String(), "\r"); draws != 3 {
+		t.Fatalf("expected 3 redraws, got %d: %q", draws, out.String())
+	}
+
+	out.Reset()
+	bar.Clear()
+	if out.String() != "\r"+strings.Repeat(" ", len(formatProgress(event, 0)))+"\r" {
+		t.Fatalf("expected the line to be overwritten with spaces, got %q", out.String())
+	}
+
+	// nothing is left to clear
+	out.Reset()
+	bar.Clear()
+	if out.Len() != 0 {
+		t.Fatalf("expected no output, got %q", out.String())
+	}
+}
+
+func TestProgressBarNil(t *testing.T) {
+	var bar *ProgressBar
+	if bar.Events() != nil {
+		t.Fatal("expected no callback for a nil bar")
+	}
+	bar.Update(ProgressEvent{})
+	bar.Clear()
+
+	if NewTerminalProgressBar(true) != nil {
+		t.Fatal("expected no bar with quiet set")
+	}
+}
+
+func TestProgressWriterCounts(t *testing.T) {
+	output := &bytes.Buffer{}
+	writer := NewProgressWriter(output, 1000, "join")
+
+	for i := 0; i < 10; i++ {
+		if _, err := writer.Write(bytes.Repeat([]byte{'a'}, 100)); err != nil {
+			t.Fatal(err)
+		}
+		if writer.Written() != int64(i+1)*100 {
+			t.Fatalf("expected %d bytes written, got %d", (i+1)*100, writer.Written())
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if output.Len() != 1000 {
+		t.Fatalf("expected the data to be passed on, got %d bytes", output.Len())
+	}
+}
+
+func TestProgressWriterPercent(t *testing.T) {
+	out := &bytes.Buffer{}
+	writer := NewProgressWriter(io.Discard, 1000, "join")
+	writer.bar = NewProgressBar(out)
+
+	for i := 0; i < 1000; i++ {
+		writer.Write([]byte{'a'})
+	}
+	writer.Close()
+
+	// once for 0% and once for every percent after it, then the final newline
+	if draws := strings.Count(out.String(), "\r"); draws != 101 {
+		t.Fatalf("expected 101 redraws, got %d", draws)
+	}
+	lines := strings.Split(out.String(), "\r")
+	if last := lines[len(lines)-1]; !strings.HasPrefix(last, "[####################] 100%") || !strings.HasSuffix(last, " join\n") {
+		t.Fatalf("expected the last line at 100%% followed by a newline, got %q", last)
+	}
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket that limits the number of bytes per second passing through
+// the readers and writers sharing it. One limiter can be shared by any number of goroutines,
+// the limit then applies to all of them together. A limiter with a rate of zero never waits
+// but still measures the achieved rate.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second, 0 means unlimited
+	burst  float64 // bucket capacity in bytes
+	tokens float64 // may go negative, the debt is paid by waiting
+	last   time.Time
+
+	start  time.Time
+	finish time.Time
+	total  int64
+}
+
+// NewRateLimiter creates a limiter for bytesPerSecond. The bucket holds a tenth of a second
+// worth of bytes, so short bursts are smoothed without letting a whole second through at once.
+//
+// Parameters:
+//   - bytesPerSecond: the limit, 0 or less only measures the achieved rate
+//
+// Returns:
+//   - *RateLimiter: the limiter
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	limiter := &RateLimiter{}
+	if bytesPerSecond > 0 {
+		limiter.rate = float64(bytesPerSecond)
+		limiter.burst = limiter.rate / 10
+	}
+	return limiter
+}
+
+// Wait accounts for n bytes and blocks until the limit allows them. A nil limiter never waits.
+func (l *RateLimiter) Wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	if l.start.IsZero() {
+		l.start = now
+		l.last = now
+		l.tokens = l.burst
+	}
+	l.total += int64(n)
+
+	var wait time.Duration
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+
+		l.tokens -= float64(n)
+		if l.tokens < 0 {
+			wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+		}
+	}
+
+	if done := now.Add(wait); done.After(l.finish) {
+		l.finish = done
+	}
+	l.mu.Unlock()
+
+	time.Sleep(wait)
+}
+
+// Total returns the number of bytes that passed through the limiter.
+func (l *RateLimiter) Total() int64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.total
+}
+
+// AverageRate returns the achieved rate in bytes per second between the first and the last transfer.
+func (l *RateLimiter) AverageRate() float64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	elapsed := l.finish.Sub(l.start).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(l.total) / elapsed
+}
+
+// RateLimitedReader limits the bytes read from Reader with Limiter.
+// Seek is passed through, so the reader can stand in for a file.
+type RateLimitedReader struct {
+	Reader  io.Reader
+	Limiter *RateLimiter
+}
+
+func (r *RateLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.Limiter.Wait(n)
+	return n, err
+}
+
+func (r *RateLimitedReader) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := r.Reader.(io.Seeker)
+	if !ok {
+		return 0, errors.New("underlying reader does not support seeking")
+	}
+	return seeker.Seek(offset, whence)
+}
+
+// RateLimitedWriter limits the bytes written to Writer with Limiter.
+// Seek is passed through, so the writer can stand in for a file.
+type RateLimitedWriter struct {
+	Writer  io.Writer
+	Limiter *RateLimiter
+}
+
+func (w *RateLimitedWriter) Write(p []byte) (int, error) {
+	w.Limiter.Wait(len(p))
+	return w.Writer.Write(p)
+}
+
+func (w *RateLimitedWriter) Seek(offset int64, whence int) (int64, error) {
+	seeker, ok := w.Writer.(io.Seeker)
+	if !ok {
+		return 0, errors.New("underlying writer does not support seeking")
+	}
+	return seeker.Seek(offset, whence)
+}
+
+// LimitReader wraps reader with limiter, or returns reader unchanged when limiter is nil.
+func LimitReader(reader io.Reader, limiter *RateLimiter) io.Reader {
+	if limiter == nil {
+		return reader
+	}
+	return &RateLimitedReader{Reader: reader, Limiter: limiter}
+}
+
+// LimitWriter wraps writer with limiter, or returns writer unchanged when limiter is nil.
+func LimitWriter(writer io.Writer, limiter *RateLimiter) io.Writer {
+	if limiter == nil {
+		return writer
+	}
+	return &RateLimitedWriter{Writer: writer, Limiter: limiter}
+}
+
+// ParseRate parses a rate such as "50MB/s" or "512KB" into bytes per second.
+func ParseRate(rate string) (int64, error) {
+	value := strings.TrimSpace(rate)
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "/s"), "/S")
+
+	bytesPerSecond, err := ParseSize(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate: %s", rate)
+	}
+	return bytesPerSecond, nil
+}
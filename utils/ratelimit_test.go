@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimitedCopyTakesExpectedTime(t *testing.T) {
+	const rate = 100 * 1024
+	const size = 50 * 1024
+
+	limiter := NewRateLimiter(rate)
+	reader := &RateLimitedReader{Reader: bytes.NewReader(make([]byte, size)), Limiter: limiter}
+
+	start := time.Now()
+	if _, err := io.Copy(io.Discard, reader); err != nil {
+		t.Fatalf("failed to copy: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	// everything above the initial burst of a tenth of a second has to wait
+	expected := time.Duration(float64(size-rate/10) / rate * float64(time.Second))
+	if elapsed < expected {
+		t.Fatalf("copy took %v, expected at least %v", elapsed, expected)
+	}
+	if limiter.Total() != size {
+		t.Fatalf("expected %d bytes, got %d", size, limiter.Total())
+	}
+	if achieved := limiter.AverageRate(); achieved > rate*1.5 {
+		t.Fatalf("achieved rate %.0f is far above the limit %d", achieved, rate)
+	}
+}
+
+func TestRateLimiterIsSharedByWriters(t *testing.T) {
+	const rate = 200 * 1024
+	const size = 20 * 1024
+	const writers = 4
+
+	limiter := NewRateLimiter(rate)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			writer := &RateLimitedWriter{Writer: io.Discard, Limiter: limiter}
+			io.Copy(writer, bytes.NewReader(make([]byte, size)))
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	expected := time.Duration(float64(writers*size-rate/10) / rate * float64(time.Second))
+	if elapsed < expected {
+		t.Fatalf("writers took %v together, expected at least %v", elapsed, expected)
+	}
+}
+
+func TestUnlimitedRateLimiterMeasures(t *testing.T) {
+	limiter := NewRateLimiter(0)
+	writer := LimitWriter(io.Discard, limiter)
+
+	start := time.Now()
+	writer.Write(make([]byte, 1<<20))
+	if time.Since(start) > time.Second {
+		t.Fatal("an unlimited limiter should not wait")
+	}
+	if limiter.Total() != 1<<20 {
+		t.Fatalf("expected %d bytes, got %d", 1<<20, limiter.Total())
+	}
+
+	if LimitReader(bytes.NewReader(nil), nil) == nil {
+		t.Fatal("a nil limiter should return the reader unchanged")
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	cases := map[string]int64{
+		"50MB/s": 50 * 1024 * 1024,
+		"512KB":  512 * 1024,
+		"1G/s":   1024 * 1024 * 1024,
+	}
+	for rate, expected := range cases {
+		got, err := ParseRate(rate)
+		if err != nil || got != expected {
+			t.Errorf("ParseRate(%q) = %d, %v, expected %d", rate, got, err, expected)
+		}
+	}
+
+	if _, err := ParseRate("fast"); err == nil {
+		t.Error("expected an error for an invalid rate")
+	}
+}
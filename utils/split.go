@@ -0,0 +1,288 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	"file-compressor/constants"
+)
+
+// SPLIT_DESCRIPTOR_EXT is appended to the entry path to name the JSON descriptor of a split entry.
+const SPLIT_DESCRIPTOR_EXT = ".parts.json"
+
+// PartInfo describes a single part of a split entry.
+type PartInfo struct {
+	File   string `json:"file"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// SplitDescriptor records the order, sizes and hashes of the parts of a split entry.
+// Part file names are stored relative to the descriptor so the set can be moved around.
+type SplitDescriptor struct {
+	Name      string     `json:"name"`
+	PartSize  int64      `json:"part_size"`
+	TotalSize int64      `json:"total_size"`
+	Parts     []PartInfo `json:"parts"`
+}
+
+// SplitWriter is an io.WriteCloser that spreads everything written to it across
+// files named <path>.part0001, <path>.part0002, ... each holding at most partSize bytes.
+// Close must be called to flush the last part and write the descriptor.
+type SplitWriter struct {
+	path     string
+	partSize int64
+
+	current     *os.File
+	currentHash hash.Hash
+	currentSize int64
+
+	descriptor SplitDescriptor
+}
+
+// NewSplitWriter creates a SplitWriter for the entry at path.
+//
+// Parameters:
+//   - path: the path the entry would have had if it was not split.
+//   - partSize: the maximum size of every part in bytes, must be greater than zero.
+//
+// Returns:
+//   - *SplitWriter: the writer.
+//   - error: an error if the part size is invalid.
+func NewSplitWriter(path string, partSize int64) (*SplitWriter, error) {
+	if partSize <= 0 {
+		return nil, fmt.Errorf("invalid part size: %d", partSize)
+	}
+
+	return &SplitWriter{
+		path:     path,
+		partSize: partSize,
+		descriptor: SplitDescriptor{
+			Name:     filepath.Base(path),
+			PartSize: partSize,
+			Parts:    []PartInfo{},
+		},
+	}, nil
+}
+
+// Write writes p across as many parts as needed. A new part is only opened when there
+// is data for it, so an entry whose size is a multiple of the part size has no empty trailing part.
+func (s *SplitWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if s.current == nil || s.currentSize == s.partSize {
+			if err := s.nextPart(); err != nil {
+				return written, err
+			}
+		}
+
+		chunk := p
+		if room := s.partSize - s.currentSize; int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+
+		n, err := s.current.Write(chunk)
+		s.currentHash.Write(chunk[:n])
+		s.currentSize += int64(n)
+		s.descriptor.TotalSize += int64(n)
+		written += n
+		if err != nil {
+			return written, fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+		}
+
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+// nextPart finishes the current part, if any, and opens the next one.
+func (s *SplitWriter) nextPart() error {
+	if err := s.finishPart(); err != nil {
+		return err
+	}
+
+	partPath := fmt.Sprintf("%s.part%04d", s.path, len(s.descriptor.Parts)+1)
+	file, err := os.Create(partPath)
+	if err != nil {
+		return fmt.Errorf(constants.FILE_CREATE_ERROR, err)
+	}
+
+	s.current = file
+	s.currentHash = sha256.New()
+	s.currentSize = 0
+
+	return nil
+}
+
+// finishPart closes the current part and records it in the descriptor.
+func (s *SplitWriter) finishPart() error {
+	if s.current == nil {
+		return nil
+	}
+
+	s.descriptor.Parts = append(s.descriptor.Parts, PartInfo{
+		File:   filepath.Base(s.current.Name()),
+		Size:   s.currentSize,
+		SHA256: hex.EncodeToString(s.currentHash.Sum(nil)),
+	})
+
+	err := s.current.Close()
+	s.current = nil
+	if err != nil {
+		return fmt.Errorf(constants.FILE_CLOSE_ERROR, err)
+	}
+
+	return nil
+}
+
+// Close flushes the last part and writes the JSON descriptor next to the parts.
+func (s *SplitWriter) Close() error {
+	if err := s.finishPart(); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s.descriptor, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode split descriptor: %v", err)
+	}
+
+	if err := os.WriteFile(s.DescriptorPath(), data, 0666); err != nil {
+		return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+	}
+
+	return nil
+}
+
+// Abort closes the current part and removes every part written so far, no descriptor is written.
+func (s *SplitWriter) Abort() error {
+	paths := []string{}
+	for _, part := range s.descriptor.Parts {
+		paths = append(paths, filepath.Join(filepath.Dir(s.path), part.File))
+	}
+	if s.current != nil {
+		s.current.Close()
+		paths = append(paths, s.current.Name())
+		s.current = nil
+	}
+
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf(constants.FILE_REMOVE_ERROR, err)
+		}
+	}
+
+	return nil
+}
+
+// DescriptorPath returns the path of the JSON descriptor written by Close.
+func (s *SplitWriter) DescriptorPath() string {
+	return s.path + SPLIT_DESCRIPTOR_EXT
+}
+
+// ReadSplitDescriptor reads and decodes the descriptor at path.
+func ReadSplitDescriptor(path string) (SplitDescriptor, error) {
+	descriptor := SplitDescriptor{}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return descriptor, fmt.Errorf(constants.FILE_READ_ERROR, err)
+	}
+
+	if err := json.Unmarshal(data, &descriptor); err != nil {
+		return descriptor, fmt.Errorf("invalid split descriptor: %v", err)
+	}
+
+	return descriptor, nil
+}
+
+// JoinParts reassembles a split entry from its descriptor, verifying the size and
+// SHA-256 hash of every part. On failure the partially joined output is removed.
+//
+// Parameters:
+//   - descriptorPath: the path of the JSON descriptor written by SplitWriter.
+//   - outputDir: the directory of the joined file, which keeps the original entry name.
+//     If empty, the directory of the descriptor is used.
+//   - progress: draws the progress of the join on stderr, see NewProgressWriter.
+//
+// Returns:
+//   - string: the path of the joined file.
+//   - error: an error if a part is missing, has the wrong size, or its hash does not match.
+func JoinParts(descriptorPath, outputDir string, progress bool) (string, error) {
+	descriptor, err := ReadSplitDescriptor(descriptorPath)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Dir(descriptorPath)
+	if outputDir == "" {
+		outputDir = dir
+	}
+
+	if err := MakeOutputDir(outputDir); err != nil {
+		return "", err
+	}
+
+	outputPath := filepath.Join(outputDir, filepath.Base(descriptor.Name))
+
+	output, err := os.Create(outputPath)
+	if err != nil {
+		return "", fmt.Errorf(constants.FILE_CREATE_ERROR, err)
+	}
+
+	if progress {
+		writer := NewProgressWriter(output, descriptor.TotalSize, "join")
+		err = joinParts(descriptor, dir, writer)
+		writer.Close()
+	} else {
+		err = joinParts(descriptor, dir, output)
+	}
+	if closeErr := output.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf(constants.FILE_CLOSE_ERROR, closeErr)
+	}
+	if err != nil {
+		os.Remove(outputPath)
+		return "", err
+	}
+
+	return outputPath, nil
+}
+
+func joinParts(descriptor SplitDescriptor, dir string, output io.Writer) error {
+	total := int64(0)
+	for _, part := range descriptor.Parts {
+		file, err := os.Open(filepath.Join(dir, filepath.Base(part.File)))
+		if err != nil {
+			return fmt.Errorf(constants.FILE_OPEN_ERROR, err)
+		}
+
+		hasher := sha256.New()
+		n, err := io.Copy(io.MultiWriter(output, hasher), file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf(constants.FILE_WRITE_ERROR, err)
+		}
+
+		if n != part.Size {
+			return fmt.Errorf("part '%s' has size %d, expected %d", part.File, n, part.Size)
+		}
+
+		if sum := hex.EncodeToString(hasher.Sum(nil)); sum != part.SHA256 {
+			return fmt.Errorf("part '%s' hash mismatch: expected %s, got %s", part.File, part.SHA256, sum)
+		}
+
+		total += n
+	}
+
+	if total != descriptor.TotalSize {
+		return fmt.Errorf("joined size %d does not match descriptor size %d", total, descriptor.TotalSize)
+	}
+
+	return nil
+}
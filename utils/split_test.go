@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeSplit(t *testing.T, dir string, data []byte, partSize int64) *SplitWriter {
+	writer, err := NewSplitWriter(filepath.Join(dir, "entry.bin"), partSize)
+	if err != nil {
+		t.Fatalf("failed to create split writer: %v", err)
+	}
+
+	// write in odd sized chunks so part boundaries fall inside writes
+	for start := 0; start < len(data); start += 7 {
+		end := min(start+7, len(data))
+		if _, err := writer.Write(data[start:end]); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close split writer: %v", err)
+	}
+
+	return writer
+}
+
+func TestSplitWriterBoundaries(t *testing.T) {
+	const partSize = 64
+
+	tests := []struct {
+		size  int
+		parts int
+	}{
+		{0, 0},
+		{1, 1},
+		{partSize - 1, 1},
+		{partSize, 1},
+		{partSize + 1, 2},
+		{3 * partSize, 3},
+		{3*partSize + 5, 4},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		data := bytes.Repeat([]byte("0123456789abcdef"), test.size/16+1)[:test.size]
+
+		writer := writeSplit(t, dir, data, partSize)
+
+		descriptor, err := ReadSplitDescriptor(writer.DescriptorPath())
+		if err != nil {
+			t.Fatalf("failed to read descriptor: %v", err)
+		}
+
+		if len(descriptor.Parts) != test.parts {
+			t.Fatalf("size %d: expected %d parts, got %d", test.size, test.parts, len(descriptor.Parts))
+		}
+
+		if descriptor.TotalSize != int64(test.size) {
+			t.Fatalf("size %d: descriptor total size is %d", test.size, descriptor.TotalSize)
+		}
+
+		for i, part := range descriptor.Parts {
+			if part.Size > partSize || part.Size == 0 {
+				t.Fatalf("size %d: part %d has invalid size %d", test.size, i, part.Size)
+			}
+			info, err := os.Stat(filepath.Join(dir, part.File))
+			if err != nil {
+				t.Fatalf("missing part file: %v", err)
+			}
+			if info.Size() != part.Size {
+				t.Fatalf("part %s is %d bytes, descriptor says %d", part.File, info.Size(), part.Size)
+			}
+		}
+
+		joined, err := JoinParts(writer.DescriptorPath(), filepath.Join(dir, "joined"), false)
+		if err != nil {
+			t.Fatalf("failed to join parts: %v", err)
+		}
+
+		joinedData, err := os.ReadFile(joined)
+		if err != nil {
+			t.Fatalf("failed to read joined file: %v", err)
+		}
+
+		if !bytes.Equal(data, joinedData) {
+			t.Fatalf("size %d: joined data does not match original", test.size)
+		}
+	}
+}
+
+func TestJoinPartsDetectsCorruption(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("squirrel"), 40)
+
+	writer := writeSplit(t, dir, data, 100)
+
+	descriptor, err := ReadSplitDescriptor(writer.DescriptorPath())
+	if err != nil {
+		t.Fatalf("failed to read descriptor: %v", err)
+	}
+
+	// flip a byte in the second part
+	partPath := filepath.Join(dir, descriptor.Parts[1].File)
+	part, err := os.ReadFile(partPath)
+	if err != nil {
+		t.Fatalf("failed to read part: %v", err)
+	}
+	part[0] ^= 0xFF
+	if err := os.WriteFile(partPath, part, 0666); err != nil {
+		t.Fatalf("failed to write part: %v", err)
+	}
+
+	outputDir := filepath.Join(dir, "joined")
+	if _, err := JoinParts(writer.DescriptorPath(), outputDir, false); err == nil {
+		t.Fatal("join should fail on a corrupted part")
+	}
+
+	if _, err := os.Stat(filepath.Join(outputDir, "entry.bin")); !os.IsNotExist(err) {
+		t.Fatal("partially joined output should be removed")
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"512", 512},
+		{"64KB", 64 * 1024},
+		{"100mb", 100 * 1024 * 1024},
+		{"4G", 4 * 1024 * 1024 * 1024},
+	}
+
+	for _, test := range tests {
+		size, err := ParseSize(test.input)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", test.input, err)
+		}
+		if size != test.expected {
+			t.Fatalf("%s: expected %d, got %d", test.input, test.expected, size)
+		}
+	}
+
+	for _, invalid := range []string{"", "MB", "-5", "abc", "0"} {
+		if _, err := ParseSize(invalid); err == nil {
+			t.Fatalf("%q should not parse", invalid)
+		}
+	}
+}
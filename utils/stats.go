@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// CompressionStats describes one compression or decompression: what was read and written, how
+// long it took and how fast the original data went through.
+type CompressionStats struct {
+	// Algorithm is the algorithm of the archive, empty when it could not be read.
+	Algorithm string `json:"algorithm"`
+	// OriginalBytes is the total size of the files before compression.
+	OriginalBytes uint64 `json:"original_bytes"`
+	// CompressedBytes is the size of the archive before encryption.
+	CompressedBytes uint64 `json:"compressed_bytes"`
+	// EncryptedBytes is the size of the encrypted archive, 0 when it is not encrypted.
+	EncryptedBytes uint64        `json:"encrypted_bytes"`
+	Duration       time.Duration `json:"duration_ns"`
+	FilesProcessed int           `json:"files_processed"`
+	// BytesPerSecond is OriginalBytes over Duration, set by Finish.
+	BytesPerSecond float64 `json:"bytes_per_second"`
+	// Files lists the processed files in the order they were reported by the codec.
+	Files []FileStats `json:"files"`
+}
+
+// FileStats holds the sizes of a single entry.
+type FileStats struct {
+	Name          string `json:"name"`
+	OriginalBytes uint64 `json:"original_bytes"`
+	// CompressedBytes is the size of the entry data in the archive, 0 when it is not known,
+	// see SetEntrySizes.
+	CompressedBytes uint64 `json:"compressed_bytes"`
+}
+
+// CountFiles returns opts with a progress function that counts every processed file in
+// FilesProcessed and lists it in Files, and adds its size to OriginalBytes when addSizes is set,
+// before calling the progress function of opts.
+//
+// Parameters:
+//   - opts: the options passed to the codec
+//   - addSizes: whether the sizes reported by the progress are the original bytes
+//
+// Returns:
+//   - []Option: opts followed by the counting progress function
+func (s *CompressionStats) CountFiles(opts []Option, addSizes bool) []Option {
+	progress := NewOptions(opts...).Progress
+	// the codecs that compress files concurrently may report them from several goroutines
+	var mu sync.Mutex
+	return append(append([]Option{}, opts...), WithProgress(func(filename string, bytesProcessed, totalBytes int64) {
+		mu.Lock()
+		s.FilesProcessed++
+		s.Files = append(s.Files, FileStats{Name: filename, OriginalBytes: uint64(bytesProcessed)})
+		if addSizes {
+			s.OriginalBytes += uint64(bytesProcessed)
+		}
+		mu.Unlock()
+		progress(filename, bytesProcessed, totalBytes)
+	}))
+}
+
+// SetEntrySizes copies the compressed sizes of the listed entries of the archive to Files, which
+// the progress function cannot report.
+func (s *CompressionStats) SetEntrySizes(entries []EntryInfo) {
+	compressed := map[string]uint64{}
+	for _, entry := range entries {
+		compressed[entry.Name] = entry.CompressedSize
+	}
+	for i := range s.Files {
+		s.Files[i].CompressedBytes = compressed[s.Files[i].Name]
+	}
+}
+
+// Finish sets Duration to the time since start and computes BytesPerSecond from it.
+func (s *CompressionStats) Finish(start time.Time) {
+	s.Duration = time.Since(start)
+	if s.Duration > 0 {
+		s.BytesPerSecond = float64(s.OriginalBytes) / s.Duration.Seconds()
+	}
+}
+
+// ArchiveBytes returns the size of the archive as it was written or read, encrypted or not.
+func (s CompressionStats) ArchiveBytes() uint64 {
+	if s.EncryptedBytes > 0 {
+		return s.EncryptedBytes
+	}
+	return s.CompressedBytes
+}
+
+// Ratio returns the sizes of the stats for printing.
+func (s CompressionStats) Ratio() FilesRatio {
+	return NewFilesRatio(s.OriginalBytes, s.ArchiveBytes())
+}
+
+// Summary returns the stats on one line, such as
+// "huffman: 3 files, 1.2 MB -> 400.0 KB (33.33%) in 12ms, 100.0 MB/s".
+func (s CompressionStats) Summary() string {
+	ratio := 0.0
+	if s.OriginalBytes > 0 {
+		ratio = float64(s.ArchiveBytes()) / float64(s.OriginalBytes) * 100
+	}
+	algorithm := s.Algorithm
+	if algorithm == "" {
+		algorithm = "unknown"
+	}
+	files := "files"
+	if s.FilesProcessed == 1 {
+		files = "file"
+	}
+	return fmt.Sprintf("%s: %d %s, %s -> %s (%.2f%%) in %s, %s/s", algorithm, s.FilesProcessed, files, FileSize(s.OriginalBytes), FileSize(s.ArchiveBytes()), ratio, s.Duration.Round(time.Millisecond), FileSize(uint64(s.BytesPerSecond)))
+}
+
+// JSON renders the stats as indented JSON.
+func (s CompressionStats) JSON() ([]byte, error) {
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// RunReport is the document printed by the CLI with -json for a compression or a
+// decompression, also when it fails.
+type RunReport struct {
+	Mode      MODE        `json:"mode"`
+	Algorithm string      `json:"algorithm,omitempty"`
+	Files     []FileStats `json:"files"`
+	// OriginalBytes and ArchiveBytes are the totals, the archive is counted as it was written
+	// or read, encrypted or not.
+	OriginalBytes uint64 `json:"original_bytes"`
+	ArchiveBytes  uint64 `json:"archive_bytes"`
+	// Ratio is ArchiveBytes in percent of OriginalBytes, 0 when nothing was read.
+	Ratio float64 `json:"ratio"`
+	// Outputs holds the path of the archive, or the paths of the extracted files.
+	Outputs  []string      `json:"outputs"`
+	Elapsed  time.Duration `json:"elapsed_ns"`
+	Warnings []string      `json:"warnings,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// NewRunReport returns the report of a run that ended with stats and wrote outputs.
+func NewRunReport(mode MODE, stats CompressionStats, outputs []string) RunReport {
+	report := RunReport{
+		Mode:          mode,
+		Algorithm:     stats.Algorithm,
+		Files:         stats.Files,
+		OriginalBytes: stats.OriginalBytes,
+		ArchiveBytes:  stats.ArchiveBytes(),
+		Outputs:       outputs,
+		Elapsed:       stats.Duration,
+	}
+	if report.Files == nil {
+		report.Files = []FileStats{}
+	}
+	if report.Outputs == nil {
+		report.Outputs = []string{}
+	}
+	if stats.OriginalBytes > 0 {
+		report.Ratio = float64(report.ArchiveBytes) / float64(stats.OriginalBytes) * 100
+	}
+	return report
+}
+
+// JSON renders the report as indented JSON.
+func (r RunReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompressionStats(t *testing.T) {
+	stats := CompressionStats{Algorithm: "huffman", OriginalBytes: 2048, CompressedBytes: 512, EncryptedBytes: 1024}
+
+	opts := stats.CountFiles(nil, false)
+	NewOptions(opts...).Progress("a.txt", 2048, 2048)
+	if stats.FilesProcessed != 1 || stats.OriginalBytes != 2048 {
+		t.Fatalf("expected one file and the sizes unchanged, got %+v", stats)
+	}
+
+	stats.Finish(time.Now().Add(-time.Second))
+	if stats.BytesPerSecond <= 0 || stats.BytesPerSecond > 2048 {
+		t.Fatalf("expected at most 2048 bytes per second, got %f", stats.BytesPerSecond)
+	}
+	stats.Duration = 1500 * time.Millisecond
+
+	if summary := stats.Summary(); summary != "huffman: 1 file, 2.0 KB -> 1.0 KB (50.00%) in 1.5s, 2.0 KB/s" {
+		t.Fatalf("unexpected summary: %s", summary)
+	}
+
+	data, err := stats.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := CompressionStats{}
+	if err := json.Unmarshal(data, &decoded); err != nil || !reflect.DeepEqual(decoded, stats) {
+		t.Fatalf("expected %+v, got %+v (%v)", stats, decoded, err)
+	}
+}
+
+func TestCompressionStatsCountSizes(t *testing.T) {
+	stats := CompressionStats{}
+	calls := 0
+	opts := stats.CountFiles([]Option{WithProgress(func(string, int64, int64) { calls++ })}, true)
+	progress := NewOptions(opts...).Progress
+	progress("a.txt", 10, -1)
+	progress("b.txt", 20, -1)
+
+	if stats.FilesProcessed != 2 || stats.OriginalBytes != 30 || calls != 2 {
+		t.Fatalf("expected 2 files of 30 bytes passed on to the progress, got %+v and %d calls", stats, calls)
+	}
+	if stats.Summary() != "unknown: 2 files, 30 B -> 0 B (0.00%) in 0s, 0 B/s" {
+		t.Fatalf("unexpected summary: %s", stats.Summary())
+	}
+}
+
+var update = flag.Bool("update", false, "rewrite the golden files of the JSON reports")
+
+func TestRunReport(t *testing.T) {
+	stats := CompressionStats{Algorithm: "deflate", OriginalBytes: 400, CompressedBytes: 100, Duration: time.Second, Files: []FileStats{{Name: "a.txt", OriginalBytes: 400}}}
+	stats.SetEntrySizes([]EntryInfo{{Name: "a.txt", CompressedSize: 90}, {Name: "b.txt", CompressedSize: 10}})
+	if stats.Files[0].CompressedBytes != 90 {
+		t.Fatalf("expected the compressed size of a.txt from its entry, got %+v", stats.Files)
+	}
+
+	report := NewRunReport(COMPRESS, stats, []string{"a.sq"})
+	if report.Ratio != 25 || report.ArchiveBytes != 100 || report.Elapsed != time.Second {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	// a failed run still prints every field, so scripts can read them without checking
+	failed := NewRunReport(DECOMPRESS, CompressionStats{}, nil)
+	failed.Error = "compressed file 'missing.sq' does not exist"
+	data, err := failed.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "run_report_error.golden")
+	if *update {
+		if err := os.WriteFile(golden, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read the golden file, run the test with -update to create it: %v", err)
+	}
+	if string(expected) != string(data)+"\n" {
+		t.Fatalf("the report does not match %s:\n%s", golden, data)
+	}
+}
@@ -0,0 +1,256 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+
+	"file-compressor/constants"
+	"file-compressor/format"
+)
+
+// FailureKind classifies why an archive entry failed verification.
+type FailureKind string
+
+const (
+	FAILURE_CRC_MISMATCH FailureKind = "crc mismatch"
+	FAILURE_TRUNCATED    FailureKind = "truncated"
+	FAILURE_UNDECODABLE  FailureKind = "undecodable"
+)
+
+// ErrChecksumMismatch is returned when the CRC-32 of an extracted entry differs from the one
+// stored in its header.
+type ErrChecksumMismatch struct {
+	Filename string
+	Expected uint32
+	Got      uint32
+}
+
+func (e *ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf(constants.CHECKSUM_MISMATCH, e.Filename, e.Expected, e.Got)
+}
+
+// VerifyStatus is the overall outcome of a verification run.
+type VerifyStatus string
+
+const (
+	VERIFY_OK         VerifyStatus = "ok"
+	VERIFY_DAMAGED    VerifyStatus = "damaged"
+	VERIFY_UNREADABLE VerifyStatus = "unreadable"
+)
+
+// Exit codes used by the CLI for each VerifyStatus.
+const (
+	EXIT_VERIFY_OK         = 0
+	EXIT_VERIFY_DAMAGED    = 1
+	EXIT_VERIFY_UNREADABLE = 2
+)
+
+// EntryFailure describes a single damaged entry.
+type EntryFailure struct {
+	// Name is the entry name, empty if the name itself could not be decoded.
+	Name string      `json:"name"`
+	Kind FailureKind `json:"kind"`
+	// Offset is the position of the entry header in the archive.
+	Offset int64 `json:"offset"`
+	// RemainderReachable reports whether the entries after this one could still be reached.
+	RemainderReachable bool   `json:"remainder_reachable"`
+	Error              string `json:"error"`
+}
+
+// VerifyReport collects the result of checking every entry of an archive.
+type VerifyReport struct {
+	Status VerifyStatus `json:"status"`
+	// Entries is the number of entries the archive header declares.
+	Entries uint64 `json:"entries"`
+	// Checked is the number of entries that were reached and checked.
+	Checked  uint64         `json:"checked"`
+	Failures []EntryFailure `json:"failures"`
+	// Structural holds the reason the archive could not be read at all.
+	Structural string `json:"structural_error,omitempty"`
+}
+
+// AddFailure records a damaged entry.
+func (r *VerifyReport) AddFailure(failure EntryFailure) {
+	r.Failures = append(r.Failures, failure)
+}
+
+// Finish computes the overall status from the collected failures.
+func (r *VerifyReport) Finish() {
+	switch {
+	case r.Structural != "":
+		r.Status = VERIFY_UNREADABLE
+	case len(r.Failures) > 0:
+		r.Status = VERIFY_DAMAGED
+	default:
+		r.Status = VERIFY_OK
+	}
+}
+
+// ExitCode maps the report status to the CLI exit code.
+func (r *VerifyReport) ExitCode() int {
+	switch r.Status {
+	case VERIFY_OK:
+		return EXIT_VERIFY_OK
+	case VERIFY_DAMAGED:
+		return EXIT_VERIFY_DAMAGED
+	default:
+		return EXIT_VERIFY_UNREADABLE
+	}
+}
+
+// OffsetBy shifts every recorded offset, used when the checked payload starts after an archive header.
+func (r *VerifyReport) OffsetBy(delta int64) {
+	for i := range r.Failures {
+		r.Failures[i].Offset += delta
+	}
+}
+
+// Table renders the report as a human readable table.
+func (r *VerifyReport) Table() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Status: %s (%d of %d entries checked, %d damaged)\n", r.Status, r.Checked, r.Entries, len(r.Failures))
+	if r.Structural != "" {
+		fmt.Fprintf(&sb, "Archive unreadable: %s\n", r.Structural)
+	}
+
+	if len(r.Failures) == 0 {
+		return sb.String()
+	}
+
+	fmt.Fprintf(&sb, "%-40s %-12s %-10s %-9s %s\n", "ENTRY", "KIND", "OFFSET", "REMAINDER", "ERROR")
+	for _, failure := range r.Failures {
+		name := failure.Name
+		if name == "" {
+			name = "<unknown>"
+		}
+		remainder := "lost"
+		if failure.RemainderReachable {
+			remainder = "ok"
+		}
+		fmt.Fprintf(&sb, "%-40s %-12s %-10d %-9s %s\n", name, failure.Kind, failure.Offset, remainder, failure.Error)
+	}
+
+	return sb.String()
+}
+
+// JSON renders the report as indented JSON.
+func (r *VerifyReport) JSON() ([]byte, error) {
+	if r.Failures == nil {
+		r.Failures = []EntryFailure{}
+	}
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// DecodeFunc decodes the compressedSize bytes of one entry from input into output.
+type DecodeFunc func(input io.Reader, output io.Writer, compressedSize uint64) error
+
+// VerifyEntries checks every entry of a payload made of an entry count and entries with
+// format.EntryHeader headers, the layout shared by all algorithms but Huffman. The entries are
+// decoded with decode and their output is discarded.
+//
+// Parameters:
+//   - input: An io.Reader positioned at the entry count.
+//   - decode: Decodes the data of a single entry.
+//
+// Returns:
+//   - VerifyReport: the collected report. Offsets are relative to the start of input.
+func VerifyEntries(input io.Reader, decode DecodeFunc) VerifyReport {
+	report := VerifyReport{}
+	counter := &CountingReader{Reader: input}
+
+	numOfFiles, err := format.ReadEntryCount(counter)
+	if err != nil {
+		report.Structural = err.Error()
+		report.Finish()
+		return report
+	}
+	report.Entries = numOfFiles
+
+	for i := uint64(0); i < numOfFiles; i++ {
+		offset := counter.BytesRead
+		report.Checked++
+
+		failure, reachable := verifyEntry(counter, decode)
+		if failure != nil {
+			failure.Offset = offset
+			failure.RemainderReachable = reachable && i+1 < numOfFiles
+			report.AddFailure(*failure)
+		}
+
+		if !reachable {
+			break
+		}
+	}
+
+	report.Finish()
+	return report
+}
+
+func verifyEntry(input *CountingReader, decode DecodeFunc) (*EntryFailure, bool) {
+	header, err := format.ReadEntryHeader(input)
+	if err != nil {
+		kind := FAILURE_UNDECODABLE
+		if input.EOF {
+			kind = FAILURE_TRUNCATED
+		}
+		// without the size the next entry cannot be found
+		return &EntryFailure{Name: string(header.Name), Kind: kind, Error: err.Error()}, false
+	}
+
+	return VerifyEntryData(input, string(header.Name), header.CRC32, header.CompressedSize, decode)
+}
+
+// VerifyEntryData decodes the data of an entry whose header has been read and compares its
+// checksum. Whatever the decoder leaves unread is skipped, so after a damaged entry the reader
+// is still positioned at the next entry header.
+//
+// Parameters:
+//   - input: The reader positioned at the entry data.
+//   - name: The entry name, used in the failure.
+//   - expectedCRC: The CRC-32 stored in the entry header.
+//   - compressedSize: The size of the entry data.
+//   - decode: Decodes the data of the entry.
+//
+// Returns:
+//   - *EntryFailure: the failure without offset, nil when the entry is intact
+//   - bool: whether the reader is positioned at the next entry header
+func VerifyEntryData(input io.Reader, name string, expectedCRC uint32, compressedSize uint64, decode DecodeFunc) (*EntryFailure, bool) {
+	entry := &io.LimitedReader{R: input, N: int64(compressedSize)}
+	checksum := crc32.NewIEEE()
+	var decodeErr error
+	// empty files have no data, the decoder is not needed
+	if compressedSize > 0 {
+		decodeErr = decode(entry, checksum, compressedSize)
+	}
+
+	// consume whatever the decoder left behind to resynchronize on the next entry
+	if _, err := io.Copy(io.Discard, entry); err != nil {
+		return &EntryFailure{Name: name, Kind: FAILURE_TRUNCATED, Error: fmt.Sprintf(constants.FILE_READ_ERROR, err)}, false
+	}
+
+	if entry.N > 0 {
+		return &EntryFailure{
+			Name:  name,
+			Kind:  FAILURE_TRUNCATED,
+			Error: fmt.Sprintf("entry data ends %d bytes early", entry.N),
+		}, false
+	}
+
+	if decodeErr != nil {
+		return &EntryFailure{Name: name, Kind: FAILURE_UNDECODABLE, Error: decodeErr.Error()}, true
+	}
+
+	if actualCRC := checksum.Sum32(); actualCRC != expectedCRC {
+		return &EntryFailure{
+			Name:  name,
+			Kind:  FAILURE_CRC_MISMATCH,
+			Error: (&ErrChecksumMismatch{Filename: name, Expected: expectedCRC, Got: actualCRC}).Error(),
+		}, true
+	}
+
+	return nil, true
+}